@@ -0,0 +1,155 @@
+// The admin command runs the operations on a Snippetbox database which can't (or can't yet) be done from the /admin
+// pages, like creating the first admin account on a new instance.
+//
+// Usage:
+//
+//	admin [flags] create-user [flags]      Add a user, reading their password from standard input.
+//	admin [flags] promote [flags] <email>  Give a user access to the /admin pages, or take it away with -revoke.
+//	admin [flags] reset-password <email>   Set a new password for a user, read from standard input, and log them out.
+//	admin [flags] purge-expired [flags]    Delete the snippets which have expired.
+//	admin [flags] migrate [up|down|version] Apply the migrations in the migrations directory, or roll back the last one.
+//
+// The database comes from the -dsn flag, or the SNIPPETBOX_DSN environment variable, as it does for the web server. Run
+// "admin <command> -h" to see the flags for each command.
+//
+// For example, to bootstrap a new instance:
+//
+//	admin migrate up
+//	echo "$ADMIN_PASSWORD" | admin create-user -name Alice -username alice -email alice@example.com -admin
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/emailaddr"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/alexedwards/scs/mysqlstore"
+	"github.com/alexedwards/scs/v2"
+	_ "github.com/go-sql-driver/mysql"
+	"io"
+	"os"
+	"time"
+)
+
+// The admin type holds what the commands work with. run() fills it in from the database, and the tests use mocks.
+type admin struct {
+	dsn      string
+	users    models.UserModelInterface
+	snippets models.SnippetModelInterface
+	sessions models.SessionModelInterface
+	store    scs.Store
+	stdin    io.Reader
+	stdout   io.Writer
+	now      func() time.Time
+}
+
+// A command is one of the subcommands. The run function is passed the arguments after the command name. Commands with
+// needsModels unset (like migrate, which has to work before the tables exist) only get the DSN.
+type command struct {
+	name        string
+	summary     string
+	needsModels bool
+	run         func(a *admin, args []string) error
+}
+
+var commands = []command{
+	{"create-user", "Add a user, reading their password from standard input", true, runCreateUser},
+	{"promote", "Give a user access to the /admin pages, or take it away with -revoke", true, runPromote},
+	{"reset-password", "Set a new password for a user, read from standard input, and log them out", true, runResetPassword},
+	{"purge-expired", "Delete the snippets which have expired", true, runPurgeExpired},
+	{"migrate", "Apply the migrations in the migrations directory, or roll back the last one", false, runMigrate},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run parses the global flags and dispatches to the named command, and returns the exit status.
+func run(args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer) int {
+	dsn := getenv("SNIPPETBOX_DSN")
+	if dsn == "" {
+		dsn = "web:pass@/snippetbox?parseTime=true"
+	}
+
+	// The email settings have to match the web server's, so that addresses are looked up the same way.
+	var normalizer emailaddr.Normalizer
+
+	fs := flag.NewFlagSet("admin", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&dsn, "dsn", dsn, "MySQL data source name (or set SNIPPETBOX_DSN)")
+	fs.BoolVar(&normalizer.Lowercase, "email-lowercase", true, "Treat email addresses as case-insensitive")
+	fs.BoolVar(&normalizer.CollapseGmail, "email-collapse-gmail", false, "Ignore dots and +aliases in Gmail addresses")
+	fs.BoolVar(&normalizer.StripPlusAliases, "email-strip-plus-aliases", false, "Ignore +aliases in all email addresses")
+	fs.Usage = func() { usage(fs) }
+
+	err := fs.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		usage(fs)
+		return 2
+	}
+
+	name := fs.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		a := &admin{dsn: dsn, stdin: stdin, stdout: stdout, now: time.Now}
+
+		if cmd.needsModels {
+			db, err := openDB(dsn)
+			if err != nil {
+				fmt.Fprintf(stderr, "admin %s: %s\n", cmd.name, err)
+				return 1
+			}
+			defer db.Close()
+
+			a.users = &models.UserModel{DB: db, Emails: normalizer}
+			a.snippets = &models.SnippetModel{DB: db}
+			a.sessions = &models.SessionModel{DB: db}
+			// The web server cleans up expired sessions, so there's no need for another goroutine doing it here.
+			a.store = mysqlstore.NewWithCleanupInterval(db, 0)
+		}
+
+		err := cmd.run(a, fs.Args()[1:])
+		if err != nil {
+			fmt.Fprintf(stderr, "admin %s: %s\n", cmd.name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "admin: unknown command %q\n", name)
+	usage(fs)
+	return 2
+}
+
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintln(w, "Usage: admin [flags] <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-15s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	fs.PrintDefaults()
+}
+
+// openDB opens a connection pool to the database and checks that it works, in the same way as the web server does.
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"github.com/0xshiku/snippetbox/internal/models/mocks"
+	"github.com/alexedwards/scs/v2/memstore"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     func(a *admin, args []string) error
+		args    []string
+		stdin   string
+		wantOut string
+		wantErr string
+	}{
+		{
+			name:    "Create user",
+			run:     runCreateUser,
+			args:    []string{"-name", "Bob", "-username", "bob", "-email", "bob@example.com"},
+			stdin:   "Correct-Horse-7\n",
+			wantOut: "created user bob@example.com\n",
+		},
+		{
+			name:    "Create admin",
+			run:     runCreateUser,
+			args:    []string{"-name", "Alice", "-username", "alice", "-email", "alice@example.com", "-admin"},
+			stdin:   "Correct-Horse-7",
+			wantOut: "created admin user alice@example.com\n",
+		},
+		{
+			name:    "Create user with an invalid username",
+			run:     runCreateUser,
+			args:    []string{"-name", "Bob", "-username", "b", "-email", "bob@example.com"},
+			stdin:   "Correct-Horse-7\n",
+			wantErr: "-username must be",
+		},
+		{
+			name:    "Create user with an invalid email",
+			run:     runCreateUser,
+			args:    []string{"-name", "Bob", "-username", "bob", "-email", "bob"},
+			stdin:   "Correct-Horse-7\n",
+			wantErr: "-email must be a valid email address",
+		},
+		{
+			name:    "Create user without a password",
+			run:     runCreateUser,
+			args:    []string{"-name", "Bob", "-username", "bob", "-email", "bob@example.com"},
+			wantErr: "expected a password on standard input",
+		},
+		{
+			name:    "Create user with a short password",
+			run:     runCreateUser,
+			args:    []string{"-name", "Bob", "-username", "bob", "-email", "bob@example.com"},
+			stdin:   "Sh0rt!\n",
+			wantErr: "password: must be at least 8 characters long",
+		},
+		{
+			name:    "Create user with a duplicate email",
+			run:     runCreateUser,
+			args:    []string{"-name", "Bob", "-username", "bob", "-email", "dup@example.com"},
+			stdin:   "Correct-Horse-7\n",
+			wantErr: "duplicate email",
+		},
+		{
+			name:    "Create admin with a duplicate email",
+			run:     runCreateUser,
+			args:    []string{"-name", "Bob", "-username", "bob", "-email", "dup@example.com", "-admin"},
+			stdin:   "Correct-Horse-7\n",
+			wantErr: "duplicate email",
+		},
+		{
+			name:    "Promote",
+			run:     runPromote,
+			args:    []string{"alice@example.com"},
+			wantOut: "alice@example.com is now an admin\n",
+		},
+		{
+			name:    "Revoke",
+			run:     runPromote,
+			args:    []string{"-revoke", "admin@example.com"},
+			wantOut: "admin@example.com is no longer an admin\n",
+		},
+		{
+			name:    "Promote an unknown user",
+			run:     runPromote,
+			args:    []string{"nobody@example.com"},
+			wantErr: "there isn't a user with the email address nobody@example.com",
+		},
+		{
+			name:    "Promote nobody",
+			run:     runPromote,
+			wantErr: "expected the email address of one user",
+		},
+		{
+			name:    "Reset password",
+			run:     runResetPassword,
+			args:    []string{"alice@example.com"},
+			stdin:   "Correct-Horse-7\r\n",
+			wantOut: "reset the password for alice@example.com, and logged them out of 1 sessions\n",
+		},
+		{
+			name:    "Reset password for an unknown user",
+			run:     runResetPassword,
+			args:    []string{"nobody@example.com"},
+			stdin:   "Correct-Horse-7\n",
+			wantErr: "there isn't a user with the email address nobody@example.com",
+		},
+		{
+			name:    "Purge expired",
+			run:     runPurgeExpired,
+			args:    []string{"-older-than", "720h"},
+			wantOut: "deleted 3 expired snippets\n",
+		},
+		{
+			name:    "Purge expired with a negative age",
+			run:     runPurgeExpired,
+			args:    []string{"-older-than", "-1h"},
+			wantErr: "-older-than can't be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+
+			a := &admin{
+				users:    &mocks.UserModel{},
+				snippets: &mocks.SnippetModel{},
+				sessions: &mocks.SessionModel{},
+				store:    memstore.NewWithCleanupInterval(0),
+				stdin:    strings.NewReader(tt.stdin),
+				stdout:   &stdout,
+				now:      func() time.Time { return time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC) },
+			}
+
+			err := tt.run(a, tt.args)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error containing %q", tt.wantErr)
+				}
+				asserts.StringContains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			asserts.NilError(t, err)
+			asserts.Equal(t, stdout.String(), tt.wantOut)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	getenv := func(string) string { return "" }
+
+	t.Run("No command", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+
+		status := run(nil, getenv, strings.NewReader(""), &stdout, &stderr)
+
+		asserts.Equal(t, status, 2)
+		asserts.StringContains(t, stderr.String(), "Usage: admin [flags] <command> [flags]")
+		asserts.StringContains(t, stderr.String(), "create-user")
+	})
+
+	t.Run("Unknown command", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+
+		status := run([]string{"frobnicate"}, getenv, strings.NewReader(""), &stdout, &stderr)
+
+		asserts.Equal(t, status, 2)
+		asserts.StringContains(t, stderr.String(), `admin: unknown command "frobnicate"`)
+	})
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/go-sql-driver/mysql"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The migration files are named in the same way as for the migrate tool, like 000001_create_snippets_table.up.sql.
+var migrationFileRX = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Only one copy of the command can be migrating the database at a time, which is enforced with a MySQL named lock.
+const (
+	migrationLock        = "snippetbox_migrate"
+	migrationLockTimeout = 10
+)
+
+// A migration is a pair of files in the migrations directory, one which makes a change to the schema and one which
+// undoes it.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// runMigrate applies the migrations, rolls back the last one, or shows the version the database is at. It keeps track
+// in the schema_migrations table in the same way as the migrate tool does, so that either can be used on a database,
+// and so that the web server's schema version check works after either.
+func runMigrate(a *admin, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := fs.String("dir", "./migrations", "The directory of migration files")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: admin migrate [flags] [up|down|version]")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	action := "up"
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		action = fs.Arg(0)
+	default:
+		fs.Usage()
+		return errors.New("expected at most one of up, down or version")
+	}
+	if action != "up" && action != "down" && action != "version" {
+		fs.Usage()
+		return fmt.Errorf("unknown action %q", action)
+	}
+
+	migrations, err := loadMigrations(*dir)
+	if err != nil {
+		return err
+	}
+
+	// The migration files have more than one statement in them, which the driver only allows if it's asked to.
+	cfg, err := mysql.ParseDSN(a.dsn)
+	if err != nil {
+		return err
+	}
+	cfg.MultiStatements = true
+
+	db, err := openDB(cfg.FormatDSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	// The lock belongs to a connection, so everything is done on the same one.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, migrationLock, migrationLockTimeout).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return errors.New("another migration is running")
+	}
+	defer conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, migrationLock)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	if action == "version" {
+		if dirty {
+			fmt.Fprintf(a.stdout, "database is at version %d, but it failed part way through (dirty)\n", version)
+		} else {
+			fmt.Fprintf(a.stdout, "database is at version %d\n", version)
+		}
+		fmt.Fprintf(a.stdout, "this version of the code needs version %d\n", models.SchemaVersion)
+		return nil
+	}
+
+	if dirty {
+		return fmt.Errorf("migration %d failed part way through, so the database needs fixing by hand, and its version setting in schema_migrations", version)
+	}
+
+	if action == "down" {
+		return migrateDown(ctx, a, conn, migrations, version)
+	}
+	return migrateUp(ctx, a, conn, migrations, version)
+}
+
+// migrateUp applies the migrations after the current version, in order, stopping at the first one that fails.
+func migrateUp(ctx context.Context, a *admin, conn *sql.Conn, migrations []migration, version int) error {
+	applied := 0
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		err := applyMigration(ctx, conn, m.up, m.version)
+		if err != nil {
+			return fmt.Errorf("applying %d_%s: %w", m.version, m.name, err)
+		}
+
+		fmt.Fprintf(a.stdout, "applied %d_%s\n", m.version, m.name)
+		applied++
+	}
+
+	if applied == 0 {
+		fmt.Fprintf(a.stdout, "database is already at version %d\n", version)
+	}
+	return nil
+}
+
+// migrateDown rolls back the migration the database is at, leaving it at the one before.
+func migrateDown(ctx context.Context, a *admin, conn *sql.Conn, migrations []migration, version int) error {
+	if version == 0 {
+		return errors.New("there are no migrations to roll back")
+	}
+
+	for i, m := range migrations {
+		if m.version != version {
+			continue
+		}
+
+		previous := 0
+		if i > 0 {
+			previous = migrations[i-1].version
+		}
+
+		err := applyMigration(ctx, conn, m.down, previous)
+		if err != nil {
+			return fmt.Errorf("rolling back %d_%s: %w", m.version, m.name, err)
+		}
+
+		fmt.Fprintf(a.stdout, "rolled back %d_%s\n", m.version, m.name)
+		return nil
+	}
+
+	return fmt.Errorf("there isn't a migration file for version %d", version)
+}
+
+// applyMigration runs a migration file, and then records the version that the database is at. As MySQL can't roll back
+// schema changes, the version is marked as dirty while the file runs, so that if it fails part way through, nothing else
+// is run until somebody has looked at it.
+func applyMigration(ctx context.Context, conn *sql.Conn, path string, version int) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = setSchemaVersion(ctx, conn, version, true)
+	if err != nil {
+		return err
+	}
+
+	if stmt := strings.TrimSpace(string(b)); stmt != "" {
+		_, err = conn.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return setSchemaVersion(ctx, conn, version, false)
+}
+
+// schemaVersion returns the version recorded in schema_migrations, which is 0 before any migrations have been applied.
+func schemaVersion(ctx context.Context, conn *sql.Conn) (int, bool, error) {
+	var version int
+	var dirty bool
+
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// setSchemaVersion records the version, in the one row of schema_migrations. Version 0 is recorded by leaving the table
+// empty, as the migrate tool does.
+func setSchemaVersion(ctx context.Context, conn *sql.Conn, version int, dirty bool) error {
+	_, err := conn.ExecContext(ctx, `TRUNCATE TABLE schema_migrations`)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+
+	_, err = conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)`, version, dirty)
+	return err
+}
+
+// loadMigrations returns the migrations in the directory, sorted by version. Every migration needs both an up and a down
+// file, so that it can be rolled back.
+func loadMigrations(dir string) ([]migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+
+	for _, entry := range entries {
+		matches := migrationFileRX.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(matches[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("%s: invalid version", entry.Name())
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: matches[2]}
+			byVersion[version] = m
+		} else if m.name != matches[2] {
+			return nil, fmt.Errorf("%s: version %d is already used by %s", entry.Name(), version, m.name)
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if matches[3] == "up" {
+			m.up = path
+		} else {
+			m.down = path
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	slices.SortFunc(migrations, func(a, b migration) int { return a.version - b.version })
+
+	return migrations, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("Repository migrations", func(t *testing.T) {
+		migrations, err := loadMigrations("../../migrations")
+		asserts.NilError(t, err)
+
+		// The migrations are numbered without gaps, and the last one is the one the code needs.
+		for i, m := range migrations {
+			asserts.Equal(t, m.version, i+1)
+		}
+		asserts.Equal(t, migrations[len(migrations)-1].version, models.SchemaVersion)
+	})
+
+	t.Run("Missing down file", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, name := range []string{"000001_create_a.up.sql", "000001_create_a.down.sql", "000002_create_b.up.sql", "README.md"} {
+			err := os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+			asserts.NilError(t, err)
+		}
+
+		_, err := loadMigrations(dir)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		asserts.StringContains(t, err.Error(), "migration 2_create_b needs both an up and a down file")
+	})
+
+	t.Run("Duplicate version", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, name := range []string{"000001_create_a.up.sql", "000001_create_b.up.sql"} {
+			err := os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+			asserts.NilError(t, err)
+		}
+
+		_, err := loadMigrations(dir)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		asserts.StringContains(t, err.Error(), "version 1 is already used")
+	})
+}
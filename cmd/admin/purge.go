@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// runPurgeExpired deletes the snippets which have expired, along with their reactions, mirrors and notifications (which
+// the foreign keys take care of). With -older-than, only the ones which expired at least that long ago are deleted, to give
+// their authors a chance to notice and renew them.
+func runPurgeExpired(a *admin, args []string) error {
+	fs := flag.NewFlagSet("purge-expired", flag.ContinueOnError)
+	olderThan := fs.Duration("older-than", 0, "Only delete snippets which expired at least this long ago")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *olderThan < 0 {
+		return errors.New("-older-than can't be negative")
+	}
+
+	n, err := a.snippets.PurgeExpired(a.now().Add(-*olderThan))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "deleted %d expired snippets\n", n)
+	return nil
+}
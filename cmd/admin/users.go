@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/password"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"strings"
+)
+
+// The createUserConfig type holds the flags for the create-user command.
+type createUserConfig struct {
+	name      string
+	username  string
+	email     string
+	isAdmin   bool
+	minLength int
+}
+
+// runCreateUser adds a user, with the same checks as the signup form (apart from the ones which need the web server's
+// configuration, like blocking disposable email addresses). The password is read from standard input, so that it
+// doesn't end up in the shell's history.
+func runCreateUser(a *admin, args []string) error {
+	var cfg createUserConfig
+
+	fs := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	fs.StringVar(&cfg.name, "name", "", "The user's name")
+	fs.StringVar(&cfg.username, "username", "", "The user's username, for their profile URL")
+	fs.StringVar(&cfg.email, "email", "", "The user's email address, which they log in with")
+	fs.BoolVar(&cfg.isAdmin, "admin", false, "Give the user access to the /admin pages")
+	fs.IntVar(&cfg.minLength, "password-min-length", 8, "Minimum password length")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !validators.NotBlank(cfg.name) || !validators.MaxChars(cfg.name, 255):
+		return errors.New("-name must be given, and can't be more than 255 characters long")
+	case !validators.Matches(cfg.username, validators.UsernameRX):
+		return errors.New("-username must be 3-30 letters, numbers, underscores or hyphens")
+	case !validators.Matches(cfg.email, validators.EmailRX) || len(cfg.email) > validators.MaxEmailLength:
+		return errors.New("-email must be a valid email address")
+	}
+
+	pw, err := a.readPassword(cfg.minLength)
+	if err != nil {
+		return err
+	}
+
+	if cfg.isAdmin {
+		err = a.users.InsertAdmin(cfg.name, cfg.username, cfg.email, pw)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(a.stdout, "created admin user %s\n", cfg.email)
+		return nil
+	}
+
+	err = a.users.Insert(cfg.name, cfg.username, cfg.email, pw)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "created user %s\n", cfg.email)
+	return nil
+}
+
+// runPromote makes the user with the given email address an admin, or with -revoke, stops them being one. They don't
+// have to log in again for it to take effect.
+func runPromote(a *admin, args []string) error {
+	fs := flag.NewFlagSet("promote", flag.ContinueOnError)
+	revoke := fs.Bool("revoke", false, "Take away the user's access to the /admin pages instead")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: admin promote [flags] <email>")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected the email address of one user")
+	}
+
+	user, err := a.findUser(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	err = a.users.SetAdmin(user.ID, !*revoke)
+	if err != nil {
+		return err
+	}
+
+	if *revoke {
+		fmt.Fprintf(a.stdout, "%s is no longer an admin\n", user.Email)
+	} else {
+		fmt.Fprintf(a.stdout, "%s is now an admin\n", user.Email)
+	}
+	return nil
+}
+
+// runResetPassword sets a new password for the user with the given email address, read from standard input, for when
+// they've lost theirs and can't get in any other way. They're logged out everywhere, in case somebody else had it.
+func runResetPassword(a *admin, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	minLength := fs.Int("password-min-length", 8, "Minimum password length")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: admin reset-password [flags] <email>   (reads the new password from standard input)")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected the email address of one user")
+	}
+
+	user, err := a.findUser(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	pw, err := a.readPassword(*minLength)
+	if err != nil {
+		return err
+	}
+
+	err = a.users.PasswordReset(user.ID, pw)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := a.sessions.AllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		err = a.store.Delete(s.Token)
+		if err != nil {
+			return err
+		}
+		err = a.sessions.Delete(s.Token)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(a.stdout, "reset the password for %s, and logged them out of %d sessions\n", user.Email, len(sessions))
+	return nil
+}
+
+// findUser returns the user with the email address, with a clearer error than ErrNoRecord if there isn't one.
+func (a *admin) findUser(email string) (*models.User, error) {
+	user, err := a.users.GetByEmail(email)
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil, fmt.Errorf("there isn't a user with the email address %s", email)
+	}
+	return user, err
+}
+
+// readPassword reads a password from the first line of standard input, and checks it against the password policy.
+func (a *admin) readPassword(minLength int) (string, error) {
+	line, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("expected a password on standard input")
+	}
+
+	pw := strings.TrimRight(line, "\r\n")
+	if pw == "" {
+		return "", errors.New("expected a password on standard input")
+	}
+
+	if message := password.NewPolicy(minLength).Check(pw); message != "" {
+		return "", fmt.Errorf("password: %s", strings.TrimPrefix(message, "This field "))
+	}
+
+	return pw, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// The client type sends requests to the server's JSON API.
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// request sends a request to the API, with input (if it isn't nil) as the JSON body, and returns the response if it was
+// successful. Otherwise it returns the error message from the response. The caller has to close the response body.
+func (c *client) request(method, path string, input any) (*http.Response, error) {
+	var body io.Reader
+	if input != nil {
+		js, err := json.Marshal(input)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	rs, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rs.StatusCode >= 300 {
+		defer rs.Body.Close()
+		return nil, responseError(rs)
+	}
+
+	return rs, nil
+}
+
+// do sends a request to the API, and decodes the JSON response into output.
+func (c *client) do(method, path string, input, output any) error {
+	rs, err := c.request(method, path, input)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	return json.NewDecoder(rs.Body).Decode(output)
+}
+
+// responseError turns an error response into an error. The API's errors are problem details (RFC 7807), with the
+// invalid fields listed for validation errors. Anything else (like a proxy's error page) is reported by its status.
+func responseError(rs *http.Response) error {
+	var problem struct {
+		Title  string            `json:"title"`
+		Detail string            `json:"detail"`
+		Errors map[string]string `json:"errors"`
+	}
+	err := json.NewDecoder(io.LimitReader(rs.Body, 1<<20)).Decode(&problem)
+	if err != nil || problem.Title == "" {
+		return fmt.Errorf("the server responded with %s", rs.Status)
+	}
+
+	if len(problem.Errors) > 0 {
+		problems := make([]string, 0, len(problem.Errors))
+		for field, message := range problem.Errors {
+			problems = append(problems, field+" "+message)
+		}
+		slices.Sort(problems)
+		return errors.New(strings.Join(problems, ", "))
+	}
+
+	if problem.Detail != "" {
+		return errors.New(problem.Detail)
+	}
+	return errors.New(strings.ToLower(problem.Title))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The postConfig type holds the flags for the post command.
+type postConfig struct {
+	title    string
+	expires  int
+	unlisted bool
+}
+
+// runPost creates a snippet from a file, or from standard input if there isn't one, and prints its URL. Snippets from
+// a file are named after it, unless -title is set. Otherwise the server names them after the language they're in.
+func runPost(c *client, args []string, stdin io.Reader, stdout io.Writer) error {
+	var cfg postConfig
+
+	fs := flag.NewFlagSet("post", flag.ContinueOnError)
+	fs.StringVar(&cfg.title, "title", "", "Title of the snippet")
+	fs.IntVar(&cfg.expires, "expires", 0, "Days until the snippet expires: 1, 7 or 365 (defaults to 7)")
+	fs.BoolVar(&cfg.unlisted, "unlisted", false, "Only show the snippet to people with the link")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snip post [flags] [file]   (reads standard input if there's no file, or it's -)")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("expected at most one file to post")
+	}
+
+	in := stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+
+		if cfg.title == "" {
+			cfg.title = filepath.Base(name)
+		}
+	}
+
+	content, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return errors.New("there's nothing to post")
+	}
+
+	input := map[string]any{
+		"title":   cfg.title,
+		"content": string(content),
+		"expires": cfg.expires,
+	}
+	if cfg.unlisted {
+		input["visibility"] = "unlisted"
+	}
+
+	var output struct {
+		URL string `json:"url"`
+	}
+	err = c.do(http.MethodPost, "/api/v1/quick", input, &output)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, output.URL)
+	return nil
+}
+
+// runList lists the user's unexpired snippets, fetching every page of the list.
+func runList(c *client, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	sort := fs.String("sort", "-created", "Order to list the snippets in: created, expires or title, with a - in front to reverse it")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEXPIRES\tVISIBILITY\tTITLE")
+
+	for page := 1; ; page++ {
+		var output struct {
+			Snippets []apiSnippet `json:"snippets"`
+			Metadata struct {
+				LastPage int `json:"last_page"`
+			} `json:"metadata"`
+		}
+
+		query := url.Values{"page": {strconv.Itoa(page)}, "page_size": {"100"}, "sort": {*sort}}
+		err = c.do(http.MethodGet, "/api/v1/snippets?"+query.Encode(), nil, &output)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range output.Snippets {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.ID, s.Expires.Local().Format("2006-01-02 15:04"), s.Visibility, s.Title)
+		}
+
+		if page >= output.Metadata.LastPage {
+			break
+		}
+	}
+
+	return tw.Flush()
+}
+
+// The apiSnippet type is a snippet, as the API returns it.
+type apiSnippet struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Expires    time.Time `json:"expires"`
+	Visibility string    `json:"visibility"`
+	URL        string    `json:"url"`
+}
+
+// runGet prints a snippet's content, exactly as it was saved, so that it can be piped into another command.
+func runGet(c *client, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snip get <id>   (or the snippet's URL)")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one snippet to get")
+	}
+
+	// Accept the URL of the snippet's page, because that's what gets shared.
+	id := strings.TrimSuffix(fs.Arg(0), "/")
+	if u, err := url.Parse(id); err == nil && u.Path != "" {
+		id = path.Base(u.Path)
+	}
+
+	var output struct {
+		Snippet apiSnippet `json:"snippet"`
+	}
+	err = c.do(http.MethodGet, "/api/v1/snippet/"+url.PathEscape(id), nil, &output)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(stdout, output.Snippet.Content)
+	return err
+}
+
+// runPair swaps a pairing code for an API token, and prints it. The token isn't saved anywhere, so that it's up to the
+// user how to keep it (usually in SNIPPETBOX_TOKEN).
+func runPair(c *client, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("pair", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snip pair <code>   (generate a code at /account/pair)")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a pairing code")
+	}
+
+	var output struct {
+		Token string `json:"token"`
+	}
+	err = c.do(http.MethodPost, "/api/v1/pair", map[string]string{"code": fs.Arg(0)}, &output)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, output.Token)
+	return nil
+}
@@ -0,0 +1,109 @@
+// The snip command shares snippets from the terminal, using a Snippetbox server's JSON API.
+//
+// Usage:
+//
+//	snip [flags] post [flags] [file]   Create a snippet from a file, or standard input, and print its URL.
+//	snip [flags] list                  List your unexpired snippets.
+//	snip [flags] get [flags] <id>      Print a snippet's content. The ID can be the snippet's URL too.
+//	snip [flags] pair <code>           Swap a pairing code from /account/pair for an API token.
+//
+// The server and API token come from the -url and -token flags, or the SNIPPETBOX_URL and SNIPPETBOX_TOKEN environment
+// variables. Run "snip <command> -h" to see the flags for each command.
+//
+// For example, to share the output of a failing test:
+//
+//	go test ./... 2>&1 | snip post -title "Failing tests"
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// A command is one of the subcommands. The run function is passed the arguments after the command name.
+type command struct {
+	name    string
+	summary string
+	run     func(c *client, args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"post", "Create a snippet from a file, or standard input, and print its URL", runPost},
+	{"list", "List your unexpired snippets", runList},
+	{"get", "Print a snippet's content", runGet},
+	{"pair", "Swap a pairing code from /account/pair for an API token", runPair},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run parses the global flags and dispatches to the named command, and returns the exit status.
+func run(args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer) int {
+	baseURL := getenv("SNIPPETBOX_URL")
+	if baseURL == "" {
+		baseURL = "https://localhost:4000"
+	}
+
+	fs := flag.NewFlagSet("snip", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	url := fs.String("url", baseURL, "Base URL of the Snippetbox server (or set SNIPPETBOX_URL)")
+	token := fs.String("token", getenv("SNIPPETBOX_TOKEN"), "API token (or set SNIPPETBOX_TOKEN)")
+	insecure := fs.Bool("insecure", false, "Don't verify the server's TLS certificate, for the self-signed development certificate")
+	fs.Usage = func() { usage(fs) }
+
+	err := fs.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		usage(fs)
+		return 2
+	}
+
+	c := &client{
+		baseURL: strings.TrimSuffix(*url, "/"),
+		token:   *token,
+		http: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure},
+			},
+		},
+	}
+
+	name := fs.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			err := cmd.run(c, fs.Args()[1:], stdin, stdout)
+			if err != nil {
+				fmt.Fprintf(stderr, "snip %s: %s\n", cmd.name, err)
+				return 1
+			}
+			return 0
+		}
+	}
+
+	fmt.Fprintf(stderr, "snip: unknown command %q\n", name)
+	usage(fs)
+	return 2
+}
+
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintln(w, "Usage: snip [flags] <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-6s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	fs.PrintDefaults()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestAPI starts a fake API server, which only accepts the token "secret", and returns its URL.
+func newTestAPI(t *testing.T) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/quick", func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]any
+		json.NewDecoder(r.Body).Decode(&input)
+
+		if input["content"] == "too long\n" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"type":"about:blank","title":"Unprocessable Entity","status":422,"errors":{"title":"must not be more than 100 characters long","content":"is too big"}}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"url":"https://example.com/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A?title=` + input["title"].(string) + `"}`))
+	})
+	mux.HandleFunc("GET /api/v1/snippets", func(w http.ResponseWriter, r *http.Request) {
+		// One snippet on each page, so that the list has to fetch both of them.
+		if r.URL.Query().Get("page") == "2" {
+			w.Write([]byte(`{"snippets":[{"id":"01HV5Q3B4C5D6E7F8G9H0J1K2M","title":"A hidden haiku","expires":"2024-01-08T00:00:00Z","visibility":"unlisted"}],"metadata":{"current_page":2,"last_page":2}}`))
+			return
+		}
+		w.Write([]byte(`{"snippets":[{"id":"01HV5Q2X8N3K7M4R6T9W0Y1Z2A","title":"An old silent pond","expires":"2024-01-08T00:00:00Z","visibility":"public"}],"metadata":{"current_page":1,"last_page":2}}`))
+	})
+	mux.HandleFunc("GET /api/v1/snippet/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "01HV5Q2X8N3K7M4R6T9W0Y1Z2A" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"type":"about:blank","title":"Not Found","status":404,"detail":"the requested snippet could not be found"}`))
+			return
+		}
+		w.Write([]byte(`{"snippet":{"id":"01HV5Q2X8N3K7M4R6T9W0Y1Z2A","content":"An old silent pond..."}}`))
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"type":"about:blank","title":"Unauthorized","status":401,"detail":"invalid or missing authentication token"}`))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts.URL
+}
+
+func TestRun(t *testing.T) {
+	baseURL := newTestAPI(t)
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		token      string
+		wantStatus int
+		wantOut    string
+		wantErr    string
+	}{
+		{
+			name:    "Post",
+			args:    []string{"post", "-title", "Build"},
+			stdin:   "FAIL\n",
+			token:   "secret",
+			wantOut: "https://example.com/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A?title=Build\n",
+		},
+		{
+			name:       "Post nothing",
+			args:       []string{"post"},
+			stdin:      "\n\n",
+			token:      "secret",
+			wantStatus: 1,
+			wantErr:    "snip post: there's nothing to post\n",
+		},
+		{
+			name:       "Post invalid",
+			args:       []string{"post"},
+			stdin:      "too long\n",
+			token:      "secret",
+			wantStatus: 1,
+			wantErr:    "snip post: content is too big, title must not be more than 100 characters long\n",
+		},
+		{
+			name:    "List",
+			args:    []string{"list"},
+			token:   "secret",
+			wantOut: "01HV5Q3B4C5D6E7F8G9H0J1K2M",
+		},
+		{
+			name:    "Get",
+			args:    []string{"get", "01HV5Q2X8N3K7M4R6T9W0Y1Z2A"},
+			token:   "secret",
+			wantOut: "An old silent pond...",
+		},
+		{
+			name:    "Get by URL",
+			args:    []string{"get", "https://example.com/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A"},
+			token:   "secret",
+			wantOut: "An old silent pond...",
+		},
+		{
+			name:       "Get missing",
+			args:       []string{"get", "01HV5Q2X8N3K7M4R6T9W0Y1Z9Z"},
+			token:      "secret",
+			wantStatus: 1,
+			wantErr:    "snip get: the requested snippet could not be found\n",
+		},
+		{
+			name:       "Wrong token",
+			args:       []string{"list"},
+			token:      "wrong",
+			wantStatus: 1,
+			wantErr:    "snip list: invalid or missing authentication token\n",
+		},
+		{
+			name:    "Token flag",
+			args:    []string{"-token", "secret", "list"},
+			token:   "wrong",
+			wantOut: "An old silent pond",
+		},
+		{
+			name:       "Unknown command",
+			args:       []string{"delete"},
+			wantStatus: 2,
+			wantErr:    `snip: unknown command "delete"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"SNIPPETBOX_URL": baseURL, "SNIPPETBOX_TOKEN": tt.token}
+
+			var stdout, stderr strings.Builder
+			status := run(tt.args, func(key string) string { return env[key] }, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+			asserts.Equal(t, status, tt.wantStatus)
+			asserts.StringContains(t, stdout.String(), tt.wantOut)
+			if tt.wantErr == "" {
+				asserts.Equal(t, stderr.String(), "")
+			} else {
+				asserts.StringContains(t, stderr.String(), tt.wantErr)
+			}
+		})
+	}
+}
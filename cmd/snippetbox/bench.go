@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// This matches the links on the home page, which is where the benchmark finds snippets to request.
+var snippetLinkRX = regexp.MustCompile(`href='(/snippet/view/[0-9A-Za-z]+)'`)
+
+// The benchConfig type holds the flags for the bench command.
+type benchConfig struct {
+	url         string
+	duration    time.Duration
+	concurrency int
+	seed        uint64
+	insecure    bool
+	users       int
+	prefix      string
+}
+
+// A route is a group of URLs that we report on together, like all the snippet pages.
+type route struct {
+	name  string
+	paths []string
+}
+
+// runBench sends requests to the key routes of a running server for a fixed time, and reports the throughput and
+// latency of each. Run it before and after a change (against the same data, from loadgen) to see what difference it makes.
+func runBench(args []string, stdout io.Writer) error {
+	var cfg benchConfig
+
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.StringVar(&cfg.url, "url", "https://localhost:4000", "Base URL of the server")
+	fs.DurationVar(&cfg.duration, "duration", 10*time.Second, "How long to send requests for")
+	fs.IntVar(&cfg.concurrency, "concurrency", 8, "Number of requests to send at once")
+	fs.Uint64Var(&cfg.seed, "seed", 1, "Seed for choosing which URLs to request")
+	fs.BoolVar(&cfg.insecure, "insecure", true, "Don't verify the server's TLS certificate (the development certificate is self-signed)")
+	fs.IntVar(&cfg.users, "users", 1000, "Number of users created by loadgen, whose profile pages will be requested (0 to skip profiles)")
+	fs.StringVar(&cfg.prefix, "prefix", "load", "Prefix that loadgen used for the usernames")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if cfg.concurrency < 1 || cfg.duration <= 0 {
+		return errors.New("the concurrency and duration must be positive")
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: cfg.insecure},
+			MaxIdleConnsPerHost: cfg.concurrency,
+		},
+		// Report redirects as they are, rather than timing the page they lead to.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	base := strings.TrimSuffix(cfg.url, "/")
+
+	routes, err := discoverRoutes(client, base, cfg)
+	if err != nil {
+		return err
+	}
+
+	results := benchmark(client, base, routes, cfg)
+
+	fmt.Fprintf(stdout, "%d workers for %s against %s\n\n", cfg.concurrency, cfg.duration, base)
+	writeResults(stdout, results, cfg.duration)
+	return nil
+}
+
+// discoverRoutes fetches the home page, and returns the routes to benchmark, using the snippets linked from it. The profile pages
+// aren't linked from anywhere public, so we use the usernames that loadgen creates instead.
+func discoverRoutes(client *http.Client, base string, cfg benchConfig) ([]route, error) {
+	resp, err := client.Get(base + "/")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the home page: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := []route{
+		{name: "home", paths: []string{"/"}},
+		{name: "about", paths: []string{"/about"}},
+		{name: "login", paths: []string{"/user/login"}},
+	}
+
+	if paths := findLinks(snippetLinkRX, body); len(paths) > 0 {
+		routes = append(routes, route{name: "snippet", paths: paths})
+	}
+	if cfg.users > 0 {
+		g := newGenerator(cfg.seed, cfg.prefix, 1)
+		paths := make([]string, cfg.users)
+		for n := range paths {
+			paths[n] = "/users/" + g.user(n+1).Username
+		}
+		routes = append(routes, route{name: "profile", paths: paths})
+	}
+
+	return routes, nil
+}
+
+// findLinks returns the distinct paths matched by rx in the page.
+func findLinks(rx *regexp.Regexp, page []byte) []string {
+	var paths []string
+	for _, m := range rx.FindAllSubmatch(page, -1) {
+		if path := string(m[1]); !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// The routeResult type holds the measurements for one route.
+type routeResult struct {
+	name      string
+	latencies []time.Duration
+	errors    int
+}
+
+// benchmark sends requests until the time is up. Each worker picks a route at random for every request, so that
+// the routes are measured under the same conditions.
+func benchmark(client *http.Client, base string, routes []route, cfg benchConfig) []*routeResult {
+	results := make([]*routeResult, len(routes))
+	for i, rt := range routes {
+		results[i] = &routeResult{name: rt.name}
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		deadline = time.Now().Add(cfg.duration)
+	)
+
+	for worker := range cfg.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rng := rand.New(rand.NewPCG(cfg.seed, uint64(worker)))
+			for time.Now().Before(deadline) {
+				i := rng.IntN(len(routes))
+				path := routes[i].paths[rng.IntN(len(routes[i].paths))]
+
+				latency, ok := timeRequest(client, base+path)
+
+				mu.Lock()
+				results[i].latencies = append(results[i].latencies, latency)
+				if !ok {
+					results[i].errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// timeRequest sends a GET request and reads the whole response. It reports whether the request succeeded, which means
+// that there was a response without a 5xx status.
+func timeRequest(client *http.Client, url string) (time.Duration, bool) {
+	start := time.Now()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return time.Since(start), false
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(io.Discard, resp.Body)
+	return time.Since(start), err == nil && resp.StatusCode < 500
+}
+
+// percentile returns the pth percentile of the sorted latencies, using the nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func writeResults(w io.Writer, results []*routeResult, duration time.Duration) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "route\trequests\terrors\treq/s\tp50\tp95\tp99\t")
+
+	for _, res := range results {
+		slices.Sort(res.latencies)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t\n",
+			res.name,
+			len(res.latencies),
+			res.errors,
+			float64(len(res.latencies))/duration.Seconds(),
+			percentile(res.latencies, 50).Round(10*time.Microsecond),
+			percentile(res.latencies, 95).Round(10*time.Microsecond),
+			percentile(res.latencies, 99).Round(10*time.Microsecond),
+		)
+	}
+
+	tw.Flush()
+}
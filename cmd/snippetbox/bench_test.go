@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	asserts.Equal(t, percentile(latencies, 50), 50*time.Millisecond)
+	asserts.Equal(t, percentile(latencies, 99), 99*time.Millisecond)
+	asserts.Equal(t, percentile(latencies[:1], 95), time.Millisecond)
+	asserts.Equal(t, percentile(nil, 50), 0)
+}
+
+func TestBench(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href='/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A'>One</a> <a href='/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A'>One again</a>`))
+	})
+	mux.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/user/login", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/snippet/view/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+
+	ts := httptest.NewTLSServer(mux)
+	defer ts.Close()
+
+	var out strings.Builder
+	err := runBench([]string{"-url", ts.URL + "/", "-duration", "200ms", "-concurrency", "2", "-users", "3"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	// A header line, a blank line, the table heading and a line for each of the five routes.
+	asserts.Equal(t, len(lines), 8)
+
+	for _, line := range lines[3:] {
+		fields := strings.Fields(line)
+		if fields[1] == "0" {
+			t.Errorf("no requests were sent for %s", fields[0])
+		}
+		// Only the profile pages fail.
+		if (fields[0] == "profile") != (fields[2] == fields[1]) {
+			t.Errorf("got %s errors for %s requests to %s", fields[2], fields[1], fields[0])
+		}
+	}
+}
+
+func TestFindLinks(t *testing.T) {
+	page := []byte(`<a href='/snippet/view/A1'>a</a><a href='/snippet/view/B2'>b</a><a href='/snippet/view/A1'>a</a><a href='/about'>about</a>`)
+
+	links := findLinks(snippetLinkRX, page)
+
+	asserts.Equal(t, len(links), 2)
+	asserts.Equal(t, links[0], "/snippet/view/A1")
+	asserts.Equal(t, links[1], "/snippet/view/B2")
+}
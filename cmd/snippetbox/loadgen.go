@@ -0,0 +1,288 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/hash"
+	"github.com/0xshiku/snippetbox/internal/ids"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"io"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MySQL allows at most 65,535 placeholders in one statement, which limits how many rows we can insert at a time.
+const maxPlaceholders = 65535
+
+// The prefix goes at the start of every synthetic username and email address, so it must keep them valid.
+var prefixRX = regexp.MustCompile("^[a-z0-9]{1,12}$")
+
+// The words that synthetic titles and snippets are made from. There are enough of them that the content isn't
+// all the same, which would make the database compress it (and any caching) unrealistically well.
+var words = strings.Fields(`
+	autumn moon pond frog water sound leaf wind mountain river cloud rain snow blossom cherry morning evening night
+	silent old cold warm distant quiet bright falling drifting winter summer spring path stone temple bell crow
+	sparrow pine bamboo shadow light lantern mist dew field harvest rice tea cup kettle smoke fire ember ash
+	sea wave shore sand shell tide boat oar fisherman net heron willow reed lotus petal branch root seed sky
+`)
+
+// The loadgenConfig type holds the flags for the loadgen command.
+type loadgenConfig struct {
+	dsn      string
+	users    int
+	snippets int
+	batch    int
+	seed     uint64
+	prefix   string
+	password string
+	days     int
+}
+
+// runLoadgen fills the database with synthetic users and snippets, so that performance changes can be measured against a
+// realistic amount of data. The same seed always generates the same users and snippets (apart from their public IDs and
+// creation times, which are relative to now), so that runs can be compared.
+func runLoadgen(args []string, stdout io.Writer) error {
+	var cfg loadgenConfig
+
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.StringVar(&cfg.dsn, "dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
+	fs.IntVar(&cfg.users, "users", 1000, "Number of users to create")
+	fs.IntVar(&cfg.snippets, "snippets", 1000000, "Number of snippets to create")
+	fs.IntVar(&cfg.batch, "batch", 1000, "Number of rows to insert in each statement")
+	fs.Uint64Var(&cfg.seed, "seed", 1, "Seed for the random number generator")
+	fs.StringVar(&cfg.prefix, "prefix", "load", "Prefix for usernames and email addresses, so that more than one run can use the same database")
+	fs.StringVar(&cfg.password, "password", "pa$$word", "Password for every synthetic user")
+	fs.IntVar(&cfg.days, "days", 365, "Spread the snippets' creation times over this many days")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.validate()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	g := newGenerator(cfg.seed, cfg.prefix, cfg.days)
+
+	start := time.Now()
+
+	userIDs, err := insertUsers(db, g, cfg, stdout)
+	if err != nil {
+		return err
+	}
+
+	err = insertSnippets(db, g, cfg, userIDs, stdout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "created %d users and %d snippets in %s\n", cfg.users, cfg.snippets, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (cfg loadgenConfig) validate() error {
+	switch {
+	case cfg.users < 0 || cfg.snippets < 0:
+		return errors.New("the numbers of users and snippets can't be negative")
+	case cfg.batch < 1 || cfg.batch*7 > maxPlaceholders:
+		return fmt.Errorf("the batch size must be between 1 and %d", maxPlaceholders/7)
+	case !prefixRX.MatchString(cfg.prefix):
+		return errors.New("the prefix must be 1 to 12 lowercase letters or digits")
+	case cfg.days < 1:
+		return errors.New("the number of days must be at least 1")
+	}
+	return nil
+}
+
+// The generator type creates synthetic users and snippets from a seeded random number generator.
+type generator struct {
+	rng    *rand.Rand
+	prefix string
+	days   int
+}
+
+func newGenerator(seed uint64, prefix string, days int) *generator {
+	return &generator{
+		rng:    rand.New(rand.NewPCG(seed, seed)),
+		prefix: prefix,
+		days:   days,
+	}
+}
+
+type syntheticUser struct {
+	Name     string
+	Username string
+	Email    string
+}
+
+// user returns the nth synthetic user. Users are numbered rather than random, so that their usernames are unique
+// and easy to find (for example, to log in as one of them).
+func (g *generator) user(n int) syntheticUser {
+	return syntheticUser{
+		Name:     fmt.Sprintf("Load User %d", n),
+		Username: fmt.Sprintf("%suser%d", g.prefix, n),
+		Email:    fmt.Sprintf("%suser%d@example.com", g.prefix, n),
+	}
+}
+
+type syntheticSnippet struct {
+	// Owner is an index into the list of users, or -1 for an anonymous snippet.
+	Owner      int
+	Title      string
+	Content    string
+	Age        time.Duration
+	Expires    int
+	Visibility string
+}
+
+// snippet returns a random snippet owned by one of the given number of users. About a fifth of snippets are anonymous
+// and a tenth are unlisted.
+func (g *generator) snippet(users int) syntheticSnippet {
+	s := syntheticSnippet{
+		Owner:      -1,
+		Title:      g.title(),
+		Content:    g.content(),
+		Age:        time.Duration(g.rng.Int64N(int64(g.days) * int64(24*time.Hour))),
+		Visibility: models.VisibilityPublic,
+	}
+
+	if users > 0 && g.rng.IntN(5) != 0 {
+		s.Owner = g.rng.IntN(users)
+	}
+
+	if g.rng.IntN(10) == 0 {
+		s.Visibility = models.VisibilityUnlisted
+	}
+
+	// Snippets expire 1, 7 or 365 days after they're created, like the options on the create form. Make sure that
+	// they're all still live, so that they show up on the pages we're testing.
+	s.Expires = []int{1, 7, 365}[g.rng.IntN(3)]
+	s.Expires += int(s.Age / (24 * time.Hour))
+
+	return s
+}
+
+func (g *generator) title() string {
+	n := 2 + g.rng.IntN(4)
+	title := make([]string, n)
+	for i := range title {
+		title[i] = words[g.rng.IntN(len(words))]
+	}
+	title[0] = strings.ToUpper(title[0][:1]) + title[0][1:]
+	return strings.Join(title, " ")
+}
+
+func (g *generator) content() string {
+	lines := make([]string, 2+g.rng.IntN(5))
+	for i := range lines {
+		line := make([]string, 3+g.rng.IntN(5))
+		for j := range line {
+			line[j] = words[g.rng.IntN(len(words))]
+		}
+		lines[i] = strings.Join(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// insertUsers creates the synthetic users, and returns their IDs in order. Hashing a password with bcrypt takes a noticeable
+// amount of time, so every user shares one hash.
+func insertUsers(db *sql.DB, g *generator, cfg loadgenConfig, stdout io.Writer) ([]int, error) {
+	hashedPassword, err := hash.Bcrypt{Cost: hash.DefaultBcryptCost}.Hash(cfg.password)
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < cfg.users; start += cfg.batch {
+		end := min(start+cfg.batch, cfg.users)
+
+		var args []any
+		for n := start; n < end; n++ {
+			u := g.user(n + 1)
+			args = append(args, u.Name, u.Username, u.Email, u.Email, hashedPassword)
+		}
+
+		stmt := `INSERT INTO users (name, username, email, normalized_email, hashed_password, created) VALUES ` + placeholders(end-start, "(?, ?, ?, ?, ?, UTC_TIMESTAMP())")
+		_, err = db.Exec(stmt, args...)
+		if err != nil {
+			return nil, fmt.Errorf("inserting users: %w (has this prefix already been used?)", err)
+		}
+
+		fmt.Fprintf(stdout, "users: %d/%d\n", end, cfg.users)
+	}
+
+	// Read the IDs back, rather than relying on them being consecutive.
+	rows, err := db.Query(`SELECT id FROM users WHERE username LIKE CONCAT(?, 'user%') ORDER BY id`, cfg.prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// insertSnippets creates the synthetic snippets, spread between the users.
+func insertSnippets(db *sql.DB, g *generator, cfg loadgenConfig, userIDs []int, stdout io.Writer) error {
+	now := time.Now().UTC()
+
+	for start := 0; start < cfg.snippets; start += cfg.batch {
+		end := min(start+cfg.batch, cfg.snippets)
+
+		var args []any
+		for n := start; n < end; n++ {
+			s := g.snippet(len(userIDs))
+
+			publicID, err := ids.ULID{}.New()
+			if err != nil {
+				return err
+			}
+
+			var owner any
+			if s.Owner >= 0 {
+				owner = userIDs[s.Owner]
+			}
+
+			created := now.Add(-s.Age)
+			args = append(args, publicID, owner, s.Title, s.Content, created, created.AddDate(0, 0, s.Expires), s.Visibility)
+		}
+
+		stmt := `INSERT INTO snippets (public_id, user_id, title, content, created, expires, visibility) VALUES ` + placeholders(end-start, "(?, ?, ?, ?, ?, ?, ?)")
+		_, err := db.Exec(stmt, args...)
+		if err != nil {
+			return fmt.Errorf("inserting snippets: %w", err)
+		}
+
+		// Don't flood the terminal when there are millions of snippets.
+		if end == cfg.snippets || (end/cfg.batch)%100 == 0 {
+			fmt.Fprintf(stdout, "snippets: %d/%d\n", end, cfg.snippets)
+		}
+	}
+
+	return nil
+}
+
+// placeholders returns n copies of row, separated by commas, for a multi-row INSERT statement.
+func placeholders(n int, row string) string {
+	return strings.TrimSuffix(strings.Repeat(row+", ", n), ", ")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"testing"
+	"time"
+)
+
+func TestGenerator(t *testing.T) {
+	t.Run("Same seed", func(t *testing.T) {
+		a := newGenerator(42, "load", 30)
+		b := newGenerator(42, "load", 30)
+
+		for range 100 {
+			asserts.Equal(t, a.snippet(10), b.snippet(10))
+		}
+	})
+
+	t.Run("Different seed", func(t *testing.T) {
+		a := newGenerator(1, "load", 30)
+		b := newGenerator(2, "load", 30)
+
+		if a.snippet(10) == b.snippet(10) && a.snippet(10) == b.snippet(10) {
+			t.Error("different seeds generated the same snippets")
+		}
+	})
+
+	t.Run("Valid snippets", func(t *testing.T) {
+		g := newGenerator(1, "load", 30)
+
+		for range 1000 {
+			s := g.snippet(10)
+
+			if s.Owner < -1 || s.Owner >= 10 {
+				t.Fatalf("got owner %d; want -1 to 9", s.Owner)
+			}
+			if s.Title == "" || len(s.Title) > 100 {
+				t.Fatalf("got title %q; want 1 to 100 characters", s.Title)
+			}
+			if s.Age < 0 || s.Age >= 30*24*time.Hour {
+				t.Fatalf("got age %s; want less than 30 days", s.Age)
+			}
+			// The snippet must still be live.
+			if time.Duration(s.Expires)*24*time.Hour <= s.Age {
+				t.Fatalf("got expiry of %d days for a snippet which is %s old", s.Expires, s.Age)
+			}
+		}
+	})
+
+	t.Run("No users", func(t *testing.T) {
+		g := newGenerator(1, "load", 30)
+
+		for range 100 {
+			asserts.Equal(t, g.snippet(0).Owner, -1)
+		}
+	})
+
+	t.Run("Valid users", func(t *testing.T) {
+		g := newGenerator(1, "abcdefghijkl", 30)
+		u := g.user(1000000)
+
+		asserts.Equal(t, u.Username, "abcdefghijkluser1000000")
+		asserts.Equal(t, validators.Matches(u.Username, validators.UsernameRX), true)
+		asserts.Equal(t, validators.Matches(u.Email, validators.EmailRX), true)
+	})
+}
+
+func TestLoadgenConfigValidate(t *testing.T) {
+	valid := loadgenConfig{users: 10, snippets: 100, batch: 1000, prefix: "load", days: 365}
+	asserts.NilError(t, valid.validate())
+
+	tests := []struct {
+		name   string
+		modify func(*loadgenConfig)
+	}{
+		{"Negative users", func(cfg *loadgenConfig) { cfg.users = -1 }},
+		{"Zero batch", func(cfg *loadgenConfig) { cfg.batch = 0 }},
+		{"Too many placeholders", func(cfg *loadgenConfig) { cfg.batch = 10000 }},
+		{"Prefix with punctuation", func(cfg *loadgenConfig) { cfg.prefix = "load-" }},
+		{"Prefix too long", func(cfg *loadgenConfig) { cfg.prefix = "abcdefghijklm" }},
+		{"Zero days", func(cfg *loadgenConfig) { cfg.days = 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+
+			if cfg.validate() == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	asserts.Equal(t, placeholders(1, "(?, ?)"), "(?, ?)")
+	asserts.Equal(t, placeholders(3, "(?)"), "(?), (?), (?)")
+}
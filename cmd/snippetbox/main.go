@@ -0,0 +1,82 @@
+// The snippetbox command holds the tools for working on Snippetbox which don't belong in the web server itself.
+//
+// Usage:
+//
+//	snippetbox loadgen [flags]   Fill a database with synthetic users and snippets.
+//	snippetbox bench [flags]     Send requests to a running server and report the latency of each route.
+//	snippetbox export [flags]    Write every unexpired snippet to a JSON Lines file.
+//	snippetbox import [flags]    Add the snippets from a JSON Lines file to the database.
+//
+// Run "snippetbox <command> -h" to see the flags for each command.
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"io"
+	"os"
+)
+
+// A command is one of the subcommands. The run function is passed the arguments after the command name.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"loadgen", "Fill a database with synthetic users and snippets", runLoadgen},
+	{"bench", "Send requests to a running server and report the latency of each route", runBench},
+	{"export", "Write every unexpired snippet to a JSON Lines file", runExport},
+	{"import", "Add the snippets from a JSON Lines file to the database", runImport},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run dispatches to the named command, and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			err := cmd.run(args[1:], stdout)
+			if err != nil {
+				fmt.Fprintf(stderr, "snippetbox %s: %s\n", cmd.name, err)
+				return 1
+			}
+			return 0
+		}
+	}
+
+	fmt.Fprintf(stderr, "snippetbox: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: snippetbox <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// openDB opens a connection pool to the database and checks that it works, in the same way as the web server does.
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
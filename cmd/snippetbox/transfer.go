@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/interchange"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"io"
+	"os"
+	"time"
+)
+
+// runExport writes every unexpired snippet to a JSON Lines file (see the interchange package for the format), so that
+// they can be imported into another instance.
+func runExport(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dsn := fs.String("dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
+	output := fs.String("o", "-", "File to write to, or - for standard output")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	out := stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	bw := bufio.NewWriter(out)
+	w := interchange.NewWriter(bw)
+	snippets := &models.SnippetModel{DB: db}
+
+	count := 0
+	err = snippets.Export(0, func(s *models.Snippet, owner string) error {
+		count++
+		return w.Write(interchange.FromModel(s, owner))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d snippets\n", count)
+	return nil
+}
+
+// The importConfig type holds the flags for the import command.
+type importConfig struct {
+	dsn    string
+	owner  string
+	strict bool
+}
+
+// runImport reads snippets from a JSON Lines file and adds them to the database. Each snippet is given to the user with
+// the same username as its owner, if there is one, and is anonymous otherwise. With -owner, every snippet goes to that user.
+// Invalid lines are reported and skipped, unless -strict is set. Snippets which have already expired are skipped too.
+func runImport(args []string, stdout io.Writer) error {
+	var cfg importConfig
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.StringVar(&cfg.dsn, "dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
+	fs.StringVar(&cfg.owner, "owner", "", "Username to give every imported snippet to, instead of matching the owners in the file")
+	fs.BoolVar(&cfg.strict, "strict", false, "Stop at the first invalid line, instead of skipping it")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snippetbox import [flags] <file>   (use - for standard input)")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one file to import")
+	}
+
+	in := io.Reader(os.Stdin)
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	im := &importer{
+		snippets: &models.SnippetModel{DB: db},
+		users:    &models.UserModel{DB: db},
+		owners:   map[string]int{},
+		strict:   cfg.strict,
+		now:      time.Now(),
+		log:      stdout,
+	}
+
+	if cfg.owner != "" {
+		user, err := im.users.GetByUsername(cfg.owner)
+		if err != nil {
+			return err
+		}
+		im.fixedOwner = user.ID
+	}
+
+	err = im.run(interchange.NewReader(in))
+	fmt.Fprintf(stdout, "imported %d snippets, skipped %d invalid and %d expired\n", im.imported, im.invalid, im.expired)
+	return err
+}
+
+// The importer type imports snippets into the database, and counts what it did.
+type importer struct {
+	snippets   models.SnippetModelInterface
+	users      models.UserModelInterface
+	owners     map[string]int
+	fixedOwner int
+	strict     bool
+	now        time.Time
+	log        io.Writer
+
+	imported, invalid, expired int
+}
+
+func (im *importer) run(r *interchange.Reader) error {
+	for {
+		s, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var lineErr *interchange.LineError
+		if errors.As(err, &lineErr) && !im.strict {
+			fmt.Fprintln(im.log, lineErr)
+			im.invalid++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !s.Expires.After(im.now) {
+			im.expired++
+			continue
+		}
+
+		userID, err := im.ownerID(s.Owner)
+		if err != nil {
+			return err
+		}
+
+		_, err = im.snippets.Import(userID, s.Title, s.Content, s.Created, s.Expires, s.Visibility)
+		if err != nil {
+			return err
+		}
+		im.imported++
+	}
+}
+
+// ownerID returns the ID of the user that a snippet should belong to, or 0 for an anonymous snippet.
+func (im *importer) ownerID(username string) (int, error) {
+	if im.fixedOwner != 0 || username == "" {
+		return im.fixedOwner, nil
+	}
+
+	if id, ok := im.owners[username]; ok {
+		return id, nil
+	}
+
+	id := 0
+	user, err := im.users.GetByUsername(username)
+	switch {
+	case err == nil:
+		id = user.ID
+	case errors.Is(err, models.ErrNoRecord):
+		fmt.Fprintf(im.log, "no user called %q, so their snippets will be anonymous\n", username)
+	default:
+		return 0, err
+	}
+
+	im.owners[username] = id
+	return id, nil
+}
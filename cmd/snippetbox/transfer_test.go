@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"github.com/0xshiku/snippetbox/internal/interchange"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/models/mocks"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The recordingSnippets type wraps the mock snippet model to remember who each imported snippet was given to.
+type recordingSnippets struct {
+	mocks.SnippetModel
+	owners []int
+}
+
+func (m *recordingSnippets) Import(userID int, title, content string, created, expires time.Time, visibility string) (string, error) {
+	m.owners = append(m.owners, userID)
+	return m.SnippetModel.Import(userID, title, content, created, expires, visibility)
+}
+
+func TestImporter(t *testing.T) {
+	input := strings.Join([]string{
+		`{"v":1,"title":"Alice's","content":"a","created":"2024-01-01T00:00:00Z","expires":"2024-01-09T00:00:00Z","owner":"alice"}`,
+		`{"v":1,"title":"Bob's","content":"b","created":"2024-01-01T00:00:00Z","expires":"2024-01-09T00:00:00Z","owner":"bob"}`,
+		`{"v":1,"title":"Anonymous","content":"c","created":"2024-01-01T00:00:00Z","expires":"2024-01-09T00:00:00Z"}`,
+		`{"v":1,"title":"Expired","content":"d","created":"2024-01-01T00:00:00Z","expires":"2024-01-02T00:00:00Z","owner":"alice"}`,
+		`{"v":1,"title":"","content":"e","created":"2024-01-01T00:00:00Z","expires":"2024-01-09T00:00:00Z"}`,
+		`{"v":1,"title":"Alice's again","content":"f","created":"2024-01-01T00:00:00Z","expires":"2024-01-09T00:00:00Z","owner":"alice"}`,
+	}, "\n")
+	now := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	newImporter := func(snippets models.SnippetModelInterface, log *bytes.Buffer) *importer {
+		return &importer{
+			snippets: snippets,
+			users:    &mocks.UserModel{},
+			owners:   map[string]int{},
+			now:      now,
+			log:      log,
+		}
+	}
+
+	t.Run("Match owners", func(t *testing.T) {
+		var log bytes.Buffer
+		snippets := &recordingSnippets{}
+		im := newImporter(snippets, &log)
+
+		err := im.run(interchange.NewReader(strings.NewReader(input)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		asserts.Equal(t, im.imported, 4)
+		asserts.Equal(t, im.expired, 1)
+		asserts.Equal(t, im.invalid, 1)
+		asserts.Equal(t, len(snippets.owners), 4)
+		for i, want := range []int{1, 0, 0, 1} {
+			asserts.Equal(t, snippets.owners[i], want)
+		}
+		asserts.StringContains(t, log.String(), `no user called "bob"`)
+		asserts.StringContains(t, log.String(), "line 5: title must be provided")
+	})
+
+	t.Run("Fixed owner", func(t *testing.T) {
+		var log bytes.Buffer
+		snippets := &recordingSnippets{}
+		im := newImporter(snippets, &log)
+		im.fixedOwner = 1
+
+		err := im.run(interchange.NewReader(strings.NewReader(input)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, owner := range snippets.owners {
+			asserts.Equal(t, owner, 1)
+		}
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		var log bytes.Buffer
+		im := newImporter(&recordingSnippets{}, &log)
+		im.strict = true
+
+		err := im.run(interchange.NewReader(strings.NewReader(input)))
+		if err == nil {
+			t.Fatal("expected an error for the invalid line")
+		}
+
+		asserts.StringContains(t, err.Error(), "line 5")
+		asserts.Equal(t, im.imported, 3)
+	})
+}
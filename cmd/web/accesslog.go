@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The access log formats. Common is the Common Log Format, and combined adds the referer and user agent to it, as
+// Apache and nginx do. JSON has every field, including the request ID and how long the response took.
+const (
+	accessLogCommon   = "common"
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+)
+
+// The accessRecorder type passes a response through to the client, keeping the status code and counting the bytes in
+// the body for the access log.
+type accessRecorder struct {
+	statusRecorder
+	bytes int64
+}
+
+func (rec *accessRecorder) Write(b []byte) (int, error) {
+	n, err := rec.statusRecorder.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Hijack lets the WebSocket routes take over the connection. Those are logged with a 101 status, once the connection
+// has been closed.
+func (rec *accessRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil && rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// The accessLogEntry type is a line of the access log.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Duration   float64   `json:"duration_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// The logRequest middleware writes a line to the access log for every request, after the response has been sent. It
+// comes after trustedProxy, so that the address is the client's rather than the proxy's.
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &accessRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		// A handler which doesn't write anything sends an empty 200 response.
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		entry := accessLogEntry{
+			Time:       start,
+			RequestID:  requestID(r),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			URI:        r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			Duration:   float64(time.Since(start).Microseconds()) / 1000,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		}
+
+		app.accessLog.Print(formatAccessLog(app.config.accessLog.format, entry))
+	})
+}
+
+// clfEscaper escapes the quoted fields of the common and combined formats, so that a quote in a user agent can't end
+// the field early.
+var clfEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// formatAccessLog returns the entry as a line in the given format.
+func formatAccessLog(format string, e accessLogEntry) string {
+	if format == accessLogJSON {
+		// The entry only has strings and numbers in it, so it can always be encoded.
+		b, _ := json.Marshal(e)
+		return string(b)
+	}
+
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		host = e.RemoteAddr
+	}
+
+	// An empty body is logged as "-" rather than 0.
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+
+	line := fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s`, host, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, clfEscaper.Replace(e.URI), e.Proto, e.Status, size)
+
+	if format == accessLogCombined {
+		line += fmt.Sprintf(` "%s" "%s"`, clfField(e.Referer), clfField(e.UserAgent))
+	}
+
+	return line
+}
+
+// clfField escapes a quoted field, which is "-" when it's empty.
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return clfEscaper.Replace(s)
+}
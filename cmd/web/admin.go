@@ -0,0 +1,365 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/disposable"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Create a new adminSettingsForm struct, for all of the site settings apart from maintenance mode, which has its own
+// button. Checkboxes are only submitted when they're ticked, so an unticked box decodes as false. DefaultExpiry is one
+// of the choices on the create form, so it's checked against those. Sections holds the names of the home page sections
+// to show, and Curated holds the public IDs of the curated snippets, separated by whitespace.
+type adminSettingsForm struct {
+	SiteName                  string   `form:"siteName"`
+	SignupEnabled             bool     `form:"signupEnabled"`
+	DefaultExpiry             int      `form:"defaultExpiry"`
+	BlockDisposableEmails     bool     `form:"blockDisposableEmails"`
+	FailedLoginAlertThreshold int      `form:"failedLoginAlertThreshold"`
+	ServerErrorAlertThreshold int      `form:"serverErrorAlertThreshold"`
+	Sections                  []string `form:"sections"`
+	AnnouncementTitle         string   `form:"announcementTitle"`
+	AnnouncementText          string   `form:"announcementText"`
+	Curated                   string   `form:"curated"`
+	validators.Validator      `form:"-"`
+}
+
+// Shows reports whether the form has the named home page section ticked, for the template's checkboxes.
+func (form adminSettingsForm) Shows(name string) bool {
+	return slices.Contains(form.Sections, name)
+}
+
+// The adminSettingsData type is passed to the admin settings template, along with details of the disposable email domain list
+// and the security alert window.
+type adminSettingsData struct {
+	adminSettingsForm
+	Disposable      disposable.Status
+	AlertWindow     time.Duration
+	Maintenance     bool
+	MaintenanceFile string
+}
+
+// The newAdminSettingsData() helper adds the current state of the things on the settings page which aren't in the form.
+// MaintenanceFile is only set when the maintenance file exists, as turning maintenance mode off doesn't do anything then.
+func (app *application) newAdminSettingsData(form adminSettingsForm) adminSettingsData {
+	data := adminSettingsData{
+		adminSettingsForm: form,
+		Disposable:        app.disposable.Status(),
+		AlertWindow:       app.alerts.window,
+		Maintenance:       app.site().Maintenance,
+	}
+
+	if app.maintenanceFileExists() {
+		data.MaintenanceFile = app.config.maintenance.file
+	}
+
+	return data
+}
+
+func (app *application) adminSettings(w http.ResponseWriter, r *http.Request) {
+	s := app.site()
+
+	data := app.newTemplateData(r)
+	data.Form = app.newAdminSettingsData(adminSettingsForm{
+		SiteName:                  s.SiteName,
+		SignupEnabled:             s.SignupEnabled,
+		DefaultExpiry:             s.DefaultExpiry,
+		BlockDisposableEmails:     s.BlockDisposableEmails,
+		FailedLoginAlertThreshold: s.FailedLoginAlertThreshold,
+		ServerErrorAlertThreshold: s.ServerErrorAlertThreshold,
+		Sections:                  s.HomeSections,
+		AnnouncementTitle:         s.HomeAnnouncementTitle,
+		AnnouncementText:          s.HomeAnnouncementText,
+		Curated:                   strings.Join(s.HomeCurated, "\n"),
+	})
+
+	app.render(w, r, http.StatusOK, "admin_settings.gohtml", data)
+}
+
+// adminSettingsPost saves the site settings. They're kept in the database, so they apply to every server, although
+// the others can take a minute to notice. The curated snippets have to exist and be public when they're picked, but
+// they're left out of the home page if they expire later on.
+func (app *application) adminSettingsPost(w http.ResponseWriter, r *http.Request) {
+	var form adminSettingsForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.SiteName = strings.TrimSpace(form.SiteName)
+
+	form.CheckField(validators.NotBlank(form.SiteName), "siteName", "This field cannot be blank")
+	form.CheckField(validators.MaxChars(form.SiteName, maxSiteNameLength), "siteName", "This field cannot be more than "+strconv.Itoa(maxSiteNameLength)+" characters long")
+	form.CheckField(validators.PermittedValue(form.DefaultExpiry, 1, 7, 365), "defaultExpiry", "This field must equal 1, 7 or 365")
+	form.CheckField(form.FailedLoginAlertThreshold >= 0, "failedLoginAlertThreshold", "This field can't be negative")
+	form.CheckField(form.ServerErrorAlertThreshold >= 0, "serverErrorAlertThreshold", "This field can't be negative")
+
+	// Put the home page sections in the order that they're offered, dropping any that we don't know about.
+	var sections []string
+	for _, name := range homeSectionNames {
+		if form.Shows(name) {
+			sections = append(sections, name)
+		}
+	}
+	form.Sections = sections
+	curated := strings.Fields(form.Curated)
+
+	if len(sections) == 0 {
+		form.AddNonFieldError("Choose at least one section to show on the home page")
+	}
+
+	if form.Shows(homeAnnouncement) {
+		form.CheckField(validators.MaxChars(form.AnnouncementTitle, 100), "announcementTitle", "This field cannot be more than 100 characters long")
+		form.CheckField(validators.NotBlank(form.AnnouncementText), "announcementText", "This field cannot be blank")
+		form.CheckField(validators.MaxChars(form.AnnouncementText, 1000), "announcementText", "This field cannot be more than 1000 characters long")
+	}
+
+	if form.Shows(homeCurated) {
+		form.CheckField(len(curated) > 0, "curated", "This field cannot be blank")
+		form.CheckField(len(curated) <= homePageSize, "curated", fmt.Sprintf("This field cannot have more than %d snippets", homePageSize))
+
+		if form.Valid() {
+			for _, id := range curated {
+				var snippet *models.Snippet
+				if len(id) <= maxPublicIDLength {
+					snippet, err = app.snippets.GetByPublicID(id)
+					if err != nil && !errors.Is(err, models.ErrNoRecord) {
+						app.serverError(w, r, err)
+						return
+					}
+				}
+
+				if snippet == nil || snippet.Visibility != models.VisibilityPublic {
+					form.AddFieldError("curated", fmt.Sprintf("Snippet %s doesn't exist or isn't public", id))
+					break
+				}
+			}
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = app.newAdminSettingsData(form)
+		app.render(w, r, http.StatusUnprocessableEntity, "admin_settings.gohtml", data)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	err = app.siteSettings.Update(models.SiteSettings{
+		SiteName:                  form.SiteName,
+		SignupEnabled:             form.SignupEnabled,
+		DefaultExpiry:             form.DefaultExpiry,
+		BlockDisposableEmails:     form.BlockDisposableEmails,
+		FailedLoginAlertThreshold: form.FailedLoginAlertThreshold,
+		ServerErrorAlertThreshold: form.ServerErrorAlertThreshold,
+		HomeSections:              sections,
+		HomeAnnouncementTitle:     form.AnnouncementTitle,
+		HomeAnnouncementText:      form.AnnouncementText,
+		HomeCurated:               curated,
+	}, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Show the new settings and home page straight away, rather than when the caches expire. The other cached pages
+	// (and the CDN's copies of them) catch up within a minute.
+	app.dropSiteCache(r)
+	err = app.cache.Delete(homeCacheKey)
+	if err != nil {
+		app.errorLog.Printf("[%s] clearing the cached home page: %s", requestID(r), err)
+	}
+	app.purgeCache("/")
+
+	app.infoLog.Printf("[%s] admin user %d changed the site settings", requestID(r), userID)
+
+	// Changing the settings could weaken the site's defences, so let every admin know about it.
+	app.securityAlert("Settings changed", fmt.Sprintf("Admin user %d changed the settings: signupEnabled=%t blockDisposableEmails=%t failedLoginAlertThreshold=%d serverErrorAlertThreshold=%d",
+		userID, form.SignupEnabled, form.BlockDisposableEmails, form.FailedLoginAlertThreshold, form.ServerErrorAlertThreshold))
+
+	app.sessionManager.Put(r.Context(), "flash", "Settings saved")
+
+	http.Redirect(w, r, "/admin/settings", http.StatusSeeOther)
+}
+
+// adminDisposableRefreshPost downloads the disposable email domain list straight away, rather than waiting for the next scheduled refresh.
+func (app *application) adminDisposableRefreshPost(w http.ResponseWriter, r *http.Request) {
+	err := app.disposable.Refresh()
+	if err != nil {
+		app.errorLog.Printf("[%s] refreshing disposable email domains: %s", requestID(r), err)
+		app.sessionManager.Put(r.Context(), "flash", "The disposable email domain list couldn't be refreshed, so the current list is still in use")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "The disposable email domain list has been refreshed")
+	}
+
+	http.Redirect(w, r, "/admin/settings", http.StatusSeeOther)
+}
+
+// The adminDeleteUserForm struct holds the username of the account to delete. Dry runs are the default, so that an admin always
+// sees what will be removed before anything is.
+type adminDeleteUserForm struct {
+	Username             string `form:"username"`
+	DryRun               bool   `form:"dryRun"`
+	validators.Validator `form:"-"`
+}
+
+// The adminDeleteUserData type is passed to the delete user template. After a dry run, Target and Plan describe what
+// would be deleted.
+type adminDeleteUserData struct {
+	adminDeleteUserForm
+	Target *models.User
+	Plan   *models.Plan
+}
+
+func (app *application) adminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = adminDeleteUserData{adminDeleteUserForm: adminDeleteUserForm{DryRun: true}}
+
+	app.render(w, r, http.StatusOK, "admin_delete_user.gohtml", data)
+}
+
+// adminDeleteUserPost permanently deletes a user, along with their snippets, tokens, pending email changes and recovery codes.
+// The user's sessions stop working straight away, because the authenticate middleware no longer finds them, and are cleared
+// from the store when they expire.
+func (app *application) adminDeleteUserPost(w http.ResponseWriter, r *http.Request) {
+	var form adminDeleteUserForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validators.NotBlank(form.Username), "username", "This field cannot be blank")
+
+	var target *models.User
+	if form.Valid() {
+		target, err = app.users.GetByUsername(form.Username)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		form.CheckField(target != nil, "username", "There is no user with this username")
+		form.CheckField(target == nil || target.ID != app.authenticatedUserID(r), "username", "You can't delete your own account")
+	}
+
+	data := app.newTemplateData(r)
+
+	if !form.Valid() {
+		data.Form = adminDeleteUserData{adminDeleteUserForm: form}
+		app.render(w, r, http.StatusUnprocessableEntity, "admin_delete_user.gohtml", data)
+		return
+	}
+
+	plan, err := app.users.Delete(target.ID, form.DryRun)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	summary := fmt.Sprintf("%d snippets, %d API tokens, %d pending email changes and %d recovery codes",
+		plan.Rows(models.PlanDelete, "snippets"), plan.Rows(models.PlanDelete, "tokens"),
+		plan.Rows(models.PlanDelete, "email_changes"), plan.Rows(models.PlanDelete, "recovery_codes"))
+
+	if form.DryRun {
+		data.Form = adminDeleteUserData{adminDeleteUserForm: form, Target: target, Plan: plan}
+		app.render(w, r, http.StatusOK, "admin_delete_user.gohtml", data)
+		return
+	}
+
+	app.infoLog.Printf("[%s] admin user %d deleted user %d (%s): %s", requestID(r), app.authenticatedUserID(r), target.ID, target.Username, summary)
+	app.securityAlert("User deleted", fmt.Sprintf("Admin user %d permanently deleted user %d (%s), along with %s.",
+		app.authenticatedUserID(r), target.ID, target.Username, summary))
+
+	// The user's snippets, profile and (possibly) the home page have all changed, so drop any cached copies of them.
+	// Only the first page of each listing is purged, as the later pages are rarely cached for long.
+	app.purgeCache(append(snippetPaths(plan.IDs(models.PlanDelete, "snippets")...), "/", "/users/"+target.Username)...)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Deleted %s, along with %s", target.Username, summary))
+
+	http.Redirect(w, r, "/admin/users/delete", http.StatusSeeOther)
+}
+
+// The adminUserStatusForm struct holds the username of the account to change, and the status to give it.
+type adminUserStatusForm struct {
+	Username             string `form:"username"`
+	Status               string `form:"status"`
+	validators.Validator `form:"-"`
+}
+
+func (app *application) adminUserStatus(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = adminUserStatusForm{Status: models.UserStatusSuspended}
+
+	app.render(w, r, http.StatusOK, "admin_user_status.gohtml", data)
+}
+
+// adminUserStatusPost suspends, bans or reinstates a user. Suspending or banning somebody logs them out everywhere straight
+// away. Their API tokens are kept, but don't work while the account is blocked, so that reinstating it doesn't mean setting
+// their integrations up again.
+func (app *application) adminUserStatusPost(w http.ResponseWriter, r *http.Request) {
+	var form adminUserStatusForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validators.NotBlank(form.Username), "username", "This field cannot be blank")
+	form.CheckField(validators.PermittedValue(form.Status, models.UserStatusActive, models.UserStatusSuspended, models.UserStatusBanned), "status", "This field must equal active, suspended or banned")
+
+	var target *models.User
+	if form.Valid() {
+		target, err = app.users.GetByUsername(form.Username)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		form.CheckField(target != nil, "username", "There is no user with this username")
+		form.CheckField(target == nil || target.ID != app.authenticatedUserID(r), "username", "You can't change the status of your own account")
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "admin_user_status.gohtml", data)
+		return
+	}
+
+	err = app.users.StatusUpdate(target.ID, form.Status)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	// The authenticate middleware would log the user out at their next request anyway, but ending their sessions now means
+	// that they don't show up as logged in anywhere in the meantime.
+	if form.Status != models.UserStatusActive {
+		_, err = app.destroyUserSessions(target.ID, "")
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.infoLog.Printf("[%s] admin user %d changed the status of user %d (%s) from %q to %q", requestID(r), app.authenticatedUserID(r), target.ID, target.Username, target.Status, form.Status)
+	app.securityAlert("User status changed", fmt.Sprintf("Admin user %d set the status of user %d (%s) to %s.",
+		app.authenticatedUserID(r), target.ID, target.Username, form.Status))
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s is now %s", target.Username, form.Status))
+
+	http.Redirect(w, r, "/admin/users/status", http.StatusSeeOther)
+}
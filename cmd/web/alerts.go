@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The kinds of security event that we count, so that admins can be alerted when there are a lot of them.
+const (
+	alertFailedLogins = "failedLogins"
+	alertServerErrors = "serverErrors"
+)
+
+// The alertCounter type counts security events of each kind in fixed windows of time.
+// It is safe for concurrent use, because events are recorded from every request handler.
+type alertCounter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	counts  map[string]int
+	started map[string]time.Time
+	// The now function returns the current time. It's a field so that tests can control the clock.
+	now func() time.Time
+}
+
+func newAlertCounter(window time.Duration) *alertCounter {
+	return &alertCounter{
+		window:  window,
+		counts:  map[string]int{},
+		started: map[string]time.Time{},
+		now:     time.Now,
+	}
+}
+
+// Add records an event of the given kind, and reports whether it brings the number of events in the current window up to
+// the threshold. It only reports true once per window, so admins get a single alert rather than one for every event after that.
+// A threshold of zero turns the alert off.
+func (c *alertCounter) Add(kind string, threshold int) bool {
+	if threshold <= 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.started[kind]) >= c.window {
+		c.started[kind] = now
+		c.counts[kind] = 0
+	}
+
+	c.counts[kind]++
+
+	return c.counts[kind] == threshold
+}
+
+// The securityAlertData type is passed to the security alert email template.
+type securityAlertData struct {
+	Subject string
+	Details string
+	Time    time.Time
+}
+
+// securityAlert logs a security event and emails it to every admin. The emails are sent in a background goroutine, so that
+// a slow SMTP server doesn't hold up the response.
+func (app *application) securityAlert(subject, details string) {
+	app.infoLog.Printf("security alert: %s: %s", subject, details)
+
+	data := securityAlertData{
+		Subject: subject,
+		Details: details,
+		Time:    time.Now(),
+	}
+
+	app.background(func() {
+		emails, err := app.users.AdminEmails()
+		if err != nil {
+			app.errorLog.Printf("sending security alert: %s", err)
+			return
+		}
+
+		for _, email := range emails {
+			err = app.mailer.Send(email, "security_alert.gohtml", data)
+			if err != nil {
+				app.errorLog.Print(err)
+			}
+		}
+	})
+}
+
+// recordFailedLogin counts a failed login attempt (a wrong password, two-factor code or recovery code), and alerts the admins
+// if there have been too many of them recently.
+func (app *application) recordFailedLogin() {
+	threshold := app.site().FailedLoginAlertThreshold
+	if app.alerts.Add(alertFailedLogins, threshold) {
+		app.securityAlert("Many failed logins", fmt.Sprintf("There have been %d failed login attempts in the last %s.", threshold, app.alerts.window))
+	}
+}
+
+// recordServerError counts a 500 Internal Server Error response, and alerts the admins if there have been too many of them recently.
+func (app *application) recordServerError(err error) {
+	threshold := app.site().ServerErrorAlertThreshold
+	if app.alerts.Add(alertServerErrors, threshold) {
+		app.securityAlert("Spike in server errors", fmt.Sprintf("There have been %d server errors in the last %s. The latest was: %s", threshold, app.alerts.window, err))
+	}
+}
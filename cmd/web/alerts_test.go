@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+	"time"
+)
+
+func TestAlertCounter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	c := newAlertCounter(10 * time.Minute)
+	c.now = func() time.Time {
+		return now
+	}
+
+	// The alert fires when the threshold is reached, and only once in the window.
+	asserts.Equal(t, c.Add(alertFailedLogins, 3), false)
+	asserts.Equal(t, c.Add(alertFailedLogins, 3), false)
+	asserts.Equal(t, c.Add(alertFailedLogins, 3), true)
+	asserts.Equal(t, c.Add(alertFailedLogins, 3), false)
+
+	// Each kind of event is counted separately.
+	asserts.Equal(t, c.Add(alertServerErrors, 1), true)
+
+	// A threshold of zero turns the alert off.
+	asserts.Equal(t, c.Add(alertServerErrors, 0), false)
+
+	// The count starts again in the next window.
+	now = now.Add(10 * time.Minute)
+	asserts.Equal(t, c.Add(alertFailedLogins, 2), false)
+	asserts.Equal(t, c.Add(alertFailedLogins, 2), true)
+}
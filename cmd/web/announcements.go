@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The current announcement is on every page, so it's cached along with the site settings, and dropped from the cache
+// when it's published or withdrawn.
+const announcementCacheKey = "site:announcement"
+
+// Limits on the announcements that admins can publish. The expiry is entered in the admin's own timezone, in the
+// format of a datetime-local input.
+const (
+	maxAnnouncementLength    = 500
+	announcementExpiryLayout = "2006-01-02T15:04"
+)
+
+// The announcementData type holds the announcement to show at the top of the page, if there is one which the visitor
+// hasn't dismissed. Next is the page to come back to after dismissing it.
+type announcementData struct {
+	Current *models.Announcement
+	Next    string
+}
+
+// currentAnnouncement returns the announcement which is up at the moment, or one with a zero ID if there isn't one. As
+// with the site settings, a database which is down (or an error loading it) means no announcement, rather than no page.
+func (app *application) currentAnnouncement() models.Announcement {
+	if app.dbHealth.Down() {
+		return models.Announcement{}
+	}
+
+	a, err := cached(app, announcementCacheKey, siteCacheTTL, func() (models.Announcement, error) {
+		a, err := app.announcements.Current()
+		if errors.Is(err, models.ErrNoRecord) {
+			return models.Announcement{}, nil
+		} else if err != nil {
+			return models.Announcement{}, err
+		}
+		return *a, nil
+	})
+	if err != nil {
+		app.errorLog.Printf("loading the current announcement: %s", err)
+		return models.Announcement{}
+	}
+
+	return a
+}
+
+// newAnnouncementData returns the announcement for the page, leaving it out if the visitor has dismissed it, or if it
+// expired since it was cached. Only the last announcement that they dismissed is remembered in their session, so a new
+// one is shown to everybody.
+func (app *application) newAnnouncementData(r *http.Request) announcementData {
+	a := app.currentAnnouncement()
+	if a.ID == 0 || a.Expired(time.Now()) || app.sessionManager.GetInt(r.Context(), "dismissedAnnouncement") == a.ID {
+		return announcementData{}
+	}
+
+	return announcementData{Current: &a, Next: r.URL.RequestURI()}
+}
+
+// announcementDismissPost hides an announcement for the rest of the visitor's session, and sends them back to the page
+// they dismissed it on. It's exempt from CSRF checks, as the form is on the pages cached for anonymous visitors, which
+// can't have tokens in them, and the worst a forged request can do is hide an announcement.
+func (app *application) announcementDismissPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "dismissedAnnouncement", id)
+
+	// Only paths on this site are followed, so that the form can't be used to send people somewhere else.
+	next := r.PostForm.Get("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// The adminAnnouncementForm struct holds the form for publishing an announcement. Expires is left blank for one which
+// stays up until it's replaced. Current is the announcement which is up now, for the page to show.
+type adminAnnouncementForm struct {
+	Text                 string               `form:"text"`
+	Severity             string               `form:"severity"`
+	Expires              string               `form:"expires"`
+	Current              *models.Announcement `form:"-"`
+	validators.Validator `form:"-"`
+}
+
+// Severities returns the choices of severity, for the template's radio buttons.
+func (form adminAnnouncementForm) Severities() []string {
+	return models.Severities
+}
+
+func (app *application) adminAnnouncement(w http.ResponseWriter, r *http.Request) {
+	app.renderAdminAnnouncement(w, r, http.StatusOK, adminAnnouncementForm{Severity: models.SeverityInfo})
+}
+
+// renderAdminAnnouncement shows the announcement page, along with the announcement which is up now.
+func (app *application) renderAdminAnnouncement(w http.ResponseWriter, r *http.Request, status int, form adminAnnouncementForm) {
+	if a := app.currentAnnouncement(); a.ID != 0 && !a.Expired(time.Now()) {
+		form.Current = &a
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, r, status, "admin_announcement.gohtml", data)
+}
+
+func (app *application) adminAnnouncementPost(w http.ResponseWriter, r *http.Request) {
+	var form adminAnnouncementForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Text = strings.TrimSpace(form.Text)
+
+	form.CheckField(validators.NotBlank(form.Text), "text", "This field cannot be blank")
+	form.CheckField(validators.MaxChars(form.Text, maxAnnouncementLength), "text", "This field cannot be more than "+strconv.Itoa(maxAnnouncementLength)+" characters long")
+	form.CheckField(validators.PermittedValue(form.Severity, models.Severities...), "severity", "This field must be info, warning or critical")
+
+	var expires time.Time
+	if form.Expires != "" {
+		expires, err = time.ParseInLocation(announcementExpiryLayout, form.Expires, app.viewerLocation(r))
+		if err != nil {
+			form.AddFieldError("expires", "This field must be a date and time")
+		} else {
+			form.CheckField(expires.After(time.Now()), "expires", "This field must be in the future")
+		}
+	}
+
+	if !form.Valid() {
+		app.renderAdminAnnouncement(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.announcements.Insert(form.Text, form.Severity, expires, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.announcementChanged(r)
+
+	app.infoLog.Printf("[%s] admin user %d published announcement %d", requestID(r), userID, id)
+
+	app.sessionManager.Put(r.Context(), "flash", "Announcement published")
+
+	http.Redirect(w, r, "/admin/announcement", http.StatusSeeOther)
+}
+
+// adminAnnouncementWithdrawPost takes down the current announcement before it expires.
+func (app *application) adminAnnouncementWithdrawPost(w http.ResponseWriter, r *http.Request) {
+	err := app.announcements.Withdraw()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.announcementChanged(r)
+
+	app.infoLog.Printf("[%s] admin user %d withdrew the announcement", requestID(r), app.authenticatedUserID(r))
+
+	app.sessionManager.Put(r.Context(), "flash", "Announcement withdrawn")
+
+	http.Redirect(w, r, "/admin/announcement", http.StatusSeeOther)
+}
+
+// announcementChanged drops the cached announcement, and the cached home page with it, so that the change shows up
+// straight away. The other cached pages catch up within a minute.
+func (app *application) announcementChanged(r *http.Request) {
+	err := app.cache.Delete(announcementCacheKey)
+	if err != nil {
+		app.errorLog.Printf("[%s] clearing the cached announcement: %s", requestID(r), err)
+	}
+	app.purgeCache("/")
+}
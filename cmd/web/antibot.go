@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/antibot"
+	"net/http"
+)
+
+// newAntibotGuard returns the guard for the signup and snippet forms, or nil if it's turned off. If the configuration
+// doesn't have a key, it makes a random one, and reports that it did.
+func newAntibotGuard(cfg config) (guard *antibot.Guard, randomKey bool, err error) {
+	if !cfg.antibot.enabled {
+		return nil, false, nil
+	}
+
+	// The key has already been checked by loadConfig.
+	key, _ := hex.DecodeString(cfg.antibot.key)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, err = rand.Read(key)
+		if err != nil {
+			return nil, false, err
+		}
+		randomKey = true
+	}
+
+	return antibot.New(key, cfg.antibot.minDelay, cfg.antibot.maxAge), randomKey, nil
+}
+
+// formToken returns a new token for the forms on a page, or "" if the spam protection is turned off.
+func (app *application) formToken() string {
+	if app.antibot == nil {
+		return ""
+	}
+	return app.antibot.Token()
+}
+
+// The blockBots middleware refuses form submissions which fill in the honeypot field, or which don't have a valid token,
+// before the handler (and so the database) sees them. Those are almost certainly bots, so they just get a 400 Bad Request.
+// A person might submit a form very quickly, or leave it open for a long time, so they're sent back to the empty form to
+// try again.
+func (app *application) blockBots(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.antibot == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		err = app.antibot.Check(r.PostForm.Get(antibot.TokenField), r.PostForm.Get(antibot.HoneypotField))
+		if err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.infoLog.Printf("[%s] refused a form from %s to %s: %s", requestID(r), clientIP(r), r.URL.Path, err)
+
+		if errors.Is(err, antibot.ErrTooFast) || errors.Is(err, antibot.ErrExpired) {
+			app.sessionManager.Put(r.Context(), "flash", "Sorry, we couldn't accept that form. Please fill it in again")
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+
+		app.clientError(w, http.StatusBadRequest)
+	})
+}
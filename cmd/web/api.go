@@ -0,0 +1,589 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/interchange"
+	"github.com/0xshiku/snippetbox/internal/langdetect"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"github.com/0xshiku/snippetbox/internal/webhooks"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The default number of days before a quick paste expires, if the client doesn't provide one.
+const quickDefaultExpires = 7
+
+// The lifetime of the API tokens handed out to paired browser extensions.
+const pairedTokenTTL = 365 * 24 * time.Hour
+
+// The problem type is an API error response, in the "problem details" format of RFC 7807. The type is always
+// "about:blank", which means that the title is just the name of the status code, and the detail says what went wrong.
+// Validation errors list each invalid field, and its problem, in errors. The request ID is there so that a user can
+// quote it when they report a problem, and we can find it in the logs.
+type problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// writeProblem sends a problem details response. It isn't a method, so that middleware which doesn't need the
+// application can use it too.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string, fieldErrors map[string]string) {
+	js, err := json.Marshal(problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Errors:    fieldErrors,
+		RequestID: requestID(r),
+	})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// The apiClientError() helper is the API's equivalent of clientError(). It sends a problem details response with the
+// given status code, and a detail which tells the client what was wrong with its request.
+func (app *application) apiClientError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	writeProblem(w, r, status, detail, nil)
+}
+
+// The apiFailedValidation() helper sends a 422 problem details response, listing the invalid fields and what's wrong
+// with each of them.
+func (app *application) apiFailedValidation(w http.ResponseWriter, r *http.Request, fieldErrors map[string]string) {
+	writeProblem(w, r, http.StatusUnprocessableEntity, "the request has invalid fields", fieldErrors)
+}
+
+// The apiServerError() helper is the API's equivalent of serverError(). It logs the error and sends a generic 500
+// problem details response, without any of the error's details.
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorLog.Output(2, fmt.Sprintf("[%s] %s", requestID(r), err))
+	app.recordServerError(err)
+	writeProblem(w, r, http.StatusInternalServerError, "the server encountered a problem and could not process your request", nil)
+}
+
+// The apiModelError() helper is the JSON equivalent of modelError(). It picks the status code from the kind of error
+// returned by the models, and only logs the errors that mean something has gone wrong on our side.
+func (app *application) apiModelError(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+
+	switch status {
+	case http.StatusInternalServerError:
+		app.apiServerError(w, r, err)
+	case http.StatusServiceUnavailable:
+		app.errorLog.Output(2, fmt.Sprintf("[%s] %s", requestID(r), err))
+		app.recordServerError(err)
+		writeProblem(w, r, status, "the server is temporarily unable to handle your request, please try again later", nil)
+	default:
+		writeProblem(w, r, status, "", nil)
+	}
+}
+
+// The quickInput type holds the information that we expect to be in a quick paste's request body. Only the content is
+// required. Everything else gets a sensible default, so a browser extension can send the bare minimum.
+type quickInput struct {
+	Title      string `json:"title,omitempty"`
+	Content    string `json:"content"`
+	Expires    int    `json:"expires,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+}
+
+func (app *application) quickCreate(w http.ResponseWriter, r *http.Request) {
+	var input quickInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiClientError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if input.Expires == 0 {
+		input.Expires = quickDefaultExpires
+	}
+
+	if input.Visibility == "" {
+		input.Visibility = models.VisibilityPublic
+	}
+
+	// If no title was provided, name the snippet after the language we think the content is written in.
+	if !validators.NotBlank(input.Title) {
+		input.Title = fmt.Sprintf("Untitled %s snippet", langdetect.Detect(input.Content))
+	}
+
+	var v validators.Validator
+
+	v.CheckField(validators.MaxChars(input.Title, 100), "title", "must not be more than 100 characters long")
+	v.CheckField(validators.NotBlank(input.Content), "content", "must be provided")
+	v.CheckField(validators.PermittedValue(input.Expires, 1, 7, 365), "expires", "must equal 1, 7 or 365")
+	v.CheckField(validators.PermittedValue(input.Visibility, models.VisibilityPublic, models.VisibilityUnlisted), "visibility", "must be public or unlisted")
+
+	if !v.Valid() {
+		app.apiFailedValidation(w, r, v.FieldErrors)
+		return
+	}
+
+	quota, err := app.snippetQuota(r)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	if message := quota.checkContent(input.Content); message != "" {
+		app.apiFailedValidation(w, r, map[string]string{"content": message})
+		return
+	}
+	if status, message := quota.checkCount(); status != 0 {
+		app.apiClientError(w, r, status, message)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	publicID, err := app.snippets.Insert(userID, input.Title, input.Content, input.Expires, input.Visibility)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.snippetEvent(r, webhooks.EventSnippetCreated, userID, publicID)
+	app.snippetsCreated(input.Visibility)
+
+	shareURL := fmt.Sprintf("%s://%s/snippet/view/%s", requestScheme(r), r.Host, publicID)
+
+	// Keep the response as small as possible: all a quick paste client needs is the link to share.
+	headers := make(http.Header)
+	headers.Set("Location", shareURL)
+
+	err = app.writeJSON(w, http.StatusCreated, map[string]string{"url": shareURL}, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// The apiSnippet type is how a snippet is represented in the API. The URL is the snippet's page, for sharing. Lists of
+// snippets leave out the content, which could be large.
+type apiSnippet struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content,omitempty"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	Visibility string    `json:"visibility"`
+	URL        string    `json:"url"`
+}
+
+func newAPISnippet(r *http.Request, s *models.Snippet) apiSnippet {
+	return apiSnippet{
+		ID:         s.PublicID,
+		Title:      s.Title,
+		Content:    s.Content,
+		Created:    s.Created,
+		Expires:    s.Expires,
+		Visibility: s.Visibility,
+		URL:        fmt.Sprintf("%s://%s/snippet/view/%s", requestScheme(r), r.Host, s.PublicID),
+	}
+}
+
+// apiSnippet looks up the snippet named in an API route. If it doesn't exist, the error response has already been
+// sent and it returns nil.
+func (app *application) apiSnippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	publicID := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if publicID == "" || len(publicID) > maxPublicIDLength {
+		app.apiClientError(w, r, http.StatusNotFound, "the requested snippet could not be found")
+		return nil
+	}
+
+	snippet, err := app.snippets.GetByPublicID(publicID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiClientError(w, r, http.StatusNotFound, "the requested snippet could not be found")
+		} else {
+			app.apiModelError(w, r, err)
+		}
+		return nil
+	}
+
+	return snippet
+}
+
+// snippetGet returns a snippet, including its content. Like the snippet's page, it works for any snippet that hasn't
+// expired, including unlisted ones, because the ID is all you need to see those.
+func (app *application) snippetGet(w http.ResponseWriter, r *http.Request) {
+	snippet := app.apiSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, map[string]any{"snippet": newAPISnippet(r, snippet)}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// The default and largest number of snippets on each page of the snippet list.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// The listMetadata type describes the page of a list that's been returned, and how many pages there are.
+type listMetadata struct {
+	CurrentPage  int `json:"current_page"`
+	PageSize     int `json:"page_size"`
+	FirstPage    int `json:"first_page"`
+	LastPage     int `json:"last_page"`
+	TotalRecords int `json:"total_records"`
+}
+
+// snippetsList returns a page of the authenticated user's unexpired snippets, without their content. The query string
+// picks the page (page and page_size), the order (sort, which defaults to -created, newest first) and can leave out
+// older snippets (created_after, in RFC 3339 format). The links to the other pages are in the Link header too.
+func (app *application) snippetsList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	var v validators.Validator
+
+	page := queryInt(qs, "page", 1, &v)
+	pageSize := queryInt(qs, "page_size", defaultPageSize, &v)
+
+	sort := qs.Get("sort")
+	if sort == "" {
+		sort = "-created"
+	}
+
+	var createdAfter time.Time
+	if value := qs.Get("created_after"); value != "" {
+		var err error
+		createdAfter, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			v.AddFieldError("created_after", "must be a time in RFC 3339 format, like 2024-01-02T15:04:05Z")
+		}
+	}
+
+	v.CheckField(page >= 1 && page <= 10_000_000, "page", "must be between 1 and 10000000")
+	v.CheckField(pageSize >= 1 && pageSize <= maxPageSize, "page_size", fmt.Sprintf("must be between 1 and %d", maxPageSize))
+	v.CheckField(validators.PermittedValue(sort, models.SnippetSorts...), "sort", "must be created, expires or title, with a - in front to reverse the order")
+
+	if !v.Valid() {
+		app.apiFailedValidation(w, r, v.FieldErrors)
+		return
+	}
+
+	snippets, total, err := app.snippets.ListForUser(app.authenticatedUserID(r), models.SnippetFilter{
+		Sort:         sort,
+		CreatedAfter: createdAfter,
+		Limit:        pageSize,
+		Offset:       (page - 1) * pageSize,
+	})
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	list := make([]apiSnippet, len(snippets))
+	for i, s := range snippets {
+		list[i] = newAPISnippet(r, s)
+		list[i].Content = ""
+	}
+
+	metadata := listMetadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     max(1, (total+pageSize-1)/pageSize),
+		TotalRecords: total,
+	}
+
+	headers := make(http.Header)
+	headers.Set("Link", pageLinks(r, metadata))
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"snippets": list, "metadata": metadata}, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// queryInt reads an integer from the query string, or returns the default if it isn't there. If it isn't an integer,
+// it adds an error for it to v.
+func queryInt(qs url.Values, key string, defaultValue int, v *validators.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddFieldError(key, "must be an integer")
+		return defaultValue
+	}
+
+	return i
+}
+
+// pageLinks returns a Link header (RFC 5988) with the first, previous, next and last pages of a list, as far as they
+// exist. The links keep the rest of the query string, so that they're for the same filter and sort.
+func pageLinks(r *http.Request, m listMetadata) string {
+	link := func(page int, rel string) string {
+		qs := r.URL.Query()
+		qs.Set("page", strconv.Itoa(page))
+		u := url.URL{Scheme: requestScheme(r), Host: r.Host, Path: r.URL.Path, RawQuery: qs.Encode()}
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+	}
+
+	links := []string{link(m.FirstPage, "first")}
+	if m.CurrentPage > m.FirstPage {
+		links = append(links, link(min(m.CurrentPage-1, m.LastPage), "prev"))
+	}
+	if m.CurrentPage < m.LastPage {
+		links = append(links, link(m.CurrentPage+1, "next"))
+	}
+	links = append(links, link(m.LastPage, "last"))
+
+	return strings.Join(links, ", ")
+}
+
+// The pairInput and pairResult types are the request and response bodies of the pairing exchange.
+type pairInput struct {
+	Code string `json:"code"`
+}
+
+type pairResult struct {
+	Token  string    `json:"token"`
+	Scope  string    `json:"scope"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// The pairExchange handler swaps a pairing code (shown to a logged-in user at /account/pair) for an API token.
+// This means that a browser extension never needs to see the user's password.
+func (app *application) pairExchange(w http.ResponseWriter, r *http.Request) {
+	var input pairInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiClientError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	code := models.NormalizePairingCode(input.Code)
+
+	var v validators.Validator
+	v.CheckField(validators.NotBlank(code), "code", "must be provided")
+
+	if !v.Valid() {
+		app.apiFailedValidation(w, r, v.FieldErrors)
+		return
+	}
+
+	// Consume the pairing code, so that it can't be used a second time.
+	userID, err := app.tokens.Consume(models.ScopePairing, code)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiClientError(w, r, http.StatusUnauthorized, "invalid or expired pairing code")
+		} else {
+			app.apiModelError(w, r, err)
+		}
+		return
+	}
+
+	token, err := app.tokens.New(userID, pairedTokenTTL, models.ScopeAPI)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, pairResult{
+		Token:  token.Plaintext,
+		Scope:  token.Scope,
+		Expiry: token.Expiry,
+	}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// The largest import that the API accepts in one request. Bigger imports should use the snippetbox import command.
+const maxImportBytes = 10 << 20
+
+// The most invalid lines that an import response lists. The rest are still counted.
+const maxImportErrors = 20
+
+// snippetsExport streams the authenticated user's unexpired snippets in the JSON Lines interchange format.
+func (app *application) snippetsExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="snippets.jsonl"`)
+
+	// Once the first line has been written, it's too late to send an error response, so a failure part way through just
+	// cuts the export short. Clients can tell, because the last line won't be complete.
+	iw := interchange.NewWriter(w)
+	err := app.snippets.Export(app.authenticatedUserID(r), func(s *models.Snippet, _ string) error {
+		return iw.Write(interchange.FromModel(s, ""))
+	})
+	if err != nil {
+		app.errorLog.Output(2, fmt.Sprintf("[%s] exporting snippets: %s", requestID(r), err))
+		app.recordServerError(err)
+	}
+}
+
+// The importResult type is the response to an import. Errors lists the lines which were invalid, and Stopped says why
+// the import stopped early, if it did.
+type importResult struct {
+	Errors   []string `json:"errors"`
+	Expired  int      `json:"expired"`
+	Imported int      `json:"imported"`
+	Invalid  int      `json:"invalid"`
+	Stopped  string   `json:"stopped,omitempty"`
+}
+
+// snippetsImport adds the snippets in a JSON Lines request body to the authenticated user's account. Invalid lines and
+// snippets which have already expired are skipped, and the response says how many of each there were.
+// Snippets which are too large for the user's quota count as invalid. If the user reaches their limit on the number of
+// snippets, the import stops there, and the response says why.
+func (app *application) snippetsImport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	quota, err := app.snippetQuota(r)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	var (
+		userID       = app.authenticatedUserID(r)
+		reader       = interchange.NewReader(r.Body)
+		now          = time.Now()
+		imported     int
+		expired      int
+		invalid      int
+		errs         []string
+		visibilities []string
+		stopped      string
+	)
+
+	for {
+		s, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var lineErr *interchange.LineError
+		if errors.As(err, &lineErr) {
+			invalid++
+			if len(errs) < maxImportErrors {
+				errs = append(errs, lineErr.Error())
+			}
+			continue
+		}
+
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.apiClientError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit))
+			return
+		}
+		if err != nil {
+			app.apiClientError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if !s.Expires.After(now) {
+			expired++
+			continue
+		}
+
+		if message := quota.checkContent(s.Content); message != "" {
+			invalid++
+			if len(errs) < maxImportErrors {
+				errs = append(errs, fmt.Sprintf("snippet %q: content: %s", s.Title, message))
+			}
+			continue
+		}
+
+		if status, message := quota.checkCount(); status != 0 {
+			stopped = message
+			break
+		}
+
+		_, err = app.snippets.Import(userID, s.Title, s.Content, s.Created, s.Expires, s.Visibility)
+		if err != nil {
+			app.apiModelError(w, r, err)
+			return
+		}
+		quota.add()
+		imported++
+		visibilities = append(visibilities, s.Visibility)
+	}
+
+	app.snippetsCreated(visibilities...)
+
+	response := importResult{
+		Errors:   errs,
+		Expired:  expired,
+		Imported: imported,
+		Invalid:  invalid,
+		Stopped:  stopped,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// The validateResult type is the response from the inline availability check. Error is empty if the value is valid.
+type validateResult struct {
+	Field string `json:"field"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+// The validateField handler checks a single signup field, so that forms can show whether an email address or username is
+// available while the user is still typing. It runs the same rules as the form, including the database lookups, and
+// responds with the first error (or an empty string if the value is fine).
+// Logged in users are checking their own details, so their current email address and username count as available.
+func (app *application) validateField(w http.ResponseWriter, r *http.Request) {
+	field := r.URL.Query().Get("field")
+	value := r.URL.Query().Get("value")
+
+	var rules []validators.Rule
+	switch field {
+	case "email":
+		rules = app.emailRules(app.authenticatedUserID(r))
+	case "username":
+		rules = app.usernameRules(app.authenticatedUserID(r))
+	default:
+		app.apiClientError(w, r, http.StatusBadRequest, `field must be "email" or "username"`)
+		return
+	}
+
+	var v validators.Validator
+	v.CheckString(field, value, rules...)
+
+	if err := v.Err(); err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, validateResult{
+		Field: field,
+		Valid: v.Valid(),
+		Error: v.FieldErrors[field],
+	}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"github.com/0xshiku/snippetbox/internal/webhooks"
+	"net/http"
+	"strconv"
+)
+
+// A batch is kept in the session until it's published, and the sessions table stores each session in a BLOB, which can't
+// hold more than 65535 bytes. These limits leave room for everything else in the session.
+const (
+	maxBatchSnippets = 10
+	maxBatchBytes    = 48 * 1024
+)
+
+// The batchData type holds the snippets which a user has added to their batch, for the batch page and the create page's
+// banner. Published holds the public IDs of the snippets from the batch they published last, so that the page can link
+// to them.
+type batchData struct {
+	Drafts    []models.SnippetDraft
+	Bytes     int
+	Published []string
+}
+
+// Create a new snippetBatchForm struct, for the settings which all the snippets in a batch share when it's published.
+type snippetBatchForm struct {
+	Expires              int    `form:"expires"`
+	Visibility           string `form:"visibility"`
+	validators.Validator `form:"-"`
+}
+
+func (form *snippetBatchForm) Validate(app *application) {
+	form.CheckField(validators.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal, 1, 7 or 365")
+	form.CheckField(validators.PermittedValue(form.Visibility, models.VisibilityPublic, models.VisibilityUnlisted), "visibility", "This field must be public or unlisted")
+}
+
+// snippetBatch returns the snippets in the current user's batch. The session can only hold types which have been
+// registered with gob, so the batch is stored as JSON.
+func (app *application) snippetBatch(r *http.Request) []models.SnippetDraft {
+	var drafts []models.SnippetDraft
+
+	stored := app.sessionManager.GetString(r.Context(), "snippetBatch")
+	if stored == "" {
+		return drafts
+	}
+
+	err := json.Unmarshal([]byte(stored), &drafts)
+	if err != nil {
+		app.errorLog.Printf("[%s] discarding an unreadable snippet batch: %s", requestID(r), err)
+		app.sessionManager.Remove(r.Context(), "snippetBatch")
+		return nil
+	}
+
+	return drafts
+}
+
+// saveSnippetBatch stores the batch in the session, or removes it if it's empty.
+func (app *application) saveSnippetBatch(r *http.Request, drafts []models.SnippetDraft) error {
+	if len(drafts) == 0 {
+		app.sessionManager.Remove(r.Context(), "snippetBatch")
+		return nil
+	}
+
+	js, err := json.Marshal(drafts)
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Put(r.Context(), "snippetBatch", string(js))
+	return nil
+}
+
+// batchBytes returns how much space the snippets in a batch take up, counting their titles along with their content.
+func batchBytes(drafts []models.SnippetDraft) int {
+	n := 0
+	for _, draft := range drafts {
+		n += len(draft.Title) + len(draft.Content)
+	}
+	return n
+}
+
+// newBatchData loads the batch for the template data.
+func (app *application) newBatchData(r *http.Request) batchData {
+	drafts := app.snippetBatch(r)
+	return batchData{Drafts: drafts, Bytes: batchBytes(drafts)}
+}
+
+// addToBatch adds the snippet from the create form to the user's batch, instead of publishing it straight away. The form
+// has already been validated, and its content checked against the quota, by snippetCreatePost. The number of snippets
+// is checked when the batch is published.
+func (app *application) addToBatch(w http.ResponseWriter, r *http.Request, form snippetCreateForm) {
+	drafts := app.snippetBatch(r)
+	draft := models.SnippetDraft{Title: form.Title, Content: form.Content}
+
+	if len(drafts) >= maxBatchSnippets {
+		form.AddNonFieldError(fmt.Sprintf("A batch can't have more than %d snippets. Please publish it before adding any more", maxBatchSnippets))
+	} else if batchBytes(drafts)+len(draft.Title)+len(draft.Content) > maxBatchBytes {
+		form.AddNonFieldError(fmt.Sprintf("A batch can't hold more than %d KB. Please publish it before adding any more", maxBatchBytes/1024))
+	}
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.Batch = batchData{Drafts: drafts, Bytes: batchBytes(drafts)}
+		app.render(w, r, http.StatusUnprocessableEntity, "create.gohtml", data)
+		return
+	}
+
+	err := app.saveSnippetBatch(r, append(drafts, draft))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet added to your batch (%d of %d)", len(drafts)+1, maxBatchSnippets))
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// renderBatch shows the batch page, with the given form for the shared settings.
+func (app *application) renderBatch(w http.ResponseWriter, r *http.Request, status int, form snippetBatchForm) {
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Batch = app.newBatchData(r)
+
+	if published, ok := app.sessionManager.Pop(r.Context(), "batchPublished").([]string); ok {
+		data.Batch.Published = published
+	}
+
+	app.render(w, r, status, "batch.gohtml", data)
+}
+
+// snippetBatchView shows the snippets in the user's batch, so that they can be checked before they're published.
+func (app *application) snippetBatchView(w http.ResponseWriter, r *http.Request) {
+	app.renderBatch(w, r, http.StatusOK, snippetBatchForm{
+		Expires:    app.site().DefaultExpiry,
+		Visibility: models.VisibilityPublic,
+	})
+}
+
+// snippetBatchRemovePost takes a snippet out of the batch. It's identified by its position, which the batch page sends.
+func (app *application) snippetBatchRemovePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	drafts := app.snippetBatch(r)
+
+	i, err := strconv.Atoi(r.PostForm.Get("index"))
+	if err != nil || i < 0 || i >= len(drafts) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.saveSnippetBatch(r, append(drafts[:i], drafts[i+1:]...))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet removed from your batch")
+
+	http.Redirect(w, r, "/snippet/batch", http.StatusSeeOther)
+}
+
+// snippetBatchPublishPost publishes every snippet in the batch, with the expiry and visibility chosen on the batch page.
+// They're inserted in one transaction, so if the quota or the database stops any of them, none are published and the
+// batch is left as it was.
+func (app *application) snippetBatchPublishPost(w http.ResponseWriter, r *http.Request) {
+	var form snippetBatchForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Validate(app)
+
+	drafts := app.snippetBatch(r)
+	if len(drafts) == 0 {
+		form.AddNonFieldError("There aren't any snippets in your batch")
+	}
+
+	quota, err := app.snippetQuota(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The quota can have changed since the snippets were added, so their sizes are checked again as well as their number.
+	for _, draft := range drafts {
+		if message := quota.checkContent(draft.Content); message != "" {
+			form.AddNonFieldError(fmt.Sprintf("%q is too large: %s", draft.Title, message))
+			break
+		}
+		if _, message := quota.checkCount(); message != "" {
+			form.AddNonFieldError(message)
+			break
+		}
+		quota.add()
+	}
+
+	if !form.Valid() {
+		app.renderBatch(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	publicIDs, err := app.snippets.InsertMany(userID, drafts, form.Expires, form.Visibility)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.snippetEvent(r, webhooks.EventSnippetCreated, userID, publicIDs...)
+	app.snippetsCreated(form.Visibility)
+
+	app.sessionManager.Remove(r.Context(), "snippetBatch")
+	app.sessionManager.Put(r.Context(), "batchPublished", publicIDs)
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%d snippets successfully created", len(publicIDs)))
+
+	http.Redirect(w, r, "/snippet/batch", http.StatusSeeOther)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/captcha"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"net/http"
+)
+
+// captchaWidget returns what the signup page needs to show the CAPTCHA, or nil if there isn't one.
+func (app *application) captchaWidget() *captcha.Widget {
+	if app.captcha == nil {
+		return nil
+	}
+
+	widget := app.captcha.Widget()
+	return &widget
+}
+
+// verifyCaptcha checks the CAPTCHA on a submitted form, if there is one, and adds an error to the form if the user didn't
+// pass it. If the service can't be reached the form is refused too (with a different message), because letting
+// everybody through would make the CAPTCHA pointless while it's down.
+func (app *application) verifyCaptcha(r *http.Request, v *validators.Validator) {
+	if app.captcha == nil {
+		return
+	}
+
+	err := app.captcha.Verify(r.Context(), r.PostForm.Get(app.captcha.Widget().Field), clientIP(r))
+	switch {
+	case errors.Is(err, captcha.ErrFailed):
+		v.AddNonFieldError("Please complete the CAPTCHA, to show us that you're not a robot")
+	case err != nil:
+		app.errorLog.Printf("[%s] verifying CAPTCHA: %s", requestID(r), err)
+		v.AddNonFieldError("We couldn't check the CAPTCHA. Please try again in a few minutes")
+	}
+}
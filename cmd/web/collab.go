@@ -0,0 +1,668 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/ot"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"github.com/0xshiku/snippetbox/internal/webhooks"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/websocket"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Shared drafts are an experimental way for several users to write a snippet together. Everybody who has a draft open is
+// connected to the server over a WebSocket. Their changes are sent as operations (see the ot package), which the server
+// puts in order, transforming each one against any changes that its author hadn't seen yet, and passes on to everybody
+// else. The draft is saved every few seconds while it's being edited, and its owner publishes it as a normal snippet.
+
+// How many drafts each user can own at once.
+const maxSharedDrafts = 10
+
+// How many of the latest operations are kept for transforming late ones against. A client whose operation is based on
+// an older revision than that is sent the whole draft again.
+const collabHistory = 1000
+
+// The limits on each connection: the largest message the server will read, how long a client can go without sending
+// anything (the editor sends a ping every 30 seconds), how long writing a message can take, and how many messages can be
+// waiting to be written before the client is treated as too slow and disconnected.
+const (
+	collabMaxMessage   = 256 * 1024
+	collabIdleTimeout  = 90 * time.Second
+	collabWriteTimeout = 10 * time.Second
+	collabSendBuffer   = 256
+)
+
+// The types of message that are sent over the WebSocket. Clients send "op" and "ping". The server sends "init" with the
+// whole draft when a client connects (and again, with an error, if one of its operations can't be used), "ack" when a
+// client's operation has been applied, "op" with other people's operations, "users" when somebody joins or leaves, and
+// "closed" when the draft has been published or deleted.
+const (
+	collabInit   = "init"
+	collabAck    = "ack"
+	collabOp     = "op"
+	collabPing   = "ping"
+	collabUsers  = "users"
+	collabClosed = "closed"
+)
+
+// The collabMessage type is every message sent over the WebSocket, with only the fields for its type filled in.
+type collabMessage struct {
+	Type     string        `json:"type"`
+	Revision int           `json:"revision"`
+	Op       *ot.Operation `json:"op,omitempty"`
+	Content  string        `json:"content,omitempty"`
+	Users    []string      `json:"users,omitempty"`
+	User     string        `json:"user,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	URL      string        `json:"url,omitempty"`
+}
+
+// The collabClient type is one open editor. Messages for it are queued on send, and written by its own goroutine.
+type collabClient struct {
+	name string
+	send chan collabMessage
+	done chan struct{}
+	once sync.Once
+}
+
+// post queues a message for the client. A client which isn't keeping up is disconnected, rather than holding up
+// everybody else, and gets the whole draft again when its editor reconnects.
+func (c *collabClient) post(m collabMessage) {
+	select {
+	case c.send <- m:
+	default:
+		c.disconnect()
+	}
+}
+
+func (c *collabClient) disconnect() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// The collabRoom type holds a draft which somebody has open. History holds the operations which took the content from
+// revision-len(history) to revision, and saved is the revision which was last saved to the database.
+type collabRoom struct {
+	publicID string
+	mu       sync.Mutex
+	content  string
+	revision int
+	history  []*ot.Operation
+	saved    int
+	clients  map[*collabClient]bool
+	closed   bool
+	stop     chan struct{}
+}
+
+// The collabHub type holds the drafts which are open, by public ID. A draft's room is made when the first person opens
+// it, and saved and removed when the last person leaves.
+type collabHub struct {
+	mu    sync.Mutex
+	rooms map[string]*collabRoom
+}
+
+func newCollabHub() *collabHub {
+	return &collabHub{rooms: map[string]*collabRoom{}}
+}
+
+// init returns the message which brings a client up to date with the whole draft.
+func (room *collabRoom) init(message string) collabMessage {
+	return collabMessage{Type: collabInit, Revision: room.revision, Content: room.content, Users: room.users(), Error: message}
+}
+
+// users returns the names of the people who have the draft open, in alphabetical order, and each of them only once.
+func (room *collabRoom) users() []string {
+	var names []string
+	for c := range room.clients {
+		names = append(names, c.name)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+func (room *collabRoom) broadcastUsers() {
+	m := collabMessage{Type: collabUsers, Revision: room.revision, Users: room.users()}
+	for c := range room.clients {
+		c.post(m)
+	}
+}
+
+// edit applies an operation from a client, which was made on the given revision. If other people's operations have been
+// applied since then, it's transformed against them first. The client is sent an acknowledgement, and everybody else
+// is sent the transformed operation. If the operation can't be used, the client is sent the whole draft again, and has
+// to throw away whatever it hadn't had acknowledged yet.
+func (room *collabRoom) edit(c *collabClient, revision int, op *ot.Operation) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	if room.closed {
+		return
+	}
+
+	oldest := room.revision - len(room.history)
+	if op == nil || revision < oldest || revision > room.revision {
+		c.post(room.init("Your editor fell too far behind, so it has been brought up to date. Your latest changes may have been lost."))
+		return
+	}
+
+	var err error
+	for _, concurrent := range room.history[revision-oldest:] {
+		op, _, err = ot.Transform(op, concurrent)
+		if err != nil {
+			break
+		}
+	}
+
+	content := room.content
+	if err == nil {
+		content, err = op.Apply(room.content)
+	}
+	if err != nil {
+		c.post(room.init("Your latest change couldn't be applied, so your editor has been brought up to date."))
+		return
+	}
+
+	if len(content) > maxContentBytes {
+		c.post(room.init(fmt.Sprintf("A draft can't be more than %d bytes long, so your latest change has been undone.", maxContentBytes)))
+		return
+	}
+
+	room.content = content
+	room.revision++
+	room.history = append(room.history, op)
+	if len(room.history) > collabHistory {
+		room.history = slices.Clone(room.history[len(room.history)-collabHistory:])
+	}
+
+	for other := range room.clients {
+		if other == c {
+			other.post(collabMessage{Type: collabAck, Revision: room.revision})
+		} else {
+			other.post(collabMessage{Type: collabOp, Revision: room.revision, Op: op, User: c.name})
+		}
+	}
+}
+
+// snapshot returns the current content of the draft.
+func (room *collabRoom) snapshot() string {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	return room.content
+}
+
+// joinDraft adds a client to the draft's room, making the room from the saved draft if nobody else has it open. The client is
+// sent the whole draft, and everybody else is told that they've joined.
+func (app *application) joinDraft(publicID string, c *collabClient) (*collabRoom, error) {
+	hub := app.collab
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	room, ok := hub.rooms[publicID]
+	if !ok {
+		// The draft is loaded while the hub is locked, so that it can't be read before the last person to leave has
+		// finished saving it.
+		draft, err := app.sharedDrafts.Get(publicID)
+		if err != nil {
+			return nil, err
+		}
+
+		room = &collabRoom{
+			publicID: publicID,
+			content:  draft.Content,
+			revision: draft.Revision,
+			saved:    draft.Revision,
+			clients:  map[*collabClient]bool{},
+			stop:     make(chan struct{}),
+		}
+		hub.rooms[publicID] = room
+
+		app.background(func() {
+			app.autosaveDraft(room)
+		})
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	room.clients[c] = true
+	c.post(room.init(""))
+	room.broadcastUsers()
+
+	return room, nil
+}
+
+// leaveDraft takes a client out of the room. If it was the last one, the draft is saved and the room is removed.
+func (app *application) leaveDraft(room *collabRoom, c *collabClient) {
+	hub := app.collab
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	room.mu.Lock()
+	delete(room.clients, c)
+	if len(room.clients) > 0 {
+		room.broadcastUsers()
+	}
+	empty := len(room.clients) == 0
+	room.mu.Unlock()
+
+	// A room which has been closed has already been removed, and might have been replaced by now.
+	if !empty || hub.rooms[room.publicID] != room {
+		return
+	}
+
+	delete(hub.rooms, room.publicID)
+	close(room.stop)
+	app.saveDraft(room)
+}
+
+// closeDraft disconnects everybody from a draft which has been published or deleted, telling them why. Their changes
+// aren't saved, because there's nothing left to save them to.
+func (app *application) closeDraft(publicID string, m collabMessage) {
+	hub := app.collab
+
+	hub.mu.Lock()
+	room, ok := hub.rooms[publicID]
+	if ok {
+		delete(hub.rooms, publicID)
+		close(room.stop)
+	}
+	hub.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	room.closed = true
+	for c := range room.clients {
+		c.post(m)
+		c.disconnect()
+	}
+}
+
+// autosaveDraft saves the draft every few seconds while it's open, so that not much is lost if the server stops.
+func (app *application) autosaveDraft(room *collabRoom) {
+	ticker := time.NewTicker(app.config.collab.saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-room.stop:
+			return
+		case <-ticker.C:
+			app.saveDraft(room)
+		}
+	}
+}
+
+// saveDraft saves the draft if it has changed since it was last saved. Errors are only logged, because the room still
+// has the changes, and they'll be saved next time.
+func (app *application) saveDraft(room *collabRoom) {
+	room.mu.Lock()
+	content, revision, changed := room.content, room.revision, room.revision != room.saved
+	room.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	err := app.sharedDrafts.Save(room.publicID, content, revision)
+	if err != nil {
+		app.errorLog.Printf("saving shared draft %s: %s", room.publicID, err)
+		return
+	}
+
+	room.mu.Lock()
+	room.saved = max(room.saved, revision)
+	room.mu.Unlock()
+}
+
+// collaborate runs one editor's connection, until it's closed or goes quiet. Messages are written by a separate
+// goroutine, so that a slow connection doesn't hold up the room, and everything still queued is written before the
+// connection is closed, so that people see why a draft has been closed.
+func (app *application) collaborate(ws *websocket.Conn, publicID, name string) {
+	// The connection was hijacked with the server's read and write deadlines still set.
+	ws.SetDeadline(time.Time{})
+	ws.MaxPayloadBytes = collabMaxMessage
+
+	c := &collabClient{
+		name: name,
+		send: make(chan collabMessage, collabSendBuffer),
+		done: make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ws.Close()
+
+		write := func(m collabMessage) error {
+			ws.SetWriteDeadline(time.Now().Add(collabWriteTimeout))
+			return websocket.JSON.Send(ws, m)
+		}
+
+		for {
+			select {
+			case m := <-c.send:
+				if write(m) != nil {
+					c.disconnect()
+					return
+				}
+			case <-c.done:
+				for {
+					select {
+					case m := <-c.send:
+						if write(m) != nil {
+							return
+						}
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	defer wg.Wait()
+	defer c.disconnect()
+
+	room, err := app.joinDraft(publicID, c)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.errorLog.Printf("opening shared draft %s: %s", publicID, err)
+		}
+		c.post(collabMessage{Type: collabClosed, Error: "This draft couldn't be opened."})
+		return
+	}
+	defer app.leaveDraft(room, c)
+
+	for {
+		ws.SetReadDeadline(time.Now().Add(collabIdleTimeout))
+
+		var m collabMessage
+		err := websocket.JSON.Receive(ws, &m)
+		if err != nil {
+			return
+		}
+
+		switch m.Type {
+		case collabPing:
+		case collabOp:
+			room.edit(c, m.Revision, m.Op)
+		default:
+			return
+		}
+	}
+}
+
+// The hijacker type lets the websocket package take over a connection through the middleware's wrapped
+// ResponseWriters. It needs a http.Hijacker, but the wrappers only support Unwrap, which http.ResponseController follows.
+type hijacker struct {
+	http.ResponseWriter
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(h.ResponseWriter).Hijack()
+}
+
+// sameOrigin refuses WebSocket connections from pages on other sites. Browsers send cookies with them, and don't apply
+// the same-origin policy, so without this any site could edit a draft as whoever visited it.
+func sameOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+
+	if origin == nil || origin.Host != r.Host {
+		return errors.New("cross-origin WebSocket connection")
+	}
+
+	return nil
+}
+
+// The sharedDraftData type holds the drafts for the drafts page, or the draft which is open in the editor.
+type sharedDraftData struct {
+	Drafts  []*models.SharedDraft
+	Draft   *models.SharedDraft
+	IsOwner bool
+}
+
+// The sharedDraftForm struct holds the title of a new draft.
+type sharedDraftForm struct {
+	Title                string `form:"title"`
+	validators.Validator `form:"-"`
+}
+
+func (form *sharedDraftForm) Validate(_ *application) {
+	form.CheckField(validators.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validators.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+}
+
+func (app *application) sharedDraftsView(w http.ResponseWriter, r *http.Request) {
+	app.renderSharedDrafts(w, r, http.StatusOK, sharedDraftForm{})
+}
+
+// renderSharedDrafts shows the drafts the user owns, along with the form for starting another one.
+func (app *application) renderSharedDrafts(w http.ResponseWriter, r *http.Request, status int, form sharedDraftForm) {
+	drafts, err := app.sharedDrafts.AllForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.SharedDrafts = sharedDraftData{Drafts: drafts}
+
+	app.render(w, r, status, "drafts.gohtml", data)
+}
+
+func (app *application) sharedDraftsPost(w http.ResponseWriter, r *http.Request) {
+	var form sharedDraftForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Validate(app)
+
+	userID := app.authenticatedUserID(r)
+
+	existing, err := app.sharedDrafts.AllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if len(existing) >= maxSharedDrafts {
+		form.AddNonFieldError(fmt.Sprintf("You can't have more than %d shared drafts. Please publish or delete one first.", maxSharedDrafts))
+	}
+
+	if !form.Valid() {
+		app.renderSharedDrafts(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	publicID, err := app.sharedDrafts.Insert(userID, form.Title)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Draft started. Send its link to anybody you'd like to write it with")
+
+	http.Redirect(w, r, "/draft/edit/"+publicID, http.StatusSeeOther)
+}
+
+// sharedDraft loads the draft named in the URL. If it doesn't exist, the error response has been sent and it returns nil.
+func (app *application) sharedDraft(w http.ResponseWriter, r *http.Request) *models.SharedDraft {
+	draft, err := app.sharedDrafts.Get(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil {
+		app.modelError(w, r, err)
+		return nil
+	}
+
+	return draft
+}
+
+// sharedDraftEdit shows the editor for a draft. Anybody who's logged in and has the link can edit it, but only its owner
+// can publish or delete it. The content on the page is what was last saved, and the editor replaces it with the latest
+// version when it connects.
+func (app *application) sharedDraftEdit(w http.ResponseWriter, r *http.Request) {
+	draft := app.sharedDraft(w, r)
+	if draft == nil {
+		return
+	}
+
+	app.renderSharedDraft(w, r, http.StatusOK, draft, snippetCreateForm{
+		Title:      draft.Title,
+		Expires:    app.site().DefaultExpiry,
+		Visibility: models.VisibilityPublic,
+	})
+}
+
+func (app *application) renderSharedDraft(w http.ResponseWriter, r *http.Request, status int, draft *models.SharedDraft, form snippetCreateForm) {
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.SharedDrafts = sharedDraftData{
+		Draft:   draft,
+		IsOwner: draft.UserID == app.authenticatedUserID(r),
+	}
+
+	app.render(w, r, status, "draft.gohtml", data)
+}
+
+// sharedDraftSocket is the WebSocket that the editor sends and receives changes over.
+func (app *application) sharedDraftSocket(w http.ResponseWriter, r *http.Request) {
+	draft := app.sharedDraft(w, r)
+	if draft == nil {
+		return
+	}
+
+	user := authenticatedUser(r)
+	name := user.Username
+	if name == "" {
+		name = user.Name
+	}
+
+	server := websocket.Server{
+		Handshake: sameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			app.collaborate(ws, draft.PublicID, name)
+		},
+	}
+
+	server.ServeHTTP(hijacker{w}, r)
+}
+
+// sharedDraftPublishPost publishes a draft as a snippet, with the title, expiry and visibility from the form, and
+// deletes the draft. The content is the latest version if anybody has the draft open, and what was last saved if not.
+// Anybody still editing it is told where the snippet is. A change made in the moment between the content being read and
+// the editors being closed is lost.
+func (app *application) sharedDraftPublishPost(w http.ResponseWriter, r *http.Request) {
+	draft := app.sharedDraft(w, r)
+	if draft == nil {
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	if draft.UserID != userID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Content = draft.Content
+	app.collab.mu.Lock()
+	room, ok := app.collab.rooms[draft.PublicID]
+	app.collab.mu.Unlock()
+	if ok {
+		form.Content = room.snapshot()
+	}
+
+	form.Validate(app)
+
+	quota, err := app.snippetQuota(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if message := quota.checkContent(form.Content); message != "" {
+		form.AddFieldError("content", message)
+	}
+	if status, message := quota.checkCount(); status != 0 {
+		form.AddNonFieldError(message)
+	}
+
+	if !form.Valid() {
+		app.renderSharedDraft(w, r, http.StatusUnprocessableEntity, draft, form)
+		return
+	}
+
+	// Create the snippet and delete the draft together, so that a failure can't leave both of them (or neither).
+	var publicID string
+	err = app.tx.WithTx(r.Context(), func(q *models.Queries) error {
+		var err error
+		publicID, err = q.Snippets.Insert(userID, form.Title, form.Content, form.Expires, form.Visibility)
+		if err != nil {
+			return err
+		}
+
+		err = q.SharedDrafts.Delete(draft.PublicID, userID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.snippetEvent(r, webhooks.EventSnippetCreated, userID, publicID)
+	app.snippetsCreated(form.Visibility)
+
+	app.closeDraft(draft.PublicID, collabMessage{Type: collabClosed, Error: "This draft has been published.", URL: "/snippet/view/" + publicID})
+
+	app.sessionManager.Put(r.Context(), "flash", "Draft published")
+
+	http.Redirect(w, r, "/snippet/view/"+publicID, http.StatusSeeOther)
+}
+
+// sharedDraftDeletePost deletes one of the user's drafts, disconnecting anybody who has it open.
+func (app *application) sharedDraftDeletePost(w http.ResponseWriter, r *http.Request) {
+	publicID := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	err := app.sharedDrafts.Delete(publicID, app.authenticatedUserID(r))
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.closeDraft(publicID, collabMessage{Type: collabClosed, Error: "This draft has been deleted by its owner."})
+
+	app.sessionManager.Put(r.Context(), "flash", "Draft deleted")
+
+	http.Redirect(w, r, "/drafts", http.StatusSeeOther)
+}
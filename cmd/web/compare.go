@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/diff"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"net/http"
+	"strings"
+)
+
+// The compareData type holds a line-by-line diff between two snippets, for the compare page. LeftID and RightID are the
+// public IDs from the query string, so that the form can be filled in again. Left and Right are nil until both are given.
+type compareData struct {
+	LeftID  string
+	RightID string
+	Left    *models.Snippet
+	Right   *models.Snippet
+	Lines   []diff.Line
+	Added   int
+	Removed int
+}
+
+// compare shows the differences between any two snippets, like configs posted by different users. It only shows snippets
+// that the viewer could open anyway: an unlisted snippet needs its ID, and an expired (or unknown) one gives a 404, the same
+// as on the view page. Without both IDs, it shows the form for choosing the snippets.
+func (app *application) compare(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	data := app.newTemplateData(r)
+	data.Compare = compareData{
+		LeftID:  strings.TrimSpace(query.Get("left")),
+		RightID: strings.TrimSpace(query.Get("right")),
+	}
+
+	// There's one page for every pair of snippets, so keep them all out of search engines, which have the snippets themselves.
+	app.setPageMeta(w, r, pageMeta{noIndex: true})
+
+	if data.Compare.LeftID == "" || data.Compare.RightID == "" {
+		app.render(w, r, http.StatusOK, "compare.gohtml", data)
+		return
+	}
+
+	if len(data.Compare.LeftID) > maxPublicIDLength || len(data.Compare.RightID) > maxPublicIDLength {
+		app.notFound(w, r)
+		return
+	}
+
+	left, err := app.snippets.GetByPublicID(data.Compare.LeftID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	right, err := app.snippets.GetByPublicID(data.Compare.RightID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	data.Compare.Left = left
+	data.Compare.Right = right
+	data.Compare.Lines = diff.Lines(left.Content, right.Content)
+
+	for _, line := range data.Compare.Lines {
+		switch line.Op {
+		case diff.Insert:
+			data.Compare.Added++
+		case diff.Delete:
+			data.Compare.Removed++
+		}
+	}
+
+	app.render(w, r, http.StatusOK, "compare.gohtml", data)
+}
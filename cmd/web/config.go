@@ -0,0 +1,1110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/captcha"
+	"github.com/0xshiku/snippetbox/internal/cdn"
+	"github.com/0xshiku/snippetbox/internal/hash"
+	"github.com/0xshiku/snippetbox/internal/ids"
+	"github.com/0xshiku/snippetbox/internal/jwt"
+	"github.com/0xshiku/snippetbox/internal/logfile"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/password"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"math"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The envPrefix is prepended to the upper-cased flag name to give the name of the matching environment variable.
+// For example, the -smtp-host flag can be set with SNIPPETBOX_SMTP_HOST.
+const envPrefix = "SNIPPETBOX_"
+
+// Define a config struct to hold all the configuration settings for our application.
+// The settings are read from command-line flags, environment variables and an optional config file, in that order of precedence.
+type config struct {
+	addr  string
+	dsn   string
+	debug bool
+	uiDir string
+	db    struct {
+		maxOpenConns    int
+		maxIdleConns    int
+		connMaxLifetime time.Duration
+		connMaxIdleTime time.Duration
+		replicas        []string
+		replicaInterval time.Duration
+		slowQuery       time.Duration
+		healthInterval  time.Duration
+		healthTimeout   time.Duration
+	}
+	tls struct {
+		certFile string
+		keyFile  string
+	}
+	autocert struct {
+		enabled  bool
+		hosts    []string
+		cacheDir string
+		email    string
+		httpAddr string
+	}
+	proxy struct {
+		trusted []netip.Prefix
+	}
+	log struct {
+		file           string
+		errorFile      string
+		maxSize        int
+		rotateInterval time.Duration
+		maxBackups     int
+		compress       bool
+	}
+	accessLog struct {
+		format string
+		file   string
+	}
+	timeouts struct {
+		idle  time.Duration
+		read  time.Duration
+		write time.Duration
+	}
+	session struct {
+		lifetime time.Duration
+	}
+	email struct {
+		lowercase        bool
+		collapseGmail    bool
+		stripPlusAliases bool
+		allowedDomains   []string
+	}
+	disposable struct {
+		block     bool
+		url       string
+		cacheFile string
+		refresh   time.Duration
+	}
+	guest struct {
+		enabled      bool
+		lifetime     time.Duration
+		warning      time.Duration
+		keepSnippets bool
+		interval     time.Duration
+		dryRun       bool
+	}
+	password struct {
+		minLength     int
+		requireUpper  bool
+		requireLower  bool
+		requireDigit  bool
+		requireSymbol bool
+		minEntropy    float64
+		denyList      string
+		breachCheck   bool
+		breachTimeout time.Duration
+		hasher        string
+		bcryptCost    int
+		argon2        struct {
+			memory      uint
+			iterations  uint
+			parallelism uint
+		}
+	}
+	ratelimit struct {
+		enabled  bool
+		requests int
+		window   time.Duration
+	}
+	reactions struct {
+		requests int
+		window   time.Duration
+	}
+	quota struct {
+		maxSnippets int
+		perHour     int
+		maxBytes    int
+	}
+	antibot struct {
+		enabled  bool
+		key      string
+		minDelay time.Duration
+		maxAge   time.Duration
+	}
+	captcha struct {
+		provider string
+		siteKey  string
+		secret   string
+		timeout  time.Duration
+	}
+	headers struct {
+		cspDefaultSrc         string
+		cspScriptSrc          string
+		cspStyleSrc           string
+		cspFontSrc            string
+		cspImgSrc             string
+		cspConnectSrc         string
+		referrerPolicy        string
+		hstsMaxAge            time.Duration
+		hstsIncludeSubdomains bool
+		hstsPreload           bool
+		frameOptions          string
+	}
+	cache struct {
+		public  string
+		private string
+		assets  string
+	}
+	lint struct {
+		enabled bool
+	}
+	cdn struct {
+		provider string
+		baseURL  string
+		zone     string
+		token    string
+	}
+	maintenance struct {
+		enabled bool
+		file    string
+	}
+	sentry struct {
+		dsn         string
+		environment string
+		release     string
+	}
+	alerts struct {
+		failedLogins int
+		serverErrors int
+		window       time.Duration
+	}
+	ids struct {
+		scheme string
+		node   int64
+	}
+	metrics struct {
+		enabled bool
+		token   string
+	}
+	slo struct {
+		availability     float64
+		latency          float64
+		latencyThreshold time.Duration
+	}
+	collab struct {
+		enabled      bool
+		saveInterval time.Duration
+	}
+	queryCache struct {
+		size          int
+		redisAddr     string
+		redisPassword string
+		redisDB       int
+		timeout       time.Duration
+	}
+	trash struct {
+		retention time.Duration
+		interval  time.Duration
+	}
+	jwt struct {
+		keys       []jwt.Key
+		ttl        time.Duration
+		refreshTTL time.Duration
+	}
+	oidc struct {
+		issuer       string
+		clientID     string
+		clientSecret string
+		name         string
+		signup       bool
+		timeout      time.Duration
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	// The effective value of every setting, for the admin runbook page.
+	snapshot []configSetting
+}
+
+// The configSetting type records the effective value of a setting and where it came from: the command line, the environment,
+// the config file, or the default.
+type configSetting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// The secretSettings are the ones whose values are redacted from the config snapshot.
+var secretSettings = map[string]bool{
+	"antibot-key":                true,
+	"captcha-secret":             true,
+	"cdn-token":                  true,
+	"jwt-keys":                   true,
+	"metrics-token":              true,
+	"oidc-client-secret":         true,
+	"query-cache-redis-password": true,
+	"sentry-dsn":                 true,
+	"smtp-password":              true,
+}
+
+// loadConfig builds the application configuration. Every setting is defined as a flag, so that the flag package
+// does the type conversion for all three sources. Values which weren't set on the command line are then filled in from the
+// environment, and failing that from the config file (given by -config or SNIPPETBOX_CONFIG).
+func loadConfig(name string, args []string, getenv func(string) string) (config, error) {
+	var cfg config
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	configFile := fs.String("config", "", "Path to an optional TOML config file")
+
+	// Define a new command-line flag with the name 'addr', a default value of ":4000"
+	// Also present a short help text explaining wha the flag controls.
+	fs.StringVar(&cfg.addr, "addr", ":4000", "HTTP network address")
+
+	// Define a new command-line flag for the MySQL DSN string.
+	fs.StringVar(&cfg.dsn, "dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
+
+	// Define the flags for the database connection pool. Keep the maximum number of connections for all the servers below
+	// MySQL's max_connections, and the lifetime below its wait_timeout, so that connections aren't closed under us.
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "Maximum number of open database connections (0 for no limit)")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "Maximum number of idle database connections to keep open")
+	fs.DurationVar(&cfg.db.connMaxLifetime, "db-conn-max-lifetime", time.Hour, "How long a database connection can be reused for (0 for no limit)")
+	fs.DurationVar(&cfg.db.connMaxIdleTime, "db-conn-max-idle-time", 15*time.Minute, "How long a database connection can be idle before it's closed (0 for no limit)")
+
+	// Read replicas take the queries which show snippets to visitors off the primary. They use the same pool settings.
+	// The DSNs aren't shown in the config snapshot, as they contain passwords.
+	fs.Func("db-replicas", "Comma-separated MySQL data source names of read replicas (empty to read everything from -dsn)", func(value string) error {
+		cfg.db.replicas = nil
+		for _, dsn := range strings.Split(value, ",") {
+			dsn = strings.TrimSpace(dsn)
+			if dsn == "" {
+				continue
+			}
+			if _, err := mysql.ParseDSN(dsn); err != nil {
+				return fmt.Errorf("invalid replica data source name: %w", err)
+			}
+			cfg.db.replicas = append(cfg.db.replicas, dsn)
+		}
+		return nil
+	})
+	fs.DurationVar(&cfg.db.replicaInterval, "db-replica-check-interval", 10*time.Second, "How often to check which read replicas are up")
+	fs.DurationVar(&cfg.db.healthInterval, "db-health-check-interval", 5*time.Second, "How often to check that the database is up")
+	fs.DurationVar(&cfg.db.healthTimeout, "db-health-check-timeout", 2*time.Second, "How long the database has to answer a health check, and /readyz waits for its checks")
+	fs.DurationVar(&cfg.db.slowQuery, "db-slow-query-threshold", 200*time.Millisecond, "Log database queries which take longer than this (0 to log none)")
+
+	// Creates a new debug flag with the default value of false
+	fs.BoolVar(&cfg.debug, "debug", false, "Enable debug mode")
+
+	// In debug mode, templates are re-read from this directory on every request, so that changes show up without a restart.
+	fs.StringVar(&cfg.uiDir, "ui-dir", "./ui", "Directory to reload templates from in debug mode")
+
+	// To install certificates locally we can run: go run /usr/local/go/src/crypto/tls/generate_cert.go --rsa-bits=2048 --host=localhost
+	fs.StringVar(&cfg.tls.certFile, "tls-cert", "./tls/cert.pem", "TLS certificate file")
+	fs.StringVar(&cfg.tls.keyFile, "tls-key", "./tls/key.pem", "TLS private key file")
+
+	// Settings for fetching certificates automatically from Let's Encrypt, instead of using the files above.
+	fs.BoolVar(&cfg.autocert.enabled, "autocert", false, "Obtain TLS certificates automatically from Let's Encrypt")
+	fs.Func("autocert-hosts", "Comma-separated list of host names to obtain certificates for (required with -autocert)", func(value string) error {
+		cfg.autocert.hosts = nil
+		for _, host := range strings.Split(value, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				cfg.autocert.hosts = append(cfg.autocert.hosts, host)
+			}
+		}
+		return nil
+	})
+	fs.StringVar(&cfg.autocert.cacheDir, "autocert-cache", "./tls/autocert", "Directory for caching automatically obtained certificates")
+	fs.StringVar(&cfg.autocert.email, "autocert-email", "", "Contact email address for the Let's Encrypt account")
+	fs.StringVar(&cfg.autocert.httpAddr, "autocert-http-addr", ":80", "HTTP address for ACME challenges and redirects to HTTPS (empty to disable)")
+
+	// Requests from these addresses (like an nginx reverse proxy) are trusted to report the real client IP address and scheme
+	// in the X-Forwarded-For and X-Forwarded-Proto headers. A single address is treated as a /32 (or /128) range.
+	fs.Func("proxy-trusted", "Comma-separated IP addresses or CIDR ranges of trusted reverse proxies", func(value string) error {
+		cfg.proxy.trusted = nil
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(field)
+				if addrErr != nil {
+					return fmt.Errorf("invalid IP address or CIDR range %q", field)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			cfg.proxy.trusted = append(cfg.proxy.trusted, prefix.Masked())
+		}
+		return nil
+	})
+
+	// Define the flags for writing the logs to files instead of stdout and stderr, for servers without journald. The files
+	// are rotated when they get too big or a new interval starts, and the old ones are kept with the time in their names.
+	fs.StringVar(&cfg.log.file, "log-file", "", "File to append information messages to (empty for stdout)")
+	fs.StringVar(&cfg.log.errorFile, "error-log-file", "", "File to append error messages to (empty for stderr)")
+	fs.IntVar(&cfg.log.maxSize, "log-max-size", 100, "Rotate a log file when it reaches this many megabytes (0 for no limit)")
+	fs.DurationVar(&cfg.log.rotateInterval, "log-rotate-interval", 24*time.Hour, "Rotate the log files at the start of each interval, so 24h rotates them at midnight UTC (0 to turn off)")
+	fs.IntVar(&cfg.log.maxBackups, "log-max-backups", 7, "Number of rotated files to keep for each log (0 to keep them all)")
+	fs.BoolVar(&cfg.log.compress, "log-compress", true, "Compress rotated log files with gzip")
+
+	// Define the flags for the access log, which has a line for every request once its response has been sent. The
+	// common and combined formats are the ones Apache and nginx write, so that existing tools can read the log.
+	fs.StringVar(&cfg.accessLog.format, "access-log-format", accessLogCombined, "Access log format (common|combined|json)")
+	fs.StringVar(&cfg.accessLog.file, "access-log-file", "", "File to append the access log to, which is rotated like the others (empty to write it with the information messages)")
+
+	fs.DurationVar(&cfg.timeouts.idle, "idle-timeout", time.Minute, "Server idle timeout")
+	fs.DurationVar(&cfg.timeouts.read, "read-timeout", 5*time.Second, "Server read timeout")
+	fs.DurationVar(&cfg.timeouts.write, "write-timeout", 10*time.Second, "Server write timeout")
+
+	fs.DurationVar(&cfg.session.lifetime, "session-lifetime", 12*time.Hour, "Session lifetime")
+
+	// Define the flags for normalizing email addresses, which decides when two addresses belong to the same account.
+	fs.BoolVar(&cfg.email.lowercase, "email-lowercase", true, "Treat email addresses as case-insensitive")
+	fs.BoolVar(&cfg.email.collapseGmail, "email-collapse-gmail", false, "Ignore dots and +aliases in Gmail addresses")
+	fs.BoolVar(&cfg.email.stripPlusAliases, "email-strip-plus-aliases", false, "Ignore +aliases in all email addresses")
+
+	// For internal deployments, new accounts (from signup or single sign-on) can be limited to addresses at some domains.
+	fs.Func("email-allowed-domains", "Comma-separated email domains that new accounts must use, like example.com (empty to allow any)", func(value string) error {
+		cfg.email.allowedDomains = nil
+		for _, domain := range strings.Split(value, ",") {
+			domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+			if domain == "" {
+				continue
+			}
+			if strings.ContainsAny(domain, "@ ") || !strings.Contains(domain, ".") {
+				return fmt.Errorf("invalid email domain %q", domain)
+			}
+			cfg.email.allowedDomains = append(cfg.email.allowedDomains, domain)
+		}
+		return nil
+	})
+
+	// Define the flags for detecting disposable email addresses. The block setting is only the default, as admins can
+	// turn it on and off from the /admin/settings page.
+	fs.BoolVar(&cfg.disposable.block, "disposable-block", true, "Block disposable email addresses at signup")
+	fs.StringVar(&cfg.disposable.url, "disposable-url", "https://raw.githubusercontent.com/disposable-email-domains/disposable-email-domains/main/disposable_email_blocklist.conf", "URL of the disposable email domain list (empty to use the built-in list only)")
+	fs.StringVar(&cfg.disposable.cacheFile, "disposable-cache-file", "./disposable-domains.txt", "File for caching the downloaded disposable email domain list")
+	fs.DurationVar(&cfg.disposable.refresh, "disposable-refresh", 24*time.Hour, "How often to download the disposable email domain list")
+
+	// Define the flags for guest accounts, which people can choose at signup to try the site out. They're deleted when their
+	// lifetime is up, after an email warning. Their snippets can be kept (without an owner) or deleted along with them.
+	fs.BoolVar(&cfg.guest.enabled, "guest-enabled", false, "Offer guest accounts at signup")
+	fs.DurationVar(&cfg.guest.lifetime, "guest-lifetime", 7*24*time.Hour, "How long guest accounts last before they're deleted")
+	fs.DurationVar(&cfg.guest.warning, "guest-warning", 24*time.Hour, "How long before a guest account is deleted to email a warning (0 for no warning)")
+	fs.BoolVar(&cfg.guest.keepSnippets, "guest-keep-snippets", false, "Keep the snippets of deleted guest accounts, as anonymous snippets")
+	fs.DurationVar(&cfg.guest.interval, "guest-interval", time.Hour, "How often to check for guest accounts to warn or delete")
+	fs.BoolVar(&cfg.guest.dryRun, "guest-dry-run", false, "Log what deleting expired guest accounts would change, without deleting them")
+
+	// Define the flags for the password policy, which applies whenever a user chooses a new password.
+	fs.IntVar(&cfg.password.minLength, "password-min-length", 8, "Minimum password length")
+	fs.BoolVar(&cfg.password.requireUpper, "password-require-upper", false, "Require an uppercase letter in passwords")
+	fs.BoolVar(&cfg.password.requireLower, "password-require-lower", false, "Require a lowercase letter in passwords")
+	fs.BoolVar(&cfg.password.requireDigit, "password-require-digit", false, "Require a digit in passwords")
+	fs.BoolVar(&cfg.password.requireSymbol, "password-require-symbol", false, "Require a symbol in passwords")
+	fs.Float64Var(&cfg.password.minEntropy, "password-min-entropy", 30, "Minimum estimated password strength in bits (0 to turn off)")
+	fs.StringVar(&cfg.password.denyList, "password-deny-list", "", "File of extra disallowed passwords, one per line")
+	fs.BoolVar(&cfg.password.breachCheck, "password-breach-check", false, "Reject passwords found in the Have I Been Pwned breach corpus")
+	fs.StringVar(&cfg.password.hasher, "password-hasher", "bcrypt", "Algorithm for new password hashes: bcrypt or argon2id (older hashes are upgraded when users log in)")
+	fs.IntVar(&cfg.password.bcryptCost, "password-bcrypt-cost", hash.DefaultBcryptCost, "Bcrypt cost for password hashes (older hashes are upgraded when users log in)")
+	fs.UintVar(&cfg.password.argon2.memory, "password-argon2-memory", uint(hash.DefaultArgon2id.Memory), "Argon2id memory for password hashes, in KiB")
+	fs.UintVar(&cfg.password.argon2.iterations, "password-argon2-iterations", uint(hash.DefaultArgon2id.Iterations), "Argon2id passes over the memory for password hashes")
+	fs.UintVar(&cfg.password.argon2.parallelism, "password-argon2-parallelism", uint(hash.DefaultArgon2id.Parallelism), "Argon2id threads for password hashes")
+	fs.DurationVar(&cfg.password.breachTimeout, "password-breach-timeout", 2*time.Second, "How long to wait for the breach check before allowing the password anyway")
+
+	// Define the flags for the rate limiter, which allows each client IP address a number of requests per window.
+	fs.BoolVar(&cfg.ratelimit.enabled, "ratelimit-enabled", true, "Enable rate limiting")
+	fs.IntVar(&cfg.ratelimit.requests, "ratelimit-requests", 120, "Maximum requests per client in each rate limit window")
+	fs.DurationVar(&cfg.ratelimit.window, "ratelimit-window", time.Minute, "Rate limit window")
+
+	// Reactions have their own, tighter, limit for each user, so that nobody can flood snippets with them.
+	fs.IntVar(&cfg.reactions.requests, "reactions-requests", 30, "Maximum reactions each user can add or remove in a window (0 for no limit)")
+	fs.DurationVar(&cfg.reactions.window, "reactions-window", time.Minute, "Reactions rate limit window")
+
+	// Define the flags for the snippet quotas, so that one user can't fill up the database. Admins aren't held to them.
+	// The content of a snippet is stored in a TEXT column, so it can never be more than 65535 bytes.
+	fs.IntVar(&cfg.quota.maxSnippets, "quota-max-snippets", 1000, "Maximum unexpired snippets each user can have (0 for no limit)")
+	fs.IntVar(&cfg.quota.perHour, "quota-per-hour", 60, "Maximum snippets each user can create in an hour (0 for no limit)")
+	fs.IntVar(&cfg.quota.maxBytes, "quota-max-bytes", maxContentBytes, "Maximum size of a snippet's content, in bytes")
+
+	// Define the flags for the spam protection on the signup and snippet forms. Without a key, a random one is made at
+	// startup, which is fine for a single instance, but means that forms shown before a restart are refused after it.
+	fs.BoolVar(&cfg.antibot.enabled, "antibot-enabled", true, "Add a honeypot field and a signed timestamp to the signup and snippet forms")
+	fs.StringVar(&cfg.antibot.key, "antibot-key", "", "Hex-encoded key for signing form timestamps, at least 32 bytes (random if empty)")
+	fs.DurationVar(&cfg.antibot.minDelay, "antibot-min-delay", 2*time.Second, "Refuse forms submitted sooner than this after they were shown")
+	fs.DurationVar(&cfg.antibot.maxAge, "antibot-max-age", 24*time.Hour, "Refuse forms submitted later than this after they were shown")
+
+	// Define the flags for the CAPTCHA on the signup form. It's off unless a provider is chosen.
+	fs.StringVar(&cfg.captcha.provider, "captcha-provider", "", "CAPTCHA service for the signup form: hcaptcha, turnstile or recaptcha (empty for none)")
+	fs.StringVar(&cfg.captcha.siteKey, "captcha-site-key", "", "CAPTCHA site key, which is shown on the page")
+	fs.StringVar(&cfg.captcha.secret, "captcha-secret", "", "CAPTCHA secret key, for checking responses")
+	fs.DurationVar(&cfg.captcha.timeout, "captcha-timeout", 5*time.Second, "How long to wait for the CAPTCHA service to check a response")
+
+	// Define the flags for the security headers sent with every response. An empty CSP directive is left out of the policy,
+	// and the per-request nonce is always added to script-src. HSTS is off by default, because browsers won't let users
+	// click through the warning for a self-signed development certificate once it's on.
+	fs.StringVar(&cfg.headers.cspDefaultSrc, "headers-csp-default-src", "'self'", "Content-Security-Policy default-src directive")
+	fs.StringVar(&cfg.headers.cspScriptSrc, "headers-csp-script-src", "'self'", "Content-Security-Policy script-src directive")
+	fs.StringVar(&cfg.headers.cspStyleSrc, "headers-csp-style-src", "'self' fonts.googleapis.com", "Content-Security-Policy style-src directive")
+	fs.StringVar(&cfg.headers.cspFontSrc, "headers-csp-font-src", "fonts.gstatic.com", "Content-Security-Policy font-src directive")
+	fs.StringVar(&cfg.headers.cspImgSrc, "headers-csp-img-src", "", "Content-Security-Policy img-src directive")
+	fs.StringVar(&cfg.headers.cspConnectSrc, "headers-csp-connect-src", "", "Content-Security-Policy connect-src directive")
+	fs.StringVar(&cfg.headers.referrerPolicy, "headers-referrer-policy", "origin-when-cross-origin", "Referrer-Policy header")
+	fs.DurationVar(&cfg.headers.hstsMaxAge, "headers-hsts-max-age", 0, "Strict-Transport-Security max-age (0 to leave the header out)")
+	fs.BoolVar(&cfg.headers.hstsIncludeSubdomains, "headers-hsts-include-subdomains", false, "Add includeSubDomains to the Strict-Transport-Security header")
+	fs.BoolVar(&cfg.headers.hstsPreload, "headers-hsts-preload", false, "Add preload to the Strict-Transport-Security header")
+	fs.StringVar(&cfg.headers.frameOptions, "headers-frame-options", "deny", "X-Frame-Options header (deny|sameorigin, or empty to leave it out)")
+
+	// Define the Cache-Control policies for each group of routes. The public policy is only used for anonymous visitors,
+	// because logged-in users see their own name in the navigation. Set it to something like "public, s-maxage=60" to let
+	// a CDN cache public pages. The assets policy is only used for static files requested with the current UI build's
+	// checksum (as the base template does), so that a new build is never hidden by an old cached copy.
+	fs.StringVar(&cfg.cache.public, "cache-public", "private, no-cache", "Cache-Control header for public pages viewed by anonymous visitors")
+	fs.StringVar(&cfg.cache.private, "cache-private", "no-store", "Cache-Control header for pages which need authentication, and the API")
+	fs.StringVar(&cfg.cache.assets, "cache-assets", "public, max-age=31536000, immutable", "Cache-Control header for versioned static files")
+
+	// Linting checks new snippets for mistakes like invalid JSON, and shows warnings to their owners. It never rejects a snippet.
+	fs.BoolVar(&cfg.lint.enabled, "lint-enabled", true, "Warn about possible mistakes in JSON, YAML and shell snippets")
+
+	// Define the flags for purging pages from a CDN when the snippets on them change or are deleted. The CDN only caches
+	// pages if -cache-public allows it. The base URL is the address that visitors use, which is what the CDN caches pages under.
+	fs.StringVar(&cfg.cdn.provider, "cdn-provider", "", "CDN to purge changed pages from (cloudflare|fastly, or empty for none)")
+	fs.StringVar(&cfg.cdn.baseURL, "cdn-base-url", "", "Public base URL of the site, like https://snippets.example.com (required with -cdn-provider)")
+	fs.StringVar(&cfg.cdn.zone, "cdn-zone", "", "Cloudflare zone ID")
+	fs.StringVar(&cfg.cdn.token, "cdn-token", "", "CDN API token")
+
+	// Define the flags for maintenance mode, in which everybody but admins gets a 503 page. The enabled setting is only the
+	// default, as admins can turn it on and off from /admin/settings. The file takes a server down even while the
+	// database can't be reached.
+	fs.BoolVar(&cfg.maintenance.enabled, "maintenance-enabled", false, "Be in maintenance mode unless an admin has turned it off")
+	fs.StringVar(&cfg.maintenance.file, "maintenance-file", "", "Put the site into maintenance mode while this file exists (empty to turn off)")
+
+	// Define the flags for reporting server errors to Sentry, along with their stack traces, request IDs and user IDs.
+	// The environment and release are attached to each event, so that they can be told apart in Sentry.
+	fs.StringVar(&cfg.sentry.dsn, "sentry-dsn", "", "Sentry DSN to report server errors to (empty to only log them)")
+	fs.StringVar(&cfg.sentry.environment, "sentry-environment", "production", "Environment name for Sentry events")
+	fs.StringVar(&cfg.sentry.release, "sentry-release", "", "Release name for Sentry events, like a git commit hash")
+
+	// Define the flags for the security alerts emailed to admins. The thresholds are only the defaults, as admins can
+	// change them from the /admin/settings page.
+	fs.IntVar(&cfg.alerts.failedLogins, "alerts-failed-logins", 20, "Email admins after this many failed logins in an alert window (0 to turn off)")
+	fs.IntVar(&cfg.alerts.serverErrors, "alerts-server-errors", 10, "Email admins after this many server errors in an alert window (0 to turn off)")
+	fs.DurationVar(&cfg.alerts.window, "alerts-window", 10*time.Minute, "Security alert window")
+
+	// Define the flags for generating the public IDs of snippets. When running more than one instance with snowflake IDs,
+	// every instance needs a different node number.
+	fs.StringVar(&cfg.ids.scheme, "ids-scheme", ids.SchemeULID, "Public snippet ID scheme (ulid|snowflake)")
+	fs.Int64Var(&cfg.ids.node, "ids-node", 0, "Node number for snowflake IDs (0-1023)")
+
+	// Define the flags for the /metrics endpoint, which reports request counts and SLO burn rates in the Prometheus text
+	// format. Without a token, anybody who can reach the server can read it.
+	fs.BoolVar(&cfg.metrics.enabled, "metrics-enabled", false, "Serve request counts and SLO burn rates at /metrics")
+	fs.StringVar(&cfg.metrics.token, "metrics-token", "", "Bearer token required to read /metrics (empty for none)")
+
+	// Define the service level objectives that the burn rates on /metrics and the admin runbook page are worked out for.
+	fs.Float64Var(&cfg.slo.availability, "slo-availability", 0.999, "Fraction of requests which should succeed (not fail with a 5xx status)")
+	fs.Float64Var(&cfg.slo.latency, "slo-latency", 0.99, "Fraction of requests which should be faster than -slo-latency-threshold")
+	fs.DurationVar(&cfg.slo.latencyThreshold, "slo-latency-threshold", 500*time.Millisecond, "Requests slower than this count against the latency objective")
+
+	// Define the flags for shared drafts, which several users can edit at once over WebSockets before one of them is
+	// published as a snippet. They're experimental, so they're off by default.
+	fs.BoolVar(&cfg.collab.enabled, "collab-enabled", false, "Turn on experimental shared drafts, which several users can edit at once")
+	fs.DurationVar(&cfg.collab.saveInterval, "collab-save-interval", 10*time.Second, "How often to save shared drafts while they're being edited")
+
+	// Define the flags for the cache of the busiest pages' query results (not to be confused with the Cache-Control
+	// headers above). It's kept in memory unless there's a Redis server, which several servers can share.
+	fs.IntVar(&cfg.queryCache.size, "query-cache-size", 1000, "Maximum number of values in the in-memory cache")
+	fs.StringVar(&cfg.queryCache.redisAddr, "query-cache-redis-addr", "", "Address (host:port) of a Redis server for the cache (empty to keep it in memory)")
+	fs.StringVar(&cfg.queryCache.redisPassword, "query-cache-redis-password", "", "Password for the Redis server")
+	fs.IntVar(&cfg.queryCache.redisDB, "query-cache-redis-db", 0, "Redis database number for the cache")
+	fs.DurationVar(&cfg.queryCache.timeout, "query-cache-redis-timeout", 500*time.Millisecond, "Timeout for each Redis command")
+
+	// Define the flags for the trash. Deleted snippets stay there, where their owners can restore them, until a background
+	// job purges them for good.
+	fs.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted snippets stay in the trash before they're purged")
+	fs.DurationVar(&cfg.trash.interval, "trash-interval", time.Hour, "How often to purge snippets which have been in the trash too long")
+
+	// Define the flags for the short-lived JWT access tokens which POST /api/v1/tokens issues, along with refresh tokens.
+	// The endpoint is only there if there's a key. Tokens are signed with the first key and accepted with any of them, so
+	// to rotate keys, put a new one first and remove the old one once -jwt-ttl has passed.
+	fs.Func("jwt-keys", "Comma-separated key-id=hex-secret pairs for signing JWT access tokens, each at least 32 bytes (empty to turn them off)", func(value string) error {
+		cfg.jwt.keys = nil
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+
+			id, secret, ok := strings.Cut(field, "=")
+			key, err := hex.DecodeString(secret)
+			if !ok || id == "" || err != nil || len(key) < 32 {
+				return errors.New("each key must be a key-id=hex-secret pair, with at least 32 bytes of secret")
+			}
+			for _, k := range cfg.jwt.keys {
+				if k.ID == id {
+					return fmt.Errorf("duplicate key ID %q", id)
+				}
+			}
+			cfg.jwt.keys = append(cfg.jwt.keys, jwt.Key{ID: id, Secret: key})
+		}
+		return nil
+	})
+	fs.DurationVar(&cfg.jwt.ttl, "jwt-ttl", 15*time.Minute, "How long JWT access tokens are valid for")
+	fs.DurationVar(&cfg.jwt.refreshTTL, "jwt-refresh-ttl", 30*24*time.Hour, "How long refresh tokens are valid for, if they aren't used")
+
+	// Define the flags for logging in with an OpenID Connect provider, like Keycloak or Auth0. It's off unless an issuer
+	// is set. The provider has to allow /user/login/oidc/callback on this site as a redirect URL. Users are matched to
+	// accounts by their (verified) email address.
+	fs.StringVar(&cfg.oidc.issuer, "oidc-issuer", "", "OpenID Connect issuer URL, like https://sso.example.com/realms/staff (empty for none)")
+	fs.StringVar(&cfg.oidc.clientID, "oidc-client-id", "", "OpenID Connect client ID (required with -oidc-issuer)")
+	fs.StringVar(&cfg.oidc.clientSecret, "oidc-client-secret", "", "OpenID Connect client secret")
+	fs.StringVar(&cfg.oidc.name, "oidc-name", "single sign-on", "Name of the provider, for the login button")
+	fs.BoolVar(&cfg.oidc.signup, "oidc-signup", true, "Create accounts for people who log in with the provider and don't have one yet")
+	fs.DurationVar(&cfg.oidc.timeout, "oidc-timeout", 10*time.Second, "How long to wait for the OpenID Connect provider")
+
+	// Define the flags for the SMTP server used to send emails (like email change confirmations).
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Snippetbox <no-reply@snippetbox.example>", "SMTP sender")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, err
+	}
+
+	// Record which flags were explicitly set on the command line. These always win.
+	set := map[string]bool{}
+	sources := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		sources[f.Name] = "command line"
+	})
+
+	path := *configFile
+	if path == "" {
+		path = getenv(envPrefix + "CONFIG")
+	}
+
+	fileValues := map[string]string{}
+	if path != "" {
+		fileValues, err = readConfigFile(path)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	// Check that the config file doesn't contain any settings we don't know about, so that typos don't go unnoticed.
+	for key := range fileValues {
+		if fs.Lookup(key) == nil || key == "config" {
+			return cfg, fmt.Errorf("config file %s: unknown setting %q", path, key)
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || f.Name == "config" {
+			return
+		}
+
+		if value, ok := lookupEnv(getenv, f.Name); ok {
+			sources[f.Name] = "environment"
+			err = fs.Set(f.Name, value)
+			if err != nil {
+				err = fmt.Errorf("environment variable %s: %w", envName(f.Name), err)
+			}
+			return
+		}
+
+		if value, ok := fileValues[f.Name]; ok {
+			sources[f.Name] = "config file"
+			err = fs.Set(f.Name, value)
+			if err != nil {
+				err = fmt.Errorf("config file %s: setting %q: %w", path, f.Name, err)
+			}
+		}
+	})
+
+	if err != nil {
+		return cfg, err
+	}
+
+	// Refuse to start in autocert mode without a host allowlist, otherwise anybody could point a domain at the server
+	// and make it request certificates on their behalf.
+	if cfg.autocert.enabled && len(cfg.autocert.hosts) == 0 {
+		return cfg, errors.New("-autocert-hosts must be set when -autocert is enabled")
+	}
+
+	if cfg.log.maxSize < 0 || cfg.log.rotateInterval < 0 || cfg.log.maxBackups < 0 {
+		return cfg, errors.New("-log-max-size, -log-rotate-interval and -log-max-backups can't be negative")
+	}
+
+	// Each file is rotated by its own logger, so two logs can't share one.
+	logFiles := []string{cfg.log.file, cfg.log.errorFile, cfg.accessLog.file}
+	for i, file := range logFiles {
+		if file != "" && slices.Contains(logFiles[i+1:], file) {
+			return cfg, fmt.Errorf("-log-file, -error-log-file and -access-log-file must be different files, but %s is used twice", file)
+		}
+	}
+
+	switch cfg.accessLog.format {
+	case accessLogCommon, accessLogCombined, accessLogJSON:
+	default:
+		return cfg, fmt.Errorf("-access-log-format must be common, combined or json, not %q", cfg.accessLog.format)
+	}
+
+	if cfg.db.maxOpenConns < 0 || cfg.db.maxIdleConns < 0 || cfg.db.connMaxLifetime < 0 || cfg.db.connMaxIdleTime < 0 {
+		return cfg, errors.New("-db-max-open-conns, -db-max-idle-conns, -db-conn-max-lifetime and -db-conn-max-idle-time can't be negative")
+	}
+
+	if cfg.db.maxOpenConns > 0 && cfg.db.maxIdleConns > cfg.db.maxOpenConns {
+		return cfg, errors.New("-db-max-idle-conns can't be more than -db-max-open-conns")
+	}
+
+	if cfg.db.healthInterval <= 0 || cfg.db.healthTimeout <= 0 {
+		return cfg, errors.New("-db-health-check-interval and -db-health-check-timeout must be positive")
+	}
+
+	if cfg.db.slowQuery < 0 {
+		return cfg, errors.New("-db-slow-query-threshold can't be negative")
+	}
+
+	if cfg.db.replicaInterval <= 0 {
+		return cfg, errors.New("-db-replica-check-interval must be positive")
+	}
+
+	if cfg.password.minLength < 1 {
+		return cfg, errors.New("-password-min-length must be at least 1")
+	}
+
+	if cfg.password.bcryptCost < bcrypt.MinCost || cfg.password.bcryptCost > bcrypt.MaxCost {
+		return cfg, fmt.Errorf("-password-bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	if cfg.guest.lifetime <= 0 || cfg.guest.interval <= 0 {
+		return cfg, errors.New("-guest-lifetime and -guest-interval must be positive")
+	}
+
+	if cfg.guest.warning < 0 || cfg.guest.warning >= cfg.guest.lifetime {
+		return cfg, errors.New("-guest-warning must be shorter than -guest-lifetime")
+	}
+
+	if cfg.password.hasher != "bcrypt" && cfg.password.hasher != "argon2id" {
+		return cfg, fmt.Errorf("-password-hasher must be bcrypt or argon2id, not %q", cfg.password.hasher)
+	}
+
+	// Argon2id needs at least 8 KiB of memory for each thread, and the thread count is stored in a byte.
+	if cfg.password.argon2.parallelism < 1 || cfg.password.argon2.parallelism > 255 {
+		return cfg, errors.New("-password-argon2-parallelism must be between 1 and 255")
+	}
+
+	if cfg.password.argon2.memory < 8*cfg.password.argon2.parallelism || cfg.password.argon2.memory > math.MaxUint32 {
+		return cfg, errors.New("-password-argon2-memory must be at least 8 KiB for each thread")
+	}
+
+	if cfg.password.argon2.iterations < 1 || cfg.password.argon2.iterations > math.MaxUint32 {
+		return cfg, errors.New("-password-argon2-iterations must be at least 1")
+	}
+
+	if cfg.password.minEntropy < 0 {
+		return cfg, errors.New("-password-min-entropy can't be negative")
+	}
+
+	if cfg.password.breachTimeout <= 0 {
+		return cfg, errors.New("-password-breach-timeout must be positive")
+	}
+
+	if cfg.reactions.requests < 0 || cfg.reactions.window <= 0 {
+		return cfg, errors.New("-reactions-requests can't be negative, and -reactions-window must be positive")
+	}
+
+	if cfg.quota.maxSnippets < 0 || cfg.quota.perHour < 0 {
+		return cfg, errors.New("-quota-max-snippets and -quota-per-hour can't be negative")
+	}
+
+	if cfg.quota.maxBytes < 1 || cfg.quota.maxBytes > maxContentBytes {
+		return cfg, fmt.Errorf("-quota-max-bytes must be between 1 and %d", maxContentBytes)
+	}
+
+	if key, err := hex.DecodeString(cfg.antibot.key); err != nil || (cfg.antibot.key != "" && len(key) < 32) {
+		return cfg, errors.New("-antibot-key must be at least 32 bytes, hex-encoded")
+	}
+
+	if cfg.antibot.minDelay < 0 || cfg.antibot.maxAge <= cfg.antibot.minDelay {
+		return cfg, errors.New("-antibot-min-delay can't be negative, and -antibot-max-age must be longer")
+	}
+
+	if cfg.captcha.provider != "" {
+		if !captcha.Known(cfg.captcha.provider) {
+			return cfg, fmt.Errorf("-captcha-provider: unknown provider %q", cfg.captcha.provider)
+		}
+		if cfg.captcha.siteKey == "" || cfg.captcha.secret == "" {
+			return cfg, errors.New("-captcha-site-key and -captcha-secret are required with -captcha-provider")
+		}
+		if cfg.captcha.timeout <= 0 {
+			return cfg, errors.New("-captcha-timeout must be positive")
+		}
+	}
+
+	switch cfg.headers.referrerPolicy {
+	case "no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin", "same-origin",
+		"strict-origin", "strict-origin-when-cross-origin", "unsafe-url":
+	default:
+		return cfg, fmt.Errorf("-headers-referrer-policy: unknown policy %q", cfg.headers.referrerPolicy)
+	}
+
+	switch cfg.headers.frameOptions {
+	case "", "deny", "sameorigin":
+	default:
+		return cfg, fmt.Errorf("-headers-frame-options must be deny, sameorigin or empty, not %q", cfg.headers.frameOptions)
+	}
+
+	if cfg.headers.hstsMaxAge < 0 {
+		return cfg, errors.New("-headers-hsts-max-age can't be negative")
+	}
+
+	// Browsers only accept a site onto the HSTS preload list if it sends includeSubDomains and a max-age of at least a year.
+	if cfg.headers.hstsPreload && (cfg.headers.hstsMaxAge < 365*24*time.Hour || !cfg.headers.hstsIncludeSubdomains) {
+		return cfg, errors.New("-headers-hsts-preload needs -headers-hsts-include-subdomains and a -headers-hsts-max-age of at least 8760h")
+	}
+
+	switch cfg.cdn.provider {
+	case "", cdn.ProviderCloudflare, cdn.ProviderFastly:
+	default:
+		return cfg, fmt.Errorf("-cdn-provider must be cloudflare, fastly or empty, not %q", cfg.cdn.provider)
+	}
+
+	if cfg.cdn.provider != "" {
+		u, err := url.Parse(cfg.cdn.baseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+			return cfg, errors.New("-cdn-base-url must be a URL like https://snippets.example.com when -cdn-provider is set")
+		}
+		cfg.cdn.baseURL = strings.TrimSuffix(cfg.cdn.baseURL, "/")
+	}
+
+	if cfg.alerts.failedLogins < 0 || cfg.alerts.serverErrors < 0 {
+		return cfg, errors.New("-alerts-failed-logins and -alerts-server-errors can't be negative")
+	}
+
+	if cfg.alerts.window <= 0 {
+		return cfg, errors.New("-alerts-window must be positive")
+	}
+
+	if cfg.slo.availability <= 0 || cfg.slo.availability >= 1 || cfg.slo.latency <= 0 || cfg.slo.latency >= 1 {
+		return cfg, errors.New("-slo-availability and -slo-latency must be between 0 and 1, like 0.999")
+	}
+
+	if cfg.slo.latencyThreshold <= 0 {
+		return cfg, errors.New("-slo-latency-threshold must be positive")
+	}
+
+	if cfg.collab.saveInterval <= 0 {
+		return cfg, errors.New("-collab-save-interval must be positive")
+	}
+
+	if cfg.queryCache.size < 1 || cfg.queryCache.timeout <= 0 {
+		return cfg, errors.New("-query-cache-size and -query-cache-redis-timeout must be positive")
+	}
+
+	if cfg.trash.retention <= 0 || cfg.trash.interval <= 0 {
+		return cfg, errors.New("-trash-retention and -trash-interval must be positive")
+	}
+
+	if cfg.oidc.issuer != "" {
+		u, err := url.Parse(cfg.oidc.issuer)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return cfg, errors.New("-oidc-issuer must be an absolute URL")
+		}
+		if cfg.oidc.clientID == "" {
+			return cfg, errors.New("-oidc-client-id is required with -oidc-issuer")
+		}
+		if cfg.oidc.timeout <= 0 {
+			return cfg, errors.New("-oidc-timeout must be positive")
+		}
+	}
+
+	if cfg.jwt.ttl <= 0 || cfg.jwt.refreshTTL <= cfg.jwt.ttl {
+		return cfg, errors.New("-jwt-ttl must be positive, and -jwt-refresh-ttl must be longer")
+	}
+
+	// Take the snapshot last, so that it shows any values which were tidied up above (like the CDN base URL).
+	fs.VisitAll(func(f *flag.Flag) {
+		source, ok := sources[f.Name]
+		if !ok {
+			source = "default"
+		}
+
+		cfg.snapshot = append(cfg.snapshot, configSetting{
+			Name:   f.Name,
+			Value:  redactSetting(f.Name, f.Value.String()),
+			Source: source,
+		})
+	})
+
+	return cfg, nil
+}
+
+// redactSetting hides the value of a secret setting. The DSN keeps everything but its password, because the rest of it
+// (like the database host) is often what's needed when something goes wrong.
+func redactSetting(name, value string) string {
+	if value == "" {
+		return value
+	}
+
+	if name == "dsn" {
+		dsn, err := mysql.ParseDSN(value)
+		if err != nil {
+			return "[redacted]"
+		}
+		if dsn.Passwd != "" {
+			dsn.Passwd = "redacted"
+		}
+		return dsn.FormatDSN()
+	}
+
+	if secretSettings[name] {
+		return "[redacted]"
+	}
+
+	return value
+}
+
+// contentSecurityPolicy builds the Content-Security-Policy header from the configured directives, adding the nonce to script-src.
+// If there's a CAPTCHA, its service's origins are added to the directives that its script, frames and styles need.
+func (cfg config) contentSecurityPolicy(nonce string) string {
+	captchaSources := strings.Join(captcha.Sources(cfg.captcha.provider), " ")
+
+	// An empty directive falls back to default-src, so that has to be kept when the CAPTCHA's origins are added to it.
+	withCaptcha := func(value string) string {
+		if captchaSources == "" {
+			return value
+		}
+		if value == "" {
+			value = cfg.headers.cspDefaultSrc
+		}
+		return strings.TrimSpace(value + " " + captchaSources)
+	}
+
+	directives := []struct {
+		name  string
+		value string
+	}{
+		{"default-src", cfg.headers.cspDefaultSrc},
+		{"script-src", strings.TrimSpace(withCaptcha(cfg.headers.cspScriptSrc) + " 'nonce-" + nonce + "'")},
+		{"style-src", withCaptcha(cfg.headers.cspStyleSrc)},
+		{"font-src", cfg.headers.cspFontSrc},
+		{"img-src", cfg.headers.cspImgSrc},
+		{"connect-src", withCaptcha(cfg.headers.cspConnectSrc)},
+		{"frame-src", withCaptcha("")},
+	}
+
+	var policy []string
+	for _, d := range directives {
+		if d.value != "" {
+			policy = append(policy, d.name+" "+d.value)
+		}
+	}
+
+	return strings.Join(policy, "; ")
+}
+
+// strictTransportSecurity builds the Strict-Transport-Security header, or returns the empty string if HSTS is turned off.
+func (cfg config) strictTransportSecurity() string {
+	if cfg.headers.hstsMaxAge <= 0 {
+		return ""
+	}
+
+	hsts := fmt.Sprintf("max-age=%d", int64(cfg.headers.hstsMaxAge.Seconds()))
+	if cfg.headers.hstsIncludeSubdomains {
+		hsts += "; includeSubDomains"
+	}
+	if cfg.headers.hstsPreload {
+		hsts += "; preload"
+	}
+
+	return hsts
+}
+
+// passwordPolicy builds the password policy from the configuration, loading the extra deny list file if there is one.
+// passwordHashes returns the set of hashers for the users' passwords. New hashes use the configured algorithm, and hashes
+// made with the other one are still accepted, then upgraded when the user logs in.
+func (cfg config) passwordHashes() *hash.Set {
+	var current hash.Hasher = hash.Bcrypt{Cost: cfg.password.bcryptCost}
+	if cfg.password.hasher == "argon2id" {
+		current = hash.Argon2id{
+			Memory:      uint32(cfg.password.argon2.memory),
+			Iterations:  uint32(cfg.password.argon2.iterations),
+			Parallelism: uint8(cfg.password.argon2.parallelism),
+		}
+	}
+
+	return hash.NewSet(current)
+}
+
+// siteDefaults returns the site settings to use for the ones that admins haven't changed, and while the database is
+// down. Some of them come from the configuration.
+func (cfg config) siteDefaults() models.SiteSettings {
+	s := models.DefaultSiteSettings
+	s.Maintenance = cfg.maintenance.enabled
+	s.BlockDisposableEmails = cfg.disposable.block
+	s.FailedLoginAlertThreshold = cfg.alerts.failedLogins
+	s.ServerErrorAlertThreshold = cfg.alerts.serverErrors
+	return s
+}
+
+func (cfg config) passwordPolicy() (password.Policy, error) {
+	policy := password.NewPolicy(cfg.password.minLength)
+	policy.RequireUpper = cfg.password.requireUpper
+	policy.RequireLower = cfg.password.requireLower
+	policy.RequireDigit = cfg.password.requireDigit
+	policy.RequireSymbol = cfg.password.requireSymbol
+	policy.MinEntropy = cfg.password.minEntropy
+	policy.BreachCheck = cfg.password.breachCheck
+
+	if cfg.password.denyList != "" {
+		f, err := os.Open(cfg.password.denyList)
+		if err != nil {
+			return policy, err
+		}
+		defer f.Close()
+
+		err = policy.LoadDenyList(f)
+		if err != nil {
+			return policy, fmt.Errorf("password deny list %s: %w", cfg.password.denyList, err)
+		}
+	}
+
+	return policy, nil
+}
+
+// envName returns the name of the environment variable for a flag, like SNIPPETBOX_SMTP_HOST for smtp-host.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func lookupEnv(getenv func(string) string, flagName string) (string, bool) {
+	value := getenv(envName(flagName))
+	return value, value != ""
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// parseConfig reads the simple subset of TOML which we need for configuration: comments, [section] headers
+// and key = value pairs, where values are quoted strings, numbers or booleans. A key inside a section is
+// mapped to the flag with the section name as a prefix, so "host" in the [smtp] section sets -smtp-host.
+func parseConfig(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid section header", lineNumber)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNumber)
+		}
+
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		if section != "" {
+			key = strings.ReplaceAll(section, "_", "-") + "-" + key
+		}
+
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid string value", lineNumber)
+			}
+			value = unquoted
+		}
+
+		if _, exists := values[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate setting %q", lineNumber, key)
+		}
+		values[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// stripComment removes a trailing # comment from a line, ignoring any # characters inside a quoted string.
+func stripComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// openLogFile opens a log file with the configured rotation. Errors from rotating it go straight to stderr, as the error
+// log might be the file itself.
+func (cfg config) openLogFile(path string) (*logfile.File, error) {
+	return logfile.Open(path, logfile.Options{
+		MaxSize:    int64(cfg.log.maxSize) << 20,
+		Interval:   cfg.log.rotateInterval,
+		MaxBackups: cfg.log.maxBackups,
+		Compress:   cfg.log.compress,
+		OnError: func(err error) {
+			fmt.Fprintf(os.Stderr, "ERROR\trotating %s: %s\n", path, err)
+		},
+	})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	// Write a config file to a temporary directory, which is automatically removed when the test finishes.
+	path := filepath.Join(t.TempDir(), "snippetbox.toml")
+	contents := `
+# Top-level settings use the flag names.
+addr = ":5000"
+dsn = "file:pass@/snippetbox" # Trailing comments are ignored
+read_timeout = "7s"
+
+[smtp]
+host = "smtp.example.com"
+port = 587
+sender = "Snippetbox #1 <no-reply@example.com>"
+`
+	err := os.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"SNIPPETBOX_CONFIG":    path,
+		"SNIPPETBOX_DSN":       "env:pass@/snippetbox",
+		"SNIPPETBOX_SMTP_PORT": "2525",
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+
+	cfg, err := loadConfig("web", []string{"-smtp-port", "465"}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The config file only applies when neither a flag nor an environment variable is set.
+	asserts.Equal(t, cfg.addr, ":5000")
+	asserts.Equal(t, cfg.timeouts.read, 7*time.Second)
+	asserts.Equal(t, cfg.smtp.host, "smtp.example.com")
+	asserts.Equal(t, cfg.smtp.sender, "Snippetbox #1 <no-reply@example.com>")
+
+	// Environment variables override the config file...
+	asserts.Equal(t, cfg.dsn, "env:pass@/snippetbox")
+
+	// ...and flags override everything.
+	asserts.Equal(t, cfg.smtp.port, 465)
+
+	// Settings that aren't set anywhere keep their defaults.
+	asserts.Equal(t, cfg.session.lifetime, 12*time.Hour)
+	asserts.Equal(t, cfg.tls.certFile, "./tls/cert.pem")
+}
+
+func TestLoadConfigExample(t *testing.T) {
+	// The example config file in the repository root should always load, and match the defaults.
+	cfg, err := loadConfig("web", []string{"-config", "../../snippetbox.example.toml"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asserts.Equal(t, cfg.addr, ":4000")
+	asserts.Equal(t, cfg.smtp.host, "localhost")
+	asserts.Equal(t, cfg.headers.cspDefaultSrc, "'self'")
+	asserts.Equal(t, cfg.headers.frameOptions, "deny")
+}
+
+func TestLoadConfigAutocertHosts(t *testing.T) {
+	cfg, err := loadConfig("web", []string{"-autocert", "-autocert-hosts", "snippetbox.example, www.snippetbox.example,"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asserts.Equal(t, len(cfg.autocert.hosts), 2)
+	asserts.Equal(t, cfg.autocert.hosts[0], "snippetbox.example")
+	asserts.Equal(t, cfg.autocert.hosts[1], "www.snippetbox.example")
+}
+
+func TestLoadConfigAllowedDomains(t *testing.T) {
+	cfg, err := loadConfig("web", []string{"-email-allowed-domains", "Example.com, @example.org,"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asserts.Equal(t, len(cfg.email.allowedDomains), 2)
+	asserts.Equal(t, cfg.email.allowedDomains[0], "example.com")
+	asserts.Equal(t, cfg.email.allowedDomains[1], "example.org")
+}
+
+func TestLoadConfigReplicas(t *testing.T) {
+	cfg, err := loadConfig("web", []string{"-db-replicas", "web:pass@tcp(replica1)/snippetbox, web:pass@tcp(replica2)/snippetbox"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asserts.Equal(t, len(cfg.db.replicas), 2)
+	asserts.Equal(t, cfg.db.replicas[1], "web:pass@tcp(replica2)/snippetbox")
+
+	// The replicas' passwords mustn't end up on the runbook page.
+	for _, setting := range cfg.snapshot {
+		if setting.Name == "db-replicas" && strings.Contains(setting.Value, "pass") {
+			t.Errorf("got %q in the config snapshot", setting.Value)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{
+			name:     "Unknown setting",
+			contents: `adress = ":4000"`,
+		},
+		{
+			name:     "Invalid value",
+			contents: `smtp-port = "twenty-five"`,
+		},
+		{
+			name:     "Missing equals",
+			contents: `addr ":4000"`,
+		},
+		{
+			name:     "Duplicate setting",
+			contents: "addr = \":4000\"\naddr = \":5000\"",
+		},
+		{
+			name:     "Autocert without hosts",
+			contents: `autocert = true`,
+		},
+		{
+			name:     "Invalid trusted proxy",
+			contents: "[proxy]\ntrusted = \"10.0.0.0/33\"",
+		},
+		{
+			name:     "Invalid allowed email domain",
+			contents: "[email]\nallowed_domains = \"alice@example.com\"",
+		},
+		{
+			name:     "Guest warning longer than lifetime",
+			contents: "[guest]\nlifetime = \"24h\"\nwarning = \"48h\"",
+		},
+		{
+			name:     "Negative reactions limit",
+			contents: "[reactions]\nrequests = -1",
+		},
+		{
+			name:     "Quota content limit too large",
+			contents: "[quota]\nmax_bytes = 100000",
+		},
+		{
+			name:     "Short antibot key",
+			contents: "[antibot]\nkey = \"abcdef\"",
+		},
+		{
+			name:     "CAPTCHA without a secret",
+			contents: "[captcha]\nprovider = \"turnstile\"\nsite_key = \"SITEKEY\"",
+		},
+		{
+			name:     "Unknown referrer policy",
+			contents: "[headers]\nreferrer_policy = \"sometimes\"",
+		},
+		{
+			name:     "Negative log size",
+			contents: "[log]\nmax_size = -1",
+		},
+		{
+			name:     "Two logs in one file",
+			contents: "error_log_file = \"/var/log/snippetbox.log\"\n\n[log]\nfile = \"/var/log/snippetbox.log\"",
+		},
+		{
+			name:     "Unknown access log format",
+			contents: "[access_log]\nformat = \"apache\"",
+		},
+		{
+			name:     "Invalid frame options",
+			contents: "[headers]\nframe_options = \"allow\"",
+		},
+		{
+			name:     "HSTS preload without includeSubDomains",
+			contents: "[headers]\nhsts_max_age = \"8760h\"\nhsts_preload = true",
+		},
+		{
+			name:     "Unknown CDN provider",
+			contents: "[cdn]\nprovider = \"akamai\"\nbase_url = \"https://snippets.example.com\"",
+		},
+		{
+			name:     "CDN without a base URL",
+			contents: "[cdn]\nprovider = \"fastly\"\ntoken = \"secret\"",
+		},
+		{
+			name:     "Unknown password hasher",
+			contents: "[password]\nhasher = \"md5\"",
+		},
+		{
+			name:     "Too little Argon2id memory",
+			contents: "[password]\nhasher = \"argon2id\"\nargon2_memory = 4",
+		},
+		{
+			name:     "Negative alert threshold",
+			contents: "[alerts]\nfailed_logins = -1",
+		},
+		{
+			name:     "SLO of 100%",
+			contents: "[slo]\navailability = 1",
+		},
+		{
+			name:     "Shared drafts never saved",
+			contents: "[collab]\nsave_interval = \"0s\"",
+		},
+		{
+			name:     "Trash never emptied",
+			contents: "[trash]\ninterval = \"0s\"",
+		},
+		{
+			name:     "Negative connection limit",
+			contents: "[db]\nmax_open_conns = -1",
+		},
+		{
+			name:     "More idle than open connections",
+			contents: "[db]\nmax_open_conns = 5\nmax_idle_conns = 10",
+		},
+		{
+			name:     "Invalid replica",
+			contents: "[db]\nreplicas = \"replica.example.com\"",
+		},
+		{
+			name:     "Zero health check interval",
+			contents: "[db]\nhealth_check_interval = \"0s\"",
+		},
+		{
+			name:     "Negative slow query threshold",
+			contents: "[db]\nslow_query_threshold = \"-1s\"",
+		},
+		{
+			name:     "Empty cache",
+			contents: "[query_cache]\nsize = 0",
+		},
+		{
+			name:     "OIDC without a client ID",
+			contents: "[oidc]\nissuer = \"https://sso.example.com\"",
+		},
+		{
+			name:     "Short JWT key",
+			contents: "[jwt]\nkeys = \"2024=abcdef\"",
+		},
+		{
+			name:     "Refresh tokens shorter than access tokens",
+			contents: "[jwt]\nttl = \"1h\"\nrefresh_ttl = \"30m\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snippetbox.toml")
+			err := os.WriteFile(path, []byte(tt.contents), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = loadConfig("web", []string{"-config", path}, func(string) string { return "" })
+			if err == nil {
+				t.Error("got: nil; want: error")
+			}
+		})
+	}
+}
+
+func TestRedactSetting(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "dsn", value: "web:pass@/snippetbox?parseTime=true", want: "web:redacted@tcp(127.0.0.1:3306)/snippetbox?parseTime=true"},
+		{name: "dsn", value: "web@tcp(db:3306)/snippetbox", want: "web@tcp(db:3306)/snippetbox"},
+		{name: "cdn-token", value: "secret", want: "[redacted]"},
+		{name: "sentry-dsn", value: "https://key@o0.ingest.sentry.io/1", want: "[redacted]"},
+		{name: "smtp-password", value: "", want: ""},
+		{name: "smtp-host", value: "localhost", want: "localhost"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asserts.Equal(t, redactSetting(tt.name, tt.value), tt.want)
+		})
+	}
+}
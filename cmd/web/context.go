@@ -3,3 +3,18 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// The ID of the authenticated user, set by whichever middleware authenticated the request (session or API token).
+const authenticatedUserIDContextKey = contextKey("authenticatedUserID")
+
+// The authenticated user's record, set by the session-based authenticate middleware.
+const authenticatedUserContextKey = contextKey("authenticatedUser")
+
+// The scheme ("http" or "https") reported by a trusted proxy in the X-Forwarded-Proto header.
+const forwardedSchemeContextKey = contextKey("forwardedScheme")
+
+// The ID of the request, set by the setRequestID middleware.
+const requestIDContextKey = contextKey("requestID")
+
+// The per-request Content-Security-Policy nonce, set by the secureHeaders middleware.
+const cspNonceContextKey = contextKey("cspNonce")
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The dbHealth type remembers whether the database answered the last health check, and since when. Its zero value
+// counts as up, so that the application isn't degraded before the first check (or in tests, which have no database),
+// and it is safe for concurrent use.
+type dbHealth struct {
+	down atomic.Bool
+
+	mu      sync.Mutex
+	since   time.Time
+	lastErr string
+}
+
+// The dbStatus type is a snapshot of dbHealth, for the health endpoint.
+type dbStatus struct {
+	Up    bool      `json:"up"`
+	Since time.Time `json:"since"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Down reports whether the database failed its last health check.
+func (h *dbHealth) Down() bool {
+	return h.down.Load()
+}
+
+// record stores the result of a health check, and reports whether the database has gone down or come back up.
+func (h *dbHealth) record(err error) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	changed := h.down.Load() != (err != nil)
+	if changed || h.since.IsZero() {
+		h.since = time.Now()
+	}
+
+	h.lastErr = ""
+	if err != nil {
+		h.lastErr = err.Error()
+	}
+
+	h.down.Store(err != nil)
+	return changed
+}
+
+func (h *dbHealth) Status() dbStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return dbStatus{Up: !h.down.Load(), Since: h.since, Error: h.lastErr}
+}
+
+// monitorDatabase pings the database every -db-health-check-interval for as long as the application runs, and logs when
+// it goes down or comes back. It's started by main() with app.background().
+func (app *application) monitorDatabase(ping func(ctx context.Context) error) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.db.healthTimeout)
+		err := ping(ctx)
+		cancel()
+
+		if app.dbHealth.record(err) {
+			if err != nil {
+				app.errorLog.Printf("database is down, serving 503s until it's back: %s", err)
+			} else {
+				app.infoLog.Printf("database is back up")
+			}
+		}
+
+		time.Sleep(app.config.db.healthInterval)
+	}
+}
+
+// The requireDatabase middleware answers straight away with a 503 page while the database is down, rather than letting
+// every request wait for its queries (and the session lookup) to time out. It comes before the session middleware, so
+// the page is rendered as if the visitor were logged out.
+func (app *application) requireDatabase(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.dbHealth.Down() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Retry-After", strconv.Itoa(int(app.config.db.healthInterval.Seconds()+1)))
+
+		data := app.newErrorTemplateData(r)
+		data.RequestID = requestID(r)
+		app.renderError(w, http.StatusServiceUnavailable, "503.gohtml", data, http.StatusText(http.StatusServiceUnavailable))
+	})
+}
+
+// The requireDatabaseAPI middleware is requireDatabase for the JSON API.
+func (app *application) requireDatabaseAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.dbHealth.Down() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(app.config.db.healthInterval.Seconds()+1)))
+		app.apiClientError(w, r, http.StatusServiceUnavailable, "the service is temporarily unavailable")
+	})
+}
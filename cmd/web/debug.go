@@ -0,0 +1,43 @@
+package main
+
+import (
+	"expvar"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/http/pprof"
+)
+
+// The debugPprof handler serves the profiles from net/http/pprof under /debug/pprof/. Most of them are served by
+// pprof.Index, which works out which profile was asked for from the path. CPU profiles and traces run for the number of
+// seconds in the query string, which has to be less than -write-timeout.
+func debugPprof(w http.ResponseWriter, r *http.Request) {
+	switch httprouter.ParamsFromContext(r.Context()).ByName("item") {
+	case "/cmdline":
+		pprof.Cmdline(w, r)
+	case "/profile":
+		pprof.Profile(w, r)
+	case "/symbol":
+		pprof.Symbol(w, r)
+	case "/trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Index(w, r)
+	}
+}
+
+// publishExpvars adds the application's own variables to the ones that expvar serves on /debug/vars, next to the
+// command line and memory stats that it always has. expvar.Publish panics if a name is used twice, so this is only
+// called once, from main().
+func (app *application) publishExpvars() {
+	expvar.Publish("jobs", expvar.Func(func() any {
+		return app.jobs.Status()
+	}))
+	expvar.Publish("database", expvar.Func(func() any {
+		return app.dbHealth.Status()
+	}))
+	if app.dbStats != nil {
+		expvar.Publish("db_pool", expvar.Func(func() any {
+			return app.dbStats()
+		}))
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/interchange"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// How long the download link for a data export works for.
+const dataExportTTL = 7 * 24 * time.Hour
+
+// The least time between two export requests from the same session. Building an export reads everything we hold about
+// the user, so it shouldn't be possible to start dozens of them by clicking the button repeatedly.
+const dataExportInterval = time.Hour
+
+// The exportAccount type is written to account.json in a data export. It holds everything about the user apart from their
+// snippets, which go in snippets.jsonl in the interchange format, so that they can be imported elsewhere.
+// Secrets (the password hash, two-factor secret and API tokens, including those for remotes) are left out.
+type exportAccount struct {
+	Exported time.Time       `json:"exported"`
+	Profile  exportProfile   `json:"profile"`
+	Sessions []exportSession `json:"sessions"`
+	Remotes  []exportRemote  `json:"remotes"`
+}
+
+type exportProfile struct {
+	ID               int       `json:"id"`
+	Name             string    `json:"name"`
+	Username         string    `json:"username,omitempty"`
+	Email            string    `json:"email"`
+	Created          time.Time `json:"created"`
+	Timezone         string    `json:"timezone"`
+	Locale           string    `json:"locale"`
+	Status           string    `json:"status"`
+	Admin            bool      `json:"admin"`
+	TwoFactorEnabled bool      `json:"twoFactorEnabled"`
+}
+
+type exportSession struct {
+	UserAgent string    `json:"userAgent"`
+	IP        string    `json:"ip"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+type exportRemote struct {
+	Name    string    `json:"name"`
+	BaseURL string    `json:"baseURL"`
+	Created time.Time `json:"created"`
+}
+
+// buildDataExport assembles everything held about the user into a ZIP archive, containing account.json and snippets.jsonl.
+func (app *application) buildDataExport(userID int) ([]byte, error) {
+	user, err := app.users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := app.twoFactor.Secret(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	account := exportAccount{
+		Exported: time.Now().UTC(),
+		Profile: exportProfile{
+			ID:               user.ID,
+			Name:             user.Name,
+			Username:         user.Username,
+			Email:            user.Email,
+			Created:          user.Created,
+			Timezone:         user.Timezone,
+			Locale:           user.Locale,
+			Status:           user.Status,
+			Admin:            user.IsAdmin,
+			TwoFactorEnabled: secret != "",
+		},
+		Sessions: []exportSession{},
+		Remotes:  []exportRemote{},
+	}
+
+	// The session tokens themselves would let anybody with the archive log in as the user, so only the details are included.
+	sessions, err := app.userSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		account.Sessions = append(account.Sessions, exportSession{UserAgent: s.UserAgent, IP: s.IP, Created: s.Created, LastSeen: s.LastSeen})
+	}
+
+	remotes, err := app.remotes.AllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rm := range remotes {
+		account.Remotes = append(account.Remotes, exportRemote{Name: rm.Name, BaseURL: rm.BaseURL, Created: rm.Created})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	f, err := zw.Create("account.json")
+	if err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(account)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err = zw.Create("snippets.jsonl")
+	if err != nil {
+		return nil, err
+	}
+
+	iw := interchange.NewWriter(f)
+	err = app.snippets.Export(userID, func(s *models.Snippet, _ string) error {
+		return iw.Write(interchange.FromModel(s, ""))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// accountExportPost starts building an export of the user's data. It can take a while for users with a lot of snippets,
+// so it's done by a background job, which emails the user a download link when it's ready.
+func (app *application) accountExportPost(w http.ResponseWriter, r *http.Request) {
+	requested := app.sessionManager.GetInt64(r.Context(), "exportRequested")
+	if time.Since(time.Unix(requested, 0)) < dataExportInterval {
+		app.sessionManager.Put(r.Context(), "flash", "Your data export is already on its way. Please check your email")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+
+	user := authenticatedUser(r)
+	downloadURL := fmt.Sprintf("%s://%s/account/export/download", requestScheme(r), r.Host)
+	id := requestID(r)
+
+	app.background(func() {
+		archive, err := app.buildDataExport(user.ID)
+		if err != nil {
+			app.errorLog.Printf("[%s] building data export for user %d: %s", id, user.ID, err)
+			return
+		}
+
+		token, err := app.exports.Insert(user.ID, archive, dataExportTTL)
+		if err != nil {
+			app.errorLog.Printf("[%s] storing data export for user %d: %s", id, user.ID, err)
+			return
+		}
+
+		emailData := map[string]string{
+			"Name":        user.Name,
+			"DownloadURL": downloadURL + "?token=" + url.QueryEscape(token),
+		}
+
+		err = app.mailer.Send(user.Email, "data_export.gohtml", emailData)
+		if err != nil {
+			app.errorLog.Printf("[%s] %s", id, err)
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "exportRequested", time.Now().Unix())
+	app.sessionManager.Put(r.Context(), "flash", "We're preparing a copy of your data. We'll email you a link to download it when it's ready")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// accountExportDownload sends a finished data export. The user has to be logged in as well as having the link from the email.
+func (app *application) accountExportDownload(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		app.notFound(w, r)
+		return
+	}
+
+	export, err := app.exports.Get(app.authenticatedUserID(r), token)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("snippetbox-export-%s.zip", export.Created.Format("2006-01-02"))
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Write(export.Archive)
+}
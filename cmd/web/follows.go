@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+// The number of snippets shown on each page of the activity feed.
+const feedPageSize = 10
+
+// The followData type holds the follower counts shown on a profile page. Following says whether the user viewing the
+// page follows the profile's owner, and CanFollow whether they're able to (they aren't on their own profile, or when
+// they aren't logged in).
+type followData struct {
+	Followers   int
+	Following   int
+	IsFollowing bool
+	CanFollow   bool
+}
+
+// profileFollowData loads the follower counts for a user's profile page, as seen by the user making the request.
+func (app *application) profileFollowData(r *http.Request, user *models.User) (followData, error) {
+	var data followData
+	var err error
+
+	data.Followers, data.Following, err = app.follows.Counts(user.ID)
+	if err != nil {
+		return data, err
+	}
+
+	viewerID := app.authenticatedUserID(r)
+	if viewerID == 0 || viewerID == user.ID {
+		return data, nil
+	}
+
+	data.CanFollow = true
+	data.IsFollowing, err = app.follows.IsFollowing(viewerID, user.ID)
+	return data, err
+}
+
+// changeFollow follows or unfollows the user named in the URL, and sends the user back to their profile.
+func (app *application) changeFollow(w http.ResponseWriter, r *http.Request, follow bool) {
+	user, err := app.users.GetByUsername(httprouter.ParamsFromContext(r.Context()).ByName("username"))
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	followerID := app.authenticatedUserID(r)
+	if user.ID == followerID {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if follow {
+		err = app.follows.Follow(followerID, user.ID)
+	} else {
+		err = app.follows.Unfollow(followerID, user.ID)
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/users/"+user.Username, http.StatusSeeOther)
+}
+
+func (app *application) userFollowPost(w http.ResponseWriter, r *http.Request) {
+	app.changeFollow(w, r, true)
+}
+
+func (app *application) userUnfollowPost(w http.ResponseWriter, r *http.Request) {
+	app.changeFollow(w, r, false)
+}
+
+// feed shows the latest public snippets from the users that the user follows.
+func (app *application) feed(w http.ResponseWriter, r *http.Request) {
+	page, ok := pageParam(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	// Fetch one more snippet than we show, so we know whether there's a next page without a separate COUNT query.
+	entries, err := app.follows.Feed(app.authenticatedUserID(r), feedPageSize+1, (page-1)*feedPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Pagination = pagination{Page: page, HasNext: len(entries) > feedPageSize}
+
+	if len(entries) > feedPageSize {
+		entries = entries[:feedPageSize]
+	}
+	data.Feed = entries
+
+	app.render(w, r, http.StatusOK, "feed.gohtml", data)
+}
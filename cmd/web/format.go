@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/federation"
+	"github.com/0xshiku/snippetbox/internal/format"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/webhooks"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"time"
+)
+
+// The formatData type holds a snippet's content after formatting, for the format preview page. Formatter is the name of
+// the formatter that was used, like "JSON". Changed is false if the snippet was already formatted, and CanSave is true if
+// the viewer owns the snippet and there's something to save.
+// The view page only uses Formatter, to offer a link to the preview.
+type formatData struct {
+	Formatter string
+	Content   string
+	Changed   bool
+	CanSave   bool
+	Error     string
+}
+
+// snippetForFormat looks up the snippet named in the URL. It sends a 404 response and returns nil if there's no such snippet.
+func (app *application) snippetForFormat(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	publicID := params.ByName("id")
+	if publicID == "" || len(publicID) > maxPublicIDLength {
+		app.notFound(w, r)
+		return nil
+	}
+
+	snippet, err := app.snippets.GetByPublicID(publicID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return nil
+	}
+
+	return snippet
+}
+
+// snippetFormat previews a structured snippet (JSON, XML or SQL) in its canonical pretty form. Anybody who can see the
+// snippet can preview it, but only its owner can save the result. Snippets that no formatter recognizes give a 404, and
+// ones that can't be parsed show the formatter's error with a 422 status.
+func (app *application) snippetFormat(w http.ResponseWriter, r *http.Request) {
+	snippet := app.snippetForFormat(w, r)
+	if snippet == nil {
+		return
+	}
+
+	formatted, formatter, err := app.formatters.Format(snippet.Content)
+	if errors.Is(err, format.ErrNoFormatter) {
+		app.notFound(w, r)
+		return
+	}
+
+	// Keep unlisted snippets out of search engines here too, and point them at the snippet itself.
+	app.setPageMeta(w, r, pageMeta{
+		canonicalPath: "/snippet/view/" + snippet.PublicID,
+		noIndex:       true,
+	})
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Format = formatData{Formatter: formatter}
+
+	if err != nil {
+		data.Format.Error = err.Error()
+		app.render(w, r, http.StatusUnprocessableEntity, "format.gohtml", data)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	data.Format.Content = formatted
+	data.Format.Changed = formatted != snippet.Content
+	data.Format.CanSave = data.Format.Changed && userID != 0 && userID == snippet.UserID
+
+	app.render(w, r, http.StatusOK, "format.gohtml", data)
+}
+
+// snippetFormatPost saves the formatted content as a new snippet, with the same title and visibility, which lasts for at
+// least as long as the original. Snippets can't be edited, so the original is left as it is.
+// Only the owner of the snippet can do this. For anyone else, act as if the snippet doesn't exist.
+func (app *application) snippetFormatPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.snippetForFormat(w, r)
+	if snippet == nil {
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	if snippet.UserID != userID {
+		app.notFound(w, r)
+		return
+	}
+
+	formatted, _, err := app.formatters.Format(snippet.Content)
+	if err != nil {
+		// The preview page only offers to save snippets which can be formatted, so this is a hand-crafted request.
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The copy counts towards the user's quota like any other new snippet.
+	quota, err := app.snippetQuota(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	_, message := quota.checkCount()
+	if quota.checkContent(formatted) != "" {
+		message = fmt.Sprintf("The formatted copy would be more than %d bytes long, so it can't be saved", quota.maxBytes)
+	}
+	if message != "" {
+		app.sessionManager.Put(r.Context(), "flash", message)
+		http.Redirect(w, r, "/snippet/view/"+snippet.PublicID, http.StatusSeeOther)
+		return
+	}
+
+	publicID, err := app.snippets.Insert(userID, snippet.Title, formatted, federation.ExpiryDays(snippet.Expires, time.Now()), snippet.Visibility)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.snippetEvent(r, webhooks.EventSnippetCreated, userID, publicID)
+	app.snippetsCreated(snippet.Visibility)
+
+	app.sessionManager.Put(r.Context(), "flash", "Formatted copy saved as a new snippet")
+
+	http.Redirect(w, r, "/snippet/view/"+publicID, http.StatusSeeOther)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"net/http"
+	"time"
+)
+
+// guestLifetime returns how long new guest accounts last, or 0 if they're turned off.
+func (app *application) guestLifetime() time.Duration {
+	if !app.config.guest.enabled {
+		return 0
+	}
+	return app.config.guest.lifetime
+}
+
+// The guestExpiryData type is passed to the guest expiry warning email template.
+type guestExpiryData struct {
+	Name         string
+	Expires      time.Time
+	KeepSnippets bool
+}
+
+// expireGuests emails a warning to guests whose accounts are about to expire, and deletes the accounts which have.
+// It's run every -guest-interval by a background job. Errors are logged, and the guests involved are tried again next time.
+func (app *application) expireGuests() {
+	if app.config.guest.warning > 0 {
+		guests, err := app.users.ExpiringGuests(time.Now().Add(app.config.guest.warning))
+		if err != nil {
+			app.errorLog.Printf("finding expiring guests: %s", err)
+		}
+
+		for _, guest := range guests {
+			data := guestExpiryData{Name: guest.Name, Expires: guest.Expires, KeepSnippets: app.config.guest.keepSnippets}
+
+			err = app.mailer.Send(guest.Email, "guest_expiry.gohtml", data)
+			if err != nil {
+				app.errorLog.Printf("warning guest user %d: %s", guest.ID, err)
+				continue
+			}
+
+			err = app.users.MarkExpiryWarned(guest.ID)
+			if err != nil {
+				app.errorLog.Printf("warning guest user %d: %s", guest.ID, err)
+			}
+		}
+	}
+
+	guests, err := app.users.ExpiredGuests()
+	if err != nil {
+		app.errorLog.Printf("finding expired guests: %s", err)
+		return
+	}
+
+	for _, guest := range guests {
+		err = app.deleteGuest(guest)
+		if err != nil {
+			app.errorLog.Printf("deleting guest user %d: %s", guest.ID, err)
+		}
+	}
+}
+
+// deleteGuest deletes an expired guest account. If -guest-keep-snippets is on, the guest's snippets are made anonymous
+// first, so that they stay up. Both happen in one transaction, so the guest can't be left without their snippets but
+// not deleted. With -guest-dry-run, nothing is changed, and what would have been is logged instead.
+func (app *application) deleteGuest(guest *models.User) error {
+	dryRun := app.config.guest.dryRun
+	var plan *models.Plan
+
+	err := app.tx.WithTx(context.Background(), func(q *models.Queries) error {
+		// Start afresh each time, as the transaction is tried again after a deadlock.
+		plan = &models.Plan{DryRun: dryRun}
+
+		if app.config.guest.keepSnippets {
+			disowned, err := q.Snippets.Disown(guest.ID, dryRun)
+			if err != nil {
+				return err
+			}
+			plan.Merge(disowned)
+		}
+
+		deleted, err := q.Users.Delete(guest.ID, dryRun)
+		if err != nil {
+			return err
+		}
+
+		// In a dry run the snippets are still the guest's, so the deletion counts them, but they would have been disowned first.
+		if dryRun && app.config.guest.keepSnippets {
+			deleted.Remove(models.PlanDelete, "snippets")
+		}
+		plan.Merge(deleted)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		app.infoLog.Printf("dry run: would delete expired guest user %d (%s): %s", guest.ID, guest.Username, plan)
+		return nil
+	}
+
+	app.infoLog.Printf("deleted expired guest user %d (%s): %d snippets deleted, %d kept", guest.ID, guest.Username,
+		plan.Rows(models.PlanDelete, "snippets"), plan.Rows(models.PlanUpdate, "snippets"))
+
+	// As when an admin deletes a user, drop any cached copies of the pages which showed the guest's snippets. Kept snippets
+	// now show no owner, so their pages have changed too.
+	ids := append(plan.IDs(models.PlanDelete, "snippets"), plan.IDs(models.PlanUpdate, "snippets")...)
+	app.purgeCache(append(snippetPaths(ids...), "/", "/users/"+guest.Username)...)
+
+	return nil
+}
+
+// accountKeepPost turns the user's guest account into an ordinary one, so that it isn't deleted.
+func (app *application) accountKeepPost(w http.ResponseWriter, r *http.Request) {
+	err := app.users.MakePermanent(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your account is yours to keep. It won't be deleted")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
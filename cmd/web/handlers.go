@@ -3,11 +3,15 @@ package main
 import (
 	"errors"
 	"fmt"
+	"github.com/0xshiku/snippetbox/internal/lint"
 	"github.com/0xshiku/snippetbox/internal/models"
 	"github.com/0xshiku/snippetbox/internal/validators"
+	"github.com/0xshiku/snippetbox/internal/webhooks"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
-	"strconv"
+	"net/url"
+	"strings"
+	"time"
 )
 
 // Defines a snippetCreateForm struct to represent the form data and validation errors for the form fields.
@@ -17,20 +21,50 @@ import (
 // So, for example, here we're telling the decoder to store the value from the HTML form input with the name "title" in the Title field.
 // The struct tag `form:"-"` tells the decoder to completely ignore a field during decoding
 type snippetCreateForm struct {
-	Title     string               `form:"title"`
-	Content   string               `form:"content"`
-	Expires   int                  `form:"expires"`
-	Validator validators.Validator `form:"-"`
+	Title                string          `form:"title"`
+	Content              string          `form:"content"`
+	Expires              int             `form:"expires"`
+	Visibility           string          `form:"visibility"`
+	AllowDuplicate       bool            `form:"allowDuplicate"`
+	Warnings             []lint.Warning  `form:"-"`
+	Duplicate            *models.Snippet `form:"-"`
+	validators.Validator `form:"-"`
+}
+
+// Validate checks the new snippet. Because the Validator type is embedded by the snippetCreateForm struct, we can call
+// CheckField() directly on it. CheckField() adds the provided key and error message to the FieldErrors map if the check
+// does not evaluate to true. For example, in the first line here we "check that the form.Title field is not blank".
+// In the second, we "check that the form.Title field has a maximum character length of 100" and so on.
+// It also lints the content. The warnings don't make the form invalid, but they're shown if the form is re-displayed.
+func (form *snippetCreateForm) Validate(app *application) {
+	form.CheckField(validators.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validators.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validators.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validators.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal, 1, 7 or 365")
+	form.CheckField(validators.PermittedValue(form.Visibility, models.VisibilityPublic, models.VisibilityUnlisted), "visibility", "This field must be public or unlisted")
+
+	form.Warnings = app.lintContent(form.Content)
 }
 
 // Create a new userSignupForm struct
 type userSignupForm struct {
 	Name                 string `form:"name"`
+	Username             string `form:"username"`
 	Email                string `form:"email"`
 	Password             string `form:"password"`
+	Guest                bool   `form:"guest"`
 	validators.Validator `form:"-"`
 }
 
+func (form *userSignupForm) Validate(app *application) {
+	form.CheckField(validators.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validators.MaxChars(form.Name, 255), "name", "This field cannot be more than 255 characters long")
+	form.CheckString("username", form.Username, app.usernameRules(0)...)
+	form.CheckString("email", form.Email, app.emailRules(0)...)
+	form.CheckField(validators.NotBlank(form.Password), "password", "This field cannot be blank")
+	app.checkPassword(&form.Validator, "password", form.Password)
+}
+
 // Create a new userLoginForm struct
 type userLoginForm struct {
 	Email                string `form:"email"`
@@ -38,6 +72,14 @@ type userLoginForm struct {
 	validators.Validator `form:"-"`
 }
 
+// Validate checks that both email and password are provided. It also checks the format of the email address as a UX-nicety
+// (in case the user makes a typo).
+func (form *userLoginForm) Validate(_ *application) {
+	form.CheckField(validators.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validators.Matches(form.Email, validators.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validators.NotBlank(form.Password), "password", "This field cannot be blank")
+}
+
 type accountPasswordUpdateForm struct {
 	CurrentPassword         string `form:"currentPassword"`
 	NewPassword             string `form:"newPassword"`
@@ -45,54 +87,259 @@ type accountPasswordUpdateForm struct {
 	validators.Validator    `form:"-"`
 }
 
+func (form *accountPasswordUpdateForm) Validate(app *application) {
+	form.CheckField(validators.NotBlank(form.CurrentPassword), "currentPassword", "This field cannot be blank")
+	form.CheckField(validators.NotBlank(form.NewPassword), "newPassword", "This field cannot be blank")
+	app.checkPassword(&form.Validator, "newPassword", form.NewPassword)
+	form.CheckField(validators.NotBlank(form.NewPasswordConfirmation), "newPasswordConfirmation", "This field cannot be blank")
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "Passwords do not match")
+}
+
+type accountProfileUpdateForm struct {
+	Name                 string `form:"name"`
+	Username             string `form:"username"`
+	validators.Validator `form:"-"`
+}
+
+// Validate takes the ID of the user whose profile it is, so that they can keep their own username. That's why the form
+// isn't decoded with decodeAndValidate().
+func (form *accountProfileUpdateForm) Validate(app *application, userID int) {
+	form.CheckField(validators.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validators.MaxChars(form.Name, 255), "name", "This field cannot be more than 255 characters long")
+	form.CheckString("username", form.Username, app.usernameRules(userID)...)
+}
+
+type accountPreferencesForm struct {
+	Timezone             string `form:"timezone"`
+	Locale               string `form:"locale"`
+	validators.Validator `form:"-"`
+}
+
+type accountEmailUpdateForm struct {
+	NewEmail             string `form:"newEmail"`
+	CurrentPassword      string `form:"currentPassword"`
+	validators.Validator `form:"-"`
+}
+
+func (form *accountEmailUpdateForm) Validate(app *application) {
+	form.CheckField(validators.NotBlank(form.NewEmail), "newEmail", "This field cannot be blank")
+	form.CheckField(validators.Matches(form.NewEmail, validators.EmailRX), "newEmail", "This field must be a valid email address")
+	form.CheckField(validators.MaxChars(form.NewEmail, validators.MaxEmailLength), "newEmail", "This field cannot be more than 254 characters long")
+	form.CheckField(!app.isBlockedEmail(form.NewEmail), "newEmail", "Disposable email addresses aren't allowed")
+	form.CheckField(app.isAllowedEmail(form.NewEmail), "newEmail", app.allowedDomainsMessage())
+	form.CheckField(validators.NotBlank(form.CurrentPassword), "currentPassword", "This field cannot be blank")
+}
+
+// The number of snippets on each page of the home page, and in each fragment loaded by infinite scrolling.
+const homePageSize = 10
+
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	// Because httprouter matches the "/" path exactly, we can now remove the manual check of r.URL.Path != "/" from this handler
 
-	snippets, err := app.snippets.Latest()
+	page, ok := pageParam(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	// Anonymous visitors get the first page that admins have put together from the home page sections. Everybody else,
+	// and the later pages, get the latest snippets.
+	if page == 1 && !app.isAuthenticated(r) {
+		sections, lastModified, err := app.homeSections()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data := app.newTemplateData(r)
+		data.Home = sections
+		for _, section := range sections {
+			if section.Name == homeLatest {
+				data.Snippets = section.Snippets
+				data.Pagination = section.Pagination
+			}
+		}
+
+		app.renderConditional(w, r, "home.gohtml", data, lastModified)
+		return
+	}
+
+	snippets, p, err := app.latestSnippets(page)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
 	// Call the newTemplateData() helper to get a templateData struct containing the 'default' data and add the snippets slice to it.
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
+	data.Pagination = p
+
+	// The page only changes when a new snippet is created, so use the newest snippet's creation time as the Last-Modified date.
+	var lastModified time.Time
+	for _, snippet := range snippets {
+		if snippet.Created.After(lastModified) {
+			lastModified = snippet.Created
+		}
+	}
+
+	// Use the renderConditional helper, so repeat visitors and feed readers get a 304 Not Modified when nothing has changed.
+	app.renderConditional(w, r, "home.gohtml", data, lastModified)
+}
+
+// The snippetFragment handler sends one page of the home page's snippet list, without the rest of the page, so that the
+// home page can load more snippets as the user scrolls. It uses the same query and template as the home page.
+// Clients that ask for JSON get the rows' HTML and the URL of the next fragment, if there is one.
+func (app *application) snippetFragment(w http.ResponseWriter, r *http.Request) {
+	page, ok := pageParam(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	snippets, p, err := app.latestSnippets(page)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The fragment doesn't include the navigation or flash message, so there's no need for the rest of the template data.
+	// In particular, newTemplateData() would use up the flash message before the user saw it.
+	data := &templateData{
+		Snippets: snippets,
+		Location: app.viewerLocation(r),
+		Locale:   viewerLocale(r),
+	}
+
+	buf, err := app.executeTemplate("home.gohtml", "snippet_rows", data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer putBuffer(buf)
+
+	var next string
+	if p.HasNext {
+		next = fmt.Sprintf("/fragments/snippets?page=%d", p.Next())
+	}
+
+	w.Header().Add("Vary", "Accept")
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		err = app.writeJSON(w, http.StatusOK, map[string]any{"html": buf.String(), "next": next}, nil)
+		if err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if next != "" {
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// latestSnippets returns a page of the latest snippets, for the home page and its fragments.
+func (app *application) latestSnippets(page int) ([]*models.Snippet, pagination, error) {
+	// Fetch one more snippet than we show, so we know whether there's a next page without a separate COUNT query.
+	snippets, err := app.snippets.Latest(homePageSize+1, (page-1)*homePageSize)
+	if err != nil {
+		return nil, pagination{}, err
+	}
+
+	p := pagination{Page: page, HasNext: len(snippets) > homePageSize}
+	if len(snippets) > homePageSize {
+		snippets = snippets[:homePageSize]
+	}
 
-	// Use the render helper
-	app.render(w, http.StatusOK, "home.gohtml", data)
+	return snippets, p, nil
 }
 
+// maxPublicIDLength matches the size of the snippets.public_id column. Anything longer can't exist, so we don't query for it.
+const maxPublicIDLength = 32
+
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	// When httprouter is parsing a request, the values of any named parameters will be stored in the request context.
 	params := httprouter.ParamsFromContext(r.Context())
 
-	// We can then use the ByName() method to get the value of the "id" named parameter from the slice and validate it as normal
-	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil || id < 1 {
-		app.notFound(w)
+	// We can then use the ByName() method to get the value of the "id" named parameter from the slice.
+	// This is the snippet's public ID, not the numeric primary key, so that snippets can't be found by counting upwards.
+	publicID := params.ByName("id")
+	if publicID == "" || len(publicID) > maxPublicIDLength {
+		app.notFound(w, r)
 		return
 	}
 
-	// Uses the SnippetModel object's Get method to retrieve the data for a specific record based on its ID.
+	// Uses the SnippetModel object's GetByPublicID method to retrieve the data for a specific record.
 	// If no matching record is found, return a 404 Not Found response.
-	snippet, err := app.snippets.Get(id)
+	snippet, err := app.snippets.GetByPublicID(publicID)
 	if err != nil {
-		// It's safer to use errors. Is than traditional comparisons.
-		// errors.Is() works by unwrapping errors as necessary before checking for a match.
-		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w)
-		} else {
-			app.serverError(w, err)
-		}
+		// The modelError helper picks the response from the kind of error, so a models.ErrNoRecord error gives a 404.
+		app.modelError(w, r, err)
+		return
+	}
+
+	// Set the canonical link for the snippet, and keep unlisted snippets out of search engines even if somebody links to them.
+	app.setPageMeta(w, r, pageMeta{
+		canonicalPath: "/snippet/view/" + snippet.PublicID,
+		noIndex:       snippet.Visibility == models.VisibilityUnlisted,
+	})
+
+	// Remember that a logged-in user viewed this snippet, so it shows up in their history.
+	if app.isAuthenticated(r) {
+		app.recordRecentlyViewed(r, snippet.ID)
+	}
+
+	// Link to any copies of the snippet on other instances.
+	mirrors, err := app.remotes.Mirrors(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Count the reactions, and show the viewer which ones they've left.
+	userID := app.authenticatedUserID(r)
+	reactions, reactionsChanged, err := app.reactions.Counts(snippet.ID, userID)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
 	// And do the same thing again here...
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	data.Mirrors = mirrors
+	data.Reactions = reactions
+
+	// Offer to pretty-print structured snippets, like JSON.
+	if f := app.formatters.Find(snippet.Content); f != nil {
+		data.Format.Formatter = f.Name()
+	}
 
-	// Use the new render helper
-	app.render(w, http.StatusOK, "view.gohtml", data)
+	// The owner of the snippet can cross-post it to any of their remote instances or move it to the trash, and sees any
+	// lint warnings for it.
+	if userID != 0 && userID == snippet.UserID {
+		data.IsOwner = true
+		data.Remotes, err = app.remotes.AllForUser(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.LintWarnings = app.lintContent(snippet.Content)
+	}
+
+	// Snippets can't be edited, so the page only changes when the snippet is created, cross-posted somewhere or reacted to.
+	lastModified := snippet.Created
+	if len(mirrors) > 0 && mirrors[len(mirrors)-1].Created.After(lastModified) {
+		lastModified = mirrors[len(mirrors)-1].Created
+	}
+	if reactionsChanged.After(lastModified) {
+		lastModified = reactionsChanged
+	}
+
+	app.renderConditional(w, r, "view.gohtml", data, lastModified)
 }
 
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
@@ -100,120 +347,192 @@ func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 
 	// Initializes a new createSnippetForm instance and pass it to the template.
 	// Notice how this is also a great opportunity to set any default or 'initial' values for the form
-	// --- here we set the initial value for the snippet expiry to 365 days.
+	// --- here we set the initial value for the snippet expiry to the default from the site settings.
 	data.Form = snippetCreateForm{
-		Expires: 365,
+		Expires:    app.site().DefaultExpiry,
+		Visibility: models.VisibilityPublic,
 	}
+	data.Batch = app.newBatchData(r)
 
-	app.render(w, http.StatusOK, "create.gohtml", data)
+	app.render(w, r, http.StatusOK, "create.gohtml", data)
 }
 
 func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
 	// Limit the request body size to 4096 bytes
 	// r.Body = http.MaxBytesReader(w, r.Body, 4096)
 
-	// First call r.ParseForm() which adds any data in POST request bodies to the r.PostForm map.
-	// This also works in the same way for PUT and PATCH requests.
-	// If there are any errors, we use our app.ClientError() helper to send a 400 Bad Request response to the user
-	err := r.ParseForm()
+	// Decode the form data into a snippetCreateForm struct and validate it. If there are any validation errors,
+	// decodeAndValidate re-displays the create.gohtml template with a 422 Unprocessable Entity status, passing in the
+	// form as dynamic data in the Form field, so there's nothing left for us to do.
+	form, ok := decodeAndValidate[snippetCreateForm](app, w, r, "create.gohtml")
+	if !ok {
+		return
+	}
+
+	// Check the snippet against the user's quota. These checks need to know who the user is, so they're made here rather
+	// than in Validate().
+	quota, err := app.snippetQuota(r)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.serverError(w, r, err)
 		return
 	}
 
-	// Declare a new empty instance of the snippetCreateForm struct
-	var form snippetCreateForm
+	if message := quota.checkContent(form.Content); message != "" {
+		form.AddFieldError("content", message)
+	}
 
-	// Call the Decode() method of the form decoder, passing in the current request and *a pointer* to our snippetCreateForm struct.
-	// This will essentially fill our struct with the relevant values from the HTML form.
-	// If there is a problem, we return a 400 Bad Request response to the client.
-	err = app.decodePostForm(r, &form)
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+	// The "Add to batch" button keeps the snippet in the session instead, to be published along with others later.
+	if r.PostForm.Get("batch") != "" {
+		app.addToBatch(w, r, form)
 		return
 	}
 
-	// Because the Validator type is embedded by the snippetCreateForm struct, we can call CheckField() directly on it to execute our validation checks.
-	// CheckField() will add the provided key and error message to the FieldErrors map if the check does not evaluate to true.
-	// For example, in the first line here we "check that the form.Title field is not blank".
-	// In the second, we "check that the form.Title field has a maximum character length of 100" and so on.
-	form.Validator.CheckField(validators.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.Validator.CheckField(validators.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.Validator.CheckField(validators.NotBlank(form.Content), "content", "This field cannot be blank")
-	//form.Validator.CheckField(validators.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7, 365")
-	form.Validator.CheckField(validators.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal, 1, 7 or 365")
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
-	// If there are any validation errors re-display the create.gohtml template,
-	// passing in the snippetCreateForm instance as dynamic data in the Form field.
-	// Not that we use the HTTP status code 422 Unprocessable Entity, when sending the response to indicate that there was a validation error.
-	// Use the Valid() method to see if any of the checks failed. If they did, then re-render the template passing in the form in the same way as before
-	if !form.Validator.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.gohtml", data)
+	// If the same content has already been published, point the user at it, unless they've said they want another copy.
+	if !form.AllowDuplicate {
+		form.Duplicate, err = app.snippets.FindByHash(models.ContentHash(form.Content), userID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		if form.Duplicate != nil {
+			form.AddFieldError("content", "An identical snippet already exists")
+		}
+	}
+
+	if status, message := quota.checkCount(); status != 0 {
+		form.AddNonFieldError(message)
+	}
+	if !form.Valid() {
+		app.renderInvalidForm(w, r, "create.gohtml", form)
 		return
 	}
 
-	// Pass the data to the SnippetModel.Insert() method, receiving the ID of the new record back
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	// Pass the data to the SnippetModel.Insert() method along with the ID of the current user, receiving the ID of the new record back
+	publicID, err := app.snippets.Insert(userID, form.Title, form.Content, form.Expires, form.Visibility)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
+	app.snippetEvent(r, webhooks.EventSnippetCreated, userID, publicID)
+	app.snippetsCreated(form.Visibility)
+
 	// Uses the Put() method to add a string value ("Snippet successfully created!") and the corresponding key ("flash") to the session data
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created")
+	// If the linters found anything, point the user at the warnings, which the view page shows to the snippet's owner.
+	flash := "Snippet successfully created"
+	if len(form.Warnings) > 0 {
+		flash += ", but it might have some problems (see below)"
+	}
+	app.sessionManager.Put(r.Context(), "flash", flash)
 
 	// Redirect the user to the relevant page for the snippet
 	// Updates the redirect path to use the new clean url format
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	http.Redirect(w, r, "/snippet/view/"+publicID, http.StatusSeeOther)
 }
 
-func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = userSignupForm{}
-	app.render(w, http.StatusOK, "signup.gohtml", data)
+// snippetPreviewForm is the part of the create form which the preview needs.
+type snippetPreviewForm struct {
+	Title   string `form:"title"`
+	Content string `form:"content"`
 }
 
-func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
-	// Declare a zero-valued instance of our userSignupForm struct.
-	var form userSignupForm
+// The snippetPreviewPost handler renders a snippet that hasn't been saved yet, so the create page can show a preview. It
+// uses the same template as the view page, so the preview can't drift from what's published. Like snippetFragment, it
+// sends the HTML on its own, or wrapped in JSON for clients which ask for it.
+func (app *application) snippetPreviewPost(w http.ResponseWriter, r *http.Request) {
+	var form snippetPreviewForm
 
-	// Parse the form data into the userSignupForm struct
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Validate the form contents using our helper functions.
-	form.CheckField(validators.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validators.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validators.Matches(form.Email, validators.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validators.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validators.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	// Nothing is saved, but there's no point rendering content that could never be published.
+	if len(form.Content) > maxContentBytes {
+		app.clientError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// As with snippetFragment, newTemplateData() would use up the flash message, and the preview doesn't need the rest.
+	data := &templateData{
+		Snippet:      &models.Snippet{Title: form.Title, Content: form.Content},
+		LintWarnings: app.lintContent(form.Content),
+	}
+
+	buf, err := app.executeTemplate("create.gohtml", "snippet_preview", data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer putBuffer(buf)
+
+	w.Header().Add("Vary", "Accept")
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		err = app.writeJSON(w, http.StatusOK, map[string]any{"html": buf.String()}, nil)
+		if err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
 
-	// if there are any errors, redisplay the signup form along with a 422 status code
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	if !app.signupEnabled(w, r) {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = userSignupForm{}
+	app.render(w, r, http.StatusOK, "signup.gohtml", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	if !app.signupEnabled(w, r) {
+		return
+	}
+
+	// Parse the form data into the userSignupForm struct and validate it. If there are any errors, the signup form has
+	// already been redisplayed along with a 422 status code.
+	form, ok := decodeAndValidate[userSignupForm](app, w, r, "signup.gohtml")
+	if !ok {
+		return
+	}
+
+	// The CAPTCHA is only checked once the rest of the form is valid, because each response can only be checked once, and
+	// the user has to solve it again whenever the form is re-displayed anyway.
+	app.verifyCaptcha(r, &form.Validator)
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.gohtml", data)
+		app.renderInvalidForm(w, r, "signup.gohtml", form)
 		return
 	}
 
-	// Try to create a new user record in the database. If the email already exists then add an error message to the form and re-display it.
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	// Try to create a new user record in the database. If the email or username already exists then add an error message to the form and re-display it.
+	// Guest accounts are only created if they're turned on. Otherwise the checkbox isn't shown, so it's ignored.
+	var err error
+	if form.Guest && app.guestLifetime() > 0 {
+		err = app.users.InsertGuest(form.Name, form.Username, form.Email, form.Password, time.Now().Add(app.guestLifetime()))
+	} else {
+		err = app.users.Insert(form.Name, form.Username, form.Email, form.Password)
+	}
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
 			form.AddFieldError("email", "Email address is already in use")
-
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.gohtml", data)
-		} else {
-			app.serverError(w, err)
+		case errors.Is(err, models.ErrDuplicateUsername):
+			form.AddFieldError("username", "Username is already taken")
+		default:
+			app.serverError(w, r, err)
+			return
 		}
 
+		app.renderInvalidForm(w, r, "signup.gohtml", form)
 		return
 	}
 
@@ -227,29 +546,13 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userLoginForm{}
-	app.render(w, http.StatusOK, "login.gohtml", data)
+	app.render(w, r, http.StatusOK, "login.gohtml", data)
 }
 
 func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
-	// Decode the form data into the userLoginForm struct
-	var form userLoginForm
-
-	err := app.decodePostForm(r, &form)
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
-	}
-
-	// Do some validation checks on the form. We check that both email and password are provided.
-	// And also check the format of the email address as a UX-nicety (in case the user makes a typo).
-	form.CheckField(validators.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validators.Matches(form.Email, validators.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validators.NotBlank(form.Password), "password", "This field cannot be blank")
-
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.gohtml", data)
+	// Decode the form data into the userLoginForm struct, and do some validation checks on it
+	form, ok := decodeAndValidate[userLoginForm](app, w, r, "login.gohtml")
+	if !ok {
 		return
 	}
 
@@ -257,51 +560,40 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	id, err := app.users.Authenticate(form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.recordFailedLogin()
 			form.AddNonFieldError("Email or password is incorrect")
-
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.gohtml", data)
+			app.renderInvalidForm(w, r, "login.gohtml", form)
+		} else if errors.Is(err, models.ErrAccountSuspended) {
+			form.AddNonFieldError("Your account has been suspended. Please contact an admin if you think this is a mistake")
+			app.renderInvalidForm(w, r, "login.gohtml", form)
+		} else if errors.Is(err, models.ErrAccountBanned) {
+			form.AddNonFieldError("Your account has been banned")
+			app.renderInvalidForm(w, r, "login.gohtml", form)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	// Use the RenewToken() method on the current session to change the session ID.
-	// It's good practice to generate a new session ID when the authentication state or privilege levels changes for the user (e.g. login and logout operations)
-	// It's good practice to this before login to mitigate the risk of a session fixation attack. Check OWASP session management cheat sheet
-	err = app.sessionManager.RenewToken(r.Context())
-	if err != nil {
-		app.serverError(w, err)
-		return
-	}
-
-	// Add the ID of the current user to the session, so that they are now 'logged in'
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
-
-	// Use the PopString method to retrieve and remove a value from the session data in one step.
-	// If no matching key exists this will return the empty string
-	path := app.sessionManager.PopString(r.Context(), "redirectAfterLogin")
-	if path != "" {
-		http.Redirect(w, r, path, http.StatusSeeOther)
-		return
-	}
-
-	// Redirect the user to the create snippet page.
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	app.completeLogin(w, r, id)
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	// Use the RenewToken() method on the current session to change the session ID again
 	err := app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
 	// Remove the authenticatedUserID from the session data so that the user is 'logged out'
+	// An admin who logs out while impersonating somebody is logged out of their own account too.
 	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	err = app.endImpersonation(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
 	// Add a flash message to the session to confirm to the user that they've been logged out
 	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
@@ -312,7 +604,7 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) about(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-	app.render(w, http.StatusOK, "about.gohtml", data)
+	app.render(w, r, http.StatusOK, "about.gohtml", data)
 }
 
 func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
@@ -323,7 +615,7 @@ func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
 		if errors.Is(err, models.ErrNoRecord) {
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
@@ -331,18 +623,242 @@ func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.User = user
 
-	app.render(w, http.StatusOK, "account.gohtml", data)
+	app.render(w, r, http.StatusOK, "account.gohtml", data)
 }
 
 func (app *application) accountPasswordUpdate(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = accountPasswordUpdateForm{}
 
-	app.render(w, http.StatusOK, "password.gohtml", data)
+	app.render(w, r, http.StatusOK, "password.gohtml", data)
 }
 
 func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http.Request) {
-	var form accountPasswordUpdateForm
+	form, ok := decodeAndValidate[accountPasswordUpdateForm](app, w, r, "password.gohtml")
+	if !ok {
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err := app.users.PasswordUpdate(userID, form.CurrentPassword, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("currentPassword", "Current password is incorrect")
+			app.renderInvalidForm(w, r, "password.gohtml", form)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been updated!")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountEmailUpdate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountEmailUpdateForm{}
+
+	app.render(w, r, http.StatusOK, "email.gohtml", data)
+}
+
+func (app *application) accountEmailUpdatePost(w http.ResponseWriter, r *http.Request) {
+	form, ok := decodeAndValidate[accountEmailUpdateForm](app, w, r, "email.gohtml")
+	if !ok {
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Check the current password by authenticating against the user's existing email address.
+	// This way we know that the person asking for the change isn't just somebody using an unattended browser.
+	_, err = app.users.Authenticate(user.Email, form.CurrentPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("currentPassword", "Current password is incorrect")
+		} else {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	form.CheckField(form.NewEmail != user.Email, "newEmail", "This is already your email address")
+
+	if !form.Valid() {
+		app.renderInvalidForm(w, r, "email.gohtml", form)
+		return
+	}
+
+	// Store the pending change. The email address is only swapped once the link sent to the new address has been clicked.
+	token, err := app.emailChanges.Insert(user.ID, form.NewEmail, 24*time.Hour)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	emailData := map[string]string{
+		"Name":       user.Name,
+		"ConfirmURL": fmt.Sprintf("%s://%s/account/email/confirm?token=%s", requestScheme(r), r.Host, url.QueryEscape(token)),
+	}
+
+	// Send the confirmation email in a background goroutine, so that a slow SMTP server doesn't hold up the response.
+	app.background(func() {
+		err := app.mailer.Send(form.NewEmail, "email_change.gohtml", emailData)
+		if err != nil {
+			app.errorLog.Printf("[%s] %s", requestID(r), err)
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("We've sent a confirmation link to %s. Your email address will be changed once you follow it.", form.NewEmail))
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountEmailConfirm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		app.notFound(w, r)
+		return
+	}
+
+	change, err := app.emailChanges.Get(token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That confirmation link is invalid or has expired.")
+			http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The new address may have been registered by somebody else since the change was requested,
+	// so handle a duplicate email in the same way as we do during signup.
+	err = app.users.EmailUpdate(change.UserID, change.NewEmail)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			app.sessionManager.Put(r.Context(), "flash", "Email address is already in use")
+			http.Redirect(w, r, "/account/email/update", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.emailChanges.DeleteAllForUser(change.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been updated!")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountHistory(w http.ResponseWriter, r *http.Request) {
+	ids := app.recentlyViewed(r)
+
+	// Look up each snippet in the history. Snippets which have expired since they were viewed are simply skipped.
+	snippets := []*models.Snippet{}
+	for _, id := range ids {
+		snippet, err := app.snippets.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				continue
+			}
+			app.serverError(w, r, err)
+			return
+		}
+		snippets = append(snippets, snippet)
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "history.gohtml", data)
+}
+
+func (app *application) accountHistoryClearPost(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "recentlyViewed")
+
+	app.sessionManager.Put(r.Context(), "flash", "Your history has been cleared.")
+
+	http.Redirect(w, r, "/account/history", http.StatusSeeOther)
+}
+
+// The number of snippets shown on each page of a user's profile.
+const profilePageSize = 10
+
+func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	user, err := app.users.GetByUsername(params.ByName("username"))
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	page, ok := pageParam(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	// Fetch one more snippet than we show, so we know whether there's a next page without a separate COUNT query.
+	snippets, err := app.snippets.LatestByUser(user.ID, profilePageSize+1, (page-1)*profilePageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	follow, err := app.profileFollowData(r, user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.User = user
+	data.Follow = follow
+	data.Pagination = pagination{Page: page, HasNext: len(snippets) > profilePageSize}
+
+	if len(snippets) > profilePageSize {
+		snippets = snippets[:profilePageSize]
+	}
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "profile.gohtml", data)
+}
+
+func (app *application) accountProfileUpdate(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = accountProfileUpdateForm{
+		Name:     user.Name,
+		Username: user.Username,
+	}
+
+	app.render(w, r, http.StatusOK, "profile_edit.gohtml", data)
+}
+
+func (app *application) accountProfileUpdatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountProfileUpdateForm
 
 	err := app.decodePostForm(r, &form)
 	if err != nil {
@@ -350,42 +866,124 @@ func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http
 		return
 	}
 
-	form.CheckField(validators.NotBlank(form.CurrentPassword), "currentPassword", "This field cannot be blank")
-	form.CheckField(validators.NotBlank(form.NewPassword), "newPassword", "This field cannot be blank")
-	form.CheckField(validators.MinChars(form.NewPassword, 8), "newPassword", "This field must be at least 8 characters long")
-	form.CheckField(validators.NotBlank(form.NewPasswordConfirmation), "newPasswordConfirmation", "This field cannot be blank")
-	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "Passwords do not match")
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	form.Validate(app, userID)
+
+	if err := form.Err(); err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	if !form.Valid() {
+		app.renderInvalidForm(w, r, "profile_edit.gohtml", form)
+		return
+	}
+
+	err = app.users.ProfileUpdate(userID, form.Name, form.Username)
+	if err != nil {
+		// The username can still be taken between the check and the update.
+		if errors.Is(err, models.ErrDuplicateUsername) {
+			form.AddFieldError("username", "Username is already taken")
+			app.renderInvalidForm(w, r, "profile_edit.gohtml", form)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your profile has been updated!")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountPreferences(w http.ResponseWriter, r *http.Request) {
+	user := authenticatedUser(r)
+
+	data := app.newTemplateData(r)
+	data.Form = accountPreferencesForm{
+		Timezone: user.Timezone,
+		Locale:   user.Locale,
+	}
+	data.Locales = locales
+
+	app.render(w, r, http.StatusOK, "preferences.gohtml", data)
+}
+
+func (app *application) accountPreferencesPost(w http.ResponseWriter, r *http.Request) {
+	var form accountPreferencesForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, knownLocale := findLocale(form.Locale)
+
+	form.CheckField(validators.NotBlank(form.Timezone), "timezone", "This field cannot be blank")
+	form.CheckField(validators.MaxChars(form.Timezone, 64), "timezone", "This field cannot be more than 64 characters long")
+	form.CheckField(validTimezone(form.Timezone), "timezone", "This must be a timezone name like Europe/London")
+	form.CheckField(knownLocale, "locale", "This field must be one of the listed options")
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
+		data.Locales = locales
 
-		app.render(w, http.StatusUnprocessableEntity, "password.gohtml", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "preferences.gohtml", data)
 		return
 	}
 
 	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
-	err = app.users.PasswordUpdate(userID, form.CurrentPassword, form.NewPassword)
+	err = app.users.PreferencesUpdate(userID, form.Timezone, form.Locale)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddFieldError("currentPassword", "Current password is incorrect")
+		app.serverError(w, r, err)
+		return
+	}
 
-			data := app.newTemplateData(r)
-			data.Form = form
+	app.sessionManager.Put(r.Context(), "flash", "Your preferences have been saved!")
 
-			app.render(w, http.StatusUnprocessableEntity, "password.gohtml", data)
-		} else if err != nil {
-			app.serverError(w, err)
-		}
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// How long a pairing code stays valid for after it's been shown to the user.
+const pairingCodeTTL = 10 * time.Minute
+
+func (app *application) accountPair(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	app.render(w, r, http.StatusOK, "pair.gohtml", data)
+}
+
+func (app *application) accountPairPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// Only the most recent pairing code should work, so remove any earlier ones first.
+	err := app.tokens.DeleteAllForUser(models.ScopePairing, userID)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your password has been updated!")
+	token, err := app.tokens.New(userID, pairingCodeTTL, models.ScopePairing)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
-	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+	// Render the code directly, rather than redirecting, so that it never needs to be stored anywhere in plaintext.
+	data := app.newTemplateData(r)
+	data.PairingCode = token.Plaintext[:4] + "-" + token.Plaintext[4:]
+
+	app.render(w, r, http.StatusOK, "pair.gohtml", data)
 }
 
-func ping(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("OK"))
+// The debugAssets handler sends the manifest of the embedded templates and static files, so that operators can check
+// exactly which UI build a running binary contains. The files are all public anyway, so it doesn't need authentication.
+func (app *application) debugAssets(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, app.assets, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"net/http"
+	"time"
+)
+
+// The templates which have to be in the template cache for the application to be ready. If these are there, the rest
+// were parsed along with them.
+var readyTemplates = []string{"home.gohtml", "view.gohtml", "404.gohtml", "500.gohtml", "503.gohtml", "maintenance.gohtml"}
+
+// The readinessCheck type is one of the things that /readyz checks. The check function should give up when the context
+// is done, but a check which doesn't (like a query without a context) is reported as timed out anyway.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// The checkResult type is the outcome of a readinessCheck, as it's shown in the /readyz response.
+type checkResult struct {
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// readinessChecks returns the checks that /readyz runs: the database answers a ping, the session store can be read, the
+// templates have been parsed, and the database schema is at least the version that this build needs.
+func (app *application) readinessChecks() []readinessCheck {
+	return []readinessCheck{
+		{name: "database", check: app.pingDB},
+		{name: "sessions", check: func(context.Context) error {
+			// Looking up a token which doesn't exist shows that the store can be read, without changing anything.
+			_, _, err := app.sessionManager.Store.Find("readyz")
+			return err
+		}},
+		{name: "templates", check: func(context.Context) error {
+			for _, page := range readyTemplates {
+				if app.templateCache[page] == nil {
+					return fmt.Errorf("template %s isn't loaded", page)
+				}
+			}
+			return nil
+		}},
+		{name: "migrations", check: func(context.Context) error {
+			version, dirty, err := app.schema.Version()
+			switch {
+			case errors.Is(err, models.ErrNoRecord):
+				return errors.New("no migrations have been recorded")
+			case err != nil:
+				return err
+			case dirty:
+				return fmt.Errorf("migration %d failed part way through", version)
+			case version < models.SchemaVersion:
+				return fmt.Errorf("schema version is %d, but %d is needed", version, models.SchemaVersion)
+			}
+			return nil
+		}},
+	}
+}
+
+// runChecks runs the checks at the same time, and waits for them until the context is done.
+func runChecks(ctx context.Context, checks []readinessCheck) map[string]checkResult {
+	type outcome struct {
+		name   string
+		result checkResult
+	}
+
+	done := make(chan outcome, len(checks))
+	for _, c := range checks {
+		go func() {
+			start := time.Now()
+			err := c.check(ctx)
+
+			result := checkResult{Status: "ok", DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Status, result.Error = "failed", err.Error()
+			}
+			done <- outcome{name: c.name, result: result}
+		}()
+	}
+
+	results := make(map[string]checkResult, len(checks))
+	for range checks {
+		select {
+		case o := <-done:
+			results[o.name] = o.result
+		case <-ctx.Done():
+			for _, c := range checks {
+				if _, ok := results[c.name]; !ok {
+					results[c.name] = checkResult{Status: "failed", Error: "timed out"}
+				}
+			}
+			return results
+		}
+	}
+
+	return results
+}
+
+// The healthz handler is the liveness probe. It only shows that the process is running and can answer requests, so that
+// an orchestrator doesn't restart it because something it depends on (like the database) is down.
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := app.writeJSON(w, http.StatusOK, map[string]any{
+		"status":  "ok",
+		"started": app.started,
+	}, nil)
+	if err != nil {
+		app.errorLog.Printf("[%s] writing health: %s", requestID(r), err)
+	}
+}
+
+// The readyz handler is the readiness probe. It responds with a 503 unless every one of the readinessChecks passes
+// within -db-health-check-timeout, so that a load balancer only sends traffic to servers which can serve it. The result
+// of each check is included, for whoever is working out why a server isn't ready.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), app.config.db.healthTimeout)
+	defer cancel()
+
+	results := runChecks(ctx, app.readinessChecks())
+
+	status, code := "ready", http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, code = "not ready", http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := app.writeJSON(w, code, map[string]any{"status": status, "checks": results}, nil)
+	if err != nil {
+		app.errorLog.Printf("[%s] writing readiness: %s", requestID(r), err)
+	}
+}
@@ -2,27 +2,138 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/0xshiku/snippetbox/internal/cache"
+	"github.com/0xshiku/snippetbox/internal/emailaddr"
+	"github.com/0xshiku/snippetbox/internal/lint"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/tracing"
+	"github.com/0xshiku/snippetbox/internal/validators"
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"io"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// The maximum number of snippets kept in a user's recently viewed history.
+const maxRecentlyViewed = 10
+
 // The serverError helper writers an error message and stack trace to the errorLog
-// Then sends a generic 500 response to the user.
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+// Then sends a generic 500 response to the user, with the request ID so that they can quote it when reporting the problem.
+// In debug mode, the page also shows the error, the stack trace and the details of the request.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	stack := string(debug.Stack())
+	trace := fmt.Sprintf("[%s] %s\n%s", requestID(r), err.Error(), stack)
 	app.errorLog.Output(2, trace)
+	app.recordServerError(err)
+	app.reportError(r, err, []byte(stack))
+
+	// Whatever the route's cache policy, an error page should never be cached.
+	w.Header().Set("Cache-Control", "no-store")
+
+	data := app.newErrorTemplateData(r)
+	data.RequestID = requestID(r)
+	text := fmt.Sprintf("%s\nRequest ID: %s", http.StatusText(http.StatusInternalServerError), data.RequestID)
+
+	if app.config.debug {
+		data.Debug = newDebugInfo(r, err, stack)
+		text = trace
+	}
+
+	app.renderError(w, http.StatusInternalServerError, "500.gohtml", data, text)
+}
+
+// The debugInfo type holds the details shown on the 500 page in debug mode.
+type debugInfo struct {
+	Error      string
+	Stack      string
+	Method     string
+	URL        string
+	Proto      string
+	RemoteAddr string
+	Headers    []debugHeader
+}
+
+type debugHeader struct {
+	Name  string
+	Value string
+}
+
+// These headers hold credentials, so we don't show their values even in debug mode. Someone might share a screenshot of the page.
+var redactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+func newDebugInfo(r *http.Request, err error, stack string) *debugInfo {
+	info := &debugInfo{
+		Error:      err.Error(),
+		Stack:      stack,
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Proto:      r.Proto,
+		RemoteAddr: r.RemoteAddr,
+	}
+
+	for name, values := range r.Header {
+		value := strings.Join(values, ", ")
+		if slices.Contains(redactedHeaders, name) {
+			value = "[redacted]"
+		}
+		info.Headers = append(info.Headers, debugHeader{Name: name, Value: value})
+	}
+
+	// Map iteration order is random, so sort the headers to make the page easier to read.
+	slices.SortFunc(info.Headers, func(a, b debugHeader) int {
+		return strings.Compare(a.Name, b.Name)
+	})
 
-	if app.debug {
-		http.Error(w, trace, http.StatusInternalServerError)
+	return info
+}
+
+// The renderError helper writes an error page with the given status. We can't use render() here, because it calls serverError()
+// when something goes wrong, so if the error page itself fails to render we fall back to sending the plain text instead.
+func (app *application) renderError(w http.ResponseWriter, status int, page string, data *templateData, text string) {
+	buf, err := app.renderPage(page, data)
+	if err != nil {
+		app.errorLog.Output(2, fmt.Sprintf("[%s] rendering %s: %s", data.RequestID, page, err))
+		http.Error(w, text, status)
 		return
 	}
+	defer putBuffer(buf)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// Read the page number from the query string, defaulting to the first page. It reports false if the page number isn't valid.
+func pageParam(r *http.Request) (int, bool) {
+	p := r.URL.Query().Get("page")
+	if p == "" {
+		return 1, true
+	}
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	page, err := strconv.Atoi(p)
+	if err != nil || page < 1 {
+		return 0, false
+	}
+
+	return page, true
+}
+
+// Return the ID of the request, which is set by the setRequestID middleware. It's included in log lines about the request,
+// so that they can be found from the ID a user quotes.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
 }
 
 // The clientError helper sends a specific status code and corresponding description to the user.
@@ -30,32 +141,58 @@ func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
-// The notFound helper is simply a convenience wrapper around clientError. It sends a 404.
-func (app *application) notFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound)
+// The notFound helper sends a 404 Not Found response, using the 404.gohtml page so that the user still gets the usual navigation.
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	data := app.newErrorTemplateData(r)
+	data.RequestID = requestID(r)
+	app.renderError(w, http.StatusNotFound, "404.gohtml", data, http.StatusText(http.StatusNotFound))
 }
 
-func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
-	// Retrieve the appropriate template set from the cache based on the page
-	// name (like 'home.gohtml'). If no entry exists in the cache with the provided name, then create a new error and call the serverError() helper
-	// method that we made earlier and return
-	ts, ok := app.templateCache[page]
-	if !ok {
-		err := fmt.Errorf("the template %s does not exist", page)
-		app.serverError(w, err)
-		return
+// errorStatus returns the HTTP status code for an error returned by one of the models, based on its kind.
+func errorStatus(err error) int {
+	switch models.KindOf(err) {
+	case models.KindNotFound:
+		return http.StatusNotFound
+	case models.KindConflict:
+		return http.StatusConflict
+	case models.KindInvalid:
+		return http.StatusUnprocessableEntity
+	case models.KindUnavailable:
+		return http.StatusServiceUnavailable
+	case models.KindForbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
 	}
+}
 
-	// Initialize a new buffer.
-	buf := new(bytes.Buffer)
+// The modelError helper sends the response for an error returned by one of the models, so that handlers don't need
+// to check for each error value in turn. Unexpected errors are logged and get a 500 response, as with serverError().
+func (app *application) modelError(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
 
-	// Write the template to the buffer, instead of straight to the http.ResponseWriter.
-	// If there's an error, call our serverError() helper and then return
-	err := ts.ExecuteTemplate(buf, "base", data)
+	switch status {
+	case http.StatusInternalServerError:
+		app.serverError(w, r, err)
+	case http.StatusServiceUnavailable:
+		// The database is down, which is worth logging (and alerting on) even though the request itself was fine.
+		app.errorLog.Output(2, fmt.Sprintf("[%s] %s", requestID(r), err))
+		app.recordServerError(err)
+		app.clientError(w, status)
+	case http.StatusNotFound:
+		app.notFound(w, r)
+	default:
+		app.clientError(w, status)
+	}
+}
+
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data *templateData) {
+	buf, err := app.tracedRenderPage(r, page, data)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
+	defer putBuffer(buf)
 
 	// If the template is written to the buffer without any errors, we are safe
 	// to go ahead and write the HTTP status code to http.ResponseWriter
@@ -66,17 +203,261 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 	buf.WriteTo(w)
 }
 
+// Return the Content-Security-Policy nonce for the request, or the empty string if secureHeaders didn't run.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceContextKey).(string)
+	return nonce
+}
+
+// Return the scheme that the client used to make the request. Behind a trusted proxy this comes from the X-Forwarded-Proto
+// header, as the proxy's connection to us might not be the same as the client's connection to the proxy.
+func requestScheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value(forwardedSchemeContextKey).(string); ok {
+		return scheme
+	}
+
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// The renderPage helper executes a page template into a buffer, so that we can check for errors (or hash the output) before anything is sent to the client.
+// The buffer should be handed back with putBuffer() once it has been written.
+func (app *application) renderPage(page string, data *templateData) (*bytes.Buffer, error) {
+	return app.executeTemplate(page, "base", data)
+}
+
+// The tracedRenderPage helper is renderPage with a span around it, as a child of the request's span.
+func (app *application) tracedRenderPage(r *http.Request, page string, data *templateData) (*bytes.Buffer, error) {
+	_, span := app.tracer.Start(r.Context(), "render "+page, tracing.KindInternal)
+	defer span.End()
+
+	buf, err := app.renderPage(page, data)
+	span.SetError(err)
+	return buf, err
+}
+
+// The executeTemplate helper executes the named template from a page's template set into a buffer. Executing a partial
+// (rather than "base") renders part of a page, like the rows of a table.
+func (app *application) executeTemplate(page, name string, data *templateData) (*bytes.Buffer, error) {
+	// Retrieve the appropriate template set from the cache based on the page
+	// name (like 'home.gohtml'). If no entry exists in the cache with the provided name, then return an error.
+	ts, ok := app.templateCache[page]
+	if !ok {
+		return nil, fmt.Errorf("the template %s does not exist", page)
+	}
+
+	// When templates are being reloaded, parse the page again from disk, so that changes show up without a restart.
+	// We still check the cache first, so that a page which isn't in the build fails in the same way as in production.
+	if app.templateFS != nil {
+		var err error
+		ts, err = parsePage(app.templateFS, page)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Write the template to a buffer, instead of straight to the http.ResponseWriter.
+	buf := renderBuffers.Get().(*bytes.Buffer)
+	err := ts.ExecuteTemplate(buf, name, data)
+	if err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+const (
+	// Most pages come to a few kilobytes, so new buffers start big enough for one of them without having to grow.
+	renderBufferSize = 8 << 10
+	// Buffers which have grown past this (for a huge snippet, say) aren't kept, so that the pool doesn't hold on to them.
+	maxRenderBufferSize = 256 << 10
+)
+
+// Every page is rendered into a buffer before it's sent, so reuse them rather than allocating (and growing) a new one
+// for each request.
+var renderBuffers = sync.Pool{
+	New: func() any {
+		return bytes.NewBuffer(make([]byte, 0, renderBufferSize))
+	},
+}
+
+// The putBuffer helper returns a buffer from executeTemplate() to the pool. It mustn't be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxRenderBufferSize {
+		return
+	}
+
+	buf.Reset()
+	renderBuffers.Put(buf)
+}
+
+// The renderConditional helper renders a page with a 200 OK status like render(), but also sets a weak ETag (a hash of the page)
+// and, if lastModified isn't zero, a Last-Modified header. When the request's If-None-Match or If-Modified-Since header shows that
+// the client already has this version of the page, we send a 304 Not Modified response without a body instead.
+func (app *application) renderConditional(w http.ResponseWriter, r *http.Request, page string, data *templateData, lastModified time.Time) {
+	buf, err := app.tracedRenderPage(r, page, data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer putBuffer(buf)
+
+	// The CSP nonce is different on every request, so leave it out of the hash. Otherwise the ETag would never match.
+	hashed := buf.Bytes()
+	if data.CSPNonce != "" {
+		hashed = bytes.ReplaceAll(hashed, []byte(data.CSPNonce), nil)
+	}
+	sum := sha256.Sum256(hashed)
+	etag := fmt.Sprintf(`W/"%x"`, sum[:16])
+
+	// The Cache-Control and Vary headers come from the route's cache policy (see the cacheControl middleware).
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		// Browsers update their cached headers from a 304 response. The cached page still contains the old nonce, so don't send
+		// a CSP header with a new one, or the inline scripts would be blocked.
+		w.Header().Del("Content-Security-Policy")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+// notModified reports whether the client's cached copy of a page is still current. As in RFC 9110, If-None-Match takes
+// precedence over If-Modified-Since, and ETags are compared weakly (ignoring the W/ prefix).
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	// HTTP dates only have a resolution of one second.
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
 // Create an newTemplateData() helper, which returns a pointer to a templateData struct initialised with current year
 // Note that we're not using the *http.Request parameter here at the moment, but we will do later in the book
 // Add the flash message to the template data, if one exists.
 // Add the authentication status to the template data
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
+		CurrentYear:      time.Now().Year(),
+		Flash:            app.sessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated:  app.isAuthenticated(r),
+		CSRFToken:        nosurf.Token(r),
+		CSPNonce:         cspNonce(r),
+		PasswordRules:    app.passwordPolicy.Describe(),
+		AssetsChecksum:   app.assets.ShortChecksum(),
+		Location:         app.viewerLocation(r),
+		Locale:           viewerLocale(r),
+		GuestLifetime:    app.guestLifetime(),
+		FormToken:        app.formToken(),
+		Captcha:          app.captchaWidget(),
+		OIDCName:         app.oidcName(),
+		Unread:           app.unreadNotifications(r),
+		CollabEnabled:    app.config.collab.enabled,
+		ImpersonatedUser: app.impersonatedUsername(r),
+		Maintenance:      app.inMaintenance(),
+		Site:             app.site(),
+		Announcement:     app.newAnnouncementData(r),
+	}
+}
+
+// The newErrorTemplateData helper is like newTemplateData, but it is also safe to call for requests which haven't been through
+// the session middleware, like a panic caught by recoverPanic. For those, there's no flash message to show.
+func (app *application) newErrorTemplateData(r *http.Request) *templateData {
+	data := &templateData{
 		CurrentYear:     time.Now().Year(),
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
 		CSRFToken:       nosurf.Token(r),
+		CSPNonce:        cspNonce(r),
+		AssetsChecksum:  app.assets.ShortChecksum(),
+		Location:        app.viewerLocation(r),
+		Locale:          viewerLocale(r),
+		Site:            app.site(),
+	}
+
+	// Without a session, there's no knowing whether the visitor has dismissed the announcement, so it's left out.
+	if app.sessionLoaded(r) {
+		data.Flash = app.sessionManager.PopString(r.Context(), "flash")
+		data.Announcement = app.newAnnouncementData(r)
+	}
+
+	return data
+}
+
+// Report whether the session middleware has run for the request. The session manager panics if we try to read a session
+// which hasn't been loaded, and it doesn't give us a way to check first, so we recover from that panic here.
+func (app *application) sessionLoaded(r *http.Request) (loaded bool) {
+	defer func() {
+		if recover() != nil {
+			loaded = false
+		}
+	}()
+
+	app.sessionManager.Status(r.Context())
+	return true
+}
+
+// Limits on the shape of the HTML forms we'll decode. Our forms have a handful of flat fields, so anything much bigger
+// than that isn't from one of our pages.
+const (
+	maxFormFields      = 32 // Distinct field names in one form.
+	maxFormValues      = 8  // Values for one field name.
+	maxFormKeyLength   = 64 // Characters in a field name.
+	maxFormNesting     = 2  // "[" and "." separators in a field name.
+	maxFormArrayLength = 16 // Elements in a slice field, like "tags[15]".
+)
+
+// newFormDecoder returns the decoder used for all the HTML forms. By default, the decoder will grow a slice to match the
+// largest index it sees, so a single "field[9999]" value would allocate 10,000 elements. We keep that limit small.
+func newFormDecoder() *form.Decoder {
+	decoder := form.NewDecoder()
+	decoder.SetMaxArraySize(maxFormArrayLength)
+	return decoder
+}
+
+// checkFormLimits returns an error if the form is bigger or more deeply nested than any of our forms could be.
+func checkFormLimits(values url.Values) error {
+	if len(values) > maxFormFields {
+		return fmt.Errorf("form has %d fields, more than the limit of %d", len(values), maxFormFields)
 	}
+
+	for key, vals := range values {
+		switch {
+		case len(key) > maxFormKeyLength:
+			return fmt.Errorf("form field name is longer than %d characters", maxFormKeyLength)
+		case strings.Count(key, "[")+strings.Count(key, ".") > maxFormNesting:
+			return fmt.Errorf("form field %q is nested more than %d levels deep", key, maxFormNesting)
+		case len(vals) > maxFormValues:
+			return fmt.Errorf("form field %q has more than %d values", key, maxFormValues)
+		}
+	}
+
+	return nil
 }
 
 // Create a new decodePostForm() helper method.
@@ -88,6 +469,12 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 		return err
 	}
 
+	// Refuse forms which couldn't have come from one of our pages, before the decoder does any work on them.
+	err = checkFormLimits(r.PostForm)
+	if err != nil {
+		return err
+	}
+
 	// Call Decode() on our decoder instance, passing the target destination as the first parameter
 	err = app.formDecoder.Decode(dst, r.PostForm)
 	if err != nil {
@@ -106,6 +493,94 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 	return nil
 }
 
+// The validatable interface is implemented by pointers to our form structs. Validate runs the form's checks, some of which
+// need the application (like the password policy, or the disposable email list), and Valid reports whether they all passed.
+// Err returns the error from any check which needed the database and couldn't reach it.
+type validatable interface {
+	Validate(app *application)
+	Valid() bool
+	Err() error
+}
+
+// decodeAndValidate decodes the POST form in r into a new T and validates it. If the form can't be decoded it sends a 400 Bad
+// Request response, and if it's invalid it re-displays page with the errors. In both cases it returns false, and the handler
+// should return straight away.
+// The second type parameter lets us call the pointer methods of T, so callers only need to name the form type:
+//
+//	form, ok := decodeAndValidate[userLoginForm](app, w, r, "login.gohtml")
+func decodeAndValidate[T any, PT interface {
+	*T
+	validatable
+}](app *application, w http.ResponseWriter, r *http.Request, page string) (T, bool) {
+	var form T
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return form, false
+	}
+
+	PT(&form).Validate(app)
+
+	// A failed lookup isn't the user's fault, so send an error response rather than re-displaying the form.
+	if err := PT(&form).Err(); err != nil {
+		app.modelError(w, r, err)
+		return form, false
+	}
+
+	if !PT(&form).Valid() {
+		app.renderInvalidForm(w, r, page, form)
+		return form, false
+	}
+
+	return form, true
+}
+
+// renderInvalidForm re-displays page with a 422 Unprocessable Entity status, so that the user can fix the errors in form.
+// Handlers use it directly when a check can only be made after validation, like a username turning out to be taken.
+func (app *application) renderInvalidForm(w http.ResponseWriter, r *http.Request, page string, form any) {
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, r, http.StatusUnprocessableEntity, page, data)
+}
+
+// Return the record of the logged-in user, as loaded by the authenticate middleware, or nil for anonymous visitors.
+func authenticatedUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(authenticatedUserContextKey).(*models.User)
+	return user
+}
+
+// Return true if the logged-in user has used a recovery code, and hasn't set up two-factor authentication again since.
+func mustEnrollTwoFactor(r *http.Request) bool {
+	user := authenticatedUser(r)
+	return user != nil && user.MustEnrollTwoFactor
+}
+
+// Return the timezone to show dates in for the person making the request. That's UTC for anonymous visitors, and for users
+// whose saved timezone can no longer be loaded (which is logged, as it means the timezone database has changed).
+func (app *application) viewerLocation(r *http.Request) *time.Location {
+	user := authenticatedUser(r)
+	if user == nil || user.Timezone == "" {
+		return time.UTC
+	}
+
+	loc, err := loadLocation(user.Timezone)
+	if err != nil {
+		app.errorLog.Output(2, fmt.Sprintf("[%s] user %d: %s", requestID(r), user.ID, err))
+		return time.UTC
+	}
+
+	return loc
+}
+
+// Return the locale to show dates in for the person making the request.
+func viewerLocale(r *http.Request) string {
+	if user := authenticatedUser(r); user != nil && user.Locale != "" {
+		return user.Locale
+	}
+	return defaultLocale
+}
+
 // Return true if the current request is from an authenticated user, otherwise return false
 func (app *application) isAuthenticated(r *http.Request) bool {
 	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
@@ -115,3 +590,330 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 	return isAuthenticated
 }
+
+// The checkPassword() helper applies the password policy to a new password, adding an error for the given field if it breaks any of the rules.
+// If the breach check is enabled but the service can't be reached, the error is logged and the password is allowed,
+// so that an outage elsewhere doesn't stop anybody signing up.
+func (app *application) checkPassword(v *validators.Validator, key, newPassword string) {
+	if problem := app.passwordPolicy.Check(newPassword); problem != "" {
+		v.AddFieldError(key, problem)
+		return
+	}
+
+	if !app.passwordPolicy.BreachCheck || app.breaches == nil {
+		return
+	}
+
+	breached, err := app.breaches.Breached(newPassword)
+	if err != nil {
+		app.errorLog.Printf("password breach check failed: %s", err)
+		return
+	}
+
+	if breached {
+		v.AddFieldError(key, "This password has appeared in a data breach, please choose another one")
+	}
+}
+
+// The isBlockedEmail() helper reports whether an email address uses a disposable domain, and admins have chosen to block them.
+func (app *application) isBlockedEmail(email string) bool {
+	return app.site().BlockDisposableEmails && app.disposable.IsDisposable(email)
+}
+
+// The isAllowedEmail() helper reports whether an email address is at one of the -email-allowed-domains, or true if
+// there aren't any.
+func (app *application) isAllowedEmail(email string) bool {
+	return len(app.config.email.allowedDomains) == 0 || emailaddr.AtDomain(email, app.config.email.allowedDomains)
+}
+
+// The allowedDomainsMessage() helper returns the form error for an address that isn't at one of the allowed domains.
+func (app *application) allowedDomainsMessage() string {
+	return "Only email addresses at " + strings.Join(app.config.email.allowedDomains, ", ") + " can be used"
+}
+
+// The cached() helper returns the value cached under the key, or calls load and caches what it returns for the ttl. If
+// the cache can't be reached, the error is logged and the value is loaded every time instead.
+func cached[T any](app *application, key string, ttl time.Duration, load func() (T, error)) (T, error) {
+	value, err := cache.Fetch(app.cache, key, ttl, load)
+	if errors.Is(err, cache.ErrUnavailable) {
+		app.errorLog.Print(err)
+		err = nil
+	}
+	return value, err
+}
+
+// The lintContent() helper returns warnings about possible mistakes in a snippet's content, or nil if linting is turned off.
+func (app *application) lintContent(content string) []lint.Warning {
+	if app.linter == nil || strings.TrimSpace(content) == "" {
+		return nil
+	}
+
+	return app.linter.Lint(content)
+}
+
+// The emailRules() helper returns the rules for a new email address. The address mustn't belong to anybody except the user
+// with the ID exceptID, so pass zero when nobody is logged in.
+// They're shared by the signup form and the /api/validate endpoint, so the inline check gives the same answer as submitting.
+func (app *application) emailRules(exceptID int) []validators.Rule {
+	return []validators.Rule{
+		validators.Required(),
+		validators.Pattern(validators.EmailRX, "This field must be a valid email address"),
+		validators.Length(validators.MaxEmailLength),
+		validators.NewRule(func(email string) bool { return !app.isBlockedEmail(email) }, "Disposable email addresses aren't allowed"),
+		validators.NewRule(app.isAllowedEmail, app.allowedDomainsMessage()),
+		validators.Unique(validators.CheckerFunc(func(email string) (bool, error) {
+			return app.users.EmailTaken(email, exceptID)
+		}), "Email address is already in use"),
+	}
+}
+
+// The usernameRules() helper is like emailRules(), but for usernames.
+func (app *application) usernameRules(exceptID int) []validators.Rule {
+	return []validators.Rule{
+		validators.Required(),
+		validators.Pattern(validators.UsernameRX, "This field must be 3-30 letters, numbers, underscores or hyphens"),
+		validators.Unique(validators.CheckerFunc(func(username string) (bool, error) {
+			return app.users.UsernameTaken(username, exceptID)
+		}), "Username is already taken"),
+	}
+}
+
+// The logIn() helper marks the session as belonging to the user with the given ID.
+func (app *application) logIn(r *http.Request, id int) error {
+	// Use the RenewToken() method on the current session to change the session ID.
+	// It's good practice to generate a new session ID when the authentication state or privilege levels changes for the user (e.g. login and logout operations)
+	// It's good practice to this before login to mitigate the risk of a session fixation attack. Check OWASP session management cheat sheet
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	// The session has a new token, so it needs a new entry in the user's list of sessions.
+	app.sessionManager.Remove(r.Context(), "sessionSeen")
+
+	// The user has finished logging in, so forget about any half-finished two-factor login.
+	app.sessionManager.Remove(r.Context(), "pendingTwoFactorUserID")
+	app.sessionManager.Remove(r.Context(), "pendingTwoFactorExpiry")
+
+	// Logging in as yourself ends any impersonation that the session was part of.
+	err = app.endImpersonation(r)
+	if err != nil {
+		return err
+	}
+
+	// Add the ID of the current user to the session, so that they are now 'logged in'
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+
+	return nil
+}
+
+// The completeLogin() helper logs in a user whose password (or identity provider) has been checked, and sends them on.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, id int) {
+	// If the user has turned on two-factor authentication, the password alone isn't enough.
+	// Remember who they are, and ask for the code from their authenticator app before logging them in.
+	secret, err := app.twoFactor.Secret(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if secret != "" {
+		err = app.startTwoFactorLogin(r, id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.redirectAfterLogin(w, r)
+}
+
+// The redirectAfterLogin() helper sends a user who has just logged in to the page they were trying to get to, or the create snippet page.
+func (app *application) redirectAfterLogin(w http.ResponseWriter, r *http.Request) {
+	// Use the PopString method to retrieve and remove a value from the session data in one step.
+	// If no matching key exists this will return the empty string
+	path := app.sessionManager.PopString(r.Context(), "redirectAfterLogin")
+	if path != "" {
+		http.Redirect(w, r, path, http.StatusSeeOther)
+		return
+	}
+
+	// Redirect the user to the create snippet page.
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// twoFactorLoginTTL is how long a user has to enter their two-factor code after entering their password.
+const twoFactorLoginTTL = 5 * time.Minute
+
+// The startTwoFactorLogin() helper records that the user has entered the right password, but still needs to enter a two-factor code.
+func (app *application) startTwoFactorLogin(r *http.Request, id int) error {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Put(r.Context(), "pendingTwoFactorUserID", id)
+	app.sessionManager.Put(r.Context(), "pendingTwoFactorExpiry", time.Now().Add(twoFactorLoginTTL).Unix())
+
+	return nil
+}
+
+// The pendingTwoFactorUserID() helper returns the ID of the user part-way through a two-factor login, or 0 if there isn't one (or it has expired).
+func (app *application) pendingTwoFactorUserID(r *http.Request) int {
+	if time.Now().Unix() > app.sessionManager.GetInt64(r.Context(), "pendingTwoFactorExpiry") {
+		return 0
+	}
+
+	return app.sessionManager.GetInt(r.Context(), "pendingTwoFactorUserID")
+}
+
+// The background() helper accepts an arbitrary function as a parameter and executes it in a background goroutine.
+// Any panic in the background goroutine is recovered and logged, rather than terminating the application.
+// The goroutines are counted in app.jobs, for the admin runbook page.
+func (app *application) background(fn func()) {
+	app.jobs.started.Add(1)
+	app.jobs.running.Add(1)
+
+	go func() {
+		defer app.jobs.running.Add(-1)
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.jobs.recordPanic(err)
+				app.errorLog.Output(2, fmt.Sprintf("%s\n%s", err, debug.Stack()))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// Return the ID of the authenticated user for the current request, or 0 if the request isn't authenticated.
+// This works for both session and API token authentication.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	id, ok := r.Context().Value(authenticatedUserIDContextKey).(int)
+	if !ok {
+		return 0
+	}
+
+	return id
+}
+
+// Return the IDs of the snippets recently viewed by the current user, most recent first.
+func (app *application) recentlyViewed(r *http.Request) []int {
+	ids, ok := app.sessionManager.Get(r.Context(), "recentlyViewed").([]int)
+	if !ok {
+		return []int{}
+	}
+
+	return ids
+}
+
+// Add a snippet ID to the front of the recently viewed history in the session. If the snippet is already in the history it is moved to the front,
+// and the history is trimmed so that it never holds more than maxRecentlyViewed entries.
+func (app *application) recordRecentlyViewed(r *http.Request, id int) {
+	ids := []int{id}
+	for _, existing := range app.recentlyViewed(r) {
+		if existing != id && len(ids) < maxRecentlyViewed {
+			ids = append(ids, existing)
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "recentlyViewed", ids)
+}
+
+// The writeJSON() helper encodes the data to JSON and writes it to the response with the given status code and any additional headers.
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any, headers http.Header) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	// Append a newline to make it easier to view in terminal applications.
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// The readJSON() helper decodes a JSON request body into dst. It limits the size of the body to 1MB,
+// rejects unknown fields and multiple JSON values, and turns the decoding errors into messages which are safe to send to the client.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		// Like in decodePostForm(), an invalid destination is a bug in our code, so we panic rather than returning the error.
+		case errors.As(err, &invalidUnmarshalError):
+			panic(err)
+		default:
+			return err
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// The pageMeta type holds per-response metadata which is sent to clients (and search engines) as HTTP headers.
+type pageMeta struct {
+	canonicalPath string
+	noIndex       bool
+}
+
+// The setPageMeta() helper writes the headers for the given page metadata. It must be called before the response is written.
+// Using headers (rather than only HTML meta tags) means the policy also applies to things like the print view or a raw download.
+func (app *application) setPageMeta(w http.ResponseWriter, r *http.Request, meta pageMeta) {
+	if meta.canonicalPath != "" {
+		w.Header().Set("Link", fmt.Sprintf("<%s://%s%s>; rel=\"canonical\"", requestScheme(r), r.Host, meta.canonicalPath))
+	}
+
+	if meta.noIndex {
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow, noarchive")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newFormRequest(t *testing.T, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestDecodePostFormLimits(t *testing.T) {
+	app := &application{formDecoder: newFormDecoder()}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{
+			name: "Valid",
+			body: "title=Hello&content=World&expires=7&visibility=public",
+		},
+		{
+			name:    "Too many fields",
+			body:    manyFields(maxFormFields + 1),
+			wantErr: true,
+		},
+		{
+			name:    "Too many values",
+			body:    strings.Repeat("title=x&", maxFormValues+1),
+			wantErr: true,
+		},
+		{
+			name:    "Long field name",
+			body:    strings.Repeat("t", maxFormKeyLength+1) + "=x",
+			wantErr: true,
+		},
+		{
+			name:    "Deeply nested",
+			body:    "a[b][c][d]=x",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid number",
+			body:    "expires=seven",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form snippetCreateForm
+			err := app.decodePostForm(newFormRequest(t, tt.body), &form)
+
+			asserts.Equal(t, err != nil, tt.wantErr)
+		})
+	}
+
+	t.Run("Huge array index", func(t *testing.T) {
+		var form struct {
+			Tags []string `form:"tags"`
+		}
+		err := app.decodePostForm(newFormRequest(t, "tags[100000]=x"), &form)
+
+		asserts.Equal(t, err != nil, true)
+		asserts.Equal(t, len(form.Tags), 0)
+	})
+}
+
+func TestDecodeAndValidate(t *testing.T) {
+	app := newTestApplication(t)
+
+	var got userLoginForm
+	handler := app.sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		form, ok := decodeAndValidate[userLoginForm](app, w, r, "login.gohtml")
+		if !ok {
+			return
+		}
+		got = form
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid",
+			body:     "email=alice%40example.com&password=pa%24%24word",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Invalid",
+			body:     "email=alice&password=",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be a valid email address",
+		},
+		{
+			name:     "Undecodable",
+			body:     "a[b][c][d]=x",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, newFormRequest(t, tt.body))
+
+			asserts.Equal(t, rr.Code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				asserts.StringContains(t, rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	asserts.Equal(t, got.Email, "alice@example.com")
+	asserts.Equal(t, got.Password, "pa$$word")
+}
+
+// manyFields returns a form body with n distinct fields.
+func manyFields(n int) string {
+	fields := make([]string, n)
+	for i := range fields {
+		fields[i] = "f" + strings.Repeat("x", i) + "=1"
+	}
+	return strings.Join(fields, "&")
+}
+
+// FuzzDecodePostForm checks that no request body makes decodePostForm panic, and that the form limits always hold for
+// the forms it accepts. Run it with: go test ./cmd/web -run=^$ -fuzz=FuzzDecodePostForm
+func FuzzDecodePostForm(f *testing.F) {
+	f.Add("title=Hello&content=World&expires=7&visibility=public")
+	f.Add("name=Bob&username=bob&email=bob%40example.com&password=pa%24%24word")
+	f.Add("expires=99999999999999999999")
+	f.Add("title[0]=x&content.inner=y")
+	f.Add("title=%zz&&=&")
+
+	app := &application{formDecoder: newFormDecoder()}
+
+	f.Fuzz(func(t *testing.T, body string) {
+		var snippetForm snippetCreateForm
+		r := newFormRequest(t, body)
+		if app.decodePostForm(r, &snippetForm) == nil && checkFormLimits(r.PostForm) != nil {
+			t.Errorf("accepted a form over the limits: %q", body)
+		}
+
+		var signupForm userSignupForm
+		app.decodePostForm(newFormRequest(t, body), &signupForm)
+
+		var settingsForm adminSettingsForm
+		app.decodePostForm(newFormRequest(t, body), &settingsForm)
+	})
+}
+
+func BenchmarkRender(b *testing.B) {
+	app := newTestApplication(b)
+
+	snippet, err := app.snippets.GetByPublicID("01HV5Q2X8N3K7M4R6T9W0Y1Z2A")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// A page of the latest snippets is about the biggest page that most visitors see.
+	snippets := make([]*models.Snippet, 10)
+	for i := range snippets {
+		snippets[i] = snippet
+	}
+
+	pages := []struct {
+		page string
+		data *templateData
+	}{
+		{page: "view.gohtml", data: &templateData{Snippet: snippet}},
+		{page: "home.gohtml", data: &templateData{Snippets: snippets}},
+	}
+
+	for _, p := range pages {
+		b.Run(p.page, func(b *testing.B) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				rr := httptest.NewRecorder()
+				app.render(rr, r, http.StatusOK, p.page, p.data)
+				if rr.Code != http.StatusOK {
+					b.Fatalf("got status %d", rr.Code)
+				}
+			}
+		})
+	}
+}
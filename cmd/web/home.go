@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"time"
+)
+
+// The names of the sections which admins can choose to show on the home page, in the order they're offered.
+const (
+	homeAnnouncement = "announcement"
+	homeCurated      = "curated"
+	homeTrending     = "trending"
+	homeLatest       = "latest"
+)
+
+var homeSectionNames = []string{homeAnnouncement, homeCurated, homeTrending, homeLatest}
+
+// How long the anonymous home page's data is cached for. Every anonymous visitor sees the same page, so there's no need
+// to run its queries for each of them. It means that a new snippet can take this long to show up.
+const homeCacheTTL = time.Minute
+
+// How far back the trending section looks for reactions.
+const trendingWindow = 7 * 24 * time.Hour
+
+// The trending snippets are cached for longer than the rest of the home page, because counting a week of reactions is
+// its most expensive query, and the order only changes slowly.
+const (
+	trendingCacheKey = "home:trending"
+	trendingCacheTTL = 5 * time.Minute
+)
+
+// The homeSection type holds the data for one section of the anonymous home page. Text is only used by the announcement,
+// and Pagination by the latest snippets.
+type homeSection struct {
+	Name       string
+	Title      string
+	Text       string
+	Snippets   []*models.Snippet
+	Pagination pagination
+}
+
+// homeSources maps the name of each home page section to the function which loads its data. The home handler calls the
+// ones for the sections that admins have chosen, so adding a new kind of section only means adding an entry here.
+var homeSources = map[string]func(app *application, site models.SiteSettings) (homeSection, error){
+	homeAnnouncement: func(app *application, site models.SiteSettings) (homeSection, error) {
+		return homeSection{Name: homeAnnouncement, Title: site.HomeAnnouncementTitle, Text: site.HomeAnnouncementText}, nil
+	},
+	homeCurated: func(app *application, site models.SiteSettings) (homeSection, error) {
+		snippets, err := app.curatedSnippets(site.HomeCurated)
+		return homeSection{Name: homeCurated, Title: "Editor's Picks", Snippets: snippets}, err
+	},
+	homeTrending: func(app *application, site models.SiteSettings) (homeSection, error) {
+		snippets, err := cached(app, trendingCacheKey, trendingCacheTTL, func() ([]*models.Snippet, error) {
+			return app.snippets.Trending(homePageSize, time.Now().Add(-trendingWindow))
+		})
+		return homeSection{Name: homeTrending, Title: "Trending Snippets", Snippets: snippets}, err
+	},
+	homeLatest: func(app *application, site models.SiteSettings) (homeSection, error) {
+		snippets, p, err := app.latestSnippets(1)
+		return homeSection{Name: homeLatest, Title: "Latest Snippets", Snippets: snippets, Pagination: p}, err
+	},
+}
+
+// curatedSnippets looks up the curated snippets. Any which have expired since they were picked, or have been deleted,
+// are left out.
+func (app *application) curatedSnippets(publicIDs []string) ([]*models.Snippet, error) {
+	snippets := []*models.Snippet{}
+
+	for _, id := range publicIDs {
+		snippet, err := app.snippets.GetByPublicID(id)
+		if errors.Is(err, models.ErrNoRecord) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if snippet.Visibility == models.VisibilityPublic {
+			snippets = append(snippets, snippet)
+		}
+	}
+
+	return snippets, nil
+}
+
+// homeCacheKey is the key that the anonymous home page's sections are cached under.
+const homeCacheKey = "home:sections"
+
+// The homePage type holds the sections of the anonymous home page, and the time they last changed, in the cache.
+type homePage struct {
+	Sections     []homeSection
+	LastModified time.Time
+}
+
+// homeSections returns the sections of the anonymous home page, along with the time they last changed, loading them if
+// they aren't in the cache. Visitors who arrive while they're being loaded wait for them, so that a burst of visitors
+// when the cache expires doesn't run the queries more than once.
+func (app *application) homeSections() ([]homeSection, time.Time, error) {
+	page, err := cached(app, homeCacheKey, homeCacheTTL, app.loadHomePage)
+	return page.Sections, page.LastModified, err
+}
+
+// loadHomePage runs the queries for the sections that admins have chosen for the anonymous home page.
+func (app *application) loadHomePage() (homePage, error) {
+	site := app.site()
+
+	// Any change to the settings counts as a change to the page, as it could have changed what the page shows.
+	sections := make([]homeSection, 0, len(site.HomeSections))
+	lastModified := site.Updated
+
+	for _, name := range site.HomeSections {
+		load, ok := homeSources[name]
+		if !ok {
+			continue
+		}
+
+		section, err := load(app, site)
+		if err != nil {
+			return homePage{}, fmt.Errorf("loading the %s home page section: %w", name, err)
+		}
+		sections = append(sections, section)
+
+		// Trending snippets can change places without anything new being created, so the page has to count as changed
+		// whenever it's loaded.
+		if name == homeTrending {
+			lastModified = time.Now()
+		}
+		for _, snippet := range section.Snippets {
+			if snippet.Created.After(lastModified) {
+				lastModified = snippet.Created
+			}
+		}
+	}
+
+	return homePage{Sections: sections, LastModified: lastModified}, nil
+}
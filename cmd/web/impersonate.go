@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"net/http"
+	"time"
+)
+
+// impersonationTTL is how long an admin can act as another user before they're switched back to their own account.
+const impersonationTTL = time.Hour
+
+// The adminImpersonateForm struct holds the username of the account that an admin wants to log in as.
+type adminImpersonateForm struct {
+	Username             string `form:"username"`
+	validators.Validator `form:"-"`
+}
+
+// The impersonatedUsername() helper returns the username of the user that an admin is logged in as, or "" if the request
+// isn't from an admin who is impersonating somebody.
+func (app *application) impersonatedUsername(r *http.Request) string {
+	if app.sessionManager.GetInt(r.Context(), "impersonatorID") == 0 {
+		return ""
+	}
+
+	user, ok := r.Context().Value(authenticatedUserContextKey).(*models.User)
+	if !ok {
+		return ""
+	}
+
+	return user.Username
+}
+
+// The stopImpersonating() helper switches the session back from the impersonated user to the admin who started
+// impersonating them, and returns the admin's ID. It returns 0 if the session isn't impersonating anybody.
+func (app *application) stopImpersonating(r *http.Request) (int, error) {
+	adminID := app.sessionManager.GetInt(r.Context(), "impersonatorID")
+	if adminID == 0 {
+		return 0, nil
+	}
+
+	targetID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// Like logging in, changing who the session belongs to gets it a new token.
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return 0, err
+	}
+
+	err = app.endImpersonation(r)
+	if err != nil {
+		return 0, err
+	}
+
+	app.sessionManager.Remove(r.Context(), "sessionSeen")
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", adminID)
+
+	app.infoLog.Printf("[%s] admin user %d stopped impersonating user %d", requestID(r), adminID, targetID)
+
+	return adminID, nil
+}
+
+// The endImpersonation() helper takes the impersonation out of the session, if there is one, and records when it
+// stopped in the audit trail. It's used wherever a session stops impersonating, including logging out.
+func (app *application) endImpersonation(r *http.Request) error {
+	if id := app.sessionManager.GetInt(r.Context(), "impersonationID"); id != 0 {
+		err := app.impersonations.Stop(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	app.sessionManager.Remove(r.Context(), "impersonatorID")
+	app.sessionManager.Remove(r.Context(), "impersonationExpiry")
+	app.sessionManager.Remove(r.Context(), "impersonationID")
+	return nil
+}
+
+func (app *application) adminImpersonate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = adminImpersonateForm{}
+
+	app.render(w, r, http.StatusOK, "admin_impersonate.gohtml", data)
+}
+
+// adminImpersonatePost logs the admin in as another user, so that they can see the site the way that user does when
+// helping them. Both IDs are kept in the session, and the admin pages are out of reach until they stop (as the session
+// belongs to a user who isn't an admin), so it can't be used to hand out admin rights. It's recorded in the
+// impersonations table and logged, every admin is alerted, and a banner on each page reminds the admin who they are.
+func (app *application) adminImpersonatePost(w http.ResponseWriter, r *http.Request) {
+	var form adminImpersonateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validators.NotBlank(form.Username), "username", "This field cannot be blank")
+
+	adminID := app.authenticatedUserID(r)
+
+	var target *models.User
+	if form.Valid() {
+		target, err = app.users.GetByUsername(form.Username)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		form.CheckField(target != nil, "username", "There is no user with this username")
+		if target != nil {
+			form.CheckField(target.ID != adminID, "username", "You can't impersonate yourself")
+			form.CheckField(!target.IsAdmin, "username", "You can't impersonate another admin")
+			form.CheckField(!target.Blocked(), "username", "You can't impersonate a user who is "+target.Status)
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "admin_impersonate.gohtml", data)
+		return
+	}
+
+	impersonationID, err := app.impersonations.Start(adminID, target.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The session isn't touched while impersonating, so it doesn't show up in the user's list of sessions.
+	app.sessionManager.Remove(r.Context(), "sessionSeen")
+	app.sessionManager.Put(r.Context(), "impersonatorID", adminID)
+	app.sessionManager.Put(r.Context(), "impersonationExpiry", time.Now().Add(impersonationTTL).Unix())
+	app.sessionManager.Put(r.Context(), "impersonationID", impersonationID)
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", target.ID)
+
+	app.infoLog.Printf("[%s] admin user %d started impersonating user %d (%s)", requestID(r), adminID, target.ID, target.Username)
+	app.securityAlert("User impersonated", fmt.Sprintf("Admin user %d logged in as user %d (%s) for up to %s.",
+		adminID, target.ID, target.Username, impersonationTTL))
+
+	app.sessionManager.Put(r.Context(), "flash", "You're now logged in as "+target.Username)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// impersonationStopPost switches an admin back to their own account. It's on the protected chain rather than the admin
+// one, because the session belongs to the impersonated user until it has run.
+func (app *application) impersonationStopPost(w http.ResponseWriter, r *http.Request) {
+	adminID, err := app.stopImpersonating(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if adminID == 0 {
+		app.notFound(w, r)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "You're logged in as yourself again")
+
+	http.Redirect(w, r, "/admin/users/impersonate", http.StatusSeeOther)
+}
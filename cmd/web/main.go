@@ -1,55 +1,158 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"flag"
+	"github.com/0xshiku/snippetbox/internal/antibot"
+	"github.com/0xshiku/snippetbox/internal/cache"
+	"github.com/0xshiku/snippetbox/internal/captcha"
+	"github.com/0xshiku/snippetbox/internal/cdn"
+	"github.com/0xshiku/snippetbox/internal/disposable"
+	"github.com/0xshiku/snippetbox/internal/emailaddr"
+	"github.com/0xshiku/snippetbox/internal/errreport"
+	"github.com/0xshiku/snippetbox/internal/federation"
+	"github.com/0xshiku/snippetbox/internal/format"
+	"github.com/0xshiku/snippetbox/internal/ids"
+	"github.com/0xshiku/snippetbox/internal/jwt"
+	"github.com/0xshiku/snippetbox/internal/lint"
+	"github.com/0xshiku/snippetbox/internal/mailer"
 	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/oidc"
+	"github.com/0xshiku/snippetbox/internal/password"
+	"github.com/0xshiku/snippetbox/internal/ratelimit"
+	"github.com/0xshiku/snippetbox/internal/slo"
+	"github.com/0xshiku/snippetbox/internal/sqltrace"
+	"github.com/0xshiku/snippetbox/internal/tracing"
+	"github.com/0xshiku/snippetbox/internal/webhooks"
+	"github.com/0xshiku/snippetbox/ui"
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	// Embed the timezone database, so that users' timezones can be loaded even on servers without one installed.
+	_ "time/tzdata"
 )
 
 // Defines an application struct to hold the application-wide dependencies for the web application.
 // For now, it will only include custom loggers
 // Also adds snippets fields to the application struct. This will allow us to make the SnippetModel object available to our handlers
 // Adds a templateCache field to the application struct
+// Adds a templateFS field, which is set in debug mode to reload the templates from disk on every render
 // Adds a formDecoder field to hold a pointer to a form.Decoder instance
 // Adds a new sessionManager field
 // Add a new users field to the application struct
+// Add emailChanges and mailer fields for the change-email flow
+// Add a config field holding the typed application configuration
+// Add passwordPolicy and breaches fields for checking new passwords
+// Add a disposable field for blocking disposable email addresses, which admins can toggle at runtime
+// Add an alerts field counting the security events which trigger emails to admins
+// Add an assets field holding the manifest of the embedded UI files, so operators can check which build is running
+// Add a formatters field holding the per-language formatters for pretty-printing structured snippets
+// Add a linter field for warning about mistakes in snippet content (nil when linting is turned off)
+// Add a purger field for removing changed pages from the CDN's cache (nil when there isn't a CDN)
+// Add a reporter field for sending server errors to Sentry (nil when errors are only logged)
+// Add a limiter field holding the rate limiter shared by the HTML and API routes (nil when rate limiting is disabled)
+// Add an oidc field for logging in with an OpenID Connect provider (nil when there isn't one)
+// Add a jwt field for signing and checking the API's short-lived access tokens (nil when there aren't any keys)
+// The reactionLimiter is a separate limit for each user on adding and removing reactions (nil when there's no limit)
+// The twoFactorLimiter limits the two-factor and recovery codes tried for each account, wherever they come from
+// Add webhooks and deliverer fields for sending signed payloads to users' webhook URLs when their snippets change
+// Add an slo field counting requests for the SLO burn rates on /metrics and the admin runbook page
+// Add sharedDrafts and collab fields for the drafts which several users can edit at once, and the ones which are open
+// Add a cache field holding the busiest pages' query results, in memory or in Redis
+// Add a tx field for running operations which span several models in one transaction
+// Add a replicas field holding the database's read replicas, for /metrics (nil when there aren't any)
+// Add a dbStats field reporting the database connection pool's usage on /metrics (nil in tests, which have no database)
+// Add a dbHealth field remembering whether the database answered its last health check
+// Add a pingDB field for /readyz to check that the database answers
+// Add a tracer field for sending OpenTelemetry traces of each request (nil when tracing isn't configured)
+// Add an accessLog field for the line written about every request, which can go to its own file
+// Add a siteSettings field for the settings that admins can change, kept in the database, like whether signups are open
+// Add an announcements field for the announcement that admins publish at the top of every page
+// Add an impersonations field for the audit trail of admins logging in as other users
+// Add a queries field timing every database query, for the per-query latencies on /metrics (nil in tests)
 type application struct {
-	debug          bool
-	errorLog       *log.Logger
-	infoLog        *log.Logger
-	snippets       models.SnippetModelInterface // Use our new interface type.
-	users          models.UserModelInterface    // Use our new interface type
-	templateCache  map[string]*template.Template
-	formDecoder    *form.Decoder
-	sessionManager *scs.SessionManager
+	config           config
+	errorLog         *log.Logger
+	infoLog          *log.Logger
+	accessLog        *log.Logger
+	snippets         models.SnippetModelInterface // Use our new interface type.
+	users            models.UserModelInterface    // Use our new interface type
+	emailChanges     models.EmailChangeModelInterface
+	tokens           models.TokenModelInterface
+	twoFactor        models.TwoFactorModelInterface
+	remotes          models.RemoteModelInterface
+	sessions         models.SessionModelInterface
+	exports          models.DataExportModelInterface
+	reactions        models.ReactionModelInterface
+	notifications    models.NotificationModelInterface
+	preferences      models.UserPreferencesModelInterface
+	siteSettings     models.SettingsModelInterface
+	announcements    models.AnnouncementModelInterface
+	impersonations   models.ImpersonationModelInterface
+	follows          models.FollowModelInterface
+	webhooks         models.WebhookModelInterface
+	sharedDrafts     models.SharedDraftModelInterface
+	tx               models.TxModelInterface
+	templateCache    map[string]*template.Template
+	templateFS       fs.FS
+	formDecoder      *form.Decoder
+	sessionManager   *scs.SessionManager
+	mailer           mailer.MailerInterface
+	limiter          *ratelimit.Limiter
+	reactionLimiter  *ratelimit.Limiter
+	twoFactorLimiter *ratelimit.Limiter
+	antibot          *antibot.Guard
+	jwt              *jwt.Signer
+	captcha          captcha.Challenge
+	oidc             oidc.Provider
+	passwordPolicy   password.Policy
+	breaches         password.BreachChecker
+	disposable       *disposable.List
+	alerts           *alertCounter
+	assets           *ui.Manifest
+	federation       federation.Pusher
+	deliverer        webhooks.Deliverer
+	purger           cdn.Purger
+	reporter         errreport.ErrorReporter
+	linter           *lint.Runner
+	formatters       *format.Registry
+	schema           models.SchemaModelInterface
+	started          time.Time
+	jobs             jobStats
+	slo              *slo.Tracker
+	collab           *collabHub
+	cache            cache.Cache
+	dbStats          func() sql.DBStats
+	replicas         *models.Replicas
+	queries          *sqltrace.Tracer
+	dbHealth         dbHealth
+	pingDB           func(ctx context.Context) error
+	tracer           *tracing.Tracer
 }
 
 func main() {
-	// Define a new command-line flag with the name 'addr', a default value of ":4000"
-	// Also present a short help text explaining wha the flag controls.
-	// The value of the flag will be stored in the addr variable at runtime
-	addr := flag.String("addr", ":4000", "HTTP network address")
-
-	// Define a new command-line flag for the MySQL DSN string.
-	dsn := flag.String("dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
-
-	// Creates a new debug flag with the default value of false
-	debug := flag.Bool("debug", false, "Enable debug mode")
-
-	// Use the flag.Parse() function to parse the command-line flag.
-	// Need to call this before the use of the addr variable, otherwise it will always contain the default value :4000
-	flag.Parse()
+	// Load the configuration from the command-line flags, environment variables and optional config file.
+	cfg, err := loadConfig(os.Args[0], os.Args[1:], os.Getenv)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		log.Fatal(err)
+	}
 
 	// Use log.New() to create a logger for writing information messages.
 	// In the last argument we use the bitwise operator OR / |
@@ -58,8 +161,46 @@ func main() {
 	// Create a logger for writing error messages in the same way, but use stderr as the destination.
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	// The access log lines have their own timestamps, so they don't get a prefix.
+	accessLog := log.New(os.Stdout, "", 0)
+
+	// Each log can go to a file of its own, which is rotated, instead of stdout or stderr.
+	for _, l := range []struct {
+		logger *log.Logger
+		path   string
+	}{{infoLog, cfg.log.file}, {errorLog, cfg.log.errorFile}, {accessLog, cfg.accessLog.file}} {
+		if l.path == "" {
+			continue
+		}
+
+		f, err := cfg.openLogFile(l.path)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		defer f.Close()
+		l.logger.SetOutput(f)
+	}
+
+	// Without a file of its own, the access log goes wherever the information messages go.
+	if cfg.accessLog.file == "" {
+		accessLog.SetOutput(infoLog.Writer())
+	}
+
+	// Every query is timed and named after the model method which ran it. The slow ones are logged without their
+	// arguments, which might be passwords or private snippets.
+	queries := sqltrace.New(cfg.db.slowQuery, func(q sqltrace.Query) {
+		infoLog.Printf("slow query %s (%s) took %s: %s", q.Name, q.Caller, q.Duration.Round(time.Millisecond), q.SQL)
+	})
+
+	// Tracing is configured with the standard OpenTelemetry environment variables, rather than flags, so that it's set up
+	// the same way as everything else sending traces to the collector.
+	tracer, err := tracing.FromEnv(os.Getenv)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
 	//openDB is a separate function to keep the main function tidy
-	db, err := openDB(*dsn)
+	db, err := openDB(cfg, queries)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
@@ -72,17 +213,88 @@ func main() {
 	// beneficial later in the future if you add a graceful shutdown to your application.
 	defer db.Close()
 
+	// Open the read replicas, if there are any. Unlike the primary, the application starts even if they're down, and
+	// keeps checking them (below).
+	var replicas *models.Replicas
+	replicasUp := 0
+	if len(cfg.db.replicas) > 0 {
+		replicaDBs := make([]*sql.DB, len(cfg.db.replicas))
+		for i, dsn := range cfg.db.replicas {
+			replicaDBs[i], err = openPool(cfg, dsn, queries)
+			if err != nil {
+				errorLog.Fatal(err)
+			}
+			defer replicaDBs[i].Close()
+		}
+
+		replicas = models.NewReplicas(replicaDBs, replicaPingTimeout)
+		replicasUp, err = replicas.Check()
+		if err != nil {
+			errorLog.Printf("%d of %d read replicas are up: %s", replicasUp, replicas.Len(), err)
+		}
+	}
+
 	// Initialize a new template cache...
 	templateCache, err := newTemplateCache()
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 
+	// Hash the embedded templates and static files. The checksum is shown in the footer, and the full manifest at /debug/assets.
+	assets, err := ui.NewManifest(ui.Files)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// In debug mode, re-read the templates from the ui directory on disk for every request, instead of using the ones
+	// embedded in the binary. If the directory isn't there (for example, when running a built binary elsewhere), carry on without.
+	var templateFS fs.FS
+	if cfg.debug {
+		_, err := os.Stat(filepath.Join(cfg.uiDir, "html", "base.gohtml"))
+		if err == nil {
+			templateFS = os.DirFS(cfg.uiDir)
+			infoLog.Printf("reloading templates from %s", cfg.uiDir)
+		} else {
+			errorLog.Printf("not reloading templates: %s", err)
+		}
+	}
+
+	// Initialize the generator for the public IDs of new snippets.
+	idGenerator, err := ids.New(cfg.ids.scheme, cfg.ids.node)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Build the password policy, which is used by every form where a user chooses a password.
+	passwordPolicy, err := cfg.passwordPolicy()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Set up the client for the CDN's purge API, if there is a CDN in front of the site.
+	purger, err := cdn.New(cfg.cdn.provider, cfg.cdn.zone, cfg.cdn.token, purgeTimeout)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Set up the client for reporting server errors to Sentry, if there's a DSN for it.
+	reporter, err := errreport.New(cfg.sentry.dsn, cfg.sentry.environment, cfg.sentry.release, reportTimeout)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Set up how email addresses are normalized, to stop people creating duplicate accounts with variations of the same address.
+	emailNormalizer := emailaddr.Normalizer{
+		Lowercase:        cfg.email.lowercase,
+		CollapseGmail:    cfg.email.collapseGmail,
+		StripPlusAliases: cfg.email.stripPlusAliases,
+	}
+
 	// Initialize a decoder instance...
-	formDecoder := form.NewDecoder()
+	formDecoder := newFormDecoder()
 
 	// Use the scs.New() function to initialize a new session manager. Then we configure it to use our MySQL database as the session store.
-	// And set a lifetime of 12 hours (so that sessions automatically expire 12 hours after first being created)
+	// And set the configured lifetime (12 hours by default, so that sessions automatically expire 12 hours after first being created)
 	sessionManager := scs.New()
 	// We can change the session cookie to use the SameSite=Strict setting instead of the default SameSite=Lax
 	// sessionManager.Cookie.SameSite = http.SameSiteStrictMode
@@ -93,25 +305,190 @@ func main() {
 	// So if your application will potentially have other websites linking to it (or even links shared in emails or private messaging services)
 	// Then SameSite=Lax is generally the more appropriate setting
 	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Lifetime = cfg.session.lifetime
 	// Makes sure that the Secure attribute is set on our session cookies.
 	// Setting this means that the cookie will only be sent by a user's web browser when a HTTPS connection is being used
 	// (and won't be sent over an unsecure HTTP connection)
 	sessionManager.Cookie.Secure = true
 
+	// The settings which admins haven't changed have the values from the configuration.
+	siteDefaults := cfg.siteDefaults()
+
+	// These models are also used together in transactions, through the tx field.
+	snippets := &models.SnippetModel{DB: db, IDs: idGenerator, Replicas: replicas}
+	users := &models.UserModel{DB: db, Emails: emailNormalizer, Passwords: cfg.passwordHashes()}
+	sharedDrafts := &models.SharedDraftModel{DB: db}
+
 	// Initialize a new instance of our application struct containing the dependencies:
 	// Initialize a models.SnippetModel instance and add it to the application dependencies.
 	// And add it to the application dependencies.
 	// Initialize a models.UserModel instance and add it to the application dependencies.
 	app := &application{
-		debug:          *debug,
+		config:         cfg,
 		errorLog:       errorLog,
 		infoLog:        infoLog,
-		snippets:       &models.SnippetModel{db},
-		users:          &models.UserModel{DB: db},
+		accessLog:      accessLog,
+		snippets:       snippets,
+		users:          users,
+		emailChanges:   &models.EmailChangeModel{DB: db},
+		tokens:         &models.TokenModel{DB: db},
+		twoFactor:      &models.TwoFactorModel{DB: db},
+		remotes:        &models.RemoteModel{DB: db},
+		sessions:       &models.SessionModel{DB: db},
+		exports:        &models.DataExportModel{DB: db},
+		reactions:      &models.ReactionModel{DB: db},
+		notifications:  &models.NotificationModel{DB: db},
+		preferences:    &models.UserPreferencesModel{DB: db},
+		siteSettings:   &models.SettingsModel{DB: db, Defaults: &siteDefaults},
+		announcements:  &models.AnnouncementModel{DB: db},
+		impersonations: &models.ImpersonationModel{DB: db},
+		follows:        &models.FollowModel{DB: db},
+		webhooks:       &models.WebhookModel{DB: db},
+		sharedDrafts:   sharedDrafts,
+		tx:             &models.TxModel{DB: db, Snippets: snippets, Users: users, SharedDrafts: sharedDrafts},
 		templateCache:  templateCache,
+		templateFS:     templateFS,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		mailer:         mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		passwordPolicy: passwordPolicy,
+		breaches:       password.NewPwnedChecker(cfg.password.breachTimeout),
+		disposable:     disposable.New(cfg.disposable.url, cfg.disposable.cacheFile),
+		alerts:         newAlertCounter(cfg.alerts.window),
+		assets:         assets,
+		federation:     federation.NewClient(federationTimeout),
+		deliverer:      webhooks.NewClient(webhookTimeout),
+		purger:         purger,
+		reporter:       reporter,
+		formatters:     format.New(),
+		schema:         &models.SchemaModel{DB: db},
+		started:        time.Now(),
+		slo:            newSLOTracker(cfg),
+		collab:         newCollabHub(),
+		cache:          cache.NewMemory(cfg.queryCache.size),
+		dbStats:        db.Stats,
+		replicas:       replicas,
+		queries:        queries,
+		pingDB:         db.PingContext,
+		tracer:         tracer,
+	}
+
+	// With a Redis server, the servers behind a load balancer share one cache, rather than each keeping their own.
+	if cfg.queryCache.redisAddr != "" {
+		app.cache = cache.NewRedis(cfg.queryCache.redisAddr, cfg.queryCache.redisPassword, cfg.queryCache.redisDB, "snippetbox:", cfg.queryCache.timeout)
+	}
+
+	if cfg.lint.enabled {
+		app.linter = lint.New()
+	}
+
+	app.publishExpvars()
+
+	if tracer != nil {
+		app.background(func() {
+			tracer.Run(func(err error) {
+				errorLog.Print(err)
+			})
+		})
+	}
+
+	// Keep checking that the database is up, so that requests can be turned away quickly while it isn't.
+	app.background(func() {
+		app.monitorDatabase(db.PingContext)
+	})
+
+	// Keep checking the read replicas, so that the ones which were down are used again once they're back. Queries stop
+	// using a replica as soon as they can't reach it, so this only logs when the number which are up changes.
+	if replicas != nil {
+		app.background(func() {
+			for {
+				time.Sleep(cfg.db.replicaInterval)
+
+				up, err := replicas.Check()
+				if up != replicasUp {
+					if err != nil {
+						errorLog.Printf("%d of %d read replicas are up: %s", up, replicas.Len(), err)
+					} else {
+						infoLog.Printf("all %d read replicas are up", up)
+					}
+				}
+				replicasUp = up
+			}
+		})
+	}
+
+	// Keep the disposable email domain list up to date in the background. If a refresh fails, the list
+	// carries on using the last good copy (from the cache file, or built in to the binary).
+	if cfg.disposable.url != "" {
+		app.background(func() {
+			for {
+				err := app.disposable.Refresh()
+				if err != nil {
+					errorLog.Printf("refreshing disposable email domains: %s", err)
+				}
+				time.Sleep(cfg.disposable.refresh)
+			}
+		})
+	}
+
+	// Warn and delete expired guest accounts in the background. This runs even if guest accounts have been turned off since,
+	// so that the ones which were already created still expire.
+	app.background(func() {
+		for {
+			app.expireGuests()
+			time.Sleep(cfg.guest.interval)
+		}
+	})
+
+	// Purge snippets which have been in the trash for longer than the retention period in the background.
+	app.background(func() {
+		for {
+			app.emptyTrash()
+			time.Sleep(cfg.trash.interval)
+		}
+	})
+
+	// Initialize the rate limiter. The same limiter is used for every route, so a client can't get around
+	// the limit by switching between the HTML pages and the API.
+	if cfg.ratelimit.enabled {
+		app.limiter = ratelimit.New(cfg.ratelimit.requests, cfg.ratelimit.window)
+	}
+
+	if cfg.reactions.requests > 0 {
+		app.reactionLimiter = ratelimit.New(cfg.reactions.requests, cfg.reactions.window)
+	}
+
+	// The shared limiter goes by IP address, so it doesn't stop somebody with the password guessing codes from lots
+	// of addresses. This one goes by account.
+	app.twoFactorLimiter = ratelimit.New(twoFactorAttempts, twoFactorAttemptWindow)
+
+	// Protect the signup and snippet forms from spam bots.
+	guard, randomKey, err := newAntibotGuard(cfg)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	if randomKey {
+		infoLog.Print("no -antibot-key set, so using a random one: forms shown before a restart will be refused after it")
+	}
+	app.antibot = guard
+
+	// Issue JWT access tokens from the API, if there are keys to sign them with.
+	if len(cfg.jwt.keys) > 0 {
+		app.jwt = jwt.New(cfg.jwt.keys)
+	}
+
+	// Add a CAPTCHA to the signup form, if a service has been chosen.
+	if cfg.captcha.provider != "" {
+		app.captcha, err = captcha.New(cfg.captcha.provider, cfg.captcha.siteKey, cfg.captcha.secret, cfg.captcha.timeout)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// Let users log in with an OpenID Connect provider, if one has been set up. The provider isn't contacted until
+	// somebody tries to log in with it.
+	if cfg.oidc.issuer != "" {
+		app.oidc = oidc.New(cfg.oidc.issuer, cfg.oidc.clientID, cfg.oidc.clientSecret, cfg.oidc.timeout)
 	}
 
 	// Initialize a tls.Config struct to hold the non-default TLS settings we want the server to use.
@@ -121,33 +498,68 @@ func main() {
 		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
 	}
 
+	// In autocert mode, certificates are obtained (and renewed) from Let's Encrypt on demand, for the allowed hosts only.
+	// The certificates are cached on disk, so that restarting the application doesn't hit the Let's Encrypt rate limits.
+	if cfg.autocert.enabled {
+		certManager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.autocert.hosts...),
+			Cache:      autocert.DirCache(cfg.autocert.cacheDir),
+			Email:      cfg.autocert.email,
+		}
+
+		tlsConfig.GetCertificate = certManager.GetCertificate
+		// Allow the TLS-ALPN-01 challenge, which is answered on the HTTPS port itself.
+		tlsConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+
+		// If configured, also listen on a plain HTTP address. This answers HTTP-01 challenges, and redirects everything else to HTTPS.
+		if cfg.autocert.httpAddr != "" {
+			go func() {
+				httpSrv := &http.Server{
+					Addr:         cfg.autocert.httpAddr,
+					ErrorLog:     errorLog,
+					Handler:      certManager.HTTPHandler(nil),
+					IdleTimeout:  cfg.timeouts.idle,
+					ReadTimeout:  cfg.timeouts.read,
+					WriteTimeout: cfg.timeouts.write,
+				}
+				infoLog.Printf("Starting ACME HTTP challenge server on %s", cfg.autocert.httpAddr)
+				errorLog.Fatal(httpSrv.ListenAndServe())
+			}()
+		}
+	}
+
 	// Initialize a new http.Server struct. We set the Addr and Handler fields so that the server use the same network address and routes as before
 	// Set the ErrorLog field so that the server now uses the custom errorLog logger in the event of any problems.
 	// Set the server's TLSConfig field to use the tlsConfig variable we just created
 	srv := &http.Server{
-		Addr:      *addr,
+		Addr:      cfg.addr,
 		ErrorLog:  errorLog,
 		Handler:   app.routes(),
 		TLSConfig: tlsConfig,
 		// Add Idle, Read and Write timeouts to the server.
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  cfg.timeouts.idle,
+		ReadTimeout:  cfg.timeouts.read,
+		WriteTimeout: cfg.timeouts.write,
 	}
 
-	// The value returned from the flag.String() function is a pointer to the flag value, not the value itself.
-	// So we need to dereference the pointer (prefix it with the * symbol) before using it.
-	infoLog.Printf("Starting server on %s", *addr)
+	infoLog.Printf("Starting server on %s", cfg.addr)
 	// Use the ListenAndServeTLS() method to start the HTTPS server.
 	// We pass in the paths to the TLS certificate and corresponding private key as the two parameters.
-	// To install certificates locally we can run: go run /usr/local/go/src/crypto/tls/generate_cert.go --rsa-bits=2048 --host=localhost
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
+	// In autocert mode the certificates come from tlsConfig.GetCertificate instead, so we pass empty paths.
+	if cfg.autocert.enabled {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServeTLS(cfg.tls.certFile, cfg.tls.keyFile)
+	}
 	errorLog.Fatal(err)
 }
 
-func openDB(dsn string) (*sql.DB, error) {
-	// The sql.Open() function initializes a new sql.DB object, which is essentially a pool of database connection
-	db, err := sql.Open("mysql", dsn)
+// How long a read replica has to answer a ping to count as up.
+const replicaPingTimeout = 2 * time.Second
+
+func openDB(cfg config, queries *sqltrace.Tracer) (*sql.DB, error) {
+	db, err := openPool(cfg, cfg.dsn, queries)
 	if err != nil {
 		return nil, err
 	}
@@ -159,3 +571,27 @@ func openDB(dsn string) (*sql.DB, error) {
 	}
 	return db, nil
 }
+
+// openPool sets up a connection pool for the database, with the configured limits and the queries timed by the tracer.
+// It doesn't connect to it yet.
+func openPool(cfg config, dsn string, queries *sqltrace.Tracer) (*sql.DB, error) {
+	mysqlCfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(mysqlCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sql.OpenDB() function initializes a new sql.DB object, which is essentially a pool of database connection
+	db := sql.OpenDB(queries.Connector(connector))
+	// Size the pool to fit the database server's limits. Without a maximum, a burst of requests could open more connections
+	// than MySQL allows, and then every request would fail rather than wait its turn.
+	db.SetMaxOpenConns(cfg.db.maxOpenConns)
+	db.SetMaxIdleConns(cfg.db.maxIdleConns)
+	db.SetConnMaxLifetime(cfg.db.connMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.db.connMaxIdleTime)
+
+	return db, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// maintenanceRetryAfter is how long visitors are told to wait before trying again in maintenance mode.
+const maintenanceRetryAfter = 5 * time.Minute
+
+// The maintenancePaths still work for everybody in maintenance mode, so that admins can log in (and anybody can log out).
+var maintenancePaths = []string{
+	"/user/login",
+	"/user/login/2fa",
+	"/user/login/recovery",
+	"/user/login/oidc",
+	"/user/login/oidc/callback",
+	"/user/logout",
+}
+
+// maintenanceFileExists reports whether the maintenance file is there, which puts every server that can see it into
+// maintenance mode. It's checked on each request, so that creating or removing the file takes effect straight away.
+func (app *application) maintenanceFileExists() bool {
+	if app.config.maintenance.file == "" {
+		return false
+	}
+
+	_, err := os.Stat(app.config.maintenance.file)
+	return err == nil
+}
+
+// inMaintenance reports whether the site is in maintenance mode, because an admin turned it on (or the configuration
+// did, and no admin has turned it off) or because the maintenance file exists.
+func (app *application) inMaintenance() bool {
+	return app.site().Maintenance || app.maintenanceFileExists()
+}
+
+// The maintenance middleware shows everybody except admins a 503 "down for maintenance" page in maintenance mode, apart
+// from on the login pages. It comes after authenticate, so that it knows who's an admin. An admin who is impersonating
+// somebody is let through as well, so that they can stop.
+func (app *application) maintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.inMaintenance() || slices.Contains(maintenancePaths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if user := authenticatedUser(r); user != nil && (user.IsAdmin || app.impersonatedUsername(r) != "") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+
+		data := app.newErrorTemplateData(r)
+		data.RequestID = requestID(r)
+		app.renderError(w, http.StatusServiceUnavailable, "maintenance.gohtml", data, http.StatusText(http.StatusServiceUnavailable))
+	})
+}
+
+// The maintenanceAPI middleware is maintenance for the JSON API, which is unavailable to everybody in maintenance mode.
+func (app *application) maintenanceAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.inMaintenance() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+		app.apiClientError(w, r, http.StatusServiceUnavailable, "the service is down for maintenance")
+	})
+}
+
+// adminMaintenancePost turns maintenance mode on or off. It's one of the site settings, so it applies to every server,
+// although the others can take a minute to notice.
+func (app *application) adminMaintenancePost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		Enabled bool `form:"enabled"`
+	}
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	err = app.siteSettings.SetMaintenance(form.Enabled, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.dropSiteCache(r)
+
+	if form.Enabled {
+		app.infoLog.Printf("[%s] admin user %d turned maintenance mode on", requestID(r), userID)
+		app.securityAlert("Maintenance mode on", fmt.Sprintf("Admin user %d put the site into maintenance mode. Only admins can use it until it's turned off.", userID))
+		app.sessionManager.Put(r.Context(), "flash", "Maintenance mode is on")
+	} else {
+		app.infoLog.Printf("[%s] admin user %d turned maintenance mode off", requestID(r), userID)
+		app.securityAlert("Maintenance mode off", fmt.Sprintf("Admin user %d took the site out of maintenance mode.", userID))
+		app.sessionManager.Put(r.Context(), "flash", "Maintenance mode is off")
+	}
+
+	http.Redirect(w, r, "/admin/settings", http.StatusSeeOther)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/slo"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The classes of route that requests are counted in for the SLO burn rates. Each class gets its own series, so there are
+// only a few of them, rather than one for every route.
+const (
+	routeClassPages  = "pages"
+	routeClassAPI    = "api"
+	routeClassAdmin  = "admin"
+	routeClassStatic = "static"
+)
+
+var routeClasses = []string{routeClassPages, routeClassAPI, routeClassAdmin, routeClassStatic}
+
+// routeClass returns the class of route that a request is counted in, or "" if it isn't counted at all. Scrapes of
+// /metrics and the health probes aren't counted, so that they don't change the numbers they report, and neither are the
+// WebSockets for shared drafts, which stay open for as long as somebody is editing, or the profiles, which take as long
+// as they're asked to.
+func routeClass(path string) string {
+	switch {
+	case path == "/metrics", path == "/healthz", path == "/readyz", strings.HasPrefix(path, "/draft/ws/"), strings.HasPrefix(path, "/debug/pprof/"):
+		return ""
+	case strings.HasPrefix(path, "/static/"):
+		return routeClassStatic
+	case strings.HasPrefix(path, "/api/"):
+		return routeClassAPI
+	case strings.HasPrefix(path, "/admin/"):
+		return routeClassAdmin
+	default:
+		return routeClassPages
+	}
+}
+
+// The statusRecorder type wraps a http.ResponseWriter to remember the status code of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter, for flushing and deadlines.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// measureSLO counts every request, along with whether it failed and how long it took, for the SLO burn rates. It comes
+// before recoverPanic, so that a panic is counted as the 500 response that it turns into.
+func (app *application) measureSLO(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := routeClass(r.URL.Path)
+		if class == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		// A handler which doesn't write anything sends an empty 200 response.
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		app.slo.Record(class, rec.status, time.Since(start))
+	})
+}
+
+// metrics reports request counts, SLO burn rates and the database connection pool's usage in the Prometheus text format. If -metrics-token is set, it has to
+// be given as a bearer token.
+func (app *application) metrics(w http.ResponseWriter, r *http.Request) {
+	if token := app.config.metrics.token; token != "" {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.clientError(w, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := app.slo.Snapshot().WritePrometheus(w)
+	if err == nil && app.dbStats != nil {
+		err = writeDBStats(w, app.dbStats())
+	}
+	if err == nil {
+		up := 1
+		if app.dbHealth.Down() {
+			up = 0
+		}
+		_, err = fmt.Fprintf(w, "# HELP snippetbox_db_up Whether the database answered its last health check.\n# TYPE snippetbox_db_up gauge\nsnippetbox_db_up %d\n", up)
+	}
+	if err == nil {
+		err = writeDBRetries(w, models.Retries())
+	}
+	if err == nil && app.queries != nil {
+		err = app.queries.Snapshot().WritePrometheus(w)
+	}
+	if err == nil && app.replicas != nil {
+		up := app.replicas.Up()
+		_, err = fmt.Fprintf(w, "# HELP snippetbox_db_replicas Read replicas, by whether they're up.\n# TYPE snippetbox_db_replicas gauge\n"+
+			"snippetbox_db_replicas{state=%q} %d\nsnippetbox_db_replicas{state=%q} %d\n", "up", up, "down", app.replicas.Len()-up)
+	}
+	if err != nil {
+		app.errorLog.Printf("[%s] writing metrics: %s", requestID(r), err)
+	}
+}
+
+// writeDBStats writes the database connection pool's statistics in the Prometheus text format. Connections which are
+// always in use, or requests which often have to wait for one, mean that -db-max-open-conns is too low.
+func writeDBStats(w io.Writer, stats sql.DBStats) error {
+	var out []byte
+
+	metric := func(name, kind, help string) {
+		out = fmt.Appendf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("snippetbox_db_max_open_connections", "gauge", "The maximum number of open database connections, or 0 for no limit.")
+	out = fmt.Appendf(out, "snippetbox_db_max_open_connections %d\n", stats.MaxOpenConnections)
+
+	metric("snippetbox_db_connections", "gauge", "Open database connections, by whether they're in use or idle.")
+	out = fmt.Appendf(out, "snippetbox_db_connections{state=%q} %d\n", "in_use", stats.InUse)
+	out = fmt.Appendf(out, "snippetbox_db_connections{state=%q} %d\n", "idle", stats.Idle)
+
+	metric("snippetbox_db_waits_total", "counter", "Times that a request had to wait for a database connection.")
+	out = fmt.Appendf(out, "snippetbox_db_waits_total %d\n", stats.WaitCount)
+
+	metric("snippetbox_db_wait_seconds_total", "counter", "Time spent waiting for database connections.")
+	out = fmt.Appendf(out, "snippetbox_db_wait_seconds_total %s\n", strconv.FormatFloat(stats.WaitDuration.Seconds(), 'g', -1, 64))
+
+	metric("snippetbox_db_connections_closed_total", "counter", "Database connections closed by the pool, by the limit which closed them.")
+	out = fmt.Appendf(out, "snippetbox_db_connections_closed_total{reason=%q} %d\n", "max_idle_conns", stats.MaxIdleClosed)
+	out = fmt.Appendf(out, "snippetbox_db_connections_closed_total{reason=%q} %d\n", "max_idle_time", stats.MaxIdleTimeClosed)
+	out = fmt.Appendf(out, "snippetbox_db_connections_closed_total{reason=%q} %d\n", "max_lifetime", stats.MaxLifetimeClosed)
+
+	_, err := w.Write(out)
+	return err
+}
+
+// writeDBRetries writes the counts of database operations which were tried again after a transient error.
+func writeDBRetries(w io.Writer, stats models.RetryStats) error {
+	var out []byte
+
+	metric := func(name, kind, help string) {
+		out = fmt.Appendf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("snippetbox_db_retries_total", "counter", "Database operations tried again after a transient error, by the error.")
+	for _, reason := range models.RetryReasons {
+		out = fmt.Appendf(out, "snippetbox_db_retries_total{reason=%q} %d\n", reason, stats.Retries[reason])
+	}
+
+	metric("snippetbox_db_retries_exhausted_total", "counter", "Database operations which still failed with a transient error after the last attempt.")
+	out = fmt.Appendf(out, "snippetbox_db_retries_exhausted_total %d\n", stats.Exhausted)
+
+	_, err := w.Write(out)
+	return err
+}
+
+// newSLOTracker returns the tracker for the configured objectives, with every class of route registered.
+func newSLOTracker(cfg config) *slo.Tracker {
+	return slo.New(slo.Objectives{
+		Availability:     cfg.slo.availability,
+		Latency:          cfg.slo.latency,
+		LatencyThreshold: cfg.slo.latencyThreshold,
+	}, routeClasses...)
+}
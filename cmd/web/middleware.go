@@ -2,26 +2,67 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"github.com/0xshiku/snippetbox/internal/ids"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/ratelimit"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/justinas/nosurf"
 )
 
-func secureHeaders(next http.Handler) http.Handler {
+// newCSPNonce returns a random, base64 encoded value for the Content-Security-Policy script-src nonce.
+func newCSPNonce() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// The secureHeaders middleware sets the security headers on every response. The policies come from the configuration.
+func (app *application) secureHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Note: This is split across multiple lines for readability.
+		// Generate a fresh nonce for every request. Inline <script> tags with a matching nonce attribute are allowed to run,
+		// which lets us use small inline scripts without allowing 'unsafe-inline' (and so any injected script) as well.
+		nonce, err := newCSPNonce()
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), cspNonceContextKey, nonce))
+
 		// Content-Security-Policy (CSP) headers are used to restrict where the resources for your web page (e.g. Javascript, images, fonts etc) can be loaded from.
 		// Setting a strict CSP policy helps prevent a variety of cross-site scripting, clickjacking, and other code-injection attacks.
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
+		w.Header().Set("Content-Security-Policy", app.config.contentSecurityPolicy(nonce))
 		// Referrer-Policy is used to control what information is included in a Referer header when a user navigates away from your web page.
-		// We will set the value to origin-when-cross-origin, which means that the full URL will be included for same-origin requests.
+		// The default of origin-when-cross-origin means that the full URL will be included for same-origin requests.
 		// But for all other requests information like the URL path and any query string values will be stripped out
-		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
+		w.Header().Set("Referrer-Policy", app.config.headers.referrerPolicy)
+		// Strict-Transport-Security tells browsers to only ever connect to the site over HTTPS.
+		// Browsers ignore it on plain HTTP responses, so it's only sent over HTTPS.
+		if hsts := app.config.strictTransportSecurity(); hsts != "" && requestScheme(r) == "https" {
+			w.Header().Set("Strict-Transport-Security", hsts)
+		}
 		// X-Content-Type-Options: nosniff instructs browsers to not MIME-type sniff the content-type of the response, which in turn helps to prevent content-sniffing attacks.
 		w.Header().Set("X-Content-Type-Options", "nosniff")
-		// X-Frame-Options: deny is used to help prevent clickjacking attacks in older browsers that don't support CSP headers
-		w.Header().Set("X-Frame-Options", "deny")
+		// X-Frame-Options is used to help prevent clickjacking attacks in older browsers that don't support CSP headers
+		if app.config.headers.frameOptions != "" {
+			w.Header().Set("X-Frame-Options", app.config.headers.frameOptions)
+		}
 		// X-XSS-Protection: 0 is used to disable the blocking of cross-site scripting attacks
 		// Previously it was good practice to set this header to X-XSS-Protection 1; mode=block
 		// But when you're using CSP headers like we are, the recommendation is to disable this feature altogether
@@ -31,13 +72,87 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) logRequest(next http.Handler) http.Handler {
+// requestIDRX matches the request IDs we accept from a trusted proxy. They end up in our logs, so we don't allow spaces
+// or control characters which could be used to fake log lines.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// The setRequestID middleware gives every request an ID, and returns it in the X-Request-ID response header. If a trusted
+// proxy has already given the request an ID, we use that one, so that the proxy's logs and ours can be matched up.
+// It comes first in the middleware chain, so that the ID is available to everything after it (including recoverPanic).
+func (app *application) setRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || !requestIDRX.MatchString(id) || !app.isTrustedProxy(clientIP(r)) {
+			var err error
+			id, err = ids.ULID{}.New()
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// The trustedProxy middleware replaces the client address and scheme with the ones reported in the X-Forwarded-For and
+// X-Forwarded-Proto headers, but only for requests which come straight from a trusted proxy. Otherwise anybody could set
+// the headers to get around the rate limiter. It runs before the other middleware, so logging, rate limiting and
+// HSTS all see the real client.
+func (app *application) trustedProxy(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
+		if !app.isTrustedProxy(clientIP(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Each proxy appends the address it received the request from, so the client is the right-most address which
+		// isn't one of our own proxies. The port of the original connection isn't known, so RemoteAddr is just the IP.
+		forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+			if err != nil {
+				break
+			}
+
+			r.RemoteAddr = addr.Unmap().String()
+			if !app.isTrustedProxy(r.RemoteAddr) {
+				break
+			}
+		}
+
+		// If there's more than one X-Forwarded-Proto header, the last one was set by the proxy closest to us.
+		if values := r.Header.Values("X-Forwarded-Proto"); len(values) > 0 {
+			scheme := strings.ToLower(strings.TrimSpace(values[len(values)-1]))
+			if scheme == "http" || scheme == "https" {
+				r = r.WithContext(context.WithValue(r.Context(), forwardedSchemeContextKey, scheme))
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// isTrustedProxy reports whether the IP address belongs to one of the trusted proxies in the configuration.
+func (app *application) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range app.config.proxy.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Create a deferred function (which will always be run in the event of a panic as Go unwinds the stack)
@@ -51,8 +166,8 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 				// So it is not malformed, and send a GOAWAY frame.
 				w.Header().Set("Connection", "close")
 				// Call the app.serverError helper method to return a 500
-				// Internal server response
-				app.serverError(w, fmt.Errorf("%s", err))
+				// Internal server response. The panicError type marks it as a panic when it's reported.
+				app.serverError(w, r, panicError{value: err})
 			}
 		}()
 
@@ -69,10 +184,34 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 			return
 		}
 
-		// Otherwise set the "Cache-Control: no-store" header so that pages require authentication are not stored in the users browser cache (or other intermediary cache)
-		w.Header().Add("Cache-Control", "no-store")
+		// Users who logged in with a recovery code must set up two-factor authentication again before doing anything else.
+		// The flag is on their account (loaded by the authenticate middleware), so it applies however they logged in.
+		if mustEnrollTwoFactor(r) && !strings.HasPrefix(r.URL.Path, "/account/2fa") && r.URL.Path != "/user/logout" {
+			http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+			return
+		}
+
+		// Otherwise call the next handler in the chain. The cacheControl middleware has already made sure that pages which
+		// require authentication are not stored in the users browser cache (or other intermediary cache).
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireAdmin middleware only lets admins through. It must come after requireAuthentication.
+// Everybody else gets a 404 Not Found response, so that the admin pages aren't advertised.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := app.users.Get(app.authenticatedUserID(r))
+		if err != nil {
+			app.modelError(w, r, err)
+			return
+		}
+
+		if !user.IsAdmin {
+			app.notFound(w, r)
+			return
+		}
 
-		// And call the next handler in the chain
 		next.ServeHTTP(w, r)
 	})
 }
@@ -80,6 +219,9 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 func noSurf(next http.Handler) http.Handler {
 	// Creates a NoSurf middleware function which uses a customized CSRF cookie with the Secure, Path and HttpOnly attributes set
 	csrfHandler := nosurf.New(next)
+	// Dismissing an announcement is harmless, and its form is on pages which are cached for anonymous visitors, so it
+	// can't have a token (see announcementDismissPost).
+	csrfHandler.ExemptPath("/announcement/dismiss")
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
 		Path:     "/",
@@ -100,22 +242,285 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Impersonation only lasts for so long, after which the admin is switched back to their own account.
+		impersonating := app.sessionManager.GetInt(r.Context(), "impersonatorID") != 0
+		if impersonating && time.Now().Unix() > app.sessionManager.GetInt64(r.Context(), "impersonationExpiry") {
+			adminID, err := app.stopImpersonating(r)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			app.sessionManager.Put(r.Context(), "flash", "You've stopped impersonating, because it has been more than "+impersonationTTL.String())
+			id, impersonating = adminID, false
+		}
+
 		// Otherwise, we check to see if a user with that ID exists in our database.
-		exists, err := app.users.Exists(id)
-		if err != nil {
-			app.serverError(w, err)
+		// We fetch the whole record rather than just checking it exists, because the pages need the user's date preferences.
+		user, err := app.users.Get(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
 			return
 		}
 
+		// If an admin has suspended or banned the user since they logged in, log them out now. The session token is renewed,
+		// as it is when logging out normally, and the request carries on as an anonymous one, so protected pages send them
+		// to the login form, which tells them why they can't log back in.
+		if user != nil && user.Blocked() {
+			err = app.sessionManager.RenewToken(r.Context())
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+			err = app.endImpersonation(r)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			app.sessionManager.Put(r.Context(), "flash", "You've been logged out, because your account has been "+user.Status)
+			app.infoLog.Printf("[%s] logged out %s user %d", requestID(r), user.Status, id)
+
+			user = nil
+		}
+
 		// If a matching user is found, we know that the request is coming from an authenticated user who exists in our database.
 		// We create a new copy of the request (with an isAuthenticatedContextKey value of true in the request context)
 		// and assign it to r.
-		if exists {
+		if user != nil {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, authenticatedUserIDContextKey, id)
+			ctx = context.WithValue(ctx, authenticatedUserContextKey, user)
 			r = r.WithContext(ctx)
+
+			// Keep the user's list of sessions up to date. An admin's session doesn't belong in the list of the user
+			// they're impersonating.
+			if !impersonating {
+				app.touchSession(r, id)
+			}
 		}
 
 		// Call the next handler in the chain
 		next.ServeHTTP(w, r)
 	})
 }
+
+// The authenticateToken middleware authenticates API requests which carry an "Authorization: Bearer <token>" header.
+// The token can be an opaque API token or, if there are signing keys, a JWT access token from POST /api/v1/tokens.
+// Requests without the header are passed through unchanged, so the session-based authenticate middleware can still apply.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// A header which is present but malformed or invalid is always an error, rather than silently falling back to the session.
+		scheme, token, ok := strings.Cut(authorizationHeader, " ")
+		if !ok || scheme != "Bearer" || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.apiClientError(w, r, http.StatusUnauthorized, "invalid or missing authentication token")
+			return
+		}
+
+		id, err := app.tokenUserID(token)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				app.apiClientError(w, r, http.StatusUnauthorized, "invalid or missing authentication token")
+			} else {
+				app.apiModelError(w, r, err)
+			}
+			return
+		}
+
+		// Tokens are kept when an account is suspended, so that they work again if the suspension is lifted, but they
+		// can't be used in the meantime.
+		user, err := app.users.Get(id)
+		if err != nil {
+			app.apiModelError(w, r, err)
+			return
+		}
+		if user.Blocked() {
+			app.apiClientError(w, r, http.StatusForbidden, "your account has been "+user.Status)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, authenticatedUserIDContextKey, id)
+		ctx = context.WithValue(ctx, authenticatedUserContextKey, user)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *application) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// API clients can't follow a redirect to the login page, so send a 401 JSON response instead.
+		if !app.isAuthenticated(r) {
+			app.apiClientError(w, r, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+
+		// The same goes for the API as for the HTML pages: a user who logged in with a recovery code can't use it until
+		// they've set up two-factor authentication again.
+		if mustEnrollTwoFactor(r) {
+			app.apiClientError(w, r, http.StatusForbidden, "you must set up two-factor authentication again before using the API")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireJSONRequest middleware rejects any unsafe request which doesn't have a JSON (or JSON Lines) body.
+// API routes don't use the noSurf middleware, but browsers won't send a cross-origin request with an application/json
+// content type without a successful CORS preflight, so this stops HTML forms on other sites from posting to the API.
+// The same goes for application/x-ndjson, which the import endpoint uses.
+func requireJSONRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || (mediaType != "application/json" && mediaType != "application/x-ndjson") {
+				writeProblem(w, r, http.StatusUnsupportedMediaType, "the request body must be JSON", nil)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitBody stops reading request bodies after n bytes. It has to come before noSurf for uploads, because noSurf reads
+// the whole form looking for the CSRF token.
+func limitBody(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the IP address of the client, which is used as the key for rate limiting.
+// Behind a trusted proxy, the trustedProxy middleware has already replaced RemoteAddr with the real client's address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfterSeconds rounds the time until the rate limit resets up to whole seconds, as used by the Retry-After header.
+func retryAfterSeconds(result ratelimit.Result) int {
+	return int(math.Ceil(result.Reset.Seconds()))
+}
+
+// The rateLimitPages middleware applies the shared rate limit to HTML routes. Rather than a bare 429 response,
+// clients over the limit get a friendly page explaining how long to wait.
+func (app *application) rateLimitPages(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := app.limiter.Allow(clientIP(r))
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(result)))
+			// The "slow down" page is only for this client, so a CDN mustn't show it to everybody else.
+			w.Header().Set("Cache-Control", "no-store")
+
+			data := app.newTemplateData(r)
+			data.RetryAfter = retryAfterSeconds(result)
+			app.render(w, r, http.StatusTooManyRequests, "ratelimit.gohtml", data)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The rateLimitAPI middleware applies the same rate limit to API routes. Every response includes the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, so well-behaved clients can pace themselves.
+func (app *application) rateLimitAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := app.limiter.Allow(clientIP(r))
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(retryAfterSeconds(result)))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(result)))
+			app.apiClientError(w, r, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded, retry in %d seconds", retryAfterSeconds(result)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The cachePolicy type names one of the configured Cache-Control policies. Each group of routes picks its policy with the
+// cacheControl middleware, so that handlers don't need to set the header themselves.
+type cachePolicy int
+
+const (
+	// cachePublic is for pages that anybody can see. Anonymous visitors get the configured public policy, and logged-in
+	// users get "private, no-cache", because the page shows their name and CSRF token.
+	cachePublic cachePolicy = iota
+	// cachePrivate is for pages which need authentication, and the API.
+	cachePrivate
+	// cacheAssets is for static files.
+	cacheAssets
+)
+
+// The cacheControl middleware sets the Cache-Control header for a group of routes. Handlers can still replace it, like
+// serverError does, so that an error page is never cached. An empty policy in the config leaves the header out.
+func (app *application) cacheControl(policy cachePolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if value := app.cacheHeader(policy, r); value != "" {
+				w.Header().Set("Cache-Control", value)
+			}
+
+			// Public pages differ between anonymous visitors and logged-in users, so caches have to keep them apart.
+			if policy == cachePublic {
+				w.Header().Add("Vary", "Cookie")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// cacheHeader returns the Cache-Control header for a request under the given policy.
+func (app *application) cacheHeader(policy cachePolicy, r *http.Request) string {
+	switch policy {
+	case cachePrivate:
+		return app.config.cache.private
+	case cacheAssets:
+		// Static file URLs don't change when the files do, so only a request for the current build can be cached for long.
+		if app.assets != nil && r.URL.Query().Get("v") == app.assets.ShortChecksum() {
+			return app.config.cache.assets
+		}
+		return "no-cache"
+	default:
+		if app.isAuthenticated(r) {
+			return "private, no-cache"
+		}
+		return app.config.cache.public
+	}
+}
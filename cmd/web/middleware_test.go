@@ -2,14 +2,28 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"github.com/0xshiku/snippetbox/internal/asserts"
+	"github.com/0xshiku/snippetbox/internal/ratelimit"
+	"github.com/0xshiku/snippetbox/internal/tracing"
+	"github.com/julienschmidt/httprouter"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSecureHeaders(t *testing.T) {
+	// The middleware uses the default configuration from the test application.
+	app := newTestApplication(t)
+
 	// Initialize a new httptest.ResponseRecorder and dummy http.Request
 	rr := httptest.NewRecorder()
 
@@ -25,17 +39,20 @@ func TestSecureHeaders(t *testing.T) {
 
 	// Pass the mock HTTP handler to our secureHeaders middleware. Because secureHeaders *returns* a http.Handler we can call its ServerHTTP()
 	// method, passing in the http.ResponseRecorder and dummy http.Request to execute it.
-	secureHeaders(next).ServeHTTP(rr, r)
+	app.secureHeaders(next).ServeHTTP(rr, r)
 
 	// Call the Result() method on the http.ResponseRecorder to get the results of the test.
 	rs := rr.Result()
 
 	// Check that the middleware has correctly set the Content-Security-Policy header on the response
-	expectedValue := "default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com"
-	asserts.Equal(t, rs.Header.Get("Content-Security-Policy"), expectedValue)
+	// The script-src nonce is random, so check the header against a pattern.
+	cspRX := regexp.MustCompile(`^default-src 'self'; script-src 'self' 'nonce-[A-Za-z0-9_-]{22}'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com$`)
+	if csp := rs.Header.Get("Content-Security-Policy"); !cspRX.MatchString(csp) {
+		t.Errorf("got Content-Security-Policy %q; want a nonce", csp)
+	}
 
 	// Check that the middleware has correctly set the Referrer-Policy header on the response
-	expectedValue = "origin-when-cross-origin"
+	expectedValue := "origin-when-cross-origin"
 	asserts.Equal(t, rs.Header.Get("Referrer-Policy"), expectedValue)
 
 	// Check that the middleware has correctly set the X-Content-Type-Options header on the response
@@ -50,6 +67,9 @@ func TestSecureHeaders(t *testing.T) {
 	expectedValue = "0"
 	asserts.Equal(t, rs.Header.Get("X-XSS-Protection"), expectedValue)
 
+	// HSTS is off by default
+	asserts.Equal(t, rs.Header.Get("Strict-Transport-Security"), "")
+
 	// Check that the middleware has correctly called the next handler in line and the response status code and body are as expected
 	asserts.Equal(t, rs.StatusCode, http.StatusOK)
 
@@ -62,3 +82,531 @@ func TestSecureHeaders(t *testing.T) {
 
 	asserts.Equal(t, string(body), "OK")
 }
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Pages", func(t *testing.T) {
+		app.limiter = ratelimit.New(1, time.Minute)
+
+		code, _, _ := ts.get(t, "/about")
+		asserts.Equal(t, code, http.StatusOK)
+
+		code, headers, body := ts.get(t, "/about")
+		asserts.Equal(t, code, http.StatusTooManyRequests)
+		asserts.Equal(t, headers.Get("Retry-After"), "60")
+		asserts.StringContains(t, body, "Please wait 60 seconds")
+	})
+
+	t.Run("API", func(t *testing.T) {
+		app.limiter = ratelimit.New(1, time.Minute)
+
+		code, headers, _ := ts.postJSON(t, "/api/v1/pair", `{"code": "WRONGCODE"}`)
+		asserts.Equal(t, code, http.StatusUnauthorized)
+		asserts.Equal(t, headers.Get("RateLimit-Limit"), "1")
+		asserts.Equal(t, headers.Get("RateLimit-Remaining"), "0")
+		asserts.Equal(t, headers.Get("RateLimit-Reset"), "60")
+
+		code, headers, body := ts.postJSON(t, "/api/v1/pair", `{"code": "ABCDEFGH"}`)
+		asserts.Equal(t, code, http.StatusTooManyRequests)
+		asserts.Equal(t, headers.Get("Retry-After"), "60")
+		asserts.StringContains(t, body, "rate limit exceeded")
+	})
+}
+
+func TestSecureHeadersConfigured(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.headers.cspScriptSrc = ""
+	app.config.headers.cspImgSrc = "'self' data:"
+	app.config.headers.referrerPolicy = "no-referrer"
+	app.config.headers.hstsMaxAge = 365 * 24 * time.Hour
+	app.config.headers.hstsIncludeSubdomains = true
+	app.config.headers.hstsPreload = true
+	app.config.headers.frameOptions = ""
+
+	rr := httptest.NewRecorder()
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HSTS is only sent over HTTPS.
+	r.TLS = &tls.ConnectionState{}
+
+	app.secureHeaders(http.NotFoundHandler()).ServeHTTP(rr, r)
+	rs := rr.Result()
+
+	// An empty script-src still gets the nonce, and the img-src directive is added.
+	cspRX := regexp.MustCompile(`^default-src 'self'; script-src 'nonce-[A-Za-z0-9_-]{22}'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com; img-src 'self' data:$`)
+	if csp := rs.Header.Get("Content-Security-Policy"); !cspRX.MatchString(csp) {
+		t.Errorf("got Content-Security-Policy %q", csp)
+	}
+
+	asserts.Equal(t, rs.Header.Get("Referrer-Policy"), "no-referrer")
+	asserts.Equal(t, rs.Header.Get("Strict-Transport-Security"), "max-age=31536000; includeSubDomains; preload")
+	asserts.Equal(t, rs.Header.Get("X-Frame-Options"), "")
+}
+
+func TestTrustedProxy(t *testing.T) {
+	app := newTestApplication(t)
+	cfg, err := loadConfig("web", []string{"-proxy-trusted", "10.0.0.0/8, 192.0.2.1"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.config = cfg
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   []string
+		forwardedProto string
+		wantIP         string
+		wantScheme     string
+	}{
+		{
+			name:       "No headers",
+			remoteAddr: "10.0.0.1:1234",
+			wantIP:     "10.0.0.1",
+			wantScheme: "http",
+		},
+		{
+			name:           "Trusted proxy",
+			remoteAddr:     "192.0.2.1:1234",
+			forwardedFor:   []string{"203.0.113.7"},
+			forwardedProto: "https",
+			wantIP:         "203.0.113.7",
+			wantScheme:     "https",
+		},
+		{
+			name:         "Chain of proxies",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"198.51.100.1, 203.0.113.7", "10.0.0.2"},
+			wantIP:       "203.0.113.7",
+			wantScheme:   "http",
+		},
+		{
+			name:         "Malformed address",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"203.0.113.7, not-an-ip"},
+			wantIP:       "10.0.0.1",
+			wantScheme:   "http",
+		},
+		{
+			name:           "Untrusted client",
+			remoteAddr:     "203.0.113.9:1234",
+			forwardedFor:   []string{"198.51.100.1"},
+			forwardedProto: "https",
+			wantIP:         "203.0.113.9",
+			wantScheme:     "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.forwardedProto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+
+			var gotIP, gotScheme string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotIP = clientIP(r)
+				gotScheme = requestScheme(r)
+			})
+
+			app.trustedProxy(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			asserts.Equal(t, gotIP, tt.wantIP)
+			asserts.Equal(t, gotScheme, tt.wantScheme)
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app := newTestApplication(t)
+	cfg, err := loadConfig("web", []string{"-proxy-trusted", "192.0.2.1"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.config = cfg
+
+	ulidRX := regexp.MustCompile(`^[0-9A-Z]{26}$`)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		wantID     string
+	}{
+		{
+			name:       "Generated",
+			remoteAddr: "203.0.113.7:1234",
+		},
+		{
+			name:       "From a trusted proxy",
+			remoteAddr: "192.0.2.1:1234",
+			header:     "nginx-4f2a9c",
+			wantID:     "nginx-4f2a9c",
+		},
+		{
+			name:       "From an untrusted client",
+			remoteAddr: "203.0.113.7:1234",
+			header:     "spoofed",
+		},
+		{
+			name:       "Invalid ID from a trusted proxy",
+			remoteAddr: "192.0.2.1:1234",
+			header:     "bad id\nfake log line",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+
+			// The handler fails, so that we can check the ID is in the error response too.
+			var contextID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = requestID(r)
+				app.serverError(w, r, errors.New("something went wrong"))
+			})
+
+			rr := httptest.NewRecorder()
+			app.setRequestID(next).ServeHTTP(rr, r)
+			rs := rr.Result()
+
+			id := rs.Header.Get("X-Request-ID")
+			if tt.wantID != "" {
+				asserts.Equal(t, id, tt.wantID)
+			} else if !ulidRX.MatchString(id) {
+				t.Errorf("got request ID %q; want a new ULID", id)
+			}
+			asserts.Equal(t, contextID, id)
+			asserts.StringContains(t, rr.Body.String(), "quote this request ID: <code>"+id+"</code>")
+		})
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	app := newTestApplication(t)
+
+	var buf bytes.Buffer
+	app.accessLog = log.New(&buf, "", 0)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Hello, world"))
+	})
+
+	tests := []struct {
+		format string
+		want   *regexp.Regexp
+	}{
+		{
+			format: accessLogCommon,
+			want:   regexp.MustCompile(`^203\.0\.113\.7 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /snippet/view/1\?page=2 HTTP/1\.1" 201 12\n$`),
+		},
+		{
+			format: accessLogCombined,
+			want:   regexp.MustCompile(`^203\.0\.113\.7 - - \[.+\] "GET /snippet/view/1\?page=2 HTTP/1\.1" 201 12 "https://example\.com/" "test \\"agent\\""\n$`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			buf.Reset()
+			app.config.accessLog.format = tt.format
+
+			r := httptest.NewRequest(http.MethodGet, "/snippet/view/1?page=2", nil)
+			r.RemoteAddr = "203.0.113.7:1234"
+			r.Header.Set("Referer", "https://example.com/")
+			r.Header.Set("User-Agent", `test "agent"`)
+
+			app.logRequest(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			if !tt.want.MatchString(buf.String()) {
+				t.Errorf("got: %q; want a line matching %s", buf.String(), tt.want)
+			}
+		})
+	}
+
+	t.Run(accessLogJSON, func(t *testing.T) {
+		buf.Reset()
+		app.config.accessLog.format = accessLogJSON
+
+		r := httptest.NewRequest(http.MethodHead, "/", nil)
+		empty := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		app.setRequestID(app.logRequest(empty)).ServeHTTP(httptest.NewRecorder(), r)
+
+		var entry accessLogEntry
+		err := json.Unmarshal(buf.Bytes(), &entry)
+		asserts.NilError(t, err)
+
+		asserts.Equal(t, entry.Method, http.MethodHead)
+		asserts.Equal(t, entry.URI, "/")
+		asserts.Equal(t, entry.Status, http.StatusOK)
+		asserts.Equal(t, entry.Bytes, int64(0))
+		asserts.Equal(t, entry.RemoteAddr, "192.0.2.1:1234")
+		if entry.RequestID == "" {
+			t.Error("the entry has no request ID")
+		}
+	})
+}
+
+func TestCSPNonce(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The nonce in the header should match the one on the page's inline script, and change with every request.
+	nonceRX := regexp.MustCompile(`'nonce-([^']+)'`)
+
+	_, headers, body := ts.get(t, "/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A")
+	matches := nonceRX.FindStringSubmatch(headers.Get("Content-Security-Policy"))
+	if len(matches) < 2 {
+		t.Fatal("no nonce found in Content-Security-Policy header")
+	}
+	asserts.StringContains(t, body, `<script nonce="`+matches[1]+`">`)
+
+	_, headers, _ = ts.get(t, "/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A")
+	if strings.Contains(headers.Get("Content-Security-Policy"), matches[1]) {
+		t.Error("got the same nonce for two requests")
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.cache.public = "public, s-maxage=60"
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	checksum := app.assets.ShortChecksum()
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantCache string
+		wantVary  bool
+	}{
+		{
+			name:      "Public page",
+			urlPath:   "/",
+			wantCache: "public, s-maxage=60",
+			wantVary:  true,
+		},
+		{
+			name:      "Not found",
+			urlPath:   "/missing",
+			wantCache: "public, s-maxage=60",
+			wantVary:  true,
+		},
+		{
+			name:      "Authenticated page",
+			urlPath:   "/account/view",
+			wantCache: "no-store",
+		},
+		{
+			name:      "API",
+			urlPath:   "/api/v1/snippets/export",
+			wantCache: "no-store",
+		},
+		{
+			name:      "Versioned asset",
+			urlPath:   "/static/css/main.css?v=" + checksum,
+			wantCache: "public, max-age=31536000, immutable",
+		},
+		{
+			name:      "Asset from an old build",
+			urlPath:   "/static/css/main.css?v=000000000000",
+			wantCache: "no-cache",
+		},
+		{
+			name:      "Unversioned asset",
+			urlPath:   "/static/css/main.css",
+			wantCache: "no-cache",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, headers, _ := ts.get(t, tt.urlPath)
+
+			asserts.Equal(t, headers.Get("Cache-Control"), tt.wantCache)
+			if tt.wantVary {
+				asserts.StringContains(t, headers.Get("Vary"), "Cookie")
+			}
+		})
+	}
+
+	t.Run("Logged in", func(t *testing.T) {
+		c := ts.newClient(t)
+		c.mustLogin(t, "alice@example.com", "pa$$word")
+
+		_, headers, body := c.get(t, "/")
+		asserts.Equal(t, headers.Get("Cache-Control"), "private, no-cache")
+
+		// The page links to the static files for the current build.
+		asserts.StringContains(t, body, "/static/css/main.css?v="+checksum)
+
+		_, headers, _ = c.get(t, "/account/view")
+		asserts.Equal(t, headers.Get("Cache-Control"), "no-store")
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, _, _ := ts.get(t, "/metrics")
+		asserts.Equal(t, code, http.StatusNotFound)
+	})
+
+	app := newTestApplication(t)
+	app.config.metrics.enabled = true
+	app.config.metrics.token = "scrape-token"
+	app.dbStats = func() sql.DBStats {
+		return sql.DBStats{MaxOpenConnections: 25, InUse: 3, Idle: 2, WaitCount: 4, WaitDuration: 1500 * time.Millisecond}
+	}
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// A page, an API request without authentication, and a static file. The 401 from the API isn't a server error.
+	ts.get(t, "/")
+	ts.postJSON(t, "/api/v1/quick", `{}`)
+	ts.get(t, "/static/css/main.css")
+
+	// A panic is counted as the 500 response it turns into.
+	panicking := app.measureSLO(app.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})))
+	r, err := http.NewRequest(http.MethodGet, "/admin/settings", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	panicking.ServeHTTP(httptest.NewRecorder(), r)
+
+	t.Run("Without token", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/metrics")
+		asserts.Equal(t, code, http.StatusUnauthorized)
+		asserts.Equal(t, header.Get("WWW-Authenticate"), "Bearer")
+	})
+
+	t.Run("With token", func(t *testing.T) {
+		code, header, body := ts.getWithHeaders(t, "/metrics", http.Header{"Authorization": {"Bearer scrape-token"}})
+		asserts.Equal(t, code, http.StatusOK)
+		asserts.StringContains(t, header.Get("Content-Type"), "text/plain; version=0.0.4")
+
+		asserts.StringContains(t, body, `snippetbox_requests_total{class="pages"} 1`+"\n")
+		asserts.StringContains(t, body, `snippetbox_requests_total{class="api"} 1`+"\n")
+		asserts.StringContains(t, body, `snippetbox_requests_total{class="static"} 1`+"\n")
+		asserts.StringContains(t, body, `snippetbox_request_errors_total{class="api"} 0`+"\n")
+		asserts.StringContains(t, body, `snippetbox_request_errors_total{class="admin"} 1`+"\n")
+		asserts.StringContains(t, body, `snippetbox_slo_error_ratio{class="admin",slo="availability",window="5m"} 1`+"\n")
+
+		asserts.StringContains(t, body, "snippetbox_db_max_open_connections 25\n")
+		asserts.StringContains(t, body, `snippetbox_db_connections{state="in_use"} 3`+"\n")
+		asserts.StringContains(t, body, `snippetbox_db_connections{state="idle"} 2`+"\n")
+		asserts.StringContains(t, body, "snippetbox_db_waits_total 4\n")
+		asserts.StringContains(t, body, "snippetbox_db_wait_seconds_total 1.5\n")
+		asserts.StringContains(t, body, `snippetbox_db_retries_total{reason="deadlock"} 0`+"\n")
+	})
+}
+
+func TestTraceRequests(t *testing.T) {
+	type span struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+	}
+	var spans []span
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		spans = append(spans, req.ResourceSpans[0].ScopeSpans[0].Spans...)
+	}))
+	defer collector.Close()
+
+	app := newTestApplication(t)
+	tracer, err := tracing.FromEnv(func(name string) string {
+		if name == "OTEL_EXPORTER_OTLP_ENDPOINT" {
+			return collector.URL
+		}
+		return ""
+	})
+	asserts.NilError(t, err)
+	app.tracer = tracer
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	code, _, _ := ts.getWithHeaders(t, "/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A", header)
+	asserts.Equal(t, code, http.StatusOK)
+
+	// Neither the metrics nor the probes are traced.
+	ts.get(t, "/healthz")
+
+	asserts.NilError(t, tracer.Flush())
+
+	asserts.Equal(t, len(spans), 2)
+	asserts.Equal(t, spans[0].Name, "render view.gohtml")
+	asserts.Equal(t, spans[1].Name, "GET /snippet/view/:id")
+	asserts.Equal(t, spans[1].TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	asserts.Equal(t, spans[1].ParentSpanID, "00f067aa0ba902b7")
+	asserts.Equal(t, spans[0].TraceID, spans[1].TraceID)
+	asserts.Equal(t, spans[0].ParentSpanID, spans[1].SpanID)
+}
+
+func TestRoutePattern(t *testing.T) {
+	app := newTestApplication(t)
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, "/snippet/view/:id", app.snippetView)
+	router.HandlerFunc(http.MethodGet, "/users/:username/:tab", app.snippetView)
+	router.HandlerFunc(http.MethodGet, "/static/*filepath", app.snippetView)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A", want: "/snippet/view/:id"},
+		{path: "/users/users/users", want: "/users/:username/:tab"},
+		{path: "/static/css/main.css", want: "/static/*filepath"},
+		{path: "/missing", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			asserts.Equal(t, routePattern(router, r), tt.want)
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// How many notifications the notifications page shows. Older ones are still counted in the unread badge until they're
+// marked as read.
+const notificationsPageSize = 50
+
+// How long the unsubscribe link in a notification email keeps working.
+const unsubscribeTokenTTL = 365 * 24 * time.Hour
+
+// The notificationKind type describes a kind of notification on the notification settings page. Every kind has to be
+// listed here for users to be able to get emails about it.
+type notificationKind struct {
+	Kind  string
+	Label string
+}
+
+var notificationKinds = []notificationKind{
+	{Kind: models.NotificationReaction, Label: "When somebody reacts to one of my snippets"},
+}
+
+// findNotificationKind looks up one of the notificationKinds.
+func findNotificationKind(kind string) (notificationKind, bool) {
+	for _, k := range notificationKinds {
+		if k.Kind == kind {
+			return k, true
+		}
+	}
+	return notificationKind{}, false
+}
+
+// The notificationEmailData type is passed to the notification email template.
+type notificationEmailData struct {
+	Name           string
+	ActorName      string
+	Emoji          string
+	SnippetTitle   string
+	SnippetURL     string
+	UnsubscribeURL string
+}
+
+// notify tells the owner of a snippet that another user did something to it, and emails them about it if they've asked
+// for that. Snippets without an owner, and users acting on their own snippets, don't cause notifications. Errors are
+// logged rather than failing the request, because the notification is only a side effect of what the user did.
+func (app *application) notify(r *http.Request, snippet *models.Snippet, actorID int, kind, detail string) {
+	if snippet.UserID == 0 || snippet.UserID == actorID {
+		return
+	}
+
+	inserted, err := app.notifications.Insert(snippet.UserID, actorID, snippet.ID, kind, detail)
+	if err != nil {
+		app.errorLog.Printf("[%s] recording %s notification for user %d: %s", requestID(r), kind, snippet.UserID, err)
+		return
+	}
+
+	// Don't send another email when the same thing happens again, like a reaction being taken away and left again.
+	if !inserted {
+		return
+	}
+
+	// The links in the email go back to the host that the request came to, like the email change confirmation does.
+	baseURL := fmt.Sprintf("%s://%s", requestScheme(r), r.Host)
+	notification := &models.Notification{Kind: kind, Detail: detail}
+
+	app.background(func() {
+		err := app.emailNotification(snippet, actorID, notification, baseURL)
+		if err != nil {
+			app.errorLog.Printf("emailing %s notification to user %d: %s", kind, snippet.UserID, err)
+		}
+	})
+}
+
+// emailNotification sends the owner of a snippet an email about a new notification, if they get emails about that kind
+// of notification. It's called by notify in a background goroutine, so that a slow SMTP server doesn't hold up the
+// response.
+func (app *application) emailNotification(snippet *models.Snippet, actorID int, notification *models.Notification, baseURL string) error {
+	kinds, err := app.preferences.EmailKinds(snippet.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(kinds, notification.Kind) {
+		return nil
+	}
+
+	owner, err := app.users.Get(snippet.UserID)
+	if err != nil {
+		return err
+	}
+
+	actor, err := app.users.Get(actorID)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.tokens.New(owner.ID, unsubscribeTokenTTL, models.ScopeUnsubscribe)
+	if err != nil {
+		return err
+	}
+
+	data := notificationEmailData{
+		Name:           owner.Name,
+		ActorName:      actor.Name,
+		Emoji:          notification.Emoji(),
+		SnippetTitle:   snippet.Title,
+		SnippetURL:     baseURL + "/snippet/view/" + snippet.PublicID,
+		UnsubscribeURL: baseURL + "/unsubscribe?" + url.Values{"token": {token.Plaintext}, "kind": {notification.Kind}}.Encode(),
+	}
+
+	return app.mailer.Send(owner.Email, "notification.gohtml", data)
+}
+
+// unreadNotifications returns how many unread notifications the authenticated user has, for the badge in the navigation
+// bar. It's 0 for anonymous requests, and if the count can't be loaded (which is logged, rather than failing the page).
+func (app *application) unreadNotifications(r *http.Request) int {
+	userID := app.authenticatedUserID(r)
+	if userID == 0 {
+		return 0
+	}
+
+	count, err := app.notifications.Unread(userID)
+	if err != nil {
+		app.errorLog.Printf("[%s] counting notifications: %s", requestID(r), err)
+		return 0
+	}
+
+	return count
+}
+
+// notificationsView lists the user's most recent notifications, with the unread ones highlighted.
+func (app *application) notificationsView(w http.ResponseWriter, r *http.Request) {
+	notifications, err := app.notifications.Latest(app.authenticatedUserID(r), notificationsPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Notifications = notifications
+
+	app.render(w, r, http.StatusOK, "notifications.gohtml", data)
+}
+
+// notificationsReadPost marks one of the user's notifications as read, if the form has its ID, or else all of them.
+func (app *application) notificationsReadPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	if value := r.PostForm.Get("id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		err = app.notifications.MarkRead(userID, id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	} else {
+		err = app.notifications.MarkAllRead(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", "All your notifications have been marked as read")
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// Create a new notificationSettingsForm struct. Email holds the kinds of notification that the user wants emails about.
+type notificationSettingsForm struct {
+	Email                []string `form:"email"`
+	validators.Validator `form:"-"`
+}
+
+// Emails reports whether the form has the given kind of notification ticked, for the template's checkboxes.
+func (form notificationSettingsForm) Emails(kind string) bool {
+	return slices.Contains(form.Email, kind)
+}
+
+// accountNotifications shows which kinds of notification the user gets emails about.
+func (app *application) accountNotifications(w http.ResponseWriter, r *http.Request) {
+	kinds, err := app.preferences.EmailKinds(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = notificationSettingsForm{Email: kinds}
+	data.NotificationKinds = notificationKinds
+
+	app.render(w, r, http.StatusOK, "notification_settings.gohtml", data)
+}
+
+// accountNotificationsPost saves which kinds of notification the user gets emails about. Kinds that we don't know about
+// are dropped, so a form from an older version of the page can't store anything unexpected.
+func (app *application) accountNotificationsPost(w http.ResponseWriter, r *http.Request) {
+	var form notificationSettingsForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	kinds := []string{}
+	for _, k := range notificationKinds {
+		if form.Emails(k.Kind) {
+			kinds = append(kinds, k.Kind)
+		}
+	}
+
+	err = app.preferences.SetEmailKinds(app.authenticatedUserID(r), kinds)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your notification settings have been saved")
+
+	http.Redirect(w, r, "/account/notifications", http.StatusSeeOther)
+}
+
+// The unsubscribeData type holds what the unsubscribe page needs. Action is where its form posts to, which is the same
+// URL as the link in the email.
+type unsubscribeData struct {
+	Label  string
+	Action string
+	Done   bool
+}
+
+// unsubscribeRequest looks up the user and kind of notification named by an unsubscribe link. If the link isn't valid,
+// the error response has already been sent and it returns ok as false.
+func (app *application) unsubscribeRequest(w http.ResponseWriter, r *http.Request) (userID int, data unsubscribeData, ok bool) {
+	query := r.URL.Query()
+	token, kind := query.Get("token"), query.Get("kind")
+
+	k, known := findNotificationKind(kind)
+	if token == "" || !known {
+		app.notFound(w, r)
+		return 0, data, false
+	}
+
+	userID, err := app.tokens.GetUserID(models.ScopeUnsubscribe, token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return 0, data, false
+	}
+
+	data = unsubscribeData{
+		Label:  k.Label,
+		Action: "/unsubscribe?" + url.Values{"token": {token}, "kind": {kind}}.Encode(),
+	}
+
+	return userID, data, true
+}
+
+// unsubscribe asks the user to confirm that they want to stop getting emails about one kind of notification. It
+// doesn't unsubscribe them straight away, because some email security scanners visit every link in an email.
+func (app *application) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	_, unsubscribe, ok := app.unsubscribeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Unsubscribe = unsubscribe
+
+	app.render(w, r, http.StatusOK, "unsubscribe.gohtml", data)
+}
+
+// unsubscribePost stops the user getting emails about one kind of notification. Mail clients which support one-click
+// unsubscribe (RFC 8058) POST to this URL themselves, without a CSRF token, so the route doesn't check for one: the
+// token in the URL proves that the request came from the email.
+func (app *application) unsubscribePost(w http.ResponseWriter, r *http.Request) {
+	userID, unsubscribe, ok := app.unsubscribeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.preferences.Unsubscribe(userID, r.URL.Query().Get("kind"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.infoLog.Printf("[%s] user %d unsubscribed from %s emails", requestID(r), userID, r.URL.Query().Get("kind"))
+
+	data := app.newTemplateData(r)
+	unsubscribe.Done = true
+	data.Unsubscribe = unsubscribe
+
+	app.render(w, r, http.StatusOK, "unsubscribe.gohtml", data)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/oidc"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// oidcName returns the name of the OpenID Connect provider for the login button, or "" if there isn't one.
+func (app *application) oidcName() string {
+	if app.oidc == nil {
+		return ""
+	}
+	return app.config.oidc.name
+}
+
+// oidcRedirectURL returns the URL that the provider sends users back to. It has to be registered with the provider.
+func oidcRedirectURL(r *http.Request) string {
+	return requestScheme(r) + "://" + r.Host + "/user/login/oidc/callback"
+}
+
+// oidcLoginFailed sends the user back to the login page, with a flash message saying why they weren't logged in.
+func (app *application) oidcLoginFailed(w http.ResponseWriter, r *http.Request, message string) {
+	app.sessionManager.Put(r.Context(), "flash", message)
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// The userLoginOIDC handler sends the user to the provider to log in. The state, nonce and PKCE verifier are kept in the
+// session, so that the callback can check that the user who comes back is the one who was sent, with a fresh ID token.
+func (app *application) userLoginOIDC(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.Random()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := app.oidc.AuthURL(r.Context(), oidcRedirectURL(r), state, nonce, verifier)
+	if err != nil {
+		app.errorLog.Printf("[%s] starting OpenID Connect login: %s", requestID(r), err)
+		app.oidcLoginFailed(w, r, fmt.Sprintf("We couldn't reach %s. Please try again in a few minutes", app.config.oidc.name))
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "oidcState", state)
+	app.sessionManager.Put(r.Context(), "oidcNonce", nonce)
+	app.sessionManager.Put(r.Context(), "oidcVerifier", verifier)
+
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// The userLoginOIDCCallback handler is where the provider sends the user back to, with a code to swap for their ID token.
+// The user is matched to an account by their email address, which the provider has to have verified, and an account is
+// made for them if there isn't one (and -oidc-signup is on, and the address is at one of the allowed domains). Two-factor authentication still applies, like it does
+// after a password.
+func (app *application) userLoginOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	// Each login attempt can only come back once.
+	state := app.sessionManager.PopString(r.Context(), "oidcState")
+	nonce := app.sessionManager.PopString(r.Context(), "oidcNonce")
+	verifier := app.sessionManager.PopString(r.Context(), "oidcVerifier")
+
+	query := r.URL.Query()
+	if state == "" || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The provider sends an error instead of a code if the user cancelled, or isn't allowed to use this site.
+	if providerErr := query.Get("error"); providerErr != "" {
+		if providerErr != "access_denied" {
+			app.errorLog.Printf("[%s] OpenID Connect login: %s: %s", requestID(r), providerErr, query.Get("error_description"))
+		}
+		app.oidcLoginFailed(w, r, fmt.Sprintf("You weren't logged in with %s", app.config.oidc.name))
+		return
+	}
+
+	claims, err := app.oidc.Exchange(r.Context(), oidcRedirectURL(r), query.Get("code"), verifier, nonce)
+	if err != nil {
+		app.errorLog.Printf("[%s] finishing OpenID Connect login: %s", requestID(r), err)
+		app.oidcLoginFailed(w, r, fmt.Sprintf("We couldn't log you in with %s. Please try again", app.config.oidc.name))
+		return
+	}
+
+	// Without a verified address, anybody who could set their email at the provider could take over an account here.
+	if claims.Email == "" || !claims.EmailVerified {
+		app.oidcLoginFailed(w, r, fmt.Sprintf("%s didn't give us a verified email address, so we couldn't log you in", app.config.oidc.name))
+		return
+	}
+
+	user, err := app.users.GetByEmail(claims.Email)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if !app.config.oidc.signup || !app.site().SignupEnabled {
+			app.oidcLoginFailed(w, r, "There isn't an account for "+claims.Email+". Please ask an admin to make one for you")
+			return
+		}
+		if !app.isAllowedEmail(claims.Email) {
+			app.oidcLoginFailed(w, r, app.allowedDomainsMessage())
+			return
+		}
+
+		id, err := app.insertOIDCUser(claims)
+		if err != nil {
+			if errors.Is(err, models.ErrDuplicateEmail) || errors.Is(err, models.ErrDuplicateUsername) {
+				app.oidcLoginFailed(w, r, "We couldn't make an account for you. Please try again")
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		// A brand new account can't have two-factor authentication turned on yet.
+		err = app.logIn(r, id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.redirectAfterLogin(w, r)
+		return
+	}
+
+	switch user.Status {
+	case models.UserStatusSuspended:
+		app.oidcLoginFailed(w, r, "Your account has been suspended. Please contact an admin if you think this is a mistake")
+		return
+	case models.UserStatusBanned:
+		app.oidcLoginFailed(w, r, "Your account has been banned")
+		return
+	}
+
+	app.completeLogin(w, r, user.ID)
+}
+
+// notUsernameRX matches the characters which aren't allowed in usernames.
+var notUsernameRX = regexp.MustCompile("[^a-zA-Z0-9_-]+")
+
+// insertOIDCUser makes an account for somebody logging in with the provider for the first time, and returns its ID. The
+// username comes from their preferred username at the provider, or their email address, with a number added if it's
+// already taken.
+func (app *application) insertOIDCUser(claims *oidc.Claims) (int, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Trim(notUsernameRX.ReplaceAllString(base, "-"), "-")
+	if len(base) > 25 {
+		base = base[:25]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	username := base
+	for n := 2; ; n++ {
+		taken, err := app.users.UsernameTaken(username, 0)
+		if err != nil {
+			return 0, err
+		}
+		if !taken {
+			break
+		}
+		if n > 100 {
+			return 0, models.ErrDuplicateUsername
+		}
+		username = base + "-" + strconv.Itoa(n)
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = username
+	}
+
+	return app.users.InsertExternal(name, username, claims.Email)
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/interchange"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The apiOperation type documents one of the API's routes, for the OpenAPI document and the docs page. Request and
+// Response are values of the types that the handler reads and writes, so the schemas in the document come from the
+// same struct tags, and can't drift from what the API actually does. A nil Request means there isn't a request body.
+type apiOperation struct {
+	Method       string
+	Path         string
+	Summary      string
+	Description  string
+	Public       bool
+	Params       []apiParam
+	Request      any
+	RequestType  string
+	Example      string
+	Status       int
+	Response     any
+	ResponseType string
+	ErrorType    string
+}
+
+// The apiParam type documents a path, query or header parameter. Type is the JSON schema type, like "string".
+type apiParam struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Type        string
+}
+
+// The snippet ID path parameter, which several operations share.
+var snippetIDParam = apiParam{Name: "id", In: "path", Description: "The snippet's ID, from its URL", Required: true, Type: "string"}
+
+// apiOperations lists every route in the JSON API, in the order they're shown on the docs page. Paths use {name} for
+// parameters, as OpenAPI does, instead of httprouter's :name. TestOpenAPI checks that each of them is routed.
+var apiOperations = []apiOperation{
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/quick",
+		Summary:     "Create a snippet",
+		Description: "Only the content is required. The title defaults to the detected language, and the snippet expires after 7 days.",
+		Request:     quickInput{},
+		Example:     `{"content": "SELECT 1;", "expires": 7, "visibility": "unlisted"}`,
+		Status:      http.StatusCreated,
+		Response: struct {
+			URL string `json:"url"`
+		}{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/snippets",
+		Summary:     "List your snippets",
+		Description: "A page of your unexpired snippets, without their content. The Link header has the first, prev, next and last pages.",
+		Params: []apiParam{
+			{Name: "page", In: "query", Description: "Page number, from 1", Type: "integer"},
+			{Name: "page_size", In: "query", Description: fmt.Sprintf("Snippets on each page, up to %d (default %d)", maxPageSize, defaultPageSize), Type: "integer"},
+			{Name: "sort", In: "query", Description: "created, expires or title, with a - in front to reverse the order (default -created)", Type: "string"},
+			{Name: "created_after", In: "query", Description: "Only snippets created after this time, in RFC 3339 format", Type: "string"},
+		},
+		Status: http.StatusOK,
+		Response: struct {
+			Snippets []apiSnippet `json:"snippets"`
+			Metadata listMetadata `json:"metadata"`
+		}{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/snippet/{id}",
+		Summary:     "Get a snippet",
+		Description: "Any unexpired snippet, including unlisted ones, with its content.",
+		Params:      []apiParam{snippetIDParam},
+		Status:      http.StatusOK,
+		Response: struct {
+			Snippet apiSnippet `json:"snippet"`
+		}{},
+	},
+	{
+		Method:       http.MethodGet,
+		Path:         "/api/v1/snippets/export",
+		Summary:      "Export your snippets",
+		Description:  "Your unexpired snippets in the JSON Lines interchange format, one snippet on each line.",
+		Status:       http.StatusOK,
+		Response:     interchange.Snippet{},
+		ResponseType: "application/x-ndjson",
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/snippets/import",
+		Summary:     "Import snippets",
+		Description: "Adds the snippets in a JSON Lines body to your account. Invalid lines and expired snippets are skipped.",
+		Request:     interchange.Snippet{},
+		RequestType: "application/x-ndjson",
+		Example:     `{"v":1,"title":"Hello","content":"Hello, world","created":"2024-01-01T00:00:00Z","expires":"2030-01-01T00:00:00Z"}`,
+		Status:      http.StatusOK,
+		Response:    importResult{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/v1/me/preferences",
+		Summary:  "Get your preferences",
+		Status:   http.StatusOK,
+		Response: apiPreferences{},
+	},
+	{
+		Method:      http.MethodPatch,
+		Path:        "/api/v1/me/preferences",
+		Summary:     "Change your preferences",
+		Description: "Fields which are left out keep their current values. If-Match must be the ETag from getting the preferences.",
+		Params:      []apiParam{{Name: "If-Match", In: "header", Description: "The ETag of the preferences being changed", Required: true, Type: "string"}},
+		Request:     preferencesInput{},
+		Example:     `{"timezone": "Europe/London"}`,
+		Status:      http.StatusOK,
+		Response:    apiPreferences{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/reactions/{id}",
+		Summary: "Get a snippet's reactions",
+		Params:  []apiParam{snippetIDParam},
+		Status:  http.StatusOK,
+		Response: struct {
+			Reactions []apiReaction `json:"reactions"`
+		}{},
+	},
+	{
+		Method:  http.MethodPut,
+		Path:    "/api/v1/reactions/{id}/{name}",
+		Summary: "React to a snippet",
+		Params: []apiParam{
+			snippetIDParam,
+			{Name: "name", In: "path", Description: "The name of the reaction", Required: true, Type: "string"},
+		},
+		Status: http.StatusOK,
+		Response: struct {
+			Reactions []apiReaction `json:"reactions"`
+		}{},
+	},
+	{
+		Method:  http.MethodDelete,
+		Path:    "/api/v1/reactions/{id}/{name}",
+		Summary: "Take back a reaction",
+		Params: []apiParam{
+			snippetIDParam,
+			{Name: "name", In: "path", Description: "The name of the reaction", Required: true, Type: "string"},
+		},
+		Status: http.StatusOK,
+		Response: struct {
+			Reactions []apiReaction `json:"reactions"`
+		}{},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/pair",
+		Summary:     "Swap a pairing code for an API token",
+		Description: "Generate the code at /account/pair. It can only be used once.",
+		Public:      true,
+		Request:     pairInput{},
+		Example:     `{"code": "ABCD-EFGH"}`,
+		Status:      http.StatusCreated,
+		Response:    pairResult{},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/tokens",
+		Summary:     "Get a short-lived access token",
+		Description: "Authenticate with an API token or session, or send a refresh token with the refresh_token grant type. The access token is a JWT, which is used like an API token until it expires. Each refresh token works once. Responds with a 404 if the server doesn't issue access tokens.",
+		Public:      true,
+		Request:     tokensInput{},
+		Example:     `{"grant_type": "refresh_token", "refresh_token": "TOKEN"}`,
+		Status:      http.StatusCreated,
+		Response:    tokensResult{},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/paste",
+		Summary:     "Create a snippet, for Pastebin clients",
+		Description: "Takes the form fields of Pastebin's api_post.php, with an API token as api_dev_key, and responds with the snippet's URL.",
+		Public:      true,
+		Request: struct {
+			DevKey     string `json:"api_dev_key"`
+			Option     string `json:"api_option"`
+			Code       string `json:"api_paste_code"`
+			Name       string `json:"api_paste_name,omitempty"`
+			Private    string `json:"api_paste_private,omitempty"`
+			ExpireDate string `json:"api_paste_expire_date,omitempty"`
+		}{},
+		RequestType:  "application/x-www-form-urlencoded",
+		Example:      "api_dev_key=TOKEN&api_option=paste&api_paste_code=Hello",
+		Status:       http.StatusOK,
+		Response:     "",
+		ResponseType: "text/plain",
+		ErrorType:    "text/plain",
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/validate",
+		Summary:     "Check a signup field",
+		Description: "Whether an email address or username can be used to sign up.",
+		Public:      true,
+		Params: []apiParam{
+			{Name: "field", In: "query", Description: "email or username", Required: true, Type: "string"},
+			{Name: "value", In: "query", Description: "The value to check", Type: "string"},
+		},
+		Status:   http.StatusOK,
+		Response: validateResult{},
+	},
+}
+
+// openAPIDocument builds the OpenAPI 3 document for the API. The server URL is the one the request was sent to.
+func openAPIDocument(r *http.Request) map[string]any {
+	schemas := map[string]any{}
+	paths := map[string]map[string]any{}
+
+	for _, op := range apiOperations {
+		operation := map[string]any{
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+			"responses": map[string]any{
+				fmt.Sprint(op.Status): map[string]any{
+					"description": http.StatusText(op.Status),
+					"content":     mediaTypes(op.ResponseType, op.Response, schemas),
+				},
+				"default": map[string]any{
+					"description": "An error",
+					"content":     errorMediaTypes(op.ErrorType, schemas),
+				},
+			},
+		}
+		if op.Description != "" {
+			operation["description"] = op.Description
+		}
+		if op.Public {
+			operation["security"] = []any{}
+		}
+
+		if len(op.Params) > 0 {
+			params := make([]any, len(op.Params))
+			for i, p := range op.Params {
+				params[i] = map[string]any{
+					"name":        p.Name,
+					"in":          p.In,
+					"description": p.Description,
+					"required":    p.Required,
+					"schema":      map[string]any{"type": p.Type},
+				}
+			}
+			operation["parameters"] = params
+		}
+
+		if op.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  mediaTypes(op.RequestType, op.Request, schemas),
+			}
+		}
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]any{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Snippetbox API",
+			"version":     "1",
+			"description": "Errors are problem details (RFC 7807). Authenticate with an API token from pairing, a JWT access token, or a logged-in session.",
+		},
+		"servers": []any{map[string]any{"url": requestScheme(r) + "://" + r.Host}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"token":   map[string]any{"type": "http", "scheme": "bearer"},
+				"session": map[string]any{"type": "apiKey", "in": "cookie", "name": "session"},
+			},
+		},
+		"security": []any{map[string]any{"token": []any{}}, map[string]any{"session": []any{}}},
+	}
+}
+
+// operationID names an operation after its method and path, like getApiV1SnippetId.
+func operationID(op apiOperation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool { return r == '/' || r == '{' || r == '}' || r == '_' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// mediaTypes describes a request or response body. The media type defaults to JSON.
+func mediaTypes(mediaType string, body any, schemas map[string]any) map[string]any {
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	return map[string]any{mediaType: map[string]any{"schema": jsonSchema(reflect.TypeOf(body), schemas)}}
+}
+
+// errorMediaTypes describes the error responses, which are problem details unless the operation says otherwise.
+func errorMediaTypes(mediaType string, schemas map[string]any) map[string]any {
+	if mediaType == "" {
+		return mediaTypes("application/problem+json", problem{}, schemas)
+	}
+	return mediaTypes(mediaType, "", schemas)
+}
+
+// jsonSchema returns the schema for a Go type, following the encoding/json rules for struct tags. Named struct types
+// are added to schemas, and referred to from wherever they're used.
+func jsonSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+
+		name := schemaName(t)
+		if _, ok := schemas[name]; !ok {
+			// Add a placeholder first, in case the type refers to itself.
+			schemas[name] = nil
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the schema for a struct's fields. Fields without omitempty are always there, so they're required.
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := map[string]any{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = jsonSchema(field.Type, schemas)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaName names the schema for a Go type. The "api" prefix of this package's types is dropped, and types from other
+// packages are prefixed with the package name, so that interchange.Snippet doesn't clash with apiSnippet.
+func schemaName(t reflect.Type) string {
+	name := strings.TrimPrefix(t.Name(), "api")
+	if pkg := t.PkgPath(); pkg != reflect.TypeOf(apiOperation{}).PkgPath() {
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + name
+	}
+
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// The apiDocs handler sends the OpenAPI document, so that clients can be generated from it.
+func (app *application) apiDocs(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, openAPIDocument(r), nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// The apiDocsPage handler shows the API's operations, with a form for trying each of them out. The forms send requests
+// with the user's session, so they work without an API token once the user has logged in.
+func (app *application) apiDocsPage(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.APIOperations = apiOperations
+	app.render(w, r, http.StatusOK, "api.gohtml", data)
+}
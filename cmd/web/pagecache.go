@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How long a page is cached for anonymous visitors. Pages are dropped from the cache when the snippets on them change,
+// so this only limits how long an expired snippet can still be seen.
+const pageCacheTTL = time.Minute
+
+// pageCacheHeaders are the response headers which the handlers set for themselves, and so have to be kept with the page.
+// The rest come from the middleware, which still runs for every request.
+var pageCacheHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Link", "X-Robots-Tag"}
+
+// The cachedPage type is a response kept in the cache. The CSP nonce and the scheme and host of the request that it was
+// made for are swapped for the current ones when it's sent, as they're different for each visitor.
+type cachedPage struct {
+	Header http.Header
+	Body   []byte
+	Nonce  string
+	Origin string
+}
+
+// pageCacheKey returns the key that the page at the path is cached under. Only anonymous visitors' pages are cached,
+// because everybody else's show who they are.
+func pageCacheKey(path string) string {
+	return "page:anonymous:" + path
+}
+
+// The pageRecorder type passes a response through to the client, and keeps a copy of the body so that it can be cached.
+type pageRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+}
+
+func (rec *pageRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.statusRecorder.Write(b)
+}
+
+// The cachePage middleware serves anonymous visitors' GET requests from the cache, and caches the pages it has to
+// render, so that a burst of visitors to a popular page doesn't mean a burst of queries. Requests with a query string,
+// or a flash message waiting in their session, are always rendered, as are those from visitors who've dismissed an
+// announcement, which the cached pages would show them again. The middleware has to come after authenticate and
+// secureHeaders, and the pages mustn't have CSRF tokens in them for anonymous visitors, as those can't be swapped.
+func (app *application) cachePage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.RawQuery != "" || app.isAuthenticated(r) || app.sessionManager.Exists(r.Context(), "flash") || app.sessionManager.Exists(r.Context(), "dismissedAnnouncement") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := pageCacheKey(r.URL.Path)
+		origin := requestScheme(r) + "://" + r.Host
+
+		b, found, err := app.cache.Get(key)
+		if err != nil {
+			app.errorLog.Printf("[%s] getting cached page: %s", requestID(r), err)
+		}
+
+		var page cachedPage
+		if found && gob.NewDecoder(bytes.NewReader(b)).Decode(&page) == nil {
+			for name, values := range page.Header {
+				for _, value := range values {
+					w.Header().Add(name, strings.ReplaceAll(value, page.Origin, origin))
+				}
+			}
+
+			lastModified, _ := http.ParseTime(page.Header.Get("Last-Modified"))
+			if notModified(r, page.Header.Get("ETag"), lastModified) {
+				w.Header().Del("Content-Security-Policy")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			body := page.Body
+			if page.Nonce != "" {
+				body = bytes.ReplaceAll(body, []byte(page.Nonce), []byte(cspNonce(r)))
+			}
+
+			w.WriteHeader(http.StatusOK)
+			w.Write(body)
+			return
+		}
+
+		rec := &pageRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+		next.ServeHTTP(rec, r)
+
+		if rec.status != http.StatusOK || rec.body.Len() == 0 {
+			return
+		}
+
+		page = cachedPage{Header: http.Header{}, Body: rec.body.Bytes(), Nonce: cspNonce(r), Origin: origin}
+		for _, name := range pageCacheHeaders {
+			for _, value := range w.Header().Values(name) {
+				page.Header.Add(name, value)
+			}
+		}
+
+		var buf bytes.Buffer
+		err = gob.NewEncoder(&buf).Encode(&page)
+		if err == nil {
+			err = app.cache.Set(key, buf.Bytes(), pageCacheTTL)
+		}
+		if err != nil {
+			app.errorLog.Printf("[%s] caching page: %s", requestID(r), err)
+		}
+	})
+}
+
+// dropCachedPages removes the pages at the paths from the cache, so that the next visitor sees them as they are now. The
+// home page's sections are cached separately, so they go along with the home page.
+func (app *application) dropCachedPages(paths ...string) {
+	keys := make([]string, 0, len(paths)+1)
+	for _, path := range paths {
+		keys = append(keys, pageCacheKey(path))
+		if path == "/" {
+			keys = append(keys, homeCacheKey)
+		}
+	}
+
+	err := app.cache.Delete(keys...)
+	if err != nil {
+		app.errorLog.Printf("dropping %d cached pages: %s", len(paths), err)
+	}
+}
+
+// snippetsCreated drops the cached copies of the home page after new snippets have been created, so that any public
+// ones are listed there straight away.
+func (app *application) snippetsCreated(visibilities ...string) {
+	for _, visibility := range visibilities {
+		if visibility == models.VisibilityPublic {
+			app.purgeCache("/")
+			return
+		}
+	}
+}
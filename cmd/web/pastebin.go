@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/langdetect"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"github.com/0xshiku/snippetbox/internal/webhooks"
+	"net/http"
+)
+
+// pastebinExpiries maps Pastebin's api_paste_expire_date values to the nearest expiry we offer which is at least as long,
+// so a paste never disappears sooner than the client asked. Pastes that never expire get the longest we have.
+var pastebinExpiries = map[string]int{
+	"10M": 1,
+	"1H":  1,
+	"1D":  1,
+	"1W":  7,
+	"2W":  365,
+	"1M":  365,
+	"6M":  365,
+	"1Y":  365,
+	"N":   365,
+}
+
+// pastebinError sends an error the way Pastebin does, as plain text starting with "Bad API request", which is what
+// Pastebin clients look for. Unlike Pastebin, the status code says what went wrong too.
+func pastebinError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "Bad API request, %s", message)
+}
+
+// pastebinServerError logs an error that's our fault, and sends a Pastebin-style error in place of the usual error page.
+func (app *application) pastebinServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorLog.Output(2, fmt.Sprintf("[%s] %s", requestID(r), err))
+	app.recordServerError(err)
+
+	status := http.StatusInternalServerError
+	if errorStatus(err) == http.StatusServiceUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	pastebinError(w, status, "the paste couldn't be created, please try again later")
+}
+
+// The pastebinCreate handler accepts the form fields of Pastebin's api_post.php, so that existing Pastebin clients can
+// create snippets here just by changing the URL. The API token goes in api_user_key, or in api_dev_key for clients that
+// only send that. Only api_option=paste is supported, and api_paste_format is ignored, because snippets don't have a
+// language. Private pastes are refused rather than quietly made unlisted, because anybody with the link can see those.
+// The response is the new snippet's URL, as plain text.
+func (app *application) pastebinCreate(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err == nil {
+		err = checkFormLimits(r.PostForm)
+	}
+	if err != nil {
+		pastebinError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+
+	token := r.PostForm.Get("api_user_key")
+	if token == "" {
+		token = r.PostForm.Get("api_dev_key")
+	}
+
+	userID, err := app.tokens.GetUserID(models.ScopeAPI, token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			pastebinError(w, http.StatusUnauthorized, "invalid api_dev_key")
+		} else {
+			app.pastebinServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.pastebinServerError(w, r, err)
+		return
+	}
+	if user.Blocked() {
+		pastebinError(w, http.StatusForbidden, "your account has been "+user.Status)
+		return
+	}
+	if user.MustEnrollTwoFactor {
+		pastebinError(w, http.StatusForbidden, "you must set up two-factor authentication again before using the API")
+		return
+	}
+
+	// The quota checks need to know who the user is, in the same way as for the rest of the API.
+	ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+	ctx = context.WithValue(ctx, authenticatedUserIDContextKey, userID)
+	ctx = context.WithValue(ctx, authenticatedUserContextKey, user)
+	r = r.WithContext(ctx)
+
+	if option := r.PostForm.Get("api_option"); option != "paste" {
+		pastebinError(w, http.StatusBadRequest, "invalid api_option")
+		return
+	}
+
+	content := r.PostForm.Get("api_paste_code")
+	if !validators.NotBlank(content) {
+		pastebinError(w, http.StatusUnprocessableEntity, "api_paste_code was empty")
+		return
+	}
+
+	title := r.PostForm.Get("api_paste_name")
+	if !validators.NotBlank(title) {
+		title = fmt.Sprintf("Untitled %s snippet", langdetect.Detect(content))
+	}
+	if !validators.MaxChars(title, 100) {
+		pastebinError(w, http.StatusUnprocessableEntity, "maximum paste name length is 100 characters")
+		return
+	}
+
+	var visibility string
+	switch r.PostForm.Get("api_paste_private") {
+	case "", "0":
+		visibility = models.VisibilityPublic
+	case "1":
+		visibility = models.VisibilityUnlisted
+	case "2":
+		pastebinError(w, http.StatusUnprocessableEntity, "private pastes aren't supported, use unlisted (1) instead")
+		return
+	default:
+		pastebinError(w, http.StatusUnprocessableEntity, "invalid api_paste_private")
+		return
+	}
+
+	expires := quickDefaultExpires
+	if value := r.PostForm.Get("api_paste_expire_date"); value != "" {
+		var ok bool
+		expires, ok = pastebinExpiries[value]
+		if !ok {
+			pastebinError(w, http.StatusUnprocessableEntity, "invalid api_paste_expire_date")
+			return
+		}
+	}
+
+	quota, err := app.snippetQuota(r)
+	if err != nil {
+		app.pastebinServerError(w, r, err)
+		return
+	}
+
+	if quota.checkContent(content) != "" {
+		pastebinError(w, http.StatusUnprocessableEntity, fmt.Sprintf("maximum paste size is %d bytes", quota.maxBytes))
+		return
+	}
+	if status, message := quota.checkCount(); status != 0 {
+		pastebinError(w, status, message)
+		return
+	}
+
+	publicID, err := app.snippets.Insert(userID, title, content, expires, visibility)
+	if err != nil {
+		app.pastebinServerError(w, r, err)
+		return
+	}
+
+	app.snippetEvent(r, webhooks.EventSnippetCreated, userID, publicID)
+	app.snippetsCreated(visibility)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s://%s/snippet/view/%s", requestScheme(r), r.Host, publicID)
+}
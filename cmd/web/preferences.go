@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The apiPreferences type is the JSON form of a user's preferences, which are the same settings as on the
+// /account/preferences page. Version goes up by one whenever they change, and is also sent as the ETag.
+type apiPreferences struct {
+	Timezone string `json:"timezone"`
+	Locale   string `json:"locale"`
+	Version  int    `json:"version"`
+}
+
+// The preferencesInput type is the request body for changing preferences. The fields are pointers, so that we can tell
+// which ones were left out.
+type preferencesInput struct {
+	Timezone *string `json:"timezone,omitempty"`
+	Locale   *string `json:"locale,omitempty"`
+}
+
+// preferencesETag returns the ETag for a version of a user's preferences. It's a strong ETag, because If-Match only
+// works with those.
+func preferencesETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// writePreferences sends a user's preferences, along with their ETag.
+func (app *application) writePreferences(w http.ResponseWriter, r *http.Request, prefs apiPreferences) {
+	headers := make(http.Header)
+	headers.Set("ETag", preferencesETag(prefs.Version))
+
+	err := app.writeJSON(w, http.StatusOK, prefs, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *application) preferencesGet(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.writePreferences(w, r, apiPreferences{
+		Timezone: user.Timezone,
+		Locale:   user.Locale,
+		Version:  user.PreferencesVersion,
+	})
+}
+
+// preferencesPatch changes some or all of the user's preferences. Fields which are left out of the request body keep their
+// current values. To stop two clients (or a client and the HTML page) from silently undoing each other's changes, the request
+// must send the ETag it got from GET in an If-Match header. If the preferences have changed since then, nothing is saved and
+// the response is 412 Precondition Failed, so the client can fetch them again and decide what to do.
+func (app *application) preferencesPatch(w http.ResponseWriter, r *http.Request) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		app.apiClientError(w, r, http.StatusPreconditionRequired, "the If-Match header must be set to the ETag of the preferences")
+		return
+	}
+
+	var input preferencesInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiClientError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	// Anything other than the current ETag (including a weak or malformed one) can't match.
+	if ifMatch != "*" && ifMatch != preferencesETag(user.PreferencesVersion) {
+		app.apiClientError(w, r, http.StatusPreconditionFailed, "the preferences have changed since they were fetched")
+		return
+	}
+
+	prefs := apiPreferences{Timezone: user.Timezone, Locale: user.Locale, Version: user.PreferencesVersion}
+	if input.Timezone != nil {
+		prefs.Timezone = *input.Timezone
+	}
+	if input.Locale != nil {
+		prefs.Locale = *input.Locale
+	}
+
+	_, knownLocale := findLocale(prefs.Locale)
+
+	var v validators.Validator
+
+	v.CheckField(validTimezone(prefs.Timezone), "timezone", "must be a timezone name like Europe/London")
+	v.CheckField(knownLocale, "locale", fmt.Sprintf("must be one of %s", strings.Join(localeTags(), ", ")))
+
+	if !v.Valid() {
+		app.apiFailedValidation(w, r, v.FieldErrors)
+		return
+	}
+
+	// The version is checked again as part of the update, in case another change was saved since we read the user.
+	err = app.users.PreferencesUpdateIfMatch(userID, prefs.Version, prefs.Timezone, prefs.Locale)
+	if err != nil {
+		if errors.Is(err, models.ErrEditConflict) {
+			app.apiClientError(w, r, http.StatusPreconditionFailed, "the preferences have changed since they were fetched")
+		} else {
+			app.apiModelError(w, r, err)
+		}
+		return
+	}
+
+	prefs.Version++
+
+	app.writePreferences(w, r, prefs)
+}
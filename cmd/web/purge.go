@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// The timeout for each request to the CDN's purge API.
+const purgeTimeout = 10 * time.Second
+
+// The number of times to try a purge before giving up on it, and the delay before the first retry, which doubles after each
+// failure. A page which isn't purged stays cached until the CDN's own cache lifetime (from -cache-public) runs out.
+const (
+	purgeAttempts   = 3
+	purgeRetryDelay = 5 * time.Second
+)
+
+// purgeCache drops the cached copies of the pages at the given paths, like "/snippet/view/01HV5Q2X8N3K7M4R6T9W0Y1Z2A", from
+// our own page cache and the CDN (if there is one).
+// The CDN purge happens in the background, so that a slow purge API doesn't hold up the response, and it is retried if it fails.
+func (app *application) purgeCache(paths ...string) {
+	if len(paths) == 0 {
+		return
+	}
+
+	app.dropCachedPages(paths...)
+
+	if app.purger == nil {
+		return
+	}
+
+	urls := make([]string, len(paths))
+	for i, path := range paths {
+		urls[i] = app.config.cdn.baseURL + path
+	}
+
+	app.background(func() {
+		delay := purgeRetryDelay
+
+		for attempt := 1; ; attempt++ {
+			err := app.purger.Purge(context.Background(), urls)
+			if err == nil {
+				return
+			}
+
+			if attempt == purgeAttempts {
+				app.errorLog.Output(2, fmt.Sprintf("purging %d URLs from the CDN: giving up after %d attempts: %s", len(urls), attempt, err))
+				return
+			}
+
+			app.errorLog.Printf("purging %d URLs from the CDN (attempt %d): %s", len(urls), attempt, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	})
+}
+
+// snippetPaths returns the paths of the pages which show the snippets with the given public IDs.
+func snippetPaths(publicIDs ...string) []string {
+	paths := make([]string, len(publicIDs))
+	for i, id := range publicIDs {
+		paths[i] = "/snippet/view/" + id
+	}
+
+	return paths
+}
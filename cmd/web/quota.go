@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The content of a snippet is stored in a TEXT column, which can't hold more than 65535 bytes.
+const maxContentBytes = 65535
+
+// The snippetQuota type holds a user's limits, along with how much of them they've used. It's loaded once per request, so
+// that an import only has to count the user's snippets once, however many it adds.
+// Admins are exempt from the limits, apart from the size of the content column.
+type snippetQuota struct {
+	exempt      bool
+	maxSnippets int
+	perHour     int
+	maxBytes    int
+	total       int
+	recent      int
+}
+
+// snippetQuota loads the quota of the user making the request.
+func (app *application) snippetQuota(r *http.Request) (*snippetQuota, error) {
+	q := &snippetQuota{
+		maxSnippets: app.config.quota.maxSnippets,
+		perHour:     app.config.quota.perHour,
+		maxBytes:    app.config.quota.maxBytes,
+	}
+
+	if user := authenticatedUser(r); user != nil && user.IsAdmin {
+		q.exempt = true
+		q.maxBytes = maxContentBytes
+		return q, nil
+	}
+
+	// There's no need to count the user's snippets if neither count is limited.
+	if q.maxSnippets == 0 && q.perHour == 0 {
+		return q, nil
+	}
+
+	var err error
+	q.total, q.recent, err = app.snippets.Usage(app.authenticatedUserID(r), time.Now().Add(-time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// checkContent returns an error message for the content field if the content is too large, or "" if it's fine.
+func (q *snippetQuota) checkContent(content string) string {
+	if q.maxBytes > 0 && len(content) > q.maxBytes {
+		return fmt.Sprintf("This field cannot be more than %d bytes long", q.maxBytes)
+	}
+	return ""
+}
+
+// checkCount reports whether the user can create another snippet. If they can't, it returns the status code to respond
+// with (429 Too Many Requests if they only have to wait a while, or 422 Unprocessable Entity if they're at their
+// limit of unexpired snippets) and a message saying which limit they've reached.
+func (q *snippetQuota) checkCount() (int, string) {
+	if q.exempt {
+		return 0, ""
+	}
+
+	if q.maxSnippets > 0 && q.total >= q.maxSnippets {
+		return http.StatusUnprocessableEntity, fmt.Sprintf("You've reached your limit of %d snippets. Snippets stop counting towards it once they expire", q.maxSnippets)
+	}
+
+	if q.perHour > 0 && q.recent >= q.perHour {
+		return http.StatusTooManyRequests, fmt.Sprintf("You can only create %d snippets an hour. Please try again later", q.perHour)
+	}
+
+	return 0, ""
+}
+
+// add counts a new snippet against the quota.
+func (q *snippetQuota) add() {
+	q.total++
+	q.recent++
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+// reactionAllowed checks the user's reactions rate limit. If they've reached it, it returns false along with the number
+// of seconds until they can react again.
+func (app *application) reactionAllowed(userID int) (bool, int) {
+	if app.reactionLimiter == nil {
+		return true, 0
+	}
+
+	result := app.reactionLimiter.Allow(fmt.Sprintf("user:%d", userID))
+	return result.Allowed, retryAfterSeconds(result)
+}
+
+// changeReaction adds or removes the user's reaction on a snippet, and drops any cached copies of the snippet's page.
+func (app *application) changeReaction(r *http.Request, snippet *models.Snippet, userID int, name string, remove bool) error {
+	var err error
+	if remove {
+		err = app.reactions.Remove(snippet.ID, userID, name)
+	} else {
+		err = app.reactions.Add(snippet.ID, userID, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	app.purgeCache(snippetPaths(snippet.PublicID)...)
+
+	if !remove {
+		app.notify(r, snippet, userID, models.NotificationReaction, name)
+	}
+
+	return nil
+}
+
+// snippetReactPost adds one of the user's reactions to a snippet, or takes it away again if the form's remove field is set.
+func (app *application) snippetReactPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	publicID := params.ByName("id")
+	if publicID == "" || len(publicID) > maxPublicIDLength {
+		app.notFound(w, r)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	name := r.PostForm.Get("reaction")
+	if !models.ValidReaction(name) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, err := app.snippets.GetByPublicID(publicID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	if ok, retryAfter := app.reactionAllowed(userID); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+		data := app.newTemplateData(r)
+		data.RetryAfter = retryAfter
+		app.render(w, r, http.StatusTooManyRequests, "ratelimit.gohtml", data)
+		return
+	}
+
+	err = app.changeReaction(r, snippet, userID, name, r.PostForm.Get("remove") == "true")
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.PublicID+"#reactions", http.StatusSeeOther)
+}
+
+// The apiReaction type is how a reaction count is represented in the API.
+type apiReaction struct {
+	Name    string `json:"name"`
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+// writeReactions sends the counts of every reaction on a snippet, as seen by the authenticated user.
+func (app *application) writeReactions(w http.ResponseWriter, r *http.Request, snippet *models.Snippet) {
+	counts, _, err := app.reactions.Counts(snippet.ID, app.authenticatedUserID(r))
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	reactions := make([]apiReaction, len(counts))
+	for i, c := range counts {
+		reactions[i] = apiReaction{Name: c.Name, Emoji: c.Emoji, Count: c.Count, Reacted: c.Reacted}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"reactions": reactions}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// reactionsGet returns the reaction counts for a snippet.
+func (app *application) reactionsGet(w http.ResponseWriter, r *http.Request) {
+	snippet := app.apiSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	app.writeReactions(w, r, snippet)
+}
+
+// reactionChange adds the authenticated user's reaction to a snippet (PUT), or removes it (DELETE). Both are idempotent,
+// and respond with the snippet's reaction counts afterwards.
+func (app *application) reactionChange(w http.ResponseWriter, r *http.Request) {
+	snippet := app.apiSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	if !models.ValidReaction(name) {
+		app.apiClientError(w, r, http.StatusNotFound, "unknown reaction")
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	if ok, retryAfter := app.reactionAllowed(userID); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		app.apiClientError(w, r, http.StatusTooManyRequests, fmt.Sprintf("reaction rate limit exceeded, retry in %d seconds", retryAfter))
+		return
+	}
+
+	err := app.changeReaction(r, snippet, userID, name, r.Method == http.MethodDelete)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.writeReactions(w, r, snippet)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/federation"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How long we wait for a remote instance to accept a cross-posted snippet.
+const federationTimeout = 10 * time.Second
+
+// The accountRemoteForm struct holds the details of another Snippetbox instance that the user wants to cross-post to.
+// The token is an API token from that instance, which the user can get by pairing with it.
+type accountRemoteForm struct {
+	Name                 string `form:"name"`
+	BaseURL              string `form:"baseURL"`
+	Token                string `form:"token"`
+	validators.Validator `form:"-"`
+}
+
+func (form *accountRemoteForm) Validate(_ *application) {
+	form.BaseURL = strings.TrimSpace(form.BaseURL)
+	form.Token = strings.TrimSpace(form.Token)
+
+	form.CheckString("name", form.Name, validators.Required(), validators.Length(50), validators.Printable())
+	form.CheckString("baseURL", form.BaseURL, validators.Required(), validators.Length(255))
+	if err := federation.CheckBaseURL(form.BaseURL); err != nil {
+		form.AddFieldError("baseURL", "This field "+err.Error())
+	}
+	form.CheckString("token", form.Token, validators.Required(), validators.Length(255), validators.Printable())
+}
+
+func (app *application) accountRemotes(w http.ResponseWriter, r *http.Request) {
+	app.renderRemotes(w, r, http.StatusOK, accountRemoteForm{})
+}
+
+// renderRemotes shows the user's remote instances, along with the form for adding another one.
+func (app *application) renderRemotes(w http.ResponseWriter, r *http.Request, status int, form accountRemoteForm) {
+	remotes, err := app.remotes.AllForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Remotes = remotes
+
+	app.render(w, r, status, "remotes.gohtml", data)
+}
+
+func (app *application) accountRemotesPost(w http.ResponseWriter, r *http.Request) {
+	var form accountRemoteForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Validate(app)
+
+	if !form.Valid() {
+		app.renderRemotes(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	_, err = app.remotes.Insert(app.authenticatedUserID(r), form.Name, form.BaseURL, form.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateRemoteName) {
+			form.AddFieldError("name", "You already have a remote with this name")
+			app.renderRemotes(w, r, http.StatusUnprocessableEntity, form)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s has been added. You can now cross-post your snippets to it.", form.Name))
+
+	http.Redirect(w, r, "/account/remotes", http.StatusSeeOther)
+}
+
+func (app *application) accountRemoteDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		ID int `form:"id"`
+	}
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.remotes.Delete(form.ID, app.authenticatedUserID(r))
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The remote has been removed")
+
+	http.Redirect(w, r, "/account/remotes", http.StatusSeeOther)
+}
+
+// snippetCrossPostPost pushes one of the user's snippets to one of their remote instances, and records where it ended up,
+// so the snippet's page can link to the copy.
+func (app *application) snippetCrossPostPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	publicID := params.ByName("id")
+	if publicID == "" || len(publicID) > maxPublicIDLength {
+		app.notFound(w, r)
+		return
+	}
+
+	var form struct {
+		Remote int `form:"remote"`
+	}
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	// Only the owner of a snippet can cross-post it. For anyone else, act as if the snippet doesn't exist, in the same way
+	// that the models do for somebody else's remote.
+	snippet, err := app.snippets.GetByPublicID(publicID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	if snippet.UserID != userID {
+		app.notFound(w, r)
+		return
+	}
+
+	remote, err := app.remotes.Get(form.Remote, userID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	remoteURL, err := app.federation.Push(remote.BaseURL, remote.Token, federation.Snippet{
+		Title:      snippet.Title,
+		Content:    snippet.Content,
+		Expires:    federation.ExpiryDays(snippet.Expires, time.Now()),
+		Visibility: snippet.Visibility,
+	})
+	if err != nil {
+		// A remote instance being down or refusing the token isn't a problem with our server, so log it and tell the user,
+		// rather than showing an error page.
+		app.errorLog.Printf("[%s] cross-posting snippet %d to %s: %s", requestID(r), snippet.ID, remote.BaseURL, err)
+
+		message := fmt.Sprintf("The snippet couldn't be cross-posted to %s. Please try again later.", remote.Name)
+		if errors.Is(err, federation.ErrUnauthorized) {
+			message = fmt.Sprintf("%s didn't accept your API token. You might need to pair with it again.", remote.Name)
+		}
+		app.sessionManager.Put(r.Context(), "flash", message)
+
+		http.Redirect(w, r, "/snippet/view/"+snippet.PublicID, http.StatusSeeOther)
+		return
+	}
+
+	err = app.remotes.RecordMirror(snippet.ID, remote.Name, remoteURL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The snippet's page now lists the new mirror, so drop any cached copy of it.
+	app.purgeCache(snippetPaths(snippet.PublicID)...)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet cross-posted to %s", remote.Name))
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.PublicID, http.StatusSeeOther)
+}
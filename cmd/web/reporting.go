@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/errreport"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// The timeout for sending each report to the error tracking service.
+const reportTimeout = 5 * time.Second
+
+// The panicError type is the error that recoverPanic hands to serverError, so that the report can say it was a panic.
+// If the panic was with an error, it's unwrapped to that.
+type panicError struct {
+	value any
+}
+
+func (e panicError) Error() string {
+	return fmt.Sprint(e.value)
+}
+
+func (e panicError) Unwrap() error {
+	err, _ := e.value.(error)
+	return err
+}
+
+// reportError sends a server error to the error tracking service (if there is one), with its stack trace and the request
+// it happened during. It's sent in the background, so that the error page doesn't wait for it, and a report which
+// can't be sent is only logged, as the error itself already has been.
+func (app *application) reportError(r *http.Request, err error, stack []byte) {
+	if app.reporter == nil {
+		return
+	}
+
+	// Credentials are left out of the report, the same as on the debug page.
+	header := r.Header.Clone()
+	for name := range header {
+		if slices.Contains(redactedHeaders, name) {
+			header[name] = []string{"[redacted]"}
+		}
+	}
+
+	report := errreport.Report{
+		Err:       err,
+		Stack:     stack,
+		Panic:     errors.As(err, new(panicError)),
+		RequestID: requestID(r),
+		UserID:    app.authenticatedUserID(r),
+		Method:    r.Method,
+		URL:       requestScheme(r) + "://" + r.Host + r.URL.RequestURI(),
+		Header:    header,
+		Time:      time.Now(),
+	}
+
+	app.background(func() {
+		err := app.reporter.Report(context.Background(), report)
+		if err != nil {
+			app.errorLog.Printf("[%s] reporting server error: %s", report.RequestID, err)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"github.com/0xshiku/snippetbox/ui"
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
@@ -12,12 +13,6 @@ func (app *application) routes() http.Handler {
 	// Initialize the router
 	router := httprouter.New()
 
-	// Creates a handler function which wraps our notFound() helper, and then assign it as the custom handler for 404 Not Found Responses.
-	// You can also set a custom handler for 405 Method Not Allowed responses by setting router.MethodNotAllowed in the same way too.
-	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.notFound(w)
-	})
-
 	// Update the pattern for the route for the static files.
 	// Take the ui.Files embedded filesystem and convert it to a http.FS type
 	// So that it satisfies the http.FileSystem interface.
@@ -28,10 +23,21 @@ func (app *application) routes() http.Handler {
 	// So, for example, our css stylesheet is located at "static/css/main.css".
 	// This means that we now longer need to strip the prefix from the request URL
 	// -- any requests that start with /static/ can just be passed directly to the file server and the corresponding static file will be served (so long as it exists)
-	router.Handler(http.MethodGet, "/static/*filepath", fileServer)
+	// The base template adds the UI build's checksum to these URLs, so that they can be cached for a long time.
+	router.Handler(http.MethodGet, "/static/*filepath", app.cacheControl(cacheAssets)(fileServer))
+
+	// Probes for Kubernetes and load balancers: /healthz says whether the process is alive, and /readyz whether it can
+	// serve requests.
+	router.HandlerFunc(http.MethodGet, "/healthz", app.healthz)
+	router.HandlerFunc(http.MethodGet, "/readyz", app.readyz)
 
-	// Add a new GET /ping route.
-	router.HandlerFunc(http.MethodGet, "/ping", ping)
+	// The manifest of the embedded UI files, for checking which build is deployed.
+	router.HandlerFunc(http.MethodGet, "/debug/assets", app.debugAssets)
+
+	// Request counts and SLO burn rates, for Prometheus to scrape. It's only there if it's been turned on.
+	if app.config.metrics.enabled {
+		router.HandlerFunc(http.MethodGet, "/metrics", app.metrics)
+	}
 
 	// Create a new middleware chain containing the middleware specific to our dynamic application routes.
 	// For now, this chain will only contain the LoadAndSave session middleware
@@ -42,42 +48,220 @@ func (app *application) routes() http.Handler {
 	// Unprotected application routes using the "dynamic" middleware chain
 	// Use the nosurf middleware on all our 'dynamic' routes
 	// Add the authenticate() middleware to the chain
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	// The cacheControl middleware comes after authenticate, because logged-in users get a different policy.
+	// The rateLimitPages middleware comes last, so that the "slow down" page can show the usual navigation.
+	// The requireDatabase middleware comes first, because loading the session needs the database.
+	// The maintenance middleware comes straight after authenticate, because admins can still use the site in maintenance mode.
+	dynamic := alice.New(app.requireDatabase, app.sessionManager.LoadAndSave, noSurf, app.authenticate, app.maintenance, app.cacheControl(cachePublic), app.rateLimitPages)
+
+	// Creates a handler function which wraps our notFound() helper, and then assign it as the custom handler for 404 Not Found Responses.
+	// It uses the dynamic chain, so that the 404 page can show the navigation for logged-in users (and their CSRF token for the logout form).
+	// You can also set a custom handler for 405 Method Not Allowed responses by setting router.MethodNotAllowed in the same way too.
+	router.NotFound = dynamic.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.notFound(w, r)
+	})
 
 	// And then create the routes using the appropriate methods, patterns and handlers
 	// Update these routes to use the new dynamic middleware chain followed by the appropriate handler function.
 	// Note: Because the alice ThenFunc() method returns a http.Handler (rather than a http.HandlerFunc)
 	// We also need to switch to registering the route using the router.Handler() method.
-	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
-	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	// The home page and snippets are what most anonymous visitors come for, so their pages are cached for them.
+	router.Handler(http.MethodGet, "/", dynamic.Append(app.cachePage).ThenFunc(app.home))
+	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.Append(app.cachePage).ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/snippet/format/:id", dynamic.ThenFunc(app.snippetFormat))
+	router.Handler(http.MethodGet, "/compare", dynamic.ThenFunc(app.compare))
 	router.Handler(http.MethodGet, "/about", dynamic.ThenFunc(app.about))
 
-	// Auth routes
+	// Pages of the home page's snippet list on their own, for infinite scrolling.
+	router.Handler(http.MethodGet, "/fragments/snippets", dynamic.ThenFunc(app.snippetFragment))
+
+	// Anybody can dismiss the announcement at the top of the page, for the rest of their session.
+	router.Handler(http.MethodPost, "/announcement/dismiss", dynamic.ThenFunc(app.announcementDismissPost))
+
+	// Public profile pages. These live under /users/ rather than /user/, because httprouter doesn't allow
+	// a :username wildcard to share a path segment with the static /user/signup, /user/login and /user/logout routes.
+	router.Handler(http.MethodGet, "/users/:username", dynamic.ThenFunc(app.userProfile))
+
+	// Auth routes. The signup form (like the snippet form below) is checked for spam bots before it's handled.
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
-	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
+	router.Handler(http.MethodPost, "/user/signup", dynamic.Append(app.blockBots).ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
 
+	// Logging in with an OpenID Connect provider, instead of a password. These routes 404 unless one has been set up.
+	router.Handler(http.MethodGet, "/user/login/oidc", dynamic.ThenFunc(app.userLoginOIDC))
+	router.Handler(http.MethodGet, "/user/login/oidc/callback", dynamic.ThenFunc(app.userLoginOIDCCallback))
+
+	// The second step of logging in, for users with two-factor authentication turned on.
+	router.Handler(http.MethodGet, "/user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactor))
+	router.Handler(http.MethodPost, "/user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactorPost))
+	router.Handler(http.MethodGet, "/user/login/recovery", dynamic.ThenFunc(app.userLoginRecovery))
+	router.Handler(http.MethodPost, "/user/login/recovery", dynamic.ThenFunc(app.userLoginRecoveryPost))
+
+	// The email confirmation link only relies on the token, so it works even if the user opens it in a different browser.
+	router.Handler(http.MethodGet, "/account/email/confirm", dynamic.ThenFunc(app.accountEmailConfirm))
+
 	// Protected (authenticated-only) application routes, using a new "protected"
 	// Middleware chain which includes the requireAuthentication middleware.
 	// Because the 'protected' middleware chain appends to the 'dynamic chain'
 	// the noSurf middleware will also be used on three routes below too
-	protected := dynamic.Append(app.requireAuthentication)
+	// The private cache policy comes before requireAuthentication, so that the redirect to the login page isn't cached either.
+	protected := dynamic.Append(app.cacheControl(cachePrivate), app.requireAuthentication)
 
 	router.Handler(http.MethodGet, "/account/view", protected.ThenFunc(app.accountView))
 	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodPost, "/snippet/create", protected.Append(app.blockBots).ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodPost, "/snippet/preview", protected.ThenFunc(app.snippetPreviewPost))
+	router.Handler(http.MethodPost, "/snippet/delete/:id", protected.ThenFunc(app.snippetDeletePost))
+	router.Handler(http.MethodGet, "/snippet/batch", protected.ThenFunc(app.snippetBatchView))
+	router.Handler(http.MethodPost, "/snippet/batch/remove", protected.ThenFunc(app.snippetBatchRemovePost))
+	router.Handler(http.MethodPost, "/snippet/batch/publish", protected.ThenFunc(app.snippetBatchPublishPost))
+	router.Handler(http.MethodPost, "/snippet/format/:id", protected.ThenFunc(app.snippetFormatPost))
+	router.Handler(http.MethodPost, "/snippet/react/:id", protected.ThenFunc(app.snippetReactPost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodGet, "/notifications", protected.ThenFunc(app.notificationsView))
+	router.Handler(http.MethodPost, "/notifications/read", protected.ThenFunc(app.notificationsReadPost))
+	router.Handler(http.MethodGet, "/account/notifications", protected.ThenFunc(app.accountNotifications))
+	router.Handler(http.MethodGet, "/feed", protected.ThenFunc(app.feed))
+	router.Handler(http.MethodPost, "/users/:username/follow", protected.ThenFunc(app.userFollowPost))
+	router.Handler(http.MethodPost, "/users/:username/unfollow", protected.ThenFunc(app.userUnfollowPost))
+	router.Handler(http.MethodPost, "/account/notifications", protected.ThenFunc(app.accountNotificationsPost))
 
 	// Add the two new routes, restricted to authenticated users only
 	router.Handler(http.MethodGet, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdate))
-	router.Handler(http.MethodPost, "account/password/update", protected.ThenFunc(app.accountPasswordUpdatePost))
+	router.Handler(http.MethodPost, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdatePost))
+	router.Handler(http.MethodGet, "/account/email/update", protected.ThenFunc(app.accountEmailUpdate))
+	router.Handler(http.MethodPost, "/account/email/update", protected.ThenFunc(app.accountEmailUpdatePost))
+	router.Handler(http.MethodGet, "/account/profile/update", protected.ThenFunc(app.accountProfileUpdate))
+	router.Handler(http.MethodPost, "/account/profile/update", protected.ThenFunc(app.accountProfileUpdatePost))
+	router.Handler(http.MethodGet, "/account/preferences", protected.ThenFunc(app.accountPreferences))
+	router.Handler(http.MethodPost, "/account/preferences", protected.ThenFunc(app.accountPreferencesPost))
+	router.Handler(http.MethodGet, "/account/pair", protected.ThenFunc(app.accountPair))
+	router.Handler(http.MethodPost, "/account/pair", protected.ThenFunc(app.accountPairPost))
+	router.Handler(http.MethodGet, "/account/2fa", protected.ThenFunc(app.accountTwoFactor))
+	router.Handler(http.MethodPost, "/account/2fa/enable", protected.ThenFunc(app.accountTwoFactorEnablePost))
+	router.Handler(http.MethodPost, "/account/2fa/disable", protected.ThenFunc(app.accountTwoFactorDisablePost))
+	router.Handler(http.MethodGet, "/account/history", protected.ThenFunc(app.accountHistory))
+	router.Handler(http.MethodPost, "/account/history/clear", protected.ThenFunc(app.accountHistoryClearPost))
+	router.Handler(http.MethodGet, "/account/sessions", protected.ThenFunc(app.accountSessions))
+	router.Handler(http.MethodPost, "/account/sessions/revoke", protected.ThenFunc(app.accountSessionRevokePost))
+	router.Handler(http.MethodPost, "/account/sessions/revoke-others", protected.ThenFunc(app.accountSessionsRevokeOthersPost))
+	router.Handler(http.MethodPost, "/account/export", protected.ThenFunc(app.accountExportPost))
+	router.Handler(http.MethodPost, "/account/keep", protected.ThenFunc(app.accountKeepPost))
+	router.Handler(http.MethodGet, "/account/trash", protected.ThenFunc(app.accountTrash))
+	router.Handler(http.MethodGet, "/account/snippets/export", protected.ThenFunc(app.accountSnippetsExport))
+	router.Handler(http.MethodGet, "/account/snippets/import", protected.ThenFunc(app.accountSnippetsImport))
+	router.Handler(http.MethodPost, "/account/snippets/import", alice.New(limitBody(maxImportBytes)).Extend(protected).ThenFunc(app.accountSnippetsImportPost))
+	router.Handler(http.MethodPost, "/account/trash/restore", protected.ThenFunc(app.accountTrashRestorePost))
+	router.Handler(http.MethodPost, "/account/trash/purge", protected.ThenFunc(app.accountTrashPurgePost))
+	router.Handler(http.MethodGet, "/account/export/download", protected.ThenFunc(app.accountExportDownload))
+
+	// Other Snippetbox instances that the user can cross-post their snippets to.
+	router.Handler(http.MethodGet, "/account/remotes", protected.ThenFunc(app.accountRemotes))
+	router.Handler(http.MethodPost, "/account/remotes", protected.ThenFunc(app.accountRemotesPost))
+	router.Handler(http.MethodPost, "/account/remotes/delete", protected.ThenFunc(app.accountRemoteDeletePost))
+	router.Handler(http.MethodPost, "/snippet/crosspost/:id", protected.ThenFunc(app.snippetCrossPostPost))
+
+	// URLs which are sent a signed payload whenever the user creates a snippet, and the log of what was sent.
+	router.Handler(http.MethodGet, "/account/webhooks", protected.ThenFunc(app.accountWebhooks))
+	router.Handler(http.MethodPost, "/account/webhooks", protected.ThenFunc(app.accountWebhooksPost))
+	router.Handler(http.MethodPost, "/account/webhooks/delete", protected.ThenFunc(app.accountWebhookDeletePost))
+
+	// Shared drafts, which several users can edit at once before the owner publishes them. They're experimental, so
+	// they're only there if they've been turned on. The editor sends and receives changes over the WebSocket.
+	if app.config.collab.enabled {
+		router.Handler(http.MethodGet, "/drafts", protected.ThenFunc(app.sharedDraftsView))
+		router.Handler(http.MethodPost, "/drafts", protected.ThenFunc(app.sharedDraftsPost))
+		router.Handler(http.MethodGet, "/draft/edit/:id", protected.ThenFunc(app.sharedDraftEdit))
+		router.Handler(http.MethodGet, "/draft/ws/:id", protected.ThenFunc(app.sharedDraftSocket))
+		router.Handler(http.MethodPost, "/draft/publish/:id", protected.ThenFunc(app.sharedDraftPublishPost))
+		router.Handler(http.MethodPost, "/draft/delete/:id", protected.ThenFunc(app.sharedDraftDeletePost))
+	}
+
+	// The unsubscribe links in notification emails work without logging in, because the token in the URL identifies the
+	// user. Mail clients POST to them for one-click unsubscribe, without a CSRF token, so the POST route leaves out nosurf.
+	// It leaves out authenticate too, so the page it shows doesn't offer a logout form without a CSRF token.
+	router.Handler(http.MethodGet, "/unsubscribe", dynamic.ThenFunc(app.unsubscribe))
+	router.Handler(http.MethodPost, "/unsubscribe", alice.New(app.requireDatabase, app.sessionManager.LoadAndSave, app.maintenance, app.cacheControl(cachePrivate)).ThenFunc(app.unsubscribePost))
+
+	// Admin routes, which are restricted to authenticated users with the admin flag set.
+	admin := protected.Append(app.requireAdmin)
+
+	router.Handler(http.MethodGet, "/admin/settings", admin.ThenFunc(app.adminSettings))
+	router.Handler(http.MethodGet, "/admin/runbook", admin.ThenFunc(app.adminRunbook))
+	router.Handler(http.MethodPost, "/admin/settings", admin.ThenFunc(app.adminSettingsPost))
+	router.Handler(http.MethodPost, "/admin/maintenance", admin.ThenFunc(app.adminMaintenancePost))
+	router.Handler(http.MethodPost, "/admin/disposable/refresh", admin.ThenFunc(app.adminDisposableRefreshPost))
+	router.Handler(http.MethodGet, "/admin/announcement", admin.ThenFunc(app.adminAnnouncement))
+	router.Handler(http.MethodPost, "/admin/announcement", admin.ThenFunc(app.adminAnnouncementPost))
+	router.Handler(http.MethodPost, "/admin/announcement/withdraw", admin.ThenFunc(app.adminAnnouncementWithdrawPost))
+	router.Handler(http.MethodGet, "/admin/users/status", admin.ThenFunc(app.adminUserStatus))
+	router.Handler(http.MethodPost, "/admin/users/status", admin.ThenFunc(app.adminUserStatusPost))
+	router.Handler(http.MethodGet, "/admin/users/delete", admin.ThenFunc(app.adminDeleteUser))
+	router.Handler(http.MethodPost, "/admin/users/delete", admin.ThenFunc(app.adminDeleteUserPost))
+	router.Handler(http.MethodGet, "/admin/users/impersonate", admin.ThenFunc(app.adminImpersonate))
+	router.Handler(http.MethodPost, "/admin/users/impersonate", admin.ThenFunc(app.adminImpersonatePost))
+
+	// Profiles and runtime variables, for working out performance problems in production. Only admins can see them, as
+	// they give away a lot about the server, unless the application is running with -debug (like on a developer's machine).
+	debug := admin
+	if app.config.debug {
+		debug = alice.New()
+	}
+
+	router.Handler(http.MethodGet, "/debug/pprof/*item", debug.ThenFunc(debugPprof))
+	router.Handler(http.MethodGet, "/debug/vars", debug.Then(expvar.Handler()))
+
+	// While impersonating, the session belongs to the user rather than the admin, so stopping can't require an admin.
+	router.Handler(http.MethodPost, "/admin/impersonation/stop", protected.ThenFunc(app.impersonationStopPost))
+
+	// JSON API routes. These accept either an API token in the Authorization header or the user's existing session,
+	// return JSON errors instead of redirecting, and require JSON request bodies in place of the nosurf CSRF token.
+	// The token check comes second, so an explicit token always takes priority over the session.
+	// Rate limiting comes first, so that every API response includes the RateLimit-* headers.
+	api := alice.New(app.rateLimitAPI, app.requireDatabaseAPI, app.maintenanceAPI, app.cacheControl(cachePrivate), app.sessionManager.LoadAndSave, requireJSONRequest, app.authenticate, app.authenticateToken, app.requireAPIAuthentication)
+
+	router.Handler(http.MethodPost, "/api/v1/quick", api.ThenFunc(app.quickCreate))
+	router.Handler(http.MethodGet, "/api/v1/snippets", api.ThenFunc(app.snippetsList))
+	router.Handler(http.MethodGet, "/api/v1/snippet/:id", api.ThenFunc(app.snippetGet))
+
+	// The same preferences as the /account/preferences page, for mobile and single-page apps.
+	router.Handler(http.MethodGet, "/api/v1/me/preferences", api.ThenFunc(app.preferencesGet))
+	router.Handler(http.MethodPatch, "/api/v1/me/preferences", api.ThenFunc(app.preferencesPatch))
+
+	// Reactions to snippets. PUT adds the user's reaction and DELETE takes it away again.
+	router.Handler(http.MethodGet, "/api/v1/reactions/:id", api.ThenFunc(app.reactionsGet))
+	router.Handler(http.MethodPut, "/api/v1/reactions/:id/:name", api.ThenFunc(app.reactionChange))
+	router.Handler(http.MethodDelete, "/api/v1/reactions/:id/:name", api.ThenFunc(app.reactionChange))
+
+	// Moving snippets between instances, in the JSON Lines interchange format.
+	router.Handler(http.MethodGet, "/api/v1/snippets/export", api.ThenFunc(app.snippetsExport))
+	router.Handler(http.MethodPost, "/api/v1/snippets/import", api.ThenFunc(app.snippetsImport))
+
+	// A Pastebin-compatible endpoint, for existing Pastebin clients. They send ordinary forms with the API token in a form
+	// field, so it doesn't use the session at all, which means a form on another site can't post to it as the user.
+	router.Handler(http.MethodPost, "/api/paste", alice.New(app.rateLimitAPI, app.requireDatabaseAPI, app.maintenanceAPI, app.cacheControl(cachePrivate), limitBody(1<<20)).ThenFunc(app.pastebinCreate))
+
+	// The pairing exchange is how an extension gets its token in the first place, so it can't require authentication.
+	// It is still rate limited, which also makes guessing pairing codes impractical.
+	router.Handler(http.MethodPost, "/api/v1/pair", alice.New(app.rateLimitAPI, app.requireDatabaseAPI, app.maintenanceAPI, app.cacheControl(cachePrivate), requireJSONRequest).ThenFunc(app.pairExchange))
+
+	// Access tokens can be got with a refresh token instead of authenticating, so authentication is up to the handler.
+	router.Handler(http.MethodPost, "/api/v1/tokens", alice.New(app.rateLimitAPI, app.requireDatabaseAPI, app.maintenanceAPI, app.cacheControl(cachePrivate), app.sessionManager.LoadAndSave, requireJSONRequest, app.authenticate, app.authenticateToken).ThenFunc(app.tokensCreate))
+
+	// The OpenAPI document describes every API route above, so that clients can be generated from it, and the docs page
+	// shows the same operations. Neither needs authentication, but trying an operation out from the docs page does.
+	router.Handler(http.MethodGet, "/api/openapi.json", alice.New(app.rateLimitAPI, app.cacheControl(cachePublic)).ThenFunc(app.apiDocs))
+	router.Handler(http.MethodGet, "/api/docs", dynamic.ThenFunc(app.apiDocsPage))
+
+	// The inline availability check is used by the signup form, so it doesn't need authentication. The session is only
+	// loaded so that a logged in user's own details count as available. Rate limiting stops it being used to list accounts.
+	router.Handler(http.MethodGet, "/api/validate", alice.New(app.rateLimitAPI, app.requireDatabaseAPI, app.maintenanceAPI, app.cacheControl(cachePrivate), app.sessionManager.LoadAndSave, app.authenticate).ThenFunc(app.validateField))
 
 	// Create a middleware chain containing our 'standard' middleware
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	// The measureSLO middleware comes before recoverPanic, so that panics are counted as server errors.
+	standard := alice.New(app.setRequestID, app.traceRequests(router), app.measureSLO, app.recoverPanic, app.trustedProxy, app.logRequest, app.secureHeaders)
 
-	// Pass the servemux as the 'next' parameter to the secureHeaders middleware
-	// Because secureHeaders is just a function, and the function returns a
-	// http.Handler we don't need to do anything else.
+	// Wrap the router in the standard middleware chain, which returns a http.Handler.
 	return standard.Then(router)
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/disposable"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/slo"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The jobStats type counts the goroutines started by app.background(), and remembers the last one that panicked.
+// Its zero value is ready to use, and it is safe for concurrent use.
+type jobStats struct {
+	started  atomic.Int64
+	running  atomic.Int64
+	panicked atomic.Int64
+
+	mu        sync.Mutex
+	lastPanic string
+	lastTime  time.Time
+}
+
+func (j *jobStats) recordPanic(err any) {
+	j.panicked.Add(1)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.lastPanic = fmt.Sprint(err)
+	j.lastTime = time.Now()
+}
+
+// The jobStatus type is a snapshot of jobStats, for the runbook template.
+type jobStatus struct {
+	Started   int64
+	Running   int64
+	Panicked  int64
+	LastPanic string
+	LastTime  time.Time
+}
+
+func (j *jobStats) Status() jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return jobStatus{
+		Started:   j.started.Load(),
+		Running:   j.running.Load(),
+		Panicked:  j.panicked.Load(),
+		LastPanic: j.lastPanic,
+		LastTime:  j.lastTime,
+	}
+}
+
+// The runbookFeature type describes a feature which can be turned on or off, either in the configuration or (for the
+// settings on the /admin/settings page) while the application is running.
+type runbookFeature struct {
+	Name    string
+	Enabled bool
+	Detail  string
+}
+
+// The runbookData type holds everything shown on the admin runbook page.
+type runbookData struct {
+	Started       time.Time
+	GoVersion     string
+	UIChecksum    string
+	Settings      []configSetting
+	Features      []runbookFeature
+	SchemaVersion int
+	SchemaDirty   bool
+	SchemaError   string
+	Jobs          jobStatus
+	Disposable    disposable.Status
+	SLO           slo.Snapshot
+}
+
+// runbookFeatures lists the state of each optional feature.
+func (app *application) runbookFeatures() []runbookFeature {
+	cfg := app.config
+	site := app.site()
+
+	return []runbookFeature{
+		{Name: "Debug mode", Enabled: cfg.debug},
+		{Name: "Maintenance mode", Enabled: app.inMaintenance(), Detail: cfg.maintenance.file},
+		{Name: "Let's Encrypt certificates", Enabled: cfg.autocert.enabled},
+		{Name: "Rate limiting", Enabled: app.limiter != nil, Detail: fmt.Sprintf("%d requests per %s", cfg.ratelimit.requests, cfg.ratelimit.window)},
+		{Name: "Block disposable email addresses", Enabled: site.BlockDisposableEmails},
+		{Name: "Password breach check", Enabled: app.passwordPolicy.BreachCheck},
+		{Name: "Form spam protection", Enabled: app.antibot != nil, Detail: fmt.Sprintf("%s to %s", cfg.antibot.minDelay, cfg.antibot.maxAge)},
+		{Name: "Signup CAPTCHA", Enabled: app.captcha != nil, Detail: cfg.captcha.provider},
+		{Name: "OpenID Connect login", Enabled: app.oidc != nil, Detail: cfg.oidc.issuer},
+		{Name: "Snippet linting", Enabled: app.linter != nil},
+		{Name: "Read replicas", Enabled: app.replicas != nil, Detail: fmt.Sprintf("%d of %d up", app.replicas.Up(), app.replicas.Len())},
+		{Name: "Shared Redis cache", Enabled: cfg.queryCache.redisAddr != "", Detail: cfg.queryCache.redisAddr},
+		{Name: "CDN purging", Enabled: app.purger != nil, Detail: cfg.cdn.provider},
+		{Name: "Sentry error reporting", Enabled: app.reporter != nil, Detail: cfg.sentry.environment},
+		{Name: "OpenTelemetry tracing", Enabled: app.tracer != nil, Detail: app.tracer.Endpoint()},
+		{Name: "Metrics endpoint", Enabled: cfg.metrics.enabled, Detail: "/metrics"},
+		{Name: "Profiling without logging in", Enabled: cfg.debug, Detail: "/debug/pprof/ and /debug/vars are admin-only otherwise"},
+		{Name: "Shared drafts (experimental)", Enabled: cfg.collab.enabled, Detail: fmt.Sprintf("saved every %s", cfg.collab.saveInterval)},
+		{Name: "Failed login alerts", Enabled: site.FailedLoginAlertThreshold > 0, Detail: fmt.Sprintf("at %d", site.FailedLoginAlertThreshold)},
+		{Name: "Server error alerts", Enabled: site.ServerErrorAlertThreshold > 0, Detail: fmt.Sprintf("at %d", site.ServerErrorAlertThreshold)},
+	}
+}
+
+// adminRunbook shows the state of the running application in one place, for working out what's wrong during an incident:
+// the effective configuration (with secrets redacted), which features are turned on, the database schema version, and
+// the background jobs. A failure to read the schema version is shown on the page rather than failing it, because the
+// page is most useful when something is broken.
+func (app *application) adminRunbook(w http.ResponseWriter, r *http.Request) {
+	runbook := runbookData{
+		Started:    app.started,
+		GoVersion:  runtime.Version(),
+		UIChecksum: app.assets.ShortChecksum(),
+		Settings:   app.config.snapshot,
+		Features:   app.runbookFeatures(),
+		Jobs:       app.jobs.Status(),
+		Disposable: app.disposable.Status(),
+		SLO:        app.slo.Snapshot(),
+	}
+
+	version, dirty, err := app.schema.Version()
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		runbook.SchemaError = "no migrations have been recorded"
+	case err != nil:
+		runbook.SchemaError = err.Error()
+	default:
+		runbook.SchemaVersion = version
+		runbook.SchemaDirty = dirty
+	}
+
+	data := app.newTemplateData(r)
+	data.Runbook = runbook
+
+	app.render(w, r, http.StatusOK, "admin_runbook.gohtml", data)
+}
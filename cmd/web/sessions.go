@@ -0,0 +1,165 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"net/http"
+	"time"
+)
+
+// How often a session's entry in the user_sessions index is updated, at most. Updating it on every request would mean a
+// database write for every page view, and the sessions page only needs to be roughly right.
+const sessionTouchInterval = time.Minute
+
+// touchSession records that the session in the request is in use by the given user, so it shows up on their sessions page.
+// Errors are logged rather than failing the request, because the index is only there for the user's information.
+func (app *application) touchSession(r *http.Request, userID int) {
+	seen := app.sessionManager.GetInt64(r.Context(), "sessionSeen")
+	if time.Since(time.Unix(seen, 0)) < sessionTouchInterval {
+		return
+	}
+
+	token := app.sessionManager.Token(r.Context())
+	if token == "" {
+		return
+	}
+
+	err := app.sessions.Touch(token, userID, r.UserAgent(), clientIP(r))
+	if err != nil {
+		app.errorLog.Printf("[%s] recording session: %s", requestID(r), err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "sessionSeen", time.Now().Unix())
+}
+
+// userSessions returns the user's sessions which are still live in the session store, most recently used first. Entries
+// in the index whose session has expired, or been destroyed by logging out, are removed as they're found.
+func (app *application) userSessions(userID int) ([]*models.Session, error) {
+	all, err := app.sessions.AllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var live []*models.Session
+	for _, s := range all {
+		_, found, err := app.sessionManager.Store.Find(s.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			err = app.sessions.Delete(s.Token)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		live = append(live, s)
+	}
+
+	return live, nil
+}
+
+// destroySession logs out one of a user's sessions, by deleting it from the session store as well as the index.
+func (app *application) destroySession(s *models.Session) error {
+	err := app.sessionManager.Store.Delete(s.Token)
+	if err != nil {
+		return err
+	}
+
+	return app.sessions.Delete(s.Token)
+}
+
+// destroyUserSessions logs the user out everywhere, except for the session with the given token (which can be "" to
+// log them out of every session).
+func (app *application) destroyUserSessions(userID int, exceptToken string) (int, error) {
+	sessions, err := app.userSessions(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, s := range sessions {
+		if s.Token == exceptToken {
+			continue
+		}
+
+		err = app.destroySession(s)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// accountSessions lists the places where the user is logged in, with the one they're using now marked.
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.userSessions(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	data.CurrentSessionID = models.SessionID(app.sessionManager.Token(r.Context()))
+
+	app.render(w, r, http.StatusOK, "sessions.gohtml", data)
+}
+
+// accountSessionRevokePost logs out one of the user's other sessions. Sessions are looked up among the user's own, so
+// an ID belonging to somebody else gives a 404, as if it didn't exist.
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id := r.PostForm.Get("id")
+
+	// The page doesn't offer to revoke the current session. That's what the logout button is for.
+	if id == models.SessionID(app.sessionManager.Token(r.Context())) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := app.userSessions(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, s := range sessions {
+		if s.ID != id {
+			continue
+		}
+
+		err = app.destroySession(s)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", "That session has been logged out")
+		http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+		return
+	}
+
+	app.notFound(w, r)
+}
+
+// accountSessionsRevokeOthersPost logs out all of the user's sessions except the current one.
+func (app *application) accountSessionsRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	_, err := app.destroyUserSessions(app.authenticatedUserID(r), app.sessionManager.Token(r.Context()))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "All your other sessions have been logged out")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"net/http"
+	"time"
+)
+
+// Every page shows the site settings, so they're cached rather than read from the database for each request. Saving
+// them drops the cached copy, so a change shows up straight away on this server, and within the TTL on the others
+// (unless they share the cache in Redis, when it's straight away on those too).
+const (
+	siteCacheKey = "site:settings"
+	siteCacheTTL = 30 * time.Second
+)
+
+// The longest site name that admins can enter.
+const maxSiteNameLength = 50
+
+// site returns the site settings. They're on every page, including the error pages, so if they can't be loaded the
+// defaults from the configuration are used rather than failing the request. While the database is down, it isn't asked
+// at all.
+func (app *application) site() models.SiteSettings {
+	if app.dbHealth.Down() {
+		return app.config.siteDefaults()
+	}
+
+	s, err := cached(app, siteCacheKey, siteCacheTTL, app.siteSettings.Get)
+	if err != nil {
+		app.errorLog.Printf("loading the site settings: %s", err)
+		return app.config.siteDefaults()
+	}
+
+	return s
+}
+
+// dropSiteCache drops the cached copy of the site settings after they've been saved, so that the change shows up
+// straight away on this server.
+func (app *application) dropSiteCache(r *http.Request) {
+	err := app.cache.Delete(siteCacheKey)
+	if err != nil {
+		app.errorLog.Printf("[%s] clearing the cached site settings: %s", requestID(r), err)
+	}
+}
+
+// signupEnabled reports whether new users can sign up. When they can't, it sends the visitor to the login page with a
+// flash message saying so.
+func (app *application) signupEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if app.site().SignupEnabled {
+		return true
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Signups are closed at the moment")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	return false
+}
@@ -1,41 +1,286 @@
 package main
 
 import (
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/captcha"
+	"github.com/0xshiku/snippetbox/internal/lint"
 	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
 	"github.com/0xshiku/snippetbox/ui"
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 )
 
 // Define a templateData type to act as the holding structure for any dynamic data that we want to pass to our HTML templates
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
-	Form            any
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
-	User            *models.User
+	CurrentYear       int
+	Snippet           *models.Snippet
+	Snippets          []*models.Snippet
+	Form              any
+	Flash             string
+	IsAuthenticated   bool
+	CSRFToken         string
+	CSPNonce          string
+	User              *models.User
+	Pagination        pagination
+	PairingCode       string
+	RetryAfter        int
+	RequestID         string
+	Debug             *debugInfo
+	AssetsChecksum    string
+	PasswordRules     []string
+	TwoFactor         twoFactorData
+	Location          *time.Location
+	Locale            string
+	Locales           []locale
+	Remotes           []*models.Remote
+	Mirrors           []*models.Mirror
+	LintWarnings      []lint.Warning
+	Format            formatData
+	Compare           compareData
+	Sessions          []*models.Session
+	CurrentSessionID  string
+	Runbook           runbookData
+	GuestLifetime     time.Duration
+	Reactions         []models.ReactionCount
+	Home              []homeSection
+	FormToken         string
+	Captcha           *captcha.Widget
+	OIDCName          string
+	Notifications     []*models.Notification
+	Unread            int
+	NotificationKinds []notificationKind
+	Unsubscribe       unsubscribeData
+	Follow            followData
+	Feed              []*models.FeedEntry
+	Batch             batchData
+	Webhooks          webhookData
+	SharedDrafts      sharedDraftData
+	CollabEnabled     bool
+	Trash             trashData
+	APIOperations     []apiOperation
+	IsOwner           bool
+	ImpersonatedUser  string
+	Maintenance       bool
+	Site              models.SiteSettings
+	Announcement      announcementData
 }
 
-// Create a humanDate function which returns a nicely formatted string representation of a time.Time object
+// HumanDate formats a time for the person viewing the page, in their timezone and locale. Templates call it as
+// {{$.HumanDate .Created}}, so that it works inside {{range}} and {{with}} blocks too.
+func (td *templateData) HumanDate(t time.Time) string {
+	return formatDate(t, td.Location, td.Locale)
+}
+
+// The pagination type holds the position in a paginated list, along with helper methods which are easy to call from templates.
+type pagination struct {
+	Page    int
+	HasNext bool
+}
+
+func (p pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p pagination) Prev() int {
+	return p.Page - 1
+}
+
+func (p pagination) Next() int {
+	return p.Page + 1
+}
+
+// The locale type describes one of the ways of writing dates that users can choose from.
+type locale struct {
+	Tag    string
+	Name   string
+	Layout string
+}
+
+// The locales that users can choose for dates. Go's time package only knows English month names, so the other
+// locales write the month as a number.
+var locales = []locale{
+	{Tag: "en-GB", Name: "English (UK)", Layout: "02 Jan 2006 at 15:04"},
+	{Tag: "en-US", Name: "English (US)", Layout: "Jan 02, 2006 at 3:04 PM"},
+	{Tag: "de-DE", Name: "Deutsch", Layout: "02.01.2006, 15:04"},
+	{Tag: "fr-FR", Name: "Français", Layout: "02/01/2006 15:04"},
+	{Tag: "ja-JP", Name: "日本語", Layout: "2006/01/02 15:04"},
+}
+
+// Example returns a sample date in the locale's format, to show in the list of choices.
+func (l locale) Example() string {
+	return time.Date(2025, time.March, 17, 14, 30, 0, 0, time.UTC).Format(l.Layout)
+}
+
+// The locale used for anonymous visitors, and for users who haven't chosen one.
+const defaultLocale = "en-GB"
+
+// Return the locale with the given tag, and whether there is one.
+func findLocale(tag string) (locale, bool) {
+	for _, l := range locales {
+		if l.Tag == tag {
+			return l, true
+		}
+	}
+	return locale{}, false
+}
+
+// Return the tags of all the locales, like "en-GB".
+func localeTags() []string {
+	tags := make([]string, len(locales))
+	for i, l := range locales {
+		tags[i] = l.Tag
+	}
+	return tags
+}
+
+// Create a humanDate function which returns a nicely formatted string representation of a time.Time object, in UTC.
+// Pages use templateData.HumanDate instead, which follows the viewer's preferences.
 func humanDate(t time.Time) string {
+	return formatDate(t, time.UTC, defaultLocale)
+}
+
+// The humanDuration function formats a period of time in whole days or hours where it can, like "7 days" or "12 hours",
+// rather than the "168h0m0s" that time.Duration.String gives.
+func humanDuration(d time.Duration) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	switch {
+	case d > 0 && d%(24*time.Hour) == 0:
+		return plural(int64(d/(24*time.Hour)), "day")
+	case d > 0 && d%time.Hour == 0:
+		return plural(int64(d/time.Hour), "hour")
+	default:
+		return d.String()
+	}
+}
+
+// The formatDate function formats a time in the given location and locale. A nil location means UTC, and an unknown
+// locale means the default one.
+func formatDate(t time.Time, loc *time.Location, tag string) string {
 	// Return the empty string if time has the zero value
 	if t.IsZero() {
 		return ""
 	}
 
-	// Convert the time to UTC before formatting it.
-	return t.UTC().Format("02 Jan 2006 at 15:04")
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	l, ok := findLocale(tag)
+	if !ok {
+		l, _ = findLocale(defaultLocale)
+	}
+
+	// Convert the time to the viewer's timezone before formatting it.
+	return t.In(loc).Format(l.Layout)
+}
+
+// Timezone data is read from disk every time time.LoadLocation is called, so we keep the locations we've loaded.
+var locationCache sync.Map
+
+// The validTimezone function reports whether name is a timezone that a user can choose. time.LoadLocation accepts "Local",
+// meaning the server's own timezone, and "" for UTC, which aren't things a user should pick.
+func validTimezone(name string) bool {
+	if !validators.NotBlank(name) || !validators.MaxChars(name, 64) || name == "Local" {
+		return false
+	}
+
+	_, err := loadLocation(name)
+	return err == nil
+}
+
+// The loadLocation function returns the location for an IANA timezone name, like "Europe/London".
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locationCache.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locationCache.Store(name, loc)
+	return loc, nil
+}
+
+// The formErrors interface is implemented by every form struct, through the validators.Validator that it embeds.
+type formErrors interface {
+	Errors() []validators.FormError
+}
+
+// FormErrors returns the errors in the page's form, for the error summary at the top of it. Pages without a form, or
+// whose form is valid, get nil.
+func (td *templateData) FormErrors() []validators.FormError {
+	form, ok := td.Form.(formErrors)
+	if !ok {
+		return nil
+	}
+	return form.Errors()
+}
+
+// The fieldAttrs function returns the attributes for a form field, so that the error summary can link to it and screen
+// readers announce its error: the field's id, and if it has an error, aria-invalid and aria-describedby pointing at the
+// error message (which has the id "<field>-error"). Templates call it as <input {{fieldAttrs .Form "title"}} ...>.
+func fieldAttrs(form any, field string) template.HTMLAttr {
+	id := template.HTMLEscapeString(field)
+	attrs := fmt.Sprintf(`id="%s"`, id)
+
+	if f, ok := form.(formErrors); ok {
+		for _, e := range f.Errors() {
+			if e.Field == field {
+				attrs += fmt.Sprintf(` aria-invalid="true" aria-describedby="%s-error"`, id)
+				break
+			}
+		}
+	}
+
+	return template.HTMLAttr(attrs)
+}
+
+// The fieldLabel function turns a form field's name into a label for the error summary, like "Current password" for
+// "currentPassword". Acronyms keep their capitals, so "baseURL" becomes "Base URL".
+func fieldLabel(field string) string {
+	var b strings.Builder
+
+	runes := []rune(field)
+	for i, r := range runes {
+		switch {
+		case i == 0:
+			b.WriteRune(unicode.ToUpper(r))
+		case unicode.IsUpper(r) && unicode.IsLower(runes[i-1]):
+			b.WriteRune(' ')
+			// Only lower case the letter if it starts a word, rather than an acronym.
+			if i+1 == len(runes) || unicode.IsLower(runes[i+1]) {
+				r = unicode.ToLower(r)
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
 }
 
 // Initialise a template.FuncMap object and store it in a global variable. This is essentially  a string-keyed map which acts as lookup between the names of our
 // custom template functions and the functions themselves.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":     humanDate,
+	"humanDuration": humanDuration,
+	"fieldAttrs":    fieldAttrs,
+	"fieldLabel":    fieldLabel,
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -55,15 +300,7 @@ func newTemplateCache() (map[string]*template.Template, error) {
 		// and assign it to the name variable.
 		name := filepath.Base(page)
 
-		// Create a slice containing the filepath patterns for the templates we want to parse.
-		patterns := []string{
-			"html/base.gohtml",
-			"html/partials/*.gohtml",
-			page,
-		}
-
-		// Use ParseFS() instead of ParseFiles() to parse the template files from the ui.Files embedded filesystem
-		ts, err := template.New(name).Funcs(functions).ParseFS(ui.Files, patterns...)
+		ts, err := parsePage(ui.Files, name)
 		if err != nil {
 			return nil, err
 		}
@@ -75,3 +312,17 @@ func newTemplateCache() (map[string]*template.Template, error) {
 	// Return te map
 	return cache, nil
 }
+
+// The parsePage function parses the template set for one page (like 'home.gohtml') from fsys, which holds the contents of
+// the ui directory. In production that's the ui.Files embedded filesystem, but in debug mode it's the directory on disk.
+func parsePage(fsys fs.FS, name string) (*template.Template, error) {
+	// Create a slice containing the filepath patterns for the templates we want to parse.
+	patterns := []string{
+		"html/base.gohtml",
+		"html/partials/*.gohtml",
+		"html/pages/" + name,
+	}
+
+	// Use ParseFS() instead of ParseFiles() to parse the template files from the filesystem
+	return template.New(name).Funcs(functions).ParseFS(fsys, patterns...)
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"github.com/0xshiku/snippetbox/internal/asserts"
+	"html/template"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -44,3 +46,138 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 7 * 24 * time.Hour, want: "7 days"},
+		{d: 24 * time.Hour, want: "1 day"},
+		{d: 12 * time.Hour, want: "12 hours"},
+		{d: time.Hour, want: "1 hour"},
+		{d: 90 * time.Minute, want: "1h30m0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			asserts.Equal(t, humanDuration(tt.d), tt.want)
+		})
+	}
+}
+
+func TestFieldAttrs(t *testing.T) {
+	var form snippetCreateForm
+	form.AddFieldError("title", "This field cannot be blank")
+
+	asserts.Equal(t, fieldAttrs(form, "title"), template.HTMLAttr(`id="title" aria-invalid="true" aria-describedby="title-error"`))
+	asserts.Equal(t, fieldAttrs(form, "content"), template.HTMLAttr(`id="content"`))
+	asserts.Equal(t, fieldAttrs(nil, "title"), template.HTMLAttr(`id="title"`))
+}
+
+func TestFieldLabel(t *testing.T) {
+	asserts.Equal(t, fieldLabel("title"), "Title")
+	asserts.Equal(t, fieldLabel("newPasswordConfirmation"), "New password confirmation")
+	asserts.Equal(t, fieldLabel("baseURL"), "Base URL")
+}
+
+func TestTemplateReload(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Stand in for the ui directory on disk.
+	fsys := fstest.MapFS{
+		"html/base.gohtml":         {Data: []byte(`{{define "base"}}<main>{{template "main" .}}</main>{{end}}`)},
+		"html/partials/nav.gohtml": {Data: []byte(`{{define "nav"}}{{end}}`)},
+		"html/pages/about.gohtml":  {Data: []byte(`{{define "main"}}First version{{end}}`)},
+	}
+	app.templateFS = fsys
+
+	buf, err := app.renderPage("about.gohtml", &templateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asserts.Equal(t, buf.String(), "<main>First version</main>")
+
+	// Editing the file changes the next render, without rebuilding the cache.
+	fsys["html/pages/about.gohtml"] = &fstest.MapFile{Data: []byte(`{{define "main"}}Second version{{end}}`)}
+
+	buf, err = app.renderPage("about.gohtml", &templateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asserts.Equal(t, buf.String(), "<main>Second version</main>")
+
+	// Pages which aren't in the build still fail, as they would in production.
+	_, err = app.renderPage("missing.gohtml", &templateData{})
+	if err == nil {
+		t.Error("got no error for a page which isn't in the cache")
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	newYork, err := loadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tm := time.Date(2024, 3, 17, 18, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		loc    *time.Location
+		locale string
+		want   string
+	}{
+		{
+			name:   "UTC",
+			loc:    time.UTC,
+			locale: "en-GB",
+			want:   "17 Mar 2024 at 18:15",
+		},
+		{
+			name:   "New York in American style",
+			loc:    newYork,
+			locale: "en-US",
+			want:   "Mar 17, 2024 at 2:15 PM",
+		},
+		{
+			name:   "German",
+			loc:    newYork,
+			locale: "de-DE",
+			want:   "17.03.2024, 14:15",
+		},
+		{
+			name:   "No location",
+			locale: "en-GB",
+			want:   "17 Mar 2024 at 18:15",
+		},
+		{
+			name:   "Unknown locale",
+			loc:    time.UTC,
+			locale: "xx-XX",
+			want:   "17 Mar 2024 at 18:15",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := &templateData{Location: tt.loc, Locale: tt.locale}
+			asserts.Equal(t, td.HumanDate(tm), tt.want)
+		})
+	}
+
+	t.Run("Zero time", func(t *testing.T) {
+		asserts.Equal(t, formatDate(time.Time{}, newYork, "en-US"), "")
+	})
+}
+
+func BenchmarkNewTemplateCache(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, err := newTemplateCache()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,23 +2,38 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"github.com/0xshiku/snippetbox/internal/cache"
+	"github.com/0xshiku/snippetbox/internal/disposable"
+	federationmocks "github.com/0xshiku/snippetbox/internal/federation/mocks"
+	"github.com/0xshiku/snippetbox/internal/format"
+	"github.com/0xshiku/snippetbox/internal/lint"
+	mailmocks "github.com/0xshiku/snippetbox/internal/mailer/mocks"
+	"github.com/0xshiku/snippetbox/internal/models"
 	"github.com/0xshiku/snippetbox/internal/models/mocks"
+	"github.com/0xshiku/snippetbox/internal/password"
+	passwordmocks "github.com/0xshiku/snippetbox/internal/password/mocks"
+	webhookmocks "github.com/0xshiku/snippetbox/internal/webhooks/mocks"
+	"github.com/0xshiku/snippetbox/ui"
 	"github.com/alexedwards/scs/v2"
-	"github.com/go-playground/form/v4"
+	"golang.org/x/net/websocket"
 	"html"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
 
-// Define a regular expression which captures the CSRF token value from the HTML for our ser signup page
-var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+)">`)
+// Define a regular expression which captures the CSRF token value from the HTML for our ser signup page.
+// Some of the templates use single quotes for attributes, so both kinds are matched.
+var csrfTokenRX = regexp.MustCompile(`<input type=["']hidden["'] name=["']csrf_token["'] value=["']([^"']+)["']>`)
 
 func extractCSRFToken(t *testing.T, body string) string {
 	// Use the FindStringSubmatch method to extract the token from the HTML body.
@@ -33,15 +48,22 @@ func extractCSRFToken(t *testing.T, body string) string {
 }
 
 // Create a newTestApplication helper which returns an instance of our application struct containing mocked dependencies.
-func newTestApplication(t *testing.T) *application {
+// It takes a testing.TB, so that benchmarks can use it too.
+func newTestApplication(t testing.TB) *application {
 	// Create an instance of the template cache.
 	templateCache, err := newTemplateCache()
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	// And the manifest of the embedded files.
+	assets, err := ui.NewManifest(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// And a form decoder.
-	formDecoder := form.NewDecoder()
+	formDecoder := newFormDecoder()
 
 	// And a session manager instance. Note that we use the same settings as production.
 	// Except that we don't set a Store for the session manager.
@@ -50,15 +72,69 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
-	return &application{
+	// Use the default configuration, as if the application had been started without any flags.
+	cfg, err := loadConfig("web", nil, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Use the default password policy, with the breach check turned on against a mock.
+	passwordPolicy := password.NewPolicy(8)
+	passwordPolicy.MinEntropy = 30
+	passwordPolicy.BreachCheck = true
+
+	// The site settings start with the defaults from the configuration, as they do in production.
+	siteDefaults := cfg.siteDefaults()
+
+	// The users mock shares the two-factor mock, so that users who log in with a recovery code have to set it up again.
+	twoFactor := &mocks.TwoFactorModel{}
+
+	app := &application{
+		config:         cfg,
 		errorLog:       log.New(io.Discard, "", 0),
 		infoLog:        log.New(io.Discard, "", 0),
-		snippets:       &mocks.SnippetModel{}, // Use the mock
-		users:          &mocks.UserModel{},    // Use the mock
+		accessLog:      log.New(io.Discard, "", 0),
+		snippets:       &mocks.SnippetModel{},                  // Use the mock
+		users:          &mocks.UserModel{TwoFactor: twoFactor}, // Use the mock
+		emailChanges:   &mocks.EmailChangeModel{},
+		tokens:         &mocks.TokenModel{},
+		twoFactor:      twoFactor,
+		remotes:        &mocks.RemoteModel{},
+		sessions:       &mocks.SessionModel{},
+		exports:        &mocks.DataExportModel{},
+		reactions:      &mocks.ReactionModel{},
+		notifications:  &mocks.NotificationModel{},
+		siteSettings:   &mocks.SettingsModel{Defaults: &siteDefaults},
+		announcements:  &mocks.AnnouncementModel{},
+		impersonations: &mocks.ImpersonationModel{},
+		preferences:    &mocks.UserPreferencesModel{},
+		follows:        &mocks.FollowModel{},
+		webhooks:       &mocks.WebhookModel{},
+		sharedDrafts:   &mocks.SharedDraftModel{},
+		schema:         &mocks.SchemaModel{},
+		pingDB:         func(context.Context) error { return nil },
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		mailer:         &mailmocks.Mailer{},
+		passwordPolicy: passwordPolicy,
+		breaches:       &passwordmocks.BreachChecker{},
+		disposable:     disposable.New("", ""),
+		alerts:         newAlertCounter(10 * time.Minute),
+		assets:         assets,
+		federation:     &federationmocks.Pusher{},
+		deliverer:      &webhookmocks.Deliverer{},
+		linter:         lint.New(),
+		formatters:     format.New(),
+		slo:            newSLOTracker(cfg),
+		collab:         newCollabHub(),
+		cache:          cache.NewMemory(100),
 	}
+
+	// Operations in a transaction use the same mocks as everything else.
+	app.tx = &mocks.TxModel{Queries: &models.Queries{Snippets: app.snippets, Users: app.users, SharedDrafts: app.sharedDrafts}}
+
+	return app
 }
 
 // Define a custom testServer type which embeds a httptest.Server instance.
@@ -92,7 +168,20 @@ func newTestServer(t *testing.T, h http.Handler) *testServer {
 
 // Implement a get() method on our custom testServer type. This makes a GET request to a given URL path using the test server client, and returns the response status code, headers and body
 func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
-	rs, err := ts.Client().Get(ts.URL + urlPath)
+	return ts.getWithHeaders(t, urlPath, nil)
+}
+
+// The getWithHeaders method is like get(), but also sends the given request headers (for example, If-None-Match).
+func (ts *testServer) getWithHeaders(t *testing.T, urlPath string, header http.Header) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rs, err := ts.Client().Do(req)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -126,3 +215,192 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	// Return the response status, headers and body
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// Create a postJSON method for sending POST requests with a JSON body to the test server.
+func (ts *testServer) postJSON(t *testing.T, urlPath string, body string) (int, http.Header, string) {
+	rs, err := ts.Client().Post(ts.URL+urlPath, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(respBody))
+}
+
+// The testClient type is a user of the test server with its own cookie jar, so that a test can have several users logged in
+// at the same time. It remembers the last CSRF token it saw on a page, and adds it to the forms it posts.
+type testClient struct {
+	client    *http.Client
+	baseURL   string
+	csrfToken string
+}
+
+// Create a newClient method which returns a new testClient for the test server, with an empty cookie jar.
+// Like the test server's own client, it doesn't follow redirects.
+func (ts *testServer) newClient(t *testing.T) *testClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{
+		Transport: ts.Client().Transport,
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &testClient{client: client, baseURL: ts.URL}
+}
+
+// The do method sends a request, reads the response, and remembers any CSRF token in the response body.
+func (c *testClient) do(t *testing.T, req *http.Request) (int, http.Header, string) {
+	rs, err := c.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if matches := csrfTokenRX.FindSubmatch(body); len(matches) == 2 {
+		c.csrfToken = html.UnescapeString(string(matches[1]))
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(body))
+}
+
+func (c *testClient) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.do(t, req)
+}
+
+// The postForm method posts the form, adding a CSRF token unless the form already has one. If the client hasn't seen
+// a token yet, it fetches the login page first to get one.
+func (c *testClient) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	if !form.Has("csrf_token") {
+		if c.csrfToken == "" {
+			c.get(t, "/user/login")
+		}
+		form.Set("csrf_token", c.csrfToken)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+urlPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return c.do(t, req)
+}
+
+// The postFile method uploads a file in a multipart form, along with the client's CSRF token.
+func (c *testClient) postFile(t *testing.T, urlPath, field, filename string, contents []byte) (int, http.Header, string) {
+	if c.csrfToken == "" {
+		c.get(t, "/user/login")
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("csrf_token", c.csrfToken)
+
+	fw, err := mw.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(contents)
+	mw.Close()
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+urlPath, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return c.do(t, req)
+}
+
+// The postJSON method sends a POST request with a JSON body, as the client's logged in user.
+func (c *testClient) postJSON(t *testing.T, urlPath string, body string) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(t, req)
+}
+
+// The mustSignup method signs up a new user, and fails the test if the signup doesn't succeed.
+func (c *testClient) mustSignup(t *testing.T, name, username, email, password string) {
+	form := url.Values{}
+	form.Add("name", name)
+	form.Add("username", username)
+	form.Add("email", email)
+	form.Add("password", password)
+
+	code, _, body := c.postForm(t, "/user/signup", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("signing up as %s: got status %d; want %d\n%s", email, code, http.StatusSeeOther, body)
+	}
+}
+
+// The mustLogin method logs the client in, and fails the test if the login doesn't succeed.
+func (c *testClient) mustLogin(t *testing.T, email, password string) {
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+
+	code, _, body := c.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("logging in as %s: got status %d; want %d\n%s", email, code, http.StatusSeeOther, body)
+	}
+}
+
+// dialDraft opens the WebSocket for a shared draft as the client's user, sending the given Origin header.
+func (c *testClient) dialDraft(t *testing.T, publicID, origin string) (*websocket.Conn, error) {
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := websocket.NewConfig("wss://"+base.Host+"/draft/ws/"+publicID, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.TlsConfig = c.client.Transport.(*http.Transport).TLSClientConfig
+	for _, cookie := range c.client.Jar.Cookies(base) {
+		config.Header.Add("Cookie", cookie.String())
+	}
+
+	return websocket.DialConfig(config)
+}
+
+// receiveDraft reads the next message from a shared draft's WebSocket, failing the test if there isn't one soon.
+func receiveDraft(t *testing.T, ws *websocket.Conn) collabMessage {
+	t.Helper()
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var m collabMessage
+	err := websocket.JSON.Receive(ws, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/jwt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The tokensInput type is the request body for getting an access token. With the refresh_token grant type, the refresh
+// token is swapped for new tokens. Without a grant type, the request has to be authenticated with an API token or the
+// user's session instead.
+type tokensInput struct {
+	GrantType    string `json:"grant_type,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// The tokensResult type holds a new JWT access token, and the refresh token for getting the next one once it expires.
+// Each refresh token can only be used once, because using it gets a new one.
+type tokensResult struct {
+	AccessToken   string    `json:"access_token"`
+	TokenType     string    `json:"token_type"`
+	ExpiresIn     int       `json:"expires_in"`
+	Expiry        time.Time `json:"expiry"`
+	RefreshToken  string    `json:"refresh_token"`
+	RefreshExpiry time.Time `json:"refresh_expiry"`
+}
+
+// tokenUserID returns the ID of the user that a bearer token belongs to. JWT access tokens are checked with the signing
+// keys, without going to the database, and anything else is looked up as an opaque API token. It returns
+// models.ErrNoRecord if the token isn't valid.
+func (app *application) tokenUserID(token string) (int, error) {
+	if app.jwt == nil || !jwt.Is(token) {
+		return app.tokens.GetUserID(models.ScopeAPI, token)
+	}
+
+	claims, err := app.jwt.Verify(token)
+	if err != nil {
+		return 0, models.ErrNoRecord
+	}
+
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, models.ErrNoRecord
+	}
+
+	return id, nil
+}
+
+// The tokensCreate handler issues a short-lived JWT access token and a refresh token. Clients which only need a token now
+// and then can keep using the opaque token from pairing, but the JWT saves a database lookup on every request. Without
+// any -jwt-keys, the route is there (so that it matches the API docs) but always responds with a 404.
+func (app *application) tokensCreate(w http.ResponseWriter, r *http.Request) {
+	if app.jwt == nil {
+		app.apiClientError(w, r, http.StatusNotFound, "access tokens aren't turned on for this server")
+		return
+	}
+
+	var input tokensInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiClientError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var userID int
+
+	switch input.GrantType {
+	case "refresh_token":
+		var v validators.Validator
+		v.CheckField(validators.NotBlank(input.RefreshToken), "refresh_token", "must be provided")
+
+		if !v.Valid() {
+			app.apiFailedValidation(w, r, v.FieldErrors)
+			return
+		}
+
+		// Consume the refresh token, so that a stolen one stops working as soon as either party uses it.
+		userID, err = app.tokens.Consume(models.ScopeRefresh, input.RefreshToken)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.apiClientError(w, r, http.StatusUnauthorized, "invalid or expired refresh token")
+			} else {
+				app.apiModelError(w, r, err)
+			}
+			return
+		}
+
+		// Like API tokens, refresh tokens are kept while an account is suspended, but can't be used.
+		user, err := app.users.Get(userID)
+		if err != nil {
+			app.apiModelError(w, r, err)
+			return
+		}
+		if user.Blocked() {
+			app.apiClientError(w, r, http.StatusForbidden, "your account has been "+user.Status)
+			return
+		}
+		if user.MustEnrollTwoFactor {
+			app.apiClientError(w, r, http.StatusForbidden, "you must set up two-factor authentication again before using the API")
+			return
+		}
+
+	case "":
+		if !app.isAuthenticated(r) {
+			app.apiClientError(w, r, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+		if mustEnrollTwoFactor(r) {
+			app.apiClientError(w, r, http.StatusForbidden, "you must set up two-factor authentication again before using the API")
+			return
+		}
+
+		// Otherwise an access token could be used to get new tokens forever, and would never really expire.
+		if _, token, _ := strings.Cut(r.Header.Get("Authorization"), " "); jwt.Is(token) {
+			app.apiClientError(w, r, http.StatusForbidden, "an access token can't be used to get new tokens")
+			return
+		}
+
+		userID = app.authenticatedUserID(r)
+
+	default:
+		var v validators.Validator
+		v.AddFieldError("grant_type", "must be refresh_token, or left out")
+		app.apiFailedValidation(w, r, v.FieldErrors)
+		return
+	}
+
+	accessToken, expiry, err := app.jwt.Sign(strconv.Itoa(userID), app.config.jwt.ttl)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	refreshToken, err := app.tokens.New(userID, app.config.jwt.refreshTTL, models.ScopeRefresh)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, tokensResult{
+		AccessToken:   accessToken,
+		TokenType:     "Bearer",
+		ExpiresIn:     int(app.config.jwt.ttl.Seconds()),
+		Expiry:        expiry,
+		RefreshToken:  refreshToken.Plaintext,
+		RefreshExpiry: refreshToken.Expiry,
+	}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/tracing"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+)
+
+// The traceRequests middleware starts a span for each request, joining the caller's trace if the request has a
+// traceparent header, and ends it with the response's status. The span is named after the route rather than the path,
+// so that all the requests for snippets are grouped together. It comes straight after setRequestID, so that the span
+// covers the rest of the middleware. The requests that aren't counted for the SLOs (like /metrics and the WebSockets)
+// aren't traced either.
+func (app *application) traceRequests(router *httprouter.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.tracer == nil || routeClass(r.URL.Path) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			name := r.Method
+			route := routePattern(router, r)
+			if route != "" {
+				name += " " + route
+			}
+
+			ctx := tracing.Extract(r.Context(), r.Header)
+			ctx, span := app.tracer.Start(ctx, name, tracing.KindServer,
+				tracing.Attr{Key: "http.request.method", Value: r.Method},
+				tracing.Attr{Key: "url.path", Value: r.URL.Path},
+				tracing.Attr{Key: "http.route", Value: route},
+				tracing.Attr{Key: "snippetbox.request_id", Value: requestID(r)},
+			)
+			defer span.End()
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			span.SetAttributes(tracing.Attr{Key: "http.response.status_code", Value: rec.status})
+			if rec.status >= 500 {
+				span.SetError(errorStatusText(rec.status))
+			}
+		})
+	}
+}
+
+// errorStatusText is the error recorded on the span of a request which failed with a 5xx status.
+type errorStatusText int
+
+func (status errorStatusText) Error() string {
+	return http.StatusText(int(status))
+}
+
+// routePattern returns the route that the request will be handled by, like "/snippet/view/:id", or "" if there isn't
+// one. httprouter only gives back the parameters' values, so the pattern is rebuilt by putting their names back in
+// place of the segments they came from. When a value appears in more than one segment (like /users/users), each choice
+// is looked up in turn, and the right one is the path which the router matches with the names as the values.
+func routePattern(router *httprouter.Router, r *http.Request) string {
+	handle, params, _ := router.Lookup(r.Method, r.URL.Path)
+	if handle == nil {
+		return ""
+	}
+
+	// A catch-all parameter's value is the rest of the path, starting with a slash. It's put back as it was when the
+	// choices are looked up, as it can't be mistaken for another parameter.
+	path, catchAll, rest := r.URL.Path, "", ""
+	if n := len(params); n > 0 && strings.HasPrefix(params[n-1].Value, "/") {
+		rest = params[n-1].Value
+		path = strings.TrimSuffix(path, rest)
+		catchAll = "/*" + params[n-1].Key
+		params = params[:n-1]
+	}
+
+	segments := strings.Split(path, "/")
+
+	var match func(from, next int) bool
+	match = func(from, next int) bool {
+		if next == len(params) {
+			_, found, _ := router.Lookup(r.Method, strings.Join(segments, "/")+rest)
+			for i, p := range params {
+				if i >= len(found) || found[i].Key != p.Key || found[i].Value != ":"+p.Key {
+					return false
+				}
+			}
+			return true
+		}
+
+		for i := from; i < len(segments); i++ {
+			if segments[i] != params[next].Value {
+				continue
+			}
+			segments[i] = ":" + params[next].Key
+			if match(i+1, next+1) {
+				return true
+			}
+			segments[i] = params[next].Value
+		}
+		return false
+	}
+
+	if !match(1, 0) {
+		return ""
+	}
+	return strings.Join(segments, "/") + catchAll
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/interchange"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"io"
+	"net/http"
+	"path"
+	"time"
+)
+
+// The snippetImportForm struct holds the problems with an uploaded archive. The file itself isn't decoded into it,
+// because it's read straight from the multipart form.
+type snippetImportForm struct {
+	validators.Validator `form:"-"`
+}
+
+// accountSnippetsExport sends the user's unexpired snippets in the interchange format, as a ZIP archive holding
+// snippets.jsonl (the same as in a data export), or with ?format=json, as the JSON Lines file on its own.
+func (app *application) accountSnippetsExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "zip" && format != "json" {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The archive is built in memory first, so that a database error can still get a proper error response.
+	var buf bytes.Buffer
+	out := io.Writer(&buf)
+
+	var zw *zip.Writer
+	if format != "json" {
+		zw = zip.NewWriter(&buf)
+		f, err := zw.Create("snippets.jsonl")
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		out = f
+	}
+
+	iw := interchange.NewWriter(out)
+	err := app.snippets.Export(app.authenticatedUserID(r), func(s *models.Snippet, _ string) error {
+		return iw.Write(interchange.FromModel(s, ""))
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("snippets-%s", time.Now().UTC().Format("2006-01-02"))
+	if zw != nil {
+		err = zw.Close()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		filename += ".zip"
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		filename += ".jsonl"
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	buf.WriteTo(w)
+}
+
+func (app *application) accountSnippetsImport(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = snippetImportForm{}
+	app.render(w, r, http.StatusOK, "import.gohtml", data)
+}
+
+// accountSnippetsImportPost adds the snippets in an uploaded archive (either a ZIP archive from an export, or a JSON Lines
+// file) to the user's account. Unlike the API's import, it's all or nothing: if any snippet is invalid, or the snippets
+// wouldn't fit in the user's quota, none of them are imported. Snippets which have already expired are skipped.
+func (app *application) accountSnippetsImportPost(w http.ResponseWriter, r *http.Request) {
+	var form snippetImportForm
+
+	// The limitBody middleware has already stopped uploads bigger than maxImportBytes. They fail the CSRF check, because
+	// noSurf can't read the form to find the token.
+	file, _, err := r.FormFile("archive")
+	if err != nil {
+		if !errors.Is(err, http.ErrMissingFile) {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		form.AddFieldError("archive", "Please choose a file to import")
+		app.renderInvalidForm(w, r, "import.gohtml", &form)
+		return
+	}
+	defer file.Close()
+
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	lines, err := openImport(contents)
+	if err != nil {
+		form.AddFieldError("archive", "This file "+err.Error())
+		app.renderInvalidForm(w, r, "import.gohtml", &form)
+		return
+	}
+
+	quota, err := app.snippetQuota(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var (
+		reader   = interchange.NewReader(lines)
+		now      = time.Now()
+		snippets []*models.Snippet
+		expired  int
+		invalid  int
+	)
+
+	for {
+		s, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var lineErr *interchange.LineError
+		if errors.As(err, &lineErr) {
+			invalid++
+			if invalid <= maxImportErrors {
+				form.AddNonFieldError(lineErr.Error())
+			}
+			continue
+		}
+		if err != nil {
+			form.AddFieldError("archive", "This file can't be read: "+err.Error())
+			app.renderInvalidForm(w, r, "import.gohtml", &form)
+			return
+		}
+
+		if !s.Expires.After(now) {
+			expired++
+			continue
+		}
+
+		if message := quota.checkContent(s.Content); message != "" {
+			invalid++
+			if invalid <= maxImportErrors {
+				form.AddNonFieldError(fmt.Sprintf("snippet %q: content: %s", s.Title, message))
+			}
+			continue
+		}
+
+		snippets = append(snippets, &models.Snippet{
+			Title:      s.Title,
+			Content:    s.Content,
+			Created:    s.Created,
+			Expires:    s.Expires,
+			Visibility: s.Visibility,
+		})
+	}
+
+	if invalid > maxImportErrors {
+		form.AddNonFieldError(fmt.Sprintf("and %d more", invalid-maxImportErrors))
+	}
+
+	// Check the quota for the whole import up front, as it's going to be inserted all at once.
+	for range snippets {
+		if status, message := quota.checkCount(); status != 0 {
+			form.AddNonFieldError(message)
+			break
+		}
+		quota.add()
+	}
+
+	if !form.Valid() {
+		app.renderInvalidForm(w, r, "import.gohtml", &form)
+		return
+	}
+
+	if len(snippets) > 0 {
+		_, err = app.snippets.ImportMany(app.authenticatedUserID(r), snippets)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		visibilities := make([]string, len(snippets))
+		for i, s := range snippets {
+			visibilities[i] = s.Visibility
+		}
+		app.snippetsCreated(visibilities...)
+	}
+
+	flash := fmt.Sprintf("Imported %d snippets", len(snippets))
+	if len(snippets) == 1 {
+		flash = "Imported 1 snippet"
+	}
+	if expired > 0 {
+		flash += fmt.Sprintf(". %d had already expired, so they were skipped", expired)
+	}
+	app.sessionManager.Put(r.Context(), "flash", flash)
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// openImport returns the JSON Lines in an uploaded file. A ZIP archive has to hold a snippets.jsonl file, which is read
+// from wherever it is in the archive, so that a data export still works after it's been unzipped and zipped up again.
+func openImport(contents []byte) (io.Reader, error) {
+	if !bytes.HasPrefix(contents, []byte("PK\x03\x04")) {
+		return bytes.NewReader(contents), nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return nil, errors.New("isn't a valid ZIP archive")
+	}
+
+	for _, f := range zr.File {
+		if path.Base(f.Name) != "snippets.jsonl" {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, errors.New("isn't a valid ZIP archive")
+		}
+		defer rc.Close()
+
+		// The file is small enough to upload, but it could still unzip to far more, so only read as much as we accept.
+		lines, err := io.ReadAll(io.LimitReader(rc, maxImportBytes+1))
+		if err != nil {
+			return nil, errors.New("isn't a valid ZIP archive")
+		}
+		if len(lines) > maxImportBytes {
+			return nil, fmt.Errorf("cannot have more than %d MB of snippets in it", maxImportBytes>>20)
+		}
+
+		return bytes.NewReader(lines), nil
+	}
+
+	return nil, errors.New("doesn't have a snippets.jsonl file in it")
+}
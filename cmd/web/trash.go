@@ -0,0 +1,166 @@
+package main
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/webhooks"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"time"
+)
+
+// The trashData type holds the snippets in the user's trash, and how long they'll stay there, for the trash page.
+type trashData struct {
+	Snippets  []*models.Snippet
+	Retention time.Duration
+}
+
+// The trashForm struct holds the snippet that the user wants to restore or purge from their trash.
+type trashForm struct {
+	ID string `form:"id"`
+}
+
+// snippetDeletePost moves one of the user's snippets to their trash. Anybody else's snippet gives a 404, the same as a
+// snippet which doesn't exist.
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	publicID := params.ByName("id")
+	if publicID == "" || len(publicID) > maxPublicIDLength {
+		app.notFound(w, r)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	// Load the snippet for the webhook payload first, because it can't be loaded by its public ID once it's in the trash.
+	snippet, err := app.snippets.GetByPublicID(publicID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	err = app.snippets.Trash(publicID, userID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.purgeSnippetPages(r, publicID)
+	app.trashEvent(r, webhooks.EventSnippetDeleted, userID, snippet)
+
+	app.sessionManager.Put(r.Context(), "flash", "Your snippet has been moved to the trash")
+
+	http.Redirect(w, r, "/account/trash", http.StatusSeeOther)
+}
+
+func (app *application) accountTrash(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Trashed(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Trash = trashData{Snippets: snippets, Retention: app.config.trash.retention}
+
+	app.render(w, r, http.StatusOK, "trash.gohtml", data)
+}
+
+// accountTrashRestorePost takes a snippet back out of the user's trash. It counts towards their quota again, so they
+// can't restore it if they're at their limit.
+func (app *application) accountTrashRestorePost(w http.ResponseWriter, r *http.Request) {
+	var form trashForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	quota, err := app.snippetQuota(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if status, message := quota.checkCount(); status == http.StatusUnprocessableEntity {
+		app.sessionManager.Put(r.Context(), "flash", message)
+		http.Redirect(w, r, "/account/trash", http.StatusSeeOther)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	// Find the snippet for the webhook payload among the ones in the trash, while it's still there.
+	trashed, err := app.snippets.Trashed(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var snippet *models.Snippet
+	for _, s := range trashed {
+		if s.PublicID == form.ID {
+			snippet = s
+		}
+	}
+
+	err = app.snippets.Restore(form.ID, userID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.purgeSnippetPages(r, form.ID)
+	app.trashEvent(r, webhooks.EventSnippetRestored, userID, snippet)
+
+	app.sessionManager.Put(r.Context(), "flash", "Your snippet has been restored")
+
+	http.Redirect(w, r, "/snippet/view/"+form.ID, http.StatusSeeOther)
+}
+
+// accountTrashPurgePost deletes a snippet in the user's trash for good, without waiting for the background job.
+func (app *application) accountTrashPurgePost(w http.ResponseWriter, r *http.Request) {
+	var form trashForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.snippets.Purge(form.ID, app.authenticatedUserID(r))
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your snippet has been deleted for good")
+
+	http.Redirect(w, r, "/account/trash", http.StatusSeeOther)
+}
+
+// purgeSnippetPages drops any cached copies of the pages which list one of the user's snippets, after it's been moved to
+// or from the trash.
+func (app *application) purgeSnippetPages(r *http.Request, publicID string) {
+	paths := append(snippetPaths(publicID), "/")
+	if user := authenticatedUser(r); user != nil && user.Username != "" {
+		paths = append(paths, "/users/"+user.Username)
+	}
+
+	app.purgeCache(paths...)
+}
+
+// emptyTrash permanently deletes the snippets which have been in the trash for longer than -trash-retention. It's run
+// every -trash-interval by a background job. Errors are logged, and the snippets are tried again next time.
+func (app *application) emptyTrash() {
+	purged, err := app.snippets.PurgeTrash(time.Now().Add(-app.config.trash.retention))
+	if err != nil {
+		app.errorLog.Printf("emptying the trash: %s", err)
+		return
+	}
+
+	if len(purged) > 0 {
+		app.infoLog.Printf("purged %d snippets from the trash", len(purged))
+	}
+}
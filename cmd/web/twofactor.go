@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/totp"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// totpIssuer is the name shown next to the account in authenticator apps.
+const totpIssuer = "Snippetbox"
+
+// Each account can try this many two-factor or recovery codes per window. A 6-digit code can't be guessed in so few
+// tries, and somebody who has just mistyped theirs a few times only has to wait a little while.
+const (
+	twoFactorAttempts      = 5
+	twoFactorAttemptWindow = 15 * time.Minute
+)
+
+// Create a twoFactorCodeForm struct, used for both authenticator codes and recovery codes.
+type twoFactorCodeForm struct {
+	Code                 string `form:"code"`
+	validators.Validator `form:"-"`
+}
+
+type twoFactorDisableForm struct {
+	CurrentPassword      string `form:"currentPassword"`
+	validators.Validator `form:"-"`
+}
+
+// The twoFactorData type holds the details shown on the two-factor authentication pages.
+type twoFactorData struct {
+	Enabled       bool
+	Secret        string
+	URL           string
+	RecoveryCodes []string
+	CodesLeft     int
+}
+
+func (app *application) userLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.pendingTwoFactorUserID(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorCodeForm{}
+	app.render(w, r, http.StatusOK, "login_2fa.gohtml", data)
+}
+
+func (app *application) userLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	id := app.pendingTwoFactorUserID(r)
+	if id == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !app.twoFactorAttemptAllowed(w, r, id, &form, "login_2fa.gohtml") {
+		return
+	}
+
+	secret, err := app.twoFactor.Secret(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form.CheckField(validators.NotBlank(form.Code), "code", "This field cannot be blank")
+	form.CheckField(totp.Validate(secret, form.Code, time.Now()), "code", "This code is incorrect")
+
+	if !form.Valid() {
+		app.recordFailedLogin()
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login_2fa.gohtml", data)
+		return
+	}
+
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.redirectAfterLogin(w, r)
+}
+
+// twoFactorAttemptAllowed counts an attempt at a two-factor or recovery code for the account. Once there have been too
+// many, it shows the form again with an error saying how long to wait, and returns false.
+func (app *application) twoFactorAttemptAllowed(w http.ResponseWriter, r *http.Request, id int, form *twoFactorCodeForm, page string) bool {
+	if app.twoFactorLimiter == nil {
+		return true
+	}
+
+	result := app.twoFactorLimiter.Allow(fmt.Sprintf("user:%d", id))
+	if result.Allowed {
+		return true
+	}
+
+	app.recordFailedLogin()
+	app.infoLog.Printf("[%s] too many two-factor attempts for user %d", requestID(r), id)
+
+	minutes := int(math.Ceil(result.Reset.Minutes()))
+	form.AddFieldError("code", fmt.Sprintf("Too many attempts. Please try again in %d minutes", minutes))
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(result)))
+
+	data := app.newTemplateData(r)
+	data.Form = *form
+	app.render(w, r, http.StatusTooManyRequests, page, data)
+	return false
+}
+
+func (app *application) userLoginRecovery(w http.ResponseWriter, r *http.Request) {
+	if app.pendingTwoFactorUserID(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorCodeForm{}
+	app.render(w, r, http.StatusOK, "login_recovery.gohtml", data)
+}
+
+// userLoginRecoveryPost logs a user in with one of their recovery codes, for when they've lost their authenticator app.
+// Using a recovery code turns two-factor authentication off, and the user has to set it up again (with a new secret
+// and new recovery codes) before they can do anything else. That's recorded against their account rather than in the
+// session, so logging out and back in with just the password doesn't get around it.
+func (app *application) userLoginRecoveryPost(w http.ResponseWriter, r *http.Request) {
+	id := app.pendingTwoFactorUserID(r)
+	if id == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !app.twoFactorAttemptAllowed(w, r, id, &form, "login_recovery.gohtml") {
+		return
+	}
+
+	form.CheckField(validators.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	if form.Valid() {
+		err = app.twoFactor.Recover(id, form.Code)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.recordFailedLogin()
+				form.AddFieldError("code", "This recovery code is incorrect or has already been used")
+			} else {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login_recovery.gohtml", data)
+		return
+	}
+
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "You've logged in with a recovery code. Please set up two-factor authentication again.")
+
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+func (app *application) accountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	secret, err := app.twoFactor.Secret(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+
+	if secret != "" {
+		codesLeft, err := app.twoFactor.RecoveryCodesLeft(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.TwoFactor = twoFactorData{Enabled: true, CodesLeft: codesLeft}
+		data.Form = twoFactorDisableForm{}
+		app.render(w, r, http.StatusOK, "twofactor.gohtml", data)
+		return
+	}
+
+	// Keep the new secret in the session until the user has confirmed it with a code, so that reloading the page
+	// doesn't change the secret they've just scanned.
+	enrollSecret := app.sessionManager.GetString(r.Context(), "totpEnrollSecret")
+	if enrollSecret == "" {
+		enrollSecret, err = totp.GenerateSecret()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "totpEnrollSecret", enrollSecret)
+	}
+
+	data.TwoFactor = twoFactorData{Secret: enrollSecret, URL: totp.URL(totpIssuer, user.Email, enrollSecret)}
+	data.Form = twoFactorCodeForm{}
+	app.render(w, r, http.StatusOK, "twofactor.gohtml", data)
+}
+
+func (app *application) accountTwoFactorEnablePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	enrollSecret := app.sessionManager.GetString(r.Context(), "totpEnrollSecret")
+	if enrollSecret == "" {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	// Check the user can generate codes from the new secret before turning it on, so they can't lock themselves out.
+	form.CheckField(validators.NotBlank(form.Code), "code", "This field cannot be blank")
+	form.CheckField(totp.Validate(enrollSecret, form.Code, time.Now()), "code", "This code is incorrect")
+
+	if !form.Valid() {
+		user, err := app.users.Get(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data := app.newTemplateData(r)
+		data.TwoFactor = twoFactorData{Secret: enrollSecret, URL: totp.URL(totpIssuer, user.Email, enrollSecret)}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "twofactor.gohtml", data)
+		return
+	}
+
+	codes, err := app.twoFactor.Enable(userID, enrollSecret)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "totpEnrollSecret")
+
+	// Show the recovery codes straight away, rather than redirecting, because this is the only time they're available.
+	data := app.newTemplateData(r)
+	data.TwoFactor = twoFactorData{Enabled: true, RecoveryCodes: formatRecoveryCodes(codes)}
+	app.render(w, r, http.StatusOK, "twofactor_codes.gohtml", data)
+}
+
+func (app *application) accountTwoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	var form twoFactorDisableForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validators.NotBlank(form.CurrentPassword), "currentPassword", "This field cannot be blank")
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if form.Valid() {
+		_, err = app.users.Authenticate(user.Email, form.CurrentPassword)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				form.AddFieldError("currentPassword", "Current password is incorrect")
+			} else {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+	}
+
+	if !form.Valid() {
+		codesLeft, err := app.twoFactor.RecoveryCodesLeft(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data := app.newTemplateData(r)
+		data.TwoFactor = twoFactorData{Enabled: true, CodesLeft: codesLeft}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "twofactor.gohtml", data)
+		return
+	}
+
+	err = app.twoFactor.Disable(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication has been turned off")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// formatRecoveryCodes splits each recovery code into two groups of five characters, which are easier to copy down.
+func formatRecoveryCodes(codes []string) []string {
+	formatted := make([]string, len(codes))
+	for i, code := range codes {
+		if len(code) == 10 {
+			code = code[:5] + "-" + code[5:]
+		}
+		formatted[i] = code
+	}
+	return formatted
+}
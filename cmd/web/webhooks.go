@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"github.com/0xshiku/snippetbox/internal/validators"
+	"github.com/0xshiku/snippetbox/internal/webhooks"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How long we wait for a webhook receiver to respond.
+const webhookTimeout = 10 * time.Second
+
+// The number of times to try delivering a payload before giving up on it, and the delay before the first retry, which
+// doubles after each failure. With these values, the last attempt is made about 7.5 minutes after the first.
+const (
+	webhookAttempts   = 5
+	webhookRetryDelay = 30 * time.Second
+)
+
+// How many webhooks each user can add, how many of the latest delivery attempts the webhooks page shows, and how long
+// the delivery log is kept for.
+const (
+	maxWebhooks              = 5
+	webhookDeliveriesPerPage = 50
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+)
+
+// The webhookData type holds the user's webhooks and their delivery log, for the webhooks page. Secret is only set
+// straight after a webhook has been added, because that's the only time it's shown.
+type webhookData struct {
+	Webhooks   []*models.Webhook
+	Deliveries []*models.WebhookDelivery
+	Secret     string
+	SecretURL  string
+}
+
+// The accountWebhookForm struct holds the URL of a new webhook.
+type accountWebhookForm struct {
+	URL                  string `form:"url"`
+	validators.Validator `form:"-"`
+}
+
+func (form *accountWebhookForm) Validate(_ *application) {
+	form.URL = strings.TrimSpace(form.URL)
+
+	form.CheckString("url", form.URL, validators.Required(), validators.Length(255))
+	if err := webhooks.CheckURL(form.URL); err != nil {
+		form.AddFieldError("url", "This field "+err.Error())
+	}
+}
+
+func (app *application) accountWebhooks(w http.ResponseWriter, r *http.Request) {
+	app.renderWebhooks(w, r, http.StatusOK, accountWebhookForm{}, webhookData{})
+}
+
+// renderWebhooks shows the user's webhooks and the latest delivery attempts, along with the form for adding another one.
+func (app *application) renderWebhooks(w http.ResponseWriter, r *http.Request, status int, form accountWebhookForm, hooks webhookData) {
+	userID := app.authenticatedUserID(r)
+
+	var err error
+
+	hooks.Webhooks, err = app.webhooks.AllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	hooks.Deliveries, err = app.webhooks.Deliveries(userID, webhookDeliveriesPerPage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Webhooks = hooks
+
+	app.render(w, r, status, "webhooks.gohtml", data)
+}
+
+func (app *application) accountWebhooksPost(w http.ResponseWriter, r *http.Request) {
+	var form accountWebhookForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Validate(app)
+
+	userID := app.authenticatedUserID(r)
+
+	existing, err := app.webhooks.AllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if len(existing) >= maxWebhooks {
+		form.AddNonFieldError(fmt.Sprintf("You can't have more than %d webhooks. Please remove one first.", maxWebhooks))
+	}
+
+	if !form.Valid() {
+		app.renderWebhooks(w, r, http.StatusUnprocessableEntity, form, webhookData{})
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	_, err = app.webhooks.Insert(userID, form.URL, secret)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateWebhook) {
+			form.AddFieldError("url", "You already have a webhook with this URL")
+			app.renderWebhooks(w, r, http.StatusUnprocessableEntity, form, webhookData{})
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Render the secret directly, rather than redirecting, so that it never needs to be stored in the session. It's only
+	// ever shown this once, like a pairing code.
+	data := webhookData{Secret: secret, SecretURL: form.URL}
+	app.renderWebhooks(w, r, http.StatusOK, accountWebhookForm{}, data)
+}
+
+func (app *application) accountWebhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		ID int `form:"id"`
+	}
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.webhooks.Delete(form.ID, app.authenticatedUserID(r))
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The webhook has been removed")
+
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
+
+// snippetEvent sends a payload about each of the snippets to every webhook that their owner has added. Anonymous
+// snippets don't have anybody to send them to. Like notify, it's a side effect of what the user did, so it happens in
+// the background and errors are only logged.
+//
+// Imported snippets don't cause events, because an import is moving existing snippets between instances rather than
+// creating new ones, and could send hundreds of payloads at once.
+func (app *application) snippetEvent(r *http.Request, event string, userID int, publicIDs ...string) {
+	if userID == 0 || len(publicIDs) == 0 {
+		return
+	}
+
+	app.sendSnippetEvent(r, event, userID, func() []*models.Snippet {
+		snippets := make([]*models.Snippet, 0, len(publicIDs))
+		for _, publicID := range publicIDs {
+			snippet, err := app.snippets.GetByPublicID(publicID)
+			if err != nil {
+				app.errorLog.Printf("loading snippet %s for %s webhooks: %s", publicID, event, err)
+				continue
+			}
+			snippets = append(snippets, snippet)
+		}
+		return snippets
+	})
+}
+
+// trashEvent is snippetEvent for a snippet which has just been moved to or from the trash. The handler loads it before
+// the move, because a snippet in the trash can't be loaded by its public ID.
+func (app *application) trashEvent(r *http.Request, event string, userID int, snippet *models.Snippet) {
+	if userID == 0 || snippet == nil {
+		return
+	}
+
+	app.sendSnippetEvent(r, event, userID, func() []*models.Snippet {
+		return []*models.Snippet{snippet}
+	})
+}
+
+// sendSnippetEvent loads the user's webhooks in the background and, if they have any, loads the snippets and sends a
+// payload about each of them to every webhook.
+func (app *application) sendSnippetEvent(r *http.Request, event string, userID int, load func() []*models.Snippet) {
+	// The snippet URLs in the payloads go back to the host that the request came to, like notification emails do.
+	baseURL := fmt.Sprintf("%s://%s", requestScheme(r), r.Host)
+
+	app.background(func() {
+		hooks, err := app.webhooks.AllForUser(userID)
+		if err != nil {
+			app.errorLog.Printf("loading webhooks for user %d: %s", userID, err)
+			return
+		}
+
+		if len(hooks) == 0 {
+			return
+		}
+
+		for _, snippet := range load() {
+			body, err := json.Marshal(webhooks.Payload{
+				Event: event,
+				Sent:  time.Now().UTC(),
+				Snippet: webhooks.Snippet{
+					ID:         snippet.PublicID,
+					Title:      snippet.Title,
+					Content:    snippet.Content,
+					Visibility: snippet.Visibility,
+					Created:    snippet.Created,
+					Expires:    snippet.Expires,
+					URL:        baseURL + "/snippet/view/" + snippet.PublicID,
+				},
+			})
+			if err != nil {
+				app.errorLog.Printf("encoding %s webhook payload for snippet %s: %s", event, snippet.PublicID, err)
+				continue
+			}
+
+			// Each webhook gets its own goroutine, so that one slow or failing receiver doesn't hold up the others.
+			for _, hook := range hooks {
+				app.background(func() {
+					app.deliverWebhook(hook, event, snippet.PublicID, body)
+				})
+			}
+		}
+	})
+}
+
+// deliverWebhook sends a payload to a webhook, retrying with an increasing delay if the receiver can't be reached or
+// has a temporary problem. Every attempt is recorded in the delivery log, which is pruned afterwards.
+func (app *application) deliverWebhook(hook *models.Webhook, event, publicID string, body []byte) {
+	deliveryID, err := webhooks.NewDeliveryID()
+	if err != nil {
+		app.errorLog.Printf("sending %s webhook %d: %s", event, hook.ID, err)
+		return
+	}
+
+	delay := webhookRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		status, err := app.deliverer.Deliver(hook.URL, hook.Secret, deliveryID, event, body)
+
+		delivery := &models.WebhookDelivery{
+			WebhookID:       hook.ID,
+			Event:           event,
+			SnippetPublicID: publicID,
+			Attempt:         attempt,
+			Status:          status,
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		if recordErr := app.webhooks.RecordDelivery(delivery); recordErr != nil {
+			app.errorLog.Printf("recording delivery of %s webhook %d: %s", event, hook.ID, recordErr)
+		}
+
+		if err == nil || !webhooks.Retryable(status) || attempt == webhookAttempts {
+			break
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	_, err = app.webhooks.PruneDeliveries(time.Now().Add(-webhookDeliveryRetention))
+	if err != nil {
+		app.errorLog.Printf("pruning webhook deliveries: %s", err)
+	}
+}
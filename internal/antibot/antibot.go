@@ -0,0 +1,82 @@
+// Package antibot catches form submissions from simple spam bots. Bots tend to fill in every field they find, and to submit
+// forms as soon as they've loaded them, whereas people can't see a field hidden with CSS, and take a few seconds to fill a
+// form in. So each form gets a honeypot field, which has to be left empty, and a signed token holding the time the form
+// was shown, which has to be old enough (but not too old) when the form comes back.
+package antibot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The names of the form fields. The honeypot is given a name that bots are keen to fill in.
+const (
+	HoneypotField = "website"
+	TokenField    = "form_started"
+)
+
+var (
+	ErrHoneypot     = errors.New("antibot: honeypot field was filled in")
+	ErrInvalidToken = errors.New("antibot: missing or invalid form token")
+	ErrTooFast      = errors.New("antibot: form was submitted too quickly")
+	ErrExpired      = errors.New("antibot: form token has expired")
+)
+
+// Guard makes and checks the form tokens. It is safe for concurrent use.
+type Guard struct {
+	key      []byte
+	minDelay time.Duration
+	maxAge   time.Duration
+	now      func() time.Time
+}
+
+// New returns a Guard which signs tokens with the key. Forms have to be submitted at least minDelay, and at most maxAge,
+// after they were shown. Every instance of the application has to use the same key, or forms shown by one instance
+// won't be accepted by another.
+func New(key []byte, minDelay, maxAge time.Duration) *Guard {
+	return &Guard{key: key, minDelay: minDelay, maxAge: maxAge, now: time.Now}
+}
+
+// Token returns a token holding the current time, for a hidden field in the form.
+func (g *Guard) Token() string {
+	ts := strconv.FormatInt(g.now().Unix(), 10)
+	return ts + "." + g.sign(ts)
+}
+
+// Check returns nil if a form submission looks like it came from a person, or one of the package's errors if it doesn't.
+func (g *Guard) Check(token, honeypot string) error {
+	if honeypot != "" {
+		return ErrHoneypot
+	}
+
+	ts, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(g.sign(ts))) {
+		return ErrInvalidToken
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	age := g.now().Sub(time.Unix(unix, 0))
+	switch {
+	case age < g.minDelay:
+		return ErrTooFast
+	case age > g.maxAge:
+		return ErrExpired
+	}
+
+	return nil
+}
+
+func (g *Guard) sign(ts string) string {
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write([]byte(ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,75 @@
+package antibot
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	g := New([]byte("test key"), 3*time.Second, time.Hour)
+	g.now = func() time.Time { return now }
+
+	token := g.Token()
+
+	tests := []struct {
+		name     string
+		token    string
+		honeypot string
+		after    time.Duration
+		want     error
+	}{
+		{
+			name:  "Valid",
+			token: token,
+			after: 10 * time.Second,
+		},
+		{
+			name:     "Honeypot filled in",
+			token:    token,
+			honeypot: "https://example.com",
+			after:    10 * time.Second,
+			want:     ErrHoneypot,
+		},
+		{
+			name:  "Too fast",
+			token: token,
+			after: time.Second,
+			want:  ErrTooFast,
+		},
+		{
+			name:  "Expired",
+			token: token,
+			after: 2 * time.Hour,
+			want:  ErrExpired,
+		},
+		{
+			name:  "Missing token",
+			after: 10 * time.Second,
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "Changed time",
+			token: "1" + token,
+			after: 10 * time.Second,
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "Signed with another key",
+			token: New([]byte("other key"), 0, time.Hour).Token(),
+			after: 10 * time.Second,
+			want:  ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checked := New([]byte("test key"), 3*time.Second, time.Hour)
+			checked.now = func() time.Time { return now.Add(tt.after) }
+
+			asserts.Equal(t, checked.Check(tt.token, tt.honeypot), tt.want)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package cache keeps the results of expensive queries for a while, so that the busiest pages don't have to go to the
+// database for every request. There's an in-memory LRU cache for a single server, and a Redis one for when several
+// servers should share what they've cached.
+//
+// Values are stored as bytes, so that they can be sent to Redis. Fetch() takes care of encoding them with encoding/gob,
+// which means that only exported fields are kept.
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable is wrapped by the errors that Fetch() returns when the cache itself failed, rather than the load
+// function. The value is still loaded and returned along with the error, so that callers can log it and carry on.
+var ErrUnavailable = errors.New("cache: unavailable")
+
+// Cache is implemented by each backend. Get reports whether the key was found, and a value which has expired counts as
+// not found.
+type Cache interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+}
+
+// Fetch returns the value cached under the key, or calls load and caches what it returns for the ttl. Errors from load
+// are returned without caching anything. Concurrent calls for the same key which miss share one call to load (within
+// this process), so that a burst of requests when a popular value expires doesn't run its query more than once.
+func Fetch[T any](c Cache, key string, ttl time.Duration, load func() (T, error)) (T, error) {
+	var value T
+
+	b, found, err := c.Get(key)
+	if err == nil && found && decode(b, &value) == nil {
+		return value, nil
+	}
+	var cacheErr error
+	if err != nil {
+		cacheErr = fmt.Errorf("%w: getting %q: %w", ErrUnavailable, key, err)
+	}
+
+	b, err = flight(c, key, func() ([]byte, error) {
+		loaded, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		err = gob.NewEncoder(&buf).Encode(&loaded)
+		if err != nil {
+			return nil, err
+		}
+
+		// The value is only useful to the callers waiting for it if the cache can't keep it.
+		setErr := c.Set(key, buf.Bytes(), ttl)
+		if setErr != nil && cacheErr == nil {
+			cacheErr = fmt.Errorf("%w: setting %q: %w", ErrUnavailable, key, setErr)
+		}
+		return buf.Bytes(), nil
+	})
+	if err != nil {
+		return value, err
+	}
+
+	err = decode(b, &value)
+	if err != nil {
+		return value, err
+	}
+
+	return value, cacheErr
+}
+
+func decode(b []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+// A call is a load which is in progress, for the callers which are waiting for it.
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+type flightKey struct {
+	cache Cache
+	key   string
+}
+
+var (
+	flightsMu sync.Mutex
+	flights   = make(map[flightKey]*call)
+)
+
+// flight calls fn, unless there's already a call in progress for the same cache and key, in which case it waits for
+// that one and returns its result instead.
+func flight(c Cache, key string, fn func() ([]byte, error)) ([]byte, error) {
+	k := flightKey{cache: c, key: key}
+
+	flightsMu.Lock()
+	if existing, ok := flights[k]; ok {
+		flightsMu.Unlock()
+		<-existing.done
+		return existing.value, existing.err
+	}
+
+	current := &call{done: make(chan struct{})}
+	flights[k] = current
+	flightsMu.Unlock()
+
+	defer func() {
+		flightsMu.Lock()
+		delete(flights, k)
+		flightsMu.Unlock()
+		close(current.done)
+	}()
+
+	current.value, current.err = fn()
+	return current.value, current.err
+}
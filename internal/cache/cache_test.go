@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory(2)
+	m.now = func() time.Time { return now }
+
+	get := func(key string) string {
+		value, found, err := m.Get(key)
+		asserts.NilError(t, err)
+		if !found {
+			return ""
+		}
+		return string(value)
+	}
+
+	m.Set("a", []byte("1"), time.Minute)
+	m.Set("b", []byte("2"), time.Hour)
+	asserts.Equal(t, get("a"), "1")
+	asserts.Equal(t, get("b"), "2")
+
+	t.Run("Replace", func(t *testing.T) {
+		m.Set("a", []byte("3"), time.Minute)
+		asserts.Equal(t, get("a"), "3")
+		asserts.Equal(t, m.Len(), 2)
+	})
+
+	t.Run("Least recently used is evicted", func(t *testing.T) {
+		// "a" was used last, so "b" makes way for "c".
+		m.Set("c", []byte("4"), time.Hour)
+		asserts.Equal(t, get("b"), "")
+		asserts.Equal(t, get("a"), "3")
+		asserts.Equal(t, get("c"), "4")
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		asserts.Equal(t, get("a"), "")
+		asserts.Equal(t, get("c"), "4")
+		asserts.Equal(t, m.Len(), 1)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		asserts.NilError(t, m.Delete("c", "missing"))
+		asserts.Equal(t, get("c"), "")
+		asserts.Equal(t, m.Len(), 0)
+	})
+}
+
+type item struct {
+	Name  string
+	Count int
+}
+
+// The brokenCache type fails every call, like a Redis server that can't be reached.
+type brokenCache struct{}
+
+var errRefused = errors.New("connection refused")
+
+func (brokenCache) Get(string) ([]byte, bool, error)        { return nil, false, errRefused }
+func (brokenCache) Set(string, []byte, time.Duration) error { return errRefused }
+func (brokenCache) Delete(...string) error                  { return errRefused }
+
+func TestFetch(t *testing.T) {
+	m := NewMemory(10)
+
+	var loads atomic.Int32
+	load := func() ([]*item, error) {
+		loads.Add(1)
+		return []*item{{Name: "a", Count: 1}, {Name: "b", Count: 2}}, nil
+	}
+
+	t.Run("Miss, then hit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			items, err := Fetch(m, "items", time.Minute, load)
+			asserts.NilError(t, err)
+			asserts.Equal(t, len(items), 2)
+			asserts.Equal(t, items[1].Name, "b")
+		}
+		asserts.Equal(t, loads.Load(), int32(1))
+	})
+
+	t.Run("Errors aren't cached", func(t *testing.T) {
+		failed := errors.New("database is down")
+		_, err := Fetch(m, "failing", time.Minute, func() (int, error) { return 0, failed })
+		asserts.Equal(t, err, failed)
+
+		_, found, _ := m.Get("failing")
+		asserts.Equal(t, found, false)
+	})
+
+	t.Run("Concurrent misses share a load", func(t *testing.T) {
+		var calls atomic.Int32
+		release := make(chan struct{})
+		slow := func() (string, error) {
+			calls.Add(1)
+			<-release
+			return "value", nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				value, err := Fetch(m, "slow", time.Minute, slow)
+				if err != nil || value != "value" {
+					t.Errorf("got: %q, %v; want: \"value\", nil", value, err)
+				}
+			}()
+		}
+
+		// Give the other goroutines time to find the load in progress, before letting it finish.
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		asserts.Equal(t, calls.Load(), int32(1))
+	})
+
+	t.Run("Cache unavailable", func(t *testing.T) {
+		loads.Store(0)
+		items, err := Fetch(brokenCache{}, "items", time.Minute, load)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Errorf("got: %v; want: %v", err, ErrUnavailable)
+		}
+		asserts.Equal(t, len(items), 2)
+		asserts.Equal(t, loads.Load(), int32(1))
+	})
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Memory is an in-memory cache which holds up to a fixed number of values, throwing away the least recently used one to
+// make room for a new one. It is safe for concurrent use.
+type Memory struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Most recently used at the front.
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+// NewMemory returns a Memory cache which holds up to size values.
+func NewMemory(size int) *Memory {
+	return &Memory{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get returns the value cached under the key, if there is one and it hasn't expired.
+func (m *Memory) Get(key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	e := el.Value.(*entry)
+	if !m.now().Before(e.expires) {
+		m.order.Remove(el)
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+
+	m.order.MoveToFront(el)
+	return e.value, true, nil
+}
+
+// Set caches the value under the key for the ttl, replacing whatever was there.
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires := m.now().Add(ttl)
+
+	if el, ok := m.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		m.order.MoveToFront(el)
+		return nil
+	}
+
+	m.entries[key] = m.order.PushFront(&entry{key: key, value: value, expires: expires})
+
+	for m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*entry).key)
+	}
+
+	return nil
+}
+
+// Delete removes the keys from the cache. Keys which aren't there are ignored.
+func (m *Memory) Delete(keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := m.entries[key]; ok {
+			m.order.Remove(el)
+			delete(m.entries, key)
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of values in the cache, including any which have expired but haven't been thrown away yet.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.order.Len()
+}
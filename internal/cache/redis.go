@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// maxIdleConns is how many connections the Redis cache keeps open between commands.
+const maxIdleConns = 4
+
+// Redis is a cache kept in a Redis server, which several servers can share. It speaks just enough of the Redis protocol
+// (RESP) for GET, SET and DEL, and keeps a few connections open between commands. It is safe for concurrent use.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewRedis returns a cache which uses the Redis server at addr (host:port), logging in with the password (if it isn't
+// empty) and using database db. The prefix is put in front of every key, so that the server can be shared with other
+// applications. Each command has to finish within the timeout.
+func NewRedis(addr, password string, db int, prefix string, timeout time.Duration) *Redis {
+	return &Redis{
+		addr:     addr,
+		password: password,
+		db:       db,
+		prefix:   prefix,
+		timeout:  timeout,
+		idle:     make(chan *redisConn, maxIdleConns),
+	}
+}
+
+// Get returns the value cached under the key, if there is one. Redis throws values away itself when they expire.
+func (c *Redis) Get(key string) ([]byte, bool, error) {
+	reply, err := c.do("GET", c.prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("cache: unexpected reply to GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set caches the value under the key for the ttl, which is rounded to the millisecond.
+func (c *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+
+	_, err := c.do("SET", c.prefix+key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// Delete removes the keys from the cache.
+func (c *Redis) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, c.prefix+key)
+	}
+
+	_, err := c.do(args...)
+	return err
+}
+
+// Close closes the idle connections.
+func (c *Redis) Close() error {
+	for {
+		select {
+		case rc := <-c.idle:
+			rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns the reply, which is a string for simple strings, an int64 for integers, a []byte for
+// bulk strings (or nil for a missing value) and a []any for arrays. Replies which are errors are returned as errors.
+func (c *Redis) do(args ...string) (any, error) {
+	rc, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := rc.do(c.timeout, args...)
+	if err != nil {
+		// An error reply leaves the connection ready for the next command, but anything else might not have.
+		var replyErr redisError
+		if !errors.As(err, &replyErr) {
+			rc.conn.Close()
+			return nil, err
+		}
+	}
+
+	select {
+	case c.idle <- rc:
+	default:
+		rc.conn.Close()
+	}
+
+	return reply, err
+}
+
+// conn returns an idle connection, or opens a new one.
+func (c *Redis) conn() (*redisConn, error) {
+	select {
+	case rc := <-c.idle:
+		return rc, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if c.password != "" {
+		_, err = rc.do(c.timeout, "AUTH", c.password)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if c.db != 0 {
+		_, err = rc.do(c.timeout, "SELECT", strconv.Itoa(c.db))
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return rc, nil
+}
+
+// redisError is an error reply from the server, like "ERR unknown command".
+type redisError string
+
+func (e redisError) Error() string {
+	return "cache: redis: " + string(e)
+}
+
+func (rc *redisConn) do(timeout time.Duration, args ...string) (any, error) {
+	err := rc.conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	// Commands are sent as an array of bulk strings.
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+
+	_, err = rc.conn.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return rc.readReply()
+}
+
+func (rc *redisConn) readReply() (any, error) {
+	line, err := rc.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("cache: empty reply from redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("cache: bad bulk string length from redis: %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		b := make([]byte, n+2)
+		_, err = io.ReadFull(rc.r, b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("cache: bad array length from redis: %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		items := make([]any, n)
+		for i := range items {
+			items[i], err = rc.readReply()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("cache: unexpected reply from redis: %q", line)
+	}
+}
+
+// readLine reads a line of the reply, without the CRLF at the end.
+func (rc *redisConn) readLine() (string, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("cache: malformed line from redis: %q", line)
+	}
+	return line[:len(line)-2], nil
+}
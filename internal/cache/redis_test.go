@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The fakeRedis type is a Redis server which understands the commands that the cache sends, and keeps a log of them.
+type fakeRedis struct {
+	net.Listener
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &fakeRedis{Listener: l, values: map[string]string{}}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, password)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeRedis) serve(conn net.Conn, password string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			if args[1] == password {
+				authed, reply = true, "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			value, ok := s.values[args[1]]
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			s.values[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case args[0] == "DEL":
+			n := 0
+			for _, key := range args[1:] {
+				if _, ok := s.values[key]; ok {
+					delete(s.values, key)
+					n++
+				}
+			}
+			reply = fmt.Sprintf(":%d\r\n", n)
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+
+		conn.Write([]byte(reply))
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+
+	args := make([]string, n)
+	for i := range args {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+
+		b := make([]byte, size+2)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+
+	return args, nil
+}
+
+func TestRedis(t *testing.T) {
+	s := newFakeRedis(t, "s3cret")
+	c := NewRedis(s.Addr().String(), "s3cret", 2, "snippetbox:", time.Second)
+	defer c.Close()
+
+	_, found, err := c.Get("missing")
+	asserts.NilError(t, err)
+	asserts.Equal(t, found, false)
+
+	// Binary values, with CRLFs in them, have to survive the trip.
+	asserts.NilError(t, c.Set("home", []byte("a\r\nb\x00c"), 90*time.Second))
+
+	value, found, err := c.Get("home")
+	asserts.NilError(t, err)
+	asserts.Equal(t, found, true)
+	asserts.Equal(t, string(value), "a\r\nb\x00c")
+
+	asserts.NilError(t, c.Delete("home", "missing"))
+
+	_, found, err = c.Get("home")
+	asserts.NilError(t, err)
+	asserts.Equal(t, found, false)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The connection is set up once, and then reused for every command.
+	asserts.Equal(t, s.commands[0], "AUTH s3cret")
+	asserts.Equal(t, s.commands[1], "SELECT 2")
+	asserts.Equal(t, s.commands[3], "SET snippetbox:home a\r\nb\x00c PX 90000")
+	asserts.Equal(t, len(s.commands), 7)
+}
+
+func TestRedisErrors(t *testing.T) {
+	s := newFakeRedis(t, "s3cret")
+
+	t.Run("Wrong password", func(t *testing.T) {
+		c := NewRedis(s.Addr().String(), "guessed", 0, "", time.Second)
+		_, _, err := c.Get("home")
+		if err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+			t.Errorf("got: %v; want: a WRONGPASS error", err)
+		}
+	})
+
+	t.Run("No server", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := l.Addr().String()
+		l.Close()
+
+		c := NewRedis(addr, "", 0, "", time.Second)
+		_, _, err = c.Get("home")
+		if err == nil {
+			t.Error("got: nil; want: error")
+		}
+	})
+}
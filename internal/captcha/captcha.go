@@ -0,0 +1,167 @@
+// Package captcha checks CAPTCHA challenges on the server. hCaptcha, Cloudflare Turnstile and Google reCAPTCHA all work the
+// same way: a script on the page turns a placeholder into the challenge, which adds a response token to the form, and the
+// server sends the token to the service's siteverify endpoint to find out whether the user passed.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrFailed is returned by Verify when the user didn't pass the challenge, or didn't try it.
+var ErrFailed = errors.New("captcha: challenge failed")
+
+// Challenge is a CAPTCHA service. Other services can be added by implementing it.
+type Challenge interface {
+	// Widget returns what a page needs to show the challenge.
+	Widget() Widget
+	// Verify checks the response that the challenge added to the form. It returns ErrFailed if the user didn't pass,
+	// and other errors if the check couldn't be made.
+	Verify(ctx context.Context, response, remoteIP string) error
+}
+
+// Widget describes how to show a challenge on a page: a div with the class and the site key in its data-sitekey attribute,
+// and the script, which puts the response in the named form field. Sources are the origins that the
+// Content-Security-Policy has to allow scripts and frames from.
+type Widget struct {
+	ScriptURL string
+	Class     string
+	SiteKey   string
+	Field     string
+	Sources   []string
+}
+
+// The services that New knows about, along with their siteverify endpoints.
+var providers = map[string]struct {
+	widget    Widget
+	verifyURL string
+}{
+	"hcaptcha": {
+		widget: Widget{
+			ScriptURL: "https://js.hcaptcha.com/1/api.js",
+			Class:     "h-captcha",
+			Field:     "h-captcha-response",
+			Sources:   []string{"https://hcaptcha.com", "https://*.hcaptcha.com"},
+		},
+		verifyURL: "https://api.hcaptcha.com/siteverify",
+	},
+	"turnstile": {
+		widget: Widget{
+			ScriptURL: "https://challenges.cloudflare.com/turnstile/v0/api.js",
+			Class:     "cf-turnstile",
+			Field:     "cf-turnstile-response",
+			Sources:   []string{"https://challenges.cloudflare.com"},
+		},
+		verifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	},
+	"recaptcha": {
+		widget: Widget{
+			ScriptURL: "https://www.google.com/recaptcha/api.js",
+			Class:     "g-recaptcha",
+			Field:     "g-recaptcha-response",
+			Sources:   []string{"https://www.google.com/recaptcha/", "https://www.gstatic.com/recaptcha/", "https://recaptcha.google.com/recaptcha/"},
+		},
+		verifyURL: "https://www.google.com/recaptcha/api/siteverify",
+	},
+}
+
+// Known reports whether New knows about the named service.
+func Known(provider string) bool {
+	_, ok := providers[provider]
+	return ok
+}
+
+// Sources returns the origins that the named service's script and frames are loaded from, or nil for an unknown service.
+func Sources(provider string) []string {
+	return providers[provider].widget.Sources
+}
+
+// SiteVerify is a Challenge for a service with a siteverify endpoint.
+type SiteVerify struct {
+	Client    *http.Client
+	VerifyURL string
+	Secret    string
+	widget    Widget
+}
+
+// New returns the Challenge for the named service ("hcaptcha", "turnstile" or "recaptcha"), which gives up on a
+// verification after the timeout.
+func New(provider, siteKey, secret string, timeout time.Duration) (*SiteVerify, error) {
+	p, ok := providers[provider]
+	if !ok {
+		return nil, fmt.Errorf("captcha: unknown provider %q", provider)
+	}
+
+	widget := p.widget
+	widget.SiteKey = siteKey
+
+	return &SiteVerify{
+		Client:    &http.Client{Timeout: timeout},
+		VerifyURL: p.verifyURL,
+		Secret:    secret,
+		widget:    widget,
+	}, nil
+}
+
+func (c *SiteVerify) Widget() Widget {
+	return c.widget
+}
+
+func (c *SiteVerify) Verify(ctx context.Context, response, remoteIP string) error {
+	// A missing response means the user didn't try the challenge, so there's no need to ask the service.
+	if strings.TrimSpace(response) == "" {
+		return ErrFailed
+	}
+
+	form := url.Values{
+		"secret":   {c.Secret},
+		"response": {response},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha: unexpected status from siteverify: %s", resp.Status)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("captcha: decoding siteverify response: %w", err)
+	}
+
+	if !result.Success {
+		// A bad secret is our mistake, not the user's, so it mustn't look like a failed challenge.
+		for _, code := range result.ErrorCodes {
+			if code == "invalid-input-secret" || code == "missing-input-secret" {
+				return fmt.Errorf("captcha: siteverify rejected the secret: %s", code)
+			}
+		}
+		return ErrFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package captcha
+
+import (
+	"context"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSiteVerify(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case r.PostForm.Get("secret") != "SECRET":
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-secret"]}`))
+		case r.PostForm.Get("response") == "good" && r.PostForm.Get("remoteip") == "192.0.2.1":
+			w.Write([]byte(`{"success": true}`))
+		case r.PostForm.Get("response") == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+		}
+	}))
+	defer ts.Close()
+
+	c, err := New("turnstile", "SITEKEY", "SECRET", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.VerifyURL = ts.URL
+
+	asserts.Equal(t, c.Widget().SiteKey, "SITEKEY")
+	asserts.Equal(t, c.Widget().Field, "cf-turnstile-response")
+
+	tests := []struct {
+		name     string
+		response string
+		wantErr  error
+		wantFail bool
+	}{
+		{name: "Passed", response: "good"},
+		{name: "Failed", response: "bad", wantErr: ErrFailed},
+		{name: "Missing", response: "", wantErr: ErrFailed},
+		{name: "Service error", response: "broken", wantFail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Verify(context.Background(), tt.response, "192.0.2.1")
+
+			if tt.wantFail {
+				if err == nil || err == ErrFailed {
+					t.Errorf("got %v; want a service error", err)
+				}
+				return
+			}
+			asserts.Equal(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		c.Secret = "WRONG"
+
+		err := c.Verify(context.Background(), "good", "192.0.2.1")
+		if err == nil || err == ErrFailed {
+			t.Errorf("got %v; want a configuration error", err)
+		}
+	})
+
+	t.Run("Unknown provider", func(t *testing.T) {
+		_, err := New("mystery", "SITEKEY", "SECRET", time.Second)
+		if err == nil {
+			t.Error("got no error for an unknown provider")
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package mocks
+
+import (
+	"context"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/captcha"
+)
+
+// Challenge passes the response "passed", and fails for "unavailable" as if the service were down. Anything else is a
+// failed challenge.
+type Challenge struct{}
+
+func (c *Challenge) Widget() captcha.Widget {
+	return captcha.Widget{
+		ScriptURL: "https://captcha.example.com/api.js",
+		Class:     "mock-captcha",
+		SiteKey:   "SITEKEY",
+		Field:     "captcha-response",
+	}
+}
+
+func (c *Challenge) Verify(ctx context.Context, response, remoteIP string) error {
+	switch response {
+	case "passed":
+		return nil
+	case "unavailable":
+		return errors.New("captcha service unavailable")
+	default:
+		return captcha.ErrFailed
+	}
+}
@@ -0,0 +1,163 @@
+// Package cdn purges pages from a CDN's cache, so that visitors stop seeing a cached copy of a snippet after it has changed
+// or been deleted. Each provider has its own purge API, so they're hidden behind the Purger interface.
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The providers that New() knows about.
+const (
+	ProviderCloudflare = "cloudflare"
+	ProviderFastly     = "fastly"
+)
+
+// Purger removes the given absolute URLs from a CDN's cache.
+type Purger interface {
+	Purge(ctx context.Context, urls []string) error
+}
+
+// New returns a Purger for the named provider. For Cloudflare, zone is the zone ID and token is an API token with the
+// Cache Purge permission. Fastly doesn't need a zone, as purging by URL only needs an API token.
+// An empty provider returns a nil Purger, meaning that there isn't a CDN to purge.
+func New(provider, zone, token string, timeout time.Duration) (Purger, error) {
+	client := &http.Client{Timeout: timeout}
+
+	switch provider {
+	case "":
+		return nil, nil
+	case ProviderCloudflare:
+		if zone == "" || token == "" {
+			return nil, fmt.Errorf("cdn: %s needs a zone ID and an API token", provider)
+		}
+		return &Cloudflare{Endpoint: cloudflareEndpoint, ZoneID: zone, Token: token, Client: client}, nil
+	case ProviderFastly:
+		if token == "" {
+			return nil, fmt.Errorf("cdn: %s needs an API token", provider)
+		}
+		return &Fastly{Endpoint: fastlyEndpoint, Token: token, Client: client}, nil
+	default:
+		return nil, fmt.Errorf("cdn: unknown provider %q", provider)
+	}
+}
+
+// maxResponseBytes limits how much of a response we read. We only look at the success flag and error messages.
+const maxResponseBytes = 64 << 10
+
+const cloudflareEndpoint = "https://api.cloudflare.com/client/v4"
+
+// cloudflareBatchSize is the number of URLs Cloudflare accepts in a single purge request on every plan.
+const cloudflareBatchSize = 30
+
+// Cloudflare purges URLs with Cloudflare's purge_cache API. Endpoint is the base URL of the API, which tests replace.
+type Cloudflare struct {
+	Endpoint string
+	ZoneID   string
+	Token    string
+	Client   *http.Client
+}
+
+func (c *Cloudflare) Purge(ctx context.Context, urls []string) error {
+	for len(urls) > 0 {
+		n := min(len(urls), cloudflareBatchSize)
+
+		err := c.purgeBatch(ctx, urls[:n])
+		if err != nil {
+			return err
+		}
+
+		urls = urls[n:]
+	}
+
+	return nil
+}
+
+func (c *Cloudflare) purgeBatch(ctx context.Context, urls []string) error {
+	body, err := json.Marshal(map[string][]string{"files": urls})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint+"/zones/"+c.ZoneID+"/purge_cache", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var output struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	// A response that isn't JSON leaves Success false, which is handled below, so the error doesn't matter.
+	_ = json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&output)
+
+	if resp.StatusCode != http.StatusOK || !output.Success {
+		var messages []string
+		for _, e := range output.Errors {
+			messages = append(messages, e.Message)
+		}
+		if len(messages) > 0 {
+			return fmt.Errorf("cdn: cloudflare purge failed: %s: %s", resp.Status, strings.Join(messages, "; "))
+		}
+		return fmt.Errorf("cdn: cloudflare purge failed: %s", resp.Status)
+	}
+
+	return nil
+}
+
+const fastlyEndpoint = "https://api.fastly.com"
+
+// Fastly purges URLs with Fastly's purge API, which takes one URL per request. Endpoint is the base URL of the API,
+// which tests replace.
+type Fastly struct {
+	Endpoint string
+	Token    string
+	Client   *http.Client
+}
+
+func (f *Fastly) Purge(ctx context.Context, urls []string) error {
+	for _, u := range urls {
+		// The API takes the URL to purge without its scheme, as part of the path.
+		target := u
+		if i := strings.Index(target, "://"); i >= 0 {
+			target = target[i+3:]
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.Endpoint+"/purge/"+target, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Fastly-Key", f.Token)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := f.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("cdn: fastly purge of %s failed: %s", u, resp.Status)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	p, err := New("", "", "", time.Second)
+	asserts.NilError(t, err)
+	asserts.Equal(t, p, nil)
+
+	_, err = New(ProviderCloudflare, "", "TOKEN", time.Second)
+	if err == nil {
+		t.Error("got: nil; want: error for a missing Cloudflare zone")
+	}
+
+	_, err = New("akamai", "", "TOKEN", time.Second)
+	if err == nil {
+		t.Error("got: nil; want: error for an unknown provider")
+	}
+}
+
+func TestCloudflare(t *testing.T) {
+	var batches [][]string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zones/ZONE/purge_cache" || r.Header.Get("Authorization") != "Bearer TOKEN" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+			return
+		}
+
+		var input struct {
+			Files []string `json:"files"`
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		batches = append(batches, input.Files)
+
+		w.Write([]byte(`{"success":true,"errors":[]}`))
+	}))
+	defer ts.Close()
+
+	c := &Cloudflare{Endpoint: ts.URL, ZoneID: "ZONE", Token: "TOKEN", Client: ts.Client()}
+
+	var urls []string
+	for i := range 45 {
+		urls = append(urls, fmt.Sprintf("https://snippets.example.com/snippet/view/%d", i))
+	}
+
+	err := c.Purge(context.Background(), urls)
+	asserts.NilError(t, err)
+
+	// Cloudflare only takes 30 URLs at a time, so the 45 URLs need two requests.
+	asserts.Equal(t, len(batches), 2)
+	asserts.Equal(t, len(batches[0]), 30)
+	asserts.Equal(t, len(batches[1]), 15)
+	asserts.Equal(t, batches[1][14], "https://snippets.example.com/snippet/view/44")
+
+	c.Token = "WRONG"
+	err = c.Purge(context.Background(), urls[:1])
+	if err == nil || !strings.Contains(err.Error(), "Authentication error") {
+		t.Errorf("got: %v; want: error containing the API's message", err)
+	}
+}
+
+func TestFastly(t *testing.T) {
+	var purged []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Fastly-Key") != "TOKEN" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		purged = append(purged, strings.TrimPrefix(r.URL.Path, "/purge/"))
+		w.Write([]byte(`{"status":"ok","id":"1"}`))
+	}))
+	defer ts.Close()
+
+	f := &Fastly{Endpoint: ts.URL, Token: "TOKEN", Client: ts.Client()}
+
+	err := f.Purge(context.Background(), []string{"https://snippets.example.com/", "https://snippets.example.com/users/alice"})
+	asserts.NilError(t, err)
+
+	asserts.Equal(t, strings.Join(purged, " "), "snippets.example.com/ snippets.example.com/users/alice")
+
+	f.Token = "WRONG"
+	err = f.Purge(context.Background(), []string{"https://snippets.example.com/"})
+	if err == nil {
+		t.Error("got: nil; want: error")
+	}
+}
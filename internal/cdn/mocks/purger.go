@@ -0,0 +1,25 @@
+package mocks
+
+import (
+	"context"
+)
+
+// Purger sends the URLs it's asked to purge on the Purged channel, so that tests can wait for purges which happen in a
+// background goroutine. It fails with Err if that's set.
+type Purger struct {
+	Err    error
+	Purged chan []string
+}
+
+func NewPurger() *Purger {
+	return &Purger{Purged: make(chan []string, 10)}
+}
+
+func (p *Purger) Purge(ctx context.Context, urls []string) error {
+	if p.Err != nil {
+		return p.Err
+	}
+
+	p.Purged <- urls
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package diff compares two texts line by line, using Myers' algorithm to find the smallest set of lines to delete and
+// insert to turn one into the other.
+package diff
+
+import (
+	"slices"
+	"strings"
+)
+
+// MaxEdits limits the work done by Lines(). Myers' algorithm takes time (and, to recover the edits, memory) which grows
+// with the number of edits squared, so when two texts have more than MaxEdits differing lines, the changed part is shown as
+// all deleted and then all inserted, rather than as the smallest diff.
+const MaxEdits = 1000
+
+// Op says what happened to a line.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+func (op Op) String() string {
+	switch op {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	default:
+		return "equal"
+	}
+}
+
+// Line is one line of a diff. Left and Right are its 1-based line numbers in each text, and 0 in the text that doesn't
+// have it (so Left is 0 for an inserted line, and Right is 0 for a deleted one).
+type Line struct {
+	Op    Op
+	Text  string
+	Left  int
+	Right int
+}
+
+// Lines returns the diff between a and b. Windows line endings are treated the same as Unix ones, and a final newline is
+// ignored.
+func Lines(a, b string) []Line {
+	left, right := split(a), split(b)
+
+	// Lines which are the same at the start or end of both texts are always part of the diff, and skipping them first keeps
+	// Myers' algorithm to the part that changed.
+	prefix := 0
+	for prefix < len(left) && prefix < len(right) && left[prefix] == right[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(left)-prefix && suffix < len(right)-prefix && left[len(left)-1-suffix] == right[len(right)-1-suffix] {
+		suffix++
+	}
+
+	ops, ok := myers(left[prefix:len(left)-suffix], right[prefix:len(right)-suffix])
+	if !ok {
+		ops = nil
+		for range len(left) - prefix - suffix {
+			ops = append(ops, Delete)
+		}
+		for range len(right) - prefix - suffix {
+			ops = append(ops, Insert)
+		}
+	}
+
+	all := make([]Op, 0, prefix+len(ops)+suffix)
+	for range prefix {
+		all = append(all, Equal)
+	}
+	all = append(all, ops...)
+	for range suffix {
+		all = append(all, Equal)
+	}
+
+	lines := make([]Line, 0, len(all))
+	x, y := 0, 0
+	for _, op := range all {
+		switch op {
+		case Equal:
+			lines = append(lines, Line{Op: Equal, Text: left[x], Left: x + 1, Right: y + 1})
+			x++
+			y++
+		case Delete:
+			lines = append(lines, Line{Op: Delete, Text: left[x], Left: x + 1})
+			x++
+		case Insert:
+			lines = append(lines, Line{Op: Insert, Text: right[y], Right: y + 1})
+			y++
+		}
+	}
+
+	return lines
+}
+
+// split breaks text into lines. An empty text has no lines.
+func split(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// myers returns the edits which turn a into b, or false if there are more than MaxEdits of them. See "An O(ND) Difference
+// Algorithm and Its Variations" (Myers, 1986). v[k] holds the furthest x reached on diagonal k = x - y, and a copy of it is
+// kept for each round, so that the path can be followed back from the end.
+func myers(a, b []string) ([]Op, bool) {
+	n, m := len(a), len(b)
+	limit := min(n+m, MaxEdits)
+
+	offset := limit + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+1]))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, n, m), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// backtrack follows the path found by myers() back from the end of both texts, and returns its edits in order.
+func backtrack(trace [][]int, x, y int) []Op {
+	var ops []Op
+
+	for d := len(trace) - 1; d > 0; d-- {
+		// trace[d] is v as it was before round d, covering diagonals -d to d.
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, Equal)
+			x--
+			y--
+		}
+
+		if x == prevX {
+			ops = append(ops, Insert)
+		} else {
+			ops = append(ops, Delete)
+		}
+		x, y = prevX, prevY
+	}
+
+	for x > 0 && y > 0 {
+		ops = append(ops, Equal)
+		x--
+		y--
+	}
+
+	slices.Reverse(ops)
+	return ops
+}
@@ -0,0 +1,108 @@
+package diff
+
+import (
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"strings"
+	"testing"
+)
+
+// render writes a diff in the unified style, with a "-", "+" or " " before each line.
+func render(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		switch l.Op {
+		case Delete:
+			b.WriteString("-")
+		case Insert:
+			b.WriteString("+")
+		default:
+			b.WriteString(" ")
+		}
+		b.WriteString(l.Text + "\n")
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "Identical",
+			a:    "one\ntwo\n",
+			b:    "one\ntwo",
+			want: " one\n two\n",
+		},
+		{
+			name: "Both empty",
+			want: "",
+		},
+		{
+			name: "Added to empty",
+			b:    "one\ntwo",
+			want: "+one\n+two\n",
+		},
+		{
+			name: "Changed line",
+			a:    "host = localhost\nport = 80\ndebug = false",
+			b:    "host = localhost\nport = 8080\ndebug = false",
+			want: " host = localhost\n-port = 80\n+port = 8080\n debug = false\n",
+		},
+		{
+			name: "Windows line endings",
+			a:    "a\r\nb\r\n",
+			b:    "a\nb\nc\n",
+			want: " a\n b\n+c\n",
+		},
+		{
+			name: "Myers paper example",
+			a:    "A\nB\nC\nA\nB\nB\nA",
+			b:    "C\nB\nA\nB\nA\nC",
+			want: "-A\n-B\n C\n+B\n A\n B\n-B\n A\n+C\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asserts.Equal(t, render(Lines(tt.a, tt.b)), tt.want)
+		})
+	}
+}
+
+func TestLinesNumbers(t *testing.T) {
+	lines := Lines("a\nb\nc", "a\nx\nc")
+
+	want := []Line{
+		{Op: Equal, Text: "a", Left: 1, Right: 1},
+		{Op: Delete, Text: "b", Left: 2},
+		{Op: Insert, Text: "x", Right: 2},
+		{Op: Equal, Text: "c", Left: 3, Right: 3},
+	}
+
+	asserts.Equal(t, len(lines), len(want))
+	for i := range want {
+		asserts.Equal(t, lines[i], want[i])
+	}
+}
+
+func TestLinesTooManyEdits(t *testing.T) {
+	var a, b []string
+	for i := range MaxEdits {
+		a = append(a, fmt.Sprintf("left %d", i))
+		b = append(b, fmt.Sprintf("right %d", i))
+	}
+
+	lines := Lines("same\n"+strings.Join(a, "\n"), "same\n"+strings.Join(b, "\n"))
+
+	// The unchanged first line is still found, and the rest is deleted and then inserted.
+	asserts.Equal(t, len(lines), 1+2*MaxEdits)
+	asserts.Equal(t, lines[0].Op, Equal)
+	asserts.Equal(t, lines[1].Op, Delete)
+	asserts.Equal(t, lines[MaxEdits].Op, Delete)
+	asserts.Equal(t, lines[MaxEdits+1].Op, Insert)
+	asserts.Equal(t, lines[2*MaxEdits].Text, fmt.Sprintf("right %d", MaxEdits-1))
+}
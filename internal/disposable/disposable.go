@@ -0,0 +1,177 @@
+package disposable
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Embed the built-in list of domains, so that there is always something to check against.
+//
+//go:embed "domains.txt"
+var builtinDomains []byte
+
+// Define the sources the current list of domains can have been loaded from.
+const (
+	SourceBuiltin = "built-in"
+	SourceCache   = "cache"
+	SourceRemote  = "remote"
+)
+
+// maxListSize limits how much of a downloaded list we read, to protect against a misbehaving server.
+const maxListSize = 10 << 20
+
+// Status describes the list of domains currently in use.
+type Status struct {
+	Domains int
+	Source  string
+	Updated time.Time
+}
+
+// List is a refreshable set of disposable email domains. The full dataset is downloaded from a URL and cached on disk.
+// If it can't be downloaded, the cached copy is used, and failing that the built-in list. It is safe for concurrent use.
+type List struct {
+	mu        sync.RWMutex
+	domains   map[string]bool
+	status    Status
+	url       string
+	cachePath string
+	client    *http.Client
+}
+
+// New returns a List loaded from the cache file if it exists, or from the built-in domains otherwise.
+// The url and cachePath can be empty, which disables downloading and caching respectively.
+func New(url, cachePath string) *List {
+	l := &List{
+		url:       url,
+		cachePath: cachePath,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+
+	domains, _ := parse(bytes.NewReader(builtinDomains))
+	l.set(domains, SourceBuiltin, time.Time{})
+
+	if cachePath != "" {
+		if info, err := os.Stat(cachePath); err == nil {
+			if f, err := os.Open(cachePath); err == nil {
+				domains, err := parse(f)
+				f.Close()
+				if err == nil && len(domains) > 0 {
+					l.set(domains, SourceCache, info.ModTime())
+				}
+			}
+		}
+	}
+
+	return l
+}
+
+// Refresh downloads the dataset and, if that succeeds, starts using it and writes it to the cache file.
+// If the download fails the current list is kept, so a failed refresh never leaves the list empty.
+func (l *List) Refresh() error {
+	if l.url == "" {
+		return nil
+	}
+
+	resp, err := l.client.Get(l.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("disposable: unexpected status fetching %s: %s", l.url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxListSize))
+	if err != nil {
+		return err
+	}
+
+	domains, err := parse(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if len(domains) == 0 {
+		return fmt.Errorf("disposable: %s returned an empty list", l.url)
+	}
+
+	l.set(domains, SourceRemote, time.Now())
+
+	if l.cachePath != "" {
+		err = os.WriteFile(l.cachePath, data, 0644)
+		if err != nil {
+			return fmt.Errorf("disposable: writing cache: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// IsDisposable reports whether the email address uses a disposable domain. Subdomains of a listed domain also count,
+// so that foo.mailinator.com is caught as well as mailinator.com.
+func (l *List) IsDisposable(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for domain != "" {
+		if l.domains[domain] {
+			return true
+		}
+
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+
+	return false
+}
+
+// Status returns details of the list currently in use.
+func (l *List) Status() Status {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.status
+}
+
+func (l *List) set(domains map[string]bool, source string, updated time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.domains = domains
+	l.status = Status{Domains: len(domains), Source: source, Updated: updated}
+}
+
+// parse reads a list of domains, one per line. Blank lines and lines starting with # are ignored.
+func parse(r io.Reader) (map[string]bool, error) {
+	domains := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = true
+	}
+
+	return domains, scanner.Err()
+}
@@ -0,0 +1,59 @@
+package disposable
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsDisposable(t *testing.T) {
+	l := New("", "")
+
+	asserts.Equal(t, l.IsDisposable("alice@mailinator.com"), true)
+	asserts.Equal(t, l.IsDisposable("alice@Inbox.Mailinator.COM"), true)
+	asserts.Equal(t, l.IsDisposable("alice@example.com"), false)
+	asserts.Equal(t, l.IsDisposable("not an address"), false)
+	asserts.Equal(t, l.Status().Source, SourceBuiltin)
+}
+
+func TestRefresh(t *testing.T) {
+	var fail atomic.Bool
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("throwaway.example\n"))
+	}))
+	defer ts.Close()
+
+	cachePath := filepath.Join(t.TempDir(), "disposable.txt")
+
+	l := New(ts.URL, cachePath)
+
+	err := l.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asserts.Equal(t, l.IsDisposable("alice@throwaway.example"), true)
+	asserts.Equal(t, l.Status().Source, SourceRemote)
+	asserts.Equal(t, l.Status().Domains, 1)
+
+	// A failed refresh keeps the current list.
+	fail.Store(true)
+	err = l.Refresh()
+	if err == nil {
+		t.Error("got: nil; want: error")
+	}
+	asserts.Equal(t, l.IsDisposable("alice@throwaway.example"), true)
+
+	// A new list starts from the cached copy of the last successful download.
+	l = New(ts.URL, cachePath)
+	asserts.Equal(t, l.IsDisposable("alice@throwaway.example"), true)
+	asserts.Equal(t, l.Status().Source, SourceCache)
+}
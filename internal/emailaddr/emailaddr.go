@@ -0,0 +1,71 @@
+package emailaddr
+
+import (
+	"strings"
+)
+
+// gmailDomains are the domains which deliver to the same Gmail mailbox, regardless of dots in the local part.
+var gmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+}
+
+// Normalizer turns an email address into a canonical form, which is used to check for duplicate accounts.
+// The domain is always lowercased, because domain names are case-insensitive. The other rules are optional,
+// as strictly speaking the local part of an address is case-sensitive and plus aliases aren't universal.
+type Normalizer struct {
+	// Lowercase lowercases the local part of the address, as almost every mail provider ignores its case.
+	Lowercase bool
+	// CollapseGmail removes dots and "+alias" suffixes from Gmail addresses, and maps googlemail.com to gmail.com.
+	CollapseGmail bool
+	// StripPlusAliases removes "+alias" suffixes from addresses at every domain.
+	StripPlusAliases bool
+}
+
+// Normalize returns the canonical form of the email address. Addresses without an @ are only trimmed.
+func (n Normalizer) Normalize(email string) string {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return email
+	}
+
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+
+	if n.Lowercase {
+		local = strings.ToLower(local)
+	}
+
+	if n.CollapseGmail && gmailDomains[domain] {
+		local = strings.ToLower(local)
+		local, _, _ = strings.Cut(local, "+")
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+
+	if n.StripPlusAliases {
+		if base, _, found := strings.Cut(local, "+"); found && base != "" {
+			local = base
+		}
+	}
+
+	return local + "@" + domain
+}
+
+// AtDomain reports whether the email address is at one of the domains, which have to be lowercase. Subdomains don't
+// count, so an address at mail.example.com isn't at example.com.
+func AtDomain(email string, domains []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return false
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+	for _, d := range domains {
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
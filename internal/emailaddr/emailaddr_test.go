@@ -0,0 +1,106 @@
+package emailaddr
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer Normalizer
+		email      string
+		want       string
+	}{
+		{
+			name:       "Domain is always lowercased",
+			normalizer: Normalizer{},
+			email:      " Alice@Example.COM ",
+			want:       "Alice@example.com",
+		},
+		{
+			name:       "Lowercase",
+			normalizer: Normalizer{Lowercase: true},
+			email:      "Alice@Example.com",
+			want:       "alice@example.com",
+		},
+		{
+			name:       "Gmail dots and aliases",
+			normalizer: Normalizer{CollapseGmail: true},
+			email:      "Alice.Jones+snippets@GoogleMail.com",
+			want:       "alicejones@gmail.com",
+		},
+		{
+			name:       "Gmail collapsing leaves other domains alone",
+			normalizer: Normalizer{CollapseGmail: true},
+			email:      "alice.jones+snippets@example.com",
+			want:       "alice.jones+snippets@example.com",
+		},
+		{
+			name:       "Plus aliases",
+			normalizer: Normalizer{StripPlusAliases: true},
+			email:      "alice+snippets@example.com",
+			want:       "alice@example.com",
+		},
+		{
+			name:       "Address starting with plus",
+			normalizer: Normalizer{StripPlusAliases: true},
+			email:      "+alice@example.com",
+			want:       "+alice@example.com",
+		},
+		{
+			name:       "Not an address",
+			normalizer: Normalizer{Lowercase: true},
+			email:      "Alice",
+			want:       "Alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asserts.Equal(t, tt.normalizer.Normalize(tt.email), tt.want)
+		})
+	}
+}
+
+// FuzzNormalize checks that normalizing an address twice gives the same result as normalizing it once. Otherwise the
+// same address could be stored in two different forms. Run it with: go test ./internal/emailaddr -run=^$ -fuzz=FuzzNormalize
+func FuzzNormalize(f *testing.F) {
+	f.Add("Alice.Smith+news@GoogleMail.com")
+	f.Add(" bob+@example.com ")
+	f.Add("+@gmail.com")
+	f.Add("a@b@c")
+
+	n := Normalizer{Lowercase: true, CollapseGmail: true, StripPlusAliases: true}
+
+	f.Fuzz(func(t *testing.T, email string) {
+		once := n.Normalize(email)
+		if twice := n.Normalize(once); twice != once {
+			t.Errorf("Normalize(%q) = %q, but Normalize(%q) = %q", email, once, once, twice)
+		}
+	})
+}
+
+func TestAtDomain(t *testing.T) {
+	domains := []string{"example.com", "example.org"}
+
+	tests := []struct {
+		name  string
+		email string
+		want  bool
+	}{
+		{name: "Allowed", email: "alice@example.com", want: true},
+		{name: "Second domain", email: "alice@example.org", want: true},
+		{name: "Different case", email: "alice@Example.COM", want: true},
+		{name: "Other domain", email: "alice@example.net", want: false},
+		{name: "Subdomain", email: "alice@mail.example.com", want: false},
+		{name: "Domain in the local part", email: "example.com@evil.com", want: false},
+		{name: "No domain", email: "alice", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asserts.Equal(t, AtDomain(tt.email, domains), tt.want)
+		})
+	}
+}
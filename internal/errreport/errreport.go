@@ -0,0 +1,41 @@
+// Package errreport sends the details of server errors to an error tracking service, so that 500s show up in our
+// alerting along with their stack traces, rather than only in the error log. Each service has its own API, so they're
+// hidden behind the ErrorReporter interface. Sentry is the only one so far.
+package errreport
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Report is one server error. Stack is the text of a goroutine's stack trace, as returned by debug.Stack(). UserID is 0
+// when the request wasn't from a logged-in user. Header shouldn't contain any credentials, so the caller has to redact
+// them first.
+type Report struct {
+	Err       error
+	Stack     []byte
+	Panic     bool
+	RequestID string
+	UserID    int
+	Method    string
+	URL       string
+	Header    http.Header
+	Time      time.Time
+}
+
+// ErrorReporter sends a report to an error tracking service.
+type ErrorReporter interface {
+	Report(ctx context.Context, report Report) error
+}
+
+// New returns an ErrorReporter which sends reports to the Sentry project with the given DSN, tagged with the environment
+// and release (either of which can be empty). An empty DSN returns a nil ErrorReporter, meaning that errors are only
+// logged.
+func New(dsn, environment, release string, timeout time.Duration) (ErrorReporter, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+
+	return NewSentry(dsn, environment, release, &http.Client{Timeout: timeout})
+}
@@ -0,0 +1,26 @@
+package mocks
+
+import (
+	"context"
+	"github.com/0xshiku/snippetbox/internal/errreport"
+)
+
+// ErrorReporter sends the reports it's given on the Reported channel, so that tests can wait for reports which are sent
+// in a background goroutine. It fails with Err if that's set.
+type ErrorReporter struct {
+	Err      error
+	Reported chan errreport.Report
+}
+
+func NewErrorReporter() *ErrorReporter {
+	return &ErrorReporter{Reported: make(chan errreport.Report, 10)}
+}
+
+func (r *ErrorReporter) Report(ctx context.Context, report errreport.Report) error {
+	if r.Err != nil {
+		return r.Err
+	}
+
+	r.Reported <- report
+	return nil
+}
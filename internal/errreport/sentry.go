@@ -0,0 +1,298 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxResponseBytes limits how much of a response we read. We only look at the error detail.
+const maxResponseBytes = 64 << 10
+
+// Sentry sends reports to Sentry's envelope API, as events with the error's stack trace, the request and the user's ID.
+// Endpoint is the envelope URL of the project, which NewSentry() works out from the DSN, and Module is the Go module
+// whose stack frames are marked as our own code, so that Sentry can group events by them.
+type Sentry struct {
+	Endpoint    string
+	DSN         string
+	Key         string
+	Environment string
+	Release     string
+	ServerName  string
+	Module      string
+	Client      *http.Client
+}
+
+// NewSentry returns a Sentry reporter for the DSN, which looks like https://KEY@o0.ingest.sentry.io/PROJECT.
+func NewSentry(dsn, environment, release string, client *http.Client) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("errreport: sentry DSN must be a URL like https://KEY@o0.ingest.sentry.io/PROJECT")
+	}
+
+	// The project ID is the last part of the path. Self-hosted Sentry can be served under a prefix, which goes in front of
+	// the API path.
+	prefix, project := "", strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = project[:i], project[i+1:]
+	}
+	if _, err := strconv.Atoi(project); err != nil {
+		return nil, fmt.Errorf("errreport: sentry DSN has no project ID: %q", u.Redacted())
+	}
+
+	endpoint := u.Scheme + "://" + u.Host + "/"
+	if prefix != "" {
+		endpoint += prefix + "/"
+	}
+	endpoint += "api/" + project + "/envelope/"
+
+	s := &Sentry{
+		Endpoint:    endpoint,
+		DSN:         dsn,
+		Key:         u.User.Username(),
+		Environment: environment,
+		Release:     release,
+		Client:      client,
+	}
+
+	s.ServerName, _ = os.Hostname()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		s.Module = info.Main.Path
+	}
+
+	return s, nil
+}
+
+func (s *Sentry) Report(ctx context.Context, report Report) error {
+	ev, err := s.event(report)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	// An envelope is a header line, then a header line and a payload for each item, which here is just the event.
+	envelopeHeader, err := json.Marshal(map[string]string{
+		"event_id": ev.EventID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+		"dsn":      s.DSN,
+	})
+	if err != nil {
+		return err
+	}
+	itemHeader, err := json.Marshal(map[string]any{"type": "event", "length": len(payload), "content_type": "application/json"})
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	for _, line := range [][]byte{envelopeHeader, itemHeader, payload} {
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=snippetbox/1.0, sentry_key="+s.Key)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var output struct {
+			Detail string `json:"detail"`
+		}
+
+		// A response that isn't JSON leaves Detail empty, which is handled below, so the error doesn't matter.
+		_ = json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&output)
+
+		if output.Detail != "" {
+			return fmt.Errorf("errreport: sentry rejected event %s: %s: %s", ev.EventID, resp.Status, output.Detail)
+		}
+		return fmt.Errorf("errreport: sentry rejected event %s: %s", ev.EventID, resp.Status)
+	}
+
+	return nil
+}
+
+// The event type is the part of Sentry's event payload that we fill in.
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	User        *eventUser        `json:"user,omitempty"`
+	Request     *eventRequest     `json:"request,omitempty"`
+	Exception   struct {
+		Values []exception `json:"values"`
+	} `json:"exception"`
+}
+
+type eventUser struct {
+	ID string `json:"id"`
+}
+
+type eventRequest struct {
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type exception struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Mechanism struct {
+		Type    string `json:"type"`
+		Handled bool   `json:"handled"`
+	} `json:"mechanism"`
+	Stacktrace *stacktrace `json:"stacktrace,omitempty"`
+}
+
+type stacktrace struct {
+	Frames []frame `json:"frames"`
+}
+
+type frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	AbsPath  string `json:"abs_path,omitempty"`
+	Lineno   int    `json:"lineno,omitempty"`
+	InApp    bool   `json:"in_app"`
+}
+
+func (s *Sentry) event(report Report) (*event, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := &event{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   report.Time.UTC().Format(time.RFC3339Nano),
+		Level:       "error",
+		Platform:    "go",
+		ServerName:  s.ServerName,
+		Environment: s.Environment,
+		Release:     s.Release,
+	}
+
+	if report.RequestID != "" {
+		ev.Tags = map[string]string{"request_id": report.RequestID}
+	}
+
+	if report.UserID != 0 {
+		ev.User = &eventUser{ID: strconv.Itoa(report.UserID)}
+	}
+
+	if report.Method != "" || report.URL != "" {
+		ev.Request = &eventRequest{Method: report.Method, URL: report.URL}
+		for name, values := range report.Header {
+			if ev.Request.Headers == nil {
+				ev.Request.Headers = make(map[string]string)
+			}
+			ev.Request.Headers[name] = strings.Join(values, ", ")
+		}
+	}
+
+	// Errors are grouped by type, so the type of the innermost error is more useful than that of the wrapper around it.
+	ex := exception{Type: "panic", Value: "<nil>"}
+	if report.Err != nil {
+		ex.Value = report.Err.Error()
+		if !report.Panic {
+			inner := report.Err
+			for errors.Unwrap(inner) != nil {
+				inner = errors.Unwrap(inner)
+			}
+			ex.Type = fmt.Sprintf("%T", inner)
+		}
+	}
+	ex.Mechanism.Type = "generic"
+	ex.Mechanism.Handled = !report.Panic
+	if report.Panic {
+		ex.Mechanism.Type = "panic"
+	}
+
+	if frames := s.frames(report.Stack); len(frames) > 0 {
+		ex.Stacktrace = &stacktrace{Frames: frames}
+	}
+
+	ev.Exception.Values = []exception{ex}
+
+	return ev, nil
+}
+
+// frames parses a stack trace from debug.Stack() into Sentry's frames, which go from the outermost call to the innermost.
+// The trace has two lines for each call: the function with its arguments, and then the file and line, indented by a tab.
+func (s *Sentry) frames(stack []byte) []frame {
+	lines := strings.Split(strings.TrimSpace(string(stack)), "\n")
+
+	var frames []frame
+	for i := 1; i+1 < len(lines); i += 2 {
+		function := lines[i]
+		location := strings.TrimPrefix(lines[i+1], "\t")
+
+		// The goroutine which started this one comes last, as "created by net/http.(*Server).Serve in goroutine 1".
+		if name, ok := strings.CutPrefix(function, "created by "); ok {
+			function, _, _ = strings.Cut(name, " in goroutine ")
+		} else if j := strings.LastIndex(function, "("); j > 0 {
+			function = function[:j]
+		}
+
+		// Drop the call to debug.Stack() itself, as it isn't part of what went wrong.
+		if function == "runtime/debug.Stack" {
+			continue
+		}
+
+		f := frame{Function: function}
+
+		// The package path ends at the first dot after the last slash, as in github.com/a/b.(*T).Method.
+		slash := strings.LastIndex(function, "/")
+		if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+			f.Module = function[:slash+1+dot]
+			f.Function = function[slash+2+dot:]
+		}
+		f.InApp = f.Module == "main" || (s.Module != "" && (f.Module == s.Module || strings.HasPrefix(f.Module, s.Module+"/")))
+
+		// The location looks like "/path/to/file.go:123 +0x1d".
+		location, _, _ = strings.Cut(location, " +0x")
+		if j := strings.LastIndex(location, ":"); j > 0 {
+			f.AbsPath = location[:j]
+			f.Lineno, _ = strconv.Atoi(location[j+1:])
+		}
+
+		frames = append(frames, f)
+	}
+
+	// Sentry wants the outermost call first, which is the opposite of Go's order.
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+
+	return frames
+}
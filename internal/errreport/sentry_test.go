@@ -0,0 +1,171 @@
+package errreport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	r, err := New("", "", "", time.Second)
+	asserts.NilError(t, err)
+	asserts.Equal(t, r, nil)
+
+	for _, dsn := range []string{"not a url", "https://o0.ingest.sentry.io/1", "https://KEY@o0.ingest.sentry.io/", "ftp://KEY@example.com/1"} {
+		_, err = New(dsn, "", "", time.Second)
+		if err == nil {
+			t.Errorf("got: nil; want: error for DSN %q", dsn)
+		}
+	}
+}
+
+func TestNewSentry(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		endpoint string
+	}{
+		{"https://KEY@o0.ingest.sentry.io/42", "https://o0.ingest.sentry.io/api/42/envelope/"},
+		{"http://KEY@sentry.example.com:9000/sentry/7", "http://sentry.example.com:9000/sentry/api/7/envelope/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			s, err := NewSentry(tt.dsn, "", "", http.DefaultClient)
+			asserts.NilError(t, err)
+			asserts.Equal(t, s.Endpoint, tt.endpoint)
+			asserts.Equal(t, s.Key, "KEY")
+		})
+	}
+}
+
+func TestSentryReport(t *testing.T) {
+	var lines []string
+	var auth string
+	status := http.StatusOK
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("X-Sentry-Auth")
+
+		lines = nil
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte(`{"detail":"event submission rejected with_reason: ProjectId"}`))
+		}
+	}))
+	defer ts.Close()
+
+	s, err := NewSentry("http://KEY@"+strings.TrimPrefix(ts.URL, "http://")+"/1", "staging", "abc123", ts.Client())
+	asserts.NilError(t, err)
+
+	report := Report{
+		Err:       fmt.Errorf("loading snippet: %w", os.ErrDeadlineExceeded),
+		Stack:     debug.Stack(),
+		RequestID: "req-1",
+		UserID:    7,
+		Method:    http.MethodGet,
+		URL:       "https://snippets.example.com/snippet/view/1",
+		Header:    http.Header{"User-Agent": {"test-agent"}},
+		Time:      time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	err = s.Report(context.Background(), report)
+	asserts.NilError(t, err)
+
+	asserts.StringContains(t, auth, "sentry_key=KEY")
+	asserts.Equal(t, len(lines), 3)
+
+	var ev event
+	err = json.Unmarshal([]byte(lines[2]), &ev)
+	asserts.NilError(t, err)
+
+	asserts.Equal(t, len(ev.EventID), 32)
+	asserts.Equal(t, ev.Timestamp, "2024-04-01T12:00:00Z")
+	asserts.Equal(t, ev.Environment, "staging")
+	asserts.Equal(t, ev.Release, "abc123")
+	asserts.Equal(t, ev.Tags["request_id"], "req-1")
+	asserts.Equal(t, ev.User.ID, "7")
+	asserts.Equal(t, ev.Request.URL, "https://snippets.example.com/snippet/view/1")
+	asserts.Equal(t, ev.Request.Headers["User-Agent"], "test-agent")
+
+	ex := ev.Exception.Values[0]
+	asserts.Equal(t, ex.Type, "*poll.DeadlineExceededError")
+	asserts.Equal(t, ex.Value, "loading snippet: i/o timeout")
+	asserts.Equal(t, ex.Mechanism.Handled, true)
+
+	// The innermost call, to this test, comes last.
+	last := ex.Stacktrace.Frames[len(ex.Stacktrace.Frames)-1]
+	asserts.Equal(t, last.Function, "TestSentryReport")
+	asserts.StringContains(t, last.AbsPath, "sentry_test.go")
+
+	t.Run("Panic", func(t *testing.T) {
+		report := Report{Err: errors.New("runtime error: index out of range"), Panic: true, Time: time.Now()}
+
+		err := s.Report(context.Background(), report)
+		asserts.NilError(t, err)
+
+		var ev event
+		err = json.Unmarshal([]byte(lines[2]), &ev)
+		asserts.NilError(t, err)
+
+		ex := ev.Exception.Values[0]
+		asserts.Equal(t, ex.Type, "panic")
+		asserts.Equal(t, ex.Mechanism.Handled, false)
+		asserts.Equal(t, ev.User == nil, true)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		status = http.StatusForbidden
+		defer func() { status = http.StatusOK }()
+
+		err := s.Report(context.Background(), report)
+		if err == nil || !strings.Contains(err.Error(), "ProjectId") {
+			t.Errorf("got: %v; want: error with the detail from Sentry", err)
+		}
+	})
+}
+
+func TestSentryFrames(t *testing.T) {
+	stack := `goroutine 7 [running]:
+runtime/debug.Stack()
+	/usr/local/go/src/runtime/debug/stack.go:26 +0x5e
+main.(*application).serverError(0xc000170000, {0x9a1b40, 0xc0001ae000}, 0xc000190200, {0x99e700, 0xc00011e0f0})
+	/src/cmd/web/helpers.go:35 +0x45
+github.com/0xshiku/snippetbox/internal/models.(*SnippetModel).Get(0xc0000a0000, {0x0, 0x0})
+	/src/internal/models/snippets.go:120 +0x1d
+net/http.HandlerFunc.ServeHTTP(0x0?, {0x9a1b40?, 0xc0001ae000?}, 0x0?)
+	/usr/local/go/src/net/http/server.go:2220 +0x29
+created by net/http.(*Server).Serve in goroutine 1
+	/usr/local/go/src/net/http/server.go:3360 +0x485
+`
+
+	s := &Sentry{Module: "github.com/0xshiku/snippetbox"}
+	frames := s.frames([]byte(stack))
+
+	want := []frame{
+		{Function: "(*Server).Serve", Module: "net/http", AbsPath: "/usr/local/go/src/net/http/server.go", Lineno: 3360},
+		{Function: "HandlerFunc.ServeHTTP", Module: "net/http", AbsPath: "/usr/local/go/src/net/http/server.go", Lineno: 2220},
+		{Function: "(*SnippetModel).Get", Module: "github.com/0xshiku/snippetbox/internal/models", AbsPath: "/src/internal/models/snippets.go", Lineno: 120, InApp: true},
+		{Function: "(*application).serverError", Module: "main", AbsPath: "/src/cmd/web/helpers.go", Lineno: 35, InApp: true},
+	}
+
+	asserts.Equal(t, len(frames), len(want))
+	for i := range want {
+		asserts.Equal(t, frames[i], want[i])
+	}
+}
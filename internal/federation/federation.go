@@ -0,0 +1,157 @@
+// Package federation cross-posts snippets to other Snippetbox instances, through the same JSON API that browser
+// extensions use. The user adds an API token from the other instance (from its pairing exchange) to their account here,
+// and we send it along with each snippet.
+package federation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/netguard"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrUnauthorized is returned when the remote instance doesn't accept the API token, usually because it has been revoked.
+var ErrUnauthorized = errors.New("federation: the remote instance rejected the API token")
+
+// Snippet holds the parts of a snippet that are sent to the remote instance. Expires is in days, and must be one of the
+// values the remote accepts (1, 7 or 365).
+type Snippet struct {
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	Expires    int    `json:"expires"`
+	Visibility string `json:"visibility"`
+}
+
+// Pusher sends a snippet to a remote instance, and returns the URL that it can be viewed at there.
+type Pusher interface {
+	Push(baseURL, token string, s Snippet) (string, error)
+}
+
+// Client is a Pusher which makes real requests.
+type Client struct {
+	Client *http.Client
+}
+
+// NewClient returns a Client which gives up after the timeout. It doesn't follow redirects, so the token is only ever
+// sent to the instance that the user asked for, and won't connect to loopback or private network addresses, so that
+// the remote instances can't be used to reach services behind our firewall.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{
+		Client: &http.Client{
+			Timeout:   timeout,
+			Transport: netguard.Transport(timeout),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// maxResponseBytes limits how much of a response we read. Ours are tiny, so anything bigger isn't a Snippetbox instance.
+const maxResponseBytes = 64 << 10
+
+func (c *Client) Push(baseURL, token string, s Snippet) (string, error) {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/api/v1/quick", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Errors are problem details, with any invalid fields in errors. Instances from before that send them in error.
+	var output struct {
+		URL    string `json:"url"`
+		Detail string `json:"detail"`
+		Errors any    `json:"errors"`
+		Error  any    `json:"error"`
+	}
+
+	// A response that isn't JSON leaves output empty, which is handled below, so the error doesn't matter.
+	_ = json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&output)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "", ErrUnauthorized
+	case resp.StatusCode != http.StatusCreated:
+		var problem any
+		switch {
+		case output.Errors != nil:
+			problem = output.Errors
+		case output.Detail != "":
+			problem = output.Detail
+		default:
+			problem = output.Error
+		}
+		if problem != nil {
+			return "", fmt.Errorf("federation: unexpected status from remote instance: %s: %v", resp.Status, problem)
+		}
+		return "", fmt.Errorf("federation: unexpected status from remote instance: %s", resp.Status)
+	}
+
+	// Only accept a link back to the same instance, so that a misbehaving remote can't make us show a link to somewhere else.
+	u, err := url.Parse(output.URL)
+	if err != nil || !sameOrigin(u, baseURL) {
+		return "", fmt.Errorf("federation: remote instance returned an unexpected URL %q", output.URL)
+	}
+
+	return output.URL, nil
+}
+
+// sameOrigin reports whether u has the same scheme and host as baseURL.
+func sameOrigin(u *url.URL, baseURL string) bool {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == base.Scheme && strings.EqualFold(u.Host, base.Host)
+}
+
+// ExpiryDays picks how many days the remote copy of a snippet should last for. The API only accepts 1, 7 or 365, so we use
+// the shortest of those which covers the time the snippet has left here.
+func ExpiryDays(expires, now time.Time) int {
+	left := expires.Sub(now)
+
+	for _, days := range []int{1, 7} {
+		if left <= time.Duration(days)*24*time.Hour {
+			return days
+		}
+	}
+
+	return 365
+}
+
+// CheckBaseURL returns an error describing what's wrong with a remote instance's base URL, or nil if it's fine.
+// Tokens are sent to it, so it has to use HTTPS.
+func CheckBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	switch {
+	case err != nil || u.Host == "":
+		return errors.New("must be a full URL like https://snippets.example.com")
+	case u.Scheme != "https":
+		return errors.New("must use https")
+	case u.User != nil || u.RawQuery != "" || u.Fragment != "":
+		return errors.New("must not include a username, query or fragment")
+	case netguard.PrivateHost(u.Hostname()):
+		return errors.New("must not point to a private network address")
+	}
+
+	return nil
+}
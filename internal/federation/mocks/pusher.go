@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/federation"
+)
+
+// Pusher accepts every snippet, unless Err is set. It remembers the last snippet it was given, so tests can check what
+// would have been sent.
+type Pusher struct {
+	Err  error
+	Last federation.Snippet
+}
+
+func (p *Pusher) Push(baseURL, token string, s federation.Snippet) (string, error) {
+	if p.Err != nil {
+		return "", p.Err
+	}
+
+	p.Last = s
+	return baseURL + "/snippet/view/01HV5Q9Z8Y7X6W5V4T3S2R1Q0P", nil
+}
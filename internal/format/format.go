@@ -0,0 +1,62 @@
+// Package format pretty-prints structured snippets, like minified JSON, into a canonical form. Each format has its own
+// Formatter, and a Registry picks the first one which matches the content.
+package format
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/langdetect"
+)
+
+// ErrNoFormatter is returned by Registry.Format() when none of the formatters match the content.
+var ErrNoFormatter = errors.New("format: no formatter for this content")
+
+// Formatter is implemented by each per-language formatter. Match is given the language detected by langdetect.Detect(),
+// as well as the content, for formats which Detect() doesn't know about (like XML).
+type Formatter interface {
+	Name() string
+	Match(language, content string) bool
+	Format(content string) (string, error)
+}
+
+// Registry holds the available formatters. Add more with Add().
+type Registry struct {
+	formatters []Formatter
+}
+
+// New returns a Registry with the built-in JSON, XML and SQL formatters.
+func New() *Registry {
+	return &Registry{formatters: []Formatter{JSON{}, XML{}, SQL{}}}
+}
+
+// Add registers another formatter. Formatters are tried in the order they were added.
+func (r *Registry) Add(f Formatter) {
+	r.formatters = append(r.formatters, f)
+}
+
+// Find returns the first formatter which matches the content, or nil if there isn't one.
+func (r *Registry) Find(content string) Formatter {
+	language := langdetect.Detect(content)
+
+	for _, f := range r.formatters {
+		if f.Match(language, content) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// Format reformats the content with the first matching formatter, and returns the result along with the formatter's name.
+func (r *Registry) Format(content string) (string, string, error) {
+	f := r.Find(content)
+	if f == nil {
+		return "", "", ErrNoFormatter
+	}
+
+	formatted, err := f.Format(content)
+	if err != nil {
+		return "", f.Name(), err
+	}
+
+	return formatted, f.Name(), nil
+}
@@ -0,0 +1,66 @@
+package format
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		wantFormatter string
+		want          string
+	}{
+		{
+			name:          "JSON",
+			content:       `{"a":[1,2,{"b":null}]}`,
+			wantFormatter: "JSON",
+			want:          "{\n  \"a\": [\n    1,\n    2,\n    {\n      \"b\": null\n    }\n  ]\n}\n",
+		},
+		{
+			name:          "XML",
+			content:       `<?xml version="1.0"?><soap:Envelope xmlns:soap="http://example.com/soap"><soap:Body id="1"><name>Alice  Jones</name></soap:Body></soap:Envelope>`,
+			wantFormatter: "XML",
+			want:          "<?xml version=\"1.0\"?>\n<soap:Envelope xmlns:soap=\"http://example.com/soap\">\n  <soap:Body id=\"1\">\n    <name>Alice  Jones</name>\n  </soap:Body>\n</soap:Envelope>\n",
+		},
+		{
+			name:          "SQL",
+			content:       "select id, count(*) as total from snippets where title = 'Select ''from'' where' and user_id in (1, 2) group by id order by total desc; delete from tokens where expiry < now()",
+			wantFormatter: "SQL",
+			want:          "SELECT id, COUNT(*) AS total\nFROM snippets\nWHERE title = 'Select ''from'' where' AND user_id IN (1, 2)\nGROUP BY id\nORDER BY total DESC;\n\nDELETE FROM tokens\nWHERE expiry < now()\n",
+		},
+	}
+
+	r := New()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, formatter, err := r.Format(tt.content)
+			asserts.NilError(t, err)
+			asserts.Equal(t, formatter, tt.wantFormatter)
+			asserts.Equal(t, got, tt.want)
+
+			// Formatting is idempotent, so the preview can say when a snippet is already formatted.
+			again, _, err := r.Format(got)
+			asserts.NilError(t, err)
+			asserts.Equal(t, again, got)
+		})
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	r := New()
+
+	_, _, err := r.Format("An old silent pond...")
+	if !errors.Is(err, ErrNoFormatter) {
+		t.Errorf("got %v; want ErrNoFormatter", err)
+	}
+
+	_, formatter, err := r.Format(`<?xml version="1.0"?><a><b></a>`)
+	asserts.Equal(t, formatter, "XML")
+	if err == nil {
+		t.Error("got nil; want an error for mismatched XML tags")
+	}
+}
@@ -0,0 +1,30 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/0xshiku/snippetbox/internal/langdetect"
+	"strings"
+)
+
+// JSON indents JSON with two spaces. Keys keep their original order.
+type JSON struct{}
+
+func (JSON) Name() string {
+	return "JSON"
+}
+
+func (JSON) Match(language, _ string) bool {
+	return language == langdetect.JSON
+}
+
+func (JSON) Format(content string) (string, error) {
+	var buf bytes.Buffer
+
+	err := json.Indent(&buf, []byte(strings.TrimSpace(content)), "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String() + "\n", nil
+}
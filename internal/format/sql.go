@@ -0,0 +1,194 @@
+package format
+
+import (
+	"github.com/0xshiku/snippetbox/internal/langdetect"
+	"strings"
+	"unicode"
+)
+
+// sqlClauses are the keywords which start a new line. Multi-word keywords are matched as a whole, so "ORDER BY" and
+// "LEFT JOIN" each go on one line. Longer keywords come first, so that "LEFT JOIN" wins over "JOIN".
+var sqlClauses = []string{
+	"INSERT INTO", "DELETE FROM", "GROUP BY", "ORDER BY", "UNION ALL", "LEFT JOIN", "RIGHT JOIN", "INNER JOIN", "OUTER JOIN",
+	"CROSS JOIN", "SELECT", "FROM", "WHERE", "HAVING", "LIMIT", "OFFSET", "JOIN", "UNION", "VALUES", "UPDATE", "SET",
+}
+
+// sqlKeywords are the other keywords which are upper-cased, but stay on the same line.
+var sqlKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "NULL": true, "IS": true, "IN": true, "AS": true, "ON": true, "LIKE": true,
+	"BETWEEN": true, "EXISTS": true, "DISTINCT": true, "ASC": true, "DESC": true, "CASE": true, "WHEN": true, "THEN": true,
+	"ELSE": true, "END": true, "COUNT": true, "INTO": true, "BY": true, "CREATE": true, "TABLE": true, "INDEX": true,
+	"PRIMARY": true, "KEY": true, "DEFAULT": true, "TRUE": true, "FALSE": true,
+}
+
+// SQL puts each clause of a SQL statement on its own line, upper-cases the keywords and separates statements with a blank
+// line. Strings, quoted identifiers and comments are left exactly as they were.
+type SQL struct{}
+
+func (SQL) Name() string {
+	return "SQL"
+}
+
+// Match accepts anything detected as SQL, and also plain text which starts with a statement keyword, because Detect() needs
+// more than a single short query to be sure.
+func (SQL) Match(language, content string) bool {
+	if language == langdetect.SQL {
+		return true
+	}
+
+	first, _, _ := strings.Cut(strings.TrimSpace(content), " ")
+	switch strings.ToUpper(first) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "CREATE", "WITH":
+		return language == langdetect.PlainText
+	}
+
+	return false
+}
+
+func (SQL) Format(content string) (string, error) {
+	tokens := sqlTokens(content)
+
+	var b strings.Builder
+	lineStart := true
+
+	newline := func() {
+		if !lineStart {
+			b.WriteString("\n")
+			lineStart = true
+		}
+	}
+	// Words are always separated by a space. Punctuation keeps the spacing it had, so that function calls like COUNT(*)
+	// stay together, but a column list after a table name keeps its space.
+	prev := ""
+	write := func(t sqlToken) {
+		s := t.text
+		switch {
+		case lineStart:
+		case s == "," || s == ")" || prev == "(":
+		case s == "(" && !t.space:
+		default:
+			b.WriteString(" ")
+		}
+		b.WriteString(s)
+		lineStart = false
+		prev = s
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+
+		switch {
+		case strings.HasPrefix(t.text, "--") || strings.HasPrefix(t.text, "#"):
+			// Line comments run to the end of the line, so they have to be followed by a newline.
+			write(t)
+			newline()
+			continue
+		case t.text == ";":
+			b.WriteString(";\n\n")
+			lineStart = true
+			continue
+		}
+
+		if clause, n := matchClause(tokens[i:]); n > 0 {
+			newline()
+			write(sqlToken{text: clause})
+			i += n - 1
+			continue
+		}
+
+		if sqlKeywords[strings.ToUpper(t.text)] {
+			t.text = strings.ToUpper(t.text)
+		}
+		write(t)
+	}
+
+	return strings.TrimRight(b.String(), "\n") + "\n", nil
+}
+
+// matchClause checks whether the tokens start with one of the sqlClauses, and returns it with the number of tokens it used.
+func matchClause(tokens []sqlToken) (string, int) {
+	for _, clause := range sqlClauses {
+		words := strings.Fields(clause)
+		if len(words) > len(tokens) {
+			continue
+		}
+
+		matched := true
+		for j, word := range words {
+			if !strings.EqualFold(tokens[j].text, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return clause, len(words)
+		}
+	}
+
+	return "", 0
+}
+
+// A sqlToken is a word, punctuation, quoted string or comment. Space records whether there was whitespace before it.
+type sqlToken struct {
+	text  string
+	space bool
+}
+
+// sqlTokens splits SQL into tokens. Whitespace is dropped, except inside strings and block comments.
+func sqlTokens(content string) []sqlToken {
+	var tokens []sqlToken
+	runes := []rune(content)
+	space := false
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			space = true
+			continue
+		case r == '\'' || r == '"' || r == '`':
+			// A quoted string or identifier runs to the matching quote. A doubled quote is an escaped quote.
+			i++
+			for i < len(runes) {
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				if runes[i] == '\\' && r != '`' {
+					i++
+				}
+				i++
+			}
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-', r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				i++
+			}
+			i = min(i+2, len(runes))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '@' || r == '$':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("_.@$", runes[i])) {
+				i++
+			}
+		case strings.ContainsRune("<>!=", r) && i+1 < len(runes) && strings.ContainsRune("=>", runes[i+1]):
+			i += 2
+		default:
+			i++
+		}
+
+		tokens = append(tokens, sqlToken{text: string(runes[start:min(i, len(runes))]), space: space})
+		space = false
+	}
+
+	return tokens
+}
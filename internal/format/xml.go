@@ -0,0 +1,92 @@
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// XML indents XML documents with two spaces. Whitespace between elements is replaced, but text inside elements is kept.
+// Empty elements are written out in full, like <br></br>, as that's what encoding/xml does.
+type XML struct{}
+
+func (XML) Name() string {
+	return "XML"
+}
+
+// Match accepts content which starts with an XML declaration. HTML is left alone, because browsers are much more forgiving
+// of it than an XML parser is.
+func (XML) Match(_, content string) bool {
+	return strings.HasPrefix(strings.TrimSpace(content), "<?xml")
+}
+
+func (XML) Format(content string) (string, error) {
+	d := xml.NewDecoder(strings.NewReader(content))
+
+	var buf bytes.Buffer
+	e := xml.NewEncoder(&buf)
+	e.Indent("", "  ")
+
+	for {
+		token, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// Drop the whitespace between elements, so that the encoder's indentation replaces it.
+		if data, ok := token.(xml.CharData); ok && len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+
+		err = e.EncodeToken(flattenNames(xml.CopyToken(token)))
+		if err != nil {
+			return "", err
+		}
+
+		// The encoder only indents elements, so put the XML declaration on a line of its own.
+		if _, ok := token.(xml.ProcInst); ok {
+			err = e.Flush()
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString("\n")
+		}
+	}
+
+	err := e.Flush()
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String() + "\n", nil
+}
+
+// flattenNames puts namespace prefixes back into element and attribute names. RawToken() splits "soap:Body" into the prefix
+// and the local name, but the encoder expects a namespace URL in place of the prefix, and would add an xmlns attribute for it.
+func flattenNames(token xml.Token) xml.Token {
+	flatten := func(name xml.Name) xml.Name {
+		if name.Space == "" {
+			return name
+		}
+		return xml.Name{Local: name.Space + ":" + name.Local}
+	}
+
+	switch t := token.(type) {
+	case xml.StartElement:
+		t.Name = flatten(t.Name)
+		for i := range t.Attr {
+			t.Attr[i].Name = flatten(t.Attr[i].Name)
+		}
+		return t
+	case xml.EndElement:
+		t.Name = flatten(t.Name)
+		return t
+	}
+
+	return token
+}
@@ -0,0 +1,72 @@
+// Package hash hashes and verifies passwords. Each algorithm is a Hasher, and a Set hashes new passwords with the current
+// algorithm while still verifying hashes made with the others. Every hash starts with a tag naming its algorithm, like
+// "$2a$" for bcrypt or "$argon2id$", so the Set can tell which Hasher made it. That lets us switch algorithms (or raise
+// their parameters) and upgrade each user's hash the next time they log in, rather than all at once.
+package hash
+
+import (
+	"errors"
+)
+
+var (
+	// ErrMismatch is returned when the password doesn't match the hash.
+	ErrMismatch = errors.New("hash: password doesn't match")
+	// ErrUnknownAlgorithm is returned when no Hasher in the Set recognizes the hash.
+	ErrUnknownAlgorithm = errors.New("hash: unknown hash algorithm")
+)
+
+// Hasher is implemented by each password hashing algorithm.
+type Hasher interface {
+	// Hash returns a tagged hash of the password, made with the Hasher's current parameters.
+	Hash(password string) (string, error)
+	// Identify reports whether the hash was made by this algorithm, with any parameters.
+	Identify(hash string) bool
+	// Verify returns nil if the password matches the hash, or ErrMismatch if it doesn't.
+	Verify(hash, password string) error
+	// Outdated reports whether the hash was made with weaker parameters than the Hasher's current ones.
+	Outdated(hash string) bool
+}
+
+// Set hashes new passwords with Current, and verifies hashes made by Current or any of Others.
+type Set struct {
+	Current Hasher
+	Others  []Hasher
+}
+
+// NewSet returns a Set which hashes with current. Bcrypt hashes can always be verified, because every existing
+// password started out as one.
+func NewSet(current Hasher) *Set {
+	s := &Set{Current: current}
+	if _, ok := current.(Bcrypt); !ok {
+		s.Others = append(s.Others, Bcrypt{Cost: DefaultBcryptCost})
+	}
+	return s
+}
+
+func (s *Set) Hash(password string) (string, error) {
+	return s.Current.Hash(password)
+}
+
+// Verify checks the password against the hash. If it matches, rehash reports whether the hash should be replaced with a new
+// one from Hash(), because it was made by another algorithm or with weaker parameters.
+func (s *Set) Verify(hash, password string) (rehash bool, err error) {
+	if s.Current.Identify(hash) {
+		err = s.Current.Verify(hash, password)
+		if err != nil {
+			return false, err
+		}
+		return s.Current.Outdated(hash), nil
+	}
+
+	for _, h := range s.Others {
+		if h.Identify(hash) {
+			err = h.Verify(hash, password)
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+
+	return false, ErrUnknownAlgorithm
+}
@@ -0,0 +1,141 @@
+package hash
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// testArgon2id uses as little memory as possible, so that the tests run quickly.
+var testArgon2id = Argon2id{Memory: 8, Iterations: 1, Parallelism: 1}
+
+func TestHashers(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher Hasher
+		prefix string
+	}{
+		{
+			name:   "Bcrypt",
+			hasher: Bcrypt{Cost: bcrypt.MinCost},
+			prefix: "$2a$04$",
+		},
+		{
+			name:   "Argon2id",
+			hasher: testArgon2id,
+			prefix: "$argon2id$v=19$m=8,t=1,p=1$",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashed, err := tt.hasher.Hash("pa$$word")
+			asserts.NilError(t, err)
+			asserts.Equal(t, strings.HasPrefix(hashed, tt.prefix), true)
+			asserts.Equal(t, tt.hasher.Identify(hashed), true)
+			asserts.Equal(t, tt.hasher.Outdated(hashed), false)
+
+			asserts.NilError(t, tt.hasher.Verify(hashed, "pa$$word"))
+			asserts.Equal(t, tt.hasher.Verify(hashed, "password"), ErrMismatch)
+
+			// Hashing the same password twice uses a different salt.
+			again, err := tt.hasher.Hash("pa$$word")
+			asserts.NilError(t, err)
+			asserts.Equal(t, again == hashed, false)
+		})
+	}
+}
+
+func TestArgon2idOutdated(t *testing.T) {
+	hashed, err := testArgon2id.Hash("pa$$word")
+	asserts.NilError(t, err)
+
+	asserts.Equal(t, Argon2id{Memory: 16, Iterations: 1, Parallelism: 1}.Outdated(hashed), true)
+	asserts.Equal(t, Argon2id{Memory: 8, Iterations: 2, Parallelism: 1}.Outdated(hashed), true)
+
+	// Hashes made with the old parameters can still be verified.
+	asserts.NilError(t, Argon2id{Memory: 16, Iterations: 2, Parallelism: 1}.Verify(hashed, "pa$$word"))
+}
+
+func TestArgon2idMalformed(t *testing.T) {
+	for _, hashed := range []string{
+		"$argon2id$",
+		"$argon2id$v=16$m=8,t=1,p=1$c2FsdHNhbHRzYWx0$a2V5",
+		"$argon2id$v=19$m=8$c2FsdHNhbHRzYWx0$a2V5",
+		"$argon2id$v=19$m=8,t=1,p=1$not base64$a2V5",
+		"$argon2id$v=19$m=8,t=1,p=1$c2FsdHNhbHRzYWx0$",
+	} {
+		err := testArgon2id.Verify(hashed, "pa$$word")
+		if err == nil || errors.Is(err, ErrMismatch) {
+			t.Errorf("%s: got: %v; want: malformed hash error", hashed, err)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	bcryptHash, err := Bcrypt{Cost: bcrypt.MinCost}.Hash("pa$$word")
+	asserts.NilError(t, err)
+
+	argon2Hash, err := testArgon2id.Hash("pa$$word")
+	asserts.NilError(t, err)
+
+	tests := []struct {
+		name       string
+		set        *Set
+		hashed     string
+		password   string
+		wantRehash bool
+		wantErr    error
+	}{
+		{
+			name:     "Current bcrypt",
+			set:      NewSet(Bcrypt{Cost: bcrypt.MinCost}),
+			hashed:   bcryptHash,
+			password: "pa$$word",
+		},
+		{
+			name:       "Bcrypt cost raised",
+			set:        NewSet(Bcrypt{Cost: bcrypt.MinCost + 1}),
+			hashed:     bcryptHash,
+			password:   "pa$$word",
+			wantRehash: true,
+		},
+		{
+			name:       "Migrating from bcrypt",
+			set:        NewSet(testArgon2id),
+			hashed:     bcryptHash,
+			password:   "pa$$word",
+			wantRehash: true,
+		},
+		{
+			name:     "Current Argon2id",
+			set:      NewSet(testArgon2id),
+			hashed:   argon2Hash,
+			password: "pa$$word",
+		},
+		{
+			name:     "Wrong password",
+			set:      NewSet(testArgon2id),
+			hashed:   bcryptHash,
+			password: "password",
+			wantErr:  ErrMismatch,
+		},
+		{
+			name:     "Unknown algorithm",
+			set:      NewSet(Bcrypt{Cost: bcrypt.MinCost}),
+			hashed:   argon2Hash,
+			password: "pa$$word",
+			wantErr:  ErrUnknownAlgorithm,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := tt.set.Verify(tt.hashed, tt.password)
+			asserts.Equal(t, err, tt.wantErr)
+			asserts.Equal(t, rehash, tt.wantRehash)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package ids
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Define the names of the available ID schemes, as used in the configuration.
+const (
+	SchemeULID      = "ulid"
+	SchemeSnowflake = "snowflake"
+)
+
+// Generator is implemented by anything which can create new public identifiers.
+// Public identifiers are used in URLs instead of the auto-increment primary key, so that
+// visitors can't enumerate records or work out how many have been created.
+type Generator interface {
+	New() (string, error)
+}
+
+// New returns the generator for the given scheme. The node number is only used by the snowflake scheme.
+func New(scheme string, node int64) (Generator, error) {
+	switch scheme {
+	case SchemeULID:
+		return ULID{}, nil
+	case SchemeSnowflake:
+		return NewSnowflake(node)
+	default:
+		return nil, fmt.Errorf("ids: unknown scheme %q", scheme)
+	}
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs. It leaves out I, L, O and U to avoid confusion.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates 26 character Universally Unique Lexicographically Sortable Identifiers: a 48-bit millisecond
+// timestamp followed by 80 random bits. The random part makes them impossible to guess.
+type ULID struct{}
+
+func (ULID) New() (string, error) {
+	var b [16]byte
+
+	ms := uint64(time.Now().UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+
+	_, err := rand.Read(b[6:])
+	if err != nil {
+		return "", err
+	}
+
+	return encodeULID(b), nil
+}
+
+// encodeULID encodes the 128 bits as 26 base32 characters, 5 bits at a time, starting with the 2 leftover high bits.
+func encodeULID(b [16]byte) string {
+	out := make([]byte, 26)
+
+	hi := uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
+		uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
+	lo := uint64(b[8])<<56 | uint64(b[9])<<48 | uint64(b[10])<<40 | uint64(b[11])<<32 |
+		uint64(b[12])<<24 | uint64(b[13])<<16 | uint64(b[14])<<8 | uint64(b[15])
+
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out)
+}
+
+// The snowflake layout: 41 bits of milliseconds since snowflakeEpoch, 10 bits of node number and a 12 bit sequence.
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxNode      = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch is the start of the snowflake timestamps (2024-01-01T00:00:00Z).
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake generates compact, time-ordered 64-bit identifiers. Every instance of the application must be given a
+// different node number. Unlike ULIDs they are not random, but they don't reveal the number of records created.
+type Snowflake struct {
+	mu       sync.Mutex
+	node     int64
+	lastMs   int64
+	sequence int64
+}
+
+// NewSnowflake returns a snowflake generator for the given node number (0-1023).
+func NewSnowflake(node int64) (*Snowflake, error) {
+	if node < 0 || node > snowflakeMaxNode {
+		return nil, fmt.Errorf("ids: snowflake node must be between 0 and %d", snowflakeMaxNode)
+	}
+
+	return &Snowflake{node: node}, nil
+}
+
+func (s *Snowflake) New() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := time.Since(snowflakeEpoch).Milliseconds()
+	if ms < s.lastMs {
+		// The clock went backwards. Carry on from the last timestamp rather than risk duplicates.
+		ms = s.lastMs
+	}
+
+	if ms == s.lastMs {
+		s.sequence = (s.sequence + 1) & snowflakeMaxSequence
+		if s.sequence == 0 {
+			// The sequence for this millisecond is used up, so wait for the next one.
+			for ms <= s.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				ms = time.Since(snowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+
+	if ms >= 1<<41 {
+		return "", errors.New("ids: snowflake timestamp overflow")
+	}
+
+	s.lastMs = ms
+
+	id := ms<<(snowflakeNodeBits+snowflakeSequenceBits) | s.node<<snowflakeSequenceBits | s.sequence
+
+	return strconv.FormatInt(id, 10), nil
+}
@@ -0,0 +1,79 @@
+package ids
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"strings"
+	"testing"
+)
+
+func TestULID(t *testing.T) {
+	seen := map[string]bool{}
+
+	for i := 0; i < 1000; i++ {
+		id, err := ULID{}.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		asserts.Equal(t, len(id), 26)
+		for _, r := range id {
+			if !strings.ContainsRune(crockford, r) {
+				t.Fatalf("unexpected character %q in %q", r, id)
+			}
+		}
+
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	var b [16]byte
+	asserts.Equal(t, encodeULID(b), "00000000000000000000000000")
+
+	for i := range b {
+		b[i] = 0xff
+	}
+	asserts.Equal(t, encodeULID(b), "7ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+}
+
+func TestSnowflake(t *testing.T) {
+	_, err := NewSnowflake(1024)
+	if err == nil {
+		t.Error("got: nil; want: error for node out of range")
+	}
+
+	g, err := NewSnowflake(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+
+	for i := 0; i < 10000; i++ {
+		id, err := g.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("uuid", 0)
+	if err == nil {
+		t.Error("got: nil; want: error for unknown scheme")
+	}
+
+	g, err := New(SchemeULID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asserts.Equal(t, g, Generator(ULID{}))
+}
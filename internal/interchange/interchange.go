@@ -0,0 +1,182 @@
+// Package interchange reads and writes the JSON Lines format used to move snippets between Snippetbox instances.
+//
+// A file (or request body) holds one snippet per line, each a JSON object with these keys:
+//
+//	v           The version of the format. Always 1 for now. Required.
+//	id          The snippet's public ID on the instance it was exported from. Informational only: imported
+//	            snippets get new IDs, because the old ones might already be taken.
+//	title       Up to 100 characters. Required.
+//	content     The snippet itself. Required.
+//	created     When the snippet was created, in RFC 3339 format. Required.
+//	expires     When the snippet expires, in RFC 3339 format. Required, and must be after created.
+//	visibility  "public" or "unlisted". Defaults to "public".
+//	owner       The username of the snippet's owner, if it had one.
+//	tags        A list of tags. Optional.
+//	versions    Earlier versions of the snippet, oldest first, each with title, content and created keys. Optional.
+//
+// Blank lines are ignored. Readers must reject lines with a version they don't know, rather than guessing.
+//
+// This instance doesn't store tags or versions yet, so it never writes them, and ignores them when importing.
+// They're part of the format so that files from instances which do can still be read.
+package interchange
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Version is the version of the format written by this package.
+const Version = 1
+
+// MaxLineLength is the longest line that a Reader accepts. It's much bigger than any snippet we'd expect, but stops
+// a malformed file from using up all the memory.
+const MaxLineLength = 4 << 20
+
+// Snippet is one line of the format.
+type Snippet struct {
+	V          int        `json:"v"`
+	ID         string     `json:"id,omitempty"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+	Created    time.Time  `json:"created"`
+	Expires    time.Time  `json:"expires"`
+	Visibility string     `json:"visibility,omitempty"`
+	Owner      string     `json:"owner,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Versions   []Revision `json:"versions,omitempty"`
+}
+
+// Revision is an earlier version of a snippet.
+type Revision struct {
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+}
+
+// Validate checks that the snippet follows the rules of the format, and fills in the default visibility.
+func (s *Snippet) Validate() error {
+	if s.Visibility == "" {
+		s.Visibility = models.VisibilityPublic
+	}
+
+	switch {
+	case s.V != Version:
+		return fmt.Errorf("unsupported version %d", s.V)
+	case strings.TrimSpace(s.Title) == "":
+		return errors.New("title must be provided")
+	case utf8.RuneCountInString(s.Title) > 100:
+		return errors.New("title must not be more than 100 characters long")
+	case strings.TrimSpace(s.Content) == "":
+		return errors.New("content must be provided")
+	case s.Created.IsZero():
+		return errors.New("created must be provided")
+	case !s.Expires.After(s.Created):
+		return errors.New("expires must be after created")
+	case s.Visibility != models.VisibilityPublic && s.Visibility != models.VisibilityUnlisted:
+		return errors.New("visibility must be public or unlisted")
+	}
+
+	return nil
+}
+
+// Writer writes snippets as JSON Lines.
+type Writer struct {
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer) *Writer {
+	enc := json.NewEncoder(w)
+	// Snippets are full of code, so keep <, > and & readable.
+	enc.SetEscapeHTML(false)
+	return &Writer{enc: enc}
+}
+
+// Write writes one snippet on its own line, setting its version.
+func (w *Writer) Write(s *Snippet) error {
+	s.V = Version
+	return w.enc.Encode(s)
+}
+
+// Reader reads snippets from JSON Lines.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineLength)
+	return &Reader{scanner: scanner}
+}
+
+// LineError is returned by Read for a line which isn't a valid snippet. Reading can carry on with the next line.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Read returns the next snippet, or io.EOF when there are no more. A *LineError means that one line was invalid,
+// and the caller can decide whether to skip it or stop. Any other error means the input couldn't be read at all.
+func (r *Reader) Read() (*Snippet, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := r.scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var s Snippet
+		err := json.Unmarshal(line, &s)
+		if err != nil {
+			return nil, &LineError{Line: r.line, Err: err}
+		}
+
+		err = s.Validate()
+		if err != nil {
+			return nil, &LineError{Line: r.line, Err: err}
+		}
+
+		return &s, nil
+	}
+
+	err := r.scanner.Err()
+	if err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line %d: longer than %d bytes", r.line+1, MaxLineLength)
+		}
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// FromModel converts a snippet from the database to the interchange format. The owner is the username of the snippet's
+// owner, or the empty string for an anonymous snippet.
+func FromModel(s *models.Snippet, owner string) *Snippet {
+	return &Snippet{
+		V:          Version,
+		ID:         s.PublicID,
+		Title:      s.Title,
+		Content:    s.Content,
+		Created:    s.Created.UTC(),
+		Expires:    s.Expires.UTC(),
+		Visibility: s.Visibility,
+		Owner:      owner,
+	}
+}
@@ -0,0 +1,109 @@
+package interchange
+
+import (
+	"bytes"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	want := &Snippet{
+		ID:         "01HV5Q4N5P6Q7R8S9T0V1W2X3Y",
+		Title:      "An old silent pond",
+		Content:    "if a < b && b > c {\n}",
+		Created:    created,
+		Expires:    created.Add(24 * time.Hour),
+		Visibility: "unlisted",
+		Owner:      "alice",
+	}
+
+	var buf bytes.Buffer
+	err := NewWriter(&buf).Write(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Code should stay readable in the file.
+	asserts.StringContains(t, buf.String(), `a < b && b > c`)
+
+	got, err := NewReader(&buf).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asserts.Equal(t, got.V, Version)
+	asserts.Equal(t, got.ID, want.ID)
+	asserts.Equal(t, got.Title, want.Title)
+	asserts.Equal(t, got.Content, want.Content)
+	asserts.Equal(t, got.Created.Equal(want.Created), true)
+	asserts.Equal(t, got.Expires.Equal(want.Expires), true)
+	asserts.Equal(t, got.Visibility, want.Visibility)
+	asserts.Equal(t, got.Owner, want.Owner)
+}
+
+func TestRead(t *testing.T) {
+	input := strings.Join([]string{
+		`{"v":1,"title":"First","content":"one","created":"2024-01-01T00:00:00Z","expires":"2024-01-02T00:00:00Z"}`,
+		``,
+		`{"v":2,"title":"Future","content":"two","created":"2024-01-01T00:00:00Z","expires":"2024-01-02T00:00:00Z"}`,
+		`{"v":1,"title":"","content":"three","created":"2024-01-01T00:00:00Z","expires":"2024-01-02T00:00:00Z"}`,
+		`{"v":1,"title":"Backwards","content":"four","created":"2024-01-02T00:00:00Z","expires":"2024-01-01T00:00:00Z"}`,
+		`{"v":1,"title":"Private","content":"five","created":"2024-01-01T00:00:00Z","expires":"2024-01-02T00:00:00Z","visibility":"private"}`,
+		`not json`,
+		`{"v":1,"title":"Last","content":"six","created":"2024-01-01T00:00:00Z","expires":"2024-01-02T00:00:00Z","tags":["go"],"versions":[{"title":"Old","content":"5","created":"2023-12-31T00:00:00Z"}]}`,
+	}, "\n")
+
+	r := NewReader(strings.NewReader(input))
+
+	s, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	asserts.Equal(t, s.Title, "First")
+	asserts.Equal(t, s.Visibility, "public")
+
+	// The blank line is skipped, so the invalid lines keep their own line numbers.
+	for _, want := range []string{
+		"line 3: unsupported version 2",
+		"line 4: title must be provided",
+		"line 5: expires must be after created",
+		"line 6: visibility must be public or unlisted",
+		"line 7: ",
+	} {
+		_, err := r.Read()
+
+		var lineErr *LineError
+		if !errors.As(err, &lineErr) {
+			t.Fatalf("got %v; want a *LineError", err)
+		}
+		asserts.StringContains(t, err.Error(), want)
+	}
+
+	s, err = r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	asserts.Equal(t, s.Title, "Last")
+	asserts.Equal(t, len(s.Tags), 1)
+	asserts.Equal(t, len(s.Versions), 1)
+
+	_, err = r.Read()
+	asserts.Equal(t, err, io.EOF)
+}
+
+func TestReadTooLong(t *testing.T) {
+	input := strings.Repeat("x", MaxLineLength+1)
+
+	_, err := NewReader(strings.NewReader(input)).Read()
+
+	var lineErr *LineError
+	if err == nil || errors.As(err, &lineErr) {
+		t.Fatalf("got %v; want an error which stops the import", err)
+	}
+	asserts.StringContains(t, err.Error(), "line 1: longer than")
+}
@@ -0,0 +1,149 @@
+// Package jwt issues and verifies the short-lived access tokens for the API. They're JSON Web Tokens (RFC 7519) signed
+// with HMAC-SHA256, so that a request can be authenticated without looking the token up in the database.
+//
+// Each key has an ID, which goes in the token's "kid" header. Tokens are always signed with the first key, but are
+// accepted if they were signed with any of them, so that a key can be rotated by putting a new one in front of it and
+// removing the old one once the tokens it signed have expired.
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("jwt: malformed token or invalid signature")
+	ErrUnknownKey   = errors.New("jwt: token was signed with an unknown key")
+	ErrExpired      = errors.New("jwt: token has expired")
+)
+
+// Key is a signing key and the ID that tokens refer to it by.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Claims are the registered claims that the tokens carry. The subject is the ID of the user that the token belongs to.
+type Claims struct {
+	Subject  string `json:"sub"`
+	IssuedAt int64  `json:"iat"`
+	Expiry   int64  `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Signer makes and checks tokens. It is safe for concurrent use.
+type Signer struct {
+	keys []Key
+	now  func() time.Time
+}
+
+// New returns a Signer which signs tokens with the first key, and accepts tokens signed with any of them. It panics if
+// there aren't any keys.
+func New(keys []Key) *Signer {
+	if len(keys) == 0 {
+		panic("jwt: no signing keys")
+	}
+	return &Signer{keys: keys, now: time.Now}
+}
+
+// Is reports whether a bearer token looks like a JWT (three dot-separated parts), rather than an opaque token.
+func Is(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Sign returns a token for the subject which expires after the ttl, and the time that it expires.
+func (s *Signer) Sign(subject string, ttl time.Duration) (string, time.Time, error) {
+	now := s.now()
+	expiry := now.Add(ttl)
+
+	key := s.keys[0]
+
+	h, err := json.Marshal(header{Algorithm: "HS256", Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	c, err := json.Marshal(Claims{Subject: subject, IssuedAt: now.Unix(), Expiry: expiry.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := encode(h) + "." + encode(c)
+	return unsigned + "." + encode(sign(key.Secret, unsigned)), time.Unix(expiry.Unix(), 0).UTC(), nil
+}
+
+// Verify checks a token's signature and expiry, and returns its claims. It returns one of the package's errors if the
+// token isn't valid.
+func (s *Signer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	err := decode(parts[0], &h)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Only accept the one algorithm that we sign with, so that a token can't choose a weaker one (or "none").
+	if h.Algorithm != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	var key *Key
+	for i := range s.keys {
+		if s.keys[i].ID == h.KeyID {
+			key = &s.keys[i]
+			break
+		}
+	}
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, sign(key.Secret, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	var c Claims
+	err = decode(parts[1], &c)
+	if err != nil || c.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if s.now().Unix() >= c.Expiry {
+		return nil, ErrExpired
+	}
+
+	return &c, nil
+}
+
+func sign(secret []byte, unsigned string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,96 @@
+package jwt
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	oldKey := Key{ID: "old", Secret: []byte("old key")}
+	newKey := Key{ID: "new", Secret: []byte("new key")}
+
+	// The old signer is the one from before the key was rotated.
+	oldSigner := New([]Key{oldKey})
+	oldSigner.now = func() time.Time { return now }
+
+	s := New([]Key{newKey, oldKey})
+	s.now = func() time.Time { return now }
+
+	token, expiry, err := s.Sign("1", 15*time.Minute)
+	asserts.NilError(t, err)
+	asserts.Equal(t, expiry, now.Add(15*time.Minute))
+	asserts.Equal(t, Is(token), true)
+
+	oldToken, _, err := oldSigner.Sign("1", 15*time.Minute)
+	asserts.NilError(t, err)
+
+	parts := strings.Split(token, ".")
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		token  string
+		after  time.Duration
+		want   error
+	}{
+		{
+			name:   "Valid",
+			signer: s,
+			token:  token,
+			after:  time.Minute,
+		},
+		{
+			name:   "Signed with the old key",
+			signer: s,
+			token:  oldToken,
+			after:  time.Minute,
+		},
+		{
+			name:   "Signed with a key that's been removed",
+			signer: New([]Key{newKey}),
+			token:  oldToken,
+			want:   ErrUnknownKey,
+		},
+		{
+			name:   "Expired",
+			signer: s,
+			token:  token,
+			after:  15 * time.Minute,
+			want:   ErrExpired,
+		},
+		{
+			name:   "Changed claims",
+			signer: s,
+			token:  parts[0] + "." + encode([]byte(`{"sub":"2","iat":1704110400,"exp":1704111300}`)) + "." + parts[2],
+			want:   ErrInvalidToken,
+		},
+		{
+			name:   "No algorithm",
+			signer: s,
+			token:  encode([]byte(`{"alg":"none","typ":"JWT","kid":"new"}`)) + "." + parts[1] + ".",
+			want:   ErrInvalidToken,
+		},
+		{
+			name:   "Opaque token",
+			signer: s,
+			token:  "APITOKENAPITOKENAPITOKEN12",
+			want:   ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.signer.now = func() time.Time { return now.Add(tt.after) }
+
+			claims, err := tt.signer.Verify(tt.token)
+			asserts.Equal(t, err, tt.want)
+			if tt.want == nil {
+				asserts.Equal(t, claims.Subject, "1")
+			}
+		})
+	}
+}
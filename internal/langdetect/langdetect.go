@@ -0,0 +1,100 @@
+package langdetect
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// The names of the languages which Detect() can recognize.
+const (
+	PlainText  = "Plain text"
+	Go         = "Go"
+	Python     = "Python"
+	JavaScript = "JavaScript"
+	Shell      = "Shell"
+	SQL        = "SQL"
+	HTML       = "HTML"
+	JSON       = "JSON"
+	YAML       = "YAML"
+)
+
+// A rule pairs a language with a set of regular expressions. Each expression which matches the content adds one to the language's score.
+type rule struct {
+	language string
+	patterns []*regexp.Regexp
+}
+
+// Compile the patterns once at startup, in the same way as validators.EmailRX.
+var rules = []rule{
+	{Go, []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^package \w+`),
+		regexp.MustCompile(`(?m)^func (\(\w+ \*?\w+\) )?\w+\(`),
+		regexp.MustCompile(`:=`),
+		regexp.MustCompile(`(?m)^import \(`),
+	}},
+	{Python, []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^\s*def \w+\(.*\):\s*$`),
+		regexp.MustCompile(`(?m)^\s*(from \w+ )?import \w+`),
+		regexp.MustCompile(`(?m)^\s*if __name__ == .__main__.:`),
+		regexp.MustCompile(`(?m)^\s*(elif|except|class \w+.*):`),
+	}},
+	{JavaScript, []*regexp.Regexp{
+		regexp.MustCompile(`\b(const|let|var) \w+ =`),
+		regexp.MustCompile(`\bfunction\s*\w*\(`),
+		regexp.MustCompile(`=>`),
+		regexp.MustCompile(`console\.log\(`),
+	}},
+	{Shell, []*regexp.Regexp{
+		regexp.MustCompile(`^#!\s*/(usr/)?bin/(env )?(ba|z)?sh`),
+		regexp.MustCompile(`(?m)^\s*\$ \w+`),
+		regexp.MustCompile(`(?m)^\s*(echo|export|sudo|cd|fi|done)\b`),
+	}},
+	{SQL, []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bSELECT\b[\s\S]+\bFROM\b`),
+		regexp.MustCompile(`(?i)\bINSERT INTO\b`),
+		regexp.MustCompile(`(?i)\bCREATE (TABLE|INDEX)\b`),
+		regexp.MustCompile(`(?i)\bUPDATE \w+ SET\b`),
+	}},
+	{HTML, []*regexp.Regexp{
+		regexp.MustCompile(`(?i)<!doctype html`),
+		regexp.MustCompile(`(?i)<(html|head|body|div|span|p|a)[\s>]`),
+		regexp.MustCompile(`(?i)</\w+>`),
+	}},
+	{YAML, []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^---\s*$`),
+		regexp.MustCompile(`(?m)^[\w-]+:( .+)?$`),
+		regexp.MustCompile(`(?m)^\s+- \S`),
+	}},
+}
+
+// Detect makes a best guess at the programming language of the given content. It's based on a handful of simple heuristics,
+// so it's only intended for things like picking a sensible default title. If nothing matches, PlainText is returned.
+func Detect(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return PlainText
+	}
+
+	// JSON is the one language where we can be certain, so check it first.
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return JSON
+	}
+
+	best, bestScore := PlainText, 0
+	for _, r := range rules {
+		score := 0
+		for _, p := range r.patterns {
+			if p.MatchString(trimmed) {
+				score++
+			}
+		}
+
+		// Require at least two matching patterns, so a single stray "=>" or "key: value" doesn't decide the language.
+		if score >= 2 && score > bestScore {
+			best, bestScore = r.language, score
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,56 @@
+package langdetect
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "Empty",
+			content: "  ",
+			want:    PlainText,
+		},
+		{
+			name:    "Prose",
+			content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+			want:    PlainText,
+		},
+		{
+			name:    "JSON",
+			content: `{"name": "snippetbox", "stars": 3}`,
+			want:    JSON,
+		},
+		{
+			name:    "Go",
+			content: "package main\n\nfunc main() {\n\tx := 1\n}",
+			want:    Go,
+		},
+		{
+			name:    "Python",
+			content: "import os\n\ndef main():\n    print(os.getcwd())\n",
+			want:    Python,
+		},
+		{
+			name:    "Shell",
+			content: "#!/bin/bash\necho \"hello\"\n",
+			want:    Shell,
+		},
+		{
+			name:    "SQL",
+			content: "SELECT id, title FROM snippets;\nUPDATE snippets SET title = 'x';",
+			want:    SQL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asserts.Equal(t, Detect(tt.content), tt.want)
+		})
+	}
+}
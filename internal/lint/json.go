@@ -0,0 +1,42 @@
+package lint
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/langdetect"
+	"strings"
+)
+
+// JSON checks that content which looks like JSON (because it starts with a brace or bracket) is valid.
+type JSON struct{}
+
+func (JSON) Name() string {
+	return "json"
+}
+
+func (JSON) Match(language, content string) bool {
+	if language == langdetect.JSON {
+		return true
+	}
+
+	// Detect() only recognizes valid JSON, so also check anything which starts like JSON and isn't obviously something else.
+	trimmed := strings.TrimSpace(content)
+	return language == langdetect.PlainText && (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["))
+}
+
+func (JSON) Lint(content string) []Warning {
+	var v any
+	err := json.Unmarshal([]byte(content), &v)
+	if err == nil {
+		return nil
+	}
+
+	// Syntax errors carry the byte offset of the problem, which we turn into a line number.
+	line := 0
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line = 1 + strings.Count(content[:min(int(syntaxErr.Offset), len(content))], "\n")
+	}
+
+	return []Warning{{Linter: "json", Line: line, Message: "Invalid JSON: " + strings.TrimPrefix(err.Error(), "json: ")}}
+}
@@ -0,0 +1,64 @@
+// Package lint checks snippet content for common mistakes in the formats that we can recognize, like invalid JSON or
+// unquoted variables in shell scripts. The checks only ever produce warnings: a snippet is often a fragment, or
+// deliberately broken, so nothing here should stop it being saved.
+package lint
+
+import (
+	"github.com/0xshiku/snippetbox/internal/langdetect"
+	"sort"
+)
+
+// MaxWarnings limits the number of warnings returned by Runner.Lint(), so that a badly broken snippet doesn't fill the page.
+const MaxWarnings = 20
+
+// Warning describes a problem found by a linter. Line is 1-based, or 0 if the problem isn't on a particular line.
+type Warning struct {
+	Linter  string
+	Line    int
+	Message string
+}
+
+// Linter is implemented by each format-aware check. Match is given the language detected by langdetect.Detect(), as well
+// as the content, so that a linter can also pick up content which is too broken to be detected (like invalid JSON).
+type Linter interface {
+	Name() string
+	Match(language, content string) bool
+	Lint(content string) []Warning
+}
+
+// Runner runs every linter which matches the content. Add more linters with Add().
+type Runner struct {
+	linters []Linter
+}
+
+// New returns a Runner with the built-in JSON, YAML and shell linters.
+func New() *Runner {
+	return &Runner{linters: []Linter{JSON{}, YAML{}, Shell{}}}
+}
+
+// Add registers another linter, which runs after the existing ones.
+func (r *Runner) Add(l Linter) {
+	r.linters = append(r.linters, l)
+}
+
+// Lint returns the warnings from every matching linter, ordered by line.
+func (r *Runner) Lint(content string) []Warning {
+	language := langdetect.Detect(content)
+
+	var warnings []Warning
+	for _, l := range r.linters {
+		if l.Match(language, content) {
+			warnings = append(warnings, l.Lint(content)...)
+		}
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Line < warnings[j].Line
+	})
+
+	if len(warnings) > MaxWarnings {
+		warnings = warnings[:MaxWarnings]
+	}
+
+	return warnings
+}
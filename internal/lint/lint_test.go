@@ -0,0 +1,105 @@
+package lint
+
+import (
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "Valid JSON",
+			content: `{"name": "alice", "tags": ["a", "b"]}`,
+			want:    nil,
+		},
+		{
+			name:    "Invalid JSON",
+			content: "[\n  1,\n  2\n  3\n]",
+			want:    []string{"4: Invalid JSON: invalid character '3' after array element"},
+		},
+		{
+			name:    "Valid YAML",
+			content: "---\nname: alice\nroles:\n  - admin\nprofile:\n  name: 'Alice''s'\n---\nname: bob",
+			want:    nil,
+		},
+		{
+			name:    "Broken YAML",
+			content: "name: alice\nprofile:\n\tage: 30\nname: \"bob\ntags:\n  - a",
+			want: []string{
+				"3: Tabs can't be used for indentation in YAML",
+				"4: Duplicate key name (first used on line 1)",
+				"4: Unterminated quoted value",
+			},
+		},
+		{
+			name:    "Clean shell script",
+			content: "#!/bin/sh\nset -e\ncd /tmp || exit\necho \"$@\"",
+			want:    nil,
+		},
+		{
+			name:    "Shell script",
+			content: "#!/bin/bash\nexport NAME=alice\ncd /tmp\necho `date` $@\nif [ $NAME == alice ]; then echo hi; fi",
+			want: []string{
+				"3: SC2164: Use \"cd ... || exit\" in case cd fails",
+				"4: SC2006: Use $(...) instead of legacy backticks",
+				"4: SC2068: Double quote \"$@\" to avoid re-splitting elements",
+				"5: SC2086: Double quote variables in tests to prevent globbing and word splitting",
+			},
+		},
+		{
+			name:    "Plain text",
+			content: "An old silent pond...",
+			want:    nil,
+		},
+	}
+
+	r := New()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, w := range r.Lint(tt.content) {
+				got = append(got, fmt.Sprintf("%d: %s", w.Line, w.Message))
+			}
+
+			asserts.Equal(t, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		})
+	}
+}
+
+func TestShellShebang(t *testing.T) {
+	// Scripts without a shebang are rarely detected as shell, so check the rule on its own.
+	warnings := Shell{}.Lint("export NAME=alice\necho \"$NAME\"")
+
+	asserts.Equal(t, len(warnings), 1)
+	asserts.Equal(t, warnings[0].Message, "SC2148: Add a shebang like #!/bin/sh so the shell is known")
+}
+
+type countLines struct{}
+
+func (countLines) Name() string                        { return "count" }
+func (countLines) Match(language, content string) bool { return true }
+func (countLines) Lint(content string) []Warning {
+	var warnings []Warning
+	for i := range strings.Count(content, "\n") + 1 {
+		warnings = append(warnings, Warning{Linter: "count", Line: i + 1, Message: "line"})
+	}
+	return warnings
+}
+
+func TestRunnerAdd(t *testing.T) {
+	r := New()
+	r.Add(countLines{})
+
+	warnings := r.Lint(strings.Repeat("x\n", 30))
+
+	// The extra linter runs too, and the warnings are capped.
+	asserts.Equal(t, len(warnings), MaxWarnings)
+	asserts.Equal(t, warnings[0].Linter, "count")
+}
@@ -0,0 +1,56 @@
+package lint
+
+import (
+	"github.com/0xshiku/snippetbox/internal/langdetect"
+	"regexp"
+	"strings"
+)
+
+// A shellRule is a single check in the style of ShellCheck, whose codes are included in the messages so that they can be
+// looked up. Each rule is applied to every line that isn't a comment.
+type shellRule struct {
+	pattern *regexp.Regexp
+	message string
+}
+
+var shellRules = []shellRule{
+	{regexp.MustCompile(`^\s*cd\s+[^|&;]+$`), "SC2164: Use \"cd ... || exit\" in case cd fails"},
+	{regexp.MustCompile("`[^`]*`"), "SC2006: Use $(...) instead of legacy backticks"},
+	{regexp.MustCompile(`(^|[^"])\$@`), "SC2068: Double quote \"$@\" to avoid re-splitting elements"},
+	{regexp.MustCompile(`\[\s+\$\w+\s+(==?|!=)`), "SC2086: Double quote variables in tests to prevent globbing and word splitting"},
+	{regexp.MustCompile(`^\s*rm\s+(-\w+\s+)*"?\$\w+/`), "SC2115: Use \"${var:?}\" to make sure this never expands to /"},
+}
+
+// Shell checks shell scripts for a few common mistakes.
+type Shell struct{}
+
+func (Shell) Name() string {
+	return "shell"
+}
+
+func (Shell) Match(language, _ string) bool {
+	return language == langdetect.Shell
+}
+
+func (Shell) Lint(content string) []Warning {
+	var warnings []Warning
+
+	lines := strings.Split(content, "\n")
+	if !strings.HasPrefix(lines[0], "#!") {
+		warnings = append(warnings, Warning{Linter: "shell", Line: 1, Message: "SC2148: Add a shebang like #!/bin/sh so the shell is known"})
+	}
+
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		for _, rule := range shellRules {
+			if rule.pattern.MatchString(line) {
+				warnings = append(warnings, Warning{Linter: "shell", Line: i + 1, Message: rule.message})
+			}
+		}
+	}
+
+	return warnings
+}
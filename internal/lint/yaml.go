@@ -0,0 +1,100 @@
+package lint
+
+import (
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/langdetect"
+	"regexp"
+	"strings"
+)
+
+// yamlKeyRX matches a mapping key at the start of a line, capturing its indentation and name.
+var yamlKeyRX = regexp.MustCompile(`^( *)([\w.-]+|"[^"]*"|'[^']*'):(\s|$)`)
+
+// YAML checks for the mistakes that most often break YAML files. It isn't a full parser, so it can't say that a file is valid,
+// only that it has one of these problems:
+//   - tabs used for indentation, which YAML doesn't allow
+//   - the same key twice in one mapping
+//   - an unterminated quoted value
+type YAML struct{}
+
+func (YAML) Name() string {
+	return "yaml"
+}
+
+func (YAML) Match(language, _ string) bool {
+	return language == langdetect.YAML
+}
+
+func (YAML) Lint(content string) []Warning {
+	var warnings []Warning
+
+	// keys holds the keys seen so far in each open mapping, by indentation. A key at a lower indentation closes the deeper
+	// mappings, and a "---" line starts a new document.
+	keys := map[int]map[string]int{}
+
+	for i, line := range strings.Split(content, "\n") {
+		n := i + 1
+
+		if strings.TrimSpace(line) == "---" {
+			keys = map[int]map[string]int{}
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if strings.Contains(indent, "\t") {
+			warnings = append(warnings, Warning{Linter: "yaml", Line: n, Message: "Tabs can't be used for indentation in YAML"})
+		}
+
+		m := yamlKeyRX.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		depth, key := len(m[1]), m[2]
+		for d := range keys {
+			if d > depth {
+				delete(keys, d)
+			}
+		}
+		if keys[depth] == nil {
+			keys[depth] = map[string]int{}
+		}
+		if first, seen := keys[depth][key]; seen {
+			warnings = append(warnings, Warning{Linter: "yaml", Line: n, Message: fmt.Sprintf("Duplicate key %s (first used on line %d)", key, first)})
+		} else {
+			keys[depth][key] = n
+		}
+
+		value := strings.TrimSpace(line[len(m[0]):])
+		if unterminatedQuote(value) {
+			warnings = append(warnings, Warning{Linter: "yaml", Line: n, Message: "Unterminated quoted value"})
+		}
+	}
+
+	return warnings
+}
+
+// unterminatedQuote reports whether a single-line value opens a quote which isn't closed. Comments after the value are
+// ignored.
+func unterminatedQuote(value string) bool {
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		return false
+	}
+
+	quote := value[0]
+	for i := 1; i < len(value); i++ {
+		switch {
+		case quote == '"' && value[i] == '\\':
+			i++
+		case value[i] == quote:
+			// In single-quoted values, a doubled quote is an escaped quote.
+			if quote == '\'' && i+1 < len(value) && value[i+1] == '\'' {
+				i++
+				continue
+			}
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,284 @@
+// Package logfile writes logs to a file which is rotated when it gets too big or too old, for servers which don't have
+// journald or logrotate to look after their logs. Old files are renamed with the time they were rotated, optionally
+// compressed with gzip, and deleted once there are more than a set number of them.
+package logfile
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the layout of the time in the names of old files, like app-2024-04-01T12-00-00.000.log. It sorts
+// in the same order as the times, and doesn't use colons, which aren't allowed in file names on Windows.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Options says when a File is rotated, and what happens to the old files.
+type Options struct {
+	// MaxSize is the size in bytes that the file can grow to before it's rotated, or 0 for no limit.
+	MaxSize int64
+	// Interval rotates the file when a new interval starts, so 24h rotates it at midnight UTC. 0 never rotates it by time.
+	Interval time.Duration
+	// MaxBackups is the number of old files to keep, or 0 to keep them all.
+	MaxBackups int
+	// Compress gzips the old files.
+	Compress bool
+	// OnError is called with errors from rotating the file, and from compressing and deleting old files in the
+	// background. It can be called during a Write, so it mustn't write to the File itself.
+	OnError func(error)
+}
+
+// File is an io.WriteCloser which appends to the file at its path, and rotates it according to its Options. Each call
+// to Write goes into a single file, so a logger's lines are never split across two. It is safe for concurrent use.
+type File struct {
+	path string
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time
+
+	// cleanup is held by the goroutine compressing and deleting old files, so that there's only one at a time.
+	cleanup sync.Mutex
+	pending sync.WaitGroup
+}
+
+// Open opens the file at the path for appending, creating it (but not its directory) if it doesn't exist.
+func Open(path string, opts Options) (*File, error) {
+	if opts.MaxSize < 0 || opts.Interval < 0 || opts.MaxBackups < 0 {
+		return nil, errors.New("logfile: options can't be negative")
+	}
+
+	f := &File{path: path, opts: opts, now: time.Now}
+
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// open opens the file, and works out how big and how old it is, so that a file left by the last run is rotated at the
+// right time.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.started = f.now()
+	if f.size > 0 {
+		f.started = info.ModTime()
+	}
+
+	return nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	// A file which can't be rotated is still written to, as losing the log would be worse than a big file.
+	if f.due(int64(len(p))) {
+		err := f.rotate()
+		if err != nil {
+			f.report(err)
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file has to be rotated before n more bytes are written to it. A file which is empty is never
+// rotated, even if a single write is bigger than MaxSize.
+func (f *File) due(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+
+	if f.opts.MaxSize > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+
+	return f.opts.Interval > 0 && !f.now().Truncate(f.opts.Interval).Equal(f.started.Truncate(f.opts.Interval))
+}
+
+// Rotate starts a new file straight away, whatever the options say.
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+
+	return f.rotate()
+}
+
+func (f *File) rotate() error {
+	err := f.file.Close()
+	if err != nil {
+		return err
+	}
+	f.file = nil
+
+	backup := f.backupName(f.now())
+	err = os.Rename(f.path, backup)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Join(err, f.open())
+	}
+
+	err = f.open()
+	if err != nil {
+		return err
+	}
+
+	f.pending.Add(1)
+	go func() {
+		defer f.pending.Done()
+
+		f.cleanup.Lock()
+		defer f.cleanup.Unlock()
+
+		if f.opts.Compress {
+			f.report(compress(backup))
+		}
+		f.report(f.prune())
+	}()
+
+	return nil
+}
+
+// backupName returns the name an old file is renamed to, with the time before its extension.
+func (f *File) backupName(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-" + t.UTC().Format(backupTimeFormat) + ext
+}
+
+// backups returns the names of the old files, oldest first.
+func (f *File) backups() ([]string, error) {
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		stamp, ok := strings.CutSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		if _, err := time.Parse(backupTimeFormat, stamp); !ok || err != nil {
+			continue
+		}
+
+		names = append(names, filepath.Join(filepath.Dir(f.path), entry.Name()))
+	}
+
+	// The names only differ in their times (and .gz), which sort in the same order as the times themselves.
+	slices.Sort(names)
+	return names, nil
+}
+
+// prune deletes the oldest files beyond MaxBackups.
+func (f *File) prune() error {
+	if f.opts.MaxBackups == 0 {
+		return nil
+	}
+
+	names, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for len(names) > f.opts.MaxBackups {
+		errs = append(errs, os.Remove(names[0]))
+		names = names[1:]
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f *File) report(err error) {
+	if err != nil && f.opts.OnError != nil {
+		f.opts.OnError(err)
+	}
+}
+
+// compress gzips the file at the path into path.gz, and removes the original once it has been written.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	src.Close()
+	return os.Remove(path)
+}
+
+// Close closes the file, after waiting for any old files to be compressed.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	f.pending.Wait()
+	return err
+}
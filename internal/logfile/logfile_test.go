@@ -0,0 +1,134 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clock returns a now function which moves on by a second each time it's called, so that every rotation gets a new name.
+func clock(start time.Time) func() time.Time {
+	return func() time.Time {
+		start = start.Add(time.Second)
+		return start
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	asserts.NilError(t, err)
+	return string(b)
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	f, err := Open(path, Options{MaxSize: 10, MaxBackups: 2})
+	asserts.NilError(t, err)
+	f.now = clock(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+		_, err := f.Write([]byte(line))
+		asserts.NilError(t, err)
+	}
+	asserts.NilError(t, f.Close())
+
+	asserts.Equal(t, readFile(t, path), "six\n")
+
+	// Four files were rotated, and only the newest two are kept.
+	backups, err := f.backups()
+	asserts.NilError(t, err)
+	asserts.Equal(t, len(backups), 2)
+	asserts.Equal(t, readFile(t, backups[0]), "three\n")
+	asserts.Equal(t, readFile(t, backups[1]), "four\nfive\n")
+	if name := filepath.Base(backups[1]); !strings.HasPrefix(name, "app-2024-04-01T12-00-") || !strings.HasSuffix(name, ".000.log") {
+		t.Errorf("got backup %q; want it named after the time it was rotated", name)
+	}
+}
+
+func TestRotateByInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	// A file left by the last run is rotated when the next day starts, going by when it was last written to.
+	err := os.WriteFile(path, []byte("yesterday\n"), 0o640)
+	asserts.NilError(t, err)
+	yesterday := time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC)
+	asserts.NilError(t, os.Chtimes(path, yesterday, yesterday))
+
+	f, err := Open(path, Options{Interval: 24 * time.Hour})
+	asserts.NilError(t, err)
+
+	now := time.Date(2024, 4, 1, 0, 30, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	f.Write([]byte("today\n"))
+	f.Write([]byte("still today\n"))
+
+	now = now.Add(24 * time.Hour)
+	f.Write([]byte("tomorrow\n"))
+	asserts.NilError(t, f.Close())
+
+	backups, err := f.backups()
+	asserts.NilError(t, err)
+	asserts.Equal(t, len(backups), 2)
+	asserts.Equal(t, readFile(t, backups[0]), "yesterday\n")
+	asserts.Equal(t, readFile(t, backups[1]), "today\nstill today\n")
+	asserts.Equal(t, readFile(t, path), "tomorrow\n")
+}
+
+func TestCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	var errs []error
+	f, err := Open(path, Options{Compress: true, OnError: func(err error) { errs = append(errs, err) }})
+	asserts.NilError(t, err)
+
+	f.Write([]byte(strings.Repeat("compress me\n", 100)))
+	asserts.NilError(t, f.Rotate())
+	f.Write([]byte("new\n"))
+	asserts.NilError(t, f.Close())
+	asserts.Equal(t, len(errs), 0)
+
+	backups, err := f.backups()
+	asserts.NilError(t, err)
+	asserts.Equal(t, len(backups), 1)
+	if !strings.HasSuffix(backups[0], ".log.gz") {
+		t.Fatalf("got backup %q; want a .gz file", backups[0])
+	}
+
+	gz, err := os.Open(backups[0])
+	asserts.NilError(t, err)
+	defer gz.Close()
+
+	zr, err := gzip.NewReader(gz)
+	asserts.NilError(t, err)
+	b, err := io.ReadAll(zr)
+	asserts.NilError(t, err)
+	asserts.Equal(t, string(b), strings.Repeat("compress me\n", 100))
+}
+
+func TestBackupsIgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"app.log", "app-2024-04-01T12-00-00.000.log", "app-2024-04-02T12-00-00.000.log.gz", "app-old.log", "application.log", "error-2024-04-01T12-00-00.000.log"} {
+		asserts.NilError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o640))
+	}
+
+	f := &File{path: filepath.Join(dir, "app.log")}
+	backups, err := f.backups()
+	asserts.NilError(t, err)
+
+	asserts.Equal(t, len(backups), 2)
+	asserts.Equal(t, filepath.Base(backups[0]), "app-2024-04-01T12-00-00.000.log")
+	asserts.Equal(t, filepath.Base(backups[1]), "app-2024-04-02T12-00-00.000.log.gz")
+}
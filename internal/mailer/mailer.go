@@ -0,0 +1,167 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	ttemplate "text/template"
+	"time"
+)
+
+// Declare a new variable with the type embed.FS (embedded file system) to hold our email templates.
+// This has a comment directive in the format `//go:embed <path>` IMMEDIATELY ABOVE it,
+// which indicates to Go that we want to store the contents of the ./templates directory in the templateFS embedded file system variable.
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+type MailerInterface interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// Define a Mailer struct which contains the address of the SMTP server, the authentication details (if any)
+// and the sender information for your emails (the name and address you want the email to be from, such as "Alice Smith <alice@example.com>").
+type Mailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+func New(host string, port int, username, password, sender string) *Mailer {
+	m := &Mailer{
+		addr:   fmt.Sprintf("%s:%d", host, port),
+		sender: sender,
+	}
+
+	// Only use authentication if a username has been provided. This means that a local development SMTP server
+	// (like MailHog or Mailpit) works without any credentials.
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m
+}
+
+// Send takes the recipient email address, the name of the file containing the templates, and any dynamic data for the templates.
+// Each template file must define a "subject", "plainBody" and "htmlBody" template. It can also define an "unsubscribe"
+// template, holding a URL which turns the emails off, for the one-click unsubscribe headers (RFC 8058).
+func (m *Mailer) Send(recipient, templateFile string, data any) error {
+	// Use the ParseFS() method from text/template to parse the required template file from the embedded file system.
+	// We use text/template for the subject and plain-text body, because they must not be HTML escaped.
+	tmpl, err := ttemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return err
+	}
+
+	unsubscribe := new(bytes.Buffer)
+	if tmpl.Lookup("unsubscribe") != nil {
+		err = tmpl.ExecuteTemplate(unsubscribe, "unsubscribe", data)
+		if err != nil {
+			return err
+		}
+	}
+
+	// And use html/template for the HTML body, so that any dynamic data is escaped correctly.
+	htmlTmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return err
+	}
+
+	msg, err := m.buildMessage(recipient, subject.String(), strings.TrimSpace(unsubscribe.String()), plainBody.Bytes(), htmlBody.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// Try sending the email up to three times before aborting and returning the final error.
+	// We sleep for 500 milliseconds between each attempt.
+	for i := 1; i <= 3; i++ {
+		err = smtp.SendMail(m.addr, m.auth, m.sender, []string{recipient}, msg)
+		// If everything worked, return nil.
+		if err == nil {
+			return nil
+		}
+
+		// If it didn't work, sleep for a short time and retry.
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return err
+}
+
+// buildMessage assembles a multipart/alternative MIME message containing both the plain-text and HTML bodies. If there's
+// an unsubscribe URL, the headers tell mail clients that they can offer an unsubscribe button which POSTs to it.
+func (m *Mailer) buildMessage(recipient, subject, unsubscribeURL string, plainBody, htmlBody []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	fmt.Fprintf(buf, "From: %s\r\n", m.sender)
+	fmt.Fprintf(buf, "To: %s\r\n", recipient)
+	fmt.Fprintf(buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	if unsubscribeURL != "" {
+		fmt.Fprintf(buf, "List-Unsubscribe: <%s>\r\n", unsubscribeURL)
+		fmt.Fprintf(buf, "List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+	}
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=utf-8", plainBody},
+		{"text/html; charset=utf-8", htmlBody},
+	}
+
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write(p.body)
+		if err != nil {
+			return nil, err
+		}
+
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
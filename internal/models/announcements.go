@@ -0,0 +1,111 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// The severities of an announcement, which decide how it's styled. They're offered to admins in this order.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// Announcement is a message which admins publish at the top of every page. Expires is the zero time for an announcement
+// that stays up until it's replaced or withdrawn.
+type Announcement struct {
+	ID       int
+	Text     string
+	Severity string
+	Created  time.Time
+	Expires  time.Time
+}
+
+// Expired reports whether the announcement's expiry time has passed.
+func (a *Announcement) Expired(now time.Time) bool {
+	return !a.Expires.IsZero() && !now.Before(a.Expires)
+}
+
+type AnnouncementModelInterface interface {
+	Insert(text, severity string, expires time.Time, userID int) (int, error)
+	Current() (*Announcement, error)
+	Withdraw() error
+}
+
+// AnnouncementModel wraps a database connection pool and is used to manage the announcements table.
+type AnnouncementModel struct {
+	DB DBTX
+}
+
+// Insert publishes an announcement, in place of the current one (if there is one), and returns its ID. Pass the zero
+// time for an announcement which doesn't expire.
+func (m *AnnouncementModel) Insert(text, severity string, expires time.Time, userID int) (int, error) {
+	var nullExpires sql.NullTime
+	if !expires.IsZero() {
+		nullExpires = sql.NullTime{Time: expires.UTC(), Valid: true}
+	}
+
+	return retryValue(m.DB, func() (int, error) {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+
+		err = withdrawAnnouncements(tx)
+		if err != nil {
+			return 0, err
+		}
+
+		stmt := `INSERT INTO announcements (text, severity, created, expires, created_by)
+    VALUES (?, ?, UTC_TIMESTAMP(), ?, ?)`
+
+		result, err := tx.Exec(stmt, text, severity, nullExpires, userID)
+		if err != nil {
+			return 0, err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+
+		return int(id), tx.Commit()
+	})
+}
+
+// Current returns the announcement which is up at the moment. If there isn't one, it returns ErrNoRecord.
+func (m *AnnouncementModel) Current() (*Announcement, error) {
+	var a Announcement
+	var expires sql.NullTime
+
+	stmt := `SELECT id, text, severity, created, expires FROM announcements
+    WHERE expires IS NULL OR expires > UTC_TIMESTAMP()
+    ORDER BY id DESC LIMIT 1`
+
+	err := m.DB.QueryRow(stmt).Scan(&a.ID, &a.Text, &a.Severity, &a.Created, &expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	a.Expires = expires.Time
+
+	return &a, nil
+}
+
+// Withdraw takes down the current announcement, by expiring it now. Withdrawing when there isn't one does nothing.
+func (m *AnnouncementModel) Withdraw() error {
+	return withdrawAnnouncements(m.DB)
+}
+
+func withdrawAnnouncements(db DBTX) error {
+	_, err := db.Exec(`UPDATE announcements SET expires = UTC_TIMESTAMP() WHERE expires IS NULL OR expires > UTC_TIMESTAMP()`)
+	return err
+}
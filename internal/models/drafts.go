@@ -0,0 +1,131 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/ids"
+	"time"
+)
+
+type SharedDraftModelInterface interface {
+	Insert(userID int, title string) (string, error)
+	Get(publicID string) (*SharedDraft, error)
+	AllForUser(userID int) ([]*SharedDraft, error)
+	Save(publicID, content string, revision int) error
+	Delete(publicID string, userID int) error
+}
+
+// SharedDraft is a draft which any logged-in user with its link can edit, until its owner publishes it as a snippet.
+// Revision counts the changes which have been made to it.
+type SharedDraft struct {
+	ID       int
+	PublicID string
+	UserID   int
+	Title    string
+	Content  string
+	Revision int
+	Created  time.Time
+	Updated  time.Time
+}
+
+// SharedDraftModel wraps a database connection pool and is used to manage the shared_drafts table.
+type SharedDraftModel struct {
+	DB DBTX
+}
+
+// Insert adds an empty draft owned by the user, and returns its public ID. The IDs are always ULIDs, because they're
+// all that stops other people from finding the draft.
+func (m *SharedDraftModel) Insert(userID int, title string) (string, error) {
+	publicID, err := ids.ULID{}.New()
+	if err != nil {
+		return "", err
+	}
+
+	stmt := `INSERT INTO shared_drafts (public_id, user_id, title, content, created, updated)
+	VALUES (?, ?, ?, '', UTC_TIMESTAMP(), UTC_TIMESTAMP())`
+
+	_, err = m.DB.Exec(stmt, publicID, userID, title)
+	if err != nil {
+		return "", err
+	}
+
+	return publicID, nil
+}
+
+// Get returns a draft by its public ID.
+func (m *SharedDraftModel) Get(publicID string) (*SharedDraft, error) {
+	stmt := `SELECT id, public_id, user_id, title, content, revision, created, updated FROM shared_drafts WHERE public_id = ?`
+
+	d := &SharedDraft{}
+
+	err := m.DB.QueryRow(stmt, publicID).Scan(&d.ID, &d.PublicID, &d.UserID, &d.Title, &d.Content, &d.Revision, &d.Created, &d.Updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("shared draft %q: %w", publicID, ErrNoRecord)
+		}
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// AllForUser returns the drafts the user owns, most recently changed first. The content is left out, because it isn't
+// needed for a list.
+func (m *SharedDraftModel) AllForUser(userID int) ([]*SharedDraft, error) {
+	stmt := `SELECT id, public_id, user_id, title, revision, created, updated FROM shared_drafts
+	WHERE user_id = ? ORDER BY updated DESC, id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drafts := []*SharedDraft{}
+
+	for rows.Next() {
+		d := &SharedDraft{}
+
+		err = rows.Scan(&d.ID, &d.PublicID, &d.UserID, &d.Title, &d.Revision, &d.Created, &d.Updated)
+		if err != nil {
+			return nil, err
+		}
+
+		drafts = append(drafts, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return drafts, nil
+}
+
+// Save stores the content of a draft as it was at a revision. It does nothing if a later revision has already been
+// saved, or the draft has been deleted.
+func (m *SharedDraftModel) Save(publicID, content string, revision int) error {
+	stmt := `UPDATE shared_drafts SET content = ?, revision = ?, updated = UTC_TIMESTAMP() WHERE public_id = ? AND revision < ?`
+
+	_, err := m.DB.Exec(stmt, content, revision, publicID, revision)
+	return err
+}
+
+// Delete removes one of the user's drafts.
+func (m *SharedDraftModel) Delete(publicID string, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM shared_drafts WHERE public_id = ? AND user_id = ?`, publicID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
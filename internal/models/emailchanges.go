@@ -0,0 +1,94 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+)
+
+type EmailChangeModelInterface interface {
+	Insert(userID int, newEmail string, ttl time.Duration) (string, error)
+	Get(token string) (*EmailChange, error)
+	DeleteAllForUser(userID int) error
+}
+
+// EmailChange holds the details of a pending (unconfirmed) change of email address.
+type EmailChange struct {
+	UserID   int
+	NewEmail string
+	Expiry   time.Time
+}
+
+// EmailChangeModel wraps a database connection pool and is used to manage the email_changes table.
+type EmailChangeModel struct {
+	DB DBTX
+}
+
+// Insert records a pending email change for the user and returns the plaintext confirmation token.
+// Only the SHA-256 hash of the token is stored in the database, so a leaked database dump can't be used to confirm changes.
+// Any earlier pending changes for the same user are removed, so that only the most recent link works.
+func (m *EmailChangeModel) Insert(userID int, newEmail string, ttl time.Duration) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = m.DeleteAllForUser(userID)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(token))
+
+	stmt := `INSERT INTO email_changes (token_hash, user_id, new_email, expiry) VALUES (?, ?, ?, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND))`
+
+	_, err = m.DB.Exec(stmt, hash[:], userID, newEmail, int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Get returns the pending email change for the given plaintext token, as long as it hasn't expired yet.
+func (m *EmailChangeModel) Get(token string) (*EmailChange, error) {
+	hash := sha256.Sum256([]byte(token))
+
+	stmt := `SELECT user_id, new_email, expiry FROM email_changes WHERE token_hash = ? AND expiry > UTC_TIMESTAMP()`
+
+	c := &EmailChange{}
+
+	err := m.DB.QueryRow(stmt, hash[:]).Scan(&c.UserID, &c.NewEmail, &c.Expiry)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// DeleteAllForUser removes every pending email change for a specific user.
+func (m *EmailChangeModel) DeleteAllForUser(userID int) error {
+	stmt := `DELETE FROM email_changes WHERE user_id = ?`
+
+	_, err := m.DB.Exec(stmt, userID)
+	return err
+}
+
+// generateToken returns a random, URL-safe token containing 128 bits of entropy.
+func generateToken() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
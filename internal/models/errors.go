@@ -1,11 +1,110 @@
 package models
 
-import "errors"
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Kind is the category of a model error. Handlers and the API use it to choose a response status code,
+// rather than checking for each error value in turn.
+type Kind int
+
+const (
+	// KindInternal is any error that doesn't fit one of the other kinds, like a bad query. It's the zero value.
+	KindInternal Kind = iota
+	// KindNotFound means that the record doesn't exist (or has expired).
+	KindNotFound
+	// KindConflict means that the change would break a uniqueness rule, like two users with the same email address.
+	KindConflict
+	// KindInvalid means that the input was rejected, like a wrong password.
+	KindInvalid
+	// KindUnavailable means that the database couldn't be reached. Trying again later might work.
+	KindUnavailable
+	// KindForbidden means that the user isn't allowed to do that, like logging in to a suspended account.
+	KindForbidden
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not found"
+	case KindConflict:
+		return "conflict"
+	case KindInvalid:
+		return "invalid"
+	case KindUnavailable:
+		return "unavailable"
+	case KindForbidden:
+		return "forbidden"
+	default:
+		return "internal"
+	}
+}
+
+// Error is the type of the errors returned by the models. As well as its Kind, it records the field it relates to
+// (for conflicts and invalid input) and the underlying error, if there is one.
+type Error struct {
+	Kind    Kind
+	Field   string
+	Message string
+	Err     error
+}
 
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("models: %s: %s", e.Message, e.Err)
+	}
+	return "models: " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// The error values below are the ones returned by the models. Check for them with errors.Is, or use KindOf to
+// find out which kind of error it is.
 var (
-	ErrNoRecord = errors.New("models: no matching record found")
+	ErrNoRecord = &Error{Kind: KindNotFound, Message: "no matching record found"}
 	// ErrInvalidCredentials Add a new ErrInvalidCredentials error. We'll use this later if a user tries to login with an incorrect email address or password
-	ErrInvalidCredentials = errors.New("models: invalid credentials")
+	ErrInvalidCredentials = &Error{Kind: KindInvalid, Field: "credentials", Message: "invalid credentials"}
 	// ErrDuplicateEmail Add new ErrDuplicateEmail error. We'll use this later if a user tries to signup with an email address that's already in use
-	ErrDuplicateEmail = errors.New("models: duplicate email")
+	ErrDuplicateEmail = &Error{Kind: KindConflict, Field: "email", Message: "duplicate email"}
+	// ErrDuplicateUsername is returned if a user tries to signup with (or change to) a username that's already taken
+	ErrDuplicateUsername = &Error{Kind: KindConflict, Field: "username", Message: "duplicate username"}
+	// ErrDuplicateRemoteName is returned if a user tries to add two remote instances with the same name
+	ErrDuplicateRemoteName = &Error{Kind: KindConflict, Field: "name", Message: "duplicate remote name"}
+	// ErrDuplicateWebhook is returned if a user tries to add the same webhook URL twice
+	ErrDuplicateWebhook = &Error{Kind: KindConflict, Field: "url", Message: "duplicate webhook URL"}
+	// ErrEditConflict is returned if a record was changed by somebody else since the version that the change was based on
+	ErrEditConflict = &Error{Kind: KindConflict, Field: "version", Message: "edit conflict"}
+	// ErrAccountSuspended is returned if a user whose account has been suspended tries to log in with the right password
+	ErrAccountSuspended = &Error{Kind: KindForbidden, Field: "credentials", Message: "account suspended"}
+	// ErrAccountBanned is returned if a user whose account has been banned tries to log in with the right password
+	ErrAccountBanned = &Error{Kind: KindForbidden, Field: "credentials", Message: "account banned"}
+	// ErrInvalidReaction is returned if a reaction isn't one of the Reactions
+	ErrInvalidReaction = &Error{Kind: KindInvalid, Field: "reaction", Message: "invalid reaction"}
+	// ErrInvalidStatus is returned if an account is given a status that isn't one of the UserStatus constants
+	ErrInvalidStatus = &Error{Kind: KindInvalid, Field: "status", Message: "invalid account status"}
+	// ErrInvalidSort is returned if a list of snippets is asked to be sorted in a way that isn't one of the SnippetSorts
+	ErrInvalidSort = &Error{Kind: KindInvalid, Field: "sort", Message: "invalid sort"}
 )
+
+// KindOf returns the kind of err. Errors that didn't come from the models are KindInternal, except for ones which
+// show that the database connection failed, which are KindUnavailable.
+func KindOf(err error) Kind {
+	var modelErr *Error
+	if errors.As(err, &modelErr) {
+		return modelErr.Kind
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return KindUnavailable
+	}
+
+	return KindInternal
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{
+			name: "No record",
+			err:  ErrNoRecord,
+			want: KindNotFound,
+		},
+		{
+			name: "Wrapped no record",
+			err:  fmt.Errorf("snippet %d: %w", 1, ErrNoRecord),
+			want: KindNotFound,
+		},
+		{
+			name: "Duplicate email",
+			err:  ErrDuplicateEmail,
+			want: KindConflict,
+		},
+		{
+			name: "Invalid credentials",
+			err:  ErrInvalidCredentials,
+			want: KindInvalid,
+		},
+		{
+			name: "Bad connection",
+			err:  fmt.Errorf("query: %w", driver.ErrBadConn),
+			want: KindUnavailable,
+		},
+		{
+			name: "Other error",
+			err:  errors.New("syntax error"),
+			want: KindInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asserts.Equal(t, KindOf(tt.err), tt.want)
+		})
+	}
+}
+
+func TestErrorContext(t *testing.T) {
+	err := fmt.Errorf("user %d: %w", 7, ErrNoRecord)
+
+	// The context is added to the message, and the error still matches the error value.
+	asserts.Equal(t, err.Error(), "user 7: models: no matching record found")
+	asserts.Equal(t, errors.Is(err, ErrNoRecord), true)
+	asserts.Equal(t, errors.Is(err, ErrDuplicateEmail), false)
+
+	var modelErr *Error
+	asserts.Equal(t, errors.As(ErrDuplicateUsername, &modelErr), true)
+	asserts.Equal(t, modelErr.Field, "username")
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type DataExportModelInterface interface {
+	Insert(userID int, archive []byte, ttl time.Duration) (string, error)
+	Get(userID int, token string) (*DataExport, error)
+}
+
+// DataExport is a finished archive of the data held about a user, waiting to be downloaded.
+type DataExport struct {
+	UserID  int
+	Archive []byte
+	Created time.Time
+	Expiry  time.Time
+}
+
+// DataExportModel wraps a database connection pool and is used to manage the data_exports table.
+type DataExportModel struct {
+	DB DBTX
+}
+
+// Insert stores a finished export for the user and returns the plaintext token for its download link. As with email changes,
+// only a hash of the token is stored. Any earlier exports for the same user (and any expired ones for anybody) are removed,
+// so that the table doesn't fill up with archives that nobody will download.
+func (m *DataExportModel) Insert(userID int, archive []byte, ttl time.Duration) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = m.DB.Exec(`DELETE FROM data_exports WHERE user_id = ? OR expiry <= UTC_TIMESTAMP()`, userID)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(token))
+
+	stmt := `INSERT INTO data_exports (token_hash, user_id, archive, created, expiry) VALUES (?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND))`
+
+	_, err = m.DB.Exec(stmt, hash[:], userID, archive, int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Get returns the unexpired export with the given plaintext token. It has to belong to the given user, so that a forwarded
+// (or leaked) link can't be used by anybody else.
+func (m *DataExportModel) Get(userID int, token string) (*DataExport, error) {
+	hash := sha256.Sum256([]byte(token))
+
+	stmt := `SELECT user_id, archive, created, expiry FROM data_exports WHERE token_hash = ? AND user_id = ? AND expiry > UTC_TIMESTAMP()`
+
+	e := &DataExport{}
+
+	err := m.DB.QueryRow(stmt, hash[:], userID).Scan(&e.UserID, &e.Archive, &e.Created, &e.Expiry)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
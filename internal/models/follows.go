@@ -0,0 +1,88 @@
+package models
+
+type FollowModelInterface interface {
+	Follow(followerID, followedID int) error
+	Unfollow(followerID, followedID int) error
+	IsFollowing(followerID, followedID int) (bool, error)
+	Counts(userID int) (followers, following int, err error)
+	Feed(userID, limit, offset int) ([]*FeedEntry, error)
+}
+
+// FeedEntry is a snippet in a user's activity feed, along with the name of the user who wrote it. AuthorUsername is
+// always set, because users can only be followed from their profile page, which needs a username.
+type FeedEntry struct {
+	Snippet
+	AuthorName     string
+	AuthorUsername string
+}
+
+// FollowModel wraps a database connection pool and is used to manage the follows table.
+type FollowModel struct {
+	DB DBTX
+}
+
+// Follow makes one user follow another. Following somebody twice does nothing.
+func (m *FollowModel) Follow(followerID, followedID int) error {
+	_, err := m.DB.Exec(`INSERT IGNORE INTO follows (follower_id, followed_id, created) VALUES (?, ?, UTC_TIMESTAMP())`,
+		followerID, followedID)
+	return err
+}
+
+// Unfollow stops one user following another. Unfollowing somebody who isn't followed does nothing.
+func (m *FollowModel) Unfollow(followerID, followedID int) error {
+	_, err := m.DB.Exec(`DELETE FROM follows WHERE follower_id = ? AND followed_id = ?`, followerID, followedID)
+	return err
+}
+
+// IsFollowing reports whether one user follows another.
+func (m *FollowModel) IsFollowing(followerID, followedID int) (bool, error) {
+	var exists bool
+	err := m.DB.QueryRow(`SELECT EXISTS(SELECT true FROM follows WHERE follower_id = ? AND followed_id = ?)`,
+		followerID, followedID).Scan(&exists)
+	return exists, err
+}
+
+// Counts returns how many followers a user has, and how many users they follow.
+func (m *FollowModel) Counts(userID int) (followers, following int, err error) {
+	stmt := `SELECT (SELECT COUNT(*) FROM follows WHERE followed_id = ?), (SELECT COUNT(*) FROM follows WHERE follower_id = ?)`
+
+	err = m.DB.QueryRow(stmt, userID, userID).Scan(&followers, &following)
+	return followers, following, err
+}
+
+// Feed returns the latest public snippets from the users that the user follows, newest first. It starts from the
+// follows table, so each followed user's snippets are found through idx_snippets_user_created rather than by scanning
+// every snippet.
+func (m *FollowModel) Feed(userID, limit, offset int) ([]*FeedEntry, error) {
+	stmt := `SELECT s.id, s.public_id, s.user_id, s.title, s.content, s.created, s.expires, s.visibility, u.name, COALESCE(u.username, '')
+    FROM follows f
+    JOIN snippets s ON s.user_id = f.followed_id
+    JOIN users u ON u.id = f.followed_id
+    WHERE f.follower_id = ? AND s.expires > UTC_TIMESTAMP() AND s.deleted_at IS NULL AND s.visibility = 'public'
+    ORDER BY s.created DESC, s.id DESC
+    LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*FeedEntry{}
+
+	for rows.Next() {
+		e := &FeedEntry{}
+
+		err = rows.Scan(&e.ID, &e.PublicID, &e.UserID, &e.Title, &e.Content, &e.Created, &e.Expires, &e.Visibility, &e.AuthorName, &e.AuthorUsername)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+type ImpersonationModelInterface interface {
+	Start(adminID, userID int) (int, error)
+	Stop(id int) error
+}
+
+// Impersonation records an admin logging in as another user. Stopped is the zero time until they stop.
+type Impersonation struct {
+	ID      int
+	AdminID int
+	UserID  int
+	Started time.Time
+	Stopped time.Time
+}
+
+// ImpersonationModel wraps a database connection pool and is used to manage the impersonations table, which is the
+// audit trail of admins logging in as other users.
+type ImpersonationModel struct {
+	DB DBTX
+}
+
+// Start records that the admin has started impersonating the user, and returns the record's ID for Stop.
+func (m *ImpersonationModel) Start(adminID, userID int) (int, error) {
+	stmt := `INSERT INTO impersonations (admin_id, user_id, started)
+    VALUES (?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, adminID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Stop records that the impersonation has ended. The first stop time is kept, so stopping it again does nothing.
+func (m *ImpersonationModel) Stop(id int) error {
+	_, err := m.DB.Exec(`UPDATE impersonations SET stopped = UTC_TIMESTAMP() WHERE id = ? AND stopped IS NULL`, id)
+	return err
+}
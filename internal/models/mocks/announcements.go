@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"sync"
+	"time"
+)
+
+// AnnouncementModel starts without an announcement, and keeps the ones it's asked to publish, so tests can check that
+// they're shown.
+type AnnouncementModel struct {
+	mu      sync.Mutex
+	current *models.Announcement
+	lastID  int
+}
+
+func (m *AnnouncementModel) Insert(text, severity string, expires time.Time, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	m.current = &models.Announcement{ID: m.lastID, Text: text, Severity: severity, Created: time.Now(), Expires: expires}
+	return m.lastID, nil
+}
+
+func (m *AnnouncementModel) Current() (*models.Announcement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.current == nil || m.current.Expired(time.Now()) {
+		return nil, models.ErrNoRecord
+	}
+
+	a := *m.current
+	return &a, nil
+}
+
+func (m *AnnouncementModel) Withdraw() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.current = nil
+	return nil
+}
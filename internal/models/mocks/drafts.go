@@ -0,0 +1,75 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"sync"
+	"time"
+)
+
+var mockSharedDraft = &models.SharedDraft{
+	ID:       1,
+	PublicID: "01HV5Q2X8N3K7M4R6T9W0Y1Z3B",
+	UserID:   1,
+	Title:    "Shared notes",
+	Content:  "Hello",
+	Revision: 3,
+	Created:  time.Now(),
+	Updated:  time.Now(),
+}
+
+// SharedDraftModel gives alice (user 1) one draft. It remembers what it's asked to save, so tests can check it. Drafts
+// are saved from the editing sessions' goroutines, so it's safe for concurrent use.
+type SharedDraftModel struct {
+	mu    sync.Mutex
+	saved map[string]string
+}
+
+func (m *SharedDraftModel) Insert(userID int, title string) (string, error) {
+	return "01HV5Q2X8N3K7M4R6T9W0Y1Z4C", nil
+}
+
+func (m *SharedDraftModel) Get(publicID string) (*models.SharedDraft, error) {
+	if publicID != mockSharedDraft.PublicID {
+		return nil, models.ErrNoRecord
+	}
+
+	d := *mockSharedDraft
+	return &d, nil
+}
+
+func (m *SharedDraftModel) AllForUser(userID int) ([]*models.SharedDraft, error) {
+	if userID != mockSharedDraft.UserID {
+		return []*models.SharedDraft{}, nil
+	}
+
+	return []*models.SharedDraft{mockSharedDraft}, nil
+}
+
+func (m *SharedDraftModel) Save(publicID, content string, revision int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.saved == nil {
+		m.saved = map[string]string{}
+	}
+	m.saved[publicID] = content
+
+	return nil
+}
+
+func (m *SharedDraftModel) Delete(publicID string, userID int) error {
+	if publicID != mockSharedDraft.PublicID || userID != mockSharedDraft.UserID {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// Saved returns the content which was last saved for a draft, and whether any was.
+func (m *SharedDraftModel) Saved(publicID string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	content, ok := m.saved[publicID]
+	return content, ok
+}
@@ -0,0 +1,27 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"time"
+)
+
+type EmailChangeModel struct{}
+
+func (m *EmailChangeModel) Insert(userID int, newEmail string, ttl time.Duration) (string, error) {
+	return "VALIDTOKEN", nil
+}
+
+func (m *EmailChangeModel) Get(token string) (*models.EmailChange, error) {
+	switch token {
+	case "VALIDTOKEN":
+		return &models.EmailChange{UserID: 1, NewEmail: "alice.new@example.com", Expiry: time.Now().Add(time.Hour)}, nil
+	case "DUPTOKEN":
+		return &models.EmailChange{UserID: 1, NewEmail: "dup@example.com", Expiry: time.Now().Add(time.Hour)}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *EmailChangeModel) DeleteAllForUser(userID int) error {
+	return nil
+}
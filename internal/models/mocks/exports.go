@@ -0,0 +1,28 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"time"
+)
+
+// MockExportToken is the download token for alice's (user 1) finished data export.
+const MockExportToken = "EXPORTTOKEN"
+
+type DataExportModel struct{}
+
+func (m *DataExportModel) Insert(userID int, archive []byte, ttl time.Duration) (string, error) {
+	return MockExportToken, nil
+}
+
+func (m *DataExportModel) Get(userID int, token string) (*models.DataExport, error) {
+	if userID != 1 || token != MockExportToken {
+		return nil, models.ErrNoRecord
+	}
+
+	return &models.DataExport{
+		UserID:  1,
+		Archive: []byte("PK mock archive"),
+		Created: time.Now(),
+		Expiry:  time.Now().Add(time.Hour),
+	}, nil
+}
@@ -0,0 +1,40 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+)
+
+// FollowModel says that carol (user 2) follows alice (user 1), so carol's feed has alice's public snippet in it. Nobody
+// else follows anybody.
+type FollowModel struct{}
+
+func (m *FollowModel) Follow(followerID, followedID int) error {
+	return nil
+}
+
+func (m *FollowModel) Unfollow(followerID, followedID int) error {
+	return nil
+}
+
+func (m *FollowModel) IsFollowing(followerID, followedID int) (bool, error) {
+	return followerID == mockAdmin.ID && followedID == mockUser.ID, nil
+}
+
+func (m *FollowModel) Counts(userID int) (int, int, error) {
+	switch userID {
+	case mockUser.ID:
+		return 1, 0, nil
+	case mockAdmin.ID:
+		return 0, 1, nil
+	default:
+		return 0, 0, nil
+	}
+}
+
+func (m *FollowModel) Feed(userID, limit, offset int) ([]*models.FeedEntry, error) {
+	if userID != mockAdmin.ID || offset > 0 {
+		return []*models.FeedEntry{}, nil
+	}
+
+	return []*models.FeedEntry{{Snippet: *mockSnippet, AuthorName: mockUser.Name, AuthorUsername: mockUser.Username}}, nil
+}
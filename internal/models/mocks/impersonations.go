@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"sync"
+	"time"
+)
+
+// ImpersonationModel keeps the records it's given, so tests can check that impersonations are started and stopped.
+type ImpersonationModel struct {
+	mu      sync.Mutex
+	records []*models.Impersonation
+}
+
+func (m *ImpersonationModel) Start(adminID, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records = append(m.records, &models.Impersonation{
+		ID:      len(m.records) + 1,
+		AdminID: adminID,
+		UserID:  userID,
+		Started: time.Now(),
+	})
+	return len(m.records), nil
+}
+
+func (m *ImpersonationModel) Stop(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.records) {
+		return models.ErrNoRecord
+	}
+
+	if r := m.records[id-1]; r.Stopped.IsZero() {
+		r.Stopped = time.Now()
+	}
+	return nil
+}
+
+// Records returns copies of the impersonations recorded so far.
+func (m *ImpersonationModel) Records() []models.Impersonation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := make([]models.Impersonation, len(m.records))
+	for i, r := range m.records {
+		records[i] = *r
+	}
+	return records
+}
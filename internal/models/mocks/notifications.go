@@ -0,0 +1,65 @@
+package mocks
+
+import (
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/models"
+	"time"
+)
+
+// NotificationModel says that alice (user 1) has two notifications about the public mock snippet: a heart from dave,
+// which she hasn't read, and an older thumbs up from carol, which she has. Inserted records the notifications that
+// tests create.
+type NotificationModel struct {
+	Inserted []string
+}
+
+func (m *NotificationModel) Insert(userID, actorID, snippetID int, kind, detail string) (bool, error) {
+	m.Inserted = append(m.Inserted, fmt.Sprintf("%d %d %d %s %s", userID, actorID, snippetID, kind, detail))
+	return true, nil
+}
+
+func (m *NotificationModel) Unread(userID int) (int, error) {
+	if userID != 1 {
+		return 0, nil
+	}
+
+	return 1, nil
+}
+
+func (m *NotificationModel) Latest(userID, limit int) ([]*models.Notification, error) {
+	if userID != 1 {
+		return []*models.Notification{}, nil
+	}
+
+	return []*models.Notification{
+		{
+			ID:              2,
+			Kind:            models.NotificationReaction,
+			Detail:          "heart",
+			ActorName:       "Dave",
+			ActorUsername:   "dave",
+			SnippetPublicID: mockSnippet.PublicID,
+			SnippetTitle:    mockSnippet.Title,
+			Created:         time.Now().Add(-time.Hour),
+		},
+		{
+			ID:              1,
+			Kind:            models.NotificationReaction,
+			Detail:          "thumbsup",
+			ActorName:       "Carol",
+			ActorUsername:   "carol",
+			SnippetPublicID: mockSnippet.PublicID,
+			SnippetTitle:    mockSnippet.Title,
+			Created:         time.Now().Add(-24 * time.Hour),
+			Read:            true,
+		},
+	}, nil
+}
+
+func (m *NotificationModel) MarkRead(userID, id int) error {
+	return nil
+}
+
+func (m *NotificationModel) MarkAllRead(userID int) error {
+	return nil
+}
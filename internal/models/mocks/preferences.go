@@ -0,0 +1,20 @@
+package mocks
+
+// UserPreferencesModel says that alice (user 1) gets emails about reactions, and nobody else gets any.
+type UserPreferencesModel struct{}
+
+func (m *UserPreferencesModel) EmailKinds(userID int) ([]string, error) {
+	if userID != 1 {
+		return []string{}, nil
+	}
+
+	return []string{"reaction"}, nil
+}
+
+func (m *UserPreferencesModel) SetEmailKinds(userID int, kinds []string) error {
+	return nil
+}
+
+func (m *UserPreferencesModel) Unsubscribe(userID int, kind string) error {
+	return nil
+}
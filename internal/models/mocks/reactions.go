@@ -0,0 +1,42 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"time"
+)
+
+// ReactionModel says that the public mock snippet has two thumbs up (one of them from alice) and a heart.
+type ReactionModel struct{}
+
+func (m *ReactionModel) Add(snippetID, userID int, name string) error {
+	if !models.ValidReaction(name) {
+		return models.ErrInvalidReaction
+	}
+
+	return nil
+}
+
+func (m *ReactionModel) Remove(snippetID, userID int, name string) error {
+	if !models.ValidReaction(name) {
+		return models.ErrInvalidReaction
+	}
+
+	return nil
+}
+
+func (m *ReactionModel) Counts(snippetID, userID int) ([]models.ReactionCount, time.Time, error) {
+	counts := make([]models.ReactionCount, len(models.Reactions))
+	for i, r := range models.Reactions {
+		counts[i] = models.ReactionCount{Reaction: r}
+	}
+
+	if snippetID != mockSnippet.ID {
+		return counts, time.Time{}, nil
+	}
+
+	counts[0].Count = 2
+	counts[0].Reacted = userID == 1
+	counts[1].Count = 1
+
+	return counts, mockSnippet.Created, nil
+}
@@ -0,0 +1,68 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"time"
+)
+
+var mockRemote = &models.Remote{
+	ID:      1,
+	UserID:  1,
+	Name:    "public",
+	BaseURL: "https://snippets.example.com",
+	Token:   "REMOTETOKENREMOTETOKEN1234",
+	Created: time.Now(),
+}
+
+var mockMirror = &models.Mirror{
+	RemoteName: "public",
+	URL:        "https://snippets.example.com/snippet/view/01HV5Q9Z8Y7X6W5V4T3S2R1Q0P",
+	Created:    time.Now(),
+}
+
+// RemoteModel gives alice (user 1) one remote, and says that the mock snippet has been cross-posted to it.
+type RemoteModel struct{}
+
+func (m *RemoteModel) Insert(userID int, name, baseURL, token string) (int, error) {
+	if name == mockRemote.Name && userID == mockRemote.UserID {
+		return 0, models.ErrDuplicateRemoteName
+	}
+
+	return 2, nil
+}
+
+func (m *RemoteModel) Get(id, userID int) (*models.Remote, error) {
+	if id != mockRemote.ID || userID != mockRemote.UserID {
+		return nil, models.ErrNoRecord
+	}
+
+	return mockRemote, nil
+}
+
+func (m *RemoteModel) AllForUser(userID int) ([]*models.Remote, error) {
+	if userID != mockRemote.UserID {
+		return []*models.Remote{}, nil
+	}
+
+	return []*models.Remote{mockRemote}, nil
+}
+
+func (m *RemoteModel) Delete(id, userID int) error {
+	if id != mockRemote.ID || userID != mockRemote.UserID {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *RemoteModel) RecordMirror(snippetID int, remoteName, url string) error {
+	return nil
+}
+
+func (m *RemoteModel) Mirrors(snippetID int) ([]*models.Mirror, error) {
+	if snippetID == mockSnippet.ID {
+		return []*models.Mirror{mockMirror}, nil
+	}
+
+	return []*models.Mirror{}, nil
+}
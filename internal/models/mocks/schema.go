@@ -0,0 +1,12 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+)
+
+// SchemaModel says that every migration has been applied cleanly.
+type SchemaModel struct{}
+
+func (m *SchemaModel) Version() (int, bool, error) {
+	return models.SchemaVersion, false, nil
+}
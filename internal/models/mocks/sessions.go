@@ -0,0 +1,36 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"time"
+)
+
+// SessionModel says that alice (user 1) is also logged in on a phone, with the session token below. The session only
+// counts as live if a test adds a session with that token to the session store.
+type SessionModel struct{}
+
+const mockSessionToken = "MOCKSESSIONTOKENMOCKSESSIONTOKENMOCKSESSION"
+
+func (m *SessionModel) Touch(token string, userID int, userAgent, ip string) error {
+	return nil
+}
+
+func (m *SessionModel) AllForUser(userID int) ([]*models.Session, error) {
+	if userID != 1 {
+		return []*models.Session{}, nil
+	}
+
+	return []*models.Session{{
+		ID:        models.SessionID(mockSessionToken),
+		Token:     mockSessionToken,
+		UserID:    1,
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)",
+		IP:        "203.0.113.7",
+		Created:   time.Now().Add(-time.Hour),
+		LastSeen:  time.Now(),
+	}}, nil
+}
+
+func (m *SessionModel) Delete(token string) error {
+	return nil
+}
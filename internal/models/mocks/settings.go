@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"sync"
+	"time"
+)
+
+// SettingsModel starts with Defaults (or the default site settings, if that's nil), and remembers what it's asked to
+// save, so tests can check that changes take effect.
+type SettingsModel struct {
+	Defaults *models.SiteSettings
+
+	mu       sync.Mutex
+	settings *models.SiteSettings
+}
+
+func (m *SettingsModel) Get() (models.SiteSettings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.current(), nil
+}
+
+func (m *SettingsModel) Update(settings models.SiteSettings, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Like the real model, saving the settings leaves maintenance mode alone.
+	settings.Maintenance = m.current().Maintenance
+	settings.Updated = time.Now()
+	m.settings = &settings
+	return nil
+}
+
+func (m *SettingsModel) SetMaintenance(enabled bool, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings := m.current()
+	settings.Maintenance = enabled
+	settings.Updated = time.Now()
+	m.settings = &settings
+	return nil
+}
+
+// current returns the saved settings, or the defaults if nothing has been saved yet. The caller must hold m.mu.
+func (m *SettingsModel) current() models.SiteSettings {
+	switch {
+	case m.settings != nil:
+		return *m.settings
+	case m.Defaults != nil:
+		return *m.Defaults
+	default:
+		return models.DefaultSiteSettings
+	}
+}
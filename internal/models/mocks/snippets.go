@@ -1,33 +1,224 @@
 package mocks
 
 import (
+	"fmt"
 	"github.com/0xshiku/snippetbox/internal/models"
+	"slices"
 	"time"
 )
 
 var mockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         1,
+	PublicID:   "01HV5Q2X8N3K7M4R6T9W0Y1Z2A",
+	UserID:     1,
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	Visibility: models.VisibilityPublic,
+}
+
+var mockUnlistedSnippet = &models.Snippet{
+	ID:         3,
+	PublicID:   "01HV5Q3B4C5D6E7F8G9H0J1K2M",
+	UserID:     1,
+	Title:      "A hidden haiku",
+	Content:    "Only those with the link...",
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	Visibility: models.VisibilityUnlisted,
+}
+
+// mockJSONSnippet is minified JSON, for testing the formatters. It isn't in any of the listings.
+var mockJSONSnippet = &models.Snippet{
+	ID:         4,
+	PublicID:   "01HV5Q5J6K7M8N9P0Q1R2S3T4V",
+	UserID:     1,
+	Title:      "Settings",
+	Content:    `{"name":"alice","admin":false}`,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(48 * time.Hour),
+	Visibility: models.VisibilityPublic,
 }
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	return 2, nil
+func (m *SnippetModel) Insert(userID int, title string, content string, expires int, visibility string) (string, error) {
+	return "01HV5Q4N5P6Q7R8S9T0V1W2X3Y", nil
+}
+
+func (m *SnippetModel) InsertMany(userID int, drafts []models.SnippetDraft, expires int, visibility string) ([]string, error) {
+	publicIDs := make([]string, len(drafts))
+	for i := range drafts {
+		publicIDs[i] = fmt.Sprintf("01HV5Q4N5P6Q7R8S9T0V1W2X%02d", i)
+	}
+	return publicIDs, nil
 }
 
 func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockUnlistedSnippet, nil
+	case 4:
+		return mockJSONSnippet, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) GetByPublicID(publicID string) (*models.Snippet, error) {
+	switch publicID {
+	case mockSnippet.PublicID:
+		return mockSnippet, nil
+	case mockUnlistedSnippet.PublicID:
+		return mockUnlistedSnippet, nil
+	case mockJSONSnippet.PublicID:
+		return mockJSONSnippet, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
 
-func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
-	return []*models.Snippet{mockSnippet}, nil
+func (m *SnippetModel) Latest(limit, offset int) ([]*models.Snippet, error) {
+	if offset == 0 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) LatestByUser(userID, limit, offset int) ([]*models.Snippet, error) {
+	if userID == 1 && offset == 0 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+
+	return []*models.Snippet{}, nil
+}
+
+// ListForUser gives alice (user 1) her public and unlisted snippets, in the order they're in here whatever the sort.
+func (m *SnippetModel) ListForUser(userID int, filter models.SnippetFilter) ([]*models.Snippet, int, error) {
+	if !slices.Contains(models.SnippetSorts, filter.Sort) {
+		return nil, 0, models.ErrInvalidSort
+	}
+	if userID != 1 {
+		return []*models.Snippet{}, 0, nil
+	}
+
+	snippets := []*models.Snippet{mockSnippet, mockUnlistedSnippet}
+	total := len(snippets)
+
+	snippets = snippets[min(filter.Offset, total):min(filter.Offset+filter.Limit, total)]
+	return snippets, total, nil
+}
+
+// Trending pretends that the JSON snippet is the only one with recent reactions.
+func (m *SnippetModel) Trending(limit int, since time.Time) ([]*models.Snippet, error) {
+	return []*models.Snippet{mockJSONSnippet}, nil
+}
+
+func (m *SnippetModel) Import(userID int, title, content string, created, expires time.Time, visibility string) (string, error) {
+	return "01HV5Q9Z8Y7X6W5V4T3S2R1Q0P", nil
+}
+
+func (m *SnippetModel) ImportMany(userID int, snippets []*models.Snippet) ([]string, error) {
+	publicIDs := make([]string, len(snippets))
+	for i := range snippets {
+		publicIDs[i] = fmt.Sprintf("01HV5Q9Z8Y7X6W5V4T3S2R1Q%02d", i)
+	}
+	return publicIDs, nil
+}
+
+func (m *SnippetModel) Export(userID int, fn func(s *models.Snippet, owner string) error) error {
+	if userID == 0 || userID == 1 {
+		return fn(mockSnippet, "alice")
+	}
+
+	return nil
+}
+
+// Disown pretends that alice and the guest user each have one snippet.
+func (m *SnippetModel) Disown(userID int, dryRun bool) (*models.Plan, error) {
+	plan := &models.Plan{DryRun: dryRun}
+	if userID == 1 || userID == mockGuestUser.ID {
+		plan.Steps = []models.PlanStep{{Action: models.PlanUpdate, Table: "snippets", Rows: 1, IDs: []string{mockSnippet.PublicID}}}
+	}
+
+	return plan, nil
+}
+
+// Usage pretends that alice has 2 unexpired snippets, 1 of which she created recently. Nobody else has any.
+func (m *SnippetModel) Usage(userID int, since time.Time) (int, int, error) {
+	if userID == 1 {
+		return 2, 1, nil
+	}
+
+	return 0, 0, nil
+}
+
+// mockTrashedSnippet is in alice's trash. Nothing else returns it.
+var mockTrashedSnippet = &models.Snippet{
+	ID:         5,
+	PublicID:   "01HV5Q6W7X8Y9Z0A1B2C3D4E5F",
+	UserID:     1,
+	Title:      "A fallen leaf",
+	Content:    "Gone with the wind...",
+	Created:    time.Now().Add(-48 * time.Hour),
+	Expires:    time.Now().Add(48 * time.Hour),
+	Visibility: models.VisibilityPublic,
+	Deleted:    time.Now().Add(-time.Hour),
+}
+
+// Trash lets alice move any of her snippets to the trash, apart from the one that's already there.
+func (m *SnippetModel) Trash(publicID string, userID int) error {
+	s, err := m.GetByPublicID(publicID)
+	if err != nil || s.UserID != userID {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) Restore(publicID string, userID int) error {
+	if publicID != mockTrashedSnippet.PublicID || userID != mockTrashedSnippet.UserID {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) Purge(publicID string, userID int) error {
+	return m.Restore(publicID, userID)
+}
+
+func (m *SnippetModel) Trashed(userID int) ([]*models.Snippet, error) {
+	if userID != mockTrashedSnippet.UserID {
+		return []*models.Snippet{}, nil
+	}
+
+	return []*models.Snippet{mockTrashedSnippet}, nil
+}
+
+// PurgeTrash pretends that the trashed snippet is purged once the time given is after it was deleted.
+func (m *SnippetModel) PurgeTrash(before time.Time) ([]string, error) {
+	if before.After(mockTrashedSnippet.Deleted) {
+		return []string{mockTrashedSnippet.PublicID}, nil
+	}
+
+	return []string{}, nil
+}
+
+// PurgeExpired says that there were three expired snippets, whatever the time.
+func (m *SnippetModel) PurgeExpired(before time.Time) (int, error) {
+	return 3, nil
+}
+
+// FindByHash only knows about the first snippet, which is public.
+func (m *SnippetModel) FindByHash(hash string, userID int) (*models.Snippet, error) {
+	if hash != models.ContentHash(mockSnippet.Content) {
+		return nil, models.ErrNoRecord
+	}
+
+	return mockSnippet, nil
 }
@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"time"
+)
+
+type TokenModel struct{}
+
+func (m *TokenModel) New(userID int, ttl time.Duration, scope string) (*models.Token, error) {
+	plaintext := "APITOKENAPITOKENAPITOKEN12"
+	switch scope {
+	case models.ScopePairing:
+		plaintext = "ABCDEFGH"
+	case models.ScopeUnsubscribe:
+		plaintext = "UNSUBSCRIBETOKENUNSUBSCRIBE"
+	case models.ScopeRefresh:
+		plaintext = "REFRESHTOKENREFRESHTOKEN12"
+	}
+
+	return &models.Token{
+		Plaintext: plaintext,
+		UserID:    userID,
+		Expiry:    time.Now().Add(ttl),
+		Scope:     scope,
+	}, nil
+}
+
+func (m *TokenModel) GetUserID(scope, plaintext string) (int, error) {
+	switch {
+	case scope == models.ScopePairing && plaintext == "ABCDEFGH":
+		return 1, nil
+	case scope == models.ScopeAPI && plaintext == "APITOKENAPITOKENAPITOKEN12":
+		return 1, nil
+	case scope == models.ScopeAPI && plaintext == "DAVETOKENDAVETOKENDAVETOK3":
+		return 3, nil
+	case scope == models.ScopeUnsubscribe && plaintext == "UNSUBSCRIBETOKENUNSUBSCRIBE":
+		return 1, nil
+	case scope == models.ScopeRefresh && plaintext == "REFRESHTOKENREFRESHTOKEN12":
+		return 1, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
+func (m *TokenModel) Consume(scope, plaintext string) (int, error) {
+	return m.GetUserID(scope, plaintext)
+}
+
+func (m *TokenModel) DeleteAllForUser(scope string, userID int) error {
+	return nil
+}
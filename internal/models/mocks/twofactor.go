@@ -0,0 +1,81 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"sync"
+)
+
+// The secret used for the mock user dave@example.com, who has two-factor authentication turned on.
+// Tests can calculate the current code with totp.Code(MockTOTPSecret, time.Now()).
+const MockTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TwoFactorModel remembers which users have logged in with a recovery code, so that tests can check what happens when
+// they log in again. A UserModel with this as its TwoFactor field shows them as having to set up two-factor
+// authentication again.
+type TwoFactorModel struct {
+	mu        sync.Mutex
+	recovered map[int]bool
+}
+
+func (m *TwoFactorModel) Secret(userID int) (string, error) {
+	switch userID {
+	case 1, 2, 4, 5:
+		return "", nil
+	case 3:
+		if m.mustEnroll(userID) {
+			return "", nil
+		}
+		return MockTOTPSecret, nil
+	default:
+		return "", models.ErrNoRecord
+	}
+}
+
+func (m *TwoFactorModel) Enable(userID int, secret string) ([]string, error) {
+	m.mu.Lock()
+	delete(m.recovered, userID)
+	m.mu.Unlock()
+
+	codes := make([]string, models.RecoveryCodeCount)
+	for i := range codes {
+		codes[i] = "RECOVERY23"
+	}
+
+	return codes, nil
+}
+
+func (m *TwoFactorModel) Disable(userID int) error {
+	return nil
+}
+
+func (m *TwoFactorModel) Recover(userID int, code string) error {
+	if userID != 3 || models.NormalizePairingCode(code) != "RECOVERY23" || m.mustEnroll(userID) {
+		return models.ErrNoRecord
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.recovered == nil {
+		m.recovered = map[int]bool{}
+	}
+	m.recovered[userID] = true
+
+	return nil
+}
+
+func (m *TwoFactorModel) RecoveryCodesLeft(userID int) (int, error) {
+	return 9, nil
+}
+
+// mustEnroll reports whether the user has logged in with a recovery code, and not set up two-factor authentication since.
+func (m *TwoFactorModel) mustEnroll(userID int) bool {
+	if m == nil {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.recovered[userID]
+}
@@ -0,0 +1,16 @@
+package mocks
+
+import (
+	"context"
+	"github.com/0xshiku/snippetbox/internal/models"
+)
+
+// TxModel passes its Queries straight to the function, without a transaction, so tests can give it the same mocks as
+// the rest of the application.
+type TxModel struct {
+	Queries *models.Queries
+}
+
+func (m *TxModel) WithTx(ctx context.Context, fn func(q *models.Queries) error) error {
+	return fn(m.Queries)
+}
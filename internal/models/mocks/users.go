@@ -2,50 +2,172 @@ package mocks
 
 import (
 	"github.com/0xshiku/snippetbox/internal/models"
+	"strconv"
 	"time"
 )
 
-type UserModel struct{}
+var mockUser = &models.User{
+	ID:                 1,
+	Name:               "Alice",
+	Username:           "alice",
+	Email:              "alice@example.com",
+	Created:            time.Now(),
+	Timezone:           "UTC",
+	Locale:             "en-GB",
+	PreferencesVersion: 3,
+}
+
+var mockAdmin = &models.User{
+	ID:       2,
+	Name:     "Carol",
+	Username: "carol",
+	Email:    "admin@example.com",
+	Created:  time.Now(),
+	IsAdmin:  true,
+}
+
+// mockTwoFactorUser has two-factor authentication turned on (see TwoFactorModel).
+var mockTwoFactorUser = &models.User{
+	ID:       3,
+	Name:     "Dave",
+	Username: "dave",
+	Email:    "dave@example.com",
+	Created:  time.Now(),
+}
+
+// mockSuspendedUser can still log in with the mock Authenticate, but Get shows them as suspended. That's what happens when an
+// admin suspends somebody who is already logged in, which the authenticate middleware has to deal with.
+var mockSuspendedUser = &models.User{
+	ID:       4,
+	Name:     "Eve",
+	Username: "eve",
+	Email:    "eve@example.com",
+	Created:  time.Now(),
+	Status:   models.UserStatusSuspended,
+}
 
-func (m *UserModel) Insert(name, email, password string) error {
-	switch email {
-	case "dup@example.com":
+// mockGuestUser has a guest account, which expires in a few hours. ExpiredGuests returns it anyway, so that tests can run
+// the whole guest expiry job, warning and deletion, in one go.
+var mockGuestUser = &models.User{
+	ID:       5,
+	Name:     "Grace",
+	Username: "grace",
+	Email:    "grace@example.com",
+	Created:  time.Now(),
+	Expires:  time.Now().Add(6 * time.Hour),
+}
+
+// UserModel can share a TwoFactorModel, so that users who have logged in with a recovery code have the
+// MustEnrollTwoFactor flag set.
+type UserModel struct {
+	TwoFactor *TwoFactorModel
+}
+
+func (m *UserModel) Insert(name, username, email, password string) error {
+	switch {
+	case email == "dup@example.com":
 		return models.ErrDuplicateEmail
+	case username == "taken":
+		return models.ErrDuplicateUsername
 	default:
 		return nil
 	}
 }
 
+func (m *UserModel) InsertAdmin(name, username, email, password string) error {
+	return m.Insert(name, username, email, password)
+}
+
+// InsertExternal treats the same email address and username as taken as Insert does. New accounts get the ID 6, which
+// none of the other mock users have.
+func (m *UserModel) InsertExternal(name, username, email string) (int, error) {
+	err := m.Insert(name, username, email, "")
+	if err != nil {
+		return 0, err
+	}
+	return 6, nil
+}
+
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	if email == "alice@example.com" && password == "pa$$word" {
 		return 1, nil
 	}
 
+	if email == "admin@example.com" && password == "pa$$word" {
+		return 2, nil
+	}
+
+	if email == "dave@example.com" && password == "pa$$word" {
+		return 3, nil
+	}
+
+	if email == "eve@example.com" && password == "pa$$word" {
+		return 4, nil
+	}
+
+	if email == "grace@example.com" && password == "pa$$word" {
+		return 5, nil
+	}
+
+	if email == "banned@example.com" && password == "pa$$word" {
+		return 0, models.ErrAccountBanned
+	}
+
 	return 0, models.ErrInvalidCredentials
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 2, 3, 4, 5:
 		return true, nil
 	default:
 		return false, nil
 	}
 }
 
-func (m *UserModel) Get(id int) (*models.User, error) {
-	if id == 1 {
-		u := &models.User{
-			ID:      1,
-			Name:    "Alice",
-			Email:   "alice@example.com",
-			Created: time.Now(),
-		}
+// The mock treats the same email address and username as taken as Insert does, so that the checks and the insert agree.
+func (m *UserModel) EmailTaken(email string, exceptID int) (bool, error) {
+	switch {
+	case email == "dup@example.com":
+		return true, nil
+	case email == "alice@example.com" && exceptID != 1:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
 
-		return u, nil
+func (m *UserModel) UsernameTaken(username string, exceptID int) (bool, error) {
+	switch {
+	case username == "taken":
+		return true, nil
+	case username == "alice" && exceptID != 1:
+		return true, nil
+	default:
+		return false, nil
 	}
+}
 
-	return nil, models.ErrNoRecord
+func (m *UserModel) Get(id int) (*models.User, error) {
+	switch id {
+	case 1:
+		return mockUser, nil
+	case 2:
+		return mockAdmin, nil
+	case 3:
+		if m.TwoFactor.mustEnroll(id) {
+			user := *mockTwoFactorUser
+			user.MustEnrollTwoFactor = true
+			return &user, nil
+		}
+		return mockTwoFactorUser, nil
+	case 4:
+		return mockSuspendedUser, nil
+	case 5:
+		return mockGuestUser, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
 }
 
 func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
@@ -59,3 +181,137 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 
 	return models.ErrNoRecord
 }
+
+func (m *UserModel) PasswordReset(id int, newPassword string) error {
+	if _, err := m.Get(id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *UserModel) EmailUpdate(id int, newEmail string) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+
+	if newEmail == "dup@example.com" {
+		return models.ErrDuplicateEmail
+	}
+
+	return nil
+}
+
+func (m *UserModel) GetByUsername(username string) (*models.User, error) {
+	switch username {
+	case "alice":
+		return mockUser, nil
+	case "carol":
+		return mockAdmin, nil
+	case "eve":
+		return mockSuspendedUser, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	for _, user := range []*models.User{mockUser, mockAdmin, mockTwoFactorUser, mockSuspendedUser, mockGuestUser} {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *UserModel) ProfileUpdate(id int, name, username string) error {
+	if username == "taken" {
+		return models.ErrDuplicateUsername
+	}
+
+	return nil
+}
+
+func (m *UserModel) AdminEmails() ([]string, error) {
+	return []string{mockAdmin.Email}, nil
+}
+
+func (m *UserModel) Delete(id int, dryRun bool) (*models.Plan, error) {
+	switch id {
+	case 1, 2, 3, 5:
+		return &models.Plan{DryRun: dryRun, Steps: []models.PlanStep{
+			{Action: models.PlanDelete, Table: "snippets", Rows: 1, IDs: []string{mockSnippet.PublicID}},
+			{Action: models.PlanDelete, Table: "tokens", Rows: 2},
+			{Action: models.PlanDelete, Table: "users", Rows: 1, IDs: []string{strconv.Itoa(id)}},
+		}}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) PreferencesUpdate(id int, timezone, locale string) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *UserModel) PreferencesUpdateIfMatch(id, version int, timezone, locale string) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+
+	if version != mockUser.PreferencesVersion {
+		return models.ErrEditConflict
+	}
+
+	return nil
+}
+
+func (m *UserModel) StatusUpdate(id int, status string) error {
+	switch status {
+	case models.UserStatusActive, models.UserStatusSuspended, models.UserStatusBanned:
+	default:
+		return models.ErrInvalidStatus
+	}
+
+	switch id {
+	case 1, 2, 3, 4:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) SetAdmin(id int, isAdmin bool) error {
+	if _, err := m.Get(id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *UserModel) InsertGuest(name, username, email, password string, expires time.Time) error {
+	return m.Insert(name, username, email, password)
+}
+
+func (m *UserModel) MakePermanent(id int) error {
+	return nil
+}
+
+func (m *UserModel) ExpiringGuests(before time.Time) ([]*models.User, error) {
+	if mockGuestUser.Expires.After(before) {
+		return []*models.User{}, nil
+	}
+
+	return []*models.User{mockGuestUser}, nil
+}
+
+func (m *UserModel) MarkExpiryWarned(id int) error {
+	return nil
+}
+
+func (m *UserModel) ExpiredGuests() ([]*models.User, error) {
+	return []*models.User{mockGuestUser}, nil
+}
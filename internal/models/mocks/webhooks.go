@@ -0,0 +1,86 @@
+package mocks
+
+import (
+	"github.com/0xshiku/snippetbox/internal/models"
+	"sync"
+	"time"
+)
+
+var mockWebhook = &models.Webhook{
+	ID:      1,
+	UserID:  1,
+	URL:     "https://hooks.example.com/snippets",
+	Secret:  "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	Created: time.Now(),
+}
+
+var mockWebhookDelivery = &models.WebhookDelivery{
+	ID:              1,
+	WebhookID:       1,
+	URL:             "https://hooks.example.com/snippets",
+	Event:           "snippet.created",
+	SnippetPublicID: "01HV5Q2X8N3K7M4R6T9W0Y1Z2A",
+	Attempt:         1,
+	Status:          503,
+	Error:           "webhooks: unexpected status from receiver: 503 Service Unavailable",
+	Created:         time.Now(),
+}
+
+// WebhookModel gives alice (user 1) one webhook, with one failed delivery. It remembers the deliveries it's asked to
+// record, so tests can check them. Deliveries are recorded in the background, so it's safe for concurrent use.
+type WebhookModel struct {
+	mu       sync.Mutex
+	recorded []*models.WebhookDelivery
+}
+
+func (m *WebhookModel) Insert(userID int, url, secret string) (int, error) {
+	if url == mockWebhook.URL && userID == mockWebhook.UserID {
+		return 0, models.ErrDuplicateWebhook
+	}
+
+	return 2, nil
+}
+
+func (m *WebhookModel) AllForUser(userID int) ([]*models.Webhook, error) {
+	if userID != mockWebhook.UserID {
+		return []*models.Webhook{}, nil
+	}
+
+	return []*models.Webhook{mockWebhook}, nil
+}
+
+func (m *WebhookModel) Delete(id, userID int) error {
+	if id != mockWebhook.ID || userID != mockWebhook.UserID {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *WebhookModel) RecordDelivery(d *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.recorded = append(m.recorded, d)
+	return nil
+}
+
+func (m *WebhookModel) Deliveries(userID, limit int) ([]*models.WebhookDelivery, error) {
+	if userID != mockWebhook.UserID {
+		return []*models.WebhookDelivery{}, nil
+	}
+
+	return []*models.WebhookDelivery{mockWebhookDelivery}, nil
+}
+
+func (m *WebhookModel) PruneDeliveries(before time.Time) (int, error) {
+	return 0, nil
+}
+
+// Recorded returns the deliveries that RecordDelivery has been given so far.
+func (m *WebhookModel) Recorded() []*models.WebhookDelivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*models.WebhookDelivery(nil), m.recorded...)
+}
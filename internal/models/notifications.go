@@ -0,0 +1,128 @@
+package models
+
+import (
+	"time"
+)
+
+// The kinds of notification. Reactions are the only thing that can happen to somebody else's snippet at the moment.
+const (
+	NotificationReaction = "reaction"
+)
+
+// Notification tells a user that somebody did something to one of their snippets. Detail depends on the kind: for a
+// reaction, it's the name of the reaction. ActorUsername is "" if the actor hasn't chosen a username.
+type Notification struct {
+	ID              int
+	Kind            string
+	Detail          string
+	ActorName       string
+	ActorUsername   string
+	SnippetPublicID string
+	SnippetTitle    string
+	Created         time.Time
+	Read            bool
+}
+
+// Emoji returns the emoji for a reaction notification, or "" if the reaction has since been taken out of the set.
+func (n *Notification) Emoji() string {
+	for _, r := range Reactions {
+		if r.Name == n.Detail {
+			return r.Emoji
+		}
+	}
+	return ""
+}
+
+type NotificationModelInterface interface {
+	Insert(userID, actorID, snippetID int, kind, detail string) (bool, error)
+	Unread(userID int) (int, error)
+	Latest(userID, limit int) ([]*Notification, error)
+	MarkRead(userID, id int) error
+	MarkAllRead(userID int) error
+}
+
+// NotificationModel wraps a database connection pool and is used to manage the notifications table.
+type NotificationModel struct {
+	DB DBTX
+}
+
+// Insert records a notification for the user, and reports whether it was new. If the same event has already been
+// recorded, nothing happens and it returns false.
+func (m *NotificationModel) Insert(userID, actorID, snippetID int, kind, detail string) (bool, error) {
+	stmt := `INSERT IGNORE INTO notifications (user_id, actor_id, snippet_id, kind, detail, created)
+    VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, userID, actorID, snippetID, kind, detail)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// Unread returns how many of the user's notifications haven't been read yet. Like Latest, it leaves out the ones about
+// snippets in the trash.
+func (m *NotificationModel) Unread(userID int) (int, error) {
+	stmt := `SELECT COUNT(*) FROM notifications n
+    JOIN snippets s ON s.id = n.snippet_id
+    WHERE n.user_id = ? AND n.read_at IS NULL AND s.deleted_at IS NULL`
+
+	var count int
+	err := m.DB.QueryRow(stmt, userID).Scan(&count)
+	return count, err
+}
+
+// Latest returns the user's most recent notifications, newest first. Notifications about snippets in the trash are left
+// out, and come back if the snippet is restored.
+func (m *NotificationModel) Latest(userID, limit int) ([]*Notification, error) {
+	stmt := `SELECT n.id, n.kind, n.detail, u.name, COALESCE(u.username, ''), s.public_id, s.title, n.created, n.read_at IS NOT NULL
+    FROM notifications n
+    JOIN users u ON u.id = n.actor_id
+    JOIN snippets s ON s.id = n.snippet_id
+    WHERE n.user_id = ? AND s.deleted_at IS NULL
+    ORDER BY n.created DESC, n.id DESC
+    LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+
+	for rows.Next() {
+		n := &Notification{}
+
+		err = rows.Scan(&n.ID, &n.Kind, &n.Detail, &n.ActorName, &n.ActorUsername, &n.SnippetPublicID, &n.SnippetTitle, &n.Created, &n.Read)
+		if err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// MarkRead marks one of the user's notifications as read. Notifications belonging to other users are left alone, as if
+// they didn't exist.
+func (m *NotificationModel) MarkRead(userID, id int) error {
+	_, err := m.DB.Exec(`UPDATE notifications SET read_at = UTC_TIMESTAMP() WHERE id = ? AND user_id = ? AND read_at IS NULL`, id, userID)
+	return err
+}
+
+// MarkAllRead marks all of the user's notifications as read.
+func (m *NotificationModel) MarkAllRead(userID int) error {
+	_, err := m.DB.Exec(`UPDATE notifications SET read_at = UTC_TIMESTAMP() WHERE user_id = ? AND read_at IS NULL`, userID)
+	return err
+}
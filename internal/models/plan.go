@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The actions that a PlanStep can take.
+const (
+	PlanDelete = "delete"
+	PlanUpdate = "update"
+)
+
+// Plan records the changes that a destructive operation made to the database, or would have made if it wasn't a dry run.
+// Operations which take a dryRun argument do the same reads either way, so a dry run's plan matches what a real run
+// would do (as long as nothing changes in between), but they stop before writing anything.
+type Plan struct {
+	DryRun bool
+	Steps  []PlanStep
+}
+
+// PlanStep is the rows that one statement deletes or updates in one table. Rows counts them, including rows removed by
+// ON DELETE CASCADE. IDs identifies them where that's useful, like the public IDs of snippets, and is empty otherwise.
+type PlanStep struct {
+	Action string
+	Table  string
+	Rows   int
+	IDs    []string
+}
+
+// add appends a step to the plan. Steps which don't touch any rows are left out.
+func (p *Plan) add(action, table string, rows int, ids []string) {
+	if rows == 0 {
+		return
+	}
+	p.Steps = append(p.Steps, PlanStep{Action: action, Table: table, Rows: rows, IDs: ids})
+}
+
+// Merge adds the steps from another plan, for operations which are made up of several smaller ones.
+func (p *Plan) Merge(other *Plan) {
+	p.Steps = append(p.Steps, other.Steps...)
+}
+
+// Remove takes the steps which delete or update rows in a table out of the plan. It's for when one operation's plan
+// overlaps another's, like the snippets that a user deletion would delete if they hadn't been disowned first.
+func (p *Plan) Remove(action, table string) {
+	steps := p.Steps[:0]
+	for _, s := range p.Steps {
+		if s.Action != action || s.Table != table {
+			steps = append(steps, s)
+		}
+	}
+	p.Steps = steps
+}
+
+// Rows returns how many rows the plan deletes or updates in a table.
+func (p *Plan) Rows(action, table string) int {
+	n := 0
+	for _, s := range p.Steps {
+		if s.Action == action && s.Table == table {
+			n += s.Rows
+		}
+	}
+	return n
+}
+
+// IDs returns the IDs of the rows that the plan deletes or updates in a table.
+func (p *Plan) IDs(action, table string) []string {
+	var ids []string
+	for _, s := range p.Steps {
+		if s.Action == action && s.Table == table {
+			ids = append(ids, s.IDs...)
+		}
+	}
+	return ids
+}
+
+// String summarizes the plan for logs, like "delete 2 rows from snippets (01HV..., 01HW...), delete 1 row from users (5)".
+func (p *Plan) String() string {
+	if len(p.Steps) == 0 {
+		return "no changes"
+	}
+
+	parts := make([]string, len(p.Steps))
+	for i, s := range p.Steps {
+		preposition := "from"
+		if s.Action == PlanUpdate {
+			preposition = "in"
+		}
+
+		rows := "rows"
+		if s.Rows == 1 {
+			rows = "row"
+		}
+
+		parts[i] = fmt.Sprintf("%s %d %s %s %s", s.Action, s.Rows, rows, preposition, s.Table)
+		if len(s.IDs) > 0 {
+			parts[i] += " (" + strings.Join(s.IDs, ", ") + ")"
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// queryIDs runs a query which returns a single string column, like the public IDs of some snippets, for a PlanStep.
+func queryIDs(q DBTX, stmt string, args ...any) ([]string, error) {
+	rows, err := q.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
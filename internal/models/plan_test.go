@@ -0,0 +1,32 @@
+package models
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"strings"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	plan := &Plan{DryRun: true}
+	asserts.Equal(t, plan.String(), "no changes")
+
+	plan.add(PlanUpdate, "snippets", 2, []string{"A", "B"})
+	plan.add(PlanDelete, "tokens", 0, nil)
+
+	other := &Plan{}
+	other.add(PlanDelete, "snippets", 1, []string{"C"})
+	other.add(PlanDelete, "users", 1, []string{"5"})
+	plan.Merge(other)
+
+	// Steps which don't touch any rows are left out.
+	asserts.Equal(t, len(plan.Steps), 3)
+	asserts.Equal(t, plan.String(), "update 2 rows in snippets (A, B), delete 1 row from snippets (C), delete 1 row from users (5)")
+
+	asserts.Equal(t, plan.Rows(PlanUpdate, "snippets"), 2)
+	asserts.Equal(t, plan.Rows(PlanDelete, "snippets"), 1)
+	asserts.Equal(t, plan.Rows(PlanDelete, "tokens"), 0)
+	asserts.Equal(t, strings.Join(plan.IDs(PlanUpdate, "snippets"), ","), "A,B")
+
+	plan.Remove(PlanDelete, "snippets")
+	asserts.Equal(t, plan.String(), "update 2 rows in snippets (A, B), delete 1 row from users (5)")
+}
@@ -0,0 +1,71 @@
+package models
+
+type UserPreferencesModelInterface interface {
+	EmailKinds(userID int) ([]string, error)
+	SetEmailKinds(userID int, kinds []string) error
+	Unsubscribe(userID int, kind string) error
+}
+
+// UserPreferencesModel wraps a database connection pool and is used to manage the user_email_preferences table, which
+// says which kinds of notification each user gets emails about. The date preferences are kept on the users table.
+type UserPreferencesModel struct {
+	DB DBTX
+}
+
+// EmailKinds returns the kinds of notification that the user wants emails about, in alphabetical order.
+func (m *UserPreferencesModel) EmailKinds(userID int) ([]string, error) {
+	rows, err := m.DB.Query(`SELECT kind FROM user_email_preferences WHERE user_id = ? ORDER BY kind`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kinds := []string{}
+
+	for rows.Next() {
+		var kind string
+		err = rows.Scan(&kind)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return kinds, nil
+}
+
+// SetEmailKinds replaces the kinds of notification that the user wants emails about. Both steps happen in one
+// transaction, so a failure can't leave the user with none.
+func (m *UserPreferencesModel) SetEmailKinds(userID int, kinds []string) error {
+	return retry(m.DB, func() error {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`DELETE FROM user_email_preferences WHERE user_id = ?`, userID)
+		if err != nil {
+			return err
+		}
+
+		for _, kind := range kinds {
+			_, err = tx.Exec(`INSERT INTO user_email_preferences (user_id, kind) VALUES (?, ?)`, userID, kind)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Unsubscribe stops the user getting emails about one kind of notification. Unsubscribing twice does nothing.
+func (m *UserPreferencesModel) Unsubscribe(userID int, kind string) error {
+	_, err := m.DB.Exec(`DELETE FROM user_email_preferences WHERE user_id = ? AND kind = ?`, userID, kind)
+	return err
+}
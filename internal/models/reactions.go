@@ -0,0 +1,149 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Reaction is one of the emoji that users can react to snippets with. The name is what's stored, and used in the API,
+// so that the emoji shown for it can change without touching the data.
+type Reaction struct {
+	Name  string
+	Emoji string
+}
+
+// Reactions is the set of reactions that users can choose from, in the order they're shown in.
+var Reactions = []Reaction{
+	{Name: "thumbsup", Emoji: "👍"},
+	{Name: "heart", Emoji: "❤️"},
+	{Name: "laugh", Emoji: "😂"},
+	{Name: "tada", Emoji: "🎉"},
+	{Name: "thinking", Emoji: "🤔"},
+	{Name: "eyes", Emoji: "👀"},
+}
+
+// ValidReaction reports whether name is one of the Reactions.
+func ValidReaction(name string) bool {
+	for _, r := range Reactions {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReactionCount is how many users have left a reaction on a snippet, and whether the user viewing it is one of them.
+type ReactionCount struct {
+	Reaction
+	Count   int
+	Reacted bool
+}
+
+type ReactionModelInterface interface {
+	Add(snippetID, userID int, name string) error
+	Remove(snippetID, userID int, name string) error
+	Counts(snippetID, userID int) ([]ReactionCount, time.Time, error)
+}
+
+// ReactionModel wraps a database connection pool and is used to manage the snippet_reactions table.
+type ReactionModel struct {
+	DB DBTX
+}
+
+// Add leaves a reaction on a snippet from the user. Adding a reaction that the user has already left does nothing.
+// ErrInvalidReaction is returned if the name isn't one of the Reactions.
+func (m *ReactionModel) Add(snippetID, userID int, name string) error {
+	return m.change(`INSERT IGNORE INTO snippet_reactions (snippet_id, user_id, reaction, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`,
+		snippetID, userID, name)
+}
+
+// Remove takes the user's reaction off a snippet. Removing a reaction that the user hasn't left does nothing.
+func (m *ReactionModel) Remove(snippetID, userID int, name string) error {
+	return m.change(`DELETE FROM snippet_reactions WHERE snippet_id = ? AND user_id = ? AND reaction = ?`,
+		snippetID, userID, name)
+}
+
+// change runs an INSERT or DELETE statement for a reaction and, if it made a difference, records when the snippet's
+// reactions changed. Both happen in one transaction, so the time can't get out of step with the reactions.
+func (m *ReactionModel) change(stmt string, snippetID, userID int, name string) error {
+	if !ValidReaction(name) {
+		return ErrInvalidReaction
+	}
+
+	return retry(m.DB, func() error {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec(stmt, snippetID, userID, name)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(`UPDATE snippets SET reactions_changed = UTC_TIMESTAMP() WHERE id = ?`, snippetID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Counts returns a count for every one of the Reactions (including those nobody has left) on a snippet, in order, along
+// with when the reactions last changed (the zero time if they never have). If userID isn't 0, Reacted is set on the
+// reactions that the user has left.
+func (m *ReactionModel) Counts(snippetID, userID int) ([]ReactionCount, time.Time, error) {
+	stmt := `SELECT reaction, COUNT(*), COALESCE(SUM(user_id = ?), 0) FROM snippet_reactions WHERE snippet_id = ? GROUP BY reaction`
+
+	rows, err := m.DB.Query(stmt, userID, snippetID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+
+	type count struct {
+		n       int
+		reacted bool
+	}
+	found := map[string]count{}
+
+	for rows.Next() {
+		var name string
+		var c count
+		err = rows.Scan(&name, &c.n, &c.reacted)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		found[name] = c
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var changed sql.NullTime
+	err = m.DB.QueryRow(`SELECT reactions_changed FROM snippets WHERE id = ?`, snippetID).Scan(&changed)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, time.Time{}, err
+	}
+
+	// Reactions which have since been taken out of the set are left out.
+	counts := make([]ReactionCount, len(Reactions))
+	for i, r := range Reactions {
+		counts[i] = ReactionCount{Reaction: r, Count: found[r.Name].n, Reacted: found[r.Name].reacted}
+	}
+
+	return counts, changed.Time, nil
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"strings"
+	"time"
+)
+
+type RemoteModelInterface interface {
+	Insert(userID int, name, baseURL, token string) (int, error)
+	Get(id, userID int) (*Remote, error)
+	AllForUser(userID int) ([]*Remote, error)
+	Delete(id, userID int) error
+	RecordMirror(snippetID int, remoteName, url string) error
+	Mirrors(snippetID int) ([]*Mirror, error)
+}
+
+// Remote is another Snippetbox instance that a user can cross-post their snippets to, along with the API token that the
+// user was given there.
+type Remote struct {
+	ID      int
+	UserID  int
+	Name    string
+	BaseURL string
+	Token   string
+	Created time.Time
+}
+
+// Mirror records that a snippet was cross-posted to a remote instance, and where it ended up. The remote's name is copied,
+// so that the link survives the user removing the remote later.
+type Mirror struct {
+	RemoteName string
+	URL        string
+	Created    time.Time
+}
+
+// RemoteModel wraps a database connection pool and is used to manage the remotes and snippet_mirrors tables.
+// The API tokens have to be stored as they are, because we send them to the remote instance. So they're only ever shown
+// in the Authorization header of a cross-post request, and never on a page.
+type RemoteModel struct {
+	DB DBTX
+}
+
+// Insert adds a remote instance for the user, and returns its ID. Each of a user's remotes must have a different name.
+func (m *RemoteModel) Insert(userID int, name, baseURL, token string) (int, error) {
+	stmt := `INSERT INTO remotes (user_id, name, base_url, token, created) VALUES (?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, userID, name, baseURL, token)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "remotes_uc_user_name") {
+			return 0, ErrDuplicateRemoteName
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns one of the user's remotes. Asking for somebody else's remote gives ErrNoRecord, as if it didn't exist.
+func (m *RemoteModel) Get(id, userID int) (*Remote, error) {
+	stmt := `SELECT id, user_id, name, base_url, token, created FROM remotes WHERE id = ? AND user_id = ?`
+
+	r := &Remote{}
+
+	err := m.DB.QueryRow(stmt, id, userID).Scan(&r.ID, &r.UserID, &r.Name, &r.BaseURL, &r.Token, &r.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// AllForUser returns the user's remotes in alphabetical order.
+func (m *RemoteModel) AllForUser(userID int) ([]*Remote, error) {
+	stmt := `SELECT id, user_id, name, base_url, token, created FROM remotes WHERE user_id = ? ORDER BY name`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	remotes := []*Remote{}
+
+	for rows.Next() {
+		r := &Remote{}
+
+		err = rows.Scan(&r.ID, &r.UserID, &r.Name, &r.BaseURL, &r.Token, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		remotes = append(remotes, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return remotes, nil
+}
+
+// Delete removes one of the user's remotes. The record of snippets that were cross-posted to it is kept.
+func (m *RemoteModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM remotes WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// RecordMirror records that a snippet was cross-posted to the named remote, and can now be found at url.
+func (m *RemoteModel) RecordMirror(snippetID int, remoteName, url string) error {
+	stmt := `INSERT INTO snippet_mirrors (snippet_id, remote_name, url, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, snippetID, remoteName, url)
+	return err
+}
+
+// Mirrors returns the places a snippet has been cross-posted to, oldest first.
+func (m *RemoteModel) Mirrors(snippetID int) ([]*Mirror, error) {
+	stmt := `SELECT remote_name, url, created FROM snippet_mirrors WHERE snippet_id = ? ORDER BY id`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mirrors := []*Mirror{}
+
+	for rows.Next() {
+		mirror := &Mirror{}
+
+		err = rows.Scan(&mirror.RemoteName, &mirror.URL, &mirror.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		mirrors = append(mirrors, mirror)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return mirrors, nil
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Replicas is a set of read replicas of the primary database. Queries which only read, and don't mind being a moment
+// behind the primary, are spread across the replicas which are up. A replica is taken out when a query on it can't
+// reach it, and Check (which the application runs regularly) pings them all to find out which are up again. It is safe
+// for concurrent use.
+type Replicas struct {
+	dbs     []*sql.DB
+	up      []atomic.Bool
+	next    atomic.Uint64
+	timeout time.Duration
+}
+
+// NewReplicas returns a set of the replicas, each of which has to answer a ping within the timeout. They all start
+// out down, so call Check before using them.
+func NewReplicas(dbs []*sql.DB, timeout time.Duration) *Replicas {
+	return &Replicas{
+		dbs:     dbs,
+		up:      make([]atomic.Bool, len(dbs)),
+		timeout: timeout,
+	}
+}
+
+// Check pings every replica, and returns how many are up. The error says why the others are down.
+func (r *Replicas) Check() (int, error) {
+	var errs []error
+	up := 0
+
+	for i, db := range r.dbs {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		err := db.PingContext(ctx)
+		cancel()
+
+		r.up[i].Store(err == nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("replica %d: %w", i+1, err))
+			continue
+		}
+		up++
+	}
+
+	return up, errors.Join(errs...)
+}
+
+// Len returns the number of replicas, whether they're up or not. A nil *Replicas has none.
+func (r *Replicas) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.dbs)
+}
+
+// Up returns the number of replicas which are up.
+func (r *Replicas) Up() int {
+	if r == nil {
+		return 0
+	}
+
+	up := 0
+	for i := range r.up {
+		if r.up[i].Load() {
+			up++
+		}
+	}
+	return up
+}
+
+// pick returns the next replica which is up, taking turns between them, or -1 if they're all down.
+func (r *Replicas) pick() int {
+	start := r.next.Add(1)
+	for n := range r.dbs {
+		i := int((start + uint64(n)) % uint64(len(r.dbs)))
+		if r.up[i].Load() {
+			return i
+		}
+	}
+	return -1
+}
+
+// read runs a query on a replica, or on the primary if they're all down. If the replica fails, the query is run again
+// on the primary. That includes not finding the record, since it might have been created too recently to have reached
+// the replica, as when somebody is redirected to a snippet they've just created.
+func (r *Replicas) read(primary DBTX, fn func(db DBTX) error) error {
+	i := -1
+	if r != nil {
+		i = r.pick()
+	}
+	if i < 0 {
+		return fn(primary)
+	}
+
+	err := fn(r.dbs[i])
+	if err == nil {
+		return nil
+	}
+
+	if KindOf(err) == KindUnavailable {
+		r.up[i].Store(false)
+	}
+
+	return fn(primary)
+}
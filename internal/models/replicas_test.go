@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+	"time"
+)
+
+func TestReplicas(t *testing.T) {
+	// Nothing listens on port 1, so the replica is never up when it's checked.
+	replica, err := sql.Open("mysql", "web:pass@tcp(127.0.0.1:1)/snippetbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	// The queries only record which database they were given, so the primary doesn't have to be a real one.
+	primary := &sql.DB{}
+
+	var used []DBTX
+	query := func(fail error) func(db DBTX) error {
+		return func(db DBTX) error {
+			used = append(used, db)
+			if db == replica {
+				return fail
+			}
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name     string
+		replicas *Replicas
+		up       bool
+		fail     error
+		want     []DBTX
+		wantUp   int
+	}{
+		{
+			name:     "No replicas",
+			replicas: nil,
+			want:     []DBTX{primary},
+		},
+		{
+			name:     "All down",
+			replicas: NewReplicas([]*sql.DB{replica}, time.Second),
+			want:     []DBTX{primary},
+		},
+		{
+			name:     "Up",
+			replicas: NewReplicas([]*sql.DB{replica}, time.Second),
+			up:       true,
+			want:     []DBTX{replica},
+			wantUp:   1,
+		},
+		{
+			name:     "Not on the replica yet",
+			replicas: NewReplicas([]*sql.DB{replica}, time.Second),
+			up:       true,
+			fail:     ErrNoRecord,
+			want:     []DBTX{replica, primary},
+			wantUp:   1,
+		},
+		{
+			name:     "Unreachable",
+			replicas: NewReplicas([]*sql.DB{replica}, time.Second),
+			up:       true,
+			fail:     driver.ErrBadConn,
+			want:     []DBTX{replica, primary},
+			wantUp:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.up {
+				tt.replicas.up[0].Store(true)
+			}
+
+			used = nil
+			err := tt.replicas.read(primary, query(tt.fail))
+			asserts.NilError(t, err)
+
+			asserts.Equal(t, len(used), len(tt.want))
+			for i := range used {
+				asserts.Equal(t, used[i], tt.want[i])
+			}
+			asserts.Equal(t, tt.replicas.Up(), tt.wantUp)
+		})
+	}
+
+	t.Run("Check", func(t *testing.T) {
+		replicas := NewReplicas([]*sql.DB{replica}, time.Second)
+		replicas.up[0].Store(true)
+
+		up, err := replicas.Check()
+		asserts.Equal(t, up, 0)
+		if err == nil {
+			t.Error("got no error for a replica which is down")
+		}
+		asserts.Equal(t, replicas.Up(), 0)
+	})
+}
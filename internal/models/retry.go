@@ -0,0 +1,129 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// A statement which fails for one of these reasons might well work if it's run again a moment later, so it's retried
+// rather than turned into a 500 for the user.
+const (
+	RetryDeadlock        = "deadlock"
+	RetryLockWaitTimeout = "lock_wait_timeout"
+	RetryConnection      = "connection"
+)
+
+// RetryReasons lists the reasons that retries are counted under.
+var RetryReasons = []string{RetryDeadlock, RetryLockWaitTimeout, RetryConnection}
+
+// An operation is tried up to retryAttempts times. The delays between attempts double from retryBaseDelay up to
+// retryMaxDelay, and each one is picked at random up to that ("full jitter"), so that the transactions which deadlocked
+// with each other don't all come back at the same moment and deadlock again.
+const (
+	retryAttempts  = 3
+	retryBaseDelay = 20 * time.Millisecond
+	retryMaxDelay  = 500 * time.Millisecond
+)
+
+// RetryStats counts the retries since the application started, across every model.
+type RetryStats struct {
+	// Retries counts the attempts which were made again, by reason.
+	Retries map[string]int64
+	// Exhausted counts the operations which still failed for a transient reason after the last attempt.
+	Exhausted int64
+}
+
+var (
+	retryMu    sync.Mutex
+	retryStats = RetryStats{Retries: make(map[string]int64)}
+)
+
+// Retries returns a copy of the retry counts.
+func Retries() RetryStats {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	stats := RetryStats{Retries: make(map[string]int64, len(RetryReasons)), Exhausted: retryStats.Exhausted}
+	for _, reason := range RetryReasons {
+		stats.Retries[reason] = retryStats.Retries[reason]
+	}
+	return stats
+}
+
+// transient reports why err might go away if the statement is run again, or "" if it won't.
+//
+// A connection error is only transient when it's driver.ErrBadConn, which the driver returns when nothing was sent to
+// the server. Other connection errors (like mysql.ErrInvalidConn, or the connection being reset) can come back from
+// Commit after the server has committed, and running the transaction again would then do everything twice.
+func transient(err error) string {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		switch mySQLError.Number {
+		case 1213:
+			return RetryDeadlock
+		case 1205:
+			return RetryLockWaitTimeout
+		}
+	}
+
+	if errors.Is(err, driver.ErrBadConn) {
+		return RetryConnection
+	}
+
+	return ""
+}
+
+// retry calls fn, and calls it again after a short, growing delay if it fails for a transient reason. Each call must
+// start again from scratch, which is why it's used around whole transactions: MySQL rolls back the transaction which
+// loses a deadlock, so running its last statement again wouldn't be enough.
+//
+// When db is already a transaction (because the model came from WithTx), fn is only called once, and retrying the
+// whole transaction is left to WithTx.
+func retry(db DBTX, fn func() error) error {
+	_, err := retryValue(db, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+// retryValue is retry for functions which return a value as well.
+func retryValue[T any](db DBTX, fn func() (T, error)) (T, error) {
+	if _, ok := db.(*sql.DB); !ok {
+		return fn()
+	}
+
+	for attempt := 1; ; attempt++ {
+		value, err := fn()
+		reason := transient(err)
+		if reason == "" || !countRetry(reason, attempt) {
+			return value, err
+		}
+
+		time.Sleep(retryDelay(attempt))
+	}
+}
+
+// countRetry counts a transient failure of the attempt, and reports whether there's another attempt to come.
+func countRetry(reason string, attempt int) bool {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	if attempt == retryAttempts {
+		retryStats.Exhausted++
+		return false
+	}
+
+	retryStats.Retries[reason]++
+	return true
+}
+
+// retryDelay returns how long to wait after the attempt failed.
+func retryDelay(attempt int) time.Duration {
+	ceiling := min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+	return rand.N(ceiling) + 1
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"github.com/go-sql-driver/mysql"
+	"testing"
+)
+
+func TestRetry(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+	tests := []struct {
+		name      string
+		db        DBTX
+		errs      []error
+		wantCalls int
+		wantErr   error
+		retries   map[string]int64
+		exhausted int64
+	}{
+		{
+			name:      "Success",
+			db:        (*sql.DB)(nil),
+			errs:      []error{nil},
+			wantCalls: 1,
+		},
+		{
+			name:      "Deadlock then success",
+			db:        (*sql.DB)(nil),
+			errs:      []error{fmt.Errorf("insert: %w", deadlock), nil},
+			wantCalls: 2,
+			retries:   map[string]int64{RetryDeadlock: 1},
+		},
+		{
+			name:      "Lock wait timeout and bad connection",
+			db:        (*sql.DB)(nil),
+			errs:      []error{&mysql.MySQLError{Number: 1205}, driver.ErrBadConn, nil},
+			wantCalls: 3,
+			retries:   map[string]int64{RetryLockWaitTimeout: 1, RetryConnection: 1},
+		},
+		{
+			name:      "Gives up",
+			db:        (*sql.DB)(nil),
+			errs:      []error{deadlock, deadlock, deadlock, nil},
+			wantCalls: 3,
+			wantErr:   deadlock,
+			retries:   map[string]int64{RetryDeadlock: 2},
+			exhausted: 1,
+		},
+		{
+			// The connection can be lost after the server has run the statement, so it isn't run again.
+			name:      "Lost connection",
+			db:        (*sql.DB)(nil),
+			errs:      []error{fmt.Errorf("insert: %w", mysql.ErrInvalidConn), nil},
+			wantCalls: 1,
+			wantErr:   mysql.ErrInvalidConn,
+		},
+		{
+			name:      "Not transient",
+			db:        (*sql.DB)(nil),
+			errs:      []error{ErrNoRecord, nil},
+			wantCalls: 1,
+			wantErr:   ErrNoRecord,
+		},
+		{
+			name:      "Inside a transaction",
+			db:        &sql.Tx{},
+			errs:      []error{deadlock, nil},
+			wantCalls: 1,
+			wantErr:   deadlock,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := Retries()
+
+			calls := 0
+			err := retry(tt.db, func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+
+			asserts.Equal(t, calls, tt.wantCalls)
+			asserts.Equal(t, errors.Is(err, tt.wantErr), true)
+
+			after := Retries()
+			for _, reason := range RetryReasons {
+				asserts.Equal(t, after.Retries[reason]-before.Retries[reason], tt.retries[reason])
+			}
+			asserts.Equal(t, after.Exhausted-before.Exhausted, tt.exhausted)
+		})
+	}
+}
+
+// commitFailsDriver is a database driver whose transactions all fail to commit with mysql.ErrInvalidConn, as they do
+// when the connection drops after the server has received the COMMIT, and may have run it.
+type commitFailsDriver struct{}
+
+func (commitFailsDriver) Open(name string) (driver.Conn, error) { return commitFailsConn{}, nil }
+
+type commitFailsConn struct{}
+
+func (commitFailsConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("commitFailsConn: statements aren't supported")
+}
+func (commitFailsConn) Close() error              { return nil }
+func (commitFailsConn) Begin() (driver.Tx, error) { return commitFailsTx{}, nil }
+
+type commitFailsTx struct{}
+
+func (commitFailsTx) Commit() error   { return mysql.ErrInvalidConn }
+func (commitFailsTx) Rollback() error { return nil }
+
+func init() {
+	sql.Register("commitfails", commitFailsDriver{})
+}
+
+func TestRetryCommitFailure(t *testing.T) {
+	db, err := sql.Open("commitfails", "")
+	asserts.NilError(t, err)
+	defer db.Close()
+
+	calls := 0
+	err = retry(db, func() error {
+		calls++
+
+		tx, err := begin(db)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		return tx.Commit()
+	})
+
+	asserts.Equal(t, errors.Is(err, mysql.ErrInvalidConn), true)
+	asserts.Equal(t, calls, 1)
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+)
+
+// SchemaVersion is the migration that this version of the code needs the database to be at. It has to be bumped along
+// with each new migration.
+const SchemaVersion = 31
+
+type SchemaModelInterface interface {
+	Version() (int, bool, error)
+}
+
+// SchemaModel reads the state of the database schema, as recorded in the schema_migrations table by the migrate tool
+// when the files in the migrations directory are applied.
+type SchemaModel struct {
+	DB *sql.DB
+}
+
+// Version returns the number of the last migration that was applied, and whether it failed part way through (which
+// migrate calls "dirty"). If migrations have never been run with the migrate tool, ErrNoRecord is returned.
+func (m *SchemaModel) Version() (int, bool, error) {
+	var version int
+	var dirty bool
+
+	err := m.DB.QueryRow(`SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		// MySQL error 1146 means that the table doesn't exist.
+		var mySQLError *mysql.MySQLError
+		if errors.Is(err, sql.ErrNoRows) || (errors.As(err, &mySQLError) && mySQLError.Number == 1146) {
+			return 0, false, ErrNoRecord
+		}
+		return 0, false, err
+	}
+
+	return version, dirty, nil
+}
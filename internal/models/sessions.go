@@ -0,0 +1,92 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+type SessionModelInterface interface {
+	Touch(token string, userID int, userAgent, ip string) error
+	AllForUser(userID int) ([]*Session, error)
+	Delete(token string) error
+}
+
+// Session describes one of the places where a user is logged in. Token is the session manager's token, which must never be
+// shown on a page, because it's as good as the user's password. ID is derived from it, and is safe to show.
+// UserAgent and IP are from the most recent request that used the session.
+type Session struct {
+	ID        string
+	Token     string
+	UserID    int
+	UserAgent string
+	IP        string
+	Created   time.Time
+	LastSeen  time.Time
+}
+
+// SessionID returns the public ID of the session with the given token. It's a truncated hash, so the token can't be worked
+// out from it.
+func SessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SessionModel wraps a database connection pool and is used to manage the user_sessions table. That table is only an index
+// of the session manager's sessions by user: a row can outlive its session (when the session expires, or the user logs out),
+// so callers should check that the session still exists before trusting a row, and delete the ones that don't.
+type SessionModel struct {
+	DB DBTX
+}
+
+// Touch records that the session with the given token was used by the user just now, from the given user agent and IP address.
+func (m *SessionModel) Touch(token string, userID int, userAgent, ip string) error {
+	// The column only has room for 255 characters, and a user agent can be any length.
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	stmt := `INSERT INTO user_sessions (token, user_id, user_agent, ip, created, last_seen)
+    VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())
+    ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), user_agent = VALUES(user_agent), ip = VALUES(ip), last_seen = VALUES(last_seen)`
+
+	_, err := m.DB.Exec(stmt, token, userID, userAgent, ip)
+	return err
+}
+
+// AllForUser returns the user's sessions, most recently used first.
+func (m *SessionModel) AllForUser(userID int) ([]*Session, error) {
+	stmt := `SELECT token, user_id, user_agent, ip, created, last_seen FROM user_sessions WHERE user_id = ? ORDER BY last_seen DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		s := &Session{}
+
+		err = rows.Scan(&s.Token, &s.UserID, &s.UserAgent, &s.IP, &s.Created, &s.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+
+		s.ID = SessionID(s.Token)
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Delete removes the session with the given token from the index. It doesn't destroy the session itself.
+func (m *SessionModel) Delete(token string) error {
+	_, err := m.DB.Exec(`DELETE FROM user_sessions WHERE token = ?`, token)
+	return err
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The names of the rows in the settings table.
+const (
+	settingSiteName                  = "site_name"
+	settingSignupEnabled             = "signup_enabled"
+	settingDefaultExpiry             = "default_expiry"
+	settingMaintenance               = "maintenance"
+	settingBlockDisposableEmails     = "block_disposable_emails"
+	settingFailedLoginAlertThreshold = "failed_login_alert_threshold"
+	settingServerErrorAlertThreshold = "server_error_alert_threshold"
+	settingHomeSections              = "home_sections"
+	settingHomeAnnouncementTitle     = "home_announcement_title"
+	settingHomeAnnouncementText      = "home_announcement_text"
+	settingHomeCurated               = "home_curated"
+)
+
+// SiteSettings are the settings which admins can change for the whole site while it's running.
+type SiteSettings struct {
+	// SiteName is shown in the header and page titles.
+	SiteName string
+	// SignupEnabled lets new users sign up. Existing users can log in either way.
+	SignupEnabled bool
+	// DefaultExpiry is the number of days that the create form picks for a new snippet (1, 7 or 365).
+	DefaultExpiry int
+	// Maintenance shows everybody except admins a "down for maintenance" page.
+	Maintenance bool
+	// BlockDisposableEmails turns away signups from disposable email addresses.
+	BlockDisposableEmails bool
+	// FailedLoginAlertThreshold and ServerErrorAlertThreshold are the number of events in an alert window which trigger
+	// an email to the admins. Zero turns that alert off.
+	FailedLoginAlertThreshold int
+	ServerErrorAlertThreshold int
+	// HomeSections holds the names of the sections that the home page shows to anonymous visitors, in order. The
+	// announcement section shows HomeAnnouncementTitle and HomeAnnouncementText, and the curated one shows the snippets
+	// with the public IDs in HomeCurated.
+	HomeSections          []string
+	HomeAnnouncementTitle string
+	HomeAnnouncementText  string
+	HomeCurated           []string
+	// Updated is when a setting was last changed, or the zero time if they've never been.
+	Updated time.Time
+}
+
+// DefaultSiteSettings are the settings until an admin changes them, unless the SettingsModel is given others.
+var DefaultSiteSettings = SiteSettings{
+	SiteName:                  "Snippetbox",
+	SignupEnabled:             true,
+	DefaultExpiry:             365,
+	BlockDisposableEmails:     true,
+	FailedLoginAlertThreshold: 20,
+	ServerErrorAlertThreshold: 10,
+	HomeSections:              []string{"latest"},
+}
+
+type SettingsModelInterface interface {
+	Get() (SiteSettings, error)
+	Update(settings SiteSettings, userID int) error
+	SetMaintenance(enabled bool, userID int) error
+}
+
+// SettingsModel wraps a database connection pool and is used to manage the settings table, which has a row for each
+// site-wide setting that has been changed from its default. Defaults are the settings without a row, like the ones from
+// the configuration. When it's nil, DefaultSiteSettings are used.
+type SettingsModel struct {
+	DB       DBTX
+	Defaults *SiteSettings
+}
+
+// Get returns the site settings. A setting without a row (or whose value can't be parsed, which would need somebody to
+// have edited the table by hand) has its default value.
+func (m *SettingsModel) Get() (SiteSettings, error) {
+	rows, err := m.DB.Query(`SELECT name, value, updated FROM settings`)
+	if err != nil {
+		return SiteSettings{}, err
+	}
+	defer rows.Close()
+
+	s := DefaultSiteSettings
+	if m.Defaults != nil {
+		s = *m.Defaults
+	}
+
+	for rows.Next() {
+		var name, value string
+		var updated time.Time
+		err = rows.Scan(&name, &value, &updated)
+		if err != nil {
+			return SiteSettings{}, err
+		}
+
+		switch name {
+		case settingSiteName:
+			s.SiteName = value
+		case settingSignupEnabled:
+			parseBool(value, &s.SignupEnabled)
+		case settingDefaultExpiry:
+			parseInt(value, &s.DefaultExpiry)
+		case settingMaintenance:
+			parseBool(value, &s.Maintenance)
+		case settingBlockDisposableEmails:
+			parseBool(value, &s.BlockDisposableEmails)
+		case settingFailedLoginAlertThreshold:
+			parseInt(value, &s.FailedLoginAlertThreshold)
+		case settingServerErrorAlertThreshold:
+			parseInt(value, &s.ServerErrorAlertThreshold)
+		case settingHomeSections:
+			s.HomeSections = strings.Fields(value)
+		case settingHomeAnnouncementTitle:
+			s.HomeAnnouncementTitle = value
+		case settingHomeAnnouncementText:
+			s.HomeAnnouncementText = value
+		case settingHomeCurated:
+			s.HomeCurated = strings.Fields(value)
+		}
+
+		if updated.After(s.Updated) {
+			s.Updated = updated
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return SiteSettings{}, err
+	}
+
+	return s, nil
+}
+
+// Update saves the site settings, recording which user changed them. They're saved in one transaction, so nobody sees
+// half of a change. Maintenance mode isn't saved, because it's switched on and off on its own with SetMaintenance, and
+// saving a copy of the settings from before it was switched would undo that.
+func (m *SettingsModel) Update(s SiteSettings, userID int) error {
+	values := map[string]string{
+		settingSiteName:                  s.SiteName,
+		settingSignupEnabled:             strconv.FormatBool(s.SignupEnabled),
+		settingDefaultExpiry:             strconv.Itoa(s.DefaultExpiry),
+		settingBlockDisposableEmails:     strconv.FormatBool(s.BlockDisposableEmails),
+		settingFailedLoginAlertThreshold: strconv.Itoa(s.FailedLoginAlertThreshold),
+		settingServerErrorAlertThreshold: strconv.Itoa(s.ServerErrorAlertThreshold),
+		settingHomeSections:              strings.Join(s.HomeSections, " "),
+		settingHomeAnnouncementTitle:     s.HomeAnnouncementTitle,
+		settingHomeAnnouncementText:      s.HomeAnnouncementText,
+		settingHomeCurated:               strings.Join(s.HomeCurated, " "),
+	}
+
+	return retry(m.DB, func() error {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for name, value := range values {
+			err = setSetting(tx, name, value, userID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+}
+
+// SetMaintenance turns maintenance mode on or off, recording which user did it.
+func (m *SettingsModel) SetMaintenance(enabled bool, userID int) error {
+	return setSetting(m.DB, settingMaintenance, strconv.FormatBool(enabled), userID)
+}
+
+// setSetting saves the value of one setting, adding its row if it's still at the default.
+func setSetting(db DBTX, name, value string, userID int) error {
+	stmt := `INSERT INTO settings (name, value, updated, updated_by) VALUES (?, ?, UTC_TIMESTAMP(), ?)
+    ON DUPLICATE KEY UPDATE value = VALUES(value), updated = VALUES(updated), updated_by = VALUES(updated_by)`
+
+	_, err := db.Exec(stmt, name, value, userID)
+	return err
+}
+
+// parseBool sets *dst to the boolean in value, leaving it alone if value isn't one.
+func parseBool(value string, dst *bool) {
+	if b, err := strconv.ParseBool(value); err == nil {
+		*dst = b
+	}
+}
+
+// parseInt sets *dst to the integer in value, leaving it alone if value isn't one.
+func parseInt(value string, dst *int) {
+	if n, err := strconv.Atoi(value); err == nil {
+		*dst = n
+	}
+}
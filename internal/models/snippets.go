@@ -1,40 +1,108 @@
 package models
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/ids"
+	"strings"
 	"time"
 )
 
+// Define constants for the snippet visibility levels. Public snippets are listed on the home page and user profiles.
+// Unlisted snippets can only be found by somebody who has the link, and are kept out of search engines.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+)
+
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
+	Insert(userID int, title string, content string, expires int, visibility string) (string, error)
+	InsertMany(userID int, drafts []SnippetDraft, expires int, visibility string) ([]string, error)
 	Get(id int) (*Snippet, error)
-	Latest() ([]*Snippet, error)
+	GetByPublicID(publicID string) (*Snippet, error)
+	Latest(limit, offset int) ([]*Snippet, error)
+	LatestByUser(userID, limit, offset int) ([]*Snippet, error)
+	ListForUser(userID int, filter SnippetFilter) ([]*Snippet, int, error)
+	Import(userID int, title, content string, created, expires time.Time, visibility string) (string, error)
+	ImportMany(userID int, snippets []*Snippet) ([]string, error)
+	Export(userID int, fn func(s *Snippet, owner string) error) error
+	Disown(userID int, dryRun bool) (*Plan, error)
+	Usage(userID int, since time.Time) (total, recent int, err error)
+	Trending(limit int, since time.Time) ([]*Snippet, error)
+	Trash(publicID string, userID int) error
+	Restore(publicID string, userID int) error
+	Purge(publicID string, userID int) error
+	Trashed(userID int) ([]*Snippet, error)
+	PurgeTrash(before time.Time) ([]string, error)
+	PurgeExpired(before time.Time) (int, error)
+	FindByHash(hash string, userID int) (*Snippet, error)
 }
 
 // Snippet Define a snippet to hold the data for an individual.
 // Notice how the fields of the struct correspond to the fields of the struct correspond to the fields in our MySQL snippets
 // table?
+// UserID is the ID of the user who created the snippet, or 0 if it was created anonymously.
+// PublicID is the non-sequential identifier used in URLs. The numeric ID is only used internally.
+// Deleted is when the snippet was moved to the trash. It's only set by Trashed, because nothing else returns those snippets.
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID         int
+	PublicID   string
+	UserID     int
+	Title      string
+	Content    string
+	Created    time.Time
+	Expires    time.Time
+	Visibility string
+	Deleted    time.Time
 }
 
 // SnippetModel Define a SnippetModel type which wraps a sql.DB connection pool.
 // This will also include the below methods to interact with the data.
+// IDs generates the public identifiers for new snippets. If it's nil, ULIDs are used.
+// Replicas are read replicas for the methods which show snippets to visitors (Get, GetByPublicID, Latest, LatestByUser
+// and Trending). If it's nil, everything goes to DB. Everything else, like a user's own list of snippets, reads from DB,
+// so that it's never behind the changes they've just made.
 type SnippetModel struct {
-	DB *sql.DB
+	DB       DBTX
+	IDs      ids.Generator
+	Replicas *Replicas
+}
+
+// The statement which Insert and InsertMany use to add a snippet.
+const insertSnippetSQL = `INSERT INTO snippets (public_id, user_id, title, content, content_hash, created, expires, visibility) VALUES(?, NULLIF(?, 0), ?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), ?)`
+
+// ContentHash returns the hash which duplicate snippets share. The content is normalized first, so that snippets which
+// only differ in their line endings, trailing whitespace or surrounding blank lines count as the same.
+func ContentHash(content string) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+
+	sum := sha256.Sum256([]byte(strings.Trim(strings.Join(lines, "\n"), "\n")))
+	return hex.EncodeToString(sum[:])
 }
 
-// Insert This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// Insert This will insert a new snippet into the database, and return its public ID.
+func (m *SnippetModel) Insert(userID int, title string, content string, expires int, visibility string) (string, error) {
+	generator := m.IDs
+	if generator == nil {
+		generator = ids.ULID{}
+	}
+
+	publicID, err := generator.New()
+	if err != nil {
+		return "", err
+	}
+
 	// Writes the SQL statement we want to execute.
 	// The placeholder parameter syntax differs depending on your database. MySQL, SQL server and SQLite use the ? notation
 	// But the PostgresSQL uses the $N notation. Example: INSERT INTO ... VALUES($1, $2, $3...)
-	stmt := `INSERT INTO snippets (title, content, created, expires) VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	// A userID of 0 is stored as NULL, so that anonymous snippets don't reference a user.
+	stmt := insertSnippetSQL
 
 	// Use the Exec() method on the embedded connection pool to execute the statement.
 	// The first parameter is the SQL statement, followed by the method returns a sql.Result type, which contains some basic
@@ -43,59 +111,140 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 	// - It creates a new prepared statement on the database using the provided SQL statement.
 	// - Exec() passes the parameter values to the database. The database then executes the prepared statement.
 	// - It then closes (or deallocates) the prepared statement on the database.
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	_, err = m.DB.Exec(stmt, publicID, userID, title, content, ContentHash(content), expires, visibility)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 
-	// Use the LastInsertId() method on the result to get the ID of our newly inserted record in the snippets table.
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
+	// Return the public ID, which is what the new snippet's URL is built from.
+	return publicID, nil
+}
+
+// The SnippetDraft type holds a snippet which hasn't been saved yet, for InsertMany.
+type SnippetDraft struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// InsertMany adds several snippets at once, all with the same expiry and visibility, and returns their public IDs in the
+// same order as the drafts. They're inserted in one transaction, so either all of them are created or none are.
+func (m *SnippetModel) InsertMany(userID int, drafts []SnippetDraft, expires int, visibility string) ([]string, error) {
+	generator := m.IDs
+	if generator == nil {
+		generator = ids.ULID{}
 	}
 
-	// The ID returned has the type int64, so we convert it to an int type before returning
-	return int(id), nil
+	return retryValue(m.DB, func() ([]string, error) {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		publicIDs := make([]string, len(drafts))
+		for i, draft := range drafts {
+			publicIDs[i], err = generator.New()
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = tx.Exec(insertSnippetSQL, publicIDs[i], userID, draft.Title, draft.Content, ContentHash(draft.Content), expires, visibility)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return publicIDs, tx.Commit()
+	})
 }
 
 // Get This will return a specific snippet based on its id.
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	// Writes the SQL statement we want to execute.
-	stmt := `SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := `SELECT id, public_id, COALESCE(user_id, 0), title, content, created, expires, visibility FROM snippets WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND id = ?`
 
-	// Uses the QueryRow() method on the connection pool to execute our SQL statement
-	// Passing in the untrusted id variable as the value for the placeholder parameter.
-	// This returns a pointer to a sql.Row object which holds the result from the database
-	row := m.DB.QueryRow(stmt, id)
+	var s *Snippet
 
-	// Initialize a pointer to a new zeroed Snippet struct
-	s := &Snippet{}
+	// Reads go to a replica if there is one, falling back to the primary.
+	err := m.Replicas.read(m.DB, func(db DBTX) error {
+		// Uses the QueryRow() method on the connection pool to execute our SQL statement
+		// Passing in the untrusted id variable as the value for the placeholder parameter.
+		// This returns a pointer to a sql.Row object which holds the result from the database
+		row := db.QueryRow(stmt, id)
 
-	// Uses row.Scan() to copy the values from each field in sql.Row to the corresponding field in the Snippet struct.
-	// Arguments to row.Scan are *pointers* to the place you want to copy the data into, and the number of arguments must be exactly the same as the number of columns returned by your statement.
-	// Behind the scenes of rows.Scan() your driver will automatically convert the raw output from the SQL database to the required native Go Types.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
-	if err != nil {
+		// Initialize a pointer to a new zeroed Snippet struct
+		s = &Snippet{}
+
+		// Uses row.Scan() to copy the values from each field in sql.Row to the corresponding field in the Snippet struct.
+		// Arguments to row.Scan are *pointers* to the place you want to copy the data into, and the number of arguments must be exactly the same as the number of columns returned by your statement.
+		// Behind the scenes of rows.Scan() your driver will automatically convert the raw output from the SQL database to the required native Go Types.
+		err := row.Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility)
 		// If the query returns no rows, then row.Scan() will return a sql.ErrNoRows error. We use the errors.Is() function check for that error specifically, and return our own ErrNoRecord error instead.
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNoRecord
-		} else {
-			return nil, err
+			return fmt.Errorf("snippet %d: %w", id, ErrNoRecord)
 		}
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// If everything went OK then return the Snippet object
 	return s, nil
 }
 
-// Latest This will return the 10 most recently created snippets.
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	// Write the SQL statement we want to execute
-	stmt := `SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+// GetByPublicID returns a specific snippet based on its public ID.
+func (m *SnippetModel) GetByPublicID(publicID string) (*Snippet, error) {
+	stmt := `SELECT id, public_id, COALESCE(user_id, 0), title, content, created, expires, visibility FROM snippets WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND public_id = ?`
+
+	var s *Snippet
+
+	err := m.Replicas.read(m.DB, func(db DBTX) error {
+		s = &Snippet{}
+
+		err := db.QueryRow(stmt, publicID).Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("snippet %q: %w", publicID, ErrNoRecord)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Latest This will return a page of the most recently created snippets, newest first.
+func (m *SnippetModel) Latest(limit, offset int) ([]*Snippet, error) {
+	// Write the SQL statement we want to execute. Unlisted snippets are never included in listings.
+	stmt := `SELECT id, public_id, COALESCE(user_id, 0), title, content, created, expires, visibility FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND visibility = 'public' ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	return m.readSnippets(stmt, limit, offset)
+}
+
+// readSnippets runs a query for a list of snippets on a replica (or the primary, if they're all down).
+func (m *SnippetModel) readSnippets(stmt string, args ...any) ([]*Snippet, error) {
+	var snippets []*Snippet
+
+	err := m.Replicas.read(m.DB, func(db DBTX) error {
+		var err error
+		snippets, err = querySnippets(db, stmt, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
 
+// querySnippets runs a query which returns the usual columns for a list of snippets.
+func querySnippets(db DBTX, stmt string, args ...any) ([]*Snippet, error) {
 	// Use the Query() method on the connection pool to execute our SQL statement
 	// This returns a sql.Rows result set containing the result of our query.
-	rows, err := m.DB.Query(stmt)
+	rows, err := db.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -118,7 +267,7 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 		// Uses rows.Scan() to copy the values from each field in the row to the new Snippet object that we created.
 		// Again, the arguments to row.Scan() must be pointers to the place you want to copy the data into
 		// and the number of arguments must be exactly the same as the number of columns returned by your statement
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility)
 		if err != nil {
 			return nil, err
 		}
@@ -135,3 +284,357 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	// If everything went OK then return the Snippets slice
 	return snippets, nil
 }
+
+// LatestByUser returns a page of the unexpired, public snippets created by a specific user, newest first.
+func (m *SnippetModel) LatestByUser(userID, limit, offset int) ([]*Snippet, error) {
+	stmt := `SELECT id, public_id, user_id, title, content, created, expires, visibility FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND user_id = ? AND visibility = 'public'
+	ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	return m.readSnippets(stmt, userID, limit, offset)
+}
+
+// SnippetSorts are the orders that ListForUser can sort snippets in. Each sorts by that column, oldest (or A) first,
+// and the ones starting with "-" sort the other way around.
+var SnippetSorts = []string{"created", "-created", "expires", "-expires", "title", "-title"}
+
+// The ORDER BY clause for each of the SnippetSorts. Snippets which are the same are sorted by ID, so that pages are
+// stable. This is a fixed list so that the sort from the query string never goes into the SQL itself.
+var snippetSortClauses = map[string]string{
+	"created":  "created ASC, id ASC",
+	"-created": "created DESC, id DESC",
+	"expires":  "expires ASC, id ASC",
+	"-expires": "expires DESC, id DESC",
+	"title":    "title ASC, id ASC",
+	"-title":   "title DESC, id DESC",
+}
+
+// SnippetFilter picks a page of snippets for ListForUser. Sort is one of the SnippetSorts. If CreatedAfter is set,
+// only snippets created after then are included.
+type SnippetFilter struct {
+	Sort         string
+	CreatedAfter time.Time
+	Limit        int
+	Offset       int
+}
+
+// ListForUser returns a page of a user's unexpired snippets, unlisted ones included, along with how many snippets there
+// are on all the pages put together.
+func (m *SnippetModel) ListForUser(userID int, filter SnippetFilter) ([]*Snippet, int, error) {
+	orderBy, ok := snippetSortClauses[filter.Sort]
+	if !ok {
+		return nil, 0, ErrInvalidSort
+	}
+
+	where := `WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND user_id = ? AND created > ?`
+	createdAfter := filter.CreatedAfter.UTC()
+
+	var total int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM snippets `+where, userID, createdAfter).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stmt := `SELECT id, public_id, user_id, title, content, created, expires, visibility FROM snippets ` + where + `
+	ORDER BY ` + orderBy + ` LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, userID, createdAfter, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+
+		err = rows.Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility)
+		if err != nil {
+			return nil, 0, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, total, nil
+}
+
+// Trending returns the public snippets which have had the most reactions since the given time, most first. Snippets
+// without any reactions in that time aren't included.
+func (m *SnippetModel) Trending(limit int, since time.Time) ([]*Snippet, error) {
+	stmt := `SELECT s.id, s.public_id, COALESCE(s.user_id, 0), s.title, s.content, s.created, s.expires, s.visibility
+	FROM snippets s JOIN snippet_reactions r ON r.snippet_id = s.id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.deleted_at IS NULL AND s.visibility = 'public' AND r.created >= ?
+	GROUP BY s.id ORDER BY COUNT(*) DESC, s.id DESC LIMIT ?`
+
+	return m.readSnippets(stmt, since.UTC(), limit)
+}
+
+// Import adds a snippet that was exported from another instance. Unlike Insert, it keeps the snippet's original creation
+// and expiry times. It still gets a new public ID, because its old one might already be taken here.
+func (m *SnippetModel) Import(userID int, title, content string, created, expires time.Time, visibility string) (string, error) {
+	generator := m.IDs
+	if generator == nil {
+		generator = ids.ULID{}
+	}
+
+	publicID, err := generator.New()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = m.DB.Exec(importSnippetSQL, publicID, userID, title, content, ContentHash(content), created.UTC(), expires.UTC(), visibility)
+	if err != nil {
+		return "", err
+	}
+
+	return publicID, nil
+}
+
+// The statement which Import and ImportMany use to add a snippet with its original times.
+const importSnippetSQL = `INSERT INTO snippets (public_id, user_id, title, content, content_hash, created, expires, visibility) VALUES(?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?)`
+
+// ImportMany is like Import, but for several snippets at once, which are given their new public IDs in the same order.
+// Only the title, content, times and visibility of each snippet are used. They're inserted in one transaction, so
+// either all of them are imported or none are.
+func (m *SnippetModel) ImportMany(userID int, snippets []*Snippet) ([]string, error) {
+	generator := m.IDs
+	if generator == nil {
+		generator = ids.ULID{}
+	}
+
+	return retryValue(m.DB, func() ([]string, error) {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		publicIDs := make([]string, len(snippets))
+		for i, s := range snippets {
+			publicIDs[i], err = generator.New()
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = tx.Exec(importSnippetSQL, publicIDs[i], userID, s.Title, s.Content, ContentHash(s.Content), s.Created.UTC(), s.Expires.UTC(), s.Visibility)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return publicIDs, tx.Commit()
+	})
+}
+
+// Export calls fn for each unexpired snippet which isn't in the trash, oldest first, along with the username of its owner (or the empty string).
+// If userID isn't 0, only that user's snippets are included. The rows are streamed, so this works for any number of snippets,
+// but it holds a database connection until it returns, so fn shouldn't block for long.
+func (m *SnippetModel) Export(userID int, fn func(s *Snippet, owner string) error) error {
+	stmt := `SELECT s.id, s.public_id, COALESCE(s.user_id, 0), s.title, s.content, s.created, s.expires, s.visibility, COALESCE(u.username, '')
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.deleted_at IS NULL AND (? = 0 OR s.user_id = ?)
+	ORDER BY s.id`
+
+	rows, err := m.DB.Query(stmt, userID, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := &Snippet{}
+		var owner string
+
+		err = rows.Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility, &owner)
+		if err != nil {
+			return err
+		}
+
+		err = fn(s, owner)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Disown turns all of a user's snippets into anonymous ones, so that they're kept when the user is deleted. The plan lists
+// the snippets' public IDs. With dryRun set, nothing is changed, but the plan still says what would have been.
+func (m *SnippetModel) Disown(userID int, dryRun bool) (*Plan, error) {
+	return retryValue(m.DB, func() (*Plan, error) {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		ids, err := queryIDs(tx, `SELECT public_id FROM snippets WHERE user_id = ? ORDER BY id FOR UPDATE`, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		plan := &Plan{DryRun: dryRun}
+		plan.add(PlanUpdate, "snippets", len(ids), ids)
+
+		if dryRun {
+			return plan, nil
+		}
+
+		_, err = tx.Exec(`UPDATE snippets SET user_id = NULL WHERE user_id = ?`, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		return plan, tx.Commit()
+	})
+}
+
+// Usage counts a user's snippets for their quota. total is how many unexpired snippets they have outside the trash, and
+// recent is how many they've created since the given time, whether or not those have expired or been deleted since.
+func (m *SnippetModel) Usage(userID int, since time.Time) (total, recent int, err error) {
+	stmt := `SELECT COALESCE(SUM(expires > UTC_TIMESTAMP() AND deleted_at IS NULL), 0), COALESCE(SUM(created >= ?), 0) FROM snippets
+	WHERE user_id = ?`
+
+	err = m.DB.QueryRow(stmt, since.UTC(), userID).Scan(&total, &recent)
+	return total, recent, err
+}
+
+// Trash moves one of the user's snippets to the trash. It stays in the database, so it can be restored, but it's treated
+// as deleted everywhere else.
+func (m *SnippetModel) Trash(publicID string, userID int) error {
+	stmt := `UPDATE snippets SET deleted_at = UTC_TIMESTAMP() WHERE public_id = ? AND user_id = ? AND deleted_at IS NULL`
+
+	return m.execOne(fmt.Sprintf("snippet %q", publicID), stmt, publicID, userID)
+}
+
+// Restore takes one of the user's snippets back out of the trash.
+func (m *SnippetModel) Restore(publicID string, userID int) error {
+	stmt := `UPDATE snippets SET deleted_at = NULL WHERE public_id = ? AND user_id = ? AND deleted_at IS NOT NULL`
+
+	return m.execOne(fmt.Sprintf("trashed snippet %q", publicID), stmt, publicID, userID)
+}
+
+// Purge permanently deletes one of the user's snippets. Only snippets which are already in the trash can be purged.
+func (m *SnippetModel) Purge(publicID string, userID int) error {
+	stmt := `DELETE FROM snippets WHERE public_id = ? AND user_id = ? AND deleted_at IS NOT NULL`
+
+	return m.execOne(fmt.Sprintf("trashed snippet %q", publicID), stmt, publicID, userID)
+}
+
+// execOne runs a statement which should change exactly one snippet, and returns ErrNoRecord if it didn't change any.
+func (m *SnippetModel) execOne(what, stmt string, args ...any) error {
+	result, err := m.DB.Exec(stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("%s: %w", what, ErrNoRecord)
+	}
+
+	return nil
+}
+
+// Trashed returns the snippets in the user's trash, most recently deleted first. Expired snippets are included, so that
+// the user can still purge them.
+func (m *SnippetModel) Trashed(userID int) ([]*Snippet, error) {
+	stmt := `SELECT id, public_id, user_id, title, content, created, expires, visibility, deleted_at FROM snippets
+	WHERE user_id = ? AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+
+		err = rows.Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility, &s.Deleted)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// PurgeTrash permanently deletes every snippet which was moved to the trash before the given time, and returns their
+// public IDs.
+func (m *SnippetModel) PurgeTrash(before time.Time) ([]string, error) {
+	return retryValue(m.DB, func() ([]string, error) {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		ids, err := queryIDs(tx, `SELECT public_id FROM snippets WHERE deleted_at < ? ORDER BY id FOR UPDATE`, before.UTC())
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ids) == 0 {
+			return ids, nil
+		}
+
+		_, err = tx.Exec(`DELETE FROM snippets WHERE deleted_at < ?`, before.UTC())
+		if err != nil {
+			return nil, err
+		}
+
+		return ids, tx.Commit()
+	})
+}
+
+// PurgeExpired permanently deletes every snippet which expired before the given time, and returns how many there were.
+// Expired snippets are never shown, so this only frees up the space that they take.
+func (m *SnippetModel) PurgeExpired(before time.Time) (int, error) {
+	result, err := m.DB.Exec(`DELETE FROM snippets WHERE expires < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
+
+// FindByHash returns the most recent unexpired snippet whose content has the given hash, as made by ContentHash. Only
+// public snippets and the user's own are searched, so that it can't be used to find the links of unlisted ones.
+func (m *SnippetModel) FindByHash(hash string, userID int) (*Snippet, error) {
+	stmt := `SELECT id, public_id, COALESCE(user_id, 0), title, content, created, expires, visibility FROM snippets
+	WHERE content_hash = ? AND expires > UTC_TIMESTAMP() AND deleted_at IS NULL
+	AND (visibility = 'public' OR (? <> 0 AND user_id = ?))
+	ORDER BY id DESC LIMIT 1`
+
+	s := &Snippet{}
+
+	err := m.DB.QueryRow(stmt, hash, userID, userID).Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("snippet with hash %q: %w", hash, ErrNoRecord)
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	hash := ContentHash("func main() {\n\tfmt.Println(\"hi\")\n}")
+
+	tests := []struct {
+		name    string
+		content string
+		same    bool
+	}{
+		{name: "Identical", content: "func main() {\n\tfmt.Println(\"hi\")\n}", same: true},
+		{name: "Windows line endings", content: "func main() {\r\n\tfmt.Println(\"hi\")\r\n}", same: true},
+		{name: "Trailing whitespace", content: "func main() {  \n\tfmt.Println(\"hi\")\t\n}", same: true},
+		{name: "Surrounding blank lines", content: "\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n\n", same: true},
+		{name: "Different indentation", content: "func main() {\n    fmt.Println(\"hi\")\n}"},
+		{name: "Different content", content: "func main() {\n\tfmt.Println(\"bye\")\n}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asserts.Equal(t, ContentHash(tt.content) == hash, tt.same)
+		})
+	}
+
+	asserts.Equal(t, len(hash), 64)
+}
@@ -1,21 +1,228 @@
-CREATE TABLE snippets (
-    id INTEGER NOT NULL  PRIMARY KEY  AUTO_INCREMENT,
+CREATE TABLE users (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
     name VARCHAR(255) NOT NULL,
+    username VARCHAR(30) NULL,
     email VARCHAR(255) NOT NULL,
-    hashed_password CHAR(60) NOT NULL,
-    created DATETIME NOT NULL
+    normalized_email VARCHAR(255) NOT NULL,
+    hashed_password VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_secret VARCHAR(64) NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    locale VARCHAR(16) NOT NULL DEFAULT 'en-GB',
+    preferences_version INTEGER NOT NULL DEFAULT 1,
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    expires DATETIME NULL,
+    expiry_warned BOOLEAN NOT NULL DEFAULT FALSE,
+    must_enroll_2fa BOOLEAN NOT NULL DEFAULT FALSE
 );
 
-CREATE INDEX idx_snippets_created ON snippets(created)
+ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
+ALTER TABLE users ADD CONSTRAINT users_uc_username UNIQUE (username);
+ALTER TABLE users ADD CONSTRAINT users_uc_normalized_email UNIQUE (normalized_email);
+CREATE INDEX idx_users_expires ON users(expires);
 
-CREATE TABLE users (
+CREATE TABLE snippets (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
-    name VARCHAR(255) NOT NULL,
-    email VARCHAR(255) NOT NULL,
-    hashed_password CHAR(60) NOT NULL,
-    created DATETIME NOT NULL
+    public_id VARCHAR(32) NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    user_id INTEGER NULL,
+    visibility VARCHAR(16) NOT NULL DEFAULT 'public',
+    reactions_changed DATETIME NULL,
+    deleted_at DATETIME NULL,
+    content_hash CHAR(64) NULL,
+    CONSTRAINT snippets_uc_public_id UNIQUE (public_id),
+    CONSTRAINT snippets_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_user_created ON snippets(user_id, created);
+CREATE INDEX idx_snippets_deleted_at ON snippets(deleted_at);
+CREATE INDEX idx_snippets_content_hash ON snippets(content_hash);
+
+CREATE TABLE sessions (
+    token CHAR(43) PRIMARY KEY,
+    data BLOB NOT NULL,
+    expiry TIMESTAMP(6) NOT NULL
+);
+
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+
+CREATE TABLE email_changes (
+    token_hash BINARY(32) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    new_email VARCHAR(255) NOT NULL,
+    expiry DATETIME NOT NULL,
+    CONSTRAINT email_changes_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE tokens (
+    hash BINARY(32) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expiry DATETIME NOT NULL,
+    scope VARCHAR(32) NOT NULL,
+    CONSTRAINT tokens_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE recovery_codes (
+    user_id INTEGER NOT NULL,
+    hash BINARY(32) NOT NULL,
+    PRIMARY KEY (user_id, hash),
+    CONSTRAINT recovery_codes_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE remotes (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    base_url VARCHAR(255) NOT NULL,
+    token VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT remotes_uc_user_name UNIQUE (user_id, name),
+    CONSTRAINT remotes_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE snippet_mirrors (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    remote_name VARCHAR(50) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT snippet_mirrors_fk_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_sessions (
+    token CHAR(43) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+    CONSTRAINT user_sessions_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_sessions_user_idx ON user_sessions (user_id, last_seen);
+
+CREATE TABLE data_exports (
+    token_hash BINARY(32) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    archive LONGBLOB NOT NULL,
+    created DATETIME NOT NULL,
+    expiry DATETIME NOT NULL,
+    CONSTRAINT data_exports_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE snippet_reactions (
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    reaction VARCHAR(16) NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (snippet_id, user_id, reaction),
+    CONSTRAINT snippet_reactions_fk_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT snippet_reactions_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE notifications (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    detail VARCHAR(16) NOT NULL,
+    created DATETIME NOT NULL,
+    read_at DATETIME NULL,
+    CONSTRAINT notifications_uc_event UNIQUE (user_id, actor_id, snippet_id, kind, detail),
+    CONSTRAINT notifications_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT notifications_fk_actor FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT notifications_fk_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_idx ON notifications (user_id, read_at, created);
+
+CREATE TABLE user_email_preferences (
+    user_id INTEGER NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    PRIMARY KEY (user_id, kind),
+    CONSTRAINT user_email_preferences_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE follows (
+    follower_id INTEGER NOT NULL,
+    followed_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (follower_id, followed_id),
+    CONSTRAINT follows_fk_follower FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT follows_fk_followed FOREIGN KEY (followed_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX follows_followed_idx ON follows (followed_id);
+
+CREATE TABLE webhooks (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    url VARCHAR(255) NOT NULL,
+    secret CHAR(64) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT webhooks_uc_user_url UNIQUE (user_id, url),
+    CONSTRAINT webhooks_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE webhook_deliveries (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    webhook_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    snippet_public_id VARCHAR(32) NOT NULL,
+    attempt INTEGER NOT NULL,
+    status INTEGER NOT NULL,
+    error_message VARCHAR(255) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL,
+    CONSTRAINT webhook_deliveries_fk_webhook FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_created_idx ON webhook_deliveries (created);
+
+CREATE TABLE shared_drafts (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    public_id CHAR(26) NOT NULL,
+    user_id INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    revision INTEGER NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    updated DATETIME NOT NULL,
+    CONSTRAINT shared_drafts_uc_public_id UNIQUE (public_id),
+    CONSTRAINT shared_drafts_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE settings (
+    name VARCHAR(64) NOT NULL PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated DATETIME NOT NULL,
+    updated_by INTEGER NULL,
+    CONSTRAINT settings_fk_updated_by FOREIGN KEY (updated_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE announcements (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    text TEXT NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NULL,
+    created_by INTEGER NULL,
+    CONSTRAINT announcements_fk_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE impersonations (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    admin_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    started DATETIME NOT NULL,
+    stopped DATETIME NULL
 );
 
-ALTER TABLE users AND CONSTRAINT users_uc_email UNIQUE (email);
+INSERT INTO users (name, username, email, normalized_email, hashed_password, created) VALUES ('Alice Jones', 'alice', 'alice@example.com', 'alice@example.com', '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG', '2022-01-01 10:00:00');
 
-INSERT INTO users (name, email, hashed_password, created) VALUES ('Alice Jones', 'alice@example.com','$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG', '2022-01-01 10:00:00');
\ No newline at end of file
+INSERT INTO snippets (public_id, title, content, created, expires, user_id) VALUES ('AAAAAAAAAAAAAAAAAAAAAAAAAA', 'An old silent pond', 'An old silent pond...', '2022-01-01 10:00:00', '2099-01-01 10:00:00', 1);
@@ -1,3 +1,20 @@
+DROP TABLE impersonations;
+DROP TABLE announcements;
+DROP TABLE settings;
+DROP TABLE shared_drafts;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+DROP TABLE follows;
+DROP TABLE user_email_preferences;
+DROP TABLE notifications;
+DROP TABLE snippet_reactions;
+DROP TABLE data_exports;
+DROP TABLE user_sessions;
+DROP TABLE snippet_mirrors;
+DROP TABLE remotes;
+DROP TABLE recovery_codes;
+DROP TABLE tokens;
+DROP TABLE email_changes;
+DROP TABLE sessions;
+DROP TABLE snippets;
 DROP TABLE users;
-
-DROP TABLE snippets;
\ No newline at end of file
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Define constants for the token scopes.
+// A pairing token is a short, human-typeable code which a browser extension exchanges for an API token.
+// An API token authenticates requests to the JSON API.
+// An unsubscribe token goes in the links in notification emails, so that users can turn them off without logging in.
+// A refresh token is swapped for a new JWT access token (and a new refresh token) when the last one expires.
+const (
+	ScopePairing     = "pairing"
+	ScopeAPI         = "api"
+	ScopeUnsubscribe = "unsubscribe"
+	ScopeRefresh     = "refresh"
+)
+
+type TokenModelInterface interface {
+	New(userID int, ttl time.Duration, scope string) (*Token, error)
+	GetUserID(scope, plaintext string) (int, error)
+	Consume(scope, plaintext string) (int, error)
+	DeleteAllForUser(scope string, userID int) error
+}
+
+// Token holds the data for an individual token. The plaintext is only ever available when the token is first created,
+// because we only store a SHA-256 hash of it in the database.
+type Token struct {
+	Plaintext string
+	Hash      []byte
+	UserID    int
+	Expiry    time.Time
+	Scope     string
+}
+
+// TokenModel wraps a database connection pool and is used to manage the tokens table.
+type TokenModel struct {
+	DB DBTX
+}
+
+// New generates a token for the user with the given lifetime and scope, and inserts it into the tokens table.
+func (m *TokenModel) New(userID int, ttl time.Duration, scope string) (*Token, error) {
+	var plaintext string
+	var err error
+
+	// Pairing codes are typed in by hand, so they use a short code. Everything else gets the full 128 bits of entropy.
+	if scope == ScopePairing {
+		plaintext, err = generatePairingCode()
+	} else {
+		plaintext, err = generateToken()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	token := &Token{
+		Plaintext: plaintext,
+		Hash:      hash[:],
+		UserID:    userID,
+		Expiry:    time.Now().Add(ttl).UTC(),
+		Scope:     scope,
+	}
+
+	stmt := `INSERT INTO tokens (hash, user_id, expiry, scope) VALUES (?, ?, ?, ?)`
+
+	_, err = m.DB.Exec(stmt, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetUserID returns the ID of the user that an unexpired token with the given scope belongs to.
+func (m *TokenModel) GetUserID(scope, plaintext string) (int, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	stmt := `SELECT user_id FROM tokens WHERE hash = ? AND scope = ? AND expiry > UTC_TIMESTAMP()`
+
+	var userID int
+
+	err := m.DB.QueryRow(stmt, hash[:], scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// Consume works like GetUserID, but also deletes the token so that it can only ever be used once.
+// If two requests race to consume the same token, only the one which actually deletes the row succeeds.
+func (m *TokenModel) Consume(scope, plaintext string) (int, error) {
+	userID, err := m.GetUserID(scope, plaintext)
+	if err != nil {
+		return 0, err
+	}
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	result, err := m.DB.Exec(`DELETE FROM tokens WHERE hash = ? AND scope = ?`, hash[:], scope)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if rows == 0 {
+		return 0, ErrNoRecord
+	}
+
+	return userID, nil
+}
+
+// DeleteAllForUser deletes all tokens with a specific scope for a specific user.
+func (m *TokenModel) DeleteAllForUser(scope string, userID int) error {
+	stmt := `DELETE FROM tokens WHERE scope = ? AND user_id = ?`
+
+	_, err := m.DB.Exec(stmt, scope, userID)
+	return err
+}
+
+// The alphabet for pairing codes leaves out characters which are easily confused with each other (0/O, 1/I/L).
+const pairingAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// generatePairingCode returns an 8 character code from the pairing alphabet.
+func generatePairingCode() (string, error) {
+	return generateCode(8)
+}
+
+// generateCode returns a code of length n from the pairing alphabet.
+// Random bytes which would make some characters more likely than others (because 256 isn't a multiple of the alphabet length) are thrown away.
+func generateCode(n int) (string, error) {
+	limit := byte(256 - 256%len(pairingAlphabet))
+
+	var sb strings.Builder
+	b := make([]byte, 1)
+
+	for sb.Len() < n {
+		_, err := rand.Read(b)
+		if err != nil {
+			return "", err
+		}
+
+		if b[0] < limit {
+			sb.WriteByte(pairingAlphabet[int(b[0])%len(pairingAlphabet)])
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// NormalizePairingCode converts a pairing code as typed by a person (like "abcd-efgh ") to the form that was generated.
+func NormalizePairingCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
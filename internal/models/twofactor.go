@@ -0,0 +1,166 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// RecoveryCodeCount is the number of recovery codes a user is given when they turn on two-factor authentication.
+const RecoveryCodeCount = 10
+
+type TwoFactorModelInterface interface {
+	Secret(userID int) (string, error)
+	Enable(userID int, secret string) ([]string, error)
+	Disable(userID int) error
+	Recover(userID int, code string) error
+	RecoveryCodesLeft(userID int) (int, error)
+}
+
+// TwoFactorModel wraps a database connection pool and is used to manage TOTP secrets and recovery codes.
+// The TOTP secret has to be stored as it is, because it's needed to calculate the codes. Recovery codes are
+// only stored as SHA-256 hashes, like our other tokens.
+type TwoFactorModel struct {
+	DB DBTX
+}
+
+// Secret returns the user's TOTP secret, or an empty string if they haven't turned on two-factor authentication.
+func (m *TwoFactorModel) Secret(userID int) (string, error) {
+	var secret sql.NullString
+
+	err := m.DB.QueryRow(`SELECT totp_secret FROM users WHERE id = ?`, userID).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("two-factor secret for user %d: %w", userID, ErrNoRecord)
+		} else {
+			return "", err
+		}
+	}
+
+	return secret.String, nil
+}
+
+// Enable turns on two-factor authentication with the given secret, and returns a new set of recovery codes.
+// Any recovery codes from an earlier enrollment stop working. The plaintext codes are only available here. It also
+// clears the must_enroll_2fa flag set by Recover.
+func (m *TwoFactorModel) Enable(userID int, secret string) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateCode(10)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+
+	// Use a transaction, so that the user never ends up with a secret but no recovery codes (or the other way round).
+	return retryValue(m.DB, func() ([]string, error) {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`UPDATE users SET totp_secret = ?, must_enroll_2fa = FALSE WHERE id = ?`, secret, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, code := range codes {
+			hash := sha256.Sum256([]byte(code))
+
+			_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, hash) VALUES (?, ?)`, userID, hash[:])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return codes, nil
+	})
+}
+
+// Disable turns off two-factor authentication and deletes the user's recovery codes.
+func (m *TwoFactorModel) Disable(userID int) error {
+	return retry(m.DB, func() error {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`UPDATE users SET totp_secret = NULL WHERE id = ?`, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Recover uses up one of the user's recovery codes, for when they've lost their authenticator app. It turns two-factor
+// authentication off, deleting the rest of their recovery codes, and sets the must_enroll_2fa flag, so that they have to
+// set it up again (with a new secret and new recovery codes) before they can do anything else. It's all done in one
+// transaction, so a used code always leaves the flag set. If the code doesn't match any of the user's remaining codes,
+// ErrNoRecord is returned.
+func (m *TwoFactorModel) Recover(userID int, code string) error {
+	// Recovery codes are shown like pairing codes, in groups separated by a hyphen, so normalize them in the same way.
+	hash := sha256.Sum256([]byte(NormalizePairingCode(code)))
+
+	return retry(m.DB, func() error {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?`, userID, hash[:])
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNoRecord
+		}
+
+		_, err = tx.Exec(`UPDATE users SET totp_secret = NULL, must_enroll_2fa = TRUE WHERE id = ?`, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes the user has.
+func (m *TwoFactorModel) RecoveryCodesLeft(userID int) (int, error) {
+	var count int
+
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?`, userID).Scan(&count)
+	return count, err
+}
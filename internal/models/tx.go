@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx. The models take one of these rather than a *sql.DB, so that WithTx can
+// hand them a transaction, and several models' statements can be made atomic together.
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Queries holds the models which WithTx runs inside its transaction. More can be added as operations need them.
+type Queries struct {
+	Snippets     SnippetModelInterface
+	Users        UserModelInterface
+	SharedDrafts SharedDraftModelInterface
+}
+
+type TxModelInterface interface {
+	WithTx(ctx context.Context, fn func(q *Queries) error) error
+}
+
+// TxModel runs operations which span several models in one transaction. The models are copied for each transaction, so
+// they keep their other settings (like how snippet IDs are generated).
+type TxModel struct {
+	DB           *sql.DB
+	Snippets     *SnippetModel
+	Users        *UserModel
+	SharedDrafts *SharedDraftModel
+}
+
+// WithTx calls fn with models whose statements all run in one transaction. It's committed if fn returns nil, and rolled
+// back if fn returns an error (or the context is cancelled first), so fn must return any error it gets from the models,
+// rather than carrying on. If the transaction fails for a transient reason, like a deadlock, fn is called again with a
+// new one, so it should set the variables it shares with the caller rather than add to them.
+func (m *TxModel) WithTx(ctx context.Context, fn func(q *Queries) error) error {
+	return retry(m.DB, func() error {
+		return m.withTx(ctx, fn)
+	})
+}
+
+func (m *TxModel) withTx(ctx context.Context, fn func(q *Queries) error) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	snippets, users, drafts := *m.Snippets, *m.Users, *m.SharedDrafts
+	snippets.DB, users.DB, drafts.DB = tx, tx, tx
+	// Everything in the transaction has to see its own changes, so nothing is read from the replicas.
+	snippets.Replicas = nil
+
+	err = fn(&Queries{Snippets: &snippets, Users: &users, SharedDrafts: &drafts})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// modelTx is the transaction that a model's method uses for its own statements. When the model is already inside a
+// transaction (because it came from WithTx), the statements become part of that one instead, and committing or rolling
+// it back is left to WithTx.
+type modelTx struct {
+	DBTX
+	own *sql.Tx
+}
+
+// begin starts a transaction for a model's method, or carries on with the one that db already is.
+func begin(db DBTX) (*modelTx, error) {
+	pool, ok := db.(*sql.DB)
+	if !ok {
+		return &modelTx{DBTX: db}, nil
+	}
+
+	tx, err := pool.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &modelTx{DBTX: tx, own: tx}, nil
+}
+
+func (tx *modelTx) Commit() error {
+	if tx.own == nil {
+		return nil
+	}
+	return tx.own.Commit()
+}
+
+func (tx *modelTx) Rollback() error {
+	if tx.own == nil {
+		return nil
+	}
+	return tx.own.Rollback()
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	users := &UserModel{DB: db}
+	m := TxModel{DB: db, Snippets: &SnippetModel{DB: db}, Users: users, SharedDrafts: &SharedDraftModel{DB: db}}
+
+	t.Run("Rolled back", func(t *testing.T) {
+		errStop := errors.New("stop")
+
+		// Delete starts its own transaction when it's used on its own, but here it's part of the one from WithTx.
+		err := m.WithTx(context.Background(), func(q *Queries) error {
+			_, err := q.Users.Delete(1, false)
+			if err != nil {
+				return err
+			}
+			return errStop
+		})
+		asserts.Equal(t, err, errStop)
+
+		exists, err := users.Exists(1)
+		asserts.NilError(t, err)
+		asserts.Equal(t, exists, true)
+	})
+
+	t.Run("Committed", func(t *testing.T) {
+		err := m.WithTx(context.Background(), func(q *Queries) error {
+			_, err := q.Snippets.Disown(1, false)
+			if err != nil {
+				return err
+			}
+			_, err = q.Users.Delete(1, false)
+			return err
+		})
+		asserts.NilError(t, err)
+
+		exists, err := users.Exists(1)
+		asserts.NilError(t, err)
+		asserts.Equal(t, exists, false)
+	})
+}
@@ -3,61 +3,180 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/emailaddr"
+	"github.com/0xshiku/snippetbox/internal/hash"
 	"github.com/go-sql-driver/mysql"
-	"golang.org/x/crypto/bcrypt"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type UserModelInterface interface {
-	Insert(name, email, password string) error
+	Insert(name, username, email, password string) error
+	InsertAdmin(name, username, email, password string) error
+	InsertGuest(name, username, email, password string, expires time.Time) error
+	InsertExternal(name, username, email string) (int, error)
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
+	EmailTaken(email string, exceptID int) (bool, error)
+	UsernameTaken(username string, exceptID int) (bool, error)
 	Get(id int) (*User, error)
 	PasswordUpdate(id int, currentPassword, newPassword string) error
+	PasswordReset(id int, newPassword string) error
+	EmailUpdate(id int, newEmail string) error
+	GetByUsername(username string) (*User, error)
+	GetByEmail(email string) (*User, error)
+	ProfileUpdate(id int, name, username string) error
+	AdminEmails() ([]string, error)
+	PreferencesUpdate(id int, timezone, locale string) error
+	PreferencesUpdateIfMatch(id, version int, timezone, locale string) error
+	StatusUpdate(id int, status string) error
+	SetAdmin(id int, isAdmin bool) error
+	MakePermanent(id int) error
+	ExpiringGuests(before time.Time) ([]*User, error)
+	MarkExpiryWarned(id int) error
+	ExpiredGuests() ([]*User, error)
+	Delete(id int, dryRun bool) (*Plan, error)
 }
 
 // Define a new User type. Notice how the field names and types align with the columns in the database "users" table?
+// Username is empty for accounts created before usernames were introduced.
+// IsAdmin is true for users who can access the /admin pages.
+// Timezone (an IANA name like "Europe/London") and Locale (like "en-GB") control how dates are shown to the user.
+// PreferencesVersion goes up by one every time the preferences change.
+// Status is one of the UserStatus constants below.
+// Expires is when a guest account will be deleted. It's the zero time for ordinary accounts, which never expire.
 type User struct {
-	ID             int
-	Name           string
-	Email          string
-	HashedPassword []byte
-	Created        time.Time
+	ID                 int
+	Name               string
+	Username           string
+	Email              string
+	HashedPassword     []byte
+	Created            time.Time
+	IsAdmin            bool
+	Timezone           string
+	Locale             string
+	PreferencesVersion int
+	Status             string
+	Expires            time.Time
+	// MustEnrollTwoFactor is set when the user has logged in with a recovery code, until they set up two-factor
+	// authentication again.
+	MustEnrollTwoFactor bool
+}
+
+// IsGuest reports whether the user has a guest account, which will be deleted when it expires.
+func (u *User) IsGuest() bool {
+	return !u.Expires.IsZero()
+}
+
+// The statuses that an account can have. Suspended and banned users can't log in, and are logged out if they already are.
+// The difference is what it tells other admins: a suspension is expected to be lifted, a ban isn't. Either way the account
+// (and its email address and username) is kept, so the user can't simply sign up again with the same details.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+)
+
+// Blocked reports whether the user has been suspended or banned.
+func (u *User) Blocked() bool {
+	return u.Status == UserStatusSuspended || u.Status == UserStatusBanned
+}
+
+// statusError returns the error that Authenticate gives for a blocked account with the given status, or nil if it isn't blocked.
+func statusError(status string) error {
+	switch status {
+	case UserStatusSuspended:
+		return ErrAccountSuspended
+	case UserStatusBanned:
+		return ErrAccountBanned
+	default:
+		return nil
+	}
 }
 
 // Define a new UserModel type which wraps a database connection pool
+// Emails normalizes email addresses before they're checked for uniqueness, so that trivial variations of an
+// address (like different capitalization) can't be used to create duplicate accounts.
+// Passwords hashes new passwords and verifies existing ones. If it's nil, passwords are hashed with bcrypt at the default cost.
 type UserModel struct {
-	DB *sql.DB
+	DB        DBTX
+	Emails    emailaddr.Normalizer
+	Passwords *hash.Set
+}
+
+// defaultPasswords is used when UserModel.Passwords isn't set.
+var defaultPasswords = hash.NewSet(hash.Bcrypt{Cost: hash.DefaultBcryptCost})
+
+// passwords returns the hasher set for new and existing password hashes.
+func (m *UserModel) passwords() *hash.Set {
+	if m.Passwords == nil {
+		return defaultPasswords
+	}
+	return m.Passwords
 }
 
 // We'll use the Insert method to add a new record to the "users" table.
-func (m *UserModel) Insert(name, email, password string) error {
-	// Create a bcrypt hash of the plain-text password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+func (m *UserModel) Insert(name, username, email, password string) error {
+	_, err := m.insert(name, username, email, password, false, sql.NullTime{})
+	return err
+}
+
+// InsertAdmin adds a user who can access the /admin pages. They're made an admin by the same statement that adds them,
+// so a failure can't leave behind an account which was meant to be an admin but isn't.
+func (m *UserModel) InsertAdmin(name, username, email, password string) error {
+	_, err := m.insert(name, username, email, password, true, sql.NullTime{})
+	return err
+}
+
+// InsertGuest adds a guest account, which is deleted (by the guest expiry job) once the expiry time has passed.
+func (m *UserModel) InsertGuest(name, username, email, password string, expires time.Time) error {
+	_, err := m.insert(name, username, email, password, false, sql.NullTime{Time: expires.UTC(), Valid: true})
+	return err
+}
+
+// InsertExternal adds an account for somebody who logs in with an external identity provider, and returns its ID. The
+// account gets a random password which nobody knows, so it can only be logged into through the provider.
+func (m *UserModel) InsertExternal(name, username, email string) (int, error) {
+	password, err := generateToken()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+	return m.insert(name, username, email, password, false, sql.NullTime{})
+}
+
+func (m *UserModel) insert(name, username, email, password string, isAdmin bool, expires sql.NullTime) (int, error) {
+	// Create a hash of the plain-text password, with whichever algorithm is current
+	hashedPassword, err := m.passwords().Hash(password)
+	if err != nil {
+		return 0, err
+	}
+
+	// The address is stored as the user typed it, for sending emails to, along with its normalized form.
+	// The unique constraint is on the normalized form.
+	stmt := `INSERT INTO users (name, username, email, normalized_email, hashed_password, is_admin, created, expires) VALUES (?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), ?)`
 
 	// Use the Exec() method to insert the user details and hashed password into the users table
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
-	if err != nil {
-		// If this returns an error, we use the errors.As() function to check whether the error has the type *mysql.MySQLError.
-		// If it does, the error will be assigned to the mySQLError variable.
-		// We can then check whether the error relates to our users_uc_email key by checking if the error code equals 1062 and the contents of the error message string.
-		// If it does, we return an ErrDuplicateEmail Error
-		var mySQLError *mysql.MySQLError
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "user_uc_email") {
-				return ErrDuplicateEmail
-			}
+	result, err := m.DB.Exec(stmt, name, username, email, m.Emails.Normalize(email), hashedPassword, isAdmin, expires)
+	if err != nil {
+		// If the error relates to our users_uc_email or users_uc_username keys, we return the matching error
+		if isDuplicateEmail(err) {
+			return 0, ErrDuplicateEmail
 		}
-		return err
+		if isDuplicateUsername(err) {
+			return 0, ErrDuplicateUsername
+		}
+		return 0, err
 	}
 
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
 }
 
 // We'll use the Authenticate method to verify whether a user exists with the provided email address and password.
@@ -66,11 +185,12 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	// Retrieve the id and hashed password associated with given email
 	// If no matching email exists return the ErrInvalidCredentials error.
 	var id int
-	var hashedPassword []byte
+	var hashedPassword, status string
 
-	stmt := "SELECT id, hashed_password FROM users WHERE email = ?"
+	// Look the user up by the normalized address, so that they can log in with any variation of it.
+	stmt := "SELECT id, hashed_password, status FROM users WHERE normalized_email = ?"
 
-	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	err := m.DB.QueryRow(stmt, m.Emails.Normalize(email)).Scan(&id, &hashedPassword, &status)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -81,19 +201,46 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 
 	// Check whether, the hashed password and plain-text password provided match.
 	// If they don't, we return the ErrInvalidCredentials error.
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	// The hash is tagged with the algorithm that made it, so bcrypt hashes still work after switching to Argon2id.
+	needsRehash, err := m.passwords().Verify(hashedPassword, password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		if errors.Is(err, hash.ErrMismatch) {
 			return 0, ErrInvalidCredentials
 		} else {
 			return 0, err
 		}
 	}
 
+	// The account status is only checked once the password is known to be right, so that it can't be used to find out
+	// whether somebody has been suspended or banned.
+	if err := statusError(status); err != nil {
+		return 0, err
+	}
+
+	// The password is correct, so this is our one chance to upgrade a hash made with another algorithm, or weaker parameters,
+	// than we use now. That lets operators change them without making anybody reset their password.
+	if needsRehash {
+		m.rehash(id, hashedPassword, password)
+	}
+
 	// Otherwise, the password is correct. Return the user ID.
 	return id, nil
 }
 
+// rehash replaces the user's password hash with a new one, made with the current algorithm and parameters.
+// Any error is ignored, because the old hash still works and we'll try again at the next login. The UPDATE only applies if
+// the hash hasn't changed since it was read, so it can't undo a password change made in the meantime.
+func (m *UserModel) rehash(id int, hashedPassword, password string) {
+	newHashedPassword, err := m.passwords().Hash(password)
+	if err != nil {
+		return
+	}
+
+	stmt := "UPDATE users SET hashed_password = ? WHERE id = ? AND hashed_password = ?"
+
+	_, _ = m.DB.Exec(stmt, newHashedPassword, id, hashedPassword)
+}
+
 // We'll use the Exists method to check if a user exists with a specific ID.
 func (m *UserModel) Exists(id int) (bool, error) {
 	var exists bool
@@ -104,25 +251,51 @@ func (m *UserModel) Exists(id int) (bool, error) {
 	return exists, err
 }
 
+// EmailTaken checks whether another user has already registered the email address (or a trivial variation of it), so that
+// forms can say so before trying to insert it. The user with the ID exceptID doesn't count, which lets a user keep their own
+// address. Pass zero if there isn't a current user.
+func (m *UserModel) EmailTaken(email string, exceptID int) (bool, error) {
+	var taken bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE normalized_email = ? AND id <> ?)"
+
+	err := m.DB.QueryRow(stmt, m.Emails.Normalize(email), exceptID).Scan(&taken)
+	return taken, err
+}
+
+// UsernameTaken is like EmailTaken, but for usernames. The comparison uses the column's collation, the same as the
+// users_uc_username key does.
+func (m *UserModel) UsernameTaken(username string, exceptID int) (bool, error) {
+	var taken bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE username = ? AND id <> ?)"
+
+	err := m.DB.QueryRow(stmt, username, exceptID).Scan(&taken)
+	return taken, err
+}
+
 func (m *UserModel) Get(id int) (*User, error) {
 	var user User
+	var expires sql.NullTime
 
-	stmt := `SELECT id, name, email, created FROM users WHERE id = ?`
+	stmt := `SELECT id, name, COALESCE(username, ''), email, created, is_admin, timezone, locale, preferences_version, status, expires, must_enroll_2fa FROM users WHERE id = ?`
 
-	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created)
+	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Username, &user.Email, &user.Created, &user.IsAdmin, &user.Timezone, &user.Locale, &user.PreferencesVersion, &user.Status, &expires, &user.MustEnrollTwoFactor)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNoRecord
+			return nil, fmt.Errorf("user %d: %w", id, ErrNoRecord)
 		} else {
 			return nil, err
 		}
 	}
 
+	user.Expires = expires.Time
+
 	return &user, nil
 }
 
 func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
-	var currentHashedPassword []byte
+	var currentHashedPassword string
 
 	stmt := "SELECT hashed_password FROM users WHERE id = ?"
 
@@ -131,22 +304,396 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 		return err
 	}
 
-	err = bcrypt.CompareHashAndPassword(currentHashedPassword, []byte(currentPassword))
+	_, err = m.passwords().Verify(currentHashedPassword, currentPassword)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		if errors.Is(err, hash.ErrMismatch) {
 			return ErrInvalidCredentials
 		} else {
 			return err
 		}
 	}
 
-	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	newHashedPassword, err := m.passwords().Hash(newPassword)
 	if err != nil {
 		return err
 	}
 
 	stmt = "UPDATE users SET hashed_password = ? WHERE id = ?"
 
-	_, err = m.DB.Exec(stmt, string(newHashedPassword), id)
+	_, err = m.DB.Exec(stmt, newHashedPassword, id)
 	return err
 }
+
+// PasswordReset sets a new password for the user without checking their current one, for when they've lost it. Logging
+// them out of their existing sessions is up to the caller.
+func (m *UserModel) PasswordReset(id int, newPassword string) error {
+	hashedPassword, err := m.passwords().Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	result, err := m.DB.Exec("UPDATE users SET hashed_password = ? WHERE id = ?", hashedPassword, id)
+	if err != nil {
+		return err
+	}
+
+	return m.checkUpdated(id, result)
+}
+
+// EmailUpdate sets a new email address for the user. If the address is already used by another account, ErrDuplicateEmail is returned.
+func (m *UserModel) EmailUpdate(id int, newEmail string) error {
+	stmt := "UPDATE users SET email = ?, normalized_email = ? WHERE id = ?"
+
+	result, err := m.DB.Exec(stmt, newEmail, m.Emails.Normalize(newEmail), id)
+	if err != nil {
+		if isDuplicateEmail(err) {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("user %d: %w", id, ErrNoRecord)
+	}
+
+	return nil
+}
+
+// GetByUsername returns the user with the given username, for use on their public profile page.
+func (m *UserModel) GetByUsername(username string) (*User, error) {
+	var user User
+
+	stmt := `SELECT id, name, username, email, created, status FROM users WHERE username = ?`
+
+	err := m.DB.QueryRow(stmt, username).Scan(&user.ID, &user.Name, &user.Username, &user.Email, &user.Created, &user.Status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %q: %w", username, ErrNoRecord)
+		} else {
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// GetByEmail returns the user with the email address, or any variation of it which normalizes to the same address.
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	var user User
+	var expires sql.NullTime
+
+	stmt := `SELECT id, name, COALESCE(username, ''), email, created, is_admin, status, expires FROM users WHERE normalized_email = ?`
+
+	err := m.DB.QueryRow(stmt, m.Emails.Normalize(email)).Scan(&user.ID, &user.Name, &user.Username, &user.Email, &user.Created, &user.IsAdmin, &user.Status, &expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %q: %w", email, ErrNoRecord)
+		} else {
+			return nil, err
+		}
+	}
+
+	user.Expires = expires.Time
+
+	return &user, nil
+}
+
+// ProfileUpdate changes the display name and username of a user. If the username is already taken, ErrDuplicateUsername is returned.
+func (m *UserModel) ProfileUpdate(id int, name, username string) error {
+	stmt := "UPDATE users SET name = ?, username = ? WHERE id = ?"
+
+	_, err := m.DB.Exec(stmt, name, username, id)
+	if err != nil {
+		if isDuplicateUsername(err) {
+			return ErrDuplicateUsername
+		}
+		return err
+	}
+
+	return nil
+}
+
+// PreferencesUpdate changes the timezone and locale that dates are shown in for a user.
+func (m *UserModel) PreferencesUpdate(id int, timezone, locale string) error {
+	stmt := "UPDATE users SET timezone = ?, locale = ?, preferences_version = preferences_version + 1 WHERE id = ?"
+
+	_, err := m.DB.Exec(stmt, timezone, locale, id)
+	return err
+}
+
+// StatusUpdate changes whether a user can log in. The status must be one of the UserStatus constants, or ErrInvalidStatus
+// is returned. Logging the user out of their existing sessions is up to the caller.
+func (m *UserModel) StatusUpdate(id int, status string) error {
+	if status != UserStatusActive && statusError(status) == nil {
+		return ErrInvalidStatus
+	}
+
+	stmt := "UPDATE users SET status = ? WHERE id = ?"
+
+	result, err := m.DB.Exec(stmt, status, id)
+	if err != nil {
+		return err
+	}
+
+	return m.checkUpdated(id, result)
+}
+
+// SetAdmin gives the user access to the /admin pages, or takes it away.
+func (m *UserModel) SetAdmin(id int, isAdmin bool) error {
+	result, err := m.DB.Exec("UPDATE users SET is_admin = ? WHERE id = ?", isAdmin, id)
+	if err != nil {
+		return err
+	}
+
+	return m.checkUpdated(id, result)
+}
+
+// checkUpdated returns ErrNoRecord if an update didn't find the user. Setting a value that the user already has doesn't
+// affect any rows, so when none were, it checks whether they exist instead.
+func (m *UserModel) checkUpdated(id int, result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		exists, err := m.Exists(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("user %d: %w", id, ErrNoRecord)
+		}
+	}
+
+	return nil
+}
+
+// MakePermanent turns a guest account into an ordinary one, which never expires.
+func (m *UserModel) MakePermanent(id int) error {
+	stmt := "UPDATE users SET expires = NULL, expiry_warned = FALSE WHERE id = ?"
+
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+// ExpiringGuests returns the guests whose accounts expire before the given time, and who haven't been warned about it yet.
+func (m *UserModel) ExpiringGuests(before time.Time) ([]*User, error) {
+	return m.guests(`SELECT id, name, COALESCE(username, ''), email, created, expires FROM users
+	WHERE expires IS NOT NULL AND expires <= ? AND NOT expiry_warned ORDER BY expires`, before.UTC())
+}
+
+// MarkExpiryWarned records that the guest has been warned that their account will expire.
+func (m *UserModel) MarkExpiryWarned(id int) error {
+	stmt := "UPDATE users SET expiry_warned = TRUE WHERE id = ?"
+
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+// ExpiredGuests returns the guests whose accounts have expired, and are due to be deleted.
+func (m *UserModel) ExpiredGuests() ([]*User, error) {
+	return m.guests(`SELECT id, name, COALESCE(username, ''), email, created, expires FROM users
+	WHERE expires IS NOT NULL AND expires <= UTC_TIMESTAMP() ORDER BY expires`)
+}
+
+// guests runs a query for guest accounts, and scans the results.
+func (m *UserModel) guests(stmt string, args ...any) ([]*User, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		err = rows.Scan(&u.ID, &u.Name, &u.Username, &u.Email, &u.Created, &u.Expires)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// PreferencesUpdateIfMatch is like PreferencesUpdate, but only makes the change if the user's preferences are still at the
+// given version. Otherwise, somebody else has changed them in the meantime, and ErrEditConflict is returned.
+func (m *UserModel) PreferencesUpdateIfMatch(id, version int, timezone, locale string) error {
+	stmt := "UPDATE users SET timezone = ?, locale = ?, preferences_version = preferences_version + 1 WHERE id = ? AND preferences_version = ?"
+
+	result, err := m.DB.Exec(stmt, timezone, locale, id, version)
+	if err != nil {
+		return err
+	}
+
+	// The version always changes, so a matching row is always counted as affected.
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		exists, err := m.Exists(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// userCascades lists every table whose rows go with a user through ON DELETE CASCADE, either on the user themselves or on
+// one of their snippets or webhooks, along with the condition that picks out those rows. Each condition is given the
+// user's ID for every placeholder. A migration which adds a table like this must add it here too, or Delete's plan
+// undercounts; TestUserModelDeleteCascades checks the list against the schema.
+var userCascades = []struct {
+	table string
+	where string
+}{
+	{"tokens", "user_id = ?"},
+	{"email_changes", "user_id = ?"},
+	{"recovery_codes", "user_id = ?"},
+	{"remotes", "user_id = ?"},
+	{"snippet_mirrors", "snippet_id IN (SELECT id FROM snippets WHERE user_id = ?)"},
+	{"user_sessions", "user_id = ?"},
+	{"data_exports", "user_id = ?"},
+	{"snippet_reactions", "user_id = ? OR snippet_id IN (SELECT id FROM snippets WHERE user_id = ?)"},
+	{"notifications", "user_id = ? OR actor_id = ? OR snippet_id IN (SELECT id FROM snippets WHERE user_id = ?)"},
+	{"user_email_preferences", "user_id = ?"},
+	{"follows", "follower_id = ? OR followed_id = ?"},
+	{"webhooks", "user_id = ?"},
+	{"webhook_deliveries", "webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)"},
+	{"shared_drafts", "user_id = ?"},
+}
+
+// Delete permanently removes a user and everything that belongs to them. The rows in userCascades go through the
+// foreign keys' ON DELETE CASCADE, but their snippets have to be deleted explicitly, because
+// snippets_fk_user is ON DELETE SET NULL. It all happens in one transaction, so a failure part way through leaves the user intact.
+// The plan lists the public IDs of the user's snippets, so that cached copies of their pages can be purged.
+// With dryRun set, nothing is deleted, but the plan still says what would have been.
+func (m *UserModel) Delete(id int, dryRun bool) (*Plan, error) {
+	return retryValue(m.DB, func() (*Plan, error) {
+		tx, err := begin(m.DB)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		// Lock the user's row, so that nothing new can be added for them while we count.
+		var exists int
+		err = tx.QueryRow(`SELECT id FROM users WHERE id = ? FOR UPDATE`, id).Scan(&exists)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("user %d: %w", id, ErrNoRecord)
+			}
+			return nil, err
+		}
+
+		plan := &Plan{DryRun: dryRun}
+
+		snippetIDs, err := queryIDs(tx, `SELECT public_id FROM snippets WHERE user_id = ? ORDER BY id`, id)
+		if err != nil {
+			return nil, err
+		}
+		plan.add(PlanDelete, "snippets", len(snippetIDs), snippetIDs)
+
+		// These tables are cleared by the cascade, so they're only counted.
+		for _, c := range userCascades {
+			args := make([]any, strings.Count(c.where, "?"))
+			for i := range args {
+				args[i] = id
+			}
+
+			var n int
+			err = tx.QueryRow(`SELECT COUNT(*) FROM `+c.table+` WHERE `+c.where, args...).Scan(&n)
+			if err != nil {
+				return nil, err
+			}
+			plan.add(PlanDelete, c.table, n, nil)
+		}
+
+		plan.add(PlanDelete, "users", 1, []string{strconv.Itoa(id)})
+
+		if dryRun {
+			return plan, nil
+		}
+
+		_, err = tx.Exec(`DELETE FROM snippets WHERE user_id = ?`, id)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`DELETE FROM users WHERE id = ?`, id)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return plan, nil
+	})
+}
+
+// isDuplicateEmail uses the errors.As() function to check whether the error has the type *mysql.MySQLError.
+// If it does, we check whether the error relates to our users_uc_email or users_uc_normalized_email keys by checking if the error code equals 1062 and the contents of the error message string.
+func isDuplicateEmail(err error) bool {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number == 1062 && (strings.Contains(mySQLError.Message, "users_uc_email") || strings.Contains(mySQLError.Message, "users_uc_normalized_email"))
+	}
+	return false
+}
+
+// isDuplicateUsername checks whether the error is a MySQL duplicate entry error for our users_uc_username key.
+func isDuplicateUsername(err error) bool {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_username")
+	}
+	return false
+}
+
+// AdminEmails returns the email addresses of every admin user, for sending security alerts to.
+func (m *UserModel) AdminEmails() ([]string, error) {
+	stmt := `SELECT email FROM users WHERE is_admin = TRUE ORDER BY id`
+
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		err = rows.Scan(&email)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
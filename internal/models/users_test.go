@@ -1,8 +1,12 @@
 package models
 
 import (
+	"errors"
 	"github.com/0xshiku/snippetbox/internal/asserts"
+	"github.com/0xshiku/snippetbox/internal/hash"
+	"golang.org/x/crypto/bcrypt"
 	"testing"
+	"time"
 )
 
 func TestUserModelExists(t *testing.T) {
@@ -41,7 +45,7 @@ func TestUserModelExists(t *testing.T) {
 			db := newTestDB(t)
 
 			// Create a new instance of the UserModel.
-			m := UserModel{db}
+			m := UserModel{DB: db}
 
 			// Call the UserModel.Exists() method and check that the return value and error match the expected values for the sub-test.
 			exists, err := m.Exists(tt.userID)
@@ -51,3 +55,400 @@ func TestUserModelExists(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelAdminEmails(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db}
+
+	// The test data has no admins to begin with.
+	emails, err := m.AdminEmails()
+	asserts.NilError(t, err)
+	asserts.Equal(t, len(emails), 0)
+
+	_, err = db.Exec("UPDATE users SET is_admin = TRUE WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails, err = m.AdminEmails()
+	asserts.NilError(t, err)
+	asserts.Equal(t, len(emails), 1)
+	asserts.Equal(t, emails[0], "alice@example.com")
+}
+
+func TestUserModelTaken(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db}
+
+	tests := []struct {
+		name     string
+		email    string
+		username string
+		exceptID int
+		want     bool
+	}{
+		{
+			name:     "Taken",
+			email:    "alice@example.com",
+			username: "alice",
+			want:     true,
+		},
+		{
+			name:     "Taken by the current user",
+			email:    "alice@example.com",
+			username: "alice",
+			exceptID: 1,
+			want:     false,
+		},
+		{
+			name:     "Available",
+			email:    "bob@example.com",
+			username: "bob",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taken, err := m.EmailTaken(tt.email, tt.exceptID)
+			asserts.NilError(t, err)
+			asserts.Equal(t, taken, tt.want)
+
+			taken, err = m.UsernameTaken(tt.username, tt.exceptID)
+			asserts.NilError(t, err)
+			asserts.Equal(t, taken, tt.want)
+		})
+	}
+}
+
+func TestUserModelExternal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db}
+
+	// Existing accounts are found by their normalized address, so the domain's case doesn't matter.
+	user, err := m.GetByEmail("alice@EXAMPLE.com")
+	asserts.NilError(t, err)
+	asserts.Equal(t, user.ID, 1)
+
+	_, err = m.GetByEmail("bob@example.com")
+	if !errors.Is(err, ErrNoRecord) {
+		t.Fatalf("got: %v; want: %v", err, ErrNoRecord)
+	}
+
+	id, err := m.InsertExternal("Bob", "bob", "bob@example.com")
+	asserts.NilError(t, err)
+
+	user, err = m.GetByEmail("bob@example.com")
+	asserts.NilError(t, err)
+	asserts.Equal(t, user.ID, id)
+	asserts.Equal(t, user.Username, "bob")
+
+	_, err = m.InsertExternal("Alice", "alice2", "alice@example.com")
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("got: %v; want: %v", err, ErrDuplicateEmail)
+	}
+}
+
+func TestUserModelInsertAdmin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db}
+
+	err := m.InsertAdmin("Bob", "bob", "bob@example.com", "pa$$word")
+	asserts.NilError(t, err)
+
+	user, err := m.GetByEmail("bob@example.com")
+	asserts.NilError(t, err)
+	asserts.Equal(t, user.IsAdmin, true)
+
+	// A duplicate address fails the insert, so nobody is made an admin.
+	err = m.InsertAdmin("Alice", "alice2", "alice@example.com", "pa$$word")
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("got: %v; want: %v", err, ErrDuplicateEmail)
+	}
+
+	user, err = m.GetByEmail("alice@example.com")
+	asserts.NilError(t, err)
+	asserts.Equal(t, user.IsAdmin, false)
+}
+
+func TestUserModelAuthenticateRehash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	// Give the test user a hash made with the lowest cost, then raise the cost. The hash should be upgraded at the next login.
+	oldHash, err := bcrypt.GenerateFromPassword([]byte("pa$$word"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("UPDATE users SET hashed_password = ? WHERE id = 1", string(oldHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := UserModel{DB: db, Passwords: hash.NewSet(hash.Bcrypt{Cost: bcrypt.MinCost + 1})}
+
+	id, err := m.Authenticate("alice@example.com", "pa$$word")
+	asserts.NilError(t, err)
+	asserts.Equal(t, id, 1)
+
+	var hashedPassword []byte
+	err = db.QueryRow("SELECT hashed_password FROM users WHERE id = 1").Scan(&hashedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cost, err := bcrypt.Cost(hashedPassword)
+	asserts.NilError(t, err)
+	asserts.Equal(t, cost, bcrypt.MinCost+1)
+
+	// The new hash still works.
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	asserts.NilError(t, err)
+}
+
+func TestUserModelAuthenticateMigrate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	oldHash, err := hash.Bcrypt{Cost: bcrypt.MinCost}.Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("UPDATE users SET hashed_password = ? WHERE id = 1", oldHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Switch to Argon2id. The bcrypt hash should still work, and be replaced with an Argon2id one.
+	m := UserModel{DB: db, Passwords: hash.NewSet(hash.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1})}
+
+	id, err := m.Authenticate("alice@example.com", "pa$$word")
+	asserts.NilError(t, err)
+	asserts.Equal(t, id, 1)
+
+	var hashedPassword string
+	err = db.QueryRow("SELECT hashed_password FROM users WHERE id = 1").Scan(&hashedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asserts.Equal(t, hash.Argon2id{}.Identify(hashedPassword), true)
+
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	asserts.NilError(t, err)
+
+	_, err = m.Authenticate("alice@example.com", "wrong")
+	asserts.Equal(t, err, error(ErrInvalidCredentials))
+}
+
+func TestUserModelPreferencesUpdateIfMatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := UserModel{DB: newTestDB(t)}
+
+	user, err := m.Get(1)
+	asserts.NilError(t, err)
+	asserts.Equal(t, user.PreferencesVersion, 1)
+
+	err = m.PreferencesUpdateIfMatch(1, 1, "Europe/London", "en-GB")
+	asserts.NilError(t, err)
+
+	// The version has moved on, so a second change based on version 1 is rejected.
+	err = m.PreferencesUpdateIfMatch(1, 1, "America/New_York", "en-US")
+	asserts.Equal(t, err, error(ErrEditConflict))
+
+	// Changes from the HTML form move the version on too.
+	err = m.PreferencesUpdate(1, "Asia/Tokyo", "ja-JP")
+	asserts.NilError(t, err)
+
+	user, err = m.Get(1)
+	asserts.NilError(t, err)
+	asserts.Equal(t, user.Timezone, "Asia/Tokyo")
+	asserts.Equal(t, user.PreferencesVersion, 3)
+
+	err = m.PreferencesUpdateIfMatch(99, 1, "Europe/London", "en-GB")
+	asserts.Equal(t, err, error(ErrNoRecord))
+}
+
+func TestUserModelStatusUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := UserModel{DB: newTestDB(t)}
+
+	user, err := m.Get(1)
+	asserts.NilError(t, err)
+	asserts.Equal(t, user.Status, UserStatusActive)
+
+	err = m.StatusUpdate(1, UserStatusSuspended)
+	asserts.NilError(t, err)
+
+	// The right password still doesn't get a suspended user in, but the wrong one gets the usual error.
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	asserts.Equal(t, err, error(ErrAccountSuspended))
+
+	_, err = m.Authenticate("alice@example.com", "wrong")
+	asserts.Equal(t, err, error(ErrInvalidCredentials))
+
+	// Setting the same status again isn't an error.
+	err = m.StatusUpdate(1, UserStatusSuspended)
+	asserts.NilError(t, err)
+
+	err = m.StatusUpdate(1, UserStatusActive)
+	asserts.NilError(t, err)
+
+	id, err := m.Authenticate("alice@example.com", "pa$$word")
+	asserts.NilError(t, err)
+	asserts.Equal(t, id, 1)
+
+	err = m.StatusUpdate(1, "deleted")
+	asserts.Equal(t, err, error(ErrInvalidStatus))
+
+	err = m.StatusUpdate(99, UserStatusBanned)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got %v; want ErrNoRecord", err)
+	}
+}
+
+func TestUserModelGuests(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := UserModel{DB: newTestDB(t)}
+
+	err := m.InsertGuest("Grace", "grace", "grace@example.com", "pa$$word", time.Now().Add(-time.Minute))
+	asserts.NilError(t, err)
+
+	expired, err := m.ExpiredGuests()
+	asserts.NilError(t, err)
+	asserts.Equal(t, len(expired), 1)
+	asserts.Equal(t, expired[0].Username, "grace")
+
+	// Only guests who haven't been warned yet are returned as expiring.
+	expiring, err := m.ExpiringGuests(time.Now().Add(time.Hour))
+	asserts.NilError(t, err)
+	asserts.Equal(t, len(expiring), 1)
+
+	err = m.MarkExpiryWarned(expiring[0].ID)
+	asserts.NilError(t, err)
+
+	expiring, err = m.ExpiringGuests(time.Now().Add(time.Hour))
+	asserts.NilError(t, err)
+	asserts.Equal(t, len(expiring), 0)
+
+	err = m.MakePermanent(expired[0].ID)
+	asserts.NilError(t, err)
+
+	user, err := m.Get(expired[0].ID)
+	asserts.NilError(t, err)
+	asserts.Equal(t, user.IsGuest(), false)
+
+	expired, err = m.ExpiredGuests()
+	asserts.NilError(t, err)
+	asserts.Equal(t, len(expired), 0)
+}
+
+func TestUserModelDeleteCascades(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{DB: db}
+
+	// Every table that's cleared by a cascade from users, snippets or webhooks has to be counted by Delete.
+	rows, err := db.Query(`SELECT TABLE_NAME FROM information_schema.REFERENTIAL_CONSTRAINTS
+    WHERE CONSTRAINT_SCHEMA = DATABASE() AND DELETE_RULE = 'CASCADE' AND REFERENCED_TABLE_NAME IN ('users', 'snippets', 'webhooks')`)
+	asserts.NilError(t, err)
+	defer rows.Close()
+
+	counted := map[string]bool{}
+	for _, c := range userCascades {
+		counted[c.table] = true
+	}
+	for rows.Next() {
+		var table string
+		asserts.NilError(t, rows.Scan(&table))
+		if !counted[table] {
+			t.Errorf("%s is cleared by a cascade but isn't in userCascades", table)
+		}
+	}
+	asserts.NilError(t, rows.Err())
+
+	// Give Alice (user 1, who owns snippet 1) a row in each of those tables, and Bob some which involve her.
+	_, err = db.Exec(`
+INSERT INTO users (name, username, email, normalized_email, hashed_password, created) VALUES ('Bob Smith', 'bob', 'bob@example.com', 'bob@example.com', '', NOW());
+INSERT INTO tokens (hash, user_id, expiry, scope) VALUES (UNHEX(REPEAT('01', 32)), 1, NOW(), 'api');
+INSERT INTO email_changes (token_hash, user_id, new_email, expiry) VALUES (UNHEX(REPEAT('02', 32)), 1, 'alice@example.org', NOW());
+INSERT INTO recovery_codes (user_id, hash) VALUES (1, UNHEX(REPEAT('03', 32)));
+INSERT INTO remotes (user_id, name, base_url, token, created) VALUES (1, 'work', 'https://paste.example.com', 'secret', NOW());
+INSERT INTO snippet_mirrors (snippet_id, remote_name, url, created) VALUES (1, 'work', 'https://paste.example.com/1', NOW());
+INSERT INTO user_sessions (token, user_id, user_agent, ip, created, last_seen) VALUES (REPEAT('a', 43), 1, 'Firefox', '127.0.0.1', NOW(), NOW());
+INSERT INTO data_exports (token_hash, user_id, archive, created, expiry) VALUES (UNHEX(REPEAT('04', 32)), 1, '', NOW(), NOW());
+INSERT INTO snippet_reactions (snippet_id, user_id, reaction, created) VALUES (1, 1, 'heart', NOW()), (1, 2, 'heart', NOW());
+INSERT INTO notifications (user_id, actor_id, snippet_id, kind, detail, created) VALUES (1, 2, 1, 'reaction', 'heart', NOW());
+INSERT INTO user_email_preferences (user_id, kind) VALUES (1, 'follows');
+INSERT INTO follows (follower_id, followed_id, created) VALUES (1, 2, NOW()), (2, 1, NOW());
+INSERT INTO webhooks (user_id, url, secret, created) VALUES (1, 'https://example.com/hook', REPEAT('b', 64), NOW());
+INSERT INTO webhook_deliveries (webhook_id, event, snippet_public_id, attempt, status, created) VALUES (1, 'snippet.created', 'AAAAAAAAAAAAAAAAAAAAAAAAAA', 1, 200, NOW());
+INSERT INTO shared_drafts (public_id, user_id, title, content, created, updated) VALUES (REPEAT('C', 26), 1, 'Draft', 'Draft...', NOW(), NOW());`)
+	asserts.NilError(t, err)
+
+	plan, err := m.Delete(1, true)
+	asserts.NilError(t, err)
+
+	want := map[string]int{
+		"snippets":               1,
+		"tokens":                 1,
+		"email_changes":          1,
+		"recovery_codes":         1,
+		"remotes":                1,
+		"snippet_mirrors":        1,
+		"user_sessions":          1,
+		"data_exports":           1,
+		"snippet_reactions":      2,
+		"notifications":          1,
+		"user_email_preferences": 1,
+		"follows":                2,
+		"webhooks":               1,
+		"webhook_deliveries":     1,
+		"shared_drafts":          1,
+		"users":                  1,
+	}
+	for table, n := range want {
+		if got := plan.Rows(PlanDelete, table); got != n {
+			t.Errorf("%s: got %d rows; want %d", table, got, n)
+		}
+	}
+
+	// It was only a dry run, so Alice is still there.
+	exists, err := m.Exists(1)
+	asserts.NilError(t, err)
+	asserts.Equal(t, exists, true)
+}
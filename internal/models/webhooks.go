@@ -0,0 +1,184 @@
+package models
+
+import (
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"strings"
+	"time"
+)
+
+type WebhookModelInterface interface {
+	Insert(userID int, url, secret string) (int, error)
+	AllForUser(userID int) ([]*Webhook, error)
+	Delete(id, userID int) error
+	RecordDelivery(d *WebhookDelivery) error
+	Deliveries(userID, limit int) ([]*WebhookDelivery, error)
+	PruneDeliveries(before time.Time) (int, error)
+}
+
+// Webhook is a URL that a user wants to be sent a signed JSON payload, when something happens to one of their snippets.
+type Webhook struct {
+	ID      int
+	UserID  int
+	URL     string
+	Secret  string
+	Created time.Time
+}
+
+// WebhookDelivery records one attempt at sending a payload to a webhook. Status is the status code of the receiver's
+// response, or 0 if there wasn't one. URL is filled in by Deliveries, from the webhook.
+type WebhookDelivery struct {
+	ID              int
+	WebhookID       int
+	URL             string
+	Event           string
+	SnippetPublicID string
+	Attempt         int
+	Status          int
+	Error           string
+	Created         time.Time
+}
+
+// OK reports whether the receiver accepted the payload.
+func (d *WebhookDelivery) OK() bool {
+	return d.Status >= 200 && d.Status <= 299
+}
+
+// WebhookModel wraps a database connection pool and is used to manage the webhooks and webhook_deliveries tables.
+// The secrets are stored as they are, because they're the key for each payload's signature. They're only shown to the
+// user once, when the webhook is added.
+type WebhookModel struct {
+	DB DBTX
+}
+
+// Insert adds a webhook for the user, and returns its ID. Each of a user's webhooks must have a different URL.
+func (m *WebhookModel) Insert(userID int, url, secret string) (int, error) {
+	stmt := `INSERT INTO webhooks (user_id, url, secret, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, userID, url, secret)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "webhooks_uc_user_url") {
+			return 0, ErrDuplicateWebhook
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// AllForUser returns the user's webhooks, oldest first.
+func (m *WebhookModel) AllForUser(userID int) ([]*Webhook, error) {
+	stmt := `SELECT id, user_id, url, secret, created FROM webhooks WHERE user_id = ? ORDER BY id`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+
+	for rows.Next() {
+		w := &Webhook{}
+
+		err = rows.Scan(&w.ID, &w.UserID, &w.URL, &w.Secret, &w.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete removes one of the user's webhooks, along with its delivery log.
+func (m *WebhookModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// RecordDelivery adds an attempt to the delivery log. The error message is cut down to fit the column. If the webhook
+// was deleted while the payload was being sent, there's nothing to record it against, so it's quietly dropped.
+func (m *WebhookModel) RecordDelivery(d *WebhookDelivery) error {
+	stmt := `INSERT INTO webhook_deliveries (webhook_id, event, snippet_public_id, attempt, status, error_message, created)
+	SELECT id, ?, ?, ?, ?, ?, UTC_TIMESTAMP() FROM webhooks WHERE id = ?`
+
+	message := d.Error
+	if len(message) > 255 {
+		message = strings.ToValidUTF8(message[:255], "")
+	}
+
+	_, err := m.DB.Exec(stmt, d.Event, d.SnippetPublicID, d.Attempt, d.Status, message, d.WebhookID)
+	return err
+}
+
+// Deliveries returns the latest attempts at sending payloads to any of the user's webhooks, newest first.
+func (m *WebhookModel) Deliveries(userID, limit int) ([]*WebhookDelivery, error) {
+	stmt := `SELECT d.id, d.webhook_id, w.url, d.event, d.snippet_public_id, d.attempt, d.status, d.error_message, d.created
+	FROM webhook_deliveries d INNER JOIN webhooks w ON w.id = d.webhook_id
+	WHERE w.user_id = ? ORDER BY d.id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		d := &WebhookDelivery{}
+
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Event, &d.SnippetPublicID, &d.Attempt, &d.Status, &d.Error, &d.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// PruneDeliveries removes the delivery log entries from before a time, and returns how many there were.
+func (m *WebhookModel) PruneDeliveries(before time.Time) (int, error) {
+	result, err := m.DB.Exec(`DELETE FROM webhook_deliveries WHERE created < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rows), nil
+}
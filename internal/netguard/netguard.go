@@ -0,0 +1,66 @@
+// Package netguard stops outgoing requests to URLs that users have entered (webhooks, remote instances) from reaching
+// services behind our firewall. The check is made when the connection is dialled, after the hostname has been
+// resolved, so a public hostname which resolves to a private address is caught too.
+package netguard
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when a URL resolves to a loopback or private network address, which we refuse to
+// connect to.
+var ErrPrivateAddress = errors.New("netguard: refusing to connect to a private network address")
+
+// IsPrivate reports whether the IP address is one that outgoing requests mustn't be sent to: loopback, private,
+// link-local or unspecified.
+func IsPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+}
+
+// PrivateHost reports whether the host from a URL is obviously private, because it's localhost or a private IP
+// address. It's for rejecting URLs when they're entered, with a clear message. Hostnames which resolve to a private
+// address can only be caught when connecting, by Control.
+func PrivateHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && IsPrivate(ip)
+}
+
+// Control is a net.Dialer Control function which refuses to connect to private addresses.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || IsPrivate(ip) {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
+
+// Transport returns an HTTP transport which won't connect to private addresses. It doesn't use a proxy from the
+// environment, because the proxy's address would be checked instead of the real one.
+func Transport(timeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: Control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return transport
+}
@@ -0,0 +1,50 @@
+package netguard
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPrivateHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "snippets.example.com", want: false},
+		{host: "93.184.216.34", want: false},
+		{host: "2606:2800:220:1:248:1893:25c8:1946", want: false},
+		{host: "localhost", want: true},
+		{host: "LOCALHOST.", want: true},
+		{host: "api.localhost", want: true},
+		{host: "127.0.0.1", want: true},
+		{host: "10.0.0.5", want: true},
+		{host: "192.168.1.1", want: true},
+		{host: "169.254.169.254", want: true},
+		{host: "0.0.0.0", want: true},
+		{host: "::1", want: true},
+		{host: "fe80::1", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			asserts.Equal(t, PrivateHost(tt.host), tt.want)
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback address")
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: Transport(time.Second)}
+
+	_, err := client.Get(ts.URL)
+
+	asserts.Equal(t, errors.Is(err, ErrPrivateAddress), true)
+}
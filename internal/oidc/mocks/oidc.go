@@ -0,0 +1,32 @@
+package mocks
+
+import (
+	"context"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/oidc"
+	"net/url"
+)
+
+// Provider sends users to a fake authorization endpoint, and hands out claims for the code that they come back with:
+// "alice" and "dave" for existing users (Dave has two-factor authentication turned on), "eve" for a suspended user,
+// "new" for somebody without an account, and "unverified" for an email address that the provider hasn't checked. Any
+// other code fails, like an invalid or reused code would.
+type Provider struct{}
+
+func (p *Provider) AuthURL(ctx context.Context, redirectURL, state, nonce, verifier string) (string, error) {
+	query := url.Values{"redirect_uri": {redirectURL}, "state": {state}}
+	return "https://idp.example.com/authorize?" + query.Encode(), nil
+}
+
+func (p *Provider) Exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (*oidc.Claims, error) {
+	switch code {
+	case "alice", "dave", "eve":
+		return &oidc.Claims{Subject: code, Email: code + "@example.com", EmailVerified: true}, nil
+	case "new":
+		return &oidc.Claims{Subject: "new", Email: "new.person@example.com", EmailVerified: true, Name: "New Person", PreferredUsername: "new.person"}, nil
+	case "unverified":
+		return &oidc.Claims{Subject: "unverified", Email: "alice@example.com"}, nil
+	default:
+		return nil, errors.New("oidc: token endpoint responded with invalid_grant")
+	}
+}
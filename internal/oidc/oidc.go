@@ -0,0 +1,422 @@
+// Package oidc logs users in with an OpenID Connect provider, like Keycloak or Auth0, as a relying party. It uses the
+// authorization code flow with PKCE (RFC 7636): the user is sent to the provider's authorization endpoint, and comes back
+// with a code, which is swapped for an ID token at the token endpoint. The ID token is signed by the provider, and
+// says who the user is.
+//
+// The endpoints and signing keys are found with OpenID Connect Discovery, so only the issuer URL has to be configured.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("oidc: invalid ID token")
+	ErrUnknownKey   = errors.New("oidc: ID token was signed with an unknown key")
+)
+
+// The scopes that are asked for. The email scope is what lets accounts be linked by email address.
+const scopes = "openid email profile"
+
+// How much the provider's clock is allowed to be ahead of ours, when checking that an ID token hasn't expired.
+const leeway = time.Minute
+
+// How often the provider's signing keys can be fetched again, when an ID token refers to a key we don't have. The
+// provider adds the new key to its list before it starts signing with it, so this is enough to notice a rotation.
+const keyRefreshInterval = time.Minute
+
+// Provider is an OpenID Connect provider.
+type Provider interface {
+	// AuthURL returns the URL of the provider's authorization endpoint, for the user to be sent to. The state, nonce and
+	// verifier should come from Random, and be kept (in the session) until the user comes back.
+	AuthURL(ctx context.Context, redirectURL, state, nonce, verifier string) (string, error)
+	// Exchange swaps the code that the user came back with for an ID token, checks the token, and returns its claims.
+	Exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (*Claims, error)
+}
+
+// Claims are the claims from an ID token that are used to find (or create) the user's account.
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// idToken holds all of the claims which are checked, as well as the ones that are used.
+type idToken struct {
+	Claims
+	Issuer          string   `json:"iss"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	Expiry          int64    `json:"exp"`
+	Nonce           string   `json:"nonce"`
+}
+
+// The audience claim can be a single string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// The discovery type holds the parts of the provider's discovery document that are used.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Client is a relying party for one provider. The discovery document is fetched the first time it's needed, rather than
+// when the Client is made, so that the application can start while the provider is down. It is safe for concurrent use.
+type Client struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	http         *http.Client
+	now          func() time.Time
+
+	mu          sync.Mutex
+	discovery   *discovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// New returns a Client for the provider with the issuer URL, using the client ID and secret that it gave the application.
+// Requests to the provider time out after the timeout.
+func New(issuer, clientID, clientSecret string, timeout time.Duration) *Client {
+	return &Client{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		http:         &http.Client{Timeout: timeout},
+		now:          time.Now,
+	}
+}
+
+// Random returns a random string, for the state, nonce and PKCE verifier.
+func Random() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthURL implements Provider. The PKCE challenge is the SHA-256 hash of the verifier.
+func (c *Client) AuthURL(ctx context.Context, redirectURL, state, nonce, verifier string) (string, error) {
+	d, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.clientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange implements Provider. The ID token comes straight from the provider over TLS, but its signature is checked
+// anyway, as the specification requires.
+func (c *Client) Exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (*Claims, error) {
+	d, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// The client_secret_basic method, which every provider supports, encodes the ID and secret before joining them.
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	rs, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Body.Close()
+
+	var output struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(rs.Body, 1<<20)).Decode(&output)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token endpoint responded with %s", rs.Status)
+	}
+	if output.Error != "" {
+		return nil, fmt.Errorf("oidc: token endpoint responded with %s: %s", output.Error, output.ErrorDescription)
+	}
+	if rs.StatusCode != http.StatusOK || output.IDToken == "" {
+		return nil, fmt.Errorf("oidc: token endpoint responded with %s, without an ID token", rs.Status)
+	}
+
+	return c.verify(ctx, d, output.IDToken, nonce)
+}
+
+// verify checks an ID token's signature and claims, and returns the claims.
+func (c *Client) verify(ctx context.Context, d *discovery, token, nonce string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := c.key(ctx, d, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The algorithm has to match the type of the key, so that a token can't pick one which is easier to forge.
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Algorithm != "RS256" || rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig) != nil {
+			return nil, ErrInvalidToken
+		}
+	case *ecdsa.PublicKey:
+		if header.Algorithm != "ES256" || len(sig) != 64 {
+			return nil, ErrInvalidToken
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(key, hash[:], r, s) {
+			return nil, ErrInvalidToken
+		}
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	var claims idToken
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var audienceOK bool
+	for _, aud := range claims.Audience {
+		audienceOK = audienceOK || aud == c.clientID
+	}
+
+	switch {
+	case claims.Issuer != d.Issuer:
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidToken, claims.Issuer)
+	case !audienceOK || (claims.AuthorizedParty != "" && claims.AuthorizedParty != c.clientID):
+		return nil, fmt.Errorf("%w: issued to another client", ErrInvalidToken)
+	case c.now().Add(-leeway).Unix() >= claims.Expiry:
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: wrong nonce", ErrInvalidToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	return &claims.Claims, nil
+}
+
+// discover returns the provider's discovery document, fetching it the first time. A failed fetch isn't cached, so the
+// next login tries again.
+func (c *Client) discover(ctx context.Context) (*discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	var d discovery
+	err := c.getJSON(ctx, c.issuer+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, err
+	}
+
+	// The issuer in the document has to be exactly the one we asked, or the ID tokens' iss claims won't match it.
+	if strings.TrimSuffix(d.Issuer, "/") != c.issuer {
+		return nil, fmt.Errorf("oidc: discovery document is for issuer %q, not %q", d.Issuer, c.issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing an endpoint")
+	}
+
+	c.discovery = &d
+	return c.discovery, nil
+}
+
+// key returns the provider's signing key with the ID. The keys are fetched again if there isn't one with that ID (as
+// long as they weren't fetched very recently), because the provider might have rotated them.
+func (c *Client) key(ctx context.Context, d *discovery, id string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[id]; ok {
+		return key, nil
+	}
+
+	if c.keys != nil && c.now().Sub(c.keysFetched) < keyRefreshInterval {
+		return nil, ErrUnknownKey
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := c.getJSON(ctx, d.JWKSURI, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	c.keys = map[string]crypto.PublicKey{}
+	c.keysFetched = c.now()
+	for _, k := range set.Keys {
+		// Skip encryption keys, and the types of key we don't understand.
+		if k.Use == "enc" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			c.keys[k.ID] = key
+		}
+	}
+
+	key, ok := c.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	rs, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s responded with %s", url, rs.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(rs.Body, 1<<20)).Decode(v)
+}
+
+// The jwk type is a JSON Web Key (RFC 7517). Only RSA keys and P-256 elliptic curve keys are supported, which are the
+// ones that RS256 and ES256 use.
+type jwk struct {
+	ID    string `json:"kid"`
+	Type  string `json:"kty"`
+	Use   string `json:"use"`
+	N     string `json:"n"`
+	E     string `json:"e"`
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Type {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			return nil, errors.New("oidc: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("oidc: unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// ecdsa.Verify refuses points which aren't on the curve, so only the lengths need checking here.
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("oidc: invalid P-256 key")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	default:
+		return nil, fmt.Errorf("oidc: unsupported key type %q", k.Type)
+	}
+}
+
+func decodeSegment(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,205 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fakeProvider type is an OpenID Connect provider which hands out whichever ID token a test has put in its tokens
+// map for the code.
+type fakeProvider struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	tokens map[string]string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &fakeProvider{rsaKey: rsaKey, ecKey: ecKey, tokens: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kid": "rsa", "kty": "RSA", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kid": "ec", "kty": "EC", "crv": "P-256", "x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+		}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		// The ID and secret are form-encoded before they're put in the header, so "%" arrives as "%25".
+		id, secret, _ := r.BasicAuth()
+		secret, _ = url.QueryUnescape(secret)
+		if id != "snippetbox" || secret != "s3cr%t" || r.PostFormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"bad client or verifier"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.tokens[r.PostFormValue("code")]})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// sign makes an ID token with the claims, signed by the named key.
+func (p *fakeProvider) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := encode(header) + "." + encode(payload)
+	hash := sha256.Sum256([]byte(unsigned))
+
+	var sig []byte
+	var err error
+	if kid == "ec" {
+		r, s, err := ecdsa.Sign(rand.Reader, p.ecKey, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else {
+		sig, err = rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return unsigned + "." + encode(sig)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestAuthURL(t *testing.T) {
+	p := newFakeProvider(t)
+	c := New(p.URL+"/", "snippetbox", "s3cr%t", 5*time.Second)
+
+	authURL, err := c.AuthURL(context.Background(), "https://snippets.example.com/callback", "state", "nonce", "verifier")
+	asserts.NilError(t, err)
+
+	u, err := url.Parse(authURL)
+	asserts.NilError(t, err)
+
+	challenge := sha256.Sum256([]byte("verifier"))
+
+	asserts.Equal(t, u.Path, "/authorize")
+	asserts.Equal(t, u.Query().Get("client_id"), "snippetbox")
+	asserts.Equal(t, u.Query().Get("redirect_uri"), "https://snippets.example.com/callback")
+	asserts.Equal(t, u.Query().Get("scope"), "openid email profile")
+	asserts.Equal(t, u.Query().Get("code_challenge"), encode(challenge[:]))
+	asserts.Equal(t, u.Query().Get("code_challenge_method"), "S256")
+}
+
+func TestExchange(t *testing.T) {
+	p := newFakeProvider(t)
+
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":            p.URL,
+			"aud":            "snippetbox",
+			"sub":            "248289761001",
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          "nonce",
+		}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+
+	p.tokens["rsa"] = p.sign(t, "RS256", "rsa", claims(nil))
+	p.tokens["ec"] = p.sign(t, "ES256", "ec", claims(map[string]any{"aud": []string{"other", "snippetbox"}}))
+	p.tokens["wrong-alg"] = p.sign(t, "ES256", "rsa", claims(nil))
+	p.tokens["unknown-key"] = p.sign(t, "RS256", "old", claims(nil))
+	p.tokens["wrong-issuer"] = p.sign(t, "RS256", "rsa", claims(map[string]any{"iss": "https://evil.example.com"}))
+	p.tokens["wrong-audience"] = p.sign(t, "RS256", "rsa", claims(map[string]any{"aud": "other"}))
+	p.tokens["expired"] = p.sign(t, "RS256", "rsa", claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}))
+	p.tokens["wrong-nonce"] = p.sign(t, "RS256", "rsa", claims(map[string]any{"nonce": "replayed"}))
+
+	// The original signature, with somebody else's claims.
+	parts := strings.Split(p.tokens["rsa"], ".")
+	changed, _ := json.Marshal(claims(map[string]any{"email": "mallory@example.com"}))
+	p.tokens["changed"] = parts[0] + "." + encode(changed) + "." + parts[2]
+
+	tests := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{name: "RS256", code: "rsa"},
+		{name: "ES256", code: "ec"},
+		{name: "Algorithm doesn't match the key", code: "wrong-alg", wantErr: ErrInvalidToken},
+		{name: "Unknown key", code: "unknown-key", wantErr: ErrUnknownKey},
+		{name: "Wrong issuer", code: "wrong-issuer", wantErr: ErrInvalidToken},
+		{name: "Wrong audience", code: "wrong-audience", wantErr: ErrInvalidToken},
+		{name: "Expired", code: "expired", wantErr: ErrInvalidToken},
+		{name: "Wrong nonce", code: "wrong-nonce", wantErr: ErrInvalidToken},
+		{name: "Changed token", code: "changed", wantErr: ErrInvalidToken},
+	}
+
+	c := New(p.URL, "snippetbox", "s3cr%t", 5*time.Second)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Exchange(context.Background(), "https://snippets.example.com/callback", tt.code, "verifier", "nonce")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got: %v; want: %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				asserts.Equal(t, got.Email, "alice@example.com")
+				asserts.Equal(t, got.EmailVerified, true)
+			}
+		})
+	}
+
+	t.Run("Wrong verifier", func(t *testing.T) {
+		_, err := c.Exchange(context.Background(), "https://snippets.example.com/callback", "rsa", "guessed", "nonce")
+		if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+			t.Errorf("got: %v; want: an invalid_grant error", err)
+		}
+	})
+
+	t.Run("Issuer doesn't match", func(t *testing.T) {
+		c := New(p.URL+"/realms/other", "snippetbox", "s3cr%t", 5*time.Second)
+		_, err := c.Exchange(context.Background(), "https://snippets.example.com/callback", "rsa", "verifier", "nonce")
+		if err == nil {
+			t.Error("got: nil; want: error")
+		}
+	})
+}
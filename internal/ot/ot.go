@@ -0,0 +1,311 @@
+// Package ot implements operational transformation for plain text, so that several people can edit the same document at
+// once. It uses the same operations as the ot.js library: an operation walks through the whole document, retaining,
+// inserting or deleting as it goes, and is encoded in JSON as an array where a positive number retains that many
+// characters, a negative number deletes that many, and a string is inserted.
+//
+// Lengths and positions are counted in UTF-16 code units rather than bytes or runes, because that's what JavaScript
+// strings are made of, and the operations are made by diffing a textarea in the browser.
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"unicode/utf16"
+)
+
+var (
+	// ErrBaseLength is returned when an operation doesn't span the whole of the document it's applied to, or two
+	// operations which are being transformed weren't made on the same document.
+	ErrBaseLength = errors.New("ot: operation doesn't match the length of the document")
+	// ErrInvalid is returned when an operation can't be decoded, or would split a character which needs two UTF-16 code
+	// units in half.
+	ErrInvalid = errors.New("ot: invalid operation")
+)
+
+// MaxLength is the longest document that a decoded operation can apply to or produce. It's far more than anything
+// that can be stored, and stops huge counts from overflowing when they're added up.
+const MaxLength = 1 << 24
+
+// component is one step of an operation. Exactly one of its fields is set: retain and delete are positive counts, and
+// insert is the text to insert.
+type component struct {
+	retain int
+	delete int
+	insert []uint16
+}
+
+// Operation is a change to a document. The zero value is an operation on an empty document which does nothing.
+type Operation struct {
+	components []component
+	// BaseLength is the length of the document the operation applies to, and TargetLength is its length afterwards.
+	BaseLength   int
+	TargetLength int
+}
+
+// Retain adds a step which skips over n characters, leaving them as they are.
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+
+	o.BaseLength += n
+	o.TargetLength += n
+
+	if last := o.last(); last != nil && last.retain > 0 {
+		last.retain += n
+	} else {
+		o.components = append(o.components, component{retain: n})
+	}
+
+	return o
+}
+
+// Insert adds a step which inserts s.
+func (o *Operation) Insert(s string) *Operation {
+	return o.insert(utf16.Encode([]rune(s)))
+}
+
+func (o *Operation) insert(units []uint16) *Operation {
+	if len(units) == 0 {
+		return o
+	}
+
+	o.TargetLength += len(units)
+	// The units can belong to another operation, which mustn't be changed when this one's inserts are appended to.
+	units = slices.Clip(units)
+
+	// Inserts always come before deletes at the same position, so that equivalent operations have the same components.
+	n := len(o.components)
+	switch {
+	case n > 0 && o.components[n-1].insert != nil:
+		o.components[n-1].insert = append(o.components[n-1].insert, units...)
+	case n > 0 && o.components[n-1].delete > 0:
+		if n > 1 && o.components[n-2].insert != nil {
+			o.components[n-2].insert = append(o.components[n-2].insert, units...)
+		} else {
+			o.components = append(o.components, o.components[n-1])
+			o.components[n-1] = component{insert: units}
+		}
+	default:
+		o.components = append(o.components, component{insert: units})
+	}
+
+	return o
+}
+
+// Delete adds a step which deletes the next n characters.
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+
+	o.BaseLength += n
+
+	if last := o.last(); last != nil && last.delete > 0 {
+		last.delete += n
+	} else {
+		o.components = append(o.components, component{delete: n})
+	}
+
+	return o
+}
+
+func (o *Operation) last() *component {
+	if len(o.components) == 0 {
+		return nil
+	}
+	return &o.components[len(o.components)-1]
+}
+
+// IsNoop reports whether the operation leaves the document as it is.
+func (o *Operation) IsNoop() bool {
+	return len(o.components) == 0 || (len(o.components) == 1 && o.components[0].retain > 0)
+}
+
+// Length returns the length of s in UTF-16 code units, which is how the lengths of operations are counted.
+func Length(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// Apply applies the operation to doc, and returns the new document.
+func (o *Operation) Apply(doc string) (string, error) {
+	units := utf16.Encode([]rune(doc))
+	if len(units) != o.BaseLength {
+		return "", ErrBaseLength
+	}
+
+	out := make([]uint16, 0, o.TargetLength)
+	i := 0
+	for _, c := range o.components {
+		switch {
+		case c.retain > 0:
+			out = append(out, units[i:i+c.retain]...)
+			i += c.retain
+		case c.delete > 0:
+			i += c.delete
+		default:
+			out = append(out, c.insert...)
+		}
+
+		// Splitting a surrogate pair would leave half a character behind, which can't be stored.
+		if i > 0 && i < len(units) && isHighSurrogate(units[i-1]) && isLowSurrogate(units[i]) {
+			return "", ErrInvalid
+		}
+	}
+
+	return string(utf16.Decode(out)), nil
+}
+
+func isHighSurrogate(u uint16) bool {
+	return u >= 0xd800 && u <= 0xdbff
+}
+
+func isLowSurrogate(u uint16) bool {
+	return u >= 0xdc00 && u <= 0xdfff
+}
+
+// Transform takes two operations a and b which were made at the same time on the same document, and returns a' and b',
+// such that applying a then b' gives the same document as applying b then a'. When both insert at the same position,
+// a's insert comes first.
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.BaseLength != b.BaseLength {
+		return nil, nil, ErrBaseLength
+	}
+
+	aPrime, bPrime := &Operation{}, &Operation{}
+
+	as, bs := a.components, b.components
+	var ac, bc *component
+	next := func(cs *[]component) *component {
+		if len(*cs) == 0 {
+			return nil
+		}
+		c := (*cs)[0]
+		*cs = (*cs)[1:]
+		return &c
+	}
+	ac, bc = next(&as), next(&bs)
+
+	for ac != nil || bc != nil {
+		// Inserts don't depend on the other operation, apart from which goes first, and the other operation has to
+		// retain them.
+		if ac != nil && ac.insert != nil {
+			aPrime.insert(ac.insert)
+			bPrime.Retain(len(ac.insert))
+			ac = next(&as)
+			continue
+		}
+		if bc != nil && bc.insert != nil {
+			aPrime.Retain(len(bc.insert))
+			bPrime.insert(bc.insert)
+			bc = next(&bs)
+			continue
+		}
+
+		if ac == nil || bc == nil {
+			return nil, nil, ErrBaseLength
+		}
+
+		n := min(ac.retain+ac.delete, bc.retain+bc.delete)
+		switch {
+		case ac.retain > 0 && bc.retain > 0:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case ac.delete > 0 && bc.retain > 0:
+			aPrime.Delete(n)
+		case ac.retain > 0 && bc.delete > 0:
+			bPrime.Delete(n)
+		}
+		// When both delete the same characters, they're already gone, so neither has to delete them again.
+
+		ac, bc = shorten(ac, n, &as), shorten(bc, n, &bs)
+	}
+
+	return aPrime, bPrime, nil
+}
+
+// shorten takes n characters off a retain or delete step, and returns the next step if there's nothing left of it.
+func shorten(c *component, n int, rest *[]component) *component {
+	if c.retain > 0 {
+		c.retain -= n
+		if c.retain > 0 {
+			return c
+		}
+	} else {
+		c.delete -= n
+		if c.delete > 0 {
+			return c
+		}
+	}
+
+	if len(*rest) == 0 {
+		return nil
+	}
+	next := (*rest)[0]
+	*rest = (*rest)[1:]
+	return &next
+}
+
+// MarshalJSON encodes the operation in the ot.js format.
+func (o *Operation) MarshalJSON() ([]byte, error) {
+	steps := make([]any, 0, len(o.components))
+	for _, c := range o.components {
+		switch {
+		case c.retain > 0:
+			steps = append(steps, c.retain)
+		case c.delete > 0:
+			steps = append(steps, -c.delete)
+		default:
+			steps = append(steps, string(utf16.Decode(c.insert)))
+		}
+	}
+
+	return json.Marshal(steps)
+}
+
+// UnmarshalJSON decodes an operation in the ot.js format.
+func (o *Operation) UnmarshalJSON(b []byte) error {
+	var steps []json.RawMessage
+	err := json.Unmarshal(b, &steps)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+
+	*o = Operation{}
+	for _, step := range steps {
+		if o.BaseLength > MaxLength || o.TargetLength > MaxLength {
+			return fmt.Errorf("%w: longer than %d", ErrInvalid, MaxLength)
+		}
+
+		var s string
+		if json.Unmarshal(step, &s) == nil {
+			if s == "" {
+				return fmt.Errorf("%w: empty insert", ErrInvalid)
+			}
+			o.Insert(s)
+			continue
+		}
+
+		var n int
+		if json.Unmarshal(step, &n) != nil || n == 0 || n > MaxLength || n < -MaxLength {
+			return fmt.Errorf("%w: steps must be non-zero integers or strings", ErrInvalid)
+		}
+		if n > 0 {
+			o.Retain(n)
+		} else {
+			o.Delete(-n)
+		}
+	}
+
+	if o.BaseLength > MaxLength || o.TargetLength > MaxLength {
+		return fmt.Errorf("%w: longer than %d", ErrInvalid, MaxLength)
+	}
+
+	return nil
+}
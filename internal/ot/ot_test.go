@@ -0,0 +1,141 @@
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+)
+
+func decode(t *testing.T, js string) *Operation {
+	t.Helper()
+
+	var o Operation
+	err := json.Unmarshal([]byte(js), &o)
+	asserts.NilError(t, err)
+	return &o
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		op   string
+		want string
+		err  error
+	}{
+		{name: "Insert", doc: "Hello", op: `[5, " world"]`, want: "Hello world"},
+		{name: "Delete", doc: "Hello world", op: `[5, -6]`, want: "Hello"},
+		{name: "Replace", doc: "Hello world", op: `[6, "there", -5]`, want: "Hello there"},
+		{name: "Empty document", doc: "", op: `["Hi"]`, want: "Hi"},
+		{name: "Emoji", doc: "a😀b", op: `[3, "c", 1]`, want: "a😀cb"},
+		{name: "Too short", doc: "Hello", op: `[4, "!"]`, err: ErrBaseLength},
+		{name: "Too long", doc: "Hello", op: `[6]`, err: ErrBaseLength},
+		{name: "Split emoji", doc: "a😀b", op: `[2, "c", 2]`, err: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decode(t, tt.op).Apply(tt.doc)
+			asserts.Equal(t, errors.Is(err, tt.err), true)
+			asserts.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a    string
+		b    string
+		want string
+	}{
+		{name: "Inserts in different places", doc: "abc", a: `["x", 3]`, b: `[3, "y"]`, want: "xabcy"},
+		{name: "Inserts in the same place", doc: "abc", a: `[1, "x", 2]`, b: `[1, "y", 2]`, want: "axybc"},
+		{name: "Insert inside a delete", doc: "abcdef", a: `[1, -4, 1]`, b: `[3, "x", 3]`, want: "axf"},
+		{name: "Overlapping deletes", doc: "abcdef", a: `[1, -3, 2]`, b: `[2, -3, 1]`, want: "af"},
+		{name: "Same delete", doc: "abc", a: `[1, -1, 1]`, b: `[1, -1, 1]`, want: "ac"},
+		{name: "Emoji", doc: "😀😀", a: `["x", 4]`, b: `[2, -2, "y"]`, want: "x😀y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := decode(t, tt.a), decode(t, tt.b)
+
+			aPrime, bPrime, err := Transform(a, b)
+			asserts.NilError(t, err)
+
+			// Applying a then b' gives the same document as applying b then a'.
+			afterA, err := a.Apply(tt.doc)
+			asserts.NilError(t, err)
+			viaA, err := bPrime.Apply(afterA)
+			asserts.NilError(t, err)
+
+			afterB, err := b.Apply(tt.doc)
+			asserts.NilError(t, err)
+			viaB, err := aPrime.Apply(afterB)
+			asserts.NilError(t, err)
+
+			asserts.Equal(t, viaA, tt.want)
+			asserts.Equal(t, viaB, tt.want)
+		})
+	}
+
+	t.Run("Different documents", func(t *testing.T) {
+		_, _, err := Transform(decode(t, `[3]`), decode(t, `[4]`))
+		asserts.Equal(t, errors.Is(err, ErrBaseLength), true)
+	})
+
+	t.Run("Operations aren't changed", func(t *testing.T) {
+		a, b := decode(t, `["x", 1]`), decode(t, `["y", 1]`)
+
+		aPrime, _, err := Transform(a, b)
+		asserts.NilError(t, err)
+		aPrime.Insert("z")
+
+		js, err := json.Marshal(a)
+		asserts.NilError(t, err)
+		asserts.Equal(t, string(js), `["x",1]`)
+	})
+}
+
+func TestJSON(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		o := decode(t, `[2, "ab", "c", -1, -2, 3]`)
+		asserts.Equal(t, o.BaseLength, 8)
+		asserts.Equal(t, o.TargetLength, 8)
+
+		js, err := json.Marshal(o)
+		asserts.NilError(t, err)
+		asserts.Equal(t, string(js), `[2,"abc",-3,3]`)
+	})
+
+	t.Run("Inserts go before deletes", func(t *testing.T) {
+		o := (&Operation{}).Delete(2).Insert("x").Retain(1)
+
+		js, err := json.Marshal(o)
+		asserts.NilError(t, err)
+		asserts.Equal(t, string(js), `["x",-2,1]`)
+	})
+
+	for _, js := range []string{`{}`, `[0]`, `[""]`, `[1.5]`, `[true]`, `[99999999999]`, `[16777216, 16777216]`} {
+		t.Run(js, func(t *testing.T) {
+			var o Operation
+			err := json.Unmarshal([]byte(js), &o)
+			asserts.Equal(t, errors.Is(err, ErrInvalid), true)
+		})
+	}
+}
+
+func TestIsNoop(t *testing.T) {
+	asserts.Equal(t, decode(t, `[]`).IsNoop(), true)
+	asserts.Equal(t, decode(t, `[5]`).IsNoop(), true)
+	asserts.Equal(t, decode(t, `[5, "x"]`).IsNoop(), false)
+}
+
+func TestLength(t *testing.T) {
+	asserts.Equal(t, Length("abc"), 3)
+	asserts.Equal(t, Length("é"), 1)
+	asserts.Equal(t, Length("😀"), 2)
+}
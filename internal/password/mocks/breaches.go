@@ -0,0 +1,16 @@
+package mocks
+
+import (
+	"errors"
+)
+
+// BreachChecker reports "breachedPa$$word" as breached, and fails for "unavailablePa$$word" as if the service were down.
+type BreachChecker struct{}
+
+func (c *BreachChecker) Breached(password string) (bool, error) {
+	if password == "unavailablePa$$word" {
+		return false, errors.New("pwned passwords API unavailable")
+	}
+
+	return password == "breachedPa$$word", nil
+}
@@ -0,0 +1,155 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// commonPasswords is a small built-in deny list of passwords which are long enough to pass a length check,
+// but are among the first guesses in any password spraying attack. More can be added with a deny list file.
+var commonPasswords = []string{
+	"password", "password1", "password123", "passw0rd", "12345678", "123456789", "1234567890",
+	"qwertyuiop", "qwerty123", "iloveyou", "sunshine", "princess", "football", "baseball",
+	"welcome1", "letmein1", "trustno1", "superman", "starwars", "11111111", "00000000",
+	"abcd1234", "1q2w3e4r", "zaq12wsx", "snippetbox",
+}
+
+// BreachChecker is implemented by anything which can report whether a password has appeared in a known data breach.
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+
+// Policy holds the rules which new passwords must follow. The same policy is used everywhere a password is chosen,
+// so that the rules can't drift apart between forms.
+// MinEntropy is the lowest strength allowed, in bits, as estimated by Entropy(). Zero turns the strength check off.
+type Policy struct {
+	MinLength     int
+	MinEntropy    float64
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	BreachCheck   bool
+	denyList      map[string]bool
+}
+
+// NewPolicy returns a policy with the given minimum length, and the built-in deny list of common passwords.
+func NewPolicy(minLength int) Policy {
+	p := Policy{
+		MinLength: minLength,
+		denyList:  make(map[string]bool),
+	}
+
+	for _, password := range commonPasswords {
+		p.denyList[password] = true
+	}
+
+	return p
+}
+
+// LoadDenyList adds the passwords in r, one per line, to the policy's deny list. Blank lines and lines starting with # are ignored.
+func (p *Policy) LoadDenyList(r io.Reader) error {
+	if p.denyList == nil {
+		p.denyList = make(map[string]bool)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.denyList[strings.ToLower(line)] = true
+	}
+
+	return scanner.Err()
+}
+
+// Check returns a message describing the first rule the password breaks, or an empty string if it follows them all.
+// It doesn't do the breach check, because that needs a network request.
+func (p Policy) Check(password string) string {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Sprintf("This field must be at least %d characters long", p.MinLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	switch {
+	case p.RequireUpper && !hasUpper:
+		return "This field must contain an uppercase letter"
+	case p.RequireLower && !hasLower:
+		return "This field must contain a lowercase letter"
+	case p.RequireDigit && !hasDigit:
+		return "This field must contain a digit"
+	case p.RequireSymbol && !hasSymbol:
+		return "This field must contain a symbol"
+	}
+
+	if p.denyList[strings.ToLower(password)] {
+		return "This password is too common, please choose another one"
+	}
+
+	if p.MinEntropy > 0 && Entropy(password) < p.MinEntropy {
+		return "This password is too easy to guess, try making it longer or less predictable"
+	}
+
+	return ""
+}
+
+// Describe returns the rules of the policy as short sentences, for showing next to password fields.
+func (p Policy) Describe() []string {
+	rules := []string{fmt.Sprintf("At least %d characters long.", p.MinLength)}
+
+	var classes []string
+	if p.RequireUpper {
+		classes = append(classes, "an uppercase letter")
+	}
+	if p.RequireLower {
+		classes = append(classes, "a lowercase letter")
+	}
+	if p.RequireDigit {
+		classes = append(classes, "a digit")
+	}
+	if p.RequireSymbol {
+		classes = append(classes, "a symbol")
+	}
+	if len(classes) > 0 {
+		rules = append(rules, "Must contain "+joinList(classes)+".")
+	}
+
+	rules = append(rules, "Common passwords aren't allowed.")
+
+	if p.MinEntropy > 0 {
+		rules = append(rules, "Repeated characters and sequences like abc or qwerty don't count for much.")
+	}
+
+	if p.BreachCheck {
+		rules = append(rules, "Passwords found in known data breaches aren't allowed.")
+	}
+
+	return rules
+}
+
+// joinList joins items into a readable list, like "a, b and c".
+func joinList(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
@@ -0,0 +1,80 @@
+package password
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"strings"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	p := NewPolicy(8)
+	p.RequireUpper = true
+	p.RequireDigit = true
+
+	err := p.LoadDenyList(strings.NewReader("# Extra passwords\nCorrectHorse1\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{
+			name:     "Valid",
+			password: "validPa$$word1",
+			want:     "",
+		},
+		{
+			name:     "Too short",
+			password: "Pa$$1",
+			want:     "This field must be at least 8 characters long",
+		},
+		{
+			name:     "No uppercase",
+			password: "validpa$$word1",
+			want:     "This field must contain an uppercase letter",
+		},
+		{
+			name:     "No digit",
+			password: "validPa$$word",
+			want:     "This field must contain a digit",
+		},
+		{
+			name:     "Built-in deny list",
+			password: "Password123",
+			want:     "This password is too common, please choose another one",
+		},
+		{
+			name:     "Loaded deny list",
+			password: "correcthorse1",
+			want:     "This field must contain an uppercase letter",
+		},
+		{
+			name:     "Loaded deny list with classes",
+			password: "CorrectHorse1",
+			want:     "This password is too common, please choose another one",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asserts.Equal(t, p.Check(tt.password), tt.want)
+		})
+	}
+}
+
+func TestPolicyDescribe(t *testing.T) {
+	p := NewPolicy(10)
+	p.RequireUpper = true
+	p.RequireLower = true
+	p.RequireSymbol = true
+	p.BreachCheck = true
+
+	rules := p.Describe()
+
+	asserts.Equal(t, len(rules), 4)
+	asserts.Equal(t, rules[0], "At least 10 characters long.")
+	asserts.Equal(t, rules[1], "Must contain an uppercase letter, a lowercase letter and a symbol.")
+}
@@ -0,0 +1,61 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PwnedChecker checks passwords against the Have I Been Pwned Pwned Passwords service. It uses the k-anonymity
+// range API, so only the first 5 characters of the password's SHA-1 hash ever leave the server.
+type PwnedChecker struct {
+	Client  *http.Client
+	BaseURL string
+}
+
+// NewPwnedChecker returns a PwnedChecker for the public API, which gives up after the timeout.
+func NewPwnedChecker(timeout time.Duration) *PwnedChecker {
+	return &PwnedChecker{
+		Client:  &http.Client{Timeout: timeout},
+		BaseURL: "https://api.pwnedpasswords.com",
+	}
+}
+
+func (c *PwnedChecker) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// Ask for the response to be padded with fake entries, so the size of the response doesn't give anything away either.
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("password: unexpected status from pwned passwords API: %s", resp.Status)
+	}
+
+	// Each line of the response is a hash suffix and the number of times it has been seen, like "0018A45C4D1DEF81644B54AB7F969B88D65:10".
+	// Padding entries have a count of 0.
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && lineSuffix == suffix && count != "0" {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
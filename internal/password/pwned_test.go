@@ -0,0 +1,36 @@
+package password
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPwnedChecker(t *testing.T) {
+	// The SHA-1 hash of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/range/5BAA6" {
+			w.Write([]byte("0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n"))
+			return
+		}
+		w.Write([]byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"))
+	}))
+	defer ts.Close()
+
+	c := NewPwnedChecker(time.Second)
+	c.BaseURL = ts.URL
+
+	breached, err := c.Breached("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	asserts.Equal(t, breached, true)
+
+	breached, err = c.Breached("not in the list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	asserts.Equal(t, breached, false)
+}
@@ -0,0 +1,92 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// keyboardRows are the rows of a US keyboard, and the digits. Runs of neighbouring keys, like "qwerty" or "4321", are nearly
+// as easy to guess as a single key.
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// Entropy estimates how hard a password is to guess, in bits. It starts from the number of bits needed to pick each
+// character at random from the kinds of character the password uses (lowercase, uppercase, digits, symbols and anything
+// else), then gives a single bit to each character which repeats the one before it, or continues a sequence like "abc",
+// "321" or "qwerty".
+// It's deliberately simple. It doesn't know about words, so "correcthorse" scores the same as random letters, which is
+// why the policy also has a deny list and the breach check.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLower(r):
+			lower = true
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			upper = true
+		case r < unicode.MaxASCII && unicode.IsDigit(r):
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(pool))
+
+	var bits float64
+	var prev rune = -1
+	for _, r := range password {
+		if prev >= 0 && predictable(prev, r) {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = r
+	}
+
+	return bits
+}
+
+// predictable reports whether next is an easy guess after prev: the same character again, the next or previous letter or
+// digit, or a neighbouring key on the same keyboard row. Case is ignored.
+func predictable(prev, next rune) bool {
+	prev, next = unicode.ToLower(prev), unicode.ToLower(next)
+
+	if prev == next {
+		return true
+	}
+
+	if (isAlnum(prev) && isAlnum(next)) && (next == prev+1 || next == prev-1) {
+		return true
+	}
+
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, prev)
+		j := strings.IndexRune(row, next)
+		if i >= 0 && j >= 0 && (j == i+1 || j == i-1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAlnum reports whether r is an ASCII letter or digit.
+func isAlnum(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+}
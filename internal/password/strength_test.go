@@ -0,0 +1,79 @@
+package password
+
+import (
+	"testing"
+)
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		min      float64
+		max      float64
+	}{
+		{
+			name:     "Empty",
+			password: "",
+			min:      0,
+			max:      0,
+		},
+		{
+			name:     "Repeated character",
+			password: "aaaaaaaaaaaa",
+			min:      0,
+			max:      20,
+		},
+		{
+			name:     "Alphabet sequence",
+			password: "abcdefghijkl",
+			min:      0,
+			max:      20,
+		},
+		{
+			name:     "Keyboard row",
+			password: "qwertyuiop",
+			min:      0,
+			max:      15,
+		},
+		{
+			name:     "Digit sequence",
+			password: "9876543210",
+			min:      0,
+			max:      15,
+		},
+		{
+			name:     "Random letters",
+			password: "kdjqhtmw",
+			min:      35,
+			max:      40,
+		},
+		{
+			name:     "Mixed classes",
+			password: "validPa$$word",
+			min:      70,
+			max:      90,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Entropy(tt.password)
+			if got < tt.min || got > tt.max {
+				t.Errorf("got %.1f bits; want between %.0f and %.0f", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestPolicyMinEntropy(t *testing.T) {
+	p := NewPolicy(8)
+	p.MinEntropy = 30
+
+	if got := p.Check("zxcvbnmasdf"); got != "This password is too easy to guess, try making it longer or less predictable" {
+		t.Errorf("got %q for a keyboard pattern; want the strength message", got)
+	}
+
+	if got := p.Check("tUrn1ps&Kale"); got != "" {
+		t.Errorf("got %q for a strong password; want no message", got)
+	}
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Result describes the state of a client's rate limit after a request. It holds everything needed
+// to tell the client how to behave, whether that's in RateLimit-* headers or on a "slow down" page.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// Limiter is a fixed window rate limiter, which allows each key (usually a client IP address) a number of
+// requests per window. It is safe for concurrent use, so a single Limiter can be shared by every route.
+type Limiter struct {
+	mu        sync.Mutex
+	limit     int
+	period    time.Duration
+	windows   map[string]*window
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New returns a Limiter which allows limit requests per key in every period.
+func New(limit int, period time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		period:  period,
+		windows: make(map[string]*window),
+		now:     time.Now,
+	}
+}
+
+// Allow records a request for the key and reports whether it is within the limit.
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	// Every so often, throw away the windows which have ended, so that the map doesn't keep growing
+	// with clients we'll never see again.
+	if now.Sub(l.lastSweep) > l.period {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.period {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.period {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+
+	w.count++
+
+	remaining := l.limit - w.count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return Result{
+		Allowed:   w.count <= l.limit,
+		Limit:     l.limit,
+		Remaining: remaining,
+		Reset:     w.start.Add(l.period).Sub(now),
+	}
+}
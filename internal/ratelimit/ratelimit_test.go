@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	l := New(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	r := l.Allow("192.0.2.1")
+	asserts.Equal(t, r.Allowed, true)
+	asserts.Equal(t, r.Remaining, 1)
+	asserts.Equal(t, r.Reset, time.Minute)
+
+	now = now.Add(10 * time.Second)
+	r = l.Allow("192.0.2.1")
+	asserts.Equal(t, r.Allowed, true)
+	asserts.Equal(t, r.Remaining, 0)
+	asserts.Equal(t, r.Reset, 50*time.Second)
+
+	r = l.Allow("192.0.2.1")
+	asserts.Equal(t, r.Allowed, false)
+	asserts.Equal(t, r.Remaining, 0)
+
+	// Other clients have their own limit.
+	r = l.Allow("192.0.2.2")
+	asserts.Equal(t, r.Allowed, true)
+
+	// Once the window has passed, requests are allowed again.
+	now = now.Add(50 * time.Second)
+	r = l.Allow("192.0.2.1")
+	asserts.Equal(t, r.Allowed, true)
+	asserts.Equal(t, r.Remaining, 1)
+}
@@ -0,0 +1,291 @@
+// Package slo measures how well the application is meeting its service level objectives, without needing a metrics
+// pipeline. It counts requests, failures and slow responses for each class of route, and works out burn rates over a few
+// fixed windows: how fast the error budget is being used up, where 1 means exactly as fast as the objective allows.
+//
+// The ratios are worked out in-process, so an alert can be a plain threshold on one series, like the multiwindow
+// burn-rate alerts from the Google SRE workbook:
+//
+//	snippetbox_slo_burn_rate{slo="availability",window="1h"} > 14.4 and snippetbox_slo_burn_rate{slo="availability",window="5m"} > 14.4
+package slo
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The objectives that burn rates are worked out for.
+const (
+	Availability = "availability"
+	Latency      = "latency"
+)
+
+// Windows are the lengths of time that burn rates are worked out over. The short windows catch sudden outages quickly,
+// and the long ones catch slow leaks of the error budget.
+var Windows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+// Requests are counted in buckets of this length, and a window is made up of the latest buckets, including the one
+// which is still being filled.
+const bucketLength = time.Minute
+
+// Objectives holds the service level objectives. Availability is the fraction of requests which must not fail with a
+// 5xx status, like 0.999. Latency is the fraction of requests which must be answered within LatencyThreshold.
+type Objectives struct {
+	Availability     float64
+	Latency          float64
+	LatencyThreshold time.Duration
+}
+
+type bucket struct {
+	index  int64
+	counts counts
+}
+
+type counts struct {
+	requests int64
+	errors   int64
+	slow     int64
+}
+
+func (c *counts) add(other counts) {
+	c.requests += other.requests
+	c.errors += other.errors
+	c.slow += other.slow
+}
+
+// classStats holds the counts for one class of route: the totals since the Tracker was made, and a ring of buckets
+// covering the longest window.
+type classStats struct {
+	total   counts
+	buckets []bucket
+}
+
+// Tracker counts requests for each class of route. It is safe for concurrent use, because every request is recorded.
+type Tracker struct {
+	mu         sync.Mutex
+	objectives Objectives
+	classes    map[string]*classStats
+	// The now function returns the current time. It's a field so that tests can control the clock.
+	now func() time.Time
+}
+
+// New returns a Tracker for the objectives. The classes are registered straight away, so that they're reported (with
+// no requests) before any requests have been made, rather than appearing later.
+func New(o Objectives, classes ...string) *Tracker {
+	t := &Tracker{
+		objectives: o,
+		classes:    map[string]*classStats{},
+		now:        time.Now,
+	}
+
+	for _, class := range classes {
+		t.class(class)
+	}
+
+	return t
+}
+
+func (t *Tracker) class(name string) *classStats {
+	c, ok := t.classes[name]
+	if !ok {
+		c = &classStats{buckets: make([]bucket, int(slices.Max(Windows)/bucketLength))}
+		t.classes[name] = c
+	}
+
+	return c
+}
+
+// Record counts a request for a class of route. Responses with a 5xx status count against availability, and responses
+// which took longer than the latency threshold count against latency.
+func (t *Tracker) Record(class string, status int, duration time.Duration) {
+	var c counts
+	c.requests = 1
+	if status >= 500 {
+		c.errors = 1
+	}
+	if duration > t.objectives.LatencyThreshold {
+		c.slow = 1
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.class(class)
+	stats.total.add(c)
+
+	index := t.now().UnixNano() / int64(bucketLength)
+	b := &stats.buckets[index%int64(len(stats.buckets))]
+	if b.index != index {
+		*b = bucket{index: index}
+	}
+	b.counts.add(c)
+}
+
+// WindowStats holds the counts for one class of route over one window, along with the ratios worked out from them.
+// The ratios are 0 when there weren't any requests.
+type WindowStats struct {
+	Window           time.Duration
+	Requests         int64
+	Errors           int64
+	Slow             int64
+	ErrorRatio       float64
+	SlowRatio        float64
+	AvailabilityBurn float64
+	LatencyBurn      float64
+}
+
+// ClassStats holds the counts for one class of route since the Tracker was made, and the stats for each of the Windows.
+type ClassStats struct {
+	Class    string
+	Requests int64
+	Errors   int64
+	Slow     int64
+	Windows  []WindowStats
+}
+
+// Snapshot holds the objectives and the stats for every class of route, in alphabetical order.
+type Snapshot struct {
+	Objectives Objectives
+	Classes    []ClassStats
+}
+
+// Snapshot works out the stats for every class of route as they are now.
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := t.now().UnixNano() / int64(bucketLength)
+
+	snapshot := Snapshot{Objectives: t.objectives}
+
+	for name, stats := range t.classes {
+		class := ClassStats{
+			Class:    name,
+			Requests: stats.total.requests,
+			Errors:   stats.total.errors,
+			Slow:     stats.total.slow,
+		}
+
+		for _, window := range Windows {
+			var c counts
+
+			oldest := current - int64(window/bucketLength) + 1
+			for _, b := range stats.buckets {
+				if b.index >= oldest && b.index <= current {
+					c.add(b.counts)
+				}
+			}
+
+			class.Windows = append(class.Windows, t.windowStats(window, c))
+		}
+
+		snapshot.Classes = append(snapshot.Classes, class)
+	}
+
+	slices.SortFunc(snapshot.Classes, func(a, b ClassStats) int {
+		return cmp.Compare(a.Class, b.Class)
+	})
+
+	return snapshot
+}
+
+func (t *Tracker) windowStats(window time.Duration, c counts) WindowStats {
+	ws := WindowStats{
+		Window:   window,
+		Requests: c.requests,
+		Errors:   c.errors,
+		Slow:     c.slow,
+	}
+
+	if c.requests == 0 {
+		return ws
+	}
+
+	ws.ErrorRatio = float64(c.errors) / float64(c.requests)
+	ws.SlowRatio = float64(c.slow) / float64(c.requests)
+	ws.AvailabilityBurn = burnRate(ws.ErrorRatio, t.objectives.Availability)
+	ws.LatencyBurn = burnRate(ws.SlowRatio, t.objectives.Latency)
+
+	return ws
+}
+
+// burnRate divides the ratio of bad requests by the ratio that the objective allows.
+func burnRate(ratio, objective float64) float64 {
+	budget := 1 - objective
+	if budget <= 0 {
+		return 0
+	}
+
+	return ratio / budget
+}
+
+// Label returns the window's length, formatted with WindowLabel.
+func (ws WindowStats) Label() string {
+	return WindowLabel(ws.Window)
+}
+
+// WindowLabel formats a window length the way Prometheus writes durations, like "5m" or "6h".
+func WindowLabel(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition format.
+func (s Snapshot) WritePrometheus(w io.Writer) error {
+	var out []byte
+
+	metric := func(name, kind, help string) {
+		out = fmt.Appendf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	metric("snippetbox_requests_total", "counter", "Requests handled, by class of route.")
+	for _, c := range s.Classes {
+		out = fmt.Appendf(out, "snippetbox_requests_total{class=%q} %d\n", c.Class, c.Requests)
+	}
+
+	metric("snippetbox_request_errors_total", "counter", "Requests which failed with a 5xx status, by class of route.")
+	for _, c := range s.Classes {
+		out = fmt.Appendf(out, "snippetbox_request_errors_total{class=%q} %d\n", c.Class, c.Errors)
+	}
+
+	metric("snippetbox_slow_requests_total", "counter", "Requests which took longer than the latency threshold, by class of route.")
+	for _, c := range s.Classes {
+		out = fmt.Appendf(out, "snippetbox_slow_requests_total{class=%q} %d\n", c.Class, c.Slow)
+	}
+
+	metric("snippetbox_slo_objective", "gauge", "The fraction of requests which should be good, for each objective.")
+	out = fmt.Appendf(out, "snippetbox_slo_objective{slo=%q} %s\n", Availability, float(s.Objectives.Availability))
+	out = fmt.Appendf(out, "snippetbox_slo_objective{slo=%q} %s\n", Latency, float(s.Objectives.Latency))
+
+	metric("snippetbox_slo_latency_threshold_seconds", "gauge", "Requests which take longer than this count against the latency objective.")
+	out = fmt.Appendf(out, "snippetbox_slo_latency_threshold_seconds %s\n", float(s.Objectives.LatencyThreshold.Seconds()))
+
+	metric("snippetbox_slo_error_ratio", "gauge", "The fraction of requests in the window which were bad, for each objective and class of route.")
+	for _, c := range s.Classes {
+		for _, ws := range c.Windows {
+			out = fmt.Appendf(out, "snippetbox_slo_error_ratio{class=%q,slo=%q,window=%q} %s\n", c.Class, Availability, WindowLabel(ws.Window), float(ws.ErrorRatio))
+			out = fmt.Appendf(out, "snippetbox_slo_error_ratio{class=%q,slo=%q,window=%q} %s\n", c.Class, Latency, WindowLabel(ws.Window), float(ws.SlowRatio))
+		}
+	}
+
+	metric("snippetbox_slo_burn_rate", "gauge", "How fast the error budget was used up in the window, where 1 is as fast as the objective allows.")
+	for _, c := range s.Classes {
+		for _, ws := range c.Windows {
+			out = fmt.Appendf(out, "snippetbox_slo_burn_rate{class=%q,slo=%q,window=%q} %s\n", c.Class, Availability, WindowLabel(ws.Window), float(ws.AvailabilityBurn))
+			out = fmt.Appendf(out, "snippetbox_slo_burn_rate{class=%q,slo=%q,window=%q} %s\n", c.Class, Latency, WindowLabel(ws.Window), float(ws.LatencyBurn))
+		}
+	}
+
+	_, err := w.Write(out)
+	return err
+}
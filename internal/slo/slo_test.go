@@ -0,0 +1,107 @@
+package slo
+
+import (
+	"bytes"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+
+	tracker := New(Objectives{Availability: 0.99, Latency: 0.9, LatencyThreshold: 500 * time.Millisecond}, "api", "pages")
+	tracker.now = func() time.Time { return now }
+
+	// An hour ago: 10 good requests and 10 failures, which are only in the longer windows.
+	now = now.Add(-time.Hour + time.Minute)
+	for i := 0; i < 10; i++ {
+		tracker.Record("pages", 200, time.Millisecond)
+		tracker.Record("pages", 503, time.Millisecond)
+	}
+
+	// Just now: 99 good requests (9 of them slow) and 1 failure.
+	now = now.Add(time.Hour - time.Minute)
+	for i := 0; i < 90; i++ {
+		tracker.Record("pages", 200, time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		tracker.Record("pages", 404, time.Second)
+	}
+	tracker.Record("pages", 500, time.Millisecond)
+
+	snapshot := tracker.Snapshot()
+
+	asserts.Equal(t, len(snapshot.Classes), 2)
+
+	// The api class was registered up front, so it's there without any requests.
+	api := snapshot.Classes[0]
+	asserts.Equal(t, api.Class, "api")
+	asserts.Equal(t, api.Requests, 0)
+	asserts.Equal(t, api.Windows[0].AvailabilityBurn, 0.0)
+
+	pages := snapshot.Classes[1]
+	asserts.Equal(t, pages.Class, "pages")
+	asserts.Equal(t, pages.Requests, 120)
+	asserts.Equal(t, pages.Errors, 11)
+	asserts.Equal(t, pages.Slow, 9)
+
+	tests := []struct {
+		window           time.Duration
+		requests         int64
+		availabilityBurn float64
+		latencyBurn      float64
+	}{
+		// 1 failure in 100 requests is exactly the 1% that the availability objective allows, and 9 slow requests in
+		// 100 is 90% of the 10% that the latency objective allows.
+		{window: 5 * time.Minute, requests: 100, availabilityBurn: 1, latencyBurn: 0.9},
+		{window: 30 * time.Minute, requests: 100, availabilityBurn: 1, latencyBurn: 0.9},
+		// The requests from an hour ago are in the 1h window, because it includes the minute they were made in.
+		{window: time.Hour, requests: 120, availabilityBurn: 11.0 / 120 / 0.01, latencyBurn: 9.0 / 120 / 0.1},
+		{window: 6 * time.Hour, requests: 120, availabilityBurn: 11.0 / 120 / 0.01, latencyBurn: 9.0 / 120 / 0.1},
+	}
+
+	for i, tt := range tests {
+		t.Run(WindowLabel(tt.window), func(t *testing.T) {
+			ws := pages.Windows[i]
+
+			asserts.Equal(t, ws.Window, tt.window)
+			asserts.Equal(t, ws.Requests, tt.requests)
+			asserts.Equal(t, math.Abs(ws.AvailabilityBurn-tt.availabilityBurn) < 1e-9, true)
+			asserts.Equal(t, math.Abs(ws.LatencyBurn-tt.latencyBurn) < 1e-9, true)
+		})
+	}
+
+	// Six hours later, the old buckets have dropped out of every window, but the totals are kept.
+	now = now.Add(6 * time.Hour)
+	snapshot = tracker.Snapshot()
+
+	pages = snapshot.Classes[1]
+	asserts.Equal(t, pages.Requests, 120)
+	for _, ws := range pages.Windows {
+		asserts.Equal(t, ws.Requests, 0)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	tracker := New(Objectives{Availability: 0.999, Latency: 0.99, LatencyThreshold: 300 * time.Millisecond}, "api")
+	tracker.Record("api", 500, time.Millisecond)
+
+	var buf bytes.Buffer
+	err := tracker.Snapshot().WritePrometheus(&buf)
+	asserts.NilError(t, err)
+
+	body := buf.String()
+	asserts.StringContains(t, body, "# TYPE snippetbox_requests_total counter\nsnippetbox_requests_total{class=\"api\"} 1\n")
+	asserts.StringContains(t, body, "snippetbox_slo_objective{slo=\"availability\"} 0.999\n")
+	asserts.StringContains(t, body, "snippetbox_slo_latency_threshold_seconds 0.3\n")
+	asserts.StringContains(t, body, "snippetbox_slo_error_ratio{class=\"api\",slo=\"availability\",window=\"5m\"} 1\n")
+	asserts.StringContains(t, body, "snippetbox_slo_burn_rate{class=\"api\",slo=\"latency\",window=\"6h\"} 0\n")
+}
+
+func TestWindowLabel(t *testing.T) {
+	asserts.Equal(t, WindowLabel(5*time.Minute), "5m")
+	asserts.Equal(t, WindowLabel(90*time.Minute), "90m")
+	asserts.Equal(t, WindowLabel(6*time.Hour), "6h")
+}
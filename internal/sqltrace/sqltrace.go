@@ -0,0 +1,220 @@
+// Package sqltrace times every query that goes through a database/sql driver, by wrapping the driver's connections. Each
+// query is named after the function which ran it, like "SnippetModel.Latest", so that the latency metrics can be broken
+// down without naming queries by hand. Queries which take longer than a threshold are passed to a function for logging.
+//
+// Only the time until a query returns is measured, not the time spent reading its rows.
+package sqltrace
+
+import (
+	"cmp"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Buckets are the upper bounds of the latency histogram's buckets.
+var Buckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+// Query is a query which has been run.
+type Query struct {
+	// Name is the exported function or method which ran the query, like "SnippetModel.Latest", or "other" if there
+	// isn't one.
+	Name string
+	// Caller is the file and line in that function, like "snippets.go:215".
+	Caller   string
+	SQL      string
+	Duration time.Duration
+	Err      error
+}
+
+// QueryStats is what's been measured for the queries with one name.
+type QueryStats struct {
+	Name    string
+	Count   int64
+	Errors  int64
+	Slow    int64
+	Total   time.Duration
+	Buckets []int64 // The number of queries within each of the Buckets.
+}
+
+// Tracer measures queries. It is safe for concurrent use.
+type Tracer struct {
+	threshold time.Duration
+	slow      func(Query)
+
+	mu    sync.Mutex
+	stats map[string]*QueryStats
+}
+
+// New returns a Tracer which calls slow for each query that takes longer than the threshold. A threshold of 0 (or a nil
+// function) turns that off, but the queries are still measured.
+func New(threshold time.Duration, slow func(Query)) *Tracer {
+	return &Tracer{threshold: threshold, slow: slow, stats: make(map[string]*QueryStats)}
+}
+
+// Connector wraps a driver's connector, so that the queries on its connections are measured. Pass the result to
+// sql.OpenDB.
+func (t *Tracer) Connector(c driver.Connector) driver.Connector {
+	return &connector{Connector: c, tracer: t}
+}
+
+// Snapshot holds the stats for every name of query, in alphabetical order.
+type Snapshot struct {
+	Queries []QueryStats
+}
+
+// Snapshot copies what's been measured so far.
+func (t *Tracer) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var snapshot Snapshot
+	for _, s := range t.stats {
+		qs := *s
+		qs.Buckets = slices.Clone(s.Buckets)
+		snapshot.Queries = append(snapshot.Queries, qs)
+	}
+
+	slices.SortFunc(snapshot.Queries, func(a, b QueryStats) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return snapshot
+}
+
+// observe records a query which was started at start and has just returned err.
+func (t *Tracer) observe(stmt string, start time.Time, err error) {
+	// driver.ErrSkip means that database/sql will try another way, like preparing the statement, which is measured then.
+	if err == driver.ErrSkip {
+		return
+	}
+
+	d := time.Since(start)
+	name, caller := callerName()
+	slow := t.threshold > 0 && d > t.threshold
+
+	t.mu.Lock()
+	s, ok := t.stats[name]
+	if !ok {
+		s = &QueryStats{Name: name, Buckets: make([]int64, len(Buckets))}
+		t.stats[name] = s
+	}
+	s.Count++
+	s.Total += d
+	if err != nil {
+		s.Errors++
+	}
+	if slow {
+		s.Slow++
+	}
+	for i, bound := range Buckets {
+		if d <= bound {
+			s.Buckets[i]++
+		}
+	}
+	t.mu.Unlock()
+
+	if slow && t.slow != nil {
+		t.slow(Query{Name: name, Caller: caller, SQL: strings.Join(strings.Fields(stmt), " "), Duration: d, Err: err})
+	}
+}
+
+// callerName finds the exported function or method which ran a query, skipping the frames in database/sql, this
+// package, and unexported helpers (like a closure inside the method, or a function shared by several methods).
+func callerName() (string, string) {
+	var pcs [32]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if name, ok := exportedName(frame.Function); ok {
+			return name, filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return "other", ""
+		}
+	}
+}
+
+// exportedName turns a function's full name, like "github.com/0xshiku/snippetbox/internal/models.(*SnippetModel).Latest",
+// into "SnippetModel.Latest". It reports false for functions which aren't exported, or are in packages to skip.
+func exportedName(function string) (string, bool) {
+	if strings.HasPrefix(function, "database/sql.") || strings.HasPrefix(function, "runtime.") ||
+		strings.HasPrefix(function, "github.com/0xshiku/snippetbox/internal/sqltrace.") {
+		return "", false
+	}
+
+	// Drop the package path, then the package name.
+	name := function[strings.LastIndex(function, "/")+1:]
+	_, name, ok := strings.Cut(name, ".")
+	if !ok {
+		return "", false
+	}
+
+	// Closures are named after the function they're in, with .func1 and so on added. They count as part of it.
+	var parts []string
+	for _, part := range strings.Split(name, ".") {
+		if strings.HasPrefix(part, "func") && len(part) > 4 && unicode.IsDigit(rune(part[4])) {
+			break
+		}
+		parts = append(parts, strings.TrimSuffix(strings.TrimPrefix(part, "(*"), ")"))
+	}
+
+	// Both the type (for methods) and the function have to be exported.
+	for _, part := range parts {
+		if part == "" || !unicode.IsUpper(rune(part[0])) {
+			return "", false
+		}
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+
+	return strings.Join(parts, "."), true
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition format.
+func (snapshot Snapshot) WritePrometheus(w io.Writer) error {
+	var out []byte
+
+	metric := func(name, kind, help string) {
+		out = fmt.Appendf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	seconds := func(d time.Duration) string {
+		return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+	}
+
+	metric("snippetbox_db_query_duration_seconds", "histogram", "How long database queries took, by the function which ran them.")
+	for _, s := range snapshot.Queries {
+		for i, bound := range Buckets {
+			out = fmt.Appendf(out, "snippetbox_db_query_duration_seconds_bucket{query=%q,le=%q} %d\n", s.Name, seconds(bound), s.Buckets[i])
+		}
+		out = fmt.Appendf(out, "snippetbox_db_query_duration_seconds_bucket{query=%q,le=\"+Inf\"} %d\n", s.Name, s.Count)
+		out = fmt.Appendf(out, "snippetbox_db_query_duration_seconds_sum{query=%q} %s\n", s.Name, seconds(s.Total))
+		out = fmt.Appendf(out, "snippetbox_db_query_duration_seconds_count{query=%q} %d\n", s.Name, s.Count)
+	}
+
+	metric("snippetbox_db_query_errors_total", "counter", "Database queries which failed, by the function which ran them.")
+	for _, s := range snapshot.Queries {
+		out = fmt.Appendf(out, "snippetbox_db_query_errors_total{query=%q} %d\n", s.Name, s.Errors)
+	}
+
+	metric("snippetbox_db_slow_queries_total", "counter", "Database queries which took longer than the slow query threshold, by the function which ran them.")
+	for _, s := range snapshot.Queries {
+		out = fmt.Appendf(out, "snippetbox_db_slow_queries_total{query=%q} %d\n", s.Name, s.Slow)
+	}
+
+	_, err := w.Write(out)
+	return err
+}
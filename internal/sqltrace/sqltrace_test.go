@@ -0,0 +1,148 @@
+package sqltrace_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"github.com/0xshiku/snippetbox/internal/sqltrace"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fake driver takes as long as a query's first argument says, and fails the queries which say "fail". Queries
+// without arguments are run directly on the connection, and the rest through prepared statements, like the MySQL
+// driver does.
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query: query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) > 0 {
+		return nil, driver.ErrSkip
+	}
+	return run(query, 0)
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return 1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return run(s.query, time.Duration(args[0].(int64)))
+}
+
+func run(query string, d time.Duration) (driver.Rows, error) {
+	time.Sleep(d)
+	if strings.Contains(query, "fail") {
+		return nil, errors.New("failed")
+	}
+	return fakeRows{}, nil
+}
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return []string{"n"} }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+// The queries are named after these methods, as if they were the models.
+type SnippetModel struct {
+	DB *sql.DB
+}
+
+func (m *SnippetModel) Latest(d time.Duration) error {
+	return query(m.DB, "SELECT   latest\n\tFROM snippets WHERE ?", d)
+}
+
+func (m *SnippetModel) Get() error {
+	// Closures count as part of the method they're in.
+	return func() error {
+		return query(m.DB, "SELECT get FROM snippets")
+	}()
+}
+
+func (m *SnippetModel) Delete() error {
+	return query(m.DB, "DELETE fail")
+}
+
+// query is unexported, so it's skipped.
+func query(db *sql.DB, stmt string, args ...any) error {
+	rows, err := db.Query(stmt, args...)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+func TestTracer(t *testing.T) {
+	var slow []sqltrace.Query
+	tracer := sqltrace.New(20*time.Millisecond, func(q sqltrace.Query) {
+		slow = append(slow, q)
+	})
+
+	db := sql.OpenDB(tracer.Connector(fakeConnector{}))
+	defer db.Close()
+	m := &SnippetModel{DB: db}
+
+	asserts.NilError(t, m.Latest(0))
+	asserts.NilError(t, m.Latest(30*time.Millisecond))
+	asserts.NilError(t, m.Get())
+	if m.Delete() == nil {
+		t.Fatal("want an error from Delete")
+	}
+	asserts.NilError(t, query(db, "SELECT other"))
+
+	// Only the slow query was passed on, with its statement on one line.
+	asserts.Equal(t, len(slow), 1)
+	asserts.Equal(t, slow[0].Name, "SnippetModel.Latest")
+	asserts.Equal(t, slow[0].SQL, "SELECT latest FROM snippets WHERE ?")
+	asserts.StringContains(t, slow[0].Caller, "sqltrace_test.go:")
+	asserts.Equal(t, slow[0].Duration >= 30*time.Millisecond, true)
+
+	snapshot := tracer.Snapshot()
+	var names []string
+	for _, qs := range snapshot.Queries {
+		names = append(names, qs.Name)
+	}
+	asserts.Equal(t, strings.Join(names, ","), "SnippetModel.Delete,SnippetModel.Get,SnippetModel.Latest,TestTracer")
+
+	latest := snapshot.Queries[2]
+	asserts.Equal(t, latest.Count, 2)
+	asserts.Equal(t, latest.Slow, 1)
+	asserts.Equal(t, latest.Errors, 0)
+	asserts.Equal(t, latest.Buckets[0] >= 1, true)
+	asserts.Equal(t, latest.Buckets[len(latest.Buckets)-1], 2)
+
+	del := snapshot.Queries[0]
+	asserts.Equal(t, del.Count, 1)
+	asserts.Equal(t, del.Errors, 1)
+
+	var buf bytes.Buffer
+	asserts.NilError(t, snapshot.WritePrometheus(&buf))
+
+	out := buf.String()
+	asserts.StringContains(t, out, "# TYPE snippetbox_db_query_duration_seconds histogram\n")
+	asserts.StringContains(t, out, `snippetbox_db_query_duration_seconds_bucket{query="SnippetModel.Latest",le="5"} 2`+"\n")
+	asserts.StringContains(t, out, `snippetbox_db_query_duration_seconds_bucket{query="SnippetModel.Latest",le="+Inf"} 2`+"\n")
+	asserts.StringContains(t, out, `snippetbox_db_query_duration_seconds_count{query="SnippetModel.Get"} 1`+"\n")
+	asserts.StringContains(t, out, `snippetbox_db_query_errors_total{query="SnippetModel.Delete"} 1`+"\n")
+	asserts.StringContains(t, out, `snippetbox_db_slow_queries_total{query="SnippetModel.Latest"} 1`+"\n")
+}
@@ -0,0 +1,93 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// These are the parameters used by Google Authenticator and most other authenticator apps (RFC 6238 defaults).
+const (
+	Digits = 6
+	Period = 30 * time.Second
+)
+
+// encoding is the base32 encoding used for secrets, which is what authenticator apps expect.
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random 160-bit secret, base32 encoded.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// Code returns the code for the secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return code(key, uint64(t.Unix()/int64(Period.Seconds()))), nil
+}
+
+// Validate reports whether the code is correct for the secret at time t. Codes from one period either side
+// are also accepted, to allow for clock drift and the time it takes the user to type the code in.
+func Validate(secret, passcode string, t time.Time) bool {
+	passcode = strings.ReplaceAll(strings.TrimSpace(passcode), " ", "")
+	if len(passcode) != Digits {
+		return false
+	}
+
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return false
+	}
+
+	counter := uint64(t.Unix() / int64(Period.Seconds()))
+
+	for _, c := range []uint64{counter - 1, counter, counter + 1} {
+		if subtle.ConstantTimeCompare([]byte(code(key, c)), []byte(passcode)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// URL returns the otpauth:// URL for adding the secret to an authenticator app.
+func URL(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+
+	return fmt.Sprintf("otpauth://totp/%s:%s?%s", url.PathEscape(issuer), url.PathEscape(account), v.Encode())
+}
+
+// code implements the HOTP algorithm from RFC 4226.
+func code(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1000000)
+}
@@ -0,0 +1,56 @@
+package totp
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+	"time"
+)
+
+// The secret "12345678901234567890" from the RFC 6238 test vectors, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		asserts.Equal(t, got, tt.want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	asserts.Equal(t, Validate(rfcSecret, "005924", now), true)
+	asserts.Equal(t, Validate(rfcSecret, "005 924", now), true)
+	asserts.Equal(t, Validate(rfcSecret, "005924", now.Add(Period)), true)
+	asserts.Equal(t, Validate(rfcSecret, "005924", now.Add(3*Period)), false)
+	asserts.Equal(t, Validate(rfcSecret, "000000", now), false)
+	asserts.Equal(t, Validate(rfcSecret, "12345", now), false)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asserts.Equal(t, len(secret), 32)
+
+	code, err := Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	asserts.Equal(t, Validate(secret, code, time.Now()), true)
+}
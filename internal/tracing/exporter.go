@@ -0,0 +1,294 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FromEnv returns a Tracer configured by the standard OpenTelemetry environment variables, read with getenv:
+//
+//   - OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT with /v1/traces added, is where spans are sent.
+//     Tracing is off (and FromEnv returns nil) unless one of them is set.
+//   - OTEL_EXPORTER_OTLP_(TRACES_)HEADERS are extra headers for the collector, like "api-key=secret".
+//   - OTEL_EXPORTER_OTLP_(TRACES_)TIMEOUT is how long an export can take, in milliseconds.
+//   - OTEL_EXPORTER_OTLP_(TRACES_)PROTOCOL has to be "http/json", if it's set, as that's the only one supported.
+//   - OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES describe the service.
+//   - OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG choose which traces are recorded.
+//   - OTEL_BSP_SCHEDULE_DELAY, OTEL_BSP_MAX_QUEUE_SIZE and OTEL_BSP_MAX_EXPORT_BATCH_SIZE control batching.
+//   - OTEL_SDK_DISABLED=true, or OTEL_TRACES_EXPORTER=none, turns tracing off.
+func FromEnv(getenv func(string) string) (*Tracer, error) {
+	env := func(name string) string {
+		if value := getenv("OTEL_EXPORTER_OTLP_TRACES_" + name); value != "" {
+			return value
+		}
+		return getenv("OTEL_EXPORTER_OTLP_" + name)
+	}
+
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil, nil
+	}
+	switch getenv("OTEL_TRACES_EXPORTER") {
+	case "", "otlp":
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("tracing: unsupported OTEL_TRACES_EXPORTER %q", getenv("OTEL_TRACES_EXPORTER"))
+	}
+
+	endpoint := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" && getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		endpoint = strings.TrimSuffix(getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "/") + "/v1/traces"
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("tracing: invalid OTLP endpoint %q", endpoint)
+	}
+
+	if protocol := env("PROTOCOL"); protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("tracing: unsupported OTLP protocol %q (only http/json is supported)", protocol)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	extra, err := parsePairs(env("HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: invalid OTLP headers: %w", err)
+	}
+	for _, attr := range extra {
+		header.Set(attr.Key, attr.Value.(string))
+	}
+
+	timeout, err := envInt(env, "TIMEOUT", 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := parsePairs(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: invalid OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	serviceName := getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "snippetbox"
+	}
+	resource = append([]Attr{{Key: "service.name", Value: serviceName}}, resource...)
+
+	s, err := parseSampler(getenv("OTEL_TRACES_SAMPLER"), getenv("OTEL_TRACES_SAMPLER_ARG"))
+	if err != nil {
+		return nil, err
+	}
+
+	delay, err := envInt(getenv, "OTEL_BSP_SCHEDULE_DELAY", 5000)
+	if err != nil {
+		return nil, err
+	}
+	queueSize, err := envInt(getenv, "OTEL_BSP_MAX_QUEUE_SIZE", 2048)
+	if err != nil {
+		return nil, err
+	}
+	batchSize, err := envInt(getenv, "OTEL_BSP_MAX_EXPORT_BATCH_SIZE", 512)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tracer{
+		sampler: s,
+		exporter: &exporter{
+			url:       u.String(),
+			header:    header,
+			client:    &http.Client{Timeout: time.Duration(timeout) * time.Millisecond},
+			resource:  resource,
+			queue:     make(chan *Span, queueSize),
+			full:      make(chan struct{}, 1),
+			batchSize: min(batchSize, queueSize),
+			delay:     time.Duration(delay) * time.Millisecond,
+		},
+	}, nil
+}
+
+// Endpoint returns the URL that spans are sent to, or "" for a nil Tracer.
+func (t *Tracer) Endpoint() string {
+	if t == nil {
+		return ""
+	}
+	return t.exporter.url
+}
+
+// envInt reads a whole number from an environment variable, which has to be positive if it's set.
+func envInt(getenv func(string) string, name string, fallback int) (int, error) {
+	value := getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("tracing: %s must be a positive whole number", name)
+	}
+	return n, nil
+}
+
+// parsePairs parses a list like "key1=value1,key2=value2", where the values are URL-encoded.
+func parsePairs(s string) ([]Attr, error) {
+	var attrs []Attr
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%q isn't key=value", pair)
+		}
+
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, Attr{Key: key, Value: value})
+	}
+	return attrs, nil
+}
+
+// parseSampler parses OTEL_TRACES_SAMPLER and its argument. The default is parentbased_always_on.
+func parseSampler(name, arg string) (sampler, error) {
+	ratio := 1.0
+	if arg != "" && strings.HasSuffix(name, "traceidratio") {
+		var err error
+		ratio, err = strconv.ParseFloat(arg, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return sampler{}, fmt.Errorf("tracing: OTEL_TRACES_SAMPLER_ARG must be a number from 0 to 1")
+		}
+	}
+
+	switch name {
+	case "", "parentbased_always_on":
+		return sampler{ratio: 1, parentBased: true}, nil
+	case "parentbased_always_off":
+		return sampler{ratio: 0, parentBased: true}, nil
+	case "parentbased_traceidratio":
+		return sampler{ratio: ratio, parentBased: true}, nil
+	case "always_on":
+		return sampler{ratio: 1}, nil
+	case "always_off":
+		return sampler{ratio: 0}, nil
+	case "traceidratio":
+		return sampler{ratio: ratio}, nil
+	default:
+		return sampler{}, fmt.Errorf("tracing: unsupported OTEL_TRACES_SAMPLER %q", name)
+	}
+}
+
+// exporter batches the spans which have ended, and sends them to the collector.
+type exporter struct {
+	url       string
+	header    http.Header
+	client    *http.Client
+	resource  []Attr
+	queue     chan *Span
+	full      chan struct{}
+	batchSize int
+	delay     time.Duration
+	dropped   atomic.Int64
+}
+
+// enqueue adds a span to the next batch. If the queue is full, because the collector can't keep up, the span is dropped
+// rather than holding up the request.
+func (e *exporter) enqueue(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.dropped.Add(1)
+		return
+	}
+
+	if len(e.queue) >= e.batchSize {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run exports the queued spans every OTEL_BSP_SCHEDULE_DELAY, or sooner when a batch is full, for as long as the
+// application runs. Failed exports (and dropped spans) are passed to logError, and those spans are lost.
+func (t *Tracer) Run(logError func(error)) {
+	for {
+		select {
+		case <-time.After(t.exporter.delay):
+		case <-t.exporter.full:
+		}
+
+		err := t.Flush()
+		if err != nil {
+			logError(err)
+		}
+		if dropped := t.exporter.dropped.Swap(0); dropped > 0 {
+			logError(fmt.Errorf("tracing: dropped %d spans because the export queue was full", dropped))
+		}
+	}
+}
+
+// Flush exports the spans which are queued, in batches.
+func (t *Tracer) Flush() error {
+	e := t.exporter
+
+	for {
+		batch := make([]*Span, 0, e.batchSize)
+	fill:
+		for len(batch) < e.batchSize {
+			select {
+			case s := <-e.queue:
+				batch = append(batch, s)
+			default:
+				break fill
+			}
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := e.export(batch)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(encodeSpans(e.resource, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = e.header.Clone()
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("tracing: exporting %d spans: %w", len(spans), err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("tracing: exporting %d spans: %w", len(spans), errors.New(resp.Status))
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+// Package tracing records OpenTelemetry traces, without depending on the OpenTelemetry SDK. It does just what the
+// application needs: spans with attributes, W3C trace context propagation, sampling, and exporting to a collector with
+// OTLP over HTTP, in its JSON encoding. It's configured with the standard OTEL_ environment variables (see FromEnv).
+//
+// A nil *Tracer and a nil *Span are valid, and do nothing, so code can be instrumented whether tracing is on or not.
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TraceID identifies a trace: a request and everything done to answer it, across services.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies one span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Kind says what sort of operation a span is. The values are OTLP's.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Attr is an attribute of a span. Values can be strings, ints, int64s, float64s or bools.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// spanContext is what's passed on from a span to its children, in the same process or (in a traceparent header) in
+// another one.
+type spanContext struct {
+	traceID TraceID
+	spanID  SpanID
+	sampled bool
+}
+
+// Span is an operation within a trace. Its methods are meant to be called by the goroutine that started it.
+type Span struct {
+	tracer *Tracer
+	sc     spanContext
+	parent SpanID
+	name   string
+	kind   Kind
+	start  time.Time
+	end    time.Time
+	attrs  []Attr
+	err    string
+	ended  bool
+}
+
+// SetName changes the name of the span, for when a better one is only known after it's started.
+func (s *Span) SetName(name string) {
+	if s != nil {
+		s.name = name
+	}
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s != nil {
+		s.attrs = append(s.attrs, attrs...)
+	}
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s != nil && err != nil {
+		s.err = err.Error()
+	}
+}
+
+// TraceID returns the ID of the span's trace, or "" for a nil span.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.sc.traceID.String()
+}
+
+// End finishes the span, and queues it to be exported if it was sampled. Calling End again does nothing.
+func (s *Span) End() {
+	if s == nil || s.ended {
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+
+	if s.sc.sampled {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+type contextKey int
+
+const (
+	spanContextKey contextKey = iota
+	remoteContextKey
+)
+
+// ContextWithSpan returns a copy of ctx which carries the span, so that spans started from it are its children.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey, s)
+}
+
+// SpanFromContext returns the span that ctx carries, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey).(*Span)
+	return s
+}
+
+// parentOf returns the span context of the span that ctx carries, or of the remote parent extracted from a request.
+func parentOf(ctx context.Context) (spanContext, bool) {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc, true
+	}
+	sc, ok := ctx.Value(remoteContextKey).(spanContext)
+	return sc, ok
+}
+
+// Tracer starts spans and exports them. Make one with FromEnv.
+type Tracer struct {
+	sampler  sampler
+	exporter *exporter
+}
+
+// Start starts a span as a child of the one in ctx (if any), and returns a copy of ctx which carries the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind, attrs ...Attr) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent, hasParent := parentOf(ctx)
+
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: attrs}
+	binary.BigEndian.PutUint64(s.sc.spanID[:], rand.Uint64())
+
+	if hasParent {
+		s.sc.traceID = parent.traceID
+		s.parent = parent.spanID
+	} else {
+		binary.BigEndian.PutUint64(s.sc.traceID[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(s.sc.traceID[8:], rand.Uint64())
+	}
+	s.sc.sampled = t.sampler.sample(s.sc.traceID, parent, hasParent)
+
+	return ContextWithSpan(ctx, s), s
+}
+
+// Extract returns a copy of ctx with the remote parent from the request's traceparent header, so that the spans
+// started from it join the caller's trace. Malformed headers are ignored, as the W3C spec says.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, ok := parseTraceparent(header.Get("traceparent"))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteContextKey, sc)
+}
+
+// Inject sets the traceparent header for an outgoing request, so that the service it goes to can join the trace of
+// the span in ctx. It does nothing if ctx doesn't carry a span.
+func Inject(ctx context.Context, header http.Header) {
+	sc, ok := parentOf(ctx)
+	if !ok {
+		return
+	}
+
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	header.Set("traceparent", fmt.Sprintf("00-%s-%s-%s", sc.traceID, sc.spanID, flags))
+}
+
+// parseTraceparent parses a version 00 traceparent header, like 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+// Later versions can add fields on the end, which are ignored.
+func parseTraceparent(value string) (spanContext, bool) {
+	var sc spanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != len(sc.traceID) || strings.ToLower(parts[1]) != parts[1] {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != len(sc.spanID) || strings.ToLower(parts[2]) != parts[2] {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, false
+	}
+
+	copy(sc.traceID[:], traceID)
+	copy(sc.spanID[:], spanID)
+	if sc.traceID == (TraceID{}) || sc.spanID == (SpanID{}) {
+		return sc, false
+	}
+	sc.sampled = flags[0]&1 == 1
+
+	return sc, true
+}
+
+// sampler decides which traces are recorded, like OTEL_TRACES_SAMPLER's samplers. With parentBased set, a span with a
+// parent follows the parent's decision, and only root spans are sampled by ratio.
+type sampler struct {
+	ratio       float64
+	parentBased bool
+}
+
+func (s sampler) sample(traceID TraceID, parent spanContext, hasParent bool) bool {
+	if s.parentBased && hasParent {
+		return parent.sampled
+	}
+
+	// Compare the random part of the trace ID with the ratio, so that every service makes the same decision for a trace.
+	switch {
+	case s.ratio >= 1:
+		return true
+	case s.ratio <= 0:
+		return false
+	default:
+		return binary.BigEndian.Uint64(traceID[8:])>>11 < uint64(s.ratio*(1<<53))
+	}
+}
@@ -0,0 +1,171 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantOK      bool
+		wantSampled bool
+	}{
+		{name: "Sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantOK: true, wantSampled: true},
+		{name: "Not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", wantOK: true},
+		{name: "Later version with more fields", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantOK: true, wantSampled: true},
+		{name: "Version 00 with more fields", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{name: "Invalid version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "Zero trace ID", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "Zero span ID", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "Upper case", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{name: "Short trace ID", value: "00-4bf92f3577b34da6-00f067aa0ba902b7-01"},
+		{name: "Empty", value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := parseTraceparent(tt.value)
+			asserts.Equal(t, ok, tt.wantOK)
+			asserts.Equal(t, sc.sampled, tt.wantSampled)
+			if ok {
+				asserts.Equal(t, sc.traceID.String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+				asserts.Equal(t, sc.spanID.String(), "00f067aa0ba902b7")
+			}
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantOn  bool
+		wantURL string
+		wantErr bool
+	}{
+		{name: "Not configured", env: map[string]string{}},
+		{name: "Endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/"}, wantOn: true, wantURL: "http://collector:4318/v1/traces"},
+		{name: "Traces endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "https://traces.example.com/otlp"}, wantOn: true, wantURL: "https://traces.example.com/otlp"},
+		{name: "Disabled", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_SDK_DISABLED": "true"}},
+		{name: "No exporter", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_TRACES_EXPORTER": "none"}},
+		{name: "Protobuf", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf"}, wantErr: true},
+		{name: "Invalid endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318"}, wantErr: true},
+		{name: "Invalid headers", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_EXPORTER_OTLP_HEADERS": "api-key"}, wantErr: true},
+		{name: "Invalid sampler", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_TRACES_SAMPLER": "jaeger_remote"}, wantErr: true},
+		{name: "Invalid ratio", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_TRACES_SAMPLER": "traceidratio", "OTEL_TRACES_SAMPLER_ARG": "2"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, err := FromEnv(func(name string) string { return tt.env[name] })
+			asserts.Equal(t, err != nil, tt.wantErr)
+			asserts.Equal(t, tracer != nil, tt.wantOn)
+			if tracer != nil {
+				asserts.Equal(t, tracer.exporter.url, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestSampler(t *testing.T) {
+	traceID := TraceID{15: 1}
+	sampled := spanContext{sampled: true}
+
+	asserts.Equal(t, sampler{ratio: 1, parentBased: true}.sample(traceID, spanContext{}, true), false)
+	asserts.Equal(t, sampler{ratio: 0, parentBased: true}.sample(traceID, sampled, true), true)
+	asserts.Equal(t, sampler{ratio: 0, parentBased: true}.sample(traceID, spanContext{}, false), false)
+	asserts.Equal(t, sampler{ratio: 1}.sample(traceID, spanContext{}, true), true)
+
+	// The trace ID's random part is tiny, so it's under any ratio but 0.
+	asserts.Equal(t, sampler{ratio: 0.01}.sample(traceID, spanContext{}, false), true)
+	asserts.Equal(t, sampler{ratio: 0.01}.sample(TraceID{8: 0xff}, spanContext{}, false), false)
+}
+
+func TestTracer(t *testing.T) {
+	var received otlpRequest
+	var header http.Header
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+	}))
+	defer collector.Close()
+
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": collector.URL,
+		"OTEL_EXPORTER_OTLP_HEADERS":  "api-key=a%20secret",
+		"OTEL_RESOURCE_ATTRIBUTES":    "deployment.environment=test",
+	}
+	tracer, err := FromEnv(func(name string) string { return env[name] })
+	asserts.NilError(t, err)
+
+	// The request comes from a service which has already started the trace.
+	incoming := http.Header{}
+	incoming.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := Extract(context.Background(), incoming)
+
+	ctx, server := tracer.Start(ctx, "GET /snippet/view/:id", KindServer, Attr{Key: "http.request.method", Value: "GET"})
+	_, render := tracer.Start(ctx, "render view.gohtml", KindInternal)
+	render.SetError(errors.New("template failed"))
+	render.End()
+	server.SetAttributes(Attr{Key: "http.response.status_code", Value: 500})
+	server.End()
+	server.End()
+
+	// Outgoing requests carry on the trace from the server span.
+	outgoing := http.Header{}
+	Inject(ctx, outgoing)
+	asserts.Equal(t, outgoing.Get("traceparent"), "00-4bf92f3577b34da6a3ce929d0e0e4736-"+server.sc.spanID.String()+"-01")
+
+	asserts.NilError(t, tracer.Flush())
+
+	asserts.Equal(t, header.Get("Content-Type"), "application/json")
+	asserts.Equal(t, header.Get("Api-Key"), "a secret")
+
+	rs := received.ResourceSpans[0]
+	asserts.Equal(t, len(rs.Resource.Attributes), 2)
+	asserts.Equal(t, *rs.Resource.Attributes[0].Value.StringValue, "snippetbox")
+	asserts.Equal(t, rs.Resource.Attributes[1].Key, "deployment.environment")
+
+	spans := rs.ScopeSpans[0].Spans
+	asserts.Equal(t, len(spans), 2)
+
+	asserts.Equal(t, spans[0].Name, "render view.gohtml")
+	asserts.Equal(t, spans[0].TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	asserts.Equal(t, spans[0].ParentSpanID, server.sc.spanID.String())
+	asserts.Equal(t, spans[0].Status.Message, "template failed")
+
+	asserts.Equal(t, spans[1].Name, "GET /snippet/view/:id")
+	asserts.Equal(t, spans[1].Kind, KindServer)
+	asserts.Equal(t, spans[1].ParentSpanID, "00f067aa0ba902b7")
+	asserts.Equal(t, len(spans[1].Attributes), 2)
+	asserts.Equal(t, *spans[1].Attributes[1].Value.IntValue, "500")
+
+	// A parent which wasn't sampled means that nothing is exported.
+	incoming.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracer.Start(Extract(context.Background(), incoming), "GET /", KindServer)
+	span.End()
+	asserts.Equal(t, len(tracer.exporter.queue), 0)
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+
+	ctx, span := tracer.Start(context.Background(), "GET /", KindServer)
+	span.SetName("GET /about")
+	span.SetAttributes(Attr{Key: "http.response.status_code", Value: 200})
+	span.SetError(errors.New("failed"))
+	span.End()
+
+	asserts.Equal(t, span.TraceID(), "")
+	asserts.Equal(t, SpanFromContext(ctx) == nil, true)
+}
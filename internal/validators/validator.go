@@ -1,8 +1,12 @@
 package validators
 
 import (
+	"fmt"
+	"net/url"
 	"regexp"
+	"slices"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -11,17 +15,80 @@ import (
 // Parsing this pattern once at startup and sorting the compiled *regexp.Regexp in a variable is more performant than re-parsing the pattern each time we need it.
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// MaxEmailLength is the longest email address that can be delivered to, as set by RFC 5321. Longer values would also
+// overflow the email columns in the database.
+const MaxEmailLength = 254
+
+// UsernameRX matches usernames made up of 3 to 30 letters, digits, underscores or hyphens.
+// These are used in profile URLs, so we keep them to characters which don't need escaping.
+var UsernameRX = regexp.MustCompile("^[a-zA-Z0-9_-]{3,30}$")
+
+// SlugRX matches lowercase words made up of letters and digits, separated by single hyphens, like "go-generics".
+var SlugRX = regexp.MustCompile("^[a-z0-9]+(?:-[a-z0-9]+)*$")
+
 // Defines a new Validator type which contains a map of validation errors for our form fields
 // Add a new NonFieldErrors []string field to the struct, which we will use to hold any validation errors which are not related to a specific form field
+// The err field holds the first error returned by a rule which looks something up, like Unique(). It isn't a validation
+// error, so it isn't shown to the user.
+// The fieldOrder slice remembers the order that fields first failed in, which is usually the order they appear in the form.
 type Validator struct {
 	NonFieldErrors []string
 	FieldErrors    map[string]string
+	err            error
+	fieldOrder     []string
+}
+
+// FormError is one of a form's errors, as listed in the error summary at the top of the form. Field is empty for errors
+// which aren't about one field.
+type FormError struct {
+	Field   string
+	Message string
+}
+
+// Errors returns all of the errors, for the error summary: the non-field errors first, and then the field errors in the
+// order they were added. It has a value receiver (unlike the other methods), so that templates can call it on the form
+// structs they're given.
+func (v Validator) Errors() []FormError {
+	var errs []FormError
+
+	for _, message := range v.NonFieldErrors {
+		errs = append(errs, FormError{Message: message})
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range v.fieldOrder {
+		if message, ok := v.FieldErrors[key]; ok && !seen[key] {
+			errs = append(errs, FormError{Field: key, Message: message})
+			seen[key] = true
+		}
+	}
+
+	// Errors put straight into the FieldErrors map, rather than through AddFieldError, go last.
+	var rest []string
+	for key := range v.FieldErrors {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	slices.Sort(rest)
+	for _, key := range rest {
+		errs = append(errs, FormError{Field: key, Message: v.FieldErrors[key]})
+	}
+
+	return errs
 }
 
 // Valid() returns true if the FieldErrors map doesn't contain any entries.
 // Update the Valid() method to also check that the NonFieldErrors slice is empty
+// A lookup error also makes the form invalid, because one of its checks couldn't be made.
 func (v *Validator) Valid() bool {
-	return len(v.FieldErrors) == 0 && len(v.NonFieldErrors) == 0
+	return len(v.FieldErrors) == 0 && len(v.NonFieldErrors) == 0 && v.err == nil
+}
+
+// Err() returns the error from a rule which couldn't make its check, like Unique() when the database is down.
+// Handlers should check it before Valid(), and send a server error rather than re-displaying the form.
+func (v *Validator) Err() error {
+	return v.err
 }
 
 // Creates an AddNonFieldError for adding error messages to the new NonFieldErrors slice
@@ -38,6 +105,7 @@ func (v *Validator) AddFieldError(key, message string) {
 
 	if _, exists := v.FieldErrors[key]; !exists {
 		v.FieldErrors[key] = message
+		v.fieldOrder = append(v.fieldOrder, key)
 	}
 }
 
@@ -53,7 +121,9 @@ func NotBlank(value string) bool {
 	return strings.TrimSpace(value) != ""
 }
 
-// MaxChars() returns true if a value contains no more than n characters
+// MaxChars() returns true if a value contains no more than n characters.
+// Characters are counted as runes rather than bytes, so "ü" counts as one character, not two. Each byte of invalid UTF-8
+// counts as one character, so it can't be used to get around the limit.
 func MaxChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) <= n
 }
@@ -88,3 +158,148 @@ func MinChars(value string, n int) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// MaxBytes() returns true if a value is no more than n bytes long. Use it alongside MaxChars() when the limit comes from
+// storage (like a VARBINARY column or a request size), where a multibyte character takes up more than one unit.
+func MaxBytes(value string, n int) bool {
+	return len(value) <= n
+}
+
+// NoControlChars() returns true if a value is valid UTF-8 without any control characters, apart from tabs and line breaks.
+// This keeps out things like NUL bytes and terminal escape sequences, which can't be displayed and might confuse other tools.
+func NoControlChars(value string) bool {
+	if !utf8.ValidString(value) {
+		return false
+	}
+
+	for _, r := range value {
+		if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsSlug() returns true if a value is a slug, like "go-generics". See SlugRX.
+func IsSlug(value string) bool {
+	return SlugRX.MatchString(value)
+}
+
+// IsURL() returns true if a value is an absolute URL with a host, using one of the given schemes. With no schemes,
+// http and https are allowed.
+func IsURL(value string, schemes ...string) bool {
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	return slices.Contains(schemes, strings.ToLower(u.Scheme))
+}
+
+// A Rule is one check on a string field, along with the error message to show if it fails. Rules are combined with
+// CheckString(), which stops at the first one that fails, so the checks and their messages can be reused between forms
+// and the API instead of being written out in each handler.
+type Rule struct {
+	check   func(value string) (bool, error)
+	message string
+}
+
+// NewRule() returns a Rule for any check which isn't covered by the functions below.
+func NewRule(ok func(value string) bool, message string) Rule {
+	return Rule{check: func(value string) (bool, error) { return ok(value), nil }, message: message}
+}
+
+// WithMessage() returns a copy of the rule with a different error message. The default messages suit HTML forms,
+// so the API uses this for its shorter messages, like "must be provided".
+func (r Rule) WithMessage(message string) Rule {
+	r.message = message
+	return r
+}
+
+// Required() fails for blank values.
+func Required() Rule {
+	return NewRule(NotBlank, "This field cannot be blank")
+}
+
+// Length() fails for values with more than n characters.
+func Length(n int) Rule {
+	return NewRule(func(value string) bool { return MaxChars(value, n) }, fmt.Sprintf("This field cannot be more than %d characters long", n))
+}
+
+// Size() fails for values with more than n bytes.
+func Size(n int) Rule {
+	return NewRule(func(value string) bool { return MaxBytes(value, n) }, "This field is too long")
+}
+
+// Printable() fails for values with control characters or invalid UTF-8.
+func Printable() Rule {
+	return NewRule(NoControlChars, "This field cannot contain control characters")
+}
+
+// Slug() fails for values which aren't slugs.
+func Slug() Rule {
+	return NewRule(IsSlug, "This field must be lowercase letters and numbers, separated by hyphens")
+}
+
+// URL() fails for values which aren't absolute URLs with one of the schemes (http or https by default).
+func URL(schemes ...string) Rule {
+	return NewRule(func(value string) bool { return IsURL(value, schemes...) }, "This field must be a full URL, like https://example.com")
+}
+
+// Pattern() fails for values which don't match the regular expression.
+func Pattern(rx *regexp.Regexp, message string) Rule {
+	return NewRule(rx.MatchString, message)
+}
+
+// A Checker looks up whether a value has already been taken, usually with a database query.
+type Checker interface {
+	Taken(value string) (bool, error)
+}
+
+// The CheckerFunc type is an adapter which allows an ordinary function to be used as a Checker.
+type CheckerFunc func(value string) (bool, error)
+
+func (f CheckerFunc) Taken(value string) (bool, error) {
+	return f(value)
+}
+
+// Unique() fails for values which the checker says are already taken, like an email address which is already registered.
+// Put it last in a list of rules, so the lookup is only made for values which passed every other check. If the lookup
+// fails, the error is recorded for Err() instead.
+// A unique value can still be taken by somebody else before it's saved, so the database constraint is what really
+// guarantees uniqueness. This just lets us tell the user sooner, and with the same message.
+func Unique(checker Checker, message string) Rule {
+	return Rule{
+		check: func(value string) (bool, error) {
+			taken, err := checker.Taken(value)
+			return !taken, err
+		},
+		message: message,
+	}
+}
+
+// CheckString() runs the rules against a value in order, and adds the message of the first one that fails to the
+// FieldErrors map. The later rules aren't run, so they can rely on the earlier ones having passed, and a field which
+// already has an error doesn't make any lookups.
+func (v *Validator) CheckString(key, value string, rules ...Rule) {
+	if _, exists := v.FieldErrors[key]; exists || v.err != nil {
+		return
+	}
+
+	for _, rule := range rules {
+		ok, err := rule.check(value)
+		if err != nil {
+			v.err = fmt.Errorf("validating %s: %w", key, err)
+			return
+		}
+		if !ok {
+			v.AddFieldError(key, rule.message)
+			return
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package validators
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// FuzzValidators checks the validator functions against each other on arbitrary input, to make sure none of them panic
+// on invalid UTF-8 and that the length checks agree. Run it with: go test ./internal/validators -run=^$ -fuzz=FuzzValidators
+func FuzzValidators(f *testing.F) {
+	f.Add("alice@example.com", 10)
+	f.Add("  \t\n", 0)
+	f.Add("\xff\xfe", 1)
+	f.Add("ünïcödé_user", 30)
+
+	f.Fuzz(func(t *testing.T, value string, n int) {
+		// Every value is either at most n characters long, or at least n+1 characters long, but not both.
+		if n < math.MaxInt && MaxChars(value, n) == MinChars(value, n+1) {
+			t.Errorf("MaxChars and MinChars disagree for %q and %d", value, n)
+		}
+
+		// Surrounding whitespace doesn't make a value blank or not blank.
+		if NotBlank(value) != NotBlank(" "+value+"\t") {
+			t.Errorf("NotBlank changed with surrounding whitespace for %q", value)
+		}
+
+		// A valid username is 3 to 30 characters, with nothing that needs escaping in a URL.
+		if Matches(value, UsernameRX) {
+			if !MinChars(value, 3) || !MaxChars(value, 30) || strings.ContainsAny(value, "/?#% ") {
+				t.Errorf("UsernameRX matched %q", value)
+			}
+		}
+
+		// A valid email address has an @ and no whitespace.
+		if Matches(value, EmailRX) {
+			if !strings.Contains(value, "@") || strings.ContainsAny(value, " \t\r\n") || !utf8.ValidString(value) {
+				t.Errorf("EmailRX matched %q", value)
+			}
+		}
+
+		// Printable values are always valid UTF-8, and a value is never longer in characters than in bytes.
+		if NoControlChars(value) && !utf8.ValidString(value) {
+			t.Errorf("NoControlChars accepted invalid UTF-8 %q", value)
+		}
+		if n >= 0 && MaxBytes(value, n) && !MaxChars(value, n) {
+			t.Errorf("MaxBytes accepted %q for %d but MaxChars didn't", value, n)
+		}
+
+		// Only the first error for a field is kept.
+		want := "second"
+		if !NotBlank(value) {
+			want = "first"
+		}
+
+		var v Validator
+		v.CheckField(NotBlank(value), "value", "first")
+		v.CheckField(false, "value", "second")
+		if v.Valid() || v.FieldErrors["value"] != want {
+			t.Errorf("got field errors %v; want %q", v.FieldErrors, want)
+		}
+	})
+}
+
+func TestMaxChars(t *testing.T) {
+	// Characters are runes, not bytes.
+	if !MaxChars("ünïcödé", 7) || MaxChars("ünïcödé", 6) {
+		t.Error("MaxChars counted bytes instead of characters")
+	}
+
+	// Invalid UTF-8 can't sneak past the limit.
+	if MaxChars("\xff\xfe\xfd", 2) {
+		t.Error("MaxChars let invalid UTF-8 through")
+	}
+
+	if !MaxBytes("ü", 2) || MaxBytes("ü", 1) {
+		t.Error("MaxBytes didn't count bytes")
+	}
+}
+
+func TestNoControlChars(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"package main\n\tfunc main() {}\r\n", true},
+		{"ünïcödé", true},
+		{"", true},
+		{"nul\x00byte", false},
+		{"\x1b[31mred\x1b[0m", false},
+		{"delete\x7f", false},
+		{"next line\u0085", false},
+		{"invalid \xff utf-8", false},
+	}
+
+	for _, tt := range tests {
+		if got := NoControlChars(tt.value); got != tt.want {
+			t.Errorf("NoControlChars(%q) = %t; want %t", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsSlug(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"go", true},
+		{"go-generics", true},
+		{"web2-0", true},
+		{"", false},
+		{"Go", false},
+		{"-go", false},
+		{"go-", false},
+		{"go--generics", false},
+		{"go_generics", false},
+		{"gö", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSlug(tt.value); got != tt.want {
+			t.Errorf("IsSlug(%q) = %t; want %t", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	tests := []struct {
+		value   string
+		schemes []string
+		want    bool
+	}{
+		{"https://example.com", nil, true},
+		{"HTTP://example.com/path?q=1", nil, true},
+		{"https://example.com", []string{"https"}, true},
+		{"http://example.com", []string{"https"}, false},
+		{"ftp://example.com", nil, false},
+		{"example.com", nil, false},
+		{"/relative/path", nil, false},
+		{"https://", nil, false},
+		{"javascript:alert(1)", nil, false},
+		{"https://exa mple.com", nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsURL(tt.value, tt.schemes...); got != tt.want {
+			t.Errorf("IsURL(%q, %q) = %t; want %t", tt.value, tt.schemes, got, tt.want)
+		}
+	}
+}
+
+func TestCheckString(t *testing.T) {
+	var v Validator
+
+	v.CheckString("title", "Hello", Required(), Length(100), Printable())
+	v.CheckString("blank", " ", Required(), Length(3))
+	v.CheckString("long", "abcd", Required(), Length(3))
+	v.CheckString("api", "", Required().WithMessage("must be provided"))
+	v.CheckString("slug", "Go Generics", Slug())
+	v.CheckString("custom", "odd", NewRule(func(value string) bool { return len(value)%2 == 0 }, "must have an even length"))
+
+	want := map[string]string{
+		"blank":  "This field cannot be blank",
+		"long":   "This field cannot be more than 3 characters long",
+		"api":    "must be provided",
+		"slug":   "This field must be lowercase letters and numbers, separated by hyphens",
+		"custom": "must have an even length",
+	}
+
+	if len(v.FieldErrors) != len(want) {
+		t.Fatalf("got field errors %v; want %v", v.FieldErrors, want)
+	}
+	for key, message := range want {
+		if v.FieldErrors[key] != message {
+			t.Errorf("got %q for %s; want %q", v.FieldErrors[key], key, message)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var v Validator
+
+	v.CheckField(false, "title", "This field cannot be blank")
+	v.AddNonFieldError("Email or password is incorrect")
+	v.CheckField(false, "content", "This field cannot be blank")
+	v.CheckField(false, "title", "This field cannot be more than 100 characters long")
+	v.FieldErrors["expires"] = "This field must equal 1, 7 or 365"
+
+	want := []FormError{
+		{Message: "Email or password is incorrect"},
+		{Field: "title", Message: "This field cannot be blank"},
+		{Field: "content", Message: "This field cannot be blank"},
+		{Field: "expires", Message: "This field must equal 1, 7 or 365"},
+	}
+
+	got := v.Errors()
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	lookups := 0
+	taken := CheckerFunc(func(value string) (bool, error) {
+		lookups++
+		if value == "broken" {
+			return false, errors.New("database is down")
+		}
+		return value == "alice", nil
+	})
+
+	var v Validator
+	v.CheckString("available", "bob", Required(), Unique(taken, "Username is already taken"))
+	v.CheckString("taken", "alice", Required(), Unique(taken, "Username is already taken"))
+	v.CheckString("blank", "", Required(), Unique(taken, "Username is already taken"))
+
+	asserts.Equal(t, len(v.FieldErrors), 2)
+	asserts.Equal(t, v.FieldErrors["taken"], "Username is already taken")
+	asserts.Equal(t, v.FieldErrors["blank"], "This field cannot be blank")
+	asserts.Equal(t, v.Err(), nil)
+
+	// The blank value failed an earlier rule, so it was never looked up.
+	asserts.Equal(t, lookups, 2)
+
+	v.CheckString("broken", "broken", Unique(taken, "Username is already taken"))
+
+	if v.Err() == nil || !strings.Contains(v.Err().Error(), "database is down") {
+		t.Errorf("got error %v; want the lookup error", v.Err())
+	}
+	asserts.Equal(t, v.Valid(), false)
+	asserts.Equal(t, v.FieldErrors["broken"], "")
+}
@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// Delivery is a payload that the mock Deliverer was given.
+type Delivery struct {
+	URL   string
+	Event string
+	Body  []byte
+}
+
+// Deliverer accepts every payload, unless Status is set to something other than 200. It remembers what it was given, so
+// tests can check what would have been sent. Deliveries happen in the background, so it's safe for concurrent use.
+type Deliverer struct {
+	Status int
+
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+func (d *Deliverer) Deliver(webhookURL, secret, deliveryID, event string, body []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.deliveries = append(d.deliveries, Delivery{URL: webhookURL, Event: event, Body: body})
+
+	if d.Status != 0 && d.Status != http.StatusOK {
+		return d.Status, errors.New("mocks: delivery refused")
+	}
+
+	return http.StatusOK, nil
+}
+
+// Deliveries returns the payloads the Deliverer has been given so far.
+func (d *Deliverer) Deliveries() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Delivery(nil), d.deliveries...)
+}
@@ -0,0 +1,174 @@
+// Package webhooks sends signed JSON payloads to URLs that users have registered, when something happens to one of
+// their snippets. Each request carries an HMAC-SHA256 signature of the body, made with a secret that only we and the
+// receiver know, so that the receiver can check that the payload really came from us.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/0xshiku/snippetbox/internal/netguard"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The events that webhooks are sent for. A deleted snippet has been moved to the trash, and a restored one has been
+// taken back out of it.
+const (
+	EventSnippetCreated  = "snippet.created"
+	EventSnippetDeleted  = "snippet.deleted"
+	EventSnippetRestored = "snippet.restored"
+)
+
+// The headers sent with each payload. The signature header holds "sha256=" followed by the hex-encoded HMAC-SHA256 of
+// the request body, in the same format as GitHub's webhooks, so that existing libraries can check it.
+const (
+	HeaderEvent     = "X-Snippetbox-Event"
+	HeaderDelivery  = "X-Snippetbox-Delivery"
+	HeaderSignature = "X-Snippetbox-Signature-256"
+)
+
+// ErrPrivateAddress is returned when a webhook URL resolves to a loopback or private network address, which we refuse
+// to connect to, so that webhooks can't be used to reach services behind our firewall.
+var ErrPrivateAddress = netguard.ErrPrivateAddress
+
+// Snippet holds the parts of a snippet that are sent in a payload. ID is the public ID, as used in the snippet's URL.
+type Snippet struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Visibility string    `json:"visibility"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	URL        string    `json:"url"`
+}
+
+// Payload is the JSON body of a webhook request.
+type Payload struct {
+	Event   string    `json:"event"`
+	Sent    time.Time `json:"sent"`
+	Snippet Snippet   `json:"snippet"`
+}
+
+// Deliverer sends a payload to a webhook URL, and returns the status code of the response. A status code outside the
+// 2xx range is returned along with an error. A status code of 0 means that no response was received.
+type Deliverer interface {
+	Deliver(webhookURL, secret, deliveryID, event string, body []byte) (int, error)
+}
+
+// Client is a Deliverer which makes real requests.
+type Client struct {
+	Client *http.Client
+}
+
+// NewClient returns a Client which gives up after the timeout. It doesn't follow redirects, and won't connect to
+// loopback or private network addresses, even if a public hostname resolves to one.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{
+		Client: &http.Client{
+			Timeout:   timeout,
+			Transport: netguard.Transport(timeout),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// maxResponseBytes limits how much of a response we read. We only want the status code, but reading a little of the
+// body lets the connection be reused.
+const maxResponseBytes = 4 << 10
+
+func (c *Client) Deliver(webhookURL, secret, deliveryID, event string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippetbox-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderSignature, Sign(secret, body))
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhooks: unexpected status from receiver: %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Retryable reports whether a failed delivery with the given status code is worth trying again. Most 4xx responses mean
+// that the receiver doesn't want the payload, so sending it again won't help.
+func Retryable(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// Sign returns the value of the signature header for a request body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the right signature header for the body. It's what a receiver written in Go
+// would do, and compares the signatures in constant time.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// NewSecret returns a random signing secret containing 256 bits of entropy.
+func NewSecret() (string, error) {
+	return randomHex(32)
+}
+
+// NewDeliveryID returns a random ID for the delivery header. Retries of the same payload keep the same ID, so that
+// receivers can tell when they've seen a payload before.
+func NewDeliveryID() (string, error) {
+	return randomHex(16)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// CheckURL returns an error describing what's wrong with a webhook URL, or nil if it's fine. Payloads include the
+// content of unlisted snippets, so it has to use HTTPS.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	switch {
+	case err != nil || u.Host == "":
+		return errors.New("must be a full URL like https://hooks.example.com/snippets")
+	case u.Scheme != "https":
+		return errors.New("must use https")
+	case u.User != nil || u.Fragment != "":
+		return errors.New("must not include a username or fragment")
+	}
+
+	if netguard.PrivateHost(u.Hostname()) {
+		return errors.New("must not point to a private network address")
+	}
+
+	return nil
+}
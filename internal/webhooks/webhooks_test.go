@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"errors"
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeliver(t *testing.T) {
+	const secret = "s3cret"
+
+	var gotBody []byte
+	var gotHeader http.Header
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeader = r.Header
+
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusNoContent)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient(time.Second)
+	c.Client.Transport = ts.Client().Transport
+
+	body := []byte(`{"event":"snippet.created"}`)
+
+	t.Run("Accepted", func(t *testing.T) {
+		status, err := c.Deliver(ts.URL+"/ok", secret, "42", EventSnippetCreated, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		asserts.Equal(t, status, http.StatusNoContent)
+		asserts.Equal(t, string(gotBody), string(body))
+		asserts.Equal(t, gotHeader.Get(HeaderEvent), EventSnippetCreated)
+		asserts.Equal(t, gotHeader.Get(HeaderDelivery), "42")
+		asserts.Equal(t, Verify(secret, gotBody, gotHeader.Get(HeaderSignature)), true)
+	})
+
+	t.Run("Refused", func(t *testing.T) {
+		status, err := c.Deliver(ts.URL+"/gone", secret, "43", EventSnippetCreated, body)
+
+		asserts.Equal(t, status, http.StatusGone)
+		asserts.Equal(t, err != nil, true)
+		asserts.Equal(t, Retryable(status), false)
+	})
+
+	t.Run("Server error", func(t *testing.T) {
+		status, err := c.Deliver(ts.URL+"/broken", secret, "44", EventSnippetCreated, body)
+
+		asserts.Equal(t, status, http.StatusInternalServerError)
+		asserts.Equal(t, err != nil, true)
+		asserts.Equal(t, Retryable(status), true)
+	})
+}
+
+func TestDeliverPrivateAddress(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback address")
+	}))
+	defer ts.Close()
+
+	// Without the test server's transport, the client's own dialer refuses to connect to 127.0.0.1.
+	c := NewClient(time.Second)
+
+	status, err := c.Deliver(ts.URL, "s3cret", "1", EventSnippetCreated, []byte(`{}`))
+
+	asserts.Equal(t, status, 0)
+	asserts.Equal(t, errors.Is(err, ErrPrivateAddress), true)
+}
+
+func TestSign(t *testing.T) {
+	// The expected value was worked out with: printf '{"a":1}' | openssl dgst -sha256 -hmac key
+	asserts.Equal(t, Sign("key", []byte(`{"a":1}`)), "sha256=88a67f24bbcdaed0e6c997404bb79a743baf44c6bab2f4c27328e3009d22e342")
+
+	asserts.Equal(t, Verify("key", []byte(`{"a":1}`), Sign("key", []byte(`{"a":1}`))), true)
+	asserts.Equal(t, Verify("other", []byte(`{"a":1}`), Sign("key", []byte(`{"a":1}`))), false)
+	asserts.Equal(t, Verify("key", []byte(`{"a":2}`), Sign("key", []byte(`{"a":1}`))), false)
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr string
+	}{
+		{name: "Valid", url: "https://hooks.example.com/snippets?token=abc"},
+		{name: "Not a URL", url: "hooks.example.com", wantErr: "must be a full URL"},
+		{name: "Plain HTTP", url: "http://hooks.example.com/", wantErr: "must use https"},
+		{name: "Username", url: "https://me@hooks.example.com/", wantErr: "must not include a username"},
+		{name: "Loopback", url: "https://127.0.0.1/hook", wantErr: "private network address"},
+		{name: "Private", url: "https://10.0.0.5/hook", wantErr: "private network address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckURL(tt.url)
+
+			if tt.wantErr == "" {
+				asserts.NilError(t, err)
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			asserts.StringContains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
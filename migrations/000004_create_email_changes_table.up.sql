@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS email_changes (
+    token_hash BINARY(32) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    new_email VARCHAR(255) NOT NULL,
+    expiry DATETIME NOT NULL,
+    CONSTRAINT email_changes_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+ALTER TABLE snippets DROP FOREIGN KEY snippets_fk_user;
+DROP INDEX idx_snippets_user_created ON snippets;
+ALTER TABLE snippets DROP COLUMN user_id;
+
+ALTER TABLE users DROP INDEX users_uc_username;
+ALTER TABLE users DROP COLUMN username;
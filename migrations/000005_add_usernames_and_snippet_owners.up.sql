@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN username VARCHAR(30) NULL AFTER name;
+ALTER TABLE users ADD CONSTRAINT users_uc_username UNIQUE (username);
+
+ALTER TABLE snippets ADD COLUMN user_id INTEGER NULL;
+ALTER TABLE snippets ADD CONSTRAINT snippets_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX idx_snippets_user_created ON snippets(user_id, created);
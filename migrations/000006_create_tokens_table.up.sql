@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS tokens (
+    hash BINARY(32) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expiry DATETIME NOT NULL,
+    scope VARCHAR(32) NOT NULL,
+    CONSTRAINT tokens_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
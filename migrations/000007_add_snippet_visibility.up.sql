@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN visibility VARCHAR(16) NOT NULL DEFAULT 'public';
@@ -0,0 +1,2 @@
+ALTER TABLE snippets DROP INDEX snippets_uc_public_id;
+ALTER TABLE snippets DROP COLUMN public_id;
@@ -0,0 +1,7 @@
+ALTER TABLE snippets ADD COLUMN public_id VARCHAR(32) NULL AFTER id;
+
+-- Give the existing snippets a random public ID, so that their URLs can't be guessed either.
+UPDATE snippets SET public_id = UPPER(HEX(RANDOM_BYTES(13))) WHERE public_id IS NULL;
+
+ALTER TABLE snippets MODIFY public_id VARCHAR(32) NOT NULL;
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_public_id UNIQUE (public_id);
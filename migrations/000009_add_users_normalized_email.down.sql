@@ -0,0 +1,2 @@
+ALTER TABLE users DROP INDEX users_uc_normalized_email;
+ALTER TABLE users DROP COLUMN normalized_email;
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN normalized_email VARCHAR(255) NULL AFTER email;
+
+-- Existing accounts get the default normalization (lowercased). Accounts which only differed by the case of
+-- their email address will make the unique constraint below fail, and must be merged by hand first.
+UPDATE users SET normalized_email = LOWER(TRIM(email));
+
+ALTER TABLE users MODIFY normalized_email VARCHAR(255) NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_uc_normalized_email UNIQUE (normalized_email);
@@ -0,0 +1,2 @@
+-- Admins are promoted by hand for now, with: UPDATE users SET is_admin = TRUE WHERE email = '...';
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
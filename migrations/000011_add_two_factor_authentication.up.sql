@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) NULL;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    user_id INTEGER NOT NULL,
+    hash BINARY(32) NOT NULL,
+    PRIMARY KEY (user_id, hash),
+    CONSTRAINT recovery_codes_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
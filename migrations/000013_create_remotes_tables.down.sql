@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS snippet_mirrors;
+DROP TABLE IF EXISTS remotes;
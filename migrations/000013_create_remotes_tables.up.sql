@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS remotes (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    base_url VARCHAR(255) NOT NULL,
+    token VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT remotes_uc_user_name UNIQUE (user_id, name),
+    CONSTRAINT remotes_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS snippet_mirrors (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    remote_name VARCHAR(50) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT snippet_mirrors_fk_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- This fails if any Argon2id hashes are left, so switch back to bcrypt and wait for the users to log in first.
+ALTER TABLE users MODIFY hashed_password CHAR(60) NOT NULL;
@@ -0,0 +1,2 @@
+-- Argon2id hashes are longer than bcrypt's 60 characters, and include their parameters, so give them plenty of room.
+ALTER TABLE users MODIFY hashed_password VARCHAR(255) NOT NULL;
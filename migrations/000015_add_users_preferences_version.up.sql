@@ -0,0 +1,2 @@
+-- Incremented whenever the preferences change, so that API clients can avoid overwriting each other's changes.
+ALTER TABLE users ADD COLUMN preferences_version INTEGER NOT NULL DEFAULT 1;
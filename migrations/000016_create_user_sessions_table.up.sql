@@ -0,0 +1,13 @@
+-- An index of the sessions table by user, so that users can see where they're logged in and log other devices out.
+-- The session data itself stays in the sessions table, which belongs to the session manager.
+CREATE TABLE IF NOT EXISTS user_sessions (
+    token CHAR(43) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+    CONSTRAINT user_sessions_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_sessions_user_idx ON user_sessions (user_id, last_seen);
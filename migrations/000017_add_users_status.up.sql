@@ -0,0 +1,2 @@
+-- Whether the user can log in. Admins can suspend an account (for a while) or ban it (for good) without deleting it.
+ALTER TABLE users ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active';
@@ -0,0 +1,10 @@
+-- Archives of everything held about a user, built in the background when they ask for one. Only the most recent export
+-- for each user is kept, and only until it expires.
+CREATE TABLE IF NOT EXISTS data_exports (
+    token_hash BINARY(32) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    archive LONGBLOB NOT NULL,
+    created DATETIME NOT NULL,
+    expiry DATETIME NOT NULL,
+    CONSTRAINT data_exports_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP INDEX idx_users_expires ON users;
+ALTER TABLE users DROP COLUMN expiry_warned;
+ALTER TABLE users DROP COLUMN expires;
@@ -0,0 +1,5 @@
+-- Guest accounts are deleted once they expire. The expiry is NULL for ordinary accounts, which never expire.
+-- expiry_warned records that the guest has been emailed about it, so they're only warned once.
+ALTER TABLE users ADD COLUMN expires DATETIME NULL;
+ALTER TABLE users ADD COLUMN expiry_warned BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX idx_users_expires ON users(expires);
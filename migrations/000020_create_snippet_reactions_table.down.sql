@@ -0,0 +1,2 @@
+ALTER TABLE snippets DROP COLUMN reactions_changed;
+DROP TABLE IF EXISTS snippet_reactions;
@@ -0,0 +1,13 @@
+-- Emoji reactions to snippets. Each user can leave each reaction once on a snippet.
+CREATE TABLE IF NOT EXISTS snippet_reactions (
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    reaction VARCHAR(16) NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (snippet_id, user_id, reaction),
+    CONSTRAINT snippet_reactions_fk_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT snippet_reactions_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- When the reactions to a snippet last changed (including one being taken away), for the view page's Last-Modified header.
+ALTER TABLE snippets ADD COLUMN reactions_changed DATETIME NULL;
@@ -0,0 +1,19 @@
+-- Things that have happened to a user's snippets, for their notifications page. Detail depends on the kind: for a
+-- reaction, it's the name of the reaction. The unique key stops the same event being recorded more than once, so taking
+-- a reaction away and leaving it again doesn't notify the owner twice.
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    detail VARCHAR(16) NOT NULL,
+    created DATETIME NOT NULL,
+    read_at DATETIME NULL,
+    CONSTRAINT notifications_uc_event UNIQUE (user_id, actor_id, snippet_id, kind, detail),
+    CONSTRAINT notifications_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT notifications_fk_actor FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT notifications_fk_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_idx ON notifications (user_id, read_at, created);
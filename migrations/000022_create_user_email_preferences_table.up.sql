@@ -0,0 +1,8 @@
+-- The kinds of notification that each user wants emails about, one row per kind. Users without a row for a kind only see
+-- those notifications on the site.
+CREATE TABLE IF NOT EXISTS user_email_preferences (
+    user_id INTEGER NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    PRIMARY KEY (user_id, kind),
+    CONSTRAINT user_email_preferences_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+-- Users following other users, for the activity feed. The primary key doubles as the index for looking up who somebody
+-- follows, and the second index is for counting their followers.
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id INTEGER NOT NULL,
+    followed_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (follower_id, followed_id),
+    CONSTRAINT follows_fk_follower FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT follows_fk_followed FOREIGN KEY (followed_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX follows_followed_idx ON follows (followed_id);
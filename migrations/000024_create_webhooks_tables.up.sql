@@ -0,0 +1,27 @@
+-- URLs which are sent a signed JSON payload when something happens to one of the user's snippets. The secret has to be
+-- stored as it is, because it's the key for the HMAC signature on each payload.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    url VARCHAR(255) NOT NULL,
+    secret CHAR(64) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT webhooks_uc_user_url UNIQUE (user_id, url),
+    CONSTRAINT webhooks_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Every attempt to deliver a payload, so users can see why their receiver isn't getting them. A status of 0 means that
+-- no response was received at all.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    webhook_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    snippet_public_id VARCHAR(32) NOT NULL,
+    attempt INTEGER NOT NULL,
+    status INTEGER NOT NULL,
+    error_message VARCHAR(255) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL,
+    CONSTRAINT webhook_deliveries_fk_webhook FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_created_idx ON webhook_deliveries (created);
@@ -0,0 +1,14 @@
+-- Drafts which several users can edit at once, before the owner publishes them as a snippet. The content is saved every
+-- few seconds while people are editing, along with the revision it's at, so that an older save can't replace a newer one.
+CREATE TABLE IF NOT EXISTS shared_drafts (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    public_id CHAR(26) NOT NULL,
+    user_id INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    revision INTEGER NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    updated DATETIME NOT NULL,
+    CONSTRAINT shared_drafts_uc_public_id UNIQUE (public_id),
+    CONSTRAINT shared_drafts_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
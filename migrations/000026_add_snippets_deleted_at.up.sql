@@ -0,0 +1,4 @@
+-- When the owner moved the snippet to the trash, or NULL if they haven't. Snippets in the trash are left out of
+-- everything apart from the owner's trash page, until they're restored or purged for good.
+ALTER TABLE snippets ADD COLUMN deleted_at DATETIME NULL;
+CREATE INDEX idx_snippets_deleted_at ON snippets(deleted_at);
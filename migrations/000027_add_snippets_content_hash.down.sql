@@ -0,0 +1,2 @@
+DROP INDEX idx_snippets_content_hash ON snippets;
+ALTER TABLE snippets DROP COLUMN content_hash;
@@ -0,0 +1,4 @@
+-- A SHA-256 hash of the snippet's normalized content, for finding duplicates. Snippets created before this migration
+-- don't have one, so they're never reported as duplicates.
+ALTER TABLE snippets ADD COLUMN content_hash CHAR(64) NULL;
+CREATE INDEX idx_snippets_content_hash ON snippets(content_hash);
@@ -0,0 +1,9 @@
+-- Site-wide settings which admins change from /admin/settings, one row per setting. A setting without a row has its default
+-- value, so the table starts out empty. The values are stored as text, and parsed by the SettingsModel.
+CREATE TABLE IF NOT EXISTS settings (
+    name VARCHAR(64) NOT NULL PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated DATETIME NOT NULL,
+    updated_by INTEGER NULL,
+    CONSTRAINT settings_fk_updated_by FOREIGN KEY (updated_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,7 @@
+-- The current announcement goes back to being the banner in the site settings.
+INSERT INTO settings (name, value, updated, updated_by)
+SELECT 'banner', text, created, created_by FROM announcements
+WHERE expires IS NULL OR expires > UTC_TIMESTAMP()
+ORDER BY id DESC LIMIT 1;
+
+DROP TABLE IF EXISTS announcements;
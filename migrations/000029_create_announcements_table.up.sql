@@ -0,0 +1,17 @@
+-- Announcements which admins publish at the top of every page. Only the newest one is shown: publishing another expires
+-- the ones before it, and so does withdrawing it. Expires is NULL for an announcement that stays up until it's replaced.
+CREATE TABLE IF NOT EXISTS announcements (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    text TEXT NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NULL,
+    created_by INTEGER NULL,
+    CONSTRAINT announcements_fk_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- The banner used to be one of the site settings, so it becomes the first announcement.
+INSERT INTO announcements (text, severity, created, created_by)
+SELECT value, 'info', updated, updated_by FROM settings WHERE name = 'banner' AND value <> '';
+
+DELETE FROM settings WHERE name = 'banner';
@@ -0,0 +1,3 @@
+-- Set when a user logs in with a recovery code, which turns two-factor authentication off. Until they set it up again,
+-- they can't use the rest of the site, however they log in.
+ALTER TABLE users ADD COLUMN must_enroll_2fa BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,10 @@
+-- A record of each time an admin logged in as another user. Stopped is NULL while it's still going, or if the session
+-- ended without the admin stopping (like when it expired). There aren't any foreign keys, so that the record outlives
+-- the accounts it's about.
+CREATE TABLE IF NOT EXISTS impersonations (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    admin_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    started DATETIME NOT NULL,
+    stopped DATETIME NULL
+);
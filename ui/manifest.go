@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+)
+
+// Asset describes one of the embedded files.
+type Asset struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the embedded files with their sizes and hashes. Checksum is a hash of the whole list, so that two
+// binaries with the same Checksum contain exactly the same templates and static files.
+type Manifest struct {
+	Checksum string  `json:"checksum"`
+	Assets   []Asset `json:"assets"`
+}
+
+// NewManifest builds the manifest for the files in fsys. The files are listed in lexical order, so the checksum
+// doesn't depend on the order they happen to be read in.
+func NewManifest(fsys fs.FS) (*Manifest, error) {
+	m := &Manifest{}
+	all := sha256.New()
+
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		f, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		size, err := io.Copy(h, f)
+		if err != nil {
+			return err
+		}
+
+		asset := Asset{Path: path, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+		m.Assets = append(m.Assets, asset)
+
+		// The path is included as well as the hash, so renaming a file changes the checksum too.
+		io.WriteString(all, asset.Path+"\x00"+asset.SHA256+"\n")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.Checksum = hex.EncodeToString(all.Sum(nil))
+	return m, nil
+}
+
+// ShortChecksum returns the first 12 characters of the checksum, which is enough to tell builds apart at a glance.
+func (m *Manifest) ShortChecksum() string {
+	return m.Checksum[:12]
+}
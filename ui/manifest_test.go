@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"github.com/0xshiku/snippetbox/internal/asserts"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"static/css/main.css": {Data: []byte("body {}")},
+		"html/base.gohtml":    {Data: []byte("{{define \"base\"}}{{end}}")},
+	}
+
+	m, err := NewManifest(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asserts.Equal(t, len(m.Assets), 2)
+	asserts.Equal(t, m.Assets[0].Path, "html/base.gohtml")
+	asserts.Equal(t, m.Assets[1].Path, "static/css/main.css")
+	asserts.Equal(t, m.Assets[1].Size, int64(7))
+	// The SHA-256 hash of "body {}".
+	asserts.Equal(t, m.Assets[1].SHA256, "62368a1a29259b30bac235c0e75dc700c9b3bacf1513ad5708e4fe4a6c0d6560")
+	asserts.Equal(t, len(m.ShortChecksum()), 12)
+
+	t.Run("Changed file", func(t *testing.T) {
+		fsys["static/css/main.css"] = &fstest.MapFile{Data: []byte("body { margin: 0 }")}
+
+		changed, err := NewManifest(fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if changed.Checksum == m.Checksum {
+			t.Error("the checksum didn't change")
+		}
+	})
+
+	t.Run("Embedded files", func(t *testing.T) {
+		m, err := NewManifest(Files)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m.Assets) == 0 {
+			t.Error("got no assets")
+		}
+	})
+}
@@ -5,4 +5,496 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+// Single-key keyboard shortcuts. These are ignored while typing in a form field, or when a modifier key is held down.
+var shortcuts = {
+	"h": "/",
+	"n": "/snippet/create",
+	"a": "/account/view",
+	"?": "/about#shortcuts"
+};
+
+document.addEventListener("keydown", function(event) {
+	if (event.ctrlKey || event.metaKey || event.altKey) {
+		return;
+	}
+	var tag = event.target.tagName;
+	if (tag == "INPUT" || tag == "TEXTAREA" || tag == "SELECT" || event.target.isContentEditable) {
+		return;
+	}
+	var path = shortcuts[event.key];
+	if (path) {
+		window.location.href = path;
+	}
+});
+
+// Infinite scrolling on the home page. When the "Older" link comes into view, fetch the next page of snippets and add
+// them to the table, instead of following the link. Without JavaScript, the link still works as normal.
+var more = document.querySelector("a[data-fragment]");
+var table = document.querySelector("table#snippets");
+if (more && table && "IntersectionObserver" in window) {
+	var loading = false;
+	var observer = new IntersectionObserver(function(entries) {
+		if (!entries[0].isIntersecting || loading) {
+			return;
+		}
+		loading = true;
+		fetch(more.dataset.fragment, {headers: {"Accept": "application/json"}})
+			.then(function(response) {
+				if (!response.ok) {
+					throw new Error(response.statusText);
+				}
+				return response.json();
+			})
+			.then(function(fragment) {
+				table.tBodies[0].insertAdjacentHTML("beforeend", fragment.html);
+				if (fragment.next) {
+					more.dataset.fragment = fragment.next;
+					more.href = fragment.next.replace("/fragments/snippets", "/");
+					loading = false;
+				} else {
+					observer.disconnect();
+					more.remove();
+				}
+			})
+			.catch(function() {
+				// Leave the link in place, so the user can still go to the next page.
+				observer.disconnect();
+			});
+	});
+	observer.observe(more);
+}
+
+// Inline validation. Fields with a data-validate attribute are checked by /api/validate shortly after the user stops
+// typing, and any error is shown above the field in the same way as the server would. The server still checks everything
+// when the form is submitted, so a failed request is ignored.
+var validated = document.querySelectorAll("input[data-validate]");
+for (var i = 0; i < validated.length; i++) {
+	(function(input) {
+		var timer;
+		input.addEventListener("input", function() {
+			clearTimeout(timer);
+			timer = setTimeout(function() {
+				var url = "/api/validate?field=" + encodeURIComponent(input.dataset.validate) + "&value=" + encodeURIComponent(input.value);
+				fetch(url, {headers: {"Accept": "application/json"}})
+					.then(function(response) {
+						if (!response.ok) {
+							throw new Error(response.statusText);
+						}
+						return response.json();
+					})
+					.then(function(result) {
+						var label = input.parentNode.querySelector("label.error");
+						if (result.valid) {
+							if (label) {
+								label.remove();
+							}
+							input.removeAttribute("aria-invalid");
+							input.removeAttribute("aria-describedby");
+							return;
+						}
+						if (!label) {
+							label = document.createElement("label");
+							label.className = "error";
+							label.id = input.id + "-error";
+							input.parentNode.insertBefore(label, input);
+						}
+						label.textContent = result.error;
+						input.setAttribute("aria-invalid", "true");
+						input.setAttribute("aria-describedby", label.id);
+					})
+					.catch(function() {});
+			}, 400);
+		});
+	})(validated[i]);
+}
+
+// When a form comes back with errors, move the focus to the summary of them, so that screen readers read it out first.
+// Its links jump to the fields with errors.
+var errorSummary = document.getElementById("error-summary");
+if (errorSummary) {
+	errorSummary.focus();
+}
+
+// The create page's preview. Pressing the button swaps the content box for the snippet as the server would render it,
+// and pressing it again goes back to editing. Without JavaScript, the button stays hidden.
+var previewButton = document.getElementById("preview-button");
+var preview = document.getElementById("preview");
+if (previewButton && preview) {
+	var previewed = previewButton.form.querySelector("textarea[name='content']");
+	previewButton.hidden = false;
+	previewButton.addEventListener("click", function() {
+		if (!preview.hidden) {
+			preview.hidden = true;
+			previewed.hidden = false;
+			previewButton.textContent = "Preview";
+			previewed.focus();
+			return;
+		}
+		// The form is sent as it is, so the CSRF token goes with it.
+		fetch("/snippet/preview", {
+			method: "POST",
+			headers: {"Accept": "application/json"},
+			body: new URLSearchParams(new FormData(previewButton.form))
+		})
+			.then(function(response) {
+				if (!response.ok) {
+					throw new Error(response.statusText);
+				}
+				return response.json();
+			})
+			.then(function(result) {
+				preview.innerHTML = result.html;
+				preview.hidden = false;
+				previewed.hidden = true;
+				previewButton.textContent = "Edit";
+			})
+			.catch(function() {
+				preview.textContent = "The preview couldn't be loaded.";
+				preview.hidden = false;
+			});
+	});
+}
+
+// The API docs page. Each operation has a form for trying it out, which sends the request with the user's session
+// and shows the response. Without JavaScript, the Send buttons stay hidden.
+var tryIts = document.querySelectorAll("form.try-it");
+for (var i = 0; i < tryIts.length; i++) {
+	(function(form) {
+		var output = form.querySelector(".try-it-response");
+		form.querySelector("button").hidden = false;
+		form.addEventListener("submit", function(event) {
+			event.preventDefault();
+			var path = form.dataset.path;
+			var query = new URLSearchParams();
+			var headers = {"Accept": "application/json"};
+			var inputs = form.querySelectorAll("input[data-in]");
+			for (var j = 0; j < inputs.length; j++) {
+				var input = inputs[j];
+				if (input.value === "") {
+					continue;
+				}
+				switch (input.dataset.in) {
+				case "path":
+					path = path.replace("{" + input.name + "}", encodeURIComponent(input.value));
+					break;
+				case "query":
+					query.append(input.name, input.value);
+					break;
+				case "header":
+					headers[input.name] = input.value;
+					break;
+				}
+			}
+			if (query.toString() !== "") {
+				path += "?" + query.toString();
+			}
+			var options = {method: form.dataset.method, headers: headers, credentials: "same-origin"};
+			if (form.elements.body) {
+				headers["Content-Type"] = form.dataset.type || "application/json";
+				options.body = form.elements.body.value;
+			}
+			fetch(path, options)
+				.then(function(response) {
+					return response.text().then(function(text) {
+						output.textContent = response.status + " " + response.statusText + "\n\n" + text;
+						output.hidden = false;
+					});
+				})
+				.catch(function(err) {
+					output.textContent = "The request couldn't be sent: " + err.message;
+					output.hidden = false;
+				});
+		});
+	})(tryIts[i]);
+}
+
+// Shared drafts. Changes are sent to the server as operations in the same format as the ot package: an array where a
+// positive number keeps that many characters, a negative number deletes that many, and a string is inserted. Like
+// ot.js, the editor has at most one operation waiting for the server to acknowledge it (outstanding), and collects any
+// changes made in the meantime into another (buffer). Operations from other people are transformed against both.
+var collab = document.getElementById("collab");
+if (collab && "WebSocket" in window) {
+	var ot = {
+		retain: function(op, n) {
+			if (n <= 0) return;
+			var last = op[op.length - 1];
+			if (typeof last == "number" && last > 0) {
+				op[op.length - 1] += n;
+			} else {
+				op.push(n);
+			}
+		},
+		insert: function(op, s) {
+			if (s === "") return;
+			var last = op[op.length - 1];
+			if (typeof last == "string") {
+				op[op.length - 1] += s;
+			} else if (typeof last == "number" && last < 0) {
+				// Inserts go before deletes, as they do on the server.
+				if (typeof op[op.length - 2] == "string") {
+					op[op.length - 2] += s;
+				} else {
+					op.splice(op.length - 1, 0, s);
+				}
+			} else {
+				op.push(s);
+			}
+		},
+		remove: function(op, n) {
+			if (n <= 0) return;
+			var last = op[op.length - 1];
+			if (typeof last == "number" && last < 0) {
+				op[op.length - 1] -= n;
+			} else {
+				op.push(-n);
+			}
+		},
+		// length returns how many characters a step covers.
+		length: function(c) {
+			return typeof c == "string" ? c.length : Math.abs(c);
+		},
+		apply: function(op, doc) {
+			var out = "", i = 0;
+			for (var k = 0; k < op.length; k++) {
+				var c = op[k];
+				if (typeof c == "string") {
+					out += c;
+				} else if (c > 0) {
+					out += doc.slice(i, i + c);
+					i += c;
+				} else {
+					i -= c;
+				}
+			}
+			return out;
+		},
+		// transform returns [a', b'] for two operations made on the same document, with a's inserts first.
+		transform: function(a, b) {
+			var ap = [], bp = [], i = 0, j = 0, ac = a[0], bc = b[0];
+			while (ac !== undefined || bc !== undefined) {
+				if (typeof ac == "string") {
+					ot.insert(ap, ac);
+					ot.retain(bp, ac.length);
+					ac = a[++i];
+					continue;
+				}
+				if (typeof bc == "string") {
+					ot.retain(ap, bc.length);
+					ot.insert(bp, bc);
+					bc = b[++j];
+					continue;
+				}
+				if (ac === undefined || bc === undefined) {
+					throw new Error("operations don't match");
+				}
+				var n = Math.min(Math.abs(ac), Math.abs(bc));
+				if (ac > 0 && bc > 0) {
+					ot.retain(ap, n);
+					ot.retain(bp, n);
+				} else if (ac < 0 && bc > 0) {
+					ot.remove(ap, n);
+				} else if (ac > 0 && bc < 0) {
+					ot.remove(bp, n);
+				}
+				ac = ac > 0 ? ac - n : ac + n;
+				bc = bc > 0 ? bc - n : bc + n;
+				if (ac === 0) ac = a[++i];
+				if (bc === 0) bc = b[++j];
+			}
+			return [ap, bp];
+		},
+		// compose returns one operation which has the same effect as a followed by b.
+		compose: function(a, b) {
+			var out = [], i = 0, j = 0, ac = a[0], bc = b[0];
+			while (ac !== undefined || bc !== undefined) {
+				if (typeof ac == "number" && ac < 0) {
+					ot.remove(out, -ac);
+					ac = a[++i];
+					continue;
+				}
+				if (typeof bc == "string") {
+					ot.insert(out, bc);
+					bc = b[++j];
+					continue;
+				}
+				if (ac === undefined || bc === undefined) {
+					throw new Error("operations don't match");
+				}
+				var n = Math.min(ot.length(ac), ot.length(bc));
+				if (typeof ac == "string") {
+					if (bc > 0) {
+						ot.insert(out, ac.slice(0, n));
+					}
+					// Text which a inserted and b deleted again is left out altogether.
+					ac = ac.slice(n);
+				} else {
+					if (bc > 0) {
+						ot.retain(out, n);
+					} else {
+						ot.remove(out, n);
+					}
+					ac -= n;
+				}
+				bc = bc > 0 ? bc - n : bc + n;
+				if (ac === 0 || ac === "") ac = a[++i];
+				if (bc === 0) bc = b[++j];
+			}
+			return out;
+		},
+		// moveIndex works out where a position in the document ends up after an operation.
+		moveIndex: function(op, index) {
+			var moved = index, i = 0;
+			for (var k = 0; k < op.length && i < index; k++) {
+				var c = op[k];
+				if (typeof c == "string") {
+					moved += c.length;
+				} else if (c > 0) {
+					i += c;
+				} else {
+					moved -= Math.min(-c, index - i);
+					i -= c;
+				}
+			}
+			return moved;
+		}
+	};
+
+	var editor = collab.querySelector("textarea");
+	var stateLabel = document.getElementById("collab-state");
+	var usersLabel = document.getElementById("collab-users");
+	var errorLabel = document.getElementById("collab-error");
+	var socket, revision = 0, outstanding = null, buffer = null, shown = editor.value, closed = false;
+
+	var showError = function(message, url) {
+		errorLabel.textContent = message || "";
+		if (url) {
+			var link = document.createElement("a");
+			link.href = url;
+			link.textContent = "See the snippet";
+			errorLabel.appendChild(document.createTextNode(" "));
+			errorLabel.appendChild(link);
+		}
+		errorLabel.hidden = !message;
+	};
+
+	var send = function(op) {
+		outstanding = op;
+		socket.send(JSON.stringify({type: "op", revision: revision, op: op}));
+	};
+
+	// diff turns whatever has been typed since the last change into an operation. It only finds one changed region, which
+	// is all a single input event can make, and never splits a character made of two UTF-16 code units.
+	var diff = function() {
+		var before = shown, after = editor.value;
+		if (before == after) return;
+		var start = 0;
+		while (start < before.length && start < after.length && before.charCodeAt(start) == after.charCodeAt(start)) {
+			start++;
+		}
+		if (start > 0 && /[\ud800-\udbff]/.test(before.charAt(start - 1))) {
+			start--;
+		}
+		var end = 0;
+		while (end < before.length - start && end < after.length - start &&
+			before.charCodeAt(before.length - 1 - end) == after.charCodeAt(after.length - 1 - end)) {
+			end++;
+		}
+		if (end > 0 && /[\udc00-\udfff]/.test(before.charAt(before.length - end))) {
+			end--;
+		}
+		var op = [];
+		ot.retain(op, start);
+		ot.insert(op, after.slice(start, after.length - end));
+		ot.remove(op, before.length - start - end);
+		ot.retain(op, end);
+		shown = after;
+		if (outstanding === null) {
+			send(op);
+		} else {
+			buffer = buffer === null ? op : ot.compose(buffer, op);
+		}
+	};
+
+	// show puts someone else's change into the editor, keeping the cursor and selection where they were in the text.
+	var show = function(op) {
+		var start = ot.moveIndex(op, editor.selectionStart);
+		var end = ot.moveIndex(op, editor.selectionEnd);
+		shown = ot.apply(op, shown);
+		editor.value = shown;
+		if (document.activeElement == editor) {
+			editor.setSelectionRange(start, end);
+		}
+	};
+
+	var receive = function(event) {
+		var message = JSON.parse(event.data);
+		diff();
+		switch (message.type) {
+		case "init":
+			revision = message.revision;
+			outstanding = null;
+			buffer = null;
+			shown = message.content || "";
+			editor.value = shown;
+			editor.readOnly = false;
+			stateLabel.textContent = "Connected.";
+			showError(message.error);
+			break;
+		case "ack":
+			revision = message.revision;
+			outstanding = null;
+			if (buffer !== null) {
+				var next = buffer;
+				buffer = null;
+				send(next);
+			}
+			break;
+		case "op":
+			revision = message.revision;
+			var op = message.op, pair;
+			if (outstanding !== null) {
+				pair = ot.transform(outstanding, op);
+				outstanding = pair[0];
+				op = pair[1];
+			}
+			if (buffer !== null) {
+				pair = ot.transform(buffer, op);
+				buffer = pair[0];
+				op = pair[1];
+			}
+			show(op);
+			break;
+		case "closed":
+			closed = true;
+			editor.readOnly = true;
+			stateLabel.textContent = "Closed.";
+			showError(message.error, message.url);
+			break;
+		}
+		if (message.users) {
+			usersLabel.textContent = message.users.join(", ");
+		}
+	};
+
+	var connect = function() {
+		var scheme = window.location.protocol == "https:" ? "wss://" : "ws://";
+		socket = new WebSocket(scheme + window.location.host + collab.dataset.socket);
+		socket.addEventListener("message", receive);
+		socket.addEventListener("close", function() {
+			editor.readOnly = true;
+			if (closed) return;
+			// Changes which the server hadn't acknowledged are lost, because there's no telling whether it applied them.
+			stateLabel.textContent = "Disconnected. Reconnecting…";
+			setTimeout(connect, 3000);
+		});
+	};
+
+	editor.addEventListener("input", diff);
+	setInterval(function() {
+		if (socket.readyState == WebSocket.OPEN) {
+			socket.send(JSON.stringify({type: "ping"}));
+		}
+	}, 30000);
+	connect();
+}